@@ -22,7 +22,10 @@ import (
 	"github.com/tribehq/platform/lib/database"
 	"github.com/tribehq/platform/lib/log/echo_logger"
 	"github.com/tribehq/platform/lib/log/log_formatter"
+	"github.com/tribehq/platform/lib/payments/paytm"
+	"github.com/tribehq/platform/lib/payments/razorpay"
 	smw "github.com/tribehq/platform/middleware"
+	"github.com/tribehq/platform/models"
 	"github.com/tribehq/platform/resolvers"
 	"github.com/tribehq/platform/utils/auth"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
@@ -93,6 +96,71 @@ func main() {
 
 	//Initialize RBAC
 	auth.InitRBAC()
+
+	//Start and end scheduled sales and price rules
+	go models.RunPriceScheduler(time.Minute)
+	//Remind customers of the carts they left
+	go models.RunCartRecovery(15 * time.Minute)
+	//Renew subscriptions and retry their failed charges
+	go models.RunSubscriptionBilling(15 * time.Minute)
+	//Fail product imports whose server went away mid import
+	go models.RunProductImportRecovery(5 * time.Minute)
+	//Remind customers of the saved cards about to expire
+	go models.RunPaymentMethodExpiryReminders(6 * time.Hour)
+	//Release the held payment transfers of completed orders and jobs
+	go models.RunPaymentTransferRelease(time.Hour)
+	//Check the payouts of withdrawals whose payout webhooks didn't come through
+	go models.RunWithdrawalPayoutChecks(15 * time.Minute)
+
+	//Stripe payment intents, paid with cards tokenized by stripe.js
+	payments.RegisterGateway(payments.NewStripeGateway(os.Getenv("STRIPE_APISECRET"), os.Getenv("STRIPE_WEBHOOK_SECRET")))
+	//Razorpay checkout payments, split with stores and providers through razorpay route
+	razorpayClient := razorpay.New(os.Getenv("RAZORPAY_APIKEY"), os.Getenv("RAZORPAY_APISECRET"))
+	razorpayClient.WebhookSecret = os.Getenv("RAZORPAY_WEBHOOK_SECRET")
+	payments.RegisterGateway(payments.NewRazorpayGateway(razorpayClient))
+	//Withdrawals of providers paid out through razorpayx
+	if accountNumber := os.Getenv("RAZORPAYX_ACCOUNT_NUMBER"); accountNumber != "" {
+		models.RegisterPayoutProvider("razorpay", razorpay.NewPayouts(razorpayClient, accountNumber))
+	}
+	//Paytm checkout and linked paytm wallets
+	payments.RegisterGateway(payments.NewPaytmGateway(&paytm.Paytm{
+		MerchantMID:               os.Getenv("PAYTM_MERCHANT_MID"),
+		MerchantKey:               os.Getenv("PAYTM_MERCHANT_KEY"),
+		MerchantWebsite:           os.Getenv("PAYTM_MERCHANT_WEBSITE"),
+		IndustryType:              os.Getenv("PAYTM_INDUSTRY_TYPE"),
+		ChannelID:                 os.Getenv("PAYTM_CHANNEL_ID"),
+		ClientID:                  os.Getenv("PAYTM_CLIENT_ID"),
+		ClientSecret:              os.Getenv("PAYTM_CLIENT_SECRET"),
+		CallbackURL:               os.Getenv("PAYTM_CALLBACK_URL"),
+		TransactionStatusAPIURL:   os.Getenv("PAYTM_TRANSACTION_STATUS_API_URL"),
+		SendOTPAPIURL:             os.Getenv("PAYTM_SEND_OTP_API_URL"),
+		ValidateOTPAPIURL:         os.Getenv("PAYTM_VALIDATE_OTP_API_URL"),
+		UserDetailsAPIURL:         os.Getenv("PAYTM_USER_DETAILS_API_URL"),
+		RevokeAccessAPIURL:        os.Getenv("PAYTM_REVOKE_ACCESS_API_URL"),
+		CheckBalanceAPIURL:        os.Getenv("PAYTM_CHECK_BALANCE_API_URL"),
+		WithdrawAPIURL:            os.Getenv("PAYTM_WITHDRAW_API_URL"),
+		InitiateTransactionAPIURL: os.Getenv("PAYTM_INITIATE_TRANSACTION_API_URL"),
+		ProcessTransactionURL:     os.Getenv("PAYTM_PROCESS_TRANSACTION_URL"),
+		RefundAPIURL:              os.Getenv("PAYTM_REFUND_API_URL"),
+	}))
+	//In-memory payment gateway for offline development and testing
+	if os.Getenv("PAYMENT_FAKE_GATEWAY") == "true" {
+		payments.RegisterGateway(payments.NewFakeGateway(os.Getenv("PAYMENT_FAKE_WEBHOOK_SECRET")))
+	}
+	payments.SetDefaultGateway(os.Getenv("PAYMENT_DEFAULT_GATEWAY"))
+	//UPI collect and intent payments, through a simulated bank for offline development and testing
+	if os.Getenv("UPI_SIMULATOR") == "true" {
+		upiSimulator := payments.NewUPISimulator(os.Getenv("UPI_SIMULATOR_SECRET"))
+		upiSimulator.AutoApprove = os.Getenv("UPI_SIMULATOR_AUTO_APPROVE") == "true"
+		payments.RegisterUPIBank(upiSimulator, models.UPIMerchantAccount{
+			MID:  os.Getenv("UPI_MERCHANT_MID"),
+			VPA:  os.Getenv("UPI_MERCHANT_VPA"),
+			Name: os.Getenv("UPI_MERCHANT_NAME"),
+			MCC:  os.Getenv("UPI_MERCHANT_MCC"),
+		})
+	}
+	//Poll the bank for UPI payments whose callback didn't come
+	go payments.RunUPIStatusPolling(30 * time.Second)
 	e.Any("/", echo.WrapHandler(handler.Playground("GraphQL Playground", "/graphql")))
 	e.Any("/graphql", echo.WrapHandler(handler.GraphQL(
 		resolvers.NewExecutableSchema(resolvers.Config{Resolvers: &resolvers.Resolver{}, Directives: directives.Directives}),
@@ -111,12 +179,17 @@ func main() {
 	hooks.POST("/hooks/razorpay", payments.RazorPayWebHookHandler)
 	//Paytm Payments Handling
 	hooks.POST("/hooks/paytm", payments.PaytmWebHookHandler)
+	hooks.POST("/hooks/paytm/callback", payments.PaytmCallbackHandler)
+	//UPI Payments Handling
+	hooks.POST("/hooks/upi", payments.UPICallbackHandler)
 	//Braintree Payments Payments Handling
 	hooks.POST("/hooks/braintree", payments.BraintreeWebHookHandler)
 	//Wechat Payments Handling
 	hooks.POST("/hooks/wechat", payments.WechatPayWebHookHandler)
 	//AliPay Payments Handling
 	hooks.POST("/hooks/alipay", payments.AliPayWebHookHandler)
+	//Fake Payments Handling
+	hooks.POST("/hooks/fake", payments.WebHookHandler(payments.FakeGatewayName))
 	//Google DialogFlow - Google Actions, Cortana, Siri, Alexa & Chatbots
 	hooks.POST("/hooks/dialogflow", chatbots.DialogFlowWebHookHandler)
 
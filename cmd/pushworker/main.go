@@ -79,6 +79,10 @@ func DeliverPush(ctx context.Context, m PubSubMessage) error {
 		message.Condition = req.Condition
 	}
 
+	if req.Title != "" || req.Body != "" {
+		message.Notification = &messaging.Notification{Title: req.Title, Body: req.Body}
+	}
+
 	// Send a message to the device corresponding to the provided
 	// registration token.
 	response, err := client.Send(ctx, message)
@@ -4,8 +4,175 @@
 
 package main
 
-//Settlements Worker
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	_ "github.com/joho/godotenv/autoload"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/database"
+	"github.com/tribehq/platform/lib/log/log_formatter"
+	"github.com/tribehq/platform/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func init() {
+	//Logrus Settings
+	log.SetFormatter(log_formatter.NewFormatter())
+	log.SetReportCaller(true)
+}
+
+//Settlements Worker, settles stores and providers for a period and writes the bank payout files of what is owed to them
 func main() {
+	from := flag.String("from", "", "start of the settlement period, YYYY-MM-DD, defaults to yesterday")
+	to := flag.String("to", "", "end of the settlement period (exclusive), YYYY-MM-DD, defaults to today")
+	outDir := flag.String("out", ".", "directory the payout files are written to")
+	bankFormatFile := flag.String("bank-format", "", "JSON file describing the bank payout file format, defaults to the Axis Bank bulk upload")
+	paidFile := flag.String("paid", "", "mark the settlements of this payout file paid and exit")
+	flag.Parse()
+
+	database.ConnectMongo() //Connect to MongoDB
+	now := time.Now().UTC()
+
+	if *paidFile != "" {
+		count, err := models.MarkSettlementsPaid(filepath.Base(*paidFile), now)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		log.Infof("%d settlements of %s marked paid", count, *paidFile)
+		return
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	start, end := today.AddDate(0, 0, -1), today
+	var err error
+	if *from != "" {
+		start, err = time.Parse("2006-01-02", *from)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+	if *to != "" {
+		end, err = time.Parse("2006-01-02", *to)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+	bankFormat := models.AxisBankFileFormat
+	if *bankFormatFile != "" {
+		data, err := ioutil.ReadFile(*bankFormatFile)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		bankFormat = models.BankFileFormat{}
+		err = json.Unmarshal(data, &bankFormat)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+	err = bankFormat.Validate()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	settlements, err := models.RunSettlements(start, end, primitive.NilObjectID)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	for _, settlement := range settlements {
+		log.WithFields(log.Fields{
+			"settlementId": settlement.ID.Hex(),
+			"payeeType":    settlement.PayeeType,
+			"payeeId":      settlement.PayeeID.Hex(),
+			"currency":     settlement.Currency,
+			"netAmount":    settlement.NetAmount,
+			"status":       settlement.Status,
+		}).Infoln("Settled")
+	}
+
+	payouts, err := models.GetSettlementPayouts()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	achPayouts, bankPayouts := models.SplitACHPayouts(payouts)
+	//the file id keeps the files of runs started in the same second apart
+	stamp := now.Format("20060102150405") + "-" + primitive.NewObjectID().Hex()
+
 	//Do ACH deposits
+	if len(achPayouts) > 0 {
+		originator := models.NACHAOriginator{
+			ImmediateDestination:     os.Getenv("ACH_IMMEDIATE_DESTINATION"),
+			ImmediateDestinationName: os.Getenv("ACH_IMMEDIATE_DESTINATION_NAME"),
+			ImmediateOrigin:          os.Getenv("ACH_IMMEDIATE_ORIGIN"),
+			ImmediateOriginName:      os.Getenv("ACH_IMMEDIATE_ORIGIN_NAME"),
+			CompanyName:              os.Getenv("ACH_COMPANY_NAME"),
+			CompanyID:                os.Getenv("ACH_COMPANY_ID"),
+			OriginatingDFI:           os.Getenv("ACH_ORIGINATING_DFI"),
+			EntryDescription:         os.Getenv("ACH_ENTRY_DESCRIPTION"),
+		}
+		err = writePayoutFile(filepath.Join(*outDir, "ach-"+stamp+".txt"), achPayouts, now, func(w io.Writer, claimed []models.SettlementPayout) error {
+			return models.WriteNACHAFile(w, originator, claimed, now)
+		})
+		if err != nil {
+			log.Errorln(err)
+		}
+	}
+
 	//Do AxisBank FileUpload deposits
+	if len(bankPayouts) > 0 {
+		extension := ".csv"
+		if bankFormat.Layout == models.BankFileLayoutFixed {
+			extension = ".txt"
+		}
+		err = writePayoutFile(filepath.Join(*outDir, "bank-"+stamp+extension), bankPayouts, now, func(w io.Writer, claimed []models.SettlementPayout) error {
+			return models.WriteBankFile(w, bankFormat, claimed, now)
+		})
+		if err != nil {
+			log.Errorln(err)
+		}
+	}
+}
+
+//writePayoutFile claims the settlements of the payouts for a payout file, writes the ones it claimed and marks them exported.
+//The file is removed and the settlements given back when it can't be written in full.
+func writePayoutFile(path string, payouts []models.SettlementPayout, now time.Time, write func(w io.Writer, claimed []models.SettlementPayout) error) error {
+	payoutFile := filepath.Base(path)
+	claimed, err := models.ClaimSettlementPayouts(payouts, payoutFile, now)
+	if err != nil {
+		return err
+	}
+	if len(claimed) == 0 {
+		log.Infof("payouts of %s were claimed by another run", path)
+		return nil
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err == nil {
+		err = write(file, claimed)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path)
+		}
+	}
+	if err != nil {
+		if releaseErr := models.ReleaseSettlementPayouts(payoutFile, now); releaseErr != nil {
+			log.Errorln(releaseErr)
+		}
+		return err
+	}
+	count, err := models.MarkSettlementsExported(payoutFile, now)
+	if err != nil {
+		return err
+	}
+	if count != len(claimed) {
+		return fmt.Errorf("%d payouts written to %s but %d settlements marked exported, check the file before sending it", len(claimed), path, count)
+	}
+	log.Infof("%d payouts written to %s", len(claimed), path)
+	return nil
 }
@@ -214,6 +214,9 @@ func main() {
 	//Checkout
 	e.GET("/checkout/:cartId", shop.GetCheckoutCart)
 
+	//Downloadable product files
+	e.GET("/downloads/:id", shop.GetDownload)
+
 	//TODO handle 404 and other edge cases
 	//Sitemaps for products / collections / pages / blogs etc.,
 	e.GET("/sitemap.xml", shop.RootSiteMap)
@@ -0,0 +1,47 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package main
+
+import (
+	_ "github.com/joho/godotenv/autoload"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/database"
+	"github.com/tribehq/platform/lib/log/log_formatter"
+	"github.com/tribehq/platform/models"
+	"os"
+)
+
+func init() {
+	//Logrus Settings
+	log.SetFormatter(log_formatter.NewFormatter())
+	log.SetReportCaller(true)
+}
+
+//Wallet Reconciliation, checks every wallet balance against its postings and exits non zero on any mismatch
+func main() {
+	database.ConnectMongo() //Connect to MongoDB
+	discrepancies, err := models.ReconcileWallets()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	for _, discrepancy := range discrepancies {
+		fields := log.Fields{
+			"walletId":      discrepancy.WalletID.Hex(),
+			"balance":       discrepancy.Balance,
+			"postedBalance": discrepancy.PostedBalance,
+			"heldBalance":   discrepancy.HeldBalance,
+			"activeHolds":   discrepancy.ActiveHolds,
+		}
+		if discrepancy.PostingID != nil {
+			fields["postingId"] = discrepancy.PostingID.Hex()
+		}
+		log.WithFields(fields).Errorln(discrepancy.Reason)
+	}
+	if len(discrepancies) > 0 {
+		log.Errorf("%d wallet discrepancies found", len(discrepancies))
+		os.Exit(1)
+	}
+	log.Infoln("All wallet balances match their postings")
+}
@@ -0,0 +1,410 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/tribehq/platform/models"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeGatewayName is the name the fake gateway is registered under.
+const FakeGatewayName = "fake"
+
+// FakeSignatureHeader is the header the fake gateway signs its webhooks in.
+const FakeSignatureHeader = "X-Fake-Signature"
+
+// Cards the fake gateway treats specially, every other card number with a valid checksum is approved.
+const (
+	FakeCardDeclined          = "4000000000000002"
+	FakeCardInsufficientFunds = "4000000000009995"
+)
+
+// FakeGateway is an in-memory payment gateway for tests and offline development.
+// It is deterministic: ids are numbered in the order things are created, and every change to a payment
+// queues the webhook event a real gateway would send, signed with the gateway's secret.
+type FakeGateway struct {
+	Secret string
+	// Now gives the time disputes are opened at, time.Now when nil.
+	Now func() time.Time
+
+	mu       sync.Mutex
+	seq      int
+	tokens   map[string]*PaymentToken
+	cards    map[string]string // card number by token
+	payments map[string]*Payment
+	refunds  map[string]*Refund // by our refund id
+	byRef    map[string]*Payment
+	events   []*WebhookEvent
+}
+
+// NewFakeGateway gives a fake gateway signing its webhooks with the secret.
+func NewFakeGateway(secret string) *FakeGateway {
+	return &FakeGateway{
+		Secret:   secret,
+		tokens:   map[string]*PaymentToken{},
+		cards:    map[string]string{},
+		payments: map[string]*Payment{},
+		refunds:  map[string]*Refund{},
+		byRef:    map[string]*Payment{},
+	}
+}
+
+// Name is the name the fake gateway is registered under.
+func (g *FakeGateway) Name() string {
+	return FakeGatewayName
+}
+
+// nextID gives the next id with the prefix, the caller holds the lock.
+func (g *FakeGateway) nextID(prefix string) string {
+	g.seq++
+	return fmt.Sprintf("fake_%s_%d", prefix, g.seq)
+}
+
+// queue records the webhook event of a payment change, the caller holds the lock.
+func (g *FakeGateway) queue(eventType WebhookEventType, payment *Payment, reason string) *WebhookEvent {
+	event := &WebhookEvent{
+		ID:   g.nextID("evt"),
+		Type: eventType,
+		Payment: models.GatewayPaymentUpdate{
+			Gateway:   FakeGatewayName,
+			PaymentID: payment.ID,
+			OrderID:   payment.OrderID,
+			JobID:     payment.JobID,
+			Amount:    payment.Amount,
+			Currency:  payment.Currency,
+			Reason:    reason,
+		},
+	}
+	g.events = append(g.events, event)
+	return event
+}
+
+// FakeCard is a card the fake gateway tokenizes, standing in for a gateway's client library.
+type FakeCard struct {
+	CardNumber string
+	ExpMonth   int
+	ExpYear    int
+}
+
+// Tokenize stores the card and gives a token to pay with it, as a gateway's client library would in the customer's browser.
+func (g *FakeGateway) Tokenize(request FakeCard) (*PaymentToken, error) {
+	number := strings.Replace(request.CardNumber, " ", "", -1)
+	if !luhnValid(number) {
+		return nil, ErrPaymentDeclined
+	}
+	if request.ExpMonth < 1 || request.ExpMonth > 12 || request.ExpYear < 1 {
+		return nil, ErrPaymentDeclined
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	token := &PaymentToken{
+		Token:    g.nextID("tok"),
+		Brand:    cardBrand(number),
+		Last4:    number[len(number)-4:],
+		ExpMonth: request.ExpMonth,
+		ExpYear:  request.ExpYear,
+	}
+	token.Fingerprint = g.sign([]byte(number))[:32]
+	g.tokens[token.Token] = token
+	g.cards[token.Token] = number
+	return token, nil
+}
+
+// AttachPaymentMethod keeps a tokenized card for the customer, making the user a customer when they have none yet.
+func (g *FakeGateway) AttachPaymentMethod(request AttachRequest) (*PaymentToken, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	token, ok := g.tokens[request.Token]
+	if !ok {
+		return nil, ErrInvalidPaymentToken
+	}
+	if token.CustomerID == "" {
+		token.CustomerID = request.CustomerID
+		if token.CustomerID == "" {
+			token.CustomerID = "fake_cus_" + request.UserID
+		}
+	}
+	copied := *token
+	return &copied, nil
+}
+
+// Authorize takes the payment with a token, declining the fake gateway's declined cards.
+// A payment made again with the same reference gives back the first one.
+func (g *FakeGateway) Authorize(request PaymentRequest) (*Payment, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if request.Reference != "" {
+		if payment, ok := g.byRef[request.Reference]; ok {
+			copied := *payment
+			return &copied, nil
+		}
+	}
+	number, ok := g.cards[request.Token]
+	if !ok {
+		return nil, ErrInvalidPaymentToken
+	}
+	if request.Amount <= 0 {
+		return nil, fmt.Errorf("invalid payment amount %.2f", request.Amount)
+	}
+	payment := &Payment{
+		ID:        g.nextID("pay"),
+		Reference: request.Reference,
+		OrderID:   request.OrderID,
+		JobID:     request.JobID,
+		Status:    PaymentStatusAuthorized,
+		Amount:    request.Amount,
+		Currency:  strings.ToUpper(request.Currency),
+	}
+	switch number {
+	case FakeCardDeclined:
+		payment.FailureReason = "card declined"
+	case FakeCardInsufficientFunds:
+		payment.FailureReason = "insufficient funds"
+	}
+	g.payments[payment.ID] = payment
+	if request.Reference != "" {
+		g.byRef[request.Reference] = payment
+	}
+	if payment.FailureReason != "" {
+		payment.Status = PaymentStatusFailed
+		g.queue(WebhookEventPaymentFailed, payment, payment.FailureReason)
+		copied := *payment
+		return &copied, ErrPaymentDeclined
+	}
+	if request.Capture {
+		payment.Status = PaymentStatusCaptured
+		payment.CapturedAmount = payment.Amount
+		g.queue(WebhookEventPaymentSucceeded, payment, "")
+	}
+	copied := *payment
+	return &copied, nil
+}
+
+// Capture captures part or all of an authorized payment, the whole of it when the amount is zero.
+func (g *FakeGateway) Capture(paymentID string, amount float64) (*Payment, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	payment, ok := g.payments[paymentID]
+	if !ok {
+		return nil, ErrPaymentNotFound
+	}
+	if payment.Status != PaymentStatusAuthorized {
+		return nil, ErrInvalidPaymentState
+	}
+	if amount <= 0 {
+		amount = payment.Amount
+	}
+	if amount > payment.Amount {
+		return nil, fmt.Errorf("capture of %.2f exceeds the authorized %.2f", amount, payment.Amount)
+	}
+	payment.Status = PaymentStatusCaptured
+	payment.CapturedAmount = amount
+	event := g.queue(WebhookEventPaymentSucceeded, payment, "")
+	event.Payment.Amount = amount
+	copied := *payment
+	return &copied, nil
+}
+
+// Void releases an authorized payment.
+func (g *FakeGateway) Void(paymentID string) (*Payment, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	payment, ok := g.payments[paymentID]
+	if !ok {
+		return nil, ErrPaymentNotFound
+	}
+	if payment.Status != PaymentStatusAuthorized {
+		return nil, ErrInvalidPaymentState
+	}
+	payment.Status = PaymentStatusVoided
+	g.queue(WebhookEventPaymentCancelled, payment, "voided")
+	copied := *payment
+	return &copied, nil
+}
+
+// Refund refunds part or all of a captured payment, the rest of it when the amount is zero.
+// A refund made again with the same refund id gives back the first one.
+func (g *FakeGateway) Refund(request RefundRequest) (*Refund, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if request.RefundID != "" {
+		if refund, ok := g.refunds[request.RefundID]; ok {
+			copied := *refund
+			return &copied, nil
+		}
+	}
+	payment, ok := g.payments[request.PaymentID]
+	if !ok {
+		return nil, ErrPaymentNotFound
+	}
+	if payment.Status != PaymentStatusCaptured {
+		return nil, ErrInvalidPaymentState
+	}
+	remaining := math.Round((payment.CapturedAmount-payment.RefundedAmount)*100) / 100
+	amount := request.Amount
+	if amount <= 0 {
+		amount = remaining
+	}
+	if amount > remaining {
+		return nil, ErrRefundExceedsPayment
+	}
+	refund := &Refund{
+		ID:        g.nextID("re"),
+		RefundID:  request.RefundID,
+		PaymentID: payment.ID,
+		Amount:    amount,
+	}
+	if request.RefundID != "" {
+		g.refunds[request.RefundID] = refund
+	}
+	payment.RefundedAmount = math.Round((payment.RefundedAmount+amount)*100) / 100
+	event := g.queue(WebhookEventPaymentRefunded, payment, "")
+	event.Refunds = []models.GatewayRefundUpdate{{
+		GatewayRefundID: refund.ID,
+		RefundID:        refund.RefundID,
+		Amount:          refund.Amount,
+		Reason:          request.Reason,
+	}}
+	event.TotalRefunded = payment.RefundedAmount
+	copied := *refund
+	return &copied, nil
+}
+
+// Dispute opens a dispute of a captured payment, as a customer's bank would.
+func (g *FakeGateway) Dispute(paymentID string, reason string) (*WebhookEvent, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	payment, ok := g.payments[paymentID]
+	if !ok {
+		return nil, ErrPaymentNotFound
+	}
+	if payment.Status != PaymentStatusCaptured {
+		return nil, ErrInvalidPaymentState
+	}
+	now := time.Now
+	if g.Now != nil {
+		now = g.Now
+	}
+	event := g.queue(WebhookEventPaymentDisputed, payment, "")
+	event.Dispute = &models.PaymentDispute{
+		ID:       g.nextID("dp"),
+		Amount:   payment.CapturedAmount - payment.RefundedAmount,
+		Currency: payment.Currency,
+		Reason:   reason,
+		Status:   models.PaymentDisputeStatusOpen,
+		OpenedAt: now(),
+	}
+	return event, nil
+}
+
+// GetPayment gives a payment of the fake gateway.
+func (g *FakeGateway) GetPayment(paymentID string) (*Payment, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	payment, ok := g.payments[paymentID]
+	if !ok {
+		return nil, ErrPaymentNotFound
+	}
+	copied := *payment
+	return &copied, nil
+}
+
+// Events gives the webhook events queued since they were last taken, in the order they happened.
+func (g *FakeGateway) Events() []*WebhookEvent {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	events := g.events
+	g.events = nil
+	return events
+}
+
+// WebhookRequest gives the signed body and headers the fake gateway would post for an event.
+func (g *FakeGateway) WebhookRequest(event *WebhookEvent) ([]byte, http.Header, error) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, nil, err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set(FakeSignatureHeader, g.sign(body))
+	return body, header, nil
+}
+
+// sign gives the hex HMAC-SHA256 of the body with the gateway's secret.
+func (g *FakeGateway) sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(g.Secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook checks the webhook is signed with the gateway's secret.
+func (g *FakeGateway) VerifyWebhook(header http.Header, body []byte) error {
+	signature := header.Get(FakeSignatureHeader)
+	if signature == "" || !hmac.Equal([]byte(signature), []byte(g.sign(body))) {
+		return ErrInvalidWebhookSignature
+	}
+	return nil
+}
+
+// ParseWebhookEvent reads a webhook of the fake gateway.
+func (g *FakeGateway) ParseWebhookEvent(body []byte) (*WebhookEvent, error) {
+	event := &WebhookEvent{}
+	err := json.Unmarshal(body, event)
+	if err != nil {
+		return nil, err
+	}
+	if event.ID == "" || event.Type == "" {
+		return nil, nil
+	}
+	return event, nil
+}
+
+// luhnValid checks the card number's check digit.
+func luhnValid(number string) bool {
+	if len(number) < 12 || len(number) > 19 {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		digit := int(number[i] - '0')
+		if digit < 0 || digit > 9 {
+			return false
+		}
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// cardBrand gives the brand of a card number from its prefix.
+func cardBrand(number string) string {
+	switch {
+	case strings.HasPrefix(number, "4"):
+		return "visa"
+	case strings.HasPrefix(number, "34"), strings.HasPrefix(number, "37"):
+		return "amex"
+	case number[0] == '5' && number[1] >= '1' && number[1] <= '5', strings.HasPrefix(number, "2"):
+		return "mastercard"
+	case strings.HasPrefix(number, "60"), strings.HasPrefix(number, "65"), strings.HasPrefix(number, "81"), strings.HasPrefix(number, "82"):
+		return "rupay"
+	}
+	return "unknown"
+}
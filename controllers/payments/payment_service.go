@@ -4,5 +4,394 @@
 
 package payments
 
+import (
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/models"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PaymentStatus is the state of a payment at a payment gateway.
+type PaymentStatus string
+
+// Statuses of a payment at a payment gateway.
+const (
+	PaymentStatusPending    PaymentStatus = "pending" // waiting for the customer to pay at the gateway
+	PaymentStatusAuthorized PaymentStatus = "authorized"
+	PaymentStatusCaptured   PaymentStatus = "captured"
+	PaymentStatusVoided     PaymentStatus = "voided"
+	PaymentStatusFailed     PaymentStatus = "failed"
+)
+
+// WebhookEventType is the kind of change a payment gateway webhook tells us about.
+type WebhookEventType string
+
+// Types of payment gateway webhook events.
+const (
+	WebhookEventPaymentSucceeded WebhookEventType = "payment.succeeded"
+	WebhookEventPaymentFailed    WebhookEventType = "payment.failed"
+	WebhookEventPaymentCancelled WebhookEventType = "payment.cancelled"
+	WebhookEventPaymentRefunded  WebhookEventType = "payment.refunded"
+	WebhookEventPaymentDisputed  WebhookEventType = "payment.disputed"
+	WebhookEventPayoutUpdated    WebhookEventType = "payout.updated"
+)
+
+var (
+	// ErrGatewayNotFound is returned when no payment gateway is registered under a name.
+	ErrGatewayNotFound = errors.New("payment gateway not found")
+	// ErrGatewayNotSelected is returned when paying through a gateway other than the one the store or market takes payments through.
+	ErrGatewayNotSelected = errors.New("payments are not taken through this payment gateway")
+	// ErrPaymentNotFound is returned when the gateway doesn't know the payment.
+	ErrPaymentNotFound = errors.New("payment not found")
+	// ErrPaymentDeclined is returned when the gateway declines the payment.
+	ErrPaymentDeclined = models.ErrPaymentDeclined
+	// ErrInvalidPaymentState is returned when the payment can't be captured, voided or refunded in its current state.
+	ErrInvalidPaymentState = errors.New("payment can't be changed in its current state")
+	// ErrRefundExceedsPayment is returned when a refund is for more than is left of the captured amount.
+	ErrRefundExceedsPayment = errors.New("refund exceeds the captured amount")
+	// ErrInvalidPaymentToken is returned when a payment token is unknown to the gateway.
+	ErrInvalidPaymentToken = errors.New("invalid payment token")
+	// ErrInvalidWebhookSignature is returned when a webhook isn't signed by the gateway.
+	ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+	// ErrNotSupported is returned for operations a payment gateway doesn't offer.
+	ErrNotSupported = errors.New("not supported by the payment gateway")
+)
+
+// PaymentRequest describes a payment to take through a payment gateway.
+type PaymentRequest struct {
+	Reference   string // our id for the payment, gateways use it as the idempotency key
+	OrderID     string
+	JobID       string
+	StoreID     string  // the store paid, when the payment is for a single store
+	Amount      float64 // in the major unit of the currency
+	Currency    string
+	Token       string // the tokenized or saved payment method to pay with
+	CustomerID  string // the gateway's customer, when paying with a saved payment method
+	Description string
+	Capture     bool // capture the payment right away instead of only authorizing it
+}
+
+// paymentAttemptSeparator separates the order or job id of a payment reference from the attempt.
+const paymentAttemptSeparator = "_"
+
+// PaymentAttemptReference gives the reference of an attempt to pay an order or job. Gateways like paytm take
+// an order id only once, so each attempt to pay gets its own and a payment can be tried again after it failed.
+func PaymentAttemptReference(id string) string {
+	return id + paymentAttemptSeparator + strconv.FormatInt(time.Now().UnixNano(), 36)
+}
+
+// paymentReferenceID gives the order or job id of a payment reference, with the attempt taken off.
+func paymentReferenceID(reference string) string {
+	return strings.SplitN(reference, paymentAttemptSeparator, 2)[0]
+}
+
+// Payment is a payment at a payment gateway.
+type Payment struct {
+	ID             string
+	Reference      string
+	OrderID        string
+	JobID          string
+	Status         PaymentStatus
+	Amount         float64
+	CapturedAmount float64
+	RefundedAmount float64
+	Currency       string
+	FailureReason  string
+}
+
+// RefundRequest describes a refund of a captured payment.
+type RefundRequest struct {
+	RefundID  string // our refund id, gateways use it as the idempotency key
+	OrderID   string // the order the payment was taken for
+	PaymentID string
+	Amount    float64
+	Currency  string
+	Reason    string
+}
+
+// Refund is a refund issued by a payment gateway.
+type Refund struct {
+	ID        string
+	RefundID  string
+	PaymentID string
+	Amount    float64
+}
+
+// AttachRequest asks a payment gateway to keep a payment method its client library tokenized for a customer of ours.
+type AttachRequest struct {
+	Token      string // the payment method the card was tokenized into in the customer's browser or app
+	UserID     string
+	CustomerID string // the gateway's customer of the user, when they have one already
+}
+
+// PaymentToken stands in for a payment method at a payment gateway.
+type PaymentToken struct {
+	Token       string
+	CustomerID  string // the gateway's customer the payment method is kept for
+	Brand       string
+	Last4       string
+	ExpMonth    int
+	ExpYear     int
+	Fingerprint string // the same for every token of a card, so a card saved twice can be told apart
+}
+
+// WebhookEvent is a payment gateway webhook event in the terms of our orders and jobs.
+type WebhookEvent struct {
+	ID            string                       `json:"id"`
+	Type          WebhookEventType             `json:"type"`
+	Payment       models.GatewayPaymentUpdate  `json:"payment"`
+	Refunds       []models.GatewayRefundUpdate `json:"refunds,omitempty"`
+	TotalRefunded float64                      `json:"totalRefunded,omitempty"`
+	Dispute       *models.PaymentDispute       `json:"dispute,omitempty"`
+	Payout        *models.PayoutResult         `json:"payout,omitempty"`
+}
+
+// PaymentGateway takes payments through a payment provider.
 type PaymentGateway interface {
+	// Name is the name the gateway is registered and recorded under.
+	Name() string
+	// Authorize takes the payment, or only holds the amount until it is captured when the request doesn't capture.
+	Authorize(request PaymentRequest) (*Payment, error)
+	// Capture captures part or all of an authorized payment.
+	Capture(paymentID string, amount float64) (*Payment, error)
+	// Refund refunds part or all of a captured payment.
+	Refund(request RefundRequest) (*Refund, error)
+	// Void releases an authorized payment that hasn't been captured.
+	Void(paymentID string) (*Payment, error)
+	// AttachPaymentMethod keeps a payment method tokenized by the gateway's client library for the customer to pay with later.
+	// Card details are only ever given to the gateway's client library, never to us.
+	AttachPaymentMethod(request AttachRequest) (*PaymentToken, error)
+	// VerifyWebhook checks the webhook was sent by the gateway.
+	VerifyWebhook(header http.Header, body []byte) error
+	// ParseWebhookEvent reads a verified webhook, nil when it is an event we don't act on.
+	ParseWebhookEvent(body []byte) (*WebhookEvent, error)
+}
+
+// PaymentSplitter is implemented by gateways that split captured payments with the stores and providers they are for.
+type PaymentSplitter interface {
+	// SplitPayment transfers the shares of a captured payment to the linked accounts of its stores or provider.
+	SplitPayment(payment models.GatewayPaymentUpdate) error
+}
+
+var (
+	gatewaysMu     sync.RWMutex
+	gateways       = map[string]PaymentGateway{}
+	defaultGateway string
+)
+
+// RegisterGateway makes a payment gateway available under its name. The gateway also becomes the one
+// order refunds and subscription charges of payments recorded under that name go through, and the one
+// the transfers it made are released and reversed through when it splits payments.
+func RegisterGateway(gateway PaymentGateway) {
+	name := strings.ToLower(gateway.Name())
+	gatewaysMu.Lock()
+	gateways[name] = gateway
+	gatewaysMu.Unlock()
+	models.RegisterPaymentRefunder(name, gatewayRefunder{gateway: gateway})
+	models.RegisterPaymentCharger(name, gatewayCharger{gateway: gateway})
+	if transferrer, ok := gateway.(models.PaymentTransferrer); ok {
+		models.RegisterPaymentTransferrer(name, transferrer)
+	}
+}
+
+// GetGateway gives the payment gateway registered under a name.
+func GetGateway(name string) (PaymentGateway, error) {
+	gatewaysMu.RLock()
+	defer gatewaysMu.RUnlock()
+	gateway, ok := gateways[strings.ToLower(name)]
+	if !ok {
+		return nil, ErrGatewayNotFound
+	}
+	return gateway, nil
+}
+
+// SetDefaultGateway sets the gateway used where neither the market settings nor the store name one.
+func SetDefaultGateway(name string) {
+	gatewaysMu.Lock()
+	defer gatewaysMu.Unlock()
+	defaultGateway = strings.ToLower(name)
+}
+
+// GatewayNameFor gives the name of the gateway payments to a store go through: the store's own, else the market's, else the default.
+func GatewayNameFor(storeID string) string {
+	if name := models.PaymentGatewayNameFor(storeID); name != "" {
+		return name
+	}
+	gatewaysMu.RLock()
+	defer gatewaysMu.RUnlock()
+	return defaultGateway
+}
+
+// GatewayFor gives the gateway payments to a store go through, the market's or the default one when no store is given.
+func GatewayFor(storeID string) (PaymentGateway, error) {
+	name := GatewayNameFor(storeID)
+	if name == "" {
+		return nil, ErrGatewayNotFound
+	}
+	return GetGateway(name)
+}
+
+// checkGatewaySelected makes sure payments to a store are meant to go through the gateway.
+// Any gateway may be used when none is selected.
+func checkGatewaySelected(name string, storeID string) error {
+	selected := GatewayNameFor(storeID)
+	if selected != "" && selected != strings.ToLower(name) {
+		return ErrGatewayNotSelected
+	}
+	return nil
+}
+
+// gatewayRefunder issues order refunds through a payment gateway.
+type gatewayRefunder struct {
+	gateway PaymentGateway
+}
+
+// RefundPayment refunds the order's payment.
+func (r gatewayRefunder) RefundPayment(refund models.GatewayRefund) (string, error) {
+	gatewayRefund, err := r.gateway.Refund(RefundRequest{
+		RefundID:  refund.RefundID,
+		OrderID:   refund.OrderID,
+		PaymentID: refund.PaymentID,
+		Amount:    refund.Amount,
+		Currency:  refund.Currency,
+		Reason:    refund.Reason,
+	})
+	if err != nil {
+		return "", err
+	}
+	return gatewayRefund.ID, nil
+}
+
+// gatewayCharger charges saved payment methods through a payment gateway.
+type gatewayCharger struct {
+	gateway PaymentGateway
+}
+
+// ChargePayment takes and captures the payment with the customer's saved payment method.
+func (c gatewayCharger) ChargePayment(charge models.GatewayCharge) (string, error) {
+	payment, err := c.gateway.Authorize(PaymentRequest{
+		Reference:   charge.ChargeID,
+		OrderID:     charge.OrderID,
+		JobID:       charge.JobID,
+		Amount:      charge.Amount,
+		Currency:    charge.Currency,
+		Token:       charge.PaymentMethodID,
+		CustomerID:  charge.CustomerID,
+		Description: charge.Description,
+		Capture:     true,
+	})
+	if err != nil {
+		if payment != nil {
+			return payment.ID, err
+		}
+		return "", err
+	}
+	if payment.Status != PaymentStatusCaptured {
+		return payment.ID, fmt.Errorf("%s payment %s is %s", c.gateway.Name(), payment.ID, payment.Status)
+	}
+	return payment.ID, nil
+}
+
+// RecordWebhookEvent records a payment gateway webhook event against the order or job it is for.
+func RecordWebhookEvent(event *WebhookEvent) error {
+	switch event.Type {
+	case WebhookEventPaymentSucceeded:
+		return models.RecordGatewayPaymentSucceeded(event.Payment)
+	case WebhookEventPaymentFailed:
+		return models.RecordGatewayPaymentFailed(event.Payment)
+	case WebhookEventPaymentCancelled:
+		return models.RecordGatewayPaymentCancelled(event.Payment)
+	case WebhookEventPaymentRefunded:
+		return models.RecordGatewayRefunds(event.Payment, event.Refunds, event.TotalRefunded)
+	case WebhookEventPaymentDisputed:
+		if event.Dispute == nil {
+			return nil
+		}
+		if event.Dispute.OpenedAt.IsZero() {
+			event.Dispute.OpenedAt = time.Now()
+		}
+		return models.RecordGatewayDispute(event.Payment, *event.Dispute)
+	case WebhookEventPayoutUpdated:
+		if event.Payout == nil {
+			return nil
+		}
+		//withdrawals are paid out under the name of the gateway
+		_, err := models.RecordPayoutResult(event.Payment.Gateway, event.Payout)
+		return err
+	}
+	return nil
+}
+
+// WebHookHandler handles the webhooks of a registered payment gateway.
+// Each event is handled once, and events that fail to be handled get a 500 so the gateway retries them.
+func WebHookHandler(name string) echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		gateway, err := GetGateway(name)
+		if err != nil {
+			return ctx.NoContent(http.StatusNotFound)
+		}
+		body, err := ioutil.ReadAll(ctx.Request().Body)
+		if err != nil {
+			log.Error(err)
+			return ctx.NoContent(http.StatusBadRequest)
+		}
+		err = gateway.VerifyWebhook(ctx.Request().Header, body)
+		if err != nil {
+			log.Errorf("Error verifying %s webhook signature: %v\n", name, err)
+			return ctx.NoContent(http.StatusBadRequest)
+		}
+		event, err := gateway.ParseWebhookEvent(body)
+		if err != nil {
+			log.Errorf("Error parsing %s webhook: %v\n", name, err)
+			return ctx.NoContent(http.StatusBadRequest)
+		}
+		if event == nil {
+			return ctx.JSON(http.StatusOK, "")
+		}
+		return handleWebhookEvent(ctx, gateway, event.ID, string(event.Type), func() error {
+			return recordGatewayEvent(gateway, event)
+		})
+	}
+}
+
+// recordGatewayEvent records a webhook event of a gateway, and splits the payments it captured when the gateway splits them.
+func recordGatewayEvent(gateway PaymentGateway, event *WebhookEvent) error {
+	if event.Payment.Gateway == "" {
+		event.Payment.Gateway = gateway.Name()
+	}
+	err := RecordWebhookEvent(event)
+	if splitter, ok := gateway.(PaymentSplitter); ok && err == nil && event.Type == WebhookEventPaymentSucceeded {
+		err = splitter.SplitPayment(event.Payment)
+	}
+	return err
+}
+
+// handleWebhookEvent handles a verified webhook event of a gateway once.
+// Events that are handled already are acknowledged, and events that fail get a 500 so the gateway retries them.
+func handleWebhookEvent(ctx echo.Context, gateway PaymentGateway, eventID string, eventType string, handle func() error) error {
+	claimed, err := models.ClaimPaymentEvent(gateway.Name(), eventID, eventType)
+	if err != nil {
+		return ctx.NoContent(http.StatusInternalServerError)
+	}
+	if claimed == nil {
+		//handled already, or being handled by another delivery
+		return ctx.JSON(http.StatusOK, "")
+	}
+	err = handle()
+	finishErr := models.FinishPaymentEvent(claimed, err)
+	if err != nil {
+		log.Errorf("Error handling %s webhook event %s (%s): %v\n", gateway.Name(), eventID, eventType, err)
+		return ctx.NoContent(http.StatusInternalServerError)
+	}
+	if finishErr != nil {
+		log.Errorln(finishErr)
+	}
+	return ctx.JSON(http.StatusOK, "")
 }
@@ -0,0 +1,223 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package payments
+
+import (
+	"github.com/stretchr/testify/require"
+	"github.com/tribehq/platform/models"
+	"net/http"
+	"testing"
+)
+
+func fakeCard(t *testing.T, gateway *FakeGateway, number string) string {
+	token, err := gateway.Tokenize(FakeCard{CardNumber: number, ExpMonth: 12, ExpYear: 2030})
+	require.NoError(t, err)
+	return token.Token
+}
+
+func TestFakeGatewayTokenize(t *testing.T) {
+	gateway := NewFakeGateway("secret")
+
+	token, err := gateway.Tokenize(FakeCard{CardNumber: "4242 4242 4242 4242", ExpMonth: 12, ExpYear: 2030})
+	require.NoError(t, err)
+	require.Equal(t, "visa", token.Brand)
+	require.Equal(t, "4242", token.Last4)
+
+	again, err := gateway.Tokenize(FakeCard{CardNumber: "4242424242424242", ExpMonth: 1, ExpYear: 2031})
+	require.NoError(t, err)
+	require.NotEqual(t, token.Token, again.Token)
+	require.Equal(t, token.Fingerprint, again.Fingerprint)
+
+	_, err = gateway.Tokenize(FakeCard{CardNumber: "4242424242424241", ExpMonth: 12, ExpYear: 2030})
+	require.Equal(t, ErrPaymentDeclined, err)
+	_, err = gateway.Tokenize(FakeCard{CardNumber: "4242424242424242", ExpMonth: 13, ExpYear: 2030})
+	require.Equal(t, ErrPaymentDeclined, err)
+}
+
+func TestFakeGatewayAttachPaymentMethod(t *testing.T) {
+	gateway := NewFakeGateway("secret")
+	token := fakeCard(t, gateway, "4242424242424242")
+
+	attached, err := gateway.AttachPaymentMethod(AttachRequest{Token: token, UserID: "u1"})
+	require.NoError(t, err)
+	require.Equal(t, token, attached.Token)
+	require.Equal(t, "fake_cus_u1", attached.CustomerID)
+	require.Equal(t, "4242", attached.Last4)
+
+	other, err := gateway.AttachPaymentMethod(AttachRequest{Token: fakeCard(t, gateway, "5555555555554444"), UserID: "u1", CustomerID: "cus_1"})
+	require.NoError(t, err)
+	require.Equal(t, "cus_1", other.CustomerID)
+
+	_, err = gateway.AttachPaymentMethod(AttachRequest{Token: "unknown", UserID: "u1"})
+	require.Equal(t, ErrInvalidPaymentToken, err)
+}
+
+func TestFakeGatewayAuthorizeCaptureRefund(t *testing.T) {
+	gateway := NewFakeGateway("secret")
+	token := fakeCard(t, gateway, "4242424242424242")
+
+	payment, err := gateway.Authorize(PaymentRequest{Reference: "job1", JobID: "job1", Amount: 250, Currency: "inr", Token: token})
+	require.NoError(t, err)
+	require.Equal(t, PaymentStatusAuthorized, payment.Status)
+	require.Equal(t, "INR", payment.Currency)
+
+	again, err := gateway.Authorize(PaymentRequest{Reference: "job1", JobID: "job1", Amount: 250, Currency: "inr", Token: token})
+	require.NoError(t, err)
+	require.Equal(t, payment.ID, again.ID)
+
+	_, err = gateway.Refund(RefundRequest{RefundID: "r0", PaymentID: payment.ID, Amount: 10})
+	require.Equal(t, ErrInvalidPaymentState, err)
+
+	_, err = gateway.Capture(payment.ID, 300)
+	require.Error(t, err)
+	captured, err := gateway.Capture(payment.ID, 200)
+	require.NoError(t, err)
+	require.Equal(t, PaymentStatusCaptured, captured.Status)
+	require.Equal(t, 200.0, captured.CapturedAmount)
+	_, err = gateway.Capture(payment.ID, 0)
+	require.Equal(t, ErrInvalidPaymentState, err)
+
+	refund, err := gateway.Refund(RefundRequest{RefundID: "r1", PaymentID: payment.ID, Amount: 120.5})
+	require.NoError(t, err)
+	require.Equal(t, 120.5, refund.Amount)
+	repeated, err := gateway.Refund(RefundRequest{RefundID: "r1", PaymentID: payment.ID, Amount: 120.5})
+	require.NoError(t, err)
+	require.Equal(t, refund.ID, repeated.ID)
+	_, err = gateway.Refund(RefundRequest{RefundID: "r2", PaymentID: payment.ID, Amount: 80})
+	require.Equal(t, ErrRefundExceedsPayment, err)
+	rest, err := gateway.Refund(RefundRequest{RefundID: "r3", PaymentID: payment.ID})
+	require.NoError(t, err)
+	require.Equal(t, 79.5, rest.Amount)
+
+	stored, err := gateway.GetPayment(payment.ID)
+	require.NoError(t, err)
+	require.Equal(t, 200.0, stored.RefundedAmount)
+
+	events := gateway.Events()
+	require.Len(t, events, 3)
+	require.Equal(t, WebhookEventPaymentSucceeded, events[0].Type)
+	require.Equal(t, 200.0, events[0].Payment.Amount)
+	require.Equal(t, "job1", events[0].Payment.JobID)
+	require.Equal(t, WebhookEventPaymentRefunded, events[1].Type)
+	require.Equal(t, 120.5, events[1].TotalRefunded)
+	require.Equal(t, "r1", events[1].Refunds[0].RefundID)
+	require.Equal(t, 200.0, events[2].TotalRefunded)
+	require.Empty(t, gateway.Events())
+}
+
+func TestFakeGatewayDeclinesAndVoids(t *testing.T) {
+	gateway := NewFakeGateway("secret")
+
+	declined, err := gateway.Authorize(PaymentRequest{Reference: "o1", Amount: 10, Token: fakeCard(t, gateway, FakeCardDeclined)})
+	require.Equal(t, ErrPaymentDeclined, err)
+	require.Equal(t, PaymentStatusFailed, declined.Status)
+	require.Equal(t, "card declined", declined.FailureReason)
+
+	poor, err := gateway.Authorize(PaymentRequest{Reference: "o2", Amount: 10, Token: fakeCard(t, gateway, FakeCardInsufficientFunds)})
+	require.Equal(t, ErrPaymentDeclined, err)
+	require.Equal(t, "insufficient funds", poor.FailureReason)
+
+	_, err = gateway.Authorize(PaymentRequest{Reference: "o3", Amount: 10, Token: "unknown"})
+	require.Equal(t, ErrInvalidPaymentToken, err)
+
+	payment, err := gateway.Authorize(PaymentRequest{Reference: "o4", Amount: 10, Token: fakeCard(t, gateway, "5555555555554444")})
+	require.NoError(t, err)
+	voided, err := gateway.Void(payment.ID)
+	require.NoError(t, err)
+	require.Equal(t, PaymentStatusVoided, voided.Status)
+	_, err = gateway.Capture(payment.ID, 0)
+	require.Equal(t, ErrInvalidPaymentState, err)
+
+	events := gateway.Events()
+	require.Len(t, events, 3)
+	require.Equal(t, WebhookEventPaymentFailed, events[0].Type)
+	require.Equal(t, "card declined", events[0].Payment.Reason)
+	require.Equal(t, WebhookEventPaymentCancelled, events[2].Type)
+}
+
+func TestFakeGatewayWebhooks(t *testing.T) {
+	gateway := NewFakeGateway("secret")
+	token := fakeCard(t, gateway, "4242424242424242")
+	payment, err := gateway.Authorize(PaymentRequest{Reference: "o1", OrderID: "o1", Amount: 99, Currency: "INR", Token: token, Capture: true})
+	require.NoError(t, err)
+	dispute, err := gateway.Dispute(payment.ID, "fraudulent")
+	require.NoError(t, err)
+	require.Equal(t, 99.0, dispute.Dispute.Amount)
+
+	for _, event := range gateway.Events() {
+		body, header, err := gateway.WebhookRequest(event)
+		require.NoError(t, err)
+		require.NoError(t, gateway.VerifyWebhook(header, body))
+		parsed, err := gateway.ParseWebhookEvent(body)
+		require.NoError(t, err)
+		require.Equal(t, event.ID, parsed.ID)
+		require.Equal(t, event.Type, parsed.Type)
+		require.Equal(t, "o1", parsed.Payment.OrderID)
+
+		require.Equal(t, ErrInvalidWebhookSignature, gateway.VerifyWebhook(http.Header{}, body))
+		require.Equal(t, ErrInvalidWebhookSignature, NewFakeGateway("other").VerifyWebhook(header, body))
+		require.Equal(t, ErrInvalidWebhookSignature, gateway.VerifyWebhook(header, append(body, ' ')))
+	}
+
+	ignored, err := gateway.ParseWebhookEvent([]byte(`{"hello":"world"}`))
+	require.NoError(t, err)
+	require.Nil(t, ignored)
+}
+
+func TestGatewayCharger(t *testing.T) {
+	gateway := NewFakeGateway("secret")
+	charger := gatewayCharger{gateway: gateway}
+	token := fakeCard(t, gateway, "4242424242424242")
+
+	id, err := charger.ChargePayment(models.GatewayCharge{ChargeID: "c1", JobID: "j1", Amount: 40, Currency: "INR", PaymentMethodID: token})
+	require.NoError(t, err)
+	payment, err := gateway.GetPayment(id)
+	require.NoError(t, err)
+	require.Equal(t, PaymentStatusCaptured, payment.Status)
+	require.Equal(t, "j1", payment.JobID)
+
+	again, err := charger.ChargePayment(models.GatewayCharge{ChargeID: "c1", JobID: "j1", Amount: 40, Currency: "INR", PaymentMethodID: token})
+	require.NoError(t, err)
+	require.Equal(t, id, again)
+
+	declinedID, err := charger.ChargePayment(models.GatewayCharge{ChargeID: "c2", Amount: 40, PaymentMethodID: fakeCard(t, gateway, FakeCardDeclined)})
+	require.Equal(t, ErrPaymentDeclined, err)
+	require.NotEmpty(t, declinedID)
+
+	_, err = charger.ChargePayment(models.GatewayCharge{ChargeID: "c3", Amount: 40, PaymentMethodID: "unknown"})
+	require.Equal(t, ErrInvalidPaymentToken, err)
+}
+
+func TestGatewayRefunder(t *testing.T) {
+	gateway := NewFakeGateway("secret")
+	token := fakeCard(t, gateway, "4242424242424242")
+	payment, err := gateway.Authorize(PaymentRequest{Reference: "o1", OrderID: "o1", Amount: 100, Token: token, Capture: true})
+	require.NoError(t, err)
+	refunder := gatewayRefunder{gateway: gateway}
+
+	id, err := refunder.RefundPayment(models.GatewayRefund{RefundID: "r1", OrderID: "o1", PaymentID: payment.ID, Amount: 30})
+	require.NoError(t, err)
+	again, err := refunder.RefundPayment(models.GatewayRefund{RefundID: "r1", OrderID: "o1", PaymentID: payment.ID, Amount: 30})
+	require.NoError(t, err)
+	require.Equal(t, id, again)
+	_, err = refunder.RefundPayment(models.GatewayRefund{RefundID: "r2", OrderID: "o1", PaymentID: payment.ID, Amount: 71})
+	require.Equal(t, ErrRefundExceedsPayment, err)
+}
+
+func TestRegisterGateway(t *testing.T) {
+	gateway := NewFakeGateway("secret")
+	RegisterGateway(gateway)
+
+	registered, err := GetGateway("FAKE")
+	require.NoError(t, err)
+	require.Equal(t, gateway, registered)
+	_, err = GetGateway("nowhere")
+	require.Equal(t, ErrGatewayNotFound, err)
+
+	_, ok := models.GetPaymentRefunder(FakeGatewayName)
+	require.True(t, ok)
+	_, ok = models.GetPaymentCharger(FakeGatewayName)
+	require.True(t, ok)
+}
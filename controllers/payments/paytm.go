@@ -5,11 +5,409 @@
 package payments
 
 import (
+	"errors"
 	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/payments/paytm"
+	"github.com/tribehq/platform/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// PaytmWebHookHandler handles razor pay webhooks.
+// PaytmGatewayName is the name paytm payments and linked paytm wallets are recorded under.
+const PaytmGatewayName = "paytm"
+
+// paytmAddMoneyPrefix marks the paytm orders of money added to wallets, which pay for nothing of ours.
+const paytmAddMoneyPrefix = "ADDMONEY"
+
+// ErrPaytmOTPNotSent is returned when paytm doesn't send the otp a wallet is linked with.
+var ErrPaytmOTPNotSent = errors.New("paytm couldn't send the otp")
+
+// PaytmGateway takes payments from linked paytm wallets and through paytm checkout.
+// Paytm orders carry the reference of the attempt to pay our order or job, so webhooks find what they paid for,
+// and payments are recorded under their paytm order id and transaction id, so refunds find the transaction.
+type PaytmGateway struct {
+	client *paytm.Paytm
+}
+
+// NewPaytmGateway gives a paytm gateway using the paytm client.
+func NewPaytmGateway(client *paytm.Paytm) *PaytmGateway {
+	return &PaytmGateway{client: client}
+}
+
+// Name is the name paytm payments are recorded under.
+func (g *PaytmGateway) Name() string {
+	return PaytmGatewayName
+}
+
+// Authorize debits a linked paytm wallet when the request carries its access token. Without one it starts
+// a transaction the customer completes in paytm checkout, pending until they do, and the payment id is the
+// transaction token checkout is opened with. Paytm payments are always captured right away.
+func (g *PaytmGateway) Authorize(request PaymentRequest) (*Payment, error) {
+	if request.Token == "" {
+		txn, err := g.client.InitiatePayment(request.Reference, request.CustomerID, request.Amount, strings.ToUpper(request.Currency))
+		if err != nil {
+			return nil, err
+		}
+		return &Payment{
+			ID:        txn.Body.TxnToken,
+			Reference: request.Reference,
+			OrderID:   request.OrderID,
+			JobID:     request.JobID,
+			Status:    PaymentStatusPending,
+			Amount:    request.Amount,
+			Currency:  "INR",
+		}, nil
+	}
+	return g.debit(request, "")
+}
+
+// debit takes a payment from the linked paytm wallet whose access token the request carries.
+func (g *PaytmGateway) debit(request PaymentRequest, mobile string) (*Payment, error) {
+	withdraw, err := g.client.Debit(request.Token, request.Reference, request.CustomerID, mobile, request.Amount)
+	payment := &Payment{
+		ID:            paytm.PaymentID(request.Reference, withdraw.TxnID),
+		Reference:     request.Reference,
+		OrderID:       request.OrderID,
+		JobID:         request.JobID,
+		Status:        PaymentStatusFailed,
+		Amount:        request.Amount,
+		Currency:      "INR",
+		FailureReason: withdraw.ResponseMessage,
+	}
+	if err != nil {
+		if withdraw.Status == paytm.TxnStatusFailure {
+			return payment, ErrPaymentDeclined
+		}
+		return nil, err
+	}
+	switch withdraw.Status {
+	case paytm.TxnStatusSuccess:
+		payment.Status = PaymentStatusCaptured
+		payment.CapturedAmount = request.Amount
+	case paytm.TxnStatusPending:
+		payment.Status = PaymentStatusPending
+	}
+	return payment, nil
+}
+
+// Capture isn't needed with paytm, which captures payments right away.
+func (g *PaytmGateway) Capture(paymentID string, amount float64) (*Payment, error) {
+	return nil, ErrNotSupported
+}
+
+// Refund refunds part or all of a paytm transaction.
+func (g *PaytmGateway) Refund(request RefundRequest) (*Refund, error) {
+	orderID, txnID := paytm.SplitPaymentID(request.PaymentID, request.OrderID)
+	refund, err := g.client.Refund(orderID, txnID, request.RefundID, request.Amount, request.Reason)
+	if err != nil {
+		return nil, err
+	}
+	return &Refund{ID: refund.RefundID, RefundID: request.RefundID, PaymentID: request.PaymentID, Amount: request.Amount}, nil
+}
+
+// Void isn't offered by paytm, which captures payments right away.
+func (g *PaytmGateway) Void(paymentID string) (*Payment, error) {
+	return nil, ErrNotSupported
+}
+
+// AttachPaymentMethod isn't offered by paytm, wallets are linked with an otp instead.
+func (g *PaytmGateway) AttachPaymentMethod(request AttachRequest) (*PaymentToken, error) {
+	return nil, ErrNotSupported
+}
+
+// paytmParams reads the form paytm posts to callbacks and webhooks.
+func paytmParams(body []byte) (map[string]string, error) {
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	params := make(map[string]string, len(values))
+	for key := range values {
+		params[key] = values.Get(key)
+	}
+	return params, nil
+}
+
+// VerifyWebhook checks the checksum of the form paytm posted.
+func (g *PaytmGateway) VerifyWebhook(header http.Header, body []byte) error {
+	params, err := paytmParams(body)
+	if err != nil || !paytm.VerifyCallback(params) {
+		return ErrInvalidWebhookSignature
+	}
+	return nil
+}
+
+// ParseWebhookEvent reads the transaction paytm posted. The paytm order id is the reference of an attempt to pay
+// our order or job, and the order is looked for first when the payment is recorded. Money added to wallets isn't recorded.
+func (g *PaytmGateway) ParseWebhookEvent(body []byte) (*WebhookEvent, error) {
+	params, err := paytmParams(body)
+	if err != nil {
+		return nil, err
+	}
+	orderID := params["ORDERID"]
+	if orderID == "" || strings.HasPrefix(orderID, paytmAddMoneyPrefix) {
+		return nil, nil
+	}
+	amount, _ := strconv.ParseFloat(params["TXNAMOUNT"], 64)
+	currency := params["CURRENCY"]
+	if currency == "" {
+		currency = "INR"
+	}
+	targetID := paymentReferenceID(orderID)
+	update := models.GatewayPaymentUpdate{
+		Gateway:   PaytmGatewayName,
+		PaymentID: paytm.PaymentID(orderID, params["TXNID"]),
+		OrderID:   targetID,
+		JobID:     targetID,
+		Amount:    amount,
+		Currency:  currency,
+		Reason:    params["RESPMSG"],
+	}
+	switch params["STATUS"] {
+	case paytm.TxnStatusSuccess:
+		return &WebhookEvent{ID: orderID + ":" + params["TXNID"] + ":" + params["STATUS"], Type: WebhookEventPaymentSucceeded, Payment: update}, nil
+	case paytm.TxnStatusFailure:
+		return &WebhookEvent{ID: orderID + ":" + params["TXNID"] + ":" + params["STATUS"], Type: WebhookEventPaymentFailed, Payment: update}, nil
+	}
+	return nil, nil
+}
+
+// paytmGateway gives the registered paytm gateway.
+func paytmGateway() (*PaytmGateway, error) {
+	gateway, err := GetGateway(PaytmGatewayName)
+	if err != nil {
+		return nil, err
+	}
+	paytmGateway, ok := gateway.(*PaytmGateway)
+	if !ok {
+		return nil, ErrGatewayNotFound
+	}
+	return paytmGateway, nil
+}
+
+// linkedPaytmWallet gives the user's linked paytm wallet, when its token can still be used.
+func linkedPaytmWallet(userID primitive.ObjectID) (*models.LinkedWallet, error) {
+	wallet, err := models.GetLinkedWallet(userID, PaytmGatewayName)
+	if err != nil {
+		return nil, err
+	}
+	if wallet == nil || !wallet.IsUsable() {
+		return nil, models.ErrWalletNotLinked
+	}
+	return wallet, nil
+}
+
+// SendPaytmOTP has paytm send the user the otp that links their wallet.
+func SendPaytmOTP(userID primitive.ObjectID, mobile string) error {
+	gateway, err := paytmGateway()
+	if err != nil {
+		return err
+	}
+	sent, otpResp, err := gateway.client.SendOTP(mobile, gateway.client.ClientID)
+	if err != nil {
+		return err
+	}
+	if !sent {
+		log.Errorf("paytm didn't send the otp: %s %s\n", otpResp.ResponseCode, otpResp.Message)
+		return ErrPaytmOTPNotSent
+	}
+	_, err = models.StartWalletLink(userID, PaytmGatewayName, mobile, otpResp.State)
+	return err
+}
+
+// LinkPaytmWallet links the user's paytm wallet with the otp paytm sent them, keeping the access token paytm gives for it.
+func LinkPaytmWallet(userID primitive.ObjectID, otp string) (*models.LinkedWallet, error) {
+	gateway, err := paytmGateway()
+	if err != nil {
+		return nil, err
+	}
+	wallet, err := models.GetLinkedWallet(userID, PaytmGatewayName)
+	if err != nil {
+		return nil, err
+	}
+	if wallet == nil || wallet.OTPState == "" {
+		return nil, models.ErrWalletLinkNotStarted
+	}
+	otpResp, err := gateway.client.VerifyOTP(otp, wallet.OTPState)
+	if err != nil {
+		return nil, err
+	}
+	details, err := gateway.client.ValidateToken(otpResp.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	expires := otpResp.Expires
+	if details.Expires != "" {
+		expires = details.Expires
+	}
+	var expiresAt *time.Time
+	if millis, err := expires.Int64(); err == nil && millis > 0 {
+		at := time.Unix(0, millis*int64(time.Millisecond))
+		expiresAt = &at
+	}
+	return models.CompleteWalletLink(wallet, otpResp.AccessToken, expiresAt, details.ID)
+}
+
+// UnlinkPaytmWallet revokes the access token of the user's paytm wallet and unlinks it.
+// The wallet is unlinked even when paytm can't be reached to revoke the token.
+func UnlinkPaytmWallet(userID primitive.ObjectID) error {
+	wallet, err := models.GetLinkedWallet(userID, PaytmGatewayName)
+	if err != nil {
+		return err
+	}
+	if wallet == nil || wallet.Status == models.LinkedWalletStatusRevoked {
+		return models.ErrWalletNotLinked
+	}
+	if wallet.Token != "" {
+		gateway, err := paytmGateway()
+		if err != nil {
+			return err
+		}
+		err = gateway.client.RevokeAccess(wallet.Token)
+		if err != nil {
+			log.Errorln(err)
+		}
+	}
+	_, err = models.RevokeLinkedWallet(wallet)
+	return err
+}
+
+// PaytmWalletBalance gives the balance of the user's linked paytm wallet and whether it has the amount.
+func PaytmWalletBalance(userID primitive.ObjectID, amount float64) (*models.PaytmWalletBalance, error) {
+	gateway, err := paytmGateway()
+	if err != nil {
+		return nil, err
+	}
+	wallet, err := linkedPaytmWallet(userID)
+	if err != nil {
+		return nil, err
+	}
+	balance, err := gateway.client.CheckBalance(wallet.Token, amount)
+	if err != nil {
+		return nil, err
+	}
+	deficit, _ := strconv.ParseFloat(balance.Body.DeficitAmount, 64)
+	return &models.PaytmWalletBalance{
+		Balance:         balance.WalletBalance(),
+		FundsSufficient: balance.Body.FundsSufficient,
+		DeficitAmount:   deficit,
+		AddMoneyAllowed: balance.Body.AddMoneyAllowed,
+	}, nil
+}
+
+// AddMoneyToPaytmWallet gives the form that takes the user to paytm to add money to their linked wallet.
+func AddMoneyToPaytmWallet(userID primitive.ObjectID, amount float64) (*models.PaytmAddMoneyForm, error) {
+	gateway, err := paytmGateway()
+	if err != nil {
+		return nil, err
+	}
+	wallet, err := linkedPaytmWallet(userID)
+	if err != nil {
+		return nil, err
+	}
+	orderID := paytmAddMoneyPrefix + primitive.NewObjectID().Hex()
+	form, err := gateway.client.AddMoney(wallet.Token, orderID, userID.Hex(), amount)
+	if err != nil {
+		return nil, err
+	}
+	params := make(map[string]interface{}, len(form.Params))
+	for key, value := range form.Params {
+		params[key] = value
+	}
+	return &models.PaytmAddMoneyForm{URL: form.URL, Params: params}, nil
+}
+
+// PayWithPaytmWallet pays an order or job from the user's linked paytm wallet and records the payment.
+// Debits paytm leaves pending are recorded when paytm's webhook tells how they went.
+func PayWithPaytmWallet(userID primitive.ObjectID, request PaymentRequest) error {
+	gateway, err := paytmGateway()
+	if err != nil {
+		return err
+	}
+	err = checkGatewaySelected(gateway.Name(), request.StoreID)
+	if err != nil {
+		return err
+	}
+	wallet, err := linkedPaytmWallet(userID)
+	if err != nil {
+		return err
+	}
+	request.Token = wallet.Token
+	request.CustomerID = userID.Hex()
+	payment, err := gateway.debit(request, wallet.Mobile)
+	if payment != nil {
+		update := models.GatewayPaymentUpdate{
+			Gateway:   PaytmGatewayName,
+			PaymentID: payment.ID,
+			OrderID:   request.OrderID,
+			JobID:     request.JobID,
+			Amount:    payment.Amount,
+			Currency:  payment.Currency,
+			Reason:    payment.FailureReason,
+		}
+		switch payment.Status {
+		case PaymentStatusCaptured:
+			return models.RecordGatewayPaymentSucceeded(update)
+		case PaymentStatusFailed:
+			if recordErr := models.RecordGatewayPaymentFailed(update); recordErr != nil {
+				log.Errorln(recordErr)
+			}
+		}
+	}
+	return err
+}
+
+// PaytmWebHookHandler handles the payment notifications paytm posts.
 func PaytmWebHookHandler(ctx echo.Context) error {
-	return ctx.JSON(http.StatusOK, "")
+	return WebHookHandler(PaytmGatewayName)(ctx)
+}
+
+// paytmResultURL gives the page the customer is taken to with the result of a payment made in paytm checkout.
+func paytmResultURL(status string, orderID string, message string) string {
+	resultURL := os.Getenv("PAYTM_RESULT_URL")
+	if resultURL == "" {
+		resultURL = "/payments/result"
+	}
+	query := url.Values{}
+	query.Set("gateway", PaytmGatewayName)
+	query.Set("status", status)
+	if orderID != "" {
+		query.Set("id", orderID)
+	}
+	if message != "" {
+		query.Set("message", message)
+	}
+	separator := "?"
+	if strings.Contains(resultURL, "?") {
+		separator = "&"
+	}
+	return resultURL + separator + query.Encode()
+}
+
+// PaytmCallbackHandler handles the result of a payment or add money paytm posts from the customer's browser,
+// taking the customer on to the result page once its checksum is verified. Payments are recorded by the webhook.
+func PaytmCallbackHandler(ctx echo.Context) error {
+	form, err := ctx.FormParams()
+	if err != nil {
+		return ctx.Redirect(http.StatusSeeOther, paytmResultURL(paytm.TxnStatusFailure, "", "The payment couldn't be read."))
+	}
+	params := make(map[string]string, len(form))
+	for key := range form {
+		params[key] = form.Get(key)
+	}
+	if !paytm.VerifyCallback(params) {
+		log.Errorf("Error verifying paytm callback checksum for order %s\n", params["ORDERID"])
+		return ctx.Redirect(http.StatusSeeOther, paytmResultURL(paytm.TxnStatusFailure, "", "The payment couldn't be verified."))
+	}
+	orderID := params["ORDERID"]
+	if !strings.HasPrefix(orderID, paytmAddMoneyPrefix) {
+		orderID = paymentReferenceID(orderID)
+	}
+	return ctx.Redirect(http.StatusSeeOther, paytmResultURL(params["STATUS"], orderID, params["RESPMSG"]))
 }
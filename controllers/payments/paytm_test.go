@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package payments
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/require"
+	"github.com/tribehq/platform/lib/payments/paytm"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPaymentAttemptReference(t *testing.T) {
+	first := PaymentAttemptReference("5d1c0a1e2f3a4b5c6d7e8f90")
+	second := PaymentAttemptReference("5d1c0a1e2f3a4b5c6d7e8f90")
+	require.NotEqual(t, first, second)
+	require.True(t, len(first) <= 40)
+	require.Equal(t, "5d1c0a1e2f3a4b5c6d7e8f90", paymentReferenceID(first))
+	require.Equal(t, "5d1c0a1e2f3a4b5c6d7e8f90", paymentReferenceID("5d1c0a1e2f3a4b5c6d7e8f90"))
+}
+
+func TestPaytmPaymentID(t *testing.T) {
+	orderID, txnID := paytm.SplitPaymentID(paytm.PaymentID("o1_k2", "TXN1"), "o1")
+	require.Equal(t, "o1_k2", orderID)
+	require.Equal(t, "TXN1", txnID)
+
+	//payments recorded by their transaction id only fall back to our order id
+	orderID, txnID = paytm.SplitPaymentID("TXN2", "o2")
+	require.Equal(t, "o2", orderID)
+	require.Equal(t, "TXN2", txnID)
+}
+
+func TestPaytmParseWebhookEvent(t *testing.T) {
+	gateway := &PaytmGateway{}
+	body := url.Values{"ORDERID": {"o1_k2"}, "TXNID": {"TXN1"}, "TXNAMOUNT": {"120.50"}, "STATUS": {paytm.TxnStatusSuccess}}
+	event, err := gateway.ParseWebhookEvent([]byte(body.Encode()))
+	require.NoError(t, err)
+	require.Equal(t, WebhookEventPaymentSucceeded, event.Type)
+	require.Equal(t, "o1", event.Payment.OrderID)
+	require.Equal(t, "o1", event.Payment.JobID)
+	require.Equal(t, "o1_k2/TXN1", event.Payment.PaymentID)
+	require.Equal(t, 120.5, event.Payment.Amount)
+	require.Equal(t, "INR", event.Payment.Currency)
+
+	body.Set("ORDERID", paytmAddMoneyPrefix+"abc")
+	event, err = gateway.ParseWebhookEvent([]byte(body.Encode()))
+	require.NoError(t, err)
+	require.Nil(t, event)
+}
+
+func TestPaytmCallbackRedirects(t *testing.T) {
+	os.Setenv("PAYTM_RESULT_URL", "https://shop.example.com/checkout/result?from=paytm")
+	defer os.Unsetenv("PAYTM_RESULT_URL")
+
+	form := url.Values{"ORDERID": {"o1_k2"}, "STATUS": {paytm.TxnStatusSuccess}, "CHECKSUMHASH": {"forged"}}
+	req := httptest.NewRequest(http.MethodPost, "/hooks/paytm/callback", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	require.NoError(t, PaytmCallbackHandler(echo.New().NewContext(req, rec)))
+	require.Equal(t, http.StatusSeeOther, rec.Code)
+
+	location, err := url.Parse(rec.Header().Get(echo.HeaderLocation))
+	require.NoError(t, err)
+	require.Equal(t, "shop.example.com", location.Host)
+	require.Equal(t, "paytm", location.Query().Get("from"))
+	require.Equal(t, paytm.TxnStatusFailure, location.Query().Get("status"))
+	require.Empty(t, location.Query().Get("id"))
+
+	require.Equal(t, "https://shop.example.com/checkout/result?from=paytm&gateway=paytm&id=o1&message=Txn+Success&status=TXN_SUCCESS",
+		paytmResultURL(paytm.TxnStatusSuccess, "o1", "Txn Success"))
+}
@@ -5,11 +5,473 @@
 package payments
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/payments/razorpay"
+	"github.com/tribehq/platform/models"
 	"net/http"
+	"strings"
+	"time"
 )
 
+// RazorpayGatewayName is the name razorpay payments are recorded under.
+const RazorpayGatewayName = "razorpay"
+
+// ErrRazorpayPaymentMismatch is returned when a razorpay payment isn't for the razorpay order it was verified with.
+var ErrRazorpayPaymentMismatch = errors.New("razorpay payment is not for the razorpay order")
+
+// RazorpayGateway takes payments through razorpay checkout and splits them with razorpay route.
+type RazorpayGateway struct {
+	client *razorpay.Razorpay
+}
+
+// NewRazorpayGateway gives a razorpay gateway using the razorpay client.
+func NewRazorpayGateway(client *razorpay.Razorpay) *RazorpayGateway {
+	return &RazorpayGateway{client: client}
+}
+
+// Name is the name razorpay payments are recorded under.
+func (g *RazorpayGateway) Name() string {
+	return RazorpayGatewayName
+}
+
+// KeyID is the public key razorpay checkout is opened with.
+func (g *RazorpayGateway) KeyID() string {
+	return g.client.KeyID
+}
+
+// Authorize creates the razorpay order the customer pays in razorpay checkout, the payment is pending until they do.
+// Razorpay payments can't be made with a saved token from the server.
+func (g *RazorpayGateway) Authorize(request PaymentRequest) (*Payment, error) {
+	if request.Token != "" {
+		return nil, ErrNotSupported
+	}
+	currency := strings.ToUpper(request.Currency)
+	if currency == "" {
+		currency = "INR"
+	}
+	capture := 0
+	if request.Capture {
+		capture = 1
+	}
+	notes := razorpay.Notes{}
+	if request.OrderID != "" {
+		notes["order_id"] = request.OrderID
+	}
+	if request.JobID != "" {
+		notes["job_id"] = request.JobID
+	}
+	order, err := g.client.CreateOrder(razorpay.OrderRequest{
+		Amount:         razorpay.AmountInPaise(request.Amount),
+		Currency:       currency,
+		Receipt:        request.Reference,
+		PaymentCapture: capture,
+		Notes:          notes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Payment{
+		ID:        order.ID,
+		Reference: request.Reference,
+		OrderID:   request.OrderID,
+		JobID:     request.JobID,
+		Status:    PaymentStatusPending,
+		Amount:    razorpay.AmountFromPaise(order.Amount),
+		Currency:  order.Currency,
+	}, nil
+}
+
+// razorpayPayment gives a razorpay payment in the terms of the gateway.
+func razorpayPayment(payment *razorpay.Payment) *Payment {
+	status := PaymentStatusPending
+	switch payment.Status {
+	case razorpay.PaymentStatusAuthorized:
+		status = PaymentStatusAuthorized
+	case razorpay.PaymentStatusCaptured, razorpay.PaymentStatusRefunded:
+		status = PaymentStatusCaptured
+	case razorpay.PaymentStatusFailed:
+		status = PaymentStatusFailed
+	}
+	result := &Payment{
+		ID:             payment.ID,
+		OrderID:        payment.Notes["order_id"],
+		JobID:          payment.Notes["job_id"],
+		Status:         status,
+		Amount:         razorpay.AmountFromPaise(payment.Amount),
+		RefundedAmount: razorpay.AmountFromPaise(payment.AmountRefunded),
+		Currency:       payment.Currency,
+		FailureReason:  payment.ErrorDescription,
+	}
+	if payment.Captured {
+		result.CapturedAmount = result.Amount
+	}
+	return result
+}
+
+// Capture captures an authorized razorpay payment. Razorpay only captures payments in full.
+func (g *RazorpayGateway) Capture(paymentID string, amount float64) (*Payment, error) {
+	payment, err := g.client.GetPayment(paymentID)
+	if err != nil {
+		return nil, err
+	}
+	if payment.Status != razorpay.PaymentStatusAuthorized {
+		return nil, ErrInvalidPaymentState
+	}
+	if amount > 0 && razorpay.AmountInPaise(amount) != payment.Amount {
+		return nil, ErrNotSupported
+	}
+	payment, err = g.client.CapturePayment(paymentID, payment.Amount, payment.Currency)
+	if err != nil {
+		return nil, err
+	}
+	return razorpayPayment(payment), nil
+}
+
+// Refund refunds part or all of a captured razorpay payment.
+func (g *RazorpayGateway) Refund(request RefundRequest) (*Refund, error) {
+	id, err := g.client.RefundPayment(models.GatewayRefund{
+		RefundID:  request.RefundID,
+		PaymentID: request.PaymentID,
+		Amount:    request.Amount,
+		Reason:    request.Reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Refund{ID: id, RefundID: request.RefundID, PaymentID: request.PaymentID, Amount: request.Amount}, nil
+}
+
+// Void isn't offered by razorpay, which refunds authorized payments that aren't captured in time on its own.
+func (g *RazorpayGateway) Void(paymentID string) (*Payment, error) {
+	return nil, ErrNotSupported
+}
+
+// AttachPaymentMethod isn't offered by razorpay, cards are saved by razorpay checkout.
+func (g *RazorpayGateway) AttachPaymentMethod(request AttachRequest) (*PaymentToken, error) {
+	return nil, ErrNotSupported
+}
+
+// VerifyWebhook checks the webhook is signed with the razorpay webhook secret.
+func (g *RazorpayGateway) VerifyWebhook(header http.Header, body []byte) error {
+	err := g.client.VerifyWebhookSignature(body, header.Get(razorpay.SignatureHeader))
+	if err != nil {
+		return ErrInvalidWebhookSignature
+	}
+	return nil
+}
+
+// paymentUpdate describes a razorpay payment for recording against the order or job it paid for.
+// Payments made in checkout don't always carry the notes of their razorpay order, so those are looked up.
+func (g *RazorpayGateway) paymentUpdate(payment *razorpay.Payment) models.GatewayPaymentUpdate {
+	notes := payment.Notes
+	if notes["order_id"] == "" && notes["job_id"] == "" && payment.OrderID != "" {
+		order, err := g.client.GetOrder(payment.OrderID)
+		if err != nil {
+			log.Errorln(err)
+		} else {
+			notes = order.Notes
+		}
+	}
+	return models.GatewayPaymentUpdate{
+		Gateway:   RazorpayGatewayName,
+		PaymentID: payment.ID,
+		OrderID:   notes["order_id"],
+		JobID:     notes["job_id"],
+		Amount:    razorpay.AmountFromPaise(payment.Amount),
+		Currency:  strings.ToUpper(payment.Currency),
+		Reason:    payment.ErrorDescription,
+	}
+}
+
+// ParseWebhookEvent reads a razorpay webhook. Razorpay events carry no id of their own in the body,
+// so events are told apart by the entity they are about and when they were sent.
+// Razorpayx sends the payout events of withdrawals to the same webhook.
+func (g *RazorpayGateway) ParseWebhookEvent(body []byte) (*WebhookEvent, error) {
+	webhook := &razorpay.WebhookEvent{}
+	err := json.Unmarshal(body, webhook)
+	if err != nil {
+		return nil, err
+	}
+	payload := webhook.Payload
+	switch webhook.Event {
+	case "payment.captured", "payment.failed":
+		if payload.Payment == nil {
+			return nil, nil
+		}
+		payment := &payload.Payment.Entity
+		event := &WebhookEvent{
+			ID:      webhook.Event + ":" + payment.ID,
+			Type:    WebhookEventPaymentSucceeded,
+			Payment: g.paymentUpdate(payment),
+		}
+		if webhook.Event == "payment.failed" {
+			event.Type = WebhookEventPaymentFailed
+		}
+		return event, nil
+	case "refund.processed":
+		if payload.Refund == nil || payload.Payment == nil {
+			return nil, nil
+		}
+		refund := &payload.Refund.Entity
+		payment := &payload.Payment.Entity
+		refundID := refund.Notes["refund_id"]
+		if refundID == "" {
+			refundID = refund.Receipt
+		}
+		return &WebhookEvent{
+			ID:      webhook.Event + ":" + refund.ID,
+			Type:    WebhookEventPaymentRefunded,
+			Payment: g.paymentUpdate(payment),
+			Refunds: []models.GatewayRefundUpdate{{
+				GatewayRefundID: refund.ID,
+				RefundID:        refundID,
+				Amount:          razorpay.AmountFromPaise(refund.Amount),
+				Reason:          refund.Notes["reason"],
+			}},
+			TotalRefunded: razorpay.AmountFromPaise(payment.AmountRefunded),
+		}, nil
+	case "payout.processed", "payout.failed", "payout.rejected", "payout.reversed":
+		if payload.Payout == nil {
+			return nil, nil
+		}
+		payout := &payload.Payout.Entity
+		return &WebhookEvent{
+			ID:      webhook.Event + ":" + payout.ID,
+			Type:    WebhookEventPayoutUpdated,
+			Payment: models.GatewayPaymentUpdate{Gateway: RazorpayGatewayName},
+			Payout:  payout.Result(),
+		}, nil
+	case "payment.dispute.created", "payment.dispute.won", "payment.dispute.lost", "payment.dispute.closed",
+		"payment.dispute.under_review", "payment.dispute.action_required":
+		if payload.Dispute == nil || payload.Payment == nil {
+			return nil, nil
+		}
+		dispute := &payload.Dispute.Entity
+		paymentDispute := &models.PaymentDispute{
+			ID:       dispute.ID,
+			Amount:   razorpay.AmountFromPaise(dispute.Amount),
+			Currency: strings.ToUpper(dispute.Currency),
+			Reason:   dispute.ReasonDescription,
+			Status:   models.PaymentDisputeStatusOpen,
+			OpenedAt: time.Unix(dispute.CreatedAt, 0),
+		}
+		switch dispute.Status {
+		case "won":
+			paymentDispute.Status = models.PaymentDisputeStatusWon
+		case "lost", "closed":
+			paymentDispute.Status = models.PaymentDisputeStatusLost
+		}
+		if paymentDispute.Status != models.PaymentDisputeStatusOpen {
+			closedAt := time.Unix(webhook.CreatedAt, 0)
+			paymentDispute.ClosedAt = &closedAt
+		}
+		return &WebhookEvent{
+			ID:      fmt.Sprintf("%s:%s:%d", webhook.Event, dispute.ID, webhook.CreatedAt),
+			Type:    WebhookEventPaymentDisputed,
+			Payment: g.paymentUpdate(&payload.Payment.Entity),
+			Dispute: paymentDispute,
+		}, nil
+	}
+	return nil, nil
+}
+
+// CreateRazorpayOrder creates the razorpay order a customer pays an order or a job with in razorpay checkout.
+func CreateRazorpayOrder(request PaymentRequest) (*models.RazorpayOrder, error) {
+	gateway, err := razorpayGateway()
+	if err != nil {
+		return nil, err
+	}
+	err = checkGatewaySelected(gateway.Name(), request.StoreID)
+	if err != nil {
+		return nil, err
+	}
+	payment, err := gateway.Authorize(request)
+	if err != nil {
+		return nil, err
+	}
+	return &models.RazorpayOrder{
+		ID:       payment.ID,
+		KeyID:    gateway.KeyID(),
+		Amount:   int(razorpay.AmountInPaise(payment.Amount)),
+		Currency: payment.Currency,
+		Receipt:  payment.Reference,
+	}, nil
+}
+
+// VerifyRazorpayPayment checks the signature razorpay checkout gives for a payment of a razorpay order,
+// captures the payment when it is only authorized and records it against the order or job it paid for.
+func VerifyRazorpayPayment(razorpayOrderID string, razorpayPaymentID string, signature string) error {
+	gateway, err := razorpayGateway()
+	if err != nil {
+		return err
+	}
+	err = gateway.client.VerifyPaymentSignature(razorpayOrderID, razorpayPaymentID, signature)
+	if err != nil {
+		return err
+	}
+	payment, err := gateway.client.GetPayment(razorpayPaymentID)
+	if err != nil {
+		return err
+	}
+	if payment.OrderID != razorpayOrderID {
+		return ErrRazorpayPaymentMismatch
+	}
+	if payment.Status == razorpay.PaymentStatusAuthorized {
+		payment, err = gateway.client.CapturePayment(payment.ID, payment.Amount, payment.Currency)
+		if err != nil {
+			return err
+		}
+	}
+	if payment.Status != razorpay.PaymentStatusCaptured {
+		return fmt.Errorf("razorpay payment %s is %s", payment.ID, payment.Status)
+	}
+	update := gateway.paymentUpdate(payment)
+	err = models.RecordGatewayPaymentSucceeded(update)
+	if err != nil {
+		return err
+	}
+	return gateway.SplitPayment(update)
+}
+
+// SplitPayment splits a captured payment with razorpay route, sending the shares of the stores or provider
+// that have a linked account to it. Shares of orders and jobs that aren't completed yet are held by razorpay until they are.
+// The transfers are kept as pending before they are made, and transfers razorpay made for them earlier are recorded
+// instead of being made again, so the transfers of a payment are made once however often it is recorded.
+func (g *RazorpayGateway) SplitPayment(update models.GatewayPaymentUpdate) error {
+	var splits []models.PaymentSplit
+	switch {
+	case update.OrderID != "":
+		order, err := models.GetOrderByID(update.OrderID)
+		if err != nil || order == nil {
+			return err
+		}
+		splits = models.OrderPaymentSplits(order, models.RazorpayRouteAccountKey)
+	case update.JobID != "":
+		job, err := models.GetJobByID(update.JobID)
+		if err != nil || job == nil {
+			return err
+		}
+		splits = models.JobPaymentSplits(job, update.Amount, update.Currency, models.RazorpayRouteAccountKey)
+	}
+	if len(splits) == 0 {
+		return nil
+	}
+	claimed, err := models.ClaimPaymentEvent(RazorpayGatewayName, "transfers:"+update.PaymentID, "route.transfers")
+	if err != nil || claimed == nil {
+		return err
+	}
+	err = g.transferSplits(update, splits)
+	finishErr := models.FinishPaymentEvent(claimed, err)
+	if finishErr != nil {
+		log.Errorln(finishErr)
+	}
+	return err
+}
+
+// transferSplits makes the transfers of the splits of a payment that razorpay hasn't made yet and records them all.
+func (g *RazorpayGateway) transferSplits(update models.GatewayPaymentUpdate, splits []models.PaymentSplit) error {
+	err := models.RecordPendingPaymentTransfers(RazorpayGatewayName, update.PaymentID, splits)
+	if err != nil {
+		return err
+	}
+	existing, err := g.client.GetPaymentTransfers(update.PaymentID)
+	if err != nil {
+		return err
+	}
+	made := map[string]*razorpay.Transfer{}
+	for _, transfer := range existing {
+		if key := transfer.Notes["transfer_key"]; key != "" {
+			made[key] = transfer
+		}
+	}
+	var requests []razorpay.TransferRequest
+	for _, split := range splits {
+		key := models.PaymentTransferKey(update.PaymentID, split)
+		if _, ok := made[key]; ok {
+			continue
+		}
+		currency := strings.ToUpper(split.Currency)
+		if currency == "" {
+			currency = update.Currency
+		}
+		notes := razorpay.Notes{"payee_type": split.PayeeType, "payee_id": split.PayeeID.Hex(), "transfer_key": key}
+		if !split.OrderID.IsZero() {
+			notes["order_id"] = split.OrderID.Hex()
+		}
+		if !split.JobID.IsZero() {
+			notes["job_id"] = split.JobID.Hex()
+		}
+		requests = append(requests, razorpay.TransferRequest{
+			Account:  split.AccountID,
+			Amount:   razorpay.AmountInPaise(split.Amount),
+			Currency: currency,
+			Notes:    notes,
+			OnHold:   split.OnHold,
+		})
+	}
+	if len(requests) > 0 {
+		transfers, err := g.client.TransferPayment(update.PaymentID, requests)
+		if err != nil {
+			return err
+		}
+		for _, transfer := range transfers {
+			made[transfer.Notes["transfer_key"]] = transfer
+		}
+	}
+	for _, split := range splits {
+		transfer, ok := made[models.PaymentTransferKey(update.PaymentID, split)]
+		if !ok {
+			return fmt.Errorf("razorpay made no transfer of payment %s to %s", update.PaymentID, split.AccountID)
+		}
+		err = models.RecordPaymentTransfer(split, models.PaymentTransfer{
+			ID:        transfer.ID,
+			Gateway:   RazorpayGatewayName,
+			PaymentID: update.PaymentID,
+			AccountID: transfer.Recipient,
+			Amount:    razorpay.AmountFromPaise(transfer.Amount),
+			Currency:  strings.ToUpper(transfer.Currency),
+			OnHold:    transfer.OnHold,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReleaseTransfer takes a razorpay route transfer off hold, so razorpay pays it out to the linked account.
+func (g *RazorpayGateway) ReleaseTransfer(transfer models.PaymentTransfer) error {
+	_, err := g.client.ReleaseTransfer(transfer.ID)
+	return err
+}
+
+// ReverseTransfer takes part of a razorpay route transfer back from the linked account for a refund.
+func (g *RazorpayGateway) ReverseTransfer(transfer models.PaymentTransfer, amount float64, refundID string) (string, error) {
+	reversal, err := g.client.ReverseTransfer(transfer.ID, razorpay.AmountInPaise(amount), refundID)
+	if err != nil {
+		return "", err
+	}
+	return reversal.ID, nil
+}
+
+// razorpayGateway gives the registered razorpay gateway.
+func razorpayGateway() (*RazorpayGateway, error) {
+	gateway, err := GetGateway(RazorpayGatewayName)
+	if err != nil {
+		return nil, err
+	}
+	razorpayGateway, ok := gateway.(*RazorpayGateway)
+	if !ok {
+		return nil, ErrGatewayNotFound
+	}
+	return razorpayGateway, nil
+}
+
 // RazorPayWebHookHandler handles razor pay webhooks.
 func RazorPayWebHookHandler(ctx echo.Context) error {
-	return ctx.JSON(http.StatusOK, "")
+	return WebHookHandler(RazorpayGatewayName)(ctx)
 }
@@ -0,0 +1,35 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package payments
+
+import (
+	"github.com/stretchr/testify/require"
+	"github.com/tribehq/platform/lib/payments/razorpay"
+	"github.com/tribehq/platform/models"
+	"testing"
+)
+
+func TestRazorpayPayoutWebhooks(t *testing.T) {
+	gateway := NewRazorpayGateway(razorpay.New("key", "secret"))
+	events := map[string]models.PayoutStatus{
+		"payout.processed": models.PayoutStatusPaid,
+		"payout.failed":    models.PayoutStatusFailed,
+		"payout.reversed":  models.PayoutStatusReversed,
+	}
+	for name, status := range events {
+		body := `{"event":"` + name + `","payload":{"payout":{"entity":{"id":"pout_1","reference_id":"w1","status":"` +
+			name[len("payout."):] + `","failure_reason":"","notes":[]}}},"created_at":1}`
+		event, err := gateway.ParseWebhookEvent([]byte(body))
+		require.NoError(t, err)
+		require.Equal(t, name+":pout_1", event.ID)
+		require.Equal(t, WebhookEventPayoutUpdated, event.Type)
+		require.Equal(t, RazorpayGatewayName, event.Payment.Gateway)
+		require.Equal(t, &models.PayoutResult{WithdrawalID: "w1", Reference: "pout_1", Status: status}, event.Payout)
+	}
+
+	ignored, err := gateway.ParseWebhookEvent([]byte(`{"event":"payout.queued","payload":{"payout":{"entity":{"id":"pout_1"}}}}`))
+	require.NoError(t, err)
+	require.Nil(t, ignored)
+}
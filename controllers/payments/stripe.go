@@ -5,61 +5,503 @@
 package payments
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/labstack/echo/v4"
 	log "github.com/sirupsen/logrus"
 	"github.com/stripe/stripe-go"
+	"github.com/stripe/stripe-go/client"
 	"github.com/stripe/stripe-go/webhook"
+	stripepayments "github.com/tribehq/platform/lib/payments/stripe"
+	"github.com/tribehq/platform/models"
+	"io/ioutil"
 	"net/http"
-	"os"
+	"strings"
+	"time"
 )
 
-// StripeWebHookHandler handles stripe webhooks.
-func StripeWebHookHandler(ctx echo.Context) error {
-	bodyStream, err := ctx.Request().GetBody()
-	buf := new(bytes.Buffer)
-	_, err = buf.ReadFrom(bodyStream)
+// StripeGatewayName is the name stripe payments are recorded under.
+const StripeGatewayName = "stripe"
+
+// stripeSignatureHeader is the header stripe signs its webhooks in.
+const stripeSignatureHeader = "Stripe-Signature"
+
+// ErrStripeChargeNotFound is returned when a payment intent has no charge to refund.
+var ErrStripeChargeNotFound = errors.New("stripe payment has no charge to refund")
+
+// StripeGateway takes payments with stripe payment intents. Cards are tokenized by stripe.js and saved
+// from the payment_method webhooks, so they never reach us.
+type StripeGateway struct {
+	api           *client.API
+	webhookSecret string
+}
+
+// NewStripeGateway gives a stripe gateway using the stripe secret key and webhook signing secret.
+func NewStripeGateway(secretKey string, webhookSecret string) *StripeGateway {
+	return &StripeGateway{api: client.New(secretKey, nil), webhookSecret: webhookSecret}
+}
+
+// Name is the name stripe payments are recorded under.
+func (g *StripeGateway) Name() string {
+	return StripeGatewayName
+}
+
+// stripePayment gives a stripe payment intent in the terms of the gateway.
+func stripePayment(intent *stripe.PaymentIntent) *Payment {
+	currency := string(intent.Currency)
+	payment := &Payment{
+		ID:        intent.ID,
+		Reference: intent.Metadata["charge_id"],
+		OrderID:   intent.Metadata["order_id"],
+		JobID:     intent.Metadata["job_id"],
+		Status:    PaymentStatusPending,
+		Amount:    stripepayments.AmountFromMinorUnits(intent.Amount, currency),
+		Currency:  strings.ToUpper(currency),
+	}
+	switch intent.Status {
+	case stripe.PaymentIntentStatusRequiresCapture:
+		payment.Status = PaymentStatusAuthorized
+	case stripe.PaymentIntentStatusSucceeded:
+		payment.Status = PaymentStatusCaptured
+		payment.CapturedAmount = stripepayments.AmountFromMinorUnits(intent.AmountReceived, currency)
+	case stripe.PaymentIntentStatusCanceled:
+		payment.Status = PaymentStatusVoided
+	case stripe.PaymentIntentStatusRequiresPaymentMethod:
+		//a payment intent goes back to needing a payment method when its payment fails
+		payment.Status = PaymentStatusFailed
+	}
+	if intent.LastPaymentError != nil {
+		payment.FailureReason = intent.LastPaymentError.Message
+	}
+	return payment
+}
+
+// Authorize confirms a payment intent for the payment method, off session when it is saved for a customer.
+// The amount is only held until it is captured when the request doesn't capture.
+func (g *StripeGateway) Authorize(request PaymentRequest) (*Payment, error) {
+	currency := strings.ToLower(request.Currency)
+	params := &stripe.PaymentIntentParams{
+		Amount:   stripe.Int64(stripepayments.AmountInMinorUnits(request.Amount, currency)),
+		Currency: stripe.String(currency),
+		Confirm:  stripe.Bool(true),
+	}
+	if request.Token != "" {
+		params.PaymentMethod = stripe.String(request.Token)
+	}
+	if request.CustomerID != "" {
+		params.Customer = stripe.String(request.CustomerID)
+		params.AddExtra("off_session", "true")
+	}
+	if request.Description != "" {
+		params.Description = stripe.String(request.Description)
+	}
+	if !request.Capture {
+		params.CaptureMethod = stripe.String(string(stripe.PaymentIntentCaptureMethodManual))
+	}
+	params.SetIdempotencyKey(request.Reference)
+	params.AddMetadata("charge_id", request.Reference)
+	if request.OrderID != "" {
+		params.AddMetadata("order_id", request.OrderID)
+	}
+	if request.JobID != "" {
+		params.AddMetadata("job_id", request.JobID)
+	}
+	intent, err := g.api.PaymentIntents.New(params)
 	if err != nil {
-		log.Error(err)
+		stripeErr, ok := err.(*stripe.Error)
+		if !ok || stripeErr.Type != stripe.ErrorTypeCard {
+			return nil, err
+		}
+		//declined off session payments come back as card errors, with the failed payment intent when one was made
+		log.Errorf("Stripe declined payment %s: %s\n", request.Reference, stripeErr.Msg)
+		if stripeErr.PaymentIntent == nil {
+			return nil, ErrPaymentDeclined
+		}
+		intent = stripeErr.PaymentIntent
+	}
+	payment := stripePayment(intent)
+	payment.Reference = request.Reference
+	if payment.Status == PaymentStatusFailed {
+		return payment, ErrPaymentDeclined
+	}
+	return payment, nil
+}
+
+// Capture captures part or all of an authorized payment intent, all of it when no amount is given.
+func (g *StripeGateway) Capture(paymentID string, amount float64) (*Payment, error) {
+	intent, err := g.api.PaymentIntents.Get(paymentID, nil)
+	if err != nil {
+		return nil, err
 	}
+	if intent.Status != stripe.PaymentIntentStatusRequiresCapture {
+		return nil, ErrInvalidPaymentState
+	}
+	params := &stripe.PaymentIntentCaptureParams{}
+	if amount > 0 {
+		params.AmountToCapture = stripe.Int64(stripepayments.AmountInMinorUnits(amount, string(intent.Currency)))
+	}
+	params.SetIdempotencyKey("capture:" + paymentID)
+	intent, err = g.api.PaymentIntents.Capture(paymentID, params)
+	if err != nil {
+		return nil, err
+	}
+	return stripePayment(intent), nil
+}
 
-	event, err := webhook.ConstructEvent(buf.Bytes(), ctx.Request().Header.Get("Stripe-Signature"), os.Getenv("STRIPE_WEBHOOK_SECRET"))
+// Refund refunds part or all of a charge, payment intents are refunded through their latest charge.
+func (g *StripeGateway) Refund(request RefundRequest) (*Refund, error) {
+	chargeID := request.PaymentID
+	if strings.HasPrefix(chargeID, "pi_") {
+		intent, err := g.api.PaymentIntents.Get(chargeID, nil)
+		if err != nil {
+			return nil, err
+		}
+		if intent.Charges == nil || len(intent.Charges.Data) == 0 {
+			return nil, ErrStripeChargeNotFound
+		}
+		chargeID = intent.Charges.Data[0].ID
+	}
+	params := &stripe.RefundParams{
+		Charge: stripe.String(chargeID),
+		Amount: stripe.Int64(stripepayments.AmountInMinorUnits(request.Amount, request.Currency)),
+		Reason: stripe.String(string(stripe.RefundReasonRequestedByCustomer)),
+	}
+	params.SetIdempotencyKey(request.RefundID)
+	params.AddMetadata("order_id", request.OrderID)
+	params.AddMetadata("refund_id", request.RefundID)
+	refund, err := g.api.Refunds.New(params)
+	if err != nil {
+		return nil, err
+	}
+	return &Refund{ID: refund.ID, RefundID: request.RefundID, PaymentID: request.PaymentID, Amount: request.Amount}, nil
+}
 
+// Void cancels a payment intent that hasn't been captured, releasing the amount it held.
+func (g *StripeGateway) Void(paymentID string) (*Payment, error) {
+	params := &stripe.PaymentIntentCancelParams{}
+	params.SetIdempotencyKey("void:" + paymentID)
+	intent, err := g.api.PaymentIntents.Cancel(paymentID, params)
 	if err != nil {
-		log.Errorf("Error verifying stripe webhook signature: %v\n", err)
-		return ctx.NoContent(http.StatusBadRequest) // Return a 400 error on a bad signature
+		return nil, err
 	}
+	return stripePayment(intent), nil
+}
+
+// AttachPaymentMethod attaches a payment method stripe.js created to the user's stripe customer, creating the customer
+// when the user has none yet. Customers we create carry the user's id, which is how webhooks of their payment methods find the user.
+func (g *StripeGateway) AttachPaymentMethod(request AttachRequest) (*PaymentToken, error) {
+	customerID := request.CustomerID
+	if customerID == "" {
+		params := &stripe.CustomerParams{}
+		params.AddMetadata("user_id", request.UserID)
+		params.SetIdempotencyKey("customer:" + request.UserID)
+		customer, err := g.api.Customers.New(params)
+		if err != nil {
+			return nil, err
+		}
+		customerID = customer.ID
+	}
+	method, err := g.api.PaymentMethods.Attach(request.Token, &stripe.PaymentMethodAttachParams{Customer: stripe.String(customerID)})
+	if err != nil {
+		if stripeErr, ok := err.(*stripe.Error); ok {
+			switch stripeErr.Type {
+			case stripe.ErrorTypeCard:
+				return nil, ErrPaymentDeclined
+			case stripe.ErrorTypeInvalidRequest:
+				return nil, ErrInvalidPaymentToken
+			}
+		}
+		return nil, err
+	}
+	if method.Card == nil {
+		return nil, ErrInvalidPaymentToken
+	}
+	return &PaymentToken{
+		Token:       method.ID,
+		CustomerID:  customerID,
+		Brand:       string(method.Card.Brand),
+		Last4:       method.Card.Last4,
+		ExpMonth:    int(method.Card.ExpMonth),
+		ExpYear:     int(method.Card.ExpYear),
+		Fingerprint: method.Card.Fingerprint,
+	}, nil
+}
+
+// VerifyWebhook checks the webhook is signed with the stripe webhook secret.
+func (g *StripeGateway) VerifyWebhook(header http.Header, body []byte) error {
+	err := webhook.ValidatePayload(body, header.Get(stripeSignatureHeader), g.webhookSecret)
+	if err != nil {
+		return ErrInvalidWebhookSignature
+	}
+	return nil
+}
+
+// stripePaymentUpdate describes a stripe payment intent for recording against the order or job it paid for.
+func stripePaymentUpdate(paymentIntentID string, metadata map[string]string, amount int64, currency string) models.GatewayPaymentUpdate {
+	return models.GatewayPaymentUpdate{
+		Gateway:   StripeGatewayName,
+		PaymentID: paymentIntentID,
+		OrderID:   metadata["order_id"],
+		JobID:     metadata["job_id"],
+		Amount:    stripepayments.AmountFromMinorUnits(amount, currency),
+		Currency:  strings.ToUpper(currency),
+	}
+}
 
+// ParseWebhookEvent reads a stripe webhook about a payment intent, a refund or a dispute.
+// The payment method events that keep saved cards in sync are handled by StripeWebHookHandler.
+func (g *StripeGateway) ParseWebhookEvent(body []byte) (*WebhookEvent, error) {
+	var event stripe.Event
+	err := json.Unmarshal(body, &event)
+	if err != nil {
+		return nil, err
+	}
+	if event.Data == nil {
+		return nil, nil
+	}
+	data := event.Data.Raw
 	switch event.Type {
-	case "payment_intent.succeeded":
-		var paymentIntent stripe.PaymentIntent
-		err := json.Unmarshal(event.Data.Raw, &paymentIntent)
+	case "payment_intent.succeeded", "payment_intent.payment_failed", "payment_intent.canceled":
+		var intent stripe.PaymentIntent
+		err = json.Unmarshal(data, &intent)
 		if err != nil {
-			log.Errorf("Error parsing stripe webhook JSON: %v\n", err)
-			return ctx.NoContent(http.StatusBadRequest)
+			return nil, err
 		}
-		handlePaymentIntentSucceeded(paymentIntent)
-	case "payment_method.attached":
-		var paymentMethod stripe.PaymentMethod
-		err := json.Unmarshal(event.Data.Raw, &paymentMethod)
+		currency := string(intent.Currency)
+		result := &WebhookEvent{ID: event.ID}
+		switch event.Type {
+		case "payment_intent.succeeded":
+			result.Type = WebhookEventPaymentSucceeded
+			result.Payment = stripePaymentUpdate(intent.ID, intent.Metadata, intent.AmountReceived, currency)
+		case "payment_intent.payment_failed":
+			result.Type = WebhookEventPaymentFailed
+			result.Payment = stripePaymentUpdate(intent.ID, intent.Metadata, intent.Amount, currency)
+			if intent.LastPaymentError != nil {
+				result.Payment.Reason = intent.LastPaymentError.Message
+			}
+		default:
+			//the version of stripe-go in use doesn't decode the cancellation reason
+			var cancellation struct {
+				CancellationReason string `json:"cancellation_reason"`
+			}
+			err = json.Unmarshal(data, &cancellation)
+			if err != nil {
+				return nil, err
+			}
+			result.Type = WebhookEventPaymentCancelled
+			result.Payment = stripePaymentUpdate(intent.ID, intent.Metadata, intent.Amount, currency)
+			result.Payment.Reason = strings.Replace(cancellation.CancellationReason, "_", " ", -1)
+		}
+		return result, nil
+	case "charge.refunded":
+		var charge stripe.Charge
+		err = json.Unmarshal(data, &charge)
 		if err != nil {
-			log.Errorf("Error parsing stripe webhook JSON: %v\n", err)
-			return ctx.NoContent(http.StatusBadRequest)
+			return nil, err
 		}
-		handlePaymentMethodAttached(paymentMethod)
-	default:
-		log.Errorf("Unexpected stripe webhook event type: %s\n", event.Type)
-		return ctx.NoContent(http.StatusBadRequest)
+		currency := string(charge.Currency)
+		update := stripePaymentUpdate(charge.PaymentIntent, charge.Metadata, charge.Amount, currency)
+		if update.PaymentID == "" {
+			update.PaymentID = charge.ID
+		}
+		var refunds []models.GatewayRefundUpdate
+		if charge.Refunds != nil {
+			for _, refund := range charge.Refunds.Data {
+				if refund.Status != stripe.RefundStatusSucceeded && refund.Status != stripe.RefundStatusPending {
+					continue
+				}
+				refunds = append(refunds, models.GatewayRefundUpdate{
+					GatewayRefundID: refund.ID,
+					RefundID:        refund.Metadata["refund_id"],
+					Amount:          stripepayments.AmountFromMinorUnits(refund.Amount, currency),
+					Reason:          strings.Replace(string(refund.Reason), "_", " ", -1),
+				})
+			}
+		}
+		return &WebhookEvent{
+			ID:            event.ID,
+			Type:          WebhookEventPaymentRefunded,
+			Payment:       update,
+			Refunds:       refunds,
+			TotalRefunded: stripepayments.AmountFromMinorUnits(charge.AmountRefunded, currency),
+		}, nil
+	case "charge.dispute.created", "charge.dispute.updated", "charge.dispute.closed",
+		"charge.dispute.funds_withdrawn", "charge.dispute.funds_reinstated":
+		return g.parseDispute(event.ID, data)
 	}
+	return nil, nil
+}
 
-	return ctx.JSON(http.StatusOK, "")
+// parseDispute reads a stripe dispute. Disputes only carry the id of their charge, which in turn knows the payment intent.
+func (g *StripeGateway) parseDispute(eventID string, data json.RawMessage) (*WebhookEvent, error) {
+	var dispute stripe.Dispute
+	err := json.Unmarshal(data, &dispute)
+	if err != nil {
+		return nil, err
+	}
+	if dispute.Charge == nil || dispute.Charge.ID == "" {
+		return nil, nil
+	}
+	charge, err := g.api.Charges.Get(dispute.Charge.ID, nil)
+	if err != nil {
+		return nil, err
+	}
+	currency := string(dispute.Currency)
+	update := stripePaymentUpdate(charge.PaymentIntent, charge.Metadata, charge.Amount, string(charge.Currency))
+	if update.PaymentID == "" {
+		update.PaymentID = charge.ID
+	}
+	paymentDispute := &models.PaymentDispute{
+		ID:       dispute.ID,
+		Amount:   stripepayments.AmountFromMinorUnits(dispute.Amount, currency),
+		Currency: strings.ToUpper(currency),
+		Reason:   strings.Replace(string(dispute.Reason), "_", " ", -1),
+		Status:   models.PaymentDisputeStatusOpen,
+		OpenedAt: time.Unix(dispute.Created, 0),
+	}
+	switch dispute.Status {
+	case stripe.DisputeStatusWon, stripe.DisputeStatusWarningClosed:
+		paymentDispute.Status = models.PaymentDisputeStatusWon
+	case stripe.DisputeStatusLost, stripe.DisputeStatusChargeRefunded:
+		paymentDispute.Status = models.PaymentDisputeStatusLost
+	}
+	if paymentDispute.Status != models.PaymentDisputeStatusOpen {
+		now := time.Now()
+		paymentDispute.ClosedAt = &now
+	}
+	return &WebhookEvent{
+		ID:      eventID,
+		Type:    WebhookEventPaymentDisputed,
+		Payment: update,
+		Dispute: paymentDispute,
+	}, nil
 }
 
-func handlePaymentMethodAttached(method stripe.PaymentMethod) {
+// stripeGateway gives the registered stripe gateway.
+func stripeGateway() (*StripeGateway, error) {
+	gateway, err := GetGateway(StripeGatewayName)
+	if err != nil {
+		return nil, err
+	}
+	stripeGateway, ok := gateway.(*StripeGateway)
+	if !ok {
+		return nil, ErrGatewayNotFound
+	}
+	return stripeGateway, nil
+}
 
+// StripeWebHookHandler handles stripe webhooks.
+// Payment method events keep the cards customers saved with stripe.js in sync, and the rest are
+// handled like the webhooks of any other gateway. Each event is handled once, events we don't act on
+// are acknowledged so stripe stops sending them, and events that fail get a 500 so stripe retries them.
+func StripeWebHookHandler(ctx echo.Context) error {
+	gateway, err := stripeGateway()
+	if err != nil {
+		return ctx.NoContent(http.StatusNotFound)
+	}
+	body, err := ioutil.ReadAll(ctx.Request().Body)
+	if err != nil {
+		log.Error(err)
+		return ctx.NoContent(http.StatusBadRequest)
+	}
+	err = gateway.VerifyWebhook(ctx.Request().Header, body)
+	if err != nil {
+		log.Errorf("Error verifying stripe webhook signature: %v\n", err)
+		return ctx.NoContent(http.StatusBadRequest)
+	}
+	var event stripe.Event
+	err = json.Unmarshal(body, &event)
+	if err != nil || event.Data == nil {
+		log.Errorf("Error parsing stripe webhook: %v\n", err)
+		return ctx.NoContent(http.StatusBadRequest)
+	}
+	if handler, ok := stripePaymentMethodHandlers[event.Type]; ok {
+		return handleWebhookEvent(ctx, gateway, event.ID, event.Type, func() error {
+			return handler(gateway, event.Data.Raw)
+		})
+	}
+	parsed, err := gateway.ParseWebhookEvent(body)
+	if err != nil {
+		log.Errorf("Error parsing stripe webhook event %s (%s): %v\n", event.ID, event.Type, err)
+		if _, malformed := err.(*json.SyntaxError); malformed {
+			return ctx.NoContent(http.StatusBadRequest)
+		}
+		return ctx.NoContent(http.StatusInternalServerError)
+	}
+	if parsed == nil {
+		log.Debugf("Ignoring stripe webhook event type: %s\n", event.Type)
+		return ctx.JSON(http.StatusOK, "")
+	}
+	return handleWebhookEvent(ctx, gateway, parsed.ID, string(parsed.Type), func() error {
+		return recordGatewayEvent(gateway, parsed)
+	})
+}
+
+// stripePaymentMethodHandlers are the stripe payment method webhook events we act on, keyed by event type.
+var stripePaymentMethodHandlers = map[string]func(g *StripeGateway, data json.RawMessage) error{
+	"payment_method.attached":                   handlePaymentMethodAttached,
+	"payment_method.updated":                    handlePaymentMethodAttached,
+	"payment_method.card_automatically_updated": handlePaymentMethodAttached,
+	"payment_method.detached":                   handlePaymentMethodDetached,
+}
+
+// handlePaymentMethodAttached saves a card attached to a customer of ours, or brings the saved one up to date.
+// The user is the one the customer belongs to, never one the payment method names, as anyone can name one with stripe.js.
+func handlePaymentMethodAttached(g *StripeGateway, data json.RawMessage) error {
+	var method stripe.PaymentMethod
+	err := json.Unmarshal(data, &method)
+	if err != nil {
+		return err
+	}
+	if method.Customer == nil || method.Customer.ID == "" {
+		return nil
+	}
+	paymentMethod := models.PaymentMethod{
+		Name:                   string(method.Type),
+		Type:                   models.PaymentMethodTypeCredit,
+		Gateway:                StripeGatewayName,
+		GatewayPaymentMethodID: method.ID,
+		GatewayCustomerID:      method.Customer.ID,
+	}
+	if method.Card != nil {
+		paymentMethod.Brand = string(method.Card.Brand)
+		paymentMethod.Last4 = method.Card.Last4
+		paymentMethod.ExpMonth = int(method.Card.ExpMonth)
+		paymentMethod.ExpYear = int(method.Card.ExpYear)
+		paymentMethod.Fingerprint = method.Card.Fingerprint
+		paymentMethod.Name = fmt.Sprintf("%s •••• %s", strings.Title(paymentMethod.Brand), paymentMethod.Last4)
+		if method.Card.Funding == stripe.CardFundingDebit {
+			paymentMethod.Type = models.PaymentMethodTypeDebit
+		}
+	}
+	paymentMethod.UserID, err = g.customerUserID(method.Customer.ID)
+	if err != nil {
+		return err
+	}
+	_, err = models.SyncGatewayPaymentMethod(paymentMethod)
+	return err
 }
 
-func handlePaymentIntentSucceeded(intent stripe.PaymentIntent) {
+// customerUserID gives the user a stripe customer belongs to, by what was saved for the customer,
+// else by the user id the customer was created with.
+func (g *StripeGateway) customerUserID(customerID string) (string, error) {
+	userID, err := models.GatewayCustomerUserID(StripeGatewayName, customerID)
+	if err != nil || userID != "" {
+		return userID, err
+	}
+	customer, err := g.api.Customers.Get(customerID, nil)
+	if err != nil {
+		return "", err
+	}
+	return customer.Metadata["user_id"], nil
+}
 
+func handlePaymentMethodDetached(g *StripeGateway, data json.RawMessage) error {
+	var method stripe.PaymentMethod
+	err := json.Unmarshal(data, &method)
+	if err != nil {
+		return err
+	}
+	return models.DetachGatewayPaymentMethod(StripeGatewayName, method.ID)
 }
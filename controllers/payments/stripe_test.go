@@ -0,0 +1,223 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package payments
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"github.com/stripe/stripe-go"
+	"github.com/stripe/stripe-go/client"
+	"github.com/stripe/stripe-go/webhook"
+	"github.com/tribehq/platform/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testStripeGateway gives a stripe gateway talking to the test server.
+func testStripeGateway(t *testing.T, handler http.HandlerFunc) *StripeGateway {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	backends := &stripe.Backends{
+		API: stripe.GetBackendWithConfig(stripe.APIBackend, &stripe.BackendConfig{URL: server.URL}),
+	}
+	return &StripeGateway{api: client.New("sk_test_key", backends), webhookSecret: "whsec_test"}
+}
+
+func stripeEvent(id string, eventType string, object string) []byte {
+	return []byte(fmt.Sprintf(`{"id":%q,"type":%q,"data":{"object":%s}}`, id, eventType, object))
+}
+
+func TestStripeVerifyWebhook(t *testing.T) {
+	gateway := &StripeGateway{webhookSecret: "whsec_test"}
+	body := stripeEvent("evt_1", "payment_intent.succeeded", `{"id":"pi_1"}`)
+	now := time.Now()
+	header := http.Header{}
+	header.Set(stripeSignatureHeader, fmt.Sprintf("t=%d,v1=%s", now.Unix(), hex.EncodeToString(webhook.ComputeSignature(now, body, "whsec_test"))))
+	require.NoError(t, gateway.VerifyWebhook(header, body))
+
+	forged := http.Header{}
+	forged.Set(stripeSignatureHeader, fmt.Sprintf("t=%d,v1=%s", now.Unix(), hex.EncodeToString(webhook.ComputeSignature(now, body, "whsec_other"))))
+	require.Equal(t, ErrInvalidWebhookSignature, gateway.VerifyWebhook(forged, body))
+	require.Equal(t, ErrInvalidWebhookSignature, gateway.VerifyWebhook(http.Header{}, body))
+}
+
+func TestStripeParsePaymentIntentEvents(t *testing.T) {
+	gateway := &StripeGateway{}
+
+	event, err := gateway.ParseWebhookEvent(stripeEvent("evt_1", "payment_intent.succeeded",
+		`{"id":"pi_1","amount":25000,"amount_received":25000,"currency":"inr","metadata":{"order_id":"o1"}}`))
+	require.NoError(t, err)
+	require.Equal(t, "evt_1", event.ID)
+	require.Equal(t, WebhookEventPaymentSucceeded, event.Type)
+	require.Equal(t, models.GatewayPaymentUpdate{Gateway: StripeGatewayName, PaymentID: "pi_1", OrderID: "o1", Amount: 250, Currency: "INR"}, event.Payment)
+
+	event, err = gateway.ParseWebhookEvent(stripeEvent("evt_2", "payment_intent.payment_failed",
+		`{"id":"pi_2","amount":1000,"currency":"jpy","metadata":{"job_id":"j1"},"last_payment_error":{"message":"Your card was declined."}}`))
+	require.NoError(t, err)
+	require.Equal(t, WebhookEventPaymentFailed, event.Type)
+	require.Equal(t, "j1", event.Payment.JobID)
+	require.Equal(t, 1000.0, event.Payment.Amount)
+	require.Equal(t, "Your card was declined.", event.Payment.Reason)
+
+	event, err = gateway.ParseWebhookEvent(stripeEvent("evt_3", "payment_intent.canceled",
+		`{"id":"pi_3","amount":500,"currency":"usd","cancellation_reason":"requested_by_customer"}`))
+	require.NoError(t, err)
+	require.Equal(t, WebhookEventPaymentCancelled, event.Type)
+	require.Equal(t, "requested by customer", event.Payment.Reason)
+
+	for _, eventType := range []string{"payment_method.attached", "customer.created"} {
+		event, err = gateway.ParseWebhookEvent(stripeEvent("evt_4", eventType, `{"id":"pm_1"}`))
+		require.NoError(t, err)
+		require.Nil(t, event)
+	}
+}
+
+func TestStripeParseChargeRefunded(t *testing.T) {
+	gateway := &StripeGateway{}
+	event, err := gateway.ParseWebhookEvent(stripeEvent("evt_1", "charge.refunded", `{
+		"id":"ch_1","payment_intent":"pi_1","amount":10000,"amount_refunded":3000,"currency":"inr","metadata":{"order_id":"o1"},
+		"refunds":{"data":[
+			{"id":"re_1","amount":2000,"status":"succeeded","reason":"requested_by_customer","metadata":{"refund_id":"r1"}},
+			{"id":"re_2","amount":1000,"status":"pending","metadata":{"refund_id":"r2"}},
+			{"id":"re_3","amount":500,"status":"failed","metadata":{"refund_id":"r3"}}
+		]}}`))
+	require.NoError(t, err)
+	require.Equal(t, WebhookEventPaymentRefunded, event.Type)
+	require.Equal(t, "pi_1", event.Payment.PaymentID)
+	require.Equal(t, 30.0, event.TotalRefunded)
+	require.Equal(t, []models.GatewayRefundUpdate{
+		{GatewayRefundID: "re_1", RefundID: "r1", Amount: 20, Reason: "requested by customer"},
+		{GatewayRefundID: "re_2", RefundID: "r2", Amount: 10},
+	}, event.Refunds)
+}
+
+func TestStripeParseDispute(t *testing.T) {
+	gateway := testStripeGateway(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/charges/ch_1", r.URL.Path)
+		fmt.Fprint(w, `{"id":"ch_1","payment_intent":"pi_1","amount":10000,"currency":"inr","metadata":{"job_id":"j1"}}`)
+	})
+	event, err := gateway.ParseWebhookEvent(stripeEvent("evt_1", "charge.dispute.closed",
+		`{"id":"dp_1","charge":"ch_1","amount":10000,"currency":"inr","reason":"product_not_received","status":"lost","created":1570000000}`))
+	require.NoError(t, err)
+	require.Equal(t, WebhookEventPaymentDisputed, event.Type)
+	require.Equal(t, "j1", event.Payment.JobID)
+	require.Equal(t, "pi_1", event.Payment.PaymentID)
+	require.Equal(t, models.PaymentDisputeStatusLost, event.Dispute.Status)
+	require.Equal(t, "product not received", event.Dispute.Reason)
+	require.Equal(t, 100.0, event.Dispute.Amount)
+	require.NotNil(t, event.Dispute.ClosedAt)
+}
+
+func TestStripeAuthorize(t *testing.T) {
+	gateway := testStripeGateway(t, func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/v1/payment_intents", r.URL.Path)
+		require.NoError(t, r.ParseForm())
+		require.Equal(t, "job1:1", r.Header.Get("Idempotency-Key"))
+		require.Equal(t, "25050", r.Form.Get("amount"))
+		require.Equal(t, "inr", r.Form.Get("currency"))
+		require.Equal(t, "manual", r.Form.Get("capture_method"))
+		require.Equal(t, "true", r.Form.Get("off_session"))
+		require.Equal(t, "pm_1", r.Form.Get("payment_method"))
+		require.Equal(t, "cus_1", r.Form.Get("customer"))
+		require.Equal(t, "job1", r.Form.Get("metadata[job_id]"))
+		fmt.Fprint(w, `{"id":"pi_1","status":"requires_capture","amount":25050,"currency":"inr","metadata":{"job_id":"job1"}}`)
+	})
+	payment, err := gateway.Authorize(PaymentRequest{Reference: "job1:1", JobID: "job1", Amount: 250.5, Currency: "INR", Token: "pm_1", CustomerID: "cus_1"})
+	require.NoError(t, err)
+	require.Equal(t, &Payment{ID: "pi_1", Reference: "job1:1", JobID: "job1", Status: PaymentStatusAuthorized, Amount: 250.5, Currency: "INR"}, payment)
+}
+
+func TestStripeAuthorizeDeclined(t *testing.T) {
+	gateway := testStripeGateway(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusPaymentRequired)
+		fmt.Fprint(w, `{"error":{"type":"card_error","code":"card_declined","message":"Your card was declined.",
+			"payment_intent":{"id":"pi_1","status":"requires_payment_method","amount":1000,"currency":"inr",
+			"last_payment_error":{"message":"Your card was declined."}}}}`)
+	})
+	payment, err := gateway.Authorize(PaymentRequest{Reference: "c1", Amount: 10, Currency: "INR", Token: "pm_1", Capture: true})
+	require.Equal(t, ErrPaymentDeclined, err)
+	require.Equal(t, "pi_1", payment.ID)
+	require.Equal(t, PaymentStatusFailed, payment.Status)
+	require.Equal(t, "Your card was declined.", payment.FailureReason)
+
+	failing := testStripeGateway(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `{"error":{"type":"invalid_request_error","message":"No such customer"}}`)
+	})
+	payment, err = failing.Authorize(PaymentRequest{Reference: "c2", Amount: 10, Currency: "INR", Token: "pm_1", Capture: true})
+	require.Error(t, err)
+	require.NotEqual(t, ErrPaymentDeclined, err)
+	require.Nil(t, payment)
+}
+
+func TestStripeCaptureAndRefund(t *testing.T) {
+	gateway := testStripeGateway(t, func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		switch r.URL.Path {
+		case "/v1/payment_intents/pi_1":
+			fmt.Fprint(w, `{"id":"pi_1","status":"requires_capture","amount":10000,"currency":"inr","charges":{"data":[{"id":"ch_1"}]}}`)
+		case "/v1/payment_intents/pi_2":
+			fmt.Fprint(w, `{"id":"pi_2","status":"succeeded","amount":10000,"currency":"inr","charges":{"data":[{"id":"ch_2"}]}}`)
+		case "/v1/payment_intents/pi_1/capture":
+			require.Equal(t, "8000", r.Form.Get("amount_to_capture"))
+			fmt.Fprint(w, `{"id":"pi_1","status":"succeeded","amount":10000,"amount_received":8000,"currency":"inr"}`)
+		case "/v1/refunds":
+			require.Equal(t, "ch_2", r.Form.Get("charge"))
+			require.Equal(t, "2550", r.Form.Get("amount"))
+			require.Equal(t, "r1", r.Header.Get("Idempotency-Key"))
+			require.Equal(t, "r1", r.Form.Get("metadata[refund_id]"))
+			fmt.Fprint(w, `{"id":"re_1","amount":2550,"status":"succeeded"}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+	payment, err := gateway.Capture("pi_1", 80)
+	require.NoError(t, err)
+	require.Equal(t, PaymentStatusCaptured, payment.Status)
+	require.Equal(t, 80.0, payment.CapturedAmount)
+
+	_, err = gateway.Capture("pi_2", 0)
+	require.Equal(t, ErrInvalidPaymentState, err)
+
+	refund, err := gateway.Refund(RefundRequest{RefundID: "r1", OrderID: "o1", PaymentID: "pi_2", Amount: 25.5, Currency: "INR"})
+	require.NoError(t, err)
+	require.Equal(t, &Refund{ID: "re_1", RefundID: "r1", PaymentID: "pi_2", Amount: 25.5}, refund)
+}
+
+func TestStripeAttachPaymentMethod(t *testing.T) {
+	gateway := testStripeGateway(t, func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		switch r.URL.Path {
+		case "/v1/customers":
+			require.Equal(t, "customer:u1", r.Header.Get("Idempotency-Key"))
+			require.Equal(t, "u1", r.Form.Get("metadata[user_id]"))
+			fmt.Fprint(w, `{"id":"cus_new"}`)
+		case "/v1/payment_methods/pm_1/attach":
+			require.Equal(t, "cus_new", r.Form.Get("customer"))
+			fmt.Fprint(w, `{"id":"pm_1","type":"card","customer":"cus_new",
+				"card":{"brand":"visa","last4":"4242","exp_month":12,"exp_year":2030,"fingerprint":"fp_1"}}`)
+		case "/v1/payment_methods/pm_2/attach":
+			require.Equal(t, "cus_1", r.Form.Get("customer"))
+			w.WriteHeader(http.StatusPaymentRequired)
+			fmt.Fprint(w, `{"error":{"type":"card_error","code":"card_declined","message":"Your card was declined."}}`)
+		case "/v1/payment_methods/pm_3/attach":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":{"type":"invalid_request_error","message":"No such PaymentMethod"}}`)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	})
+	token, err := gateway.AttachPaymentMethod(AttachRequest{Token: "pm_1", UserID: "u1"})
+	require.NoError(t, err)
+	require.Equal(t, &PaymentToken{Token: "pm_1", CustomerID: "cus_new", Brand: "visa", Last4: "4242", ExpMonth: 12, ExpYear: 2030, Fingerprint: "fp_1"}, token)
+
+	_, err = gateway.AttachPaymentMethod(AttachRequest{Token: "pm_2", UserID: "u1", CustomerID: "cus_1"})
+	require.Equal(t, ErrPaymentDeclined, err)
+	_, err = gateway.AttachPaymentMethod(AttachRequest{Token: "pm_3", UserID: "u1", CustomerID: "cus_1"})
+	require.Equal(t, ErrInvalidPaymentToken, err)
+}
@@ -0,0 +1,501 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package payments
+
+import (
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/payments/upi"
+	"github.com/tribehq/platform/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UPIGatewayName is the name UPI payments are recorded under.
+const UPIGatewayName = "upi"
+
+// upiPaymentTimeout is how long the payer has to approve a collect request or pay an intent.
+const upiPaymentTimeout = 15 * time.Minute
+
+// upiLatePaymentWindow is how long the bank is still asked about transactions we expired, for payments made after we stopped waiting.
+const upiLatePaymentWindow = 24 * time.Hour
+
+var (
+	// ErrUPINotConfigured is returned when no bank takes UPI payments.
+	ErrUPINotConfigured = errors.New("upi payments are not available")
+	// ErrVPANotFound is returned when the bank doesn't know a UPI address.
+	ErrVPANotFound = errors.New("upi address not found")
+	// ErrUPITransactionNotFound is returned when the bank doesn't know a UPI transaction.
+	ErrUPITransactionNotFound = errors.New("upi transaction not found")
+	// ErrUPICurrency is returned for payments in another currency than rupees.
+	ErrUPICurrency = errors.New("upi payments are only made in INR")
+	// ErrUPIPayeeMismatch is returned when the bank reports a payment made to another UPI address than the transaction's.
+	ErrUPIPayeeMismatch = errors.New("upi payment made to another payee")
+)
+
+// UPIAccount is the holder of a UPI address as the bank knows them.
+type UPIAccount struct {
+	VPA  string
+	Name string
+}
+
+// UPICollectRequest asks the payer to approve a payment to the payee in their UPI app.
+type UPICollectRequest struct {
+	TxnRef    string
+	PayerVPA  string
+	PayeeVPA  string
+	PayeeName string
+	MID       string
+	Amount    float64
+	Note      string
+	ExpiresAt time.Time
+}
+
+// UPIBankTransaction is a UPI transaction as the bank reports it.
+type UPIBankTransaction struct {
+	TxnRef        string                      `json:"txnRef"`
+	BankTxnID     string                      `json:"bankTxnID"`
+	RRN           string                      `json:"rrn"`
+	PayerVPA      string                      `json:"payerVPA"`
+	PayeeVPA      string                      `json:"payeeVPA"`
+	Amount        float64                     `json:"amount"`
+	Status        models.UPITransactionStatus `json:"status"`
+	FailureReason string                      `json:"failureReason"`
+}
+
+// UPIBank is the bank, or payment service provider, UPI payments are collected through.
+type UPIBank interface {
+	// Name is the name of the bank UPI transactions are recorded with.
+	Name() string
+	// ValidateVPA gives the holder of a UPI address, ErrVPANotFound when there is none.
+	ValidateVPA(vpa string) (*UPIAccount, error)
+	// Collect sends a collect request to the payer's UPI app. Sending the same transaction again doesn't send another.
+	Collect(request UPICollectRequest) (*UPIBankTransaction, error)
+	// TransactionStatus gives the status of a collect or intent payment, ErrUPITransactionNotFound until the bank knows it.
+	TransactionStatus(txnRef string) (*UPIBankTransaction, error)
+	// Refund refunds part or all of a UPI payment to the payer, refunds with the same id are made once.
+	Refund(refundID string, bankTxnID string, amount float64, reason string) (string, error)
+	// VerifyCallback checks a callback was sent by the bank.
+	VerifyCallback(header http.Header, body []byte) error
+	// ParseCallback reads the transaction in a verified callback.
+	ParseCallback(body []byte) (*UPIBankTransaction, error)
+}
+
+var (
+	upiMu             sync.RWMutex
+	upiBank           UPIBank
+	upiDefaultAccount models.UPIMerchantAccount
+)
+
+// RegisterUPIBank makes UPI payments go through the bank. Payments for jobs, and for orders of stores
+// without a UPI address of their own, are collected to the default account.
+func RegisterUPIBank(bank UPIBank, defaultAccount models.UPIMerchantAccount) {
+	defaultAccount.VPA = upi.NormalizeVPA(defaultAccount.VPA)
+	upiMu.Lock()
+	upiBank = bank
+	upiDefaultAccount = defaultAccount
+	upiMu.Unlock()
+	models.RegisterPaymentRefunder(UPIGatewayName, upiRefunder{})
+}
+
+// getUPIBank gives the bank UPI payments go through.
+func getUPIBank() (UPIBank, error) {
+	upiMu.RLock()
+	defer upiMu.RUnlock()
+	if upiBank == nil {
+		return nil, ErrUPINotConfigured
+	}
+	return upiBank, nil
+}
+
+// upiPayee gives the account a payment is collected to: the store's for orders of a single store that has one, else the default.
+// A payment collected to the store's own account is the store's money: it is kept as a payment transfer to the store,
+// which settlements take off what the store is owed, and refunds of it through the bank come out of the store's account.
+func upiPayee(request PaymentRequest) (models.UPIMerchantAccount, error) {
+	if request.OrderID != "" {
+		order, err := models.GetOrderByID(request.OrderID)
+		if err != nil {
+			return models.UPIMerchantAccount{}, err
+		}
+		if order != nil && !order.StoreID.IsZero() && len(order.ChildOrders) == 0 {
+			account, err := models.GetStoreUPIMerchantAccount(order.StoreID)
+			if err != nil {
+				return models.UPIMerchantAccount{}, err
+			}
+			if account != nil && account.IsActive {
+				return *account, nil
+			}
+		}
+	}
+	upiMu.RLock()
+	defer upiMu.RUnlock()
+	if upiDefaultAccount.VPA == "" {
+		return models.UPIMerchantAccount{}, ErrUPINotConfigured
+	}
+	return upiDefaultAccount, nil
+}
+
+// newUPITransaction records a UPI payment of the request waiting for the payer.
+func newUPITransaction(bank UPIBank, request PaymentRequest, mode models.UPITransactionMode, payerVPA string) (*models.UPITransaction, error) {
+	if request.Currency != "" && strings.ToUpper(request.Currency) != upi.Currency {
+		return nil, ErrUPICurrency
+	}
+	payee, err := upiPayee(request)
+	if err != nil {
+		return nil, err
+	}
+	txn := models.UPITransaction{
+		TxnRef:    models.NewUPITransactionRef(),
+		Bank:      bank.Name(),
+		Mode:      mode,
+		PayerVPA:  payerVPA,
+		PayeeVPA:  payee.VPA,
+		PayeeName: payee.Name,
+		MID:       payee.MID,
+		Amount:    request.Amount,
+		ExpiresAt: time.Now().Add(upiPaymentTimeout),
+	}
+	if !payee.StoreID.IsZero() {
+		storeID := payee.StoreID
+		txn.StoreID = &storeID
+	}
+	if request.OrderID != "" {
+		id, err := primitive.ObjectIDFromHex(request.OrderID)
+		if err != nil {
+			return nil, err
+		}
+		txn.OrderID = &id
+	}
+	if request.JobID != "" {
+		id, err := primitive.ObjectIDFromHex(request.JobID)
+		if err != nil {
+			return nil, err
+		}
+		txn.JobID = &id
+	}
+	if mode == models.UPITransactionModeIntent {
+		txn.IntentURL = upi.Intent{
+			PayeeVPA:  payee.VPA,
+			PayeeName: payee.Name,
+			MCC:       payee.MCC,
+			TxnRef:    txn.TxnRef,
+			Note:      upiNote(request),
+			Amount:    request.Amount,
+		}.URL()
+	}
+	return models.CreateUPITransaction(txn)
+}
+
+// upiNote gives the note UPI apps show the payer.
+func upiNote(request PaymentRequest) string {
+	if request.Description != "" {
+		return request.Description
+	}
+	if request.OrderID != "" {
+		return "Order " + request.OrderID
+	}
+	return "Booking " + request.JobID
+}
+
+// ValidateUPIAddress checks a UPI address is well formed and known to the bank.
+func ValidateUPIAddress(vpa string) (*models.UPIAddressValidation, error) {
+	vpa = upi.NormalizeVPA(vpa)
+	validation := &models.UPIAddressValidation{Vpa: vpa}
+	if !upi.ValidVPA(vpa) {
+		return validation, nil
+	}
+	bank, err := getUPIBank()
+	if err != nil {
+		return nil, err
+	}
+	account, err := bank.ValidateVPA(vpa)
+	if err == ErrVPANotFound {
+		return validation, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	validation.Valid = true
+	if account.Name != "" {
+		validation.Name = &account.Name
+	}
+	return validation, nil
+}
+
+// CreateUPICollectRequest sends a collect request for the payment to the payer's UPI address.
+func CreateUPICollectRequest(request PaymentRequest, payerVPA string) (*models.UPITransaction, error) {
+	payerVPA = upi.NormalizeVPA(payerVPA)
+	if !upi.ValidVPA(payerVPA) {
+		return nil, models.ErrInvalidVPA
+	}
+	bank, err := getUPIBank()
+	if err != nil {
+		return nil, err
+	}
+	_, err = bank.ValidateVPA(payerVPA)
+	if err != nil {
+		return nil, err
+	}
+	txn, err := newUPITransaction(bank, request, models.UPITransactionModeCollect, payerVPA)
+	if err != nil {
+		return nil, err
+	}
+	bankTxn, err := bank.Collect(UPICollectRequest{
+		TxnRef:    txn.TxnRef,
+		PayerVPA:  payerVPA,
+		PayeeVPA:  txn.PayeeVPA,
+		PayeeName: txn.PayeeName,
+		MID:       txn.MID,
+		Amount:    txn.Amount,
+		Note:      upiNote(request),
+		ExpiresAt: txn.ExpiresAt,
+	})
+	if err != nil {
+		_, _, completeErr := models.CompleteUPITransaction(txn, models.UPITransaction{Status: models.UPITransactionStatusFailed, FailureReason: err.Error()})
+		if completeErr != nil {
+			log.Errorln(completeErr)
+		}
+		return nil, err
+	}
+	if bankTxn.Status != models.UPITransactionStatusPending {
+		return completeUPITransaction(txn, bankTxn)
+	}
+	if bankTxn.BankTxnID != "" {
+		return models.SetUPITransactionBankTxnID(txn, bankTxn.BankTxnID)
+	}
+	return txn, nil
+}
+
+// CreateUPIIntent records a payment the payer makes from their UPI app with the transaction's intent link.
+func CreateUPIIntent(request PaymentRequest) (*models.UPITransaction, error) {
+	bank, err := getUPIBank()
+	if err != nil {
+		return nil, err
+	}
+	return newUPITransaction(bank, request, models.UPITransactionModeIntent, "")
+}
+
+// PollUPITransaction asks the bank for the status of a pending UPI transaction and records it once it is known.
+// Transactions the payer didn't pay in time are expired, and the bank's success or failure of an expired
+// transaction is still recorded, the payer may have paid after we stopped waiting.
+func PollUPITransaction(txn *models.UPITransaction) (*models.UPITransaction, error) {
+	if txn.Status != models.UPITransactionStatusPending && txn.Status != models.UPITransactionStatusExpired {
+		return txn, nil
+	}
+	bank, err := getUPIBank()
+	if err != nil {
+		return nil, err
+	}
+	bankTxn, err := bank.TransactionStatus(txn.TxnRef)
+	if err != nil && err != ErrUPITransactionNotFound {
+		return nil, err
+	}
+	if err == nil && bankTxn.Status != models.UPITransactionStatusPending {
+		return completeUPITransaction(txn, bankTxn)
+	}
+	if txn.Status == models.UPITransactionStatusPending && time.Now().After(txn.ExpiresAt) {
+		return completeUPITransaction(txn, &UPIBankTransaction{TxnRef: txn.TxnRef, Status: models.UPITransactionStatusExpired, FailureReason: "not paid in time"})
+	}
+	return txn, nil
+}
+
+// upiCompletion gives how a UPI transaction ended as the bank reports it. A payment the bank reports made to
+// another UPI address than the transaction's is refused. A payment of less than was asked for is failed,
+// keeping what was paid so it is refunded.
+func upiCompletion(txn *models.UPITransaction, bankTxn *UPIBankTransaction) (models.UPITransaction, error) {
+	completed := models.UPITransaction{
+		Status:        bankTxn.Status,
+		BankTxnID:     bankTxn.BankTxnID,
+		RRN:           bankTxn.RRN,
+		PayerVPA:      bankTxn.PayerVPA,
+		FailureReason: bankTxn.FailureReason,
+	}
+	if completed.Status != models.UPITransactionStatusSuccess {
+		return completed, nil
+	}
+	if upi.NormalizeVPA(bankTxn.PayeeVPA) != txn.PayeeVPA {
+		return completed, ErrUPIPayeeMismatch
+	}
+	if math.Round(bankTxn.Amount*100) < math.Round(txn.Amount*100) {
+		completed.Status = models.UPITransactionStatusFailed
+		completed.PaidAmount = bankTxn.Amount
+		completed.FailureReason = fmt.Sprintf("paid %.2f of %.2f", bankTxn.Amount, txn.Amount)
+	}
+	return completed, nil
+}
+
+// completeUPITransaction records how a UPI transaction ended against the order or job it was for.
+// Failures are recorded once however often the bank reports them, payments every time the bank does
+// so a payment that failed to be recorded is recorded when the bank retries. A payment of less than
+// was asked for is recorded as failed and refunded to the payer.
+func completeUPITransaction(txn *models.UPITransaction, bankTxn *UPIBankTransaction) (*models.UPITransaction, error) {
+	completed, err := upiCompletion(txn, bankTxn)
+	if err != nil {
+		log.Errorf("UPI transaction %s was reported paid to %s instead of %s\n", txn.TxnRef, bankTxn.PayeeVPA, txn.PayeeVPA)
+		return nil, err
+	}
+	updated, changed, err := models.CompleteUPITransaction(txn, completed)
+	if err != nil || (!changed && updated.Status != models.UPITransactionStatusSuccess) {
+		return updated, err
+	}
+	update := models.GatewayPaymentUpdate{
+		Gateway:   UPIGatewayName,
+		PaymentID: updated.BankTxnID,
+		Amount:    updated.Amount,
+		Currency:  updated.Currency,
+		Reason:    updated.FailureReason,
+	}
+	if update.PaymentID == "" {
+		update.PaymentID = updated.TxnRef
+	}
+	if updated.OrderID != nil {
+		update.OrderID = updated.OrderID.Hex()
+	}
+	if updated.JobID != nil {
+		update.JobID = updated.JobID.Hex()
+	}
+	if updated.PaidAmount > 0 {
+		updated, update.Reason = refundUPIUnderpayment(updated)
+	}
+	switch updated.Status {
+	case models.UPITransactionStatusSuccess:
+		err = models.RecordGatewayPaymentSucceeded(update)
+		if err == nil && updated.StoreID != nil && updated.OrderID != nil {
+			err = recordUPIStorePayment(updated, update.PaymentID)
+		}
+	case models.UPITransactionStatusFailed, models.UPITransactionStatusExpired:
+		//the failure of a transaction we expired was recorded when it expired
+		if txn.Status != models.UPITransactionStatusExpired {
+			err = models.RecordGatewayPaymentFailed(update)
+		}
+	}
+	return updated, err
+}
+
+// refundUPIUnderpayment refunds a payment of less than was asked for to the payer, and gives the reason the payment
+// is recorded as failed with. A refund that fails is left for the admins, who are told by the reason.
+func refundUPIUnderpayment(txn *models.UPITransaction) (*models.UPITransaction, string) {
+	reason := fmt.Sprintf("Paid %.2f of %.2f", txn.PaidAmount, txn.Amount)
+	bank, err := getUPIBank()
+	if err == nil && txn.BankTxnID != "" {
+		var refundID string
+		refundID, err = bank.Refund("underpaid:"+txn.TxnRef, txn.BankTxnID, txn.PaidAmount, "paid less than the amount asked")
+		if err == nil {
+			refunded, err := models.SetUPITransactionRefund(txn, refundID)
+			if err != nil {
+				log.Errorln(err)
+				return txn, reason + ", refunded to the payer."
+			}
+			return refunded, reason + ", refunded to the payer."
+		}
+	}
+	log.Errorf("UPI transaction %s paid %.2f of %.2f and couldn't be refunded: %v\n", txn.TxnRef, txn.PaidAmount, txn.Amount, err)
+	return txn, reason + ", it needs refunding to the payer."
+}
+
+// recordUPIStorePayment keeps a payment collected to a store's own UPI address as a payment transfer to the store.
+func recordUPIStorePayment(txn *models.UPITransaction, paymentID string) error {
+	split := models.PaymentSplit{
+		PayeeType: models.SettlementPayeeStore,
+		PayeeID:   *txn.StoreID,
+		OrderID:   *txn.OrderID,
+		AccountID: txn.PayeeVPA,
+		Amount:    txn.Amount,
+		Currency:  txn.Currency,
+	}
+	return models.RecordPaymentTransfer(split, models.PaymentTransfer{
+		ID:        paymentID,
+		Gateway:   UPIGatewayName,
+		PaymentID: paymentID,
+		AccountID: txn.PayeeVPA,
+		Amount:    txn.Amount,
+		Currency:  txn.Currency,
+		Direct:    true,
+	})
+}
+
+// RunUPIStatusPolling polls the bank for the status of pending UPI transactions every interval, for payments
+// whose callback didn't come, and of the ones expired within a day for payments made late. It runs until the process exits.
+func RunUPIStatusPolling(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, err := getUPIBank(); err != nil {
+			continue
+		}
+		txns, err := models.GetPendingUPITransactions(time.Now().Add(-interval), 100)
+		if err != nil {
+			continue
+		}
+		expired, err := models.GetExpiredUPITransactions(time.Now().Add(-upiLatePaymentWindow), 100)
+		if err != nil {
+			continue
+		}
+		for _, txn := range append(txns, expired...) {
+			_, err = PollUPITransaction(txn)
+			if err != nil {
+				log.Errorf("Error polling UPI transaction %s: %v\n", txn.TxnRef, err)
+			}
+		}
+	}
+}
+
+// upiRefunder refunds order payments collected through UPI.
+type upiRefunder struct{}
+
+// RefundPayment refunds the order's UPI payment to the payer.
+func (upiRefunder) RefundPayment(refund models.GatewayRefund) (string, error) {
+	bank, err := getUPIBank()
+	if err != nil {
+		return "", err
+	}
+	return bank.Refund(refund.RefundID, refund.PaymentID, refund.Amount, refund.Reason)
+}
+
+// UPICallbackHandler handles the status callbacks of the bank UPI payments go through.
+func UPICallbackHandler(ctx echo.Context) error {
+	bank, err := getUPIBank()
+	if err != nil {
+		return ctx.NoContent(http.StatusNotFound)
+	}
+	body, err := ioutil.ReadAll(ctx.Request().Body)
+	if err != nil {
+		log.Error(err)
+		return ctx.NoContent(http.StatusBadRequest)
+	}
+	err = bank.VerifyCallback(ctx.Request().Header, body)
+	if err != nil {
+		log.Errorf("Error verifying UPI callback: %v\n", err)
+		return ctx.NoContent(http.StatusBadRequest)
+	}
+	bankTxn, err := bank.ParseCallback(body)
+	if err != nil {
+		log.Errorf("Error parsing UPI callback: %v\n", err)
+		return ctx.NoContent(http.StatusBadRequest)
+	}
+	txn, err := models.GetUPITransactionByRef(bankTxn.TxnRef)
+	if err != nil {
+		return ctx.NoContent(http.StatusInternalServerError)
+	}
+	if txn == nil || bankTxn.Status == models.UPITransactionStatusPending {
+		return ctx.JSON(http.StatusOK, "")
+	}
+	_, err = completeUPITransaction(txn, bankTxn)
+	if err == ErrUPIPayeeMismatch {
+		return ctx.NoContent(http.StatusBadRequest)
+	}
+	if err != nil {
+		log.Errorf("Error recording UPI transaction %s: %v\n", txn.TxnRef, err)
+		return ctx.NoContent(http.StatusInternalServerError)
+	}
+	return ctx.JSON(http.StatusOK, "")
+}
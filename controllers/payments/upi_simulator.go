@@ -0,0 +1,280 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/tribehq/platform/lib/payments/upi"
+	"github.com/tribehq/platform/models"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// UPISimulatorName is the name of the simulated bank UPI transactions are recorded with.
+const UPISimulatorName = "simulator"
+
+// UPISimulatorSignatureHeader is the header the simulated bank signs its callbacks in.
+const UPISimulatorSignatureHeader = "X-UPI-Simulator-Signature"
+
+// UPI addresses the simulated bank treats specially, every other well formed address exists.
+const (
+	UPISimulatorVPAUnknown  = "unknown@sim"
+	UPISimulatorVPADeclined = "declined@sim"
+)
+
+// ErrUPIRefundExceedsPayment is returned when a refund is for more than is left of a UPI payment.
+var ErrUPIRefundExceedsPayment = errors.New("refund exceeds the upi payment")
+
+// UPISimulator is an in-memory bank for tests and offline development. It is deterministic: ids are numbered
+// in the order things happen, and every change to a transaction queues the callback the bank would send,
+// signed with the simulator's secret. Collect requests wait for Approve or Decline, and intents for Pay.
+type UPISimulator struct {
+	Secret string
+	// AutoApprove approves collect requests the first time their status is asked for, for local development.
+	AutoApprove bool
+
+	mu           sync.Mutex
+	seq          int
+	names        map[string]string // account holder by UPI address
+	transactions map[string]*UPIBankTransaction
+	refunded     map[string]float64 // by bank transaction id
+	refunds      map[string]string  // bank refund id by our refund id
+	callbacks    []*UPIBankTransaction
+}
+
+// NewUPISimulator gives a simulated bank signing its callbacks with the secret.
+func NewUPISimulator(secret string) *UPISimulator {
+	return &UPISimulator{
+		Secret:       secret,
+		names:        map[string]string{},
+		transactions: map[string]*UPIBankTransaction{},
+		refunded:     map[string]float64{},
+		refunds:      map[string]string{},
+	}
+}
+
+// Name is the name of the simulated bank.
+func (s *UPISimulator) Name() string {
+	return UPISimulatorName
+}
+
+// nextID gives the next id with the prefix, the caller holds the lock.
+func (s *UPISimulator) nextID(prefix string) string {
+	s.seq++
+	return fmt.Sprintf("sim_%s_%d", prefix, s.seq)
+}
+
+// complete ends a pending transaction and queues its callback, the caller holds the lock.
+func (s *UPISimulator) complete(txn *UPIBankTransaction, status models.UPITransactionStatus, reason string) *UPIBankTransaction {
+	txn.Status = status
+	txn.FailureReason = reason
+	if status == models.UPITransactionStatusSuccess {
+		s.seq++
+		txn.RRN = fmt.Sprintf("%012d", s.seq)
+	}
+	callback := *txn
+	s.callbacks = append(s.callbacks, &callback)
+	result := *txn
+	return &result
+}
+
+// AddAccount names the holder of a UPI address.
+func (s *UPISimulator) AddAccount(vpa string, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.names[upi.NormalizeVPA(vpa)] = name
+}
+
+// ValidateVPA gives the holder of a well formed UPI address, named after its handle unless added.
+func (s *UPISimulator) ValidateVPA(vpa string) (*UPIAccount, error) {
+	vpa = upi.NormalizeVPA(vpa)
+	if !upi.ValidVPA(vpa) || vpa == UPISimulatorVPAUnknown {
+		return nil, ErrVPANotFound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	name, ok := s.names[vpa]
+	if !ok {
+		name = strings.Title(strings.Replace(vpa[:strings.Index(vpa, "@")], ".", " ", -1))
+	}
+	return &UPIAccount{VPA: vpa, Name: name}, nil
+}
+
+// Collect sends a collect request, which the payer at UPISimulatorVPADeclined declines right away.
+func (s *UPISimulator) Collect(request UPICollectRequest) (*UPIBankTransaction, error) {
+	if _, err := s.ValidateVPA(request.PayerVPA); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if txn, ok := s.transactions[request.TxnRef]; ok {
+		result := *txn
+		return &result, nil
+	}
+	txn := &UPIBankTransaction{
+		TxnRef:    request.TxnRef,
+		BankTxnID: s.nextID("txn"),
+		PayerVPA:  upi.NormalizeVPA(request.PayerVPA),
+		PayeeVPA:  upi.NormalizeVPA(request.PayeeVPA),
+		Amount:    request.Amount,
+		Status:    models.UPITransactionStatusPending,
+	}
+	s.transactions[txn.TxnRef] = txn
+	if txn.PayerVPA == UPISimulatorVPADeclined {
+		return s.complete(txn, models.UPITransactionStatusFailed, "declined by the payer"), nil
+	}
+	result := *txn
+	return &result, nil
+}
+
+// TransactionStatus gives the status of a transaction, approving pending collect requests when auto approving.
+func (s *UPISimulator) TransactionStatus(txnRef string) (*UPIBankTransaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	txn, ok := s.transactions[txnRef]
+	if !ok {
+		return nil, ErrUPITransactionNotFound
+	}
+	if s.AutoApprove && txn.Status == models.UPITransactionStatusPending {
+		return s.complete(txn, models.UPITransactionStatusSuccess, ""), nil
+	}
+	result := *txn
+	return &result, nil
+}
+
+// Approve has the payer approve a pending collect request.
+func (s *UPISimulator) Approve(txnRef string) (*UPIBankTransaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	txn, ok := s.transactions[txnRef]
+	if !ok {
+		return nil, ErrUPITransactionNotFound
+	}
+	if txn.Status != models.UPITransactionStatusPending {
+		return nil, ErrInvalidPaymentState
+	}
+	return s.complete(txn, models.UPITransactionStatusSuccess, ""), nil
+}
+
+// Decline has the payer decline a pending collect request.
+func (s *UPISimulator) Decline(txnRef string, reason string) (*UPIBankTransaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	txn, ok := s.transactions[txnRef]
+	if !ok {
+		return nil, ErrUPITransactionNotFound
+	}
+	if txn.Status != models.UPITransactionStatusPending {
+		return nil, ErrInvalidPaymentState
+	}
+	return s.complete(txn, models.UPITransactionStatusFailed, reason), nil
+}
+
+// Pay has the payer pay an intent from their UPI app, the way the app opened with the intent link would.
+func (s *UPISimulator) Pay(txnRef string, payerVPA string, payeeVPA string, amount float64) (*UPIBankTransaction, error) {
+	if _, err := s.ValidateVPA(payerVPA); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.transactions[txnRef]; ok {
+		return nil, ErrInvalidPaymentState
+	}
+	txn := &UPIBankTransaction{
+		TxnRef:    txnRef,
+		BankTxnID: s.nextID("txn"),
+		PayerVPA:  upi.NormalizeVPA(payerVPA),
+		PayeeVPA:  upi.NormalizeVPA(payeeVPA),
+		Amount:    amount,
+	}
+	s.transactions[txnRef] = txn
+	return s.complete(txn, models.UPITransactionStatusSuccess, ""), nil
+}
+
+// Refund refunds part or all of a successful transaction, once for each refund id.
+func (s *UPISimulator) Refund(refundID string, bankTxnID string, amount float64, reason string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id, ok := s.refunds[refundID]; ok {
+		return id, nil
+	}
+	var paid *UPIBankTransaction
+	for _, txn := range s.transactions {
+		if txn.BankTxnID == bankTxnID {
+			paid = txn
+			break
+		}
+	}
+	if paid == nil {
+		return "", ErrUPITransactionNotFound
+	}
+	if paid.Status != models.UPITransactionStatusSuccess {
+		return "", ErrInvalidPaymentState
+	}
+	if math.Round((s.refunded[bankTxnID]+amount)*100) > math.Round(paid.Amount*100) {
+		return "", ErrUPIRefundExceedsPayment
+	}
+	s.refunded[bankTxnID] += amount
+	id := s.nextID("rfnd")
+	s.refunds[refundID] = id
+	return id, nil
+}
+
+// Callbacks gives the callbacks queued so far, in the order they happened.
+func (s *UPISimulator) Callbacks() []*UPIBankTransaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	callbacks := make([]*UPIBankTransaction, len(s.callbacks))
+	copy(callbacks, s.callbacks)
+	return callbacks
+}
+
+// CallbackRequest gives the body and headers the simulated bank would post a callback with.
+func (s *UPISimulator) CallbackRequest(txn *UPIBankTransaction) ([]byte, http.Header, error) {
+	body, err := json.Marshal(txn)
+	if err != nil {
+		return nil, nil, err
+	}
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set(UPISimulatorSignatureHeader, s.sign(body))
+	return body, header, nil
+}
+
+// sign gives the hex HMAC-SHA256 of the body with the simulator's secret.
+func (s *UPISimulator) sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(s.Secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyCallback checks the callback is signed with the simulator's secret.
+func (s *UPISimulator) VerifyCallback(header http.Header, body []byte) error {
+	signature := header.Get(UPISimulatorSignatureHeader)
+	if signature == "" || !hmac.Equal([]byte(signature), []byte(s.sign(body))) {
+		return ErrInvalidWebhookSignature
+	}
+	return nil
+}
+
+// ParseCallback reads a callback of the simulated bank.
+func (s *UPISimulator) ParseCallback(body []byte) (*UPIBankTransaction, error) {
+	txn := &UPIBankTransaction{}
+	err := json.Unmarshal(body, txn)
+	if err != nil {
+		return nil, err
+	}
+	if txn.TxnRef == "" {
+		return nil, ErrUPITransactionNotFound
+	}
+	return txn, nil
+}
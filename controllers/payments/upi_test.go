@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package payments
+
+import (
+	"github.com/stretchr/testify/require"
+	"github.com/tribehq/platform/models"
+	"testing"
+)
+
+func TestUPICompletion(t *testing.T) {
+	txn := &models.UPITransaction{TxnRef: "TRB1", PayeeVPA: "store@bank", Amount: 250}
+
+	completed, err := upiCompletion(txn, &UPIBankTransaction{TxnRef: "TRB1", BankTxnID: "b1", RRN: "r1", PayeeVPA: "Store@Bank", Amount: 250, Status: models.UPITransactionStatusSuccess})
+	require.NoError(t, err)
+	require.Equal(t, models.UPITransactionStatusSuccess, completed.Status)
+	require.Equal(t, "b1", completed.BankTxnID)
+	require.Zero(t, completed.PaidAmount)
+
+	//a payment to another address isn't taken as ours
+	_, err = upiCompletion(txn, &UPIBankTransaction{TxnRef: "TRB1", PayeeVPA: "someone@bank", Amount: 250, Status: models.UPITransactionStatusSuccess})
+	require.Equal(t, ErrUPIPayeeMismatch, err)
+	_, err = upiCompletion(txn, &UPIBankTransaction{TxnRef: "TRB1", Amount: 250, Status: models.UPITransactionStatusSuccess})
+	require.Equal(t, ErrUPIPayeeMismatch, err)
+
+	//a payment of less than was asked for fails and keeps what was paid to be refunded
+	completed, err = upiCompletion(txn, &UPIBankTransaction{TxnRef: "TRB1", PayeeVPA: "store@bank", Amount: 249.99, Status: models.UPITransactionStatusSuccess})
+	require.NoError(t, err)
+	require.Equal(t, models.UPITransactionStatusFailed, completed.Status)
+	require.Equal(t, 249.99, completed.PaidAmount)
+	require.Equal(t, "paid 249.99 of 250.00", completed.FailureReason)
+
+	completed, err = upiCompletion(txn, &UPIBankTransaction{TxnRef: "TRB1", Status: models.UPITransactionStatusFailed, FailureReason: "declined by the payer"})
+	require.NoError(t, err)
+	require.Equal(t, models.UPITransactionStatusFailed, completed.Status)
+	require.Equal(t, "declined by the payer", completed.FailureReason)
+}
+
+func TestUPISimulatorCollectAndRefund(t *testing.T) {
+	bank := NewUPISimulator("secret")
+	_, err := bank.ValidateVPA(UPISimulatorVPAUnknown)
+	require.Equal(t, ErrVPANotFound, err)
+
+	request := UPICollectRequest{TxnRef: "TRB1", PayerVPA: "payer@bank", PayeeVPA: "store@bank", Amount: 100}
+	collected, err := bank.Collect(request)
+	require.NoError(t, err)
+	require.Equal(t, models.UPITransactionStatusPending, collected.Status)
+	again, err := bank.Collect(request)
+	require.NoError(t, err)
+	require.Equal(t, collected.BankTxnID, again.BankTxnID)
+
+	_, err = bank.Refund("r1", collected.BankTxnID, 10, "")
+	require.Equal(t, ErrInvalidPaymentState, err)
+	paid, err := bank.Approve("TRB1")
+	require.NoError(t, err)
+	require.Equal(t, "store@bank", paid.PayeeVPA)
+	require.NotEmpty(t, paid.RRN)
+
+	refundID, err := bank.Refund("r1", paid.BankTxnID, 60, "")
+	require.NoError(t, err)
+	repeated, err := bank.Refund("r1", paid.BankTxnID, 60, "")
+	require.NoError(t, err)
+	require.Equal(t, refundID, repeated)
+	_, err = bank.Refund("r2", paid.BankTxnID, 40.01, "")
+	require.Equal(t, ErrUPIRefundExceedsPayment, err)
+
+	declined, err := bank.Collect(UPICollectRequest{TxnRef: "TRB2", PayerVPA: UPISimulatorVPADeclined, PayeeVPA: "store@bank", Amount: 10})
+	require.NoError(t, err)
+	require.Equal(t, models.UPITransactionStatusFailed, declined.Status)
+}
+
+func TestUPISimulatorCallbacks(t *testing.T) {
+	bank := NewUPISimulator("secret")
+	_, err := bank.Pay("TRB1", "payer@bank", "store@bank", 99)
+	require.NoError(t, err)
+	callbacks := bank.Callbacks()
+	require.Len(t, callbacks, 1)
+
+	body, header, err := bank.CallbackRequest(callbacks[0])
+	require.NoError(t, err)
+	require.NoError(t, bank.VerifyCallback(header, body))
+	require.Equal(t, ErrInvalidWebhookSignature, NewUPISimulator("other").VerifyCallback(header, body))
+	parsed, err := bank.ParseCallback(body)
+	require.NoError(t, err)
+	require.Equal(t, "TRB1", parsed.TxnRef)
+	require.Equal(t, "store@bank", parsed.PayeeVPA)
+	require.Equal(t, 99.0, parsed.Amount)
+}
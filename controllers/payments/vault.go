@@ -0,0 +1,52 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package payments
+
+import (
+	"fmt"
+	"github.com/tribehq/platform/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+)
+
+// SaveCard saves a card the user's browser or app tokenized with a payment gateway's client library, at the default gateway
+// when no name is given. Card details only ever reach the gateway, we get the token. A card the user already saved is given back as a duplicate.
+func SaveCard(userID primitive.ObjectID, gatewayName string, paymentMethodToken string, makeDefault bool) (*models.PaymentMethod, bool, error) {
+	var gateway PaymentGateway
+	var err error
+	if gatewayName != "" {
+		gateway, err = GetGateway(gatewayName)
+	} else {
+		gateway, err = GatewayFor("")
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	customerID, err := models.GatewayUserCustomerID(gateway.Name(), userID.Hex())
+	if err != nil {
+		return nil, false, err
+	}
+	token, err := gateway.AttachPaymentMethod(AttachRequest{Token: paymentMethodToken, UserID: userID.Hex(), CustomerID: customerID})
+	if err != nil {
+		return nil, false, err
+	}
+	paymentMethod := models.PaymentMethod{
+		Name:                   fmt.Sprintf("%s •••• %s", strings.Title(token.Brand), token.Last4),
+		Type:                   models.PaymentMethodTypeCredit,
+		UserID:                 userID.Hex(),
+		Gateway:                gateway.Name(),
+		GatewayPaymentMethodID: token.Token,
+		GatewayCustomerID:      token.CustomerID,
+		Brand:                  token.Brand,
+		Last4:                  token.Last4,
+		ExpMonth:               token.ExpMonth,
+		ExpYear:                token.ExpYear,
+		Fingerprint:            token.Fingerprint,
+	}
+	if paymentMethod.Expired() {
+		return nil, false, models.ErrPaymentMethodExpired
+	}
+	return models.SavePaymentMethod(paymentMethod, makeDefault)
+}
@@ -0,0 +1,80 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package shop
+
+import (
+	"cloud.google.com/go/storage"
+	"context"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+	cloudstorage "github.com/tribehq/platform/lib/storage"
+	"github.com/tribehq/platform/models"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// downloadTimeout bounds how long a single download may stream from storage.
+const downloadTimeout = 30 * time.Minute
+
+// GetDownload streams the file of a download grant from the storage bucket to the holder of a signed download link, counting the download.
+func GetDownload(ctx echo.Context) error {
+	grantID := ctx.Param("id")
+	err := models.VerifyDownloadURL(grantID, ctx.QueryParam("expires"), ctx.QueryParam("signature"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	}
+	grant, err := models.ConsumeDownloadGrant(grantID, ctx.RealIP(), ctx.Request().UserAgent())
+	if err != nil {
+		switch err {
+		case models.ErrDownloadRevoked, models.ErrDownloadExpired, models.ErrDownloadLimitReached, models.ErrInvalidDownloadURL:
+			return echo.NewHTTPError(http.StatusForbidden, err.Error())
+		}
+		log.Error(err)
+		return ctx.Render(http.StatusInternalServerError, "500", "")
+	}
+
+	//only objects of our own buckets are served, never whatever the grant's file points to
+	object, ok := cloudstorage.DownloadObject(grant.FileURL)
+	if !ok {
+		log.Errorf("download grant %s: file %q is not in the storage buckets", grant.ID.Hex(), grant.FileURL)
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	name := object.ObjectName()
+	readCtx, cancel := context.WithTimeout(ctx.Request().Context(), downloadTimeout)
+	defer cancel()
+	reader, err := object.NewReader(readCtx)
+	if err != nil {
+		if err == storage.ErrObjectNotExist {
+			log.Errorf("download grant %s: file %s is missing", grant.ID.Hex(), name)
+			return echo.NewHTTPError(http.StatusNotFound)
+		}
+		log.Error(err)
+		return ctx.Render(http.StatusInternalServerError, "500", "")
+	}
+	defer reader.Close()
+
+	//name the file after the download, keeping the extension of the stored file
+	fileName := path.Base(name)
+	if grant.Name != "" {
+		fileName = strings.TrimSuffix(grant.Name, path.Ext(fileName)) + path.Ext(fileName)
+	}
+	header := ctx.Response().Header()
+	header.Set(echo.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	header.Set("Cache-Control", "private, no-store")
+	header.Set(echo.HeaderContentLength, strconv.FormatInt(reader.Size(), 10))
+	contentType := reader.ContentType()
+	if contentType == "" {
+		contentType = echo.MIMEOctetStream
+	}
+	header.Set(echo.HeaderContentType, contentType)
+	ctx.Response().WriteHeader(http.StatusOK)
+	_, err = io.Copy(ctx.Response(), reader)
+	return err
+}
@@ -6,13 +6,63 @@ package shop
 
 import (
 	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"net/http"
+	"strconv"
 )
 
+const searchPageSize = 24
+
 func GetSearchPage(ctx echo.Context) error {
-	return ctx.Render(http.StatusOK, "search", "")
+	return renderSearchResults(ctx, ctx.QueryParam("q"))
 }
 
 func GetSearchResultsPage(ctx echo.Context) error {
-	return ctx.Render(http.StatusOK, "search", "")
+	return renderSearchResults(ctx, ctx.FormValue("q"))
+}
+
+// renderSearchResults renders a page of the store's products matching the query along with their facets.
+func renderSearchResults(ctx echo.Context, query string) error {
+	page, err := strconv.Atoi(ctx.FormValue("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	filter := &models.ProductSearchFilter{}
+	if store, ok := ctx.Get("store").(*models.Store); ok && store != nil {
+		filter.StoreID = &store.ID
+	}
+	if category := ctx.FormValue("category"); category != "" {
+		if categoryID, err := primitive.ObjectIDFromHex(category); err == nil {
+			filter.Categories = append(filter.Categories, categoryID)
+		}
+	}
+	if stockStatus := ctx.FormValue("stock_status"); stockStatus != "" {
+		filter.StockStatus = append(filter.StockStatus, stockStatus)
+	}
+	if minPrice, err := strconv.ParseFloat(ctx.FormValue("min_price"), 64); err == nil {
+		filter.MinPrice = &minPrice
+	}
+	if maxPrice, err := strconv.ParseFloat(ctx.FormValue("max_price"), 64); err == nil {
+		filter.MaxPrice = &maxPrice
+	}
+	results, err := models.SearchProducts(query, filter, (page-1)*searchPageSize, searchPageSize)
+	if err != nil {
+		log.Error(err)
+		return ctx.Render(http.StatusInternalServerError, "500", "")
+	}
+	products := make([]*models.Product, 0, len(results.Hits))
+	for _, hit := range results.Hits {
+		products = append(products, hit.Product)
+	}
+	return ctx.Render(http.StatusOK, "search", echo.Map{"search": map[string]interface{}{
+		"query":          query,
+		"correctedQuery": results.CorrectedQuery,
+		"products":       products,
+		"totalCount":     results.TotalCount,
+		"facets":         results.Facets,
+		"page":           page,
+		"hasNext":        page*searchPageSize < results.TotalCount,
+	}})
 }
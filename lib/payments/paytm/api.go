@@ -6,31 +6,55 @@ package paytm
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/models"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Paytm represents payment.
 type Paytm struct {
-	MerchantMID             string
-	MerchantKey             string
-	MerchantWebsite         string
-	TransactionStatusAPIURL string //https://securegw.paytm.in/order/status
-	SendOTPAPIURL           string //https://accounts.paytm.com/signin/otp
+	MerchantMID               string
+	MerchantKey               string
+	MerchantWebsite           string
+	IndustryType              string //Retail
+	ChannelID                 string //WAP
+	ClientID                  string // oauth client wallets are linked with
+	ClientSecret              string
+	CallbackURL               string // where paytm posts the result of payments made in the customer's browser
+	TransactionStatusAPIURL   string //https://securegw.paytm.in/order/status
+	SendOTPAPIURL             string //https://accounts.paytm.com/signin/otp
+	ValidateOTPAPIURL         string //https://accounts.paytm.com/signin/validate/otp
+	UserDetailsAPIURL         string //https://accounts.paytm.com/user/details
+	RevokeAccessAPIURL        string //https://accounts.paytm.com/oauth2/accessToken/revoke
+	CheckBalanceAPIURL        string //https://securegw.paytm.in/paymentservices/pay/consult
+	WithdrawAPIURL            string //https://securegw.paytm.in/paymentservices/HANDLER_FF/withdrawScw
+	InitiateTransactionAPIURL string //https://securegw.paytm.in/theia/api/v1/initiateTransaction
+	ProcessTransactionURL     string //https://securegw.paytm.in/order/process
+	RefundAPIURL              string //https://securegw.paytm.in/refund/HANDLER_INTERNAL/REFUND
 }
 
+// Statuses of a paytm transaction.
 const (
-//https://securegw-stage.paytm.in/theia/api/v1/initiateTransaction?mid=<mid>&orderId=<orderId>
-//https://securegw.paytm.in/theia/api/v1/initiateTransaction?mid=<mid>&orderId=<orderId>
+	TxnStatusSuccess = "TXN_SUCCESS"
+	TxnStatusFailure = "TXN_FAILURE"
+	TxnStatusPending = "PENDING"
 )
 
-var errorCodes = map[string]string{
-	"k": "",
-	"":  "",
-}
+var (
+	// ErrInvalidOTP is returned when paytm doesn't accept the otp a wallet is linked with.
+	ErrInvalidOTP = errors.New("paytm: invalid otp")
+	// ErrInvalidToken is returned when the access token of a linked wallet has expired or was revoked.
+	ErrInvalidToken = errors.New("paytm: invalid or expired token")
+)
 
 // SendOTPRequest represents send otp request.
 type SendOTPRequest struct {
@@ -103,9 +127,50 @@ type InitiateTransactionResponse struct {
 	} `json:"body"`
 }
 
-// InitiatePayment initiates payment.
-func (p *Paytm) InitiatePayment() {
-
+//InitiatePayment starts a transaction the customer completes in paytm's checkout ... https://developer.paytm.com/docs/initiate-transaction-api/
+func (p *Paytm) InitiatePayment(orderID string, custID string, amount float64, currency string) (InitiateTransactionResponse, error) {
+	var txnResp InitiateTransactionResponse
+	if currency == "" {
+		currency = "INR"
+	}
+	var txnReq InitiateTransactionRequest
+	txnReq.Body.RequestType = "Payment"
+	txnReq.Body.Mid = p.MerchantMID
+	txnReq.Body.WebsiteName = p.MerchantWebsite
+	txnReq.Body.OrderID = orderID
+	txnReq.Body.TxnAmount.Value = FormatAmount(amount)
+	txnReq.Body.TxnAmount.Currency = currency
+	txnReq.Body.UserInfo.CustID = custID
+	txnReq.Body.CallbackURL = p.CallbackURL
+	body, err := json.Marshal(txnReq.Body)
+	if err != nil {
+		return txnResp, err
+	}
+	signature, err := GetChecksumFromString(string(body))
+	if err != nil {
+		return txnResp, err
+	}
+	txnReq.Head.ChannelID = "WEB"
+	txnReq.Head.Version = "v1"
+	txnReq.Head.RequestTimestamp = int(time.Now().Unix())
+	txnReq.Head.Signature = signature
+	reqBody, err := json.Marshal(txnReq)
+	if err != nil {
+		return txnResp, err
+	}
+	headers := map[string]string{"Content-Type": "application/json"}
+	query := url.Values{"mid": {p.MerchantMID}, "orderId": {orderID}}
+	resp, err := p.call(p.InitiateTransactionAPIURL+"?"+query.Encode(), "POST", reqBody, nil, headers)
+	if err != nil {
+		return txnResp, err
+	}
+	if err = json.Unmarshal(resp, &txnResp); err != nil {
+		return txnResp, err
+	}
+	if txnResp.Body.ResultInfo.ResultStatus != "S" {
+		return txnResp, errors.New("paytm: " + txnResp.Body.ResultInfo.ResultMsg)
+	}
+	return txnResp, nil
 }
 
 //SendOTP sends otp ... https://developer.paytm.com/docs/send-otp-api/
@@ -137,26 +202,35 @@ func (p *Paytm) SendOTP(mobileNo string, clientID string) (bool, SendOTPResponse
 
 // VerifyOTPResponse verifies otp response.
 type VerifyOTPResponse struct {
+	AccessToken     string      `json:"access_token"`
+	Expires         json.Number `json:"expires"` // unix time in milliseconds
+	Scope           string      `json:"scope"`
+	ResourceOwnerID string      `json:"resourceOwnerId"`
+	Status          string      `json:"status"`
+	Message         string      `json:"message"`
+	ResponseCode    string      `json:"responseCode"`
 }
 
 // VerifyOTPRequest verifies otp request.
 type VerifyOTPRequest struct {
+	OTP   string `json:"otp"`
+	State string `json:"state"`
 }
 
 // VerifyOTP verifies otp ... https://developer.paytm.com/docs/validate-otp-api/
 func (p *Paytm) VerifyOTP(otp string, state string) (VerifyOTPResponse, error) {
-	headers := make(map[string]string)
+	headers := p.oauthHeaders()
 	headers["Content-Type"] = "application/json"
 	headers["Cache-Control"] = "no-cache"
 	var otpResp VerifyOTPResponse
 
-	verifyOtp := &VerifyOTPRequest{}
+	verifyOtp := &VerifyOTPRequest{OTP: otp, State: state}
 	verifyOtpReq, err := json.Marshal(verifyOtp)
 	if err != nil {
 		return otpResp, err
 	}
 
-	resp, err := p.call(p.SendOTPAPIURL, "POST", verifyOtpReq, nil, headers)
+	resp, err := p.call(p.ValidateOTPAPIURL, "POST", verifyOtpReq, nil, headers)
 	if err != nil {
 		return otpResp, err
 	}
@@ -164,28 +238,264 @@ func (p *Paytm) VerifyOTP(otp string, state string) (VerifyOTPResponse, error) {
 	if err = json.Unmarshal(resp, &otpResp); err != nil {
 		return otpResp, err
 	}
-
+	if otpResp.AccessToken == "" {
+		return otpResp, ErrInvalidOTP
+	}
 	return otpResp, nil
 }
 
-// RevokeAccess ceases access.
-func (p *Paytm) RevokeAccess() {
+// TokenDetails represents the paytm user an access token belongs to.
+type TokenDetails struct {
+	ID      string      `json:"id"`
+	Email   string      `json:"email"`
+	Mobile  string      `json:"mobile"`
+	Expires json.Number `json:"expires"` // unix time in milliseconds
+	Status  string      `json:"status"`
+	Message string      `json:"message"`
+}
+
+// RevokeAccess revokes the access token of a linked wallet ... https://developer.paytm.com/docs/revoke-access-api/
+func (p *Paytm) RevokeAccess(token string) error {
+	headers := p.oauthHeaders()
+	headers["session_token"] = token
+	resp, err := p.call(p.RevokeAccessAPIURL, "DELETE", nil, nil, headers)
+	if err != nil {
+		return err
+	}
+	var revokeResp struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}
+	if len(resp) > 0 {
+		if err = json.Unmarshal(resp, &revokeResp); err != nil {
+			return err
+		}
+	}
+	if revokeResp.Status != "" && revokeResp.Status != "SUCCESS" {
+		return errors.New("paytm: " + revokeResp.Message)
+	}
+	return nil
+}
+
+// ValidateToken gives the paytm user of an access token ... https://developer.paytm.com/docs/validate-token-api/
+func (p *Paytm) ValidateToken(token string) (TokenDetails, error) {
+	headers := p.oauthHeaders()
+	headers["session_token"] = token
+	var details TokenDetails
+	resp, err := p.call(p.UserDetailsAPIURL, "GET", nil, nil, headers)
+	if err != nil {
+		return details, err
+	}
+	if err = json.Unmarshal(resp, &details); err != nil {
+		return details, err
+	}
+	if details.ID == "" {
+		return details, ErrInvalidToken
+	}
+	return details, nil
+}
+
+// AddMoneyForm is the form the customer's browser posts to paytm to add money to their wallet.
+type AddMoneyForm struct {
+	URL    string
+	Params map[string]string
+}
+
+// AddMoney gives the form that takes the customer to paytm to add money to their linked wallet,
+// paytm posts the result to the callback url ... https://developer.paytm.com/docs/add-money-api/
+func (p *Paytm) AddMoney(token string, orderID string, custID string, amount float64) (AddMoneyForm, error) {
+	params := map[string]string{
+		"REQUEST_TYPE":     "ADD_MONEY",
+		"MID":              p.MerchantMID,
+		"ORDER_ID":         orderID,
+		"CUST_ID":          custID,
+		"TXN_AMOUNT":       FormatAmount(amount),
+		"CHANNEL_ID":       p.ChannelID,
+		"INDUSTRY_TYPE_ID": p.IndustryType,
+		"WEBSITE":          p.MerchantWebsite,
+		"SSO_TOKEN":        token,
+		"CALLBACK_URL":     p.CallbackURL,
+	}
+	checksum, err := GetChecksumFromArray(params)
+	if err != nil {
+		return AddMoneyForm{}, err
+	}
+	params["CHECKSUMHASH"] = checksum
+	return AddMoneyForm{URL: p.ProcessTransactionURL, Params: params}, nil
+}
+
+// CheckBalanceResponse represents check balance response.
+type CheckBalanceResponse struct {
+	Head struct {
+		ResponseTimestamp string `json:"responseTimestamp"`
+		Version           string `json:"version"`
+	} `json:"head"`
+	Body struct {
+		ResultInfo struct {
+			ResultStatus string `json:"resultStatus"`
+			ResultCode   string `json:"resultCode"`
+			ResultMsg    string `json:"resultMsg"`
+		} `json:"resultInfo"`
+		FundsSufficient bool   `json:"fundsSufficient"`
+		AddMoneyAllowed bool   `json:"addMoneyAllowed"`
+		DeficitAmount   string `json:"deficitAmount"`
+		PaymentOptions  []struct {
+			PaymentMode string `json:"paymentMode"`
+			Amount      string `json:"amount"`
+		} `json:"paymentOptions"`
+	} `json:"body"`
+}
+
+// WalletBalance gives the balance of the wallet, zero when paytm doesn't tell it.
+func (r CheckBalanceResponse) WalletBalance() float64 {
+	for _, option := range r.Body.PaymentOptions {
+		if option.PaymentMode == "BALANCE" {
+			balance, _ := strconv.ParseFloat(option.Amount, 64)
+			return balance
+		}
+	}
+	return 0
+}
 
+// CheckBalance checks whether a linked wallet has the amount ... https://developer.paytm.com/docs/check-balance-api/
+func (p *Paytm) CheckBalance(token string, amount float64) (CheckBalanceResponse, error) {
+	var balanceResp CheckBalanceResponse
+	body, err := json.Marshal(map[string]string{
+		"userToken":   token,
+		"totalAmount": FormatAmount(amount),
+		"mid":         p.MerchantMID,
+	})
+	if err != nil {
+		return balanceResp, err
+	}
+	signature, err := GetChecksumFromString(string(body))
+	if err != nil {
+		return balanceResp, err
+	}
+	head, err := json.Marshal(map[string]string{
+		"clientId":         p.ClientID,
+		"version":          "v1",
+		"requestTimestamp": strconv.FormatInt(time.Now().Unix(), 10),
+		"channelId":        "WEB",
+		"signature":        signature,
+	})
+	if err != nil {
+		return balanceResp, err
+	}
+	reqBody := []byte(`{"head":` + string(head) + `,"body":` + string(body) + `}`)
+	headers := map[string]string{"Content-Type": "application/json"}
+	resp, err := p.call(p.CheckBalanceAPIURL, "POST", reqBody, nil, headers)
+	if err != nil {
+		return balanceResp, err
+	}
+	if err = json.Unmarshal(resp, &balanceResp); err != nil {
+		return balanceResp, err
+	}
+	if balanceResp.Body.ResultInfo.ResultStatus != "S" {
+		return balanceResp, errors.New("paytm: " + balanceResp.Body.ResultInfo.ResultMsg)
+	}
+	return balanceResp, nil
+}
+
+// WithdrawResponse represents withdraw response.
+type WithdrawResponse struct {
+	TxnID           string `json:"TxnId"`
+	MID             string `json:"MID"`
+	OrderID         string `json:"OrderId"`
+	TxnAmount       string `json:"TxnAmount"`
+	BankTxnID       string `json:"BankTxnId"`
+	ResponseCode    string `json:"ResponseCode"`
+	ResponseMessage string `json:"ResponseMessage"`
+	Status          string `json:"Status"`
+	PaymentMode     string `json:"PaymentMode"`
+	CustID          string `json:"CustId"`
 }
 
-// ValidateToken validates tokens.
-func (p *Paytm) ValidateToken() {
+//Debit takes the amount from a linked wallet without the customer leaving the app, the device is the customer's mobile ... https://developer.paytm.com/docs/auto-debit-api/
+func (p *Paytm) Debit(token string, orderID string, custID string, mobileNo string, amount float64) (WithdrawResponse, error) {
+	var withdrawResp WithdrawResponse
+	if mobileNo == "" {
+		mobileNo = custID
+	}
+	params := map[string]string{
+		"MID":          p.MerchantMID,
+		"ReqType":      "WITHDRAW",
+		"TxnAmount":    FormatAmount(amount),
+		"AppIP":        "127.0.0.1",
+		"OrderId":      orderID,
+		"Currency":     "INR",
+		"DeviceId":     mobileNo,
+		"SSOToken":     token,
+		"PaymentMode":  "PPI",
+		"CustId":       custID,
+		"IndustryType": p.IndustryType,
+		"Channel":      p.ChannelID,
+		"AuthMode":     "USRPWD",
+	}
+	checksum, err := GetChecksumFromArray(params)
+	if err != nil {
+		return withdrawResp, err
+	}
+	params["CheckSum"] = checksum
+	reqBody, err := json.Marshal(params)
+	if err != nil {
+		return withdrawResp, err
+	}
+	headers := map[string]string{"Content-Type": "application/json"}
+	resp, err := p.call(p.WithdrawAPIURL, "POST", reqBody, nil, headers)
+	if err != nil {
+		return withdrawResp, err
+	}
+	if err = json.Unmarshal(resp, &withdrawResp); err != nil {
+		return withdrawResp, err
+	}
+	if withdrawResp.Status != TxnStatusSuccess && withdrawResp.Status != TxnStatusPending {
+		return withdrawResp, errors.New("paytm: " + withdrawResp.ResponseMessage)
+	}
+	return withdrawResp, nil
+}
 
+// VerifyCallback checks the checksum of the params paytm posts to callbacks and webhooks.
+func VerifyCallback(params map[string]string) bool {
+	checksum := params["CHECKSUMHASH"]
+	if checksum == "" {
+		return false
+	}
+	//VerifyCheckum drops the checksum from the params it is given
+	verify := make(map[string]string, len(params))
+	for key, value := range params {
+		verify[key] = value
+	}
+	return VerifyCheckum(verify, checksum)
 }
 
-// AddMoney adds money.
-func (p *Paytm) AddMoney() {
+// paymentIDSeparator separates the order id from the transaction id in a payment id.
+const paymentIDSeparator = "/"
 
+// PaymentID gives the id a paytm transaction is recorded under, its order id and transaction id, as refunds take both.
+func PaymentID(orderID string, txnID string) string {
+	return orderID + paymentIDSeparator + txnID
 }
 
-// CheckBalance checks balance.
-func (p *Paytm) CheckBalance() {
+// SplitPaymentID gives the order id and transaction id of a recorded paytm payment. Payments recorded by their
+// transaction id only give the order id they fall back to.
+func SplitPaymentID(paymentID string, orderID string) (string, string) {
+	parts := strings.SplitN(paymentID, paymentIDSeparator, 2)
+	if len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return orderID, paymentID
+}
 
+// FormatAmount formats an amount the way paytm takes it.
+func FormatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
+
+// oauthHeaders gives the headers calls for linking wallets are authorized with.
+func (p *Paytm) oauthHeaders() map[string]string {
+	credentials := base64.StdEncoding.EncodeToString([]byte(p.ClientID + ":" + p.ClientSecret))
+	return map[string]string{"Authorization": "Basic " + credentials}
 }
 
 //TransactionStatus returns transaction status ... https://developer.paytm.com/docs/transaction-status-api/
@@ -204,12 +514,69 @@ func (p *Paytm) TransactionStatus(orderID string, checksum string) (bool, Transa
 	if err = json.Unmarshal(resp, &txnStatus); err != nil {
 		return false, txnStatus, err
 	}
-	if txnStatus.Status == "TXN_SUCCESS" {
+	if txnStatus.Status == TxnStatusSuccess {
 		return true, txnStatus, nil
 	}
 	return false, txnStatus, err
 }
 
+// RefundResponse represents refund response.
+type RefundResponse struct {
+	TxnID        string `json:"TXNID"`
+	OrderID      string `json:"ORDERID"`
+	RefID        string `json:"REFID"`
+	RefundID     string `json:"REFUNDID"`
+	RefundAmount string `json:"REFUNDAMOUNT"`
+	Status       string `json:"STATUS"`
+	RespCode     string `json:"RESPCODE"`
+	RespMsg      string `json:"RESPMSG"`
+}
+
+//Refund refunds part or all of a transaction ... https://developer.paytm.com/docs/refund-api/
+func (p *Paytm) Refund(orderID string, txnID string, refID string, amount float64, comments string) (RefundResponse, error) {
+	var refundResp RefundResponse
+	params := map[string]string{
+		"MID":          p.MerchantMID,
+		"ORDERID":      orderID,
+		"TXNID":        txnID,
+		"REFID":        refID,
+		"REFUNDAMOUNT": FormatAmount(amount),
+		"TXNTYPE":      "REFUND",
+		"COMMENTS":     comments,
+	}
+	checksum, err := GetChecksumFromArray(params)
+	if err != nil {
+		return refundResp, err
+	}
+	params["CHECKSUM"] = checksum
+	jsonData, err := json.Marshal(params)
+	if err != nil {
+		return refundResp, err
+	}
+	headers := map[string]string{"Content-Type": "application/json"}
+	resp, err := p.call(p.RefundAPIURL+"?JsonData="+url.QueryEscape(string(jsonData)), "POST", nil, nil, headers)
+	if err != nil {
+		return refundResp, err
+	}
+	if err = json.Unmarshal(resp, &refundResp); err != nil {
+		return refundResp, err
+	}
+	if refundResp.Status != TxnStatusSuccess && refundResp.Status != TxnStatusPending {
+		return refundResp, errors.New("paytm: " + refundResp.RespMsg)
+	}
+	return refundResp, nil
+}
+
+// RefundPayment refunds a paytm transaction, recorded under its paytm order id and transaction id.
+func (p *Paytm) RefundPayment(refund models.GatewayRefund) (string, error) {
+	orderID, txnID := SplitPaymentID(refund.PaymentID, refund.OrderID)
+	refundResp, err := p.Refund(orderID, txnID, refund.RefundID, refund.Amount, refund.Reason)
+	if err != nil {
+		return "", err
+	}
+	return refundResp.RefundID, nil
+}
+
 func (p *Paytm) call(url string, method string, reqbody []byte, queryparams map[string]string, headers map[string]string) ([]byte, error) {
 	req, err := http.NewRequest(method, url, bytes.NewBuffer(reqbody))
 	if err != nil {
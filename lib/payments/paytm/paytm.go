@@ -90,9 +90,13 @@ func GetChecksumFromArray(paramsMap map[string]string) (checksum string, err err
 			arrayList = append(arrayList, value)
 		}
 	}
-	arrayStr := getArray2Str(arrayList)
+	return GetChecksumFromString(getArray2Str(arrayList))
+}
+
+// GetChecksumFromString is function to generate checksum key of a request body, for the json apis
+func GetChecksumFromString(str string) (checksum string, err error) {
 	salt := generateSalt(4)
-	finalString := arrayStr + "|" + salt
+	finalString := str + "|" + salt
 	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(finalString)))
 	hashString := hash + salt
 	crypt, err := Encrypt([]byte(hashString))
@@ -131,6 +135,9 @@ func VerifyCheckum(paramsMap map[string]string, checksum string) (ok bool) {
 		return
 	}
 	paytmHashStr := string(paytmHash)
+	if len(paytmHashStr) < 4 {
+		return
+	}
 	salt := paytmHashStr[len(paytmHashStr)-4:]
 	finalString := arrayStr + "|" + salt
 	h := sha256.New()
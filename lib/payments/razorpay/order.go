@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package razorpay
+
+// Order represents a razorpay order, which the customer pays in razorpay checkout.
+type Order struct {
+	ID         string `json:"id"`
+	Amount     int64  `json:"amount"`
+	AmountPaid int64  `json:"amount_paid"`
+	AmountDue  int64  `json:"amount_due"`
+	Currency   string `json:"currency"`
+	Receipt    string `json:"receipt"`
+	Status     string `json:"status"`
+	Attempts   int    `json:"attempts"`
+	Notes      Notes  `json:"notes"`
+	CreatedAt  int64  `json:"created_at"`
+}
+
+// OrderRequest represents the body of a razorpay order request.
+type OrderRequest struct {
+	Amount         int64  `json:"amount"` // in paise
+	Currency       string `json:"currency"`
+	Receipt        string `json:"receipt"`
+	PaymentCapture int    `json:"payment_capture"` // 1 to capture payments of the order as soon as they are authorized
+	Notes          Notes  `json:"notes"`
+}
+
+// CreateOrder creates a razorpay order for the customer to pay.
+func (r *Razorpay) CreateOrder(req OrderRequest) (*Order, error) {
+	order := &Order{}
+	err := r.call("POST", "/orders", req, order)
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// GetOrder gives a razorpay order.
+func (r *Razorpay) GetOrder(orderID string) (*Order, error) {
+	order := &Order{}
+	err := r.call("GET", "/orders/"+orderID, nil, order)
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
@@ -0,0 +1,73 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package razorpay
+
+import (
+	"math"
+)
+
+// Statuses of a razorpay payment.
+const (
+	PaymentStatusCreated    = "created"
+	PaymentStatusAuthorized = "authorized"
+	PaymentStatusCaptured   = "captured"
+	PaymentStatusRefunded   = "refunded"
+	PaymentStatusFailed     = "failed"
+)
+
+// Payment represents a razorpay payment.
+type Payment struct {
+	ID               string `json:"id"`
+	Amount           int64  `json:"amount"`
+	Currency         string `json:"currency"`
+	Status           string `json:"status"`
+	OrderID          string `json:"order_id"`
+	Method           string `json:"method"`
+	AmountRefunded   int64  `json:"amount_refunded"`
+	RefundStatus     string `json:"refund_status"`
+	Captured         bool   `json:"captured"`
+	Email            string `json:"email"`
+	Contact          string `json:"contact"`
+	Notes            Notes  `json:"notes"`
+	ErrorCode        string `json:"error_code"`
+	ErrorDescription string `json:"error_description"`
+	CreatedAt        int64  `json:"created_at"`
+}
+
+// captureRequest represents the body of a razorpay capture request.
+type captureRequest struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// AmountInPaise converts an amount in rupees, or the major unit of another currency, to paise.
+func AmountInPaise(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// AmountFromPaise converts an amount in paise, or the minor unit of another currency, to rupees.
+func AmountFromPaise(amount int64) float64 {
+	return float64(amount) / 100
+}
+
+// GetPayment gives a razorpay payment.
+func (r *Razorpay) GetPayment(paymentID string) (*Payment, error) {
+	payment := &Payment{}
+	err := r.call("GET", "/payments/"+paymentID, nil, payment)
+	if err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+// CapturePayment captures an authorized razorpay payment, amount is in paise.
+func (r *Razorpay) CapturePayment(paymentID string, amount int64, currency string) (*Payment, error) {
+	payment := &Payment{}
+	err := r.call("POST", "/payments/"+paymentID+"/capture", captureRequest{Amount: amount, Currency: currency}, payment)
+	if err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
@@ -0,0 +1,209 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package razorpay
+
+import (
+	"errors"
+	"github.com/tribehq/platform/models"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Contact represents a razorpayx contact, the person a payout is made to.
+type Contact struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	ReferenceID string `json:"reference_id"`
+}
+
+// FundAccount represents a razorpayx fund account, the bank account of a contact.
+type FundAccount struct {
+	ID          string `json:"id"`
+	ContactID   string `json:"contact_id"`
+	AccountType string `json:"account_type"`
+	BankAccount struct {
+		Name          string `json:"name"`
+		IFSC          string `json:"ifsc"`
+		AccountNumber string `json:"account_number"`
+	} `json:"bank_account"`
+}
+
+// Payout represents a razorpayx payout.
+type Payout struct {
+	ID            string `json:"id"`
+	FundAccountID string `json:"fund_account_id"`
+	Amount        int64  `json:"amount"`
+	Currency      string `json:"currency"`
+	Mode          string `json:"mode"`
+	Purpose       string `json:"purpose"`
+	ReferenceID   string `json:"reference_id"`
+	Narration     string `json:"narration"`
+	Notes         Notes  `json:"notes"`
+	Status        string `json:"status"`
+	FailureReason string `json:"failure_reason"`
+}
+
+// payouts represents a list of razorpayx payouts.
+type payouts struct {
+	Count int       `json:"count"`
+	Items []*Payout `json:"items"`
+}
+
+// Result describes the state of a payout for the withdrawal it was made for.
+// Queued, pending and processing payouts are still pending, and a reversed payout is one the bank sent back.
+func (payout *Payout) Result() *models.PayoutResult {
+	result := &models.PayoutResult{
+		WithdrawalID: payout.ReferenceID,
+		Reference:    payout.ID,
+		Status:       models.PayoutStatusPending,
+		Reason:       payout.FailureReason,
+	}
+	if result.WithdrawalID == "" {
+		result.WithdrawalID = payout.Notes["withdrawal_id"]
+	}
+	switch payout.Status {
+	case "processed":
+		result.Status = models.PayoutStatusPaid
+	case "reversed":
+		result.Status = models.PayoutStatusReversed
+	case "rejected", "cancelled", "failed":
+		result.Status = models.PayoutStatusFailed
+	}
+	return result
+}
+
+// payoutError gives a payout as failed when razorpayx turned down a request for it.
+// Any other error is given back as is, the payout may have been made.
+func payoutError(payout models.GatewayPayout, err error) (*models.PayoutResult, error) {
+	if apiErr, ok := err.(*APIError); ok && apiErr.turnedDown() {
+		return &models.PayoutResult{WithdrawalID: payout.WithdrawalID, Status: models.PayoutStatusFailed, Reason: apiErr.Error()}, nil
+	}
+	return nil, err
+}
+
+// payoutRequest represents the body of a razorpayx payout request.
+type payoutRequest struct {
+	AccountNumber     string `json:"account_number"`
+	FundAccountID     string `json:"fund_account_id"`
+	Amount            int64  `json:"amount"`
+	Currency          string `json:"currency"`
+	Mode              string `json:"mode"`
+	Purpose           string `json:"purpose"`
+	QueueIfLowBalance bool   `json:"queue_if_low_balance"`
+	ReferenceID       string `json:"reference_id"`
+	Narration         string `json:"narration"`
+	Notes             Notes  `json:"notes"`
+}
+
+// Payouts pays withdrawals of providers to their bank accounts through razorpayx.
+type Payouts struct {
+	*Razorpay
+	AccountNumber string // the razorpayx account the payouts are made from
+	Mode          string // IMPS, NEFT or RTGS, IMPS when not set
+}
+
+// NewPayouts gives a razorpayx payout provider paying from the given account.
+func NewPayouts(r *Razorpay, accountNumber string) *Payouts {
+	return &Payouts{Razorpay: r, AccountNumber: accountNumber, Mode: "IMPS"}
+}
+
+// createFundAccount adds the bank account of a payout as a razorpayx contact and fund account.
+// Razorpayx gives back the same contact and fund account when they already exist with the same details.
+func (p *Payouts) createFundAccount(payout models.GatewayPayout) (*FundAccount, error) {
+	contact := &Contact{}
+	err := p.call("POST", "/contacts", map[string]string{
+		"name": payout.AccountHolderName,
+		"type": "vendor",
+	}, contact)
+	if err != nil {
+		return nil, err
+	}
+	fundAccount := &FundAccount{}
+	err = p.call("POST", "/fund_accounts", map[string]interface{}{
+		"contact_id":   contact.ID,
+		"account_type": "bank_account",
+		"bank_account": map[string]string{
+			"name":           payout.AccountHolderName,
+			"ifsc":           payout.IfscCode,
+			"account_number": payout.AccountNumber,
+		},
+	}, fundAccount)
+	if err != nil {
+		return nil, err
+	}
+	return fundAccount, nil
+}
+
+// Payout transfers a withdrawal to the bank account of the provider.
+// The withdrawal id is sent as the idempotency key so a retried payout isn't made twice.
+// Payouts are queued when the account is low on balance, so they are usually still pending when this returns.
+func (p *Payouts) Payout(payout models.GatewayPayout) (*models.PayoutResult, error) {
+	if p.AccountNumber == "" {
+		return nil, errors.New("razorpay: payout account number is not set")
+	}
+	if payout.IfscCode == "" || payout.AccountNumber == "" {
+		return &models.PayoutResult{
+			WithdrawalID: payout.WithdrawalID,
+			Status:       models.PayoutStatusFailed,
+			Reason:       "razorpay: payouts need the account number and ifsc code of the bank account",
+		}, nil
+	}
+	fundAccount, err := p.createFundAccount(payout)
+	if err != nil {
+		return payoutError(payout, err)
+	}
+	mode := p.Mode
+	if mode == "" {
+		mode = "IMPS"
+	}
+	req := payoutRequest{
+		AccountNumber:     p.AccountNumber,
+		FundAccountID:     fundAccount.ID,
+		Amount:            int64(math.Round(payout.Amount * 100)),
+		Currency:          strings.ToUpper(payout.Currency),
+		Mode:              mode,
+		Purpose:           "payout",
+		QueueIfLowBalance: true,
+		ReferenceID:       payout.WithdrawalID,
+		Narration:         "Tribe withdrawal",
+		Notes:             Notes{"withdrawal_id": payout.WithdrawalID},
+	}
+	header := http.Header{}
+	header.Set("X-Payout-Idempotency", payout.WithdrawalID)
+	razorpayPayout := &Payout{}
+	err = p.callWithHeader("POST", "/payouts", header, req, razorpayPayout)
+	if err != nil {
+		return payoutError(payout, err)
+	}
+	return razorpayPayout.Result(), nil
+}
+
+// GetPayout gives the payout made for a withdrawal, by its id when it is known or else by the withdrawal id it was made with,
+// nil when no payout was made for the withdrawal.
+func (p *Payouts) GetPayout(withdrawalID string, reference string) (*models.PayoutResult, error) {
+	if reference != "" {
+		payout := &Payout{}
+		err := p.call("GET", "/payouts/"+url.PathEscape(reference), nil, payout)
+		if err != nil {
+			return nil, err
+		}
+		return payout.Result(), nil
+	}
+	query := url.Values{}
+	query.Set("account_number", p.AccountNumber)
+	query.Set("reference_id", withdrawalID)
+	list := &payouts{}
+	err := p.call("GET", "/payouts?"+query.Encode(), nil, list)
+	if err != nil {
+		return nil, err
+	}
+	if len(list.Items) == 0 {
+		return nil, nil
+	}
+	return list.Items[0].Result(), nil
+}
@@ -0,0 +1,196 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package razorpay
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"github.com/tribehq/platform/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPayoutIsIdempotentByWithdrawal(t *testing.T) {
+	made := map[string]*Payout{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/contacts":
+			_ = json.NewEncoder(w).Encode(Contact{ID: "cont_1"})
+		case "/fund_accounts":
+			body := map[string]interface{}{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			require.Equal(t, "cont_1", body["contact_id"])
+			_ = json.NewEncoder(w).Encode(FundAccount{ID: "fa_1", ContactID: "cont_1"})
+		case "/payouts":
+			key := r.Header.Get("X-Payout-Idempotency")
+			require.NotEmpty(t, key)
+			payout, ok := made[key]
+			if !ok {
+				req := payoutRequest{}
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+				require.Equal(t, "acc_1", req.AccountNumber)
+				require.Equal(t, "fa_1", req.FundAccountID)
+				payout = &Payout{ID: "pout_" + req.ReferenceID, Amount: req.Amount, ReferenceID: req.ReferenceID, Status: "processing"}
+				made[key] = payout
+			}
+			_ = json.NewEncoder(w).Encode(payout)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := New("key", "secret")
+	client.APIURL = server.URL
+	payouts := NewPayouts(client, "acc_1")
+	payout := models.GatewayPayout{WithdrawalID: "w1", Amount: 99.99, Currency: "inr", AccountHolderName: "A", AccountNumber: "123", IfscCode: "IFSC0001"}
+
+	result, err := payouts.Payout(payout)
+	require.NoError(t, err)
+	require.Equal(t, &models.PayoutResult{WithdrawalID: "w1", Reference: "pout_w1", Status: models.PayoutStatusPending}, result)
+	require.Equal(t, int64(9999), made["w1"].Amount)
+
+	//retrying the same withdrawal gives back the payout made the first time
+	result, err = payouts.Payout(payout)
+	require.NoError(t, err)
+	require.Equal(t, "pout_w1", result.Reference)
+	require.Len(t, made, 1)
+}
+
+// payoutServer answers payout requests with the payout, or makes them wait or fail.
+func payoutServer(payout *Payout, status int, wait time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/contacts":
+			_ = json.NewEncoder(w).Encode(Contact{ID: "cont_1"})
+		case "/fund_accounts":
+			_ = json.NewEncoder(w).Encode(FundAccount{ID: "fa_1"})
+		case "/payouts":
+			time.Sleep(wait)
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+				_, _ = w.Write([]byte(`{"error":{"code":"BAD_REQUEST_ERROR","description":"something went wrong"}}`))
+				return
+			}
+			_ = json.NewEncoder(w).Encode(payout)
+		}
+	}))
+}
+
+func TestPayoutResults(t *testing.T) {
+	payout := models.GatewayPayout{WithdrawalID: "w1", Amount: 10, AccountNumber: "123", IfscCode: "IFSC0001"}
+	payoutWith := func(server *httptest.Server, timeout time.Duration) (*models.PayoutResult, error) {
+		client := New("key", "secret")
+		client.APIURL = server.URL
+		client.client.Timeout = timeout
+		return NewPayouts(client, "acc_1").Payout(payout)
+	}
+
+	t.Run("queued payouts are pending", func(t *testing.T) {
+		server := payoutServer(&Payout{ID: "pout_1", ReferenceID: "w1", Status: "queued"}, http.StatusOK, 0)
+		defer server.Close()
+		result, err := payoutWith(server, time.Second)
+		require.NoError(t, err)
+		require.Equal(t, models.PayoutStatusPending, result.Status)
+		require.Equal(t, "pout_1", result.Reference)
+	})
+	t.Run("rejected payouts failed", func(t *testing.T) {
+		server := payoutServer(&Payout{ID: "pout_1", ReferenceID: "w1", Status: "rejected", FailureReason: "invalid account"}, http.StatusOK, 0)
+		defer server.Close()
+		result, err := payoutWith(server, time.Second)
+		require.NoError(t, err)
+		require.Equal(t, &models.PayoutResult{WithdrawalID: "w1", Reference: "pout_1", Status: models.PayoutStatusFailed, Reason: "invalid account"}, result)
+	})
+	t.Run("payout requests turned down failed", func(t *testing.T) {
+		server := payoutServer(nil, http.StatusBadRequest, 0)
+		defer server.Close()
+		result, err := payoutWith(server, time.Second)
+		require.NoError(t, err)
+		require.Equal(t, models.PayoutStatusFailed, result.Status)
+		require.Equal(t, "razorpay: something went wrong", result.Reason)
+	})
+	t.Run("bank accounts without an ifsc code fail", func(t *testing.T) {
+		client := New("key", "secret")
+		result, err := NewPayouts(client, "acc_1").Payout(models.GatewayPayout{WithdrawalID: "w1", Amount: 10, AccountNumber: "123"})
+		require.NoError(t, err)
+		require.Equal(t, models.PayoutStatusFailed, result.Status)
+	})
+	t.Run("the outcome of a timed out payout isn't known", func(t *testing.T) {
+		server := payoutServer(&Payout{ID: "pout_1", Status: "processed"}, http.StatusOK, 200*time.Millisecond)
+		defer server.Close()
+		result, err := payoutWith(server, 50*time.Millisecond)
+		require.Error(t, err)
+		require.Nil(t, result)
+	})
+	t.Run("the outcome of a payout razorpay failed on isn't known", func(t *testing.T) {
+		for _, status := range []int{http.StatusInternalServerError, http.StatusConflict, http.StatusTooManyRequests} {
+			server := payoutServer(nil, status, 0)
+			result, err := payoutWith(server, time.Second)
+			server.Close()
+			require.Error(t, err)
+			require.Nil(t, result)
+		}
+	})
+	t.Run("a payout account is needed", func(t *testing.T) {
+		_, err := NewPayouts(New("key", "secret"), "").Payout(payout)
+		require.Error(t, err)
+	})
+}
+
+func TestPayoutResultStatuses(t *testing.T) {
+	statuses := map[string]models.PayoutStatus{
+		"queued":     models.PayoutStatusPending,
+		"pending":    models.PayoutStatusPending,
+		"processing": models.PayoutStatusPending,
+		"processed":  models.PayoutStatusPaid,
+		"rejected":   models.PayoutStatusFailed,
+		"cancelled":  models.PayoutStatusFailed,
+		"failed":     models.PayoutStatusFailed,
+		"reversed":   models.PayoutStatusReversed,
+	}
+	for status, expected := range statuses {
+		require.Equal(t, expected, (&Payout{ID: "pout_1", Status: status}).Result().Status, status)
+	}
+	result := (&Payout{ID: "pout_1", Notes: Notes{"withdrawal_id": "w1"}, Status: "reversed", FailureReason: "beneficiary bank offline"}).Result()
+	require.Equal(t, &models.PayoutResult{WithdrawalID: "w1", Reference: "pout_1", Status: models.PayoutStatusReversed, Reason: "beneficiary bank offline"}, result)
+}
+
+func TestGetPayout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/payouts/pout_1":
+			_ = json.NewEncoder(w).Encode(Payout{ID: "pout_1", ReferenceID: "w1", Status: "reversed"})
+		case r.URL.Path == "/payouts":
+			require.Equal(t, "acc_1", r.URL.Query().Get("account_number"))
+			list := payouts{}
+			if r.URL.Query().Get("reference_id") == "w2" {
+				list.Items = []*Payout{{ID: "pout_2", ReferenceID: "w2", Status: "processed"}}
+			}
+			list.Count = len(list.Items)
+			_ = json.NewEncoder(w).Encode(list)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client := New("key", "secret")
+	client.APIURL = server.URL
+	payouts := NewPayouts(client, "acc_1")
+
+	result, err := payouts.GetPayout("w1", "pout_1")
+	require.NoError(t, err)
+	require.Equal(t, models.PayoutStatusReversed, result.Status)
+
+	result, err = payouts.GetPayout("w2", "")
+	require.NoError(t, err)
+	require.Equal(t, &models.PayoutResult{WithdrawalID: "w2", Reference: "pout_2", Status: models.PayoutStatusPaid}, result)
+
+	//no payout was made for the withdrawal
+	result, err = payouts.GetPayout("w3", "")
+	require.NoError(t, err)
+	require.Nil(t, result)
+}
@@ -0,0 +1,124 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package razorpay
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// DefaultAPIURL is the base url of the razorpay api.
+const DefaultAPIURL = "https://api.razorpay.com/v1"
+
+// Razorpay is a client of the razorpay api.
+type Razorpay struct {
+	KeyID         string
+	KeySecret     string
+	WebhookSecret string
+	APIURL        string
+	client        *http.Client
+}
+
+// apiError represents the error body returned by razorpay.
+type apiError struct {
+	Error struct {
+		Code        string `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+// APIError is an error razorpay answered a request with.
+type APIError struct {
+	StatusCode  int
+	Status      string
+	Code        string
+	Description string
+}
+
+// Error gives the description razorpay gave, or the http status when it gave none.
+func (e *APIError) Error() string {
+	if e.Description == "" {
+		return "razorpay: " + e.Status
+	}
+	return "razorpay: " + e.Description
+}
+
+// turnedDown tells whether razorpay turned the request down, so it wasn't acted on and won't be by sending it again.
+// Requests that failed on the razorpay side, were rate limited or clash with one in progress may still go through.
+func (e *APIError) turnedDown() bool {
+	return e.StatusCode >= http.StatusBadRequest && e.StatusCode < http.StatusInternalServerError &&
+		e.StatusCode != http.StatusConflict && e.StatusCode != http.StatusTooManyRequests
+}
+
+// Notes are the key value pairs razorpay keeps on its entities.
+// Razorpay gives an empty list instead of an empty object when there are none.
+type Notes map[string]string
+
+// UnmarshalJSON decodes notes given as an object, or as an empty list.
+func (n *Notes) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '[' {
+		*n = Notes{}
+		return nil
+	}
+	notes := map[string]string{}
+	err := json.Unmarshal(data, &notes)
+	if err != nil {
+		return err
+	}
+	*n = notes
+	return nil
+}
+
+// New gives a razorpay client using the api key.
+func New(keyID string, keySecret string) *Razorpay {
+	return &Razorpay{KeyID: keyID, KeySecret: keySecret, APIURL: DefaultAPIURL, client: &http.Client{Timeout: 30 * time.Second}}
+}
+
+// call sends a request to the razorpay api and decodes the response into out.
+func (r *Razorpay) call(method string, path string, body interface{}, out interface{}) error {
+	return r.callWithHeader(method, path, nil, body, out)
+}
+
+// callWithHeader sends a request with extra headers to the razorpay api and decodes the response into out.
+func (r *Razorpay) callWithHeader(method string, path string, header http.Header, body interface{}, out interface{}) error {
+	var reqBody []byte
+	if body != nil {
+		var err error
+		reqBody, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, r.APIURL+path, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(r.KeyID, r.KeySecret)
+	for key := range header {
+		req.Header.Set(key, header.Get(key))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		body := &apiError{}
+		_ = json.Unmarshal(respBody, body)
+		return &APIError{StatusCode: resp.StatusCode, Status: resp.Status, Code: body.Error.Code, Description: body.Error.Description}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
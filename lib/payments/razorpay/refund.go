@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package razorpay
+
+import (
+	"github.com/tribehq/platform/models"
+	"math"
+)
+
+// Refund represents a razorpay refund.
+type Refund struct {
+	ID        string `json:"id"`
+	Amount    int64  `json:"amount"`
+	Currency  string `json:"currency"`
+	PaymentID string `json:"payment_id"`
+	Receipt   string `json:"receipt"`
+	Notes     Notes  `json:"notes"`
+	Status    string `json:"status"`
+}
+
+// refundRequest represents the body of a razorpay refund request.
+type refundRequest struct {
+	Amount  int64  `json:"amount"`
+	Receipt string `json:"receipt"`
+	Notes   Notes  `json:"notes"`
+}
+
+// refunds represents a list of razorpay refunds.
+type refunds struct {
+	Count int       `json:"count"`
+	Items []*Refund `json:"items"`
+}
+
+// GetPaymentRefund gives the refund of a payment made with our refund id as its receipt, nil when there is none.
+func (r *Razorpay) GetPaymentRefund(paymentID string, refundID string) (*Refund, error) {
+	list := &refunds{}
+	err := r.call("GET", "/payments/"+paymentID+"/refunds?count=100", nil, list)
+	if err != nil {
+		return nil, err
+	}
+	for _, refund := range list.Items {
+		if refund.Receipt == refundID {
+			return refund, nil
+		}
+	}
+	return nil, nil
+}
+
+// RefundPayment refunds part or all of a captured razorpay payment.
+// Razorpay takes no idempotency key so a refund already made with the same receipt is given back instead of refunding twice.
+func (r *Razorpay) RefundPayment(refund models.GatewayRefund) (string, error) {
+	existing, err := r.GetPaymentRefund(refund.PaymentID, refund.RefundID)
+	if err != nil {
+		return "", err
+	}
+	if existing != nil {
+		return existing.ID, nil
+	}
+	req := refundRequest{
+		Amount:  int64(math.Round(refund.Amount * 100)),
+		Receipt: refund.RefundID,
+		Notes:   Notes{"order_id": refund.OrderID, "refund_id": refund.RefundID, "reason": refund.Reason},
+	}
+	razorpayRefund := &Refund{}
+	err = r.call("POST", "/payments/"+refund.PaymentID+"/refund", req, razorpayRefund)
+	if err != nil {
+		return "", err
+	}
+	return razorpayRefund.ID, nil
+}
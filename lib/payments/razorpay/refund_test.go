@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package razorpay
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"github.com/tribehq/platform/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRefundPaymentIsIdempotent(t *testing.T) {
+	var made []*Refund
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/payments/pay_1/refunds":
+			_ = json.NewEncoder(w).Encode(refunds{Count: len(made), Items: made})
+		case r.Method == "POST" && r.URL.Path == "/payments/pay_1/refund":
+			req := refundRequest{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			refund := &Refund{ID: "rfnd_" + req.Receipt, Amount: req.Amount, PaymentID: "pay_1", Receipt: req.Receipt}
+			made = append(made, refund)
+			_ = json.NewEncoder(w).Encode(refund)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := New("key", "secret")
+	client.APIURL = server.URL
+	refund := models.GatewayRefund{RefundID: "ref1", PaymentID: "pay_1", Amount: 12.5}
+
+	id, err := client.RefundPayment(refund)
+	require.NoError(t, err)
+	require.Equal(t, "rfnd_ref1", id)
+	require.Equal(t, int64(1250), made[0].Amount)
+
+	//retrying the same refund gives back the refund made the first time
+	id, err = client.RefundPayment(refund)
+	require.NoError(t, err)
+	require.Equal(t, "rfnd_ref1", id)
+	require.Len(t, made, 1)
+}
@@ -0,0 +1,116 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package razorpay
+
+// Transfer represents a razorpay route transfer of part of a payment to a linked account.
+type Transfer struct {
+	ID        string `json:"id"`
+	Source    string `json:"source"`
+	Recipient string `json:"recipient"`
+	Amount    int64  `json:"amount"`
+	Currency  string `json:"currency"`
+	Notes     Notes  `json:"notes"`
+	OnHold    bool   `json:"on_hold"`
+	CreatedAt int64  `json:"created_at"`
+}
+
+// TransferRequest describes a transfer to a linked account, amount is in paise.
+// A transfer on hold isn't paid out to the linked account until it is released.
+type TransferRequest struct {
+	Account  string `json:"account"`
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+	Notes    Notes  `json:"notes,omitempty"`
+	OnHold   bool   `json:"on_hold"`
+}
+
+// Reversal represents a razorpay route reversal of part of a transfer back from the linked account.
+type Reversal struct {
+	ID         string `json:"id"`
+	TransferID string `json:"transfer_id"`
+	Amount     int64  `json:"amount"`
+	Currency   string `json:"currency"`
+	Notes      Notes  `json:"notes"`
+	CreatedAt  int64  `json:"created_at"`
+}
+
+// reversalRequest represents the body of a razorpay transfer reversal request.
+type reversalRequest struct {
+	Amount int64 `json:"amount"`
+	Notes  Notes `json:"notes,omitempty"`
+}
+
+// reversals represents a list of razorpay reversals.
+type reversals struct {
+	Count int         `json:"count"`
+	Items []*Reversal `json:"items"`
+}
+
+// holdRequest represents the body of a razorpay request that holds or releases a transfer.
+type holdRequest struct {
+	OnHold bool `json:"on_hold"`
+}
+
+// transfersRequest represents the body of a razorpay payment transfers request.
+type transfersRequest struct {
+	Transfers []TransferRequest `json:"transfers"`
+}
+
+// transfers represents a list of razorpay transfers.
+type transfers struct {
+	Count int         `json:"count"`
+	Items []*Transfer `json:"items"`
+}
+
+// TransferPayment transfers parts of a captured payment to linked accounts.
+func (r *Razorpay) TransferPayment(paymentID string, requests []TransferRequest) ([]*Transfer, error) {
+	list := &transfers{}
+	err := r.call("POST", "/payments/"+paymentID+"/transfers", transfersRequest{Transfers: requests}, list)
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// GetPaymentTransfers gives the transfers made out of a payment.
+func (r *Razorpay) GetPaymentTransfers(paymentID string) ([]*Transfer, error) {
+	list := &transfers{}
+	err := r.call("GET", "/payments/"+paymentID+"/transfers", nil, list)
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// ReleaseTransfer takes a transfer off hold so it is paid out to the linked account.
+func (r *Razorpay) ReleaseTransfer(transferID string) (*Transfer, error) {
+	transfer := &Transfer{}
+	err := r.call("PATCH", "/transfers/"+transferID, holdRequest{OnHold: false}, transfer)
+	if err != nil {
+		return nil, err
+	}
+	return transfer, nil
+}
+
+// ReverseTransfer takes part of a transfer back from the linked account, amount is in paise.
+// Razorpay takes no idempotency key so a reversal already made with the same refund id in its notes is given back instead of reversing twice.
+func (r *Razorpay) ReverseTransfer(transferID string, amount int64, refundID string) (*Reversal, error) {
+	list := &reversals{}
+	err := r.call("GET", "/transfers/"+transferID+"/reversals", nil, list)
+	if err != nil {
+		return nil, err
+	}
+	for _, reversal := range list.Items {
+		if reversal.Notes["refund_id"] == refundID {
+			return reversal, nil
+		}
+	}
+	reversal := &Reversal{}
+	err = r.call("POST", "/transfers/"+transferID+"/reversals", reversalRequest{Amount: amount, Notes: Notes{"refund_id": refundID}}, reversal)
+	if err != nil {
+		return nil, err
+	}
+	return reversal, nil
+}
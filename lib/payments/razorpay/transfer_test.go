@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package razorpay
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTransferPaymentOnHold(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "POST", r.Method)
+		require.Equal(t, "/payments/pay_1/transfers", r.URL.Path)
+		body := map[string][]map[string]interface{}{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		require.Len(t, body["transfers"], 2)
+		require.Equal(t, true, body["transfers"][0]["on_hold"])
+		require.Equal(t, false, body["transfers"][1]["on_hold"])
+		_ = json.NewEncoder(w).Encode(transfers{Count: 1, Items: []*Transfer{{ID: "trf_1", OnHold: true, Notes: Notes{"transfer_key": "k1"}}}})
+	}))
+	defer server.Close()
+
+	client := New("key", "secret")
+	client.APIURL = server.URL
+	made, err := client.TransferPayment("pay_1", []TransferRequest{
+		{Account: "acc_1", Amount: 1000, Currency: "INR", OnHold: true},
+		{Account: "acc_2", Amount: 500, Currency: "INR"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "k1", made[0].Notes["transfer_key"])
+	require.True(t, made[0].OnHold)
+}
+
+func TestReleaseTransfer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "PATCH", r.Method)
+		require.Equal(t, "/transfers/trf_1", r.URL.Path)
+		body := map[string]interface{}{}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		require.Equal(t, false, body["on_hold"])
+		_ = json.NewEncoder(w).Encode(Transfer{ID: "trf_1"})
+	}))
+	defer server.Close()
+
+	client := New("key", "secret")
+	client.APIURL = server.URL
+	transfer, err := client.ReleaseTransfer("trf_1")
+	require.NoError(t, err)
+	require.False(t, transfer.OnHold)
+}
+
+func TestReverseTransferIsIdempotentByRefund(t *testing.T) {
+	var made []*Reversal
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/transfers/trf_1/reversals", r.URL.Path)
+		switch r.Method {
+		case "GET":
+			_ = json.NewEncoder(w).Encode(reversals{Count: len(made), Items: made})
+		case "POST":
+			req := reversalRequest{}
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			reversal := &Reversal{ID: "rvrsl_" + req.Notes["refund_id"], TransferID: "trf_1", Amount: req.Amount, Notes: req.Notes}
+			made = append(made, reversal)
+			_ = json.NewEncoder(w).Encode(reversal)
+		}
+	}))
+	defer server.Close()
+
+	client := New("key", "secret")
+	client.APIURL = server.URL
+	reversal, err := client.ReverseTransfer("trf_1", 2500, "r1")
+	require.NoError(t, err)
+	require.Equal(t, "rvrsl_r1", reversal.ID)
+	require.Equal(t, int64(2500), reversal.Amount)
+
+	//reversing again for the same refund gives back the reversal made the first time
+	again, err := client.ReverseTransfer("trf_1", 2500, "r1")
+	require.NoError(t, err)
+	require.Equal(t, reversal.ID, again.ID)
+	require.Len(t, made, 1)
+
+	_, err = client.ReverseTransfer("trf_1", 1000, "r2")
+	require.NoError(t, err)
+	require.Len(t, made, 2)
+}
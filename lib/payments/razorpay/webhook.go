@@ -0,0 +1,84 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package razorpay
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// SignatureHeader is the header razorpay signs its webhooks in.
+const SignatureHeader = "X-Razorpay-Signature"
+
+// ErrInvalidSignature is returned when a payment or webhook isn't signed by razorpay.
+var ErrInvalidSignature = errors.New("razorpay: invalid signature")
+
+// Dispute represents a razorpay dispute of a payment.
+type Dispute struct {
+	ID                string `json:"id"`
+	PaymentID         string `json:"payment_id"`
+	Amount            int64  `json:"amount"`
+	Currency          string `json:"currency"`
+	ReasonCode        string `json:"reason_code"`
+	ReasonDescription string `json:"reason_description"`
+	Status            string `json:"status"`
+	Phase             string `json:"phase"`
+	CreatedAt         int64  `json:"created_at"`
+}
+
+// WebhookEvent represents a razorpay webhook.
+type WebhookEvent struct {
+	AccountID string   `json:"account_id"`
+	Event     string   `json:"event"`
+	Contains  []string `json:"contains"`
+	Payload   struct {
+		Payment *struct {
+			Entity Payment `json:"entity"`
+		} `json:"payment"`
+		Refund *struct {
+			Entity Refund `json:"entity"`
+		} `json:"refund"`
+		Dispute *struct {
+			Entity Dispute `json:"entity"`
+		} `json:"dispute"`
+		Order *struct {
+			Entity Order `json:"entity"`
+		} `json:"order"`
+		Payout *struct {
+			Entity Payout `json:"entity"`
+		} `json:"payout"`
+	} `json:"payload"`
+	CreatedAt int64 `json:"created_at"`
+}
+
+// sign gives the hex HMAC-SHA256 of the message with the key.
+func sign(message []byte, key string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(message)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyPaymentSignature checks the signature razorpay checkout gives along with a payment of an order.
+func (r *Razorpay) VerifyPaymentSignature(orderID string, paymentID string, signature string) error {
+	expected := sign([]byte(orderID+"|"+paymentID), r.KeySecret)
+	if signature == "" || !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// VerifyWebhookSignature checks a webhook body is signed with the webhook secret.
+func (r *Razorpay) VerifyWebhookSignature(body []byte, signature string) error {
+	if r.WebhookSecret == "" {
+		return ErrInvalidSignature
+	}
+	expected := sign(body, r.WebhookSecret)
+	if signature == "" || !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package stripe
+
+import (
+	"math"
+	"strings"
+)
+
+// zeroDecimalCurrencies are charged in their major unit by stripe.
+var zeroDecimalCurrencies = map[string]bool{
+	"bif": true, "clp": true, "djf": true, "gnf": true, "jpy": true, "kmf": true, "krw": true, "mga": true,
+	"pyg": true, "rwf": true, "ugx": true, "vnd": true, "vuv": true, "xaf": true, "xof": true, "xpf": true,
+}
+
+// AmountInMinorUnits converts an amount to the smallest unit of its currency.
+func AmountInMinorUnits(amount float64, currency string) int64 {
+	if zeroDecimalCurrencies[strings.ToLower(currency)] {
+		return int64(math.Round(amount))
+	}
+	return int64(math.Round(amount * 100))
+}
+
+// AmountFromMinorUnits converts an amount in the smallest unit of its currency to the major unit.
+func AmountFromMinorUnits(amount int64, currency string) float64 {
+	if zeroDecimalCurrencies[strings.ToLower(currency)] {
+		return float64(amount)
+	}
+	return float64(amount) / 100
+}
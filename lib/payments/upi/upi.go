@@ -0,0 +1,65 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package upi
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Currency is the only currency UPI payments are made in.
+const Currency = "INR"
+
+// vpaPattern matches a virtual payment address: the account holder's handle, an @ and the name of their bank or UPI app.
+var vpaPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.\-_]{1,255}@[a-z][a-z0-9]{1,63}$`)
+
+// NormalizeVPA gives a VPA the way it is kept and compared, VPAs aren't case sensitive.
+func NormalizeVPA(vpa string) string {
+	return strings.ToLower(strings.TrimSpace(vpa))
+}
+
+// ValidVPA tells whether a VPA is well formed. It doesn't tell whether the VPA exists, only the bank knows that.
+func ValidVPA(vpa string) bool {
+	return vpaPattern.MatchString(NormalizeVPA(vpa))
+}
+
+// FormatAmount formats an amount in rupees the way UPI takes it.
+func FormatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
+
+// Intent is a payment to a merchant's VPA that the customer's UPI app makes when opened with its deep link.
+type Intent struct {
+	PayeeVPA  string
+	PayeeName string
+	MCC       string // merchant category code
+	TxnRef    string // our reference for the payment, the bank reports it back with the payment's status
+	Note      string
+	Amount    float64
+}
+
+// URL gives the upi://pay deep link that opens the customer's UPI app with the payment filled in.
+func (i Intent) URL() string {
+	params := [][2]string{
+		{"pa", NormalizeVPA(i.PayeeVPA)},
+		{"pn", i.PayeeName},
+		{"mc", i.MCC},
+		{"tr", i.TxnRef},
+		{"tn", i.Note},
+		{"am", FormatAmount(i.Amount)},
+		{"cu", Currency},
+	}
+	var query []string
+	for _, param := range params {
+		if param[1] == "" {
+			continue
+		}
+		//UPI apps read spaces encoded as %20, not as +
+		query = append(query, param[0]+"="+strings.Replace(url.QueryEscape(param[1]), "+", "%20", -1))
+	}
+	return "upi://pay?" + strings.Join(query, "&")
+}
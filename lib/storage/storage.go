@@ -8,23 +8,46 @@ import (
 	"cloud.google.com/go/storage"
 	"context"
 	log "github.com/sirupsen/logrus"
+	"net/url"
 	"os"
+	"path"
+	"strings"
 )
 
+// publicHost serves the public URLs of uploaded objects.
+const publicHost = "storage.googleapis.com"
+
+// DownloadsPrefix is where downloadable product files are kept. They are never public, only served through download grants.
+const DownloadsPrefix = "downloads/"
+
 var (
 	// StorageBucket ...
 	StorageBucket *storage.BucketHandle
 	//StorageBucketName ...
 	StorageBucketName string
+	// DownloadsBucket keeps downloadable product files, the storage bucket unless GCS_DOWNLOADS_BUCKET names another.
+	DownloadsBucket *storage.BucketHandle
+	// DownloadsBucketName is the name of the downloads bucket.
+	DownloadsBucketName string
 )
 
 func init() {
 	StorageBucketName = os.Getenv("GCS_BUCKET")
-	storageBucket, err := configureStorage(StorageBucketName)
-	if err != nil {
-		log.Fatal(err)
+	if StorageBucketName != "" {
+		storageBucket, err := configureStorage(StorageBucketName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		StorageBucket = storageBucket
+	}
+	DownloadsBucketName, DownloadsBucket = StorageBucketName, StorageBucket
+	if name := os.Getenv("GCS_DOWNLOADS_BUCKET"); name != "" {
+		downloadsBucket, err := configureStorage(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		DownloadsBucketName, DownloadsBucket = name, downloadsBucket
 	}
-	StorageBucket = storageBucket
 }
 
 func configureStorage(bucketID string) (*storage.BucketHandle, error) {
@@ -35,3 +58,42 @@ func configureStorage(bucketID string) (*storage.BucketHandle, error) {
 	}
 	return client.Bucket(bucketID), nil
 }
+
+// ObjectName returns the name of the object a public URL points to, if it is an object of the storage bucket.
+func ObjectName(fileURL string) (string, bool) {
+	if StorageBucketName == "" {
+		return "", false
+	}
+	u, err := url.Parse(fileURL)
+	if err != nil || u.Scheme != "https" || u.Host != publicHost || u.User != nil {
+		return "", false
+	}
+	name := strings.TrimPrefix(u.Path, "/"+StorageBucketName+"/")
+	if name == u.Path || name == "" {
+		return "", false
+	}
+	return name, true
+}
+
+// DownloadObjectName tells whether a product download file is the name of a private object of the downloads bucket.
+func DownloadObjectName(file string) (string, bool) {
+	if !strings.HasPrefix(file, DownloadsPrefix) || len(file) == len(DownloadsPrefix) || path.Clean(file) != file {
+		return "", false
+	}
+	return file, true
+}
+
+// DownloadObject gives the object of a product download file: a private object of the downloads bucket,
+// or for files uploaded before downloads were kept private, the object of the storage bucket their public URL points to.
+func DownloadObject(file string) (*storage.ObjectHandle, bool) {
+	if name, ok := DownloadObjectName(file); ok {
+		if DownloadsBucket == nil {
+			return nil, false
+		}
+		return DownloadsBucket.Object(name), true
+	}
+	if name, ok := ObjectName(file); ok && StorageBucket != nil {
+		return StorageBucket.Object(name), true
+	}
+	return nil, false
+}
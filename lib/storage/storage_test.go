@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package storage
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestObjectName(t *testing.T) {
+	StorageBucketName = "tribe-files"
+	defer func() { StorageBucketName = "" }()
+
+	name, ok := ObjectName("https://storage.googleapis.com/tribe-files/8f1c.pdf")
+	require.True(t, ok)
+	require.Equal(t, "8f1c.pdf", name)
+
+	for _, fileURL := range []string{
+		"http://storage.googleapis.com/tribe-files/8f1c.pdf",
+		"https://storage.googleapis.com/other-bucket/8f1c.pdf",
+		"https://storage.googleapis.com/tribe-files/",
+		"https://169.254.169.254/tribe-files/8f1c.pdf",
+		"https://storage.googleapis.com.evil.test/tribe-files/8f1c.pdf",
+		"https://user@storage.googleapis.com/tribe-files/8f1c.pdf",
+		"file:///etc/passwd",
+	} {
+		_, ok := ObjectName(fileURL)
+		require.False(t, ok, fileURL)
+	}
+
+	StorageBucketName = ""
+	_, ok = ObjectName("https://storage.googleapis.com/tribe-files/8f1c.pdf")
+	require.False(t, ok)
+}
+
+func TestDownloadObjectName(t *testing.T) {
+	name, ok := DownloadObjectName("downloads/8f1c.pdf")
+	require.True(t, ok)
+	require.Equal(t, "downloads/8f1c.pdf", name)
+
+	for _, file := range []string{
+		"downloads/",
+		"downloads/../avatars/8f1c.png",
+		"downloads//8f1c.pdf",
+		"/downloads/8f1c.pdf",
+		"8f1c.pdf",
+		"https://storage.googleapis.com/tribe-files/downloads/8f1c.pdf",
+	} {
+		_, ok := DownloadObjectName(file)
+		require.False(t, ok, file)
+	}
+}
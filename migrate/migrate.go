@@ -30,6 +30,17 @@ func main() {
 	//migrateRoles(db)
 	//readEmailTemplateFiles("./data/email_templates_inputs/")
 	//readSMSTemplateFiles("./data/sms_templates_inputs/")
+	migrateWalletOpeningBalances()
+}
+
+// migrateWalletOpeningBalances brings the balances of wallets from before the ledger into it, safe to run again
+func migrateWalletOpeningBalances() {
+	posted, err := models.PostOpeningWalletBalances()
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	log.Infof("posted the opening balances of %d wallets", posted)
 }
 
 // LocationCollection returns location.
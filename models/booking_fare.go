@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"errors"
+	"math"
+)
+
+// averageRideSpeedKms is the speed in kms per hour ride times are estimated with.
+const averageRideSpeedKms = 30.0
+
+var (
+	// ErrBookingFareNotAvailable is returned when the fare of a booking can't be estimated before the job is done.
+	ErrBookingFareNotAvailable = errors.New("fare can't be estimated for this booking")
+	// ErrBookingLocationRequired is returned when estimating a fare without the addresses the booking is done at.
+	ErrBookingLocationRequired = errors.New("booking locations are required")
+)
+
+// rideFare prices a ride of distance in unit with the fares of a vehicle type, the ride time being estimated
+// from the average ride speed. Rides cost at least the minimum fare of the vehicle type.
+func rideFare(vehicleType *ServiceVehicleType, distance float64, unit DistanceUnits) *BookingFareEstimate {
+	kms := distance
+	if unit == DistanceUnitsMiles {
+		kms *= kmsPerMile
+	}
+	minutes := math.Ceil(kms / averageRideSpeedKms * 60)
+	distance = roundAmount(distance)
+	baseFare := vehicleType.BaseFare
+	totalFare := roundAmount(math.Max(baseFare+vehicleType.PricePerKms*distance+vehicleType.PricePerMinute*minutes, vehicleType.MinimumFare))
+	return &BookingFareEstimate{BaseFare: &baseFare, Distance: &distance, Time: &minutes, TotalFare: &totalFare}
+}
+
+// EstimateRideFare estimates the taxed fare of a ride between two addresses in a vehicle type.
+func EstimateRideFare(vehicleTypeID string, from *Address, to *Address) (*BookingFareEstimate, error) {
+	if from == nil || to == nil || !hasCoordinates(from) || !hasCoordinates(to) {
+		return nil, ErrBookingLocationRequired
+	}
+	vehicleType, err := GetServiceVehicleTypeByID(vehicleTypeID)
+	if err != nil {
+		return nil, err
+	}
+	if vehicleType == nil || vehicleType.ID.IsZero() {
+		return nil, ErrBookingFareNotAvailable
+	}
+	unit := deliveryDistanceUnit(from)
+	estimate := rideFare(vehicleType, distanceBetween(from, to, unit), unit)
+	err = TaxBookingFare(estimate, from)
+	if err != nil {
+		return nil, err
+	}
+	return estimate, nil
+}
+
+// EstimateServiceFare estimates the taxed fare of the services ordered for delivery at an address.
+func EstimateServiceFare(items []*ServiceOrderInput, address *Address) (*BookingFareEstimate, error) {
+	var totalFare float64
+	for _, item := range items {
+		serviceType, err := GetServiceTypeByID(item.ServiceTypeID.Hex())
+		if err != nil {
+			return nil, err
+		}
+		if serviceType == nil || serviceType.ID.IsZero() {
+			return nil, ErrBookingFareNotAvailable
+		}
+		quantity := 1
+		if serviceType.AllowQuantity && item.Quantity > 0 {
+			quantity = item.Quantity
+		}
+		totalFare += serviceType.ServiceCharge * float64(quantity)
+	}
+	baseFare := roundAmount(totalFare)
+	totalFare = baseFare
+	estimate := &BookingFareEstimate{BaseFare: &baseFare, TotalFare: &totalFare}
+	err := TaxBookingFare(estimate, address)
+	if err != nil {
+		return nil, err
+	}
+	return estimate, nil
+}
@@ -0,0 +1,31 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRideFare(t *testing.T) {
+	vehicleType := &ServiceVehicleType{BaseFare: 50, PricePerKms: 12, PricePerMinute: 1, MinimumFare: 80}
+
+	t.Run("charges distance and estimated time on top of the base fare", func(t *testing.T) {
+		estimate := rideFare(vehicleType, 10, DistanceUnitsKms)
+		require.Equal(t, 10.0, *estimate.Distance)
+		require.Equal(t, 20.0, *estimate.Time)
+		require.Equal(t, 50.0, *estimate.BaseFare)
+		require.Equal(t, 190.0, *estimate.TotalFare)
+	})
+	t.Run("short rides cost the minimum fare", func(t *testing.T) {
+		estimate := rideFare(vehicleType, 1, DistanceUnitsKms)
+		require.Equal(t, 80.0, *estimate.TotalFare)
+	})
+	t.Run("rides in miles take longer per unit", func(t *testing.T) {
+		estimate := rideFare(vehicleType, 10, DistanceUnitsMiles)
+		require.Equal(t, 33.0, *estimate.Time)
+		require.Equal(t, 203.0, *estimate.TotalFare)
+	})
+}
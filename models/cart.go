@@ -29,6 +29,16 @@ type Cart struct {
 	UserID    primitive.ObjectID `json:"userID" bson:"userID"`
 	StoreID   string             `json:"storeID" bson:"storeID"`
 	Items     []CartItem         `json:"cartItems" bson:"cartItems"`
+	//Abandoned cart recovery
+	RemindersSent     int                 `json:"remindersSent" bson:"remindersSent"`
+	FirstRemindedAt   *time.Time          `json:"firstRemindedAt" bson:"firstRemindedAt"`
+	LastRemindedAt    *time.Time          `json:"lastRemindedAt" bson:"lastRemindedAt"`
+	RecoveryCoupon    string              `json:"recoveryCoupon" bson:"recoveryCoupon"`
+	RecoveryClickedAt *time.Time          `json:"recoveryClickedAt" bson:"recoveryClickedAt"`
+	CheckedOutAt      *time.Time          `json:"checkedOutAt" bson:"checkedOutAt"`
+	OrderID           *primitive.ObjectID `json:"orderID" bson:"orderID"`
+	RecoveredAt       *time.Time          `json:"recoveredAt" bson:"recoveredAt"`
+	RecoveredAmount   float64             `json:"recoveredAmount" bson:"recoveredAmount"`
 }
 
 type CartItem struct {
@@ -0,0 +1,407 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/cache"
+	"github.com/tribehq/platform/lib/database"
+	"github.com/tribehq/platform/utils/webhooks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	cartReminderTemplate     = "cart.abandoned"
+	cartRecoveryLinkValidity = 14 * 24 * time.Hour // how long the link of a cart reminder brings the cart back
+)
+
+var (
+	ErrCartRecoveryNotConfigured = errors.New("cart recovery links are not configured")
+	ErrInvalidCartRecoveryLink   = errors.New("cart recovery link is invalid")
+	ErrCartCheckedOut            = errors.New("cart was already checked out")
+)
+
+// cartReminder is what cart reminder templates are rendered with.
+type cartReminder struct {
+	Cart            *Cart
+	Customer        *User
+	Items           []OrderItem
+	Subtotal        float64
+	Reminder        int
+	RecoveryURL     string
+	CouponCode      string
+	CouponDiscount  float64
+	CouponExpiresAt time.Time
+}
+
+// SendCartReminders reminds customers of the carts they left without checking out, once for every delay of the cart recovery settings.
+// Delays count from the last change to a cart. It gives the number of reminders sent.
+func SendCartReminders(now time.Time) (int, error) {
+	settings, err := GetCurrentMarketSettings()
+	if err != nil || settings == nil {
+		return 0, err
+	}
+	recovery := settings.CartRecovery
+	if !recovery.Enabled || len(recovery.ReminderDelays) == 0 {
+		return 0, nil
+	}
+	if os.Getenv("CART_RECOVERY_URL") == "" || os.Getenv("CART_RECOVERY_SECRET") == "" {
+		return 0, ErrCartRecoveryNotConfigured
+	}
+
+	ctx := context.Background()
+	collection := database.MongoDB.Collection(CartCollection)
+	sent := 0
+	for i, delay := range recovery.ReminderDelays {
+		//carts from before reminders existed have no count yet
+		sentSoFar := bson.E{"remindersSent", i}
+		if i == 0 {
+			sentSoFar = bson.E{"remindersSent", bson.M{"$in": bson.A{0, nil}}}
+		}
+		filter := bson.D{
+			{"deletedAt", bson.M{"$exists": false}},
+			{"userID", bson.M{"$ne": primitive.NilObjectID}},
+			{"cartItems.0", bson.M{"$exists": true}},
+			sentSoFar,
+			{"updatedAt", bson.M{"$lte": now.Add(-time.Duration(delay) * time.Hour)}},
+		}
+		cur, err := collection.Find(ctx, filter)
+		if err != nil {
+			return sent, err
+		}
+		var carts []*Cart
+		err = cur.All(ctx, &carts)
+		if err != nil {
+			return sent, err
+		}
+		for _, cart := range carts {
+			//claim the reminder first so that concurrent runs don't send it twice
+			claim := bson.D{{"$set", bson.D{{"remindersSent", i + 1}, {"lastRemindedAt", now}}}}
+			if i == 0 {
+				claim = bson.D{{"$set", bson.D{{"remindersSent", i + 1}, {"lastRemindedAt", now}, {"firstRemindedAt", now}}}}
+			}
+			res, err := collection.UpdateOne(ctx, bson.D{{"_id", cart.ID}, sentSoFar}, claim)
+			if err != nil {
+				log.Errorln(err)
+				continue
+			}
+			if res.ModifiedCount < 1 {
+				continue
+			}
+			err = sendCartReminder(cart, i+1, recovery, now)
+			if err != nil {
+				log.Errorln(err)
+				continue
+			}
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// sendCartReminder sends one reminder of a cart over the channels of the cart recovery settings.
+func sendCartReminder(cart *Cart, reminder int, recovery CartRecoverySetting, now time.Time) error {
+	customer := GetUserByID(cart.UserID.Hex())
+	if customer == nil {
+		return nil
+	}
+	data := &cartReminder{Cart: cart, Customer: customer, Reminder: reminder}
+	for _, item := range cart.Items {
+		orderItem, _, err := cartOrderItem(item)
+		if err != nil {
+			continue
+		}
+		data.Items = append(data.Items, orderItem)
+		data.Subtotal += orderItem.Price * float64(orderItem.Quantity)
+	}
+	if len(data.Items) == 0 {
+		return nil
+	}
+	data.Subtotal = roundAmount(data.Subtotal)
+
+	var err error
+	data.RecoveryURL, err = CartRecoveryURL(cart, now.Add(cartRecoveryLinkValidity))
+	if err != nil {
+		return err
+	}
+	if reminder == recovery.CouponOnReminder && recovery.CouponPercentage > 0 {
+		coupon, err := createRecoveryCoupon(cart, customer, recovery, now)
+		if err != nil {
+			log.Errorln(err)
+		} else {
+			data.CouponCode, data.CouponDiscount, data.CouponExpiresAt = coupon.Code, coupon.DiscountAmount, coupon.ValidityExpire
+		}
+	}
+
+	for _, channel := range recovery.Channels {
+		switch channel {
+		case CartRecoveryChannelEmail:
+			if customer.Email != "" {
+				err = SendEmail("no-reply@tribe.cab", customer.Email, cartReminderTemplate, customer.Language, data, nil)
+			}
+		case CartRecoveryChannelSms:
+			if customer.MobileNo != "" {
+				err = SendSMS(customer.MobileNo, cartReminderTemplate, customer.Language, data)
+			}
+		case CartRecoveryChannelPush:
+			err = SendPush(customer.ID.Hex(), "push."+cartReminderTemplate, customer.Language, data, map[string]string{"type": "cart_reminder", "url": data.RecoveryURL})
+		}
+		if err != nil {
+			log.Errorln(err)
+		}
+	}
+	go webhooks.NewWebhookEvent("cart.reminded", data)
+	return nil
+}
+
+// createRecoveryCoupon creates a single use percentage coupon only the customer of an abandoned cart can use and keeps its code on the cart.
+func createRecoveryCoupon(cart *Cart, customer *User, recovery CartRecoverySetting, now time.Time) (*Coupon, error) {
+	code := make([]byte, 4)
+	if _, err := rand.Read(code); err != nil {
+		return nil, err
+	}
+	validDays := recovery.CouponValidDays
+	if validDays <= 0 {
+		validDays = 7
+	}
+	coupon := Coupon{
+		CreatedBy:      cart.UserID,
+		Code:           "CART" + strings.ToUpper(hex.EncodeToString(code)),
+		Description:    "Cart recovery",
+		DiscountAmount: recovery.CouponPercentage,
+		DiscountType:   "percentage",
+		Validity:       "set timings",
+		ValidityStart:  now,
+		ValidityExpire: now.AddDate(0, 0, validDays),
+		UsageLimit:     1,
+		Type:           CouponTypeSystemType,
+		ServiceType:    CouponSystemTypeDeliveryall,
+		IsActive:       true,
+		//tied to the customer, whether they signed up with an email or a mobile number
+		CustomerRestrictions: []primitive.ObjectID{customer.ID},
+	}
+	if customer.Email != "" {
+		coupon.EmailRestrictions = []string{customer.Email}
+	}
+	created, err := CreateCoupon(coupon)
+	if err != nil {
+		return nil, err
+	}
+	_, err = database.MongoDB.Collection(CartCollection).UpdateOne(context.Background(), bson.D{{"_id", cart.ID}}, bson.D{{"$set", bson.D{{"recoveryCoupon", created.Code}}}})
+	if err != nil {
+		log.Errorln(err)
+	}
+	return created, nil
+}
+
+// CartRecoveryURL gives the signed link that brings a customer back to their cart until it expires.
+func CartRecoveryURL(cart *Cart, expiresAt time.Time) (string, error) {
+	baseURL, secret := os.Getenv("CART_RECOVERY_URL"), os.Getenv("CART_RECOVERY_SECRET")
+	if baseURL == "" || secret == "" {
+		return "", ErrCartRecoveryNotConfigured
+	}
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	query := url.Values{}
+	query.Set("cart", cart.ID.Hex())
+	query.Set("expires", expires)
+	query.Set("signature", cartRecoverySignature(secret, cart.ID.Hex(), expires))
+	return baseURL + "?" + query.Encode(), nil
+}
+
+func cartRecoverySignature(secret string, cartID string, expires string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("cart:" + cartID + ":" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyCartRecoveryLink checks the expiry and signature of a cart recovery link.
+func verifyCartRecoveryLink(secret string, cartID string, expires string, signature string, now time.Time) error {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || now.Unix() > expiresAt {
+		return ErrInvalidCartRecoveryLink
+	}
+	if !hmac.Equal([]byte(signature), []byte(cartRecoverySignature(secret, cartID, expires))) {
+		return ErrInvalidCartRecoveryLink
+	}
+	return nil
+}
+
+// RecoverCart restores the cart of a recovery link, bringing it back if it was removed.
+// When the customer started another cart since, the items of the recovered cart are added to that one.
+func RecoverCart(cartID primitive.ObjectID, expires string, signature string) (*Cart, error) {
+	secret := os.Getenv("CART_RECOVERY_SECRET")
+	if secret == "" {
+		return nil, ErrCartRecoveryNotConfigured
+	}
+	err := verifyCartRecoveryLink(secret, cartID.Hex(), expires, signature, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	collection := database.MongoDB.Collection(CartCollection)
+	cart := &Cart{}
+	err = collection.FindOne(ctx, bson.D{{"_id", cartID}}).Decode(cart)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrInvalidCartRecoveryLink
+		}
+		return nil, err
+	}
+	if cart.OrderID != nil {
+		return nil, ErrCartCheckedOut
+	}
+	if cart.RecoveryClickedAt == nil {
+		now := time.Now()
+		cart.RecoveryClickedAt = &now
+		_, err = collection.UpdateOne(ctx, bson.D{{"_id", cart.ID}}, bson.D{{"$set", bson.D{{"recoveryClickedAt", now}}}})
+		if err != nil {
+			log.Errorln(err)
+		}
+	}
+	if cart.DeletedAt == nil {
+		return cart, nil
+	}
+
+	current, err := GetCartByFilter(bson.D{{"userID", cart.UserID}, {"storeID", cart.StoreID}})
+	if err != nil {
+		return nil, err
+	}
+	if current != nil && !current.ID.IsZero() {
+		current.Items = mergeCartItems(current.Items, cart.Items)
+		return UpdateCart(current)
+	}
+	_, err = collection.UpdateOne(ctx, bson.D{{"_id", cart.ID}}, bson.D{{"$unset", bson.D{{"deletedAt", ""}}}})
+	if err != nil {
+		return nil, err
+	}
+	cart.DeletedAt = nil
+	err = cache.RedisClient.Del(cart.ID.Hex()).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	return cart, nil
+}
+
+// sameCartItem tells whether two cart items hold the same product or variation.
+func sameCartItem(a CartItem, b CartItem) bool {
+	if a.ProductID != b.ProductID || (a.VariationID == nil) != (b.VariationID == nil) {
+		return false
+	}
+	return a.VariationID == nil || *a.VariationID == *b.VariationID
+}
+
+// mergeCartItems adds the items of another cart to cart items, keeping the larger quantity of items both carts hold.
+func mergeCartItems(items []CartItem, others []CartItem) []CartItem {
+	for _, other := range others {
+		found := false
+		for i := range items {
+			if sameCartItem(items[i], other) {
+				if other.Quantity > items[i].Quantity {
+					items[i].Quantity = other.Quantity
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			items = append(items, other)
+		}
+	}
+	return items
+}
+
+// markCartCheckedOut ties a cart to the order placed from it, counting the order as recovered when the cart was reminded of.
+func markCartCheckedOut(cart *Cart, order *Order) {
+	now := time.Now()
+	set := bson.D{{"orderID", order.ID}, {"checkedOutAt", now}}
+	if cart.RemindersSent > 0 {
+		set = append(set, bson.E{"recoveredAt", now}, bson.E{"recoveredAmount", order.OrderTotalAmount})
+	}
+	_, err := database.MongoDB.Collection(CartCollection).UpdateOne(context.Background(), bson.D{{"_id", cart.ID}}, bson.D{{"$set", set}})
+	if err != nil {
+		log.Errorln(err)
+	}
+}
+
+// GetCartRecoveryReport gives how many of the carts first reminded of between two times were won back.
+func GetCartRecoveryReport(from time.Time, to time.Time) (*CartRecoveryReport, error) {
+	ctx := context.Background()
+	remindedAt := bson.M{"$ne": nil}
+	if !from.IsZero() {
+		remindedAt["$gte"] = from
+	}
+	if !to.IsZero() {
+		remindedAt["$lte"] = to
+	}
+	pipeline := bson.A{
+		bson.M{"$match": bson.M{"firstRemindedAt": remindedAt}},
+		bson.M{"$group": bson.M{
+			"_id":              nil,
+			"remindedCarts":    bson.M{"$sum": 1},
+			"remindersSent":    bson.M{"$sum": "$remindersSent"},
+			"clickedCarts":     bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{"$recoveryClickedAt", nil}}, 1, 0}}},
+			"recoveredCarts":   bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$gt": bson.A{"$recoveredAt", nil}}, 1, 0}}},
+			"recoveredRevenue": bson.M{"$sum": "$recoveredAmount"},
+		}},
+	}
+	cur, err := database.MongoDB.Collection(CartCollection).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	var totals []struct {
+		RemindedCarts    int     `bson:"remindedCarts"`
+		RemindersSent    int     `bson:"remindersSent"`
+		ClickedCarts     int     `bson:"clickedCarts"`
+		RecoveredCarts   int     `bson:"recoveredCarts"`
+		RecoveredRevenue float64 `bson:"recoveredRevenue"`
+	}
+	err = cur.All(ctx, &totals)
+	if err != nil {
+		return nil, err
+	}
+	report := &CartRecoveryReport{}
+	if !from.IsZero() {
+		report.FromDate = &from
+	}
+	if !to.IsZero() {
+		report.ToDate = &to
+	}
+	if len(totals) > 0 {
+		report.RemindedCarts = totals[0].RemindedCarts
+		report.RemindersSent = totals[0].RemindersSent
+		report.ClickedCarts = totals[0].ClickedCarts
+		report.RecoveredCarts = totals[0].RecoveredCarts
+		report.RecoveredRevenue = roundAmount(totals[0].RecoveredRevenue)
+	}
+	if report.RemindedCarts > 0 {
+		report.ConversionRate = roundAmount(float64(report.RecoveredCarts) * 100 / float64(report.RemindedCarts))
+	}
+	return report, nil
+}
+
+// RunCartRecovery sends the cart reminders that are due, checking every interval.
+func RunCartRecovery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := SendCartReminders(time.Now()); err != nil {
+			log.Errorln(err)
+		}
+		<-ticker.C
+	}
+}
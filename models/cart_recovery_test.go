@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/url"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCartRecoveryLink(t *testing.T) {
+	os.Setenv("CART_RECOVERY_URL", "https://shop.tribe.cab/cart/recover")
+	os.Setenv("CART_RECOVERY_SECRET", "secret")
+	defer os.Unsetenv("CART_RECOVERY_URL")
+	defer os.Unsetenv("CART_RECOVERY_SECRET")
+
+	now := time.Now()
+	cart := &Cart{ID: primitive.NewObjectID()}
+	link, err := CartRecoveryURL(cart, now.Add(time.Hour))
+	require.NoError(t, err)
+	parsed, err := url.Parse(link)
+	require.NoError(t, err)
+	query := parsed.Query()
+	require.Equal(t, cart.ID.Hex(), query.Get("cart"))
+
+	require.NoError(t, verifyCartRecoveryLink("secret", cart.ID.Hex(), query.Get("expires"), query.Get("signature"), now))
+	t.Run("expired links are refused", func(t *testing.T) {
+		err := verifyCartRecoveryLink("secret", cart.ID.Hex(), query.Get("expires"), query.Get("signature"), now.Add(2*time.Hour))
+		require.Equal(t, ErrInvalidCartRecoveryLink, err)
+	})
+	t.Run("the expiry can't be pushed back", func(t *testing.T) {
+		later := strconv.FormatInt(now.Add(48*time.Hour).Unix(), 10)
+		err := verifyCartRecoveryLink("secret", cart.ID.Hex(), later, query.Get("signature"), now.Add(2*time.Hour))
+		require.Equal(t, ErrInvalidCartRecoveryLink, err)
+	})
+	t.Run("links are bound to their cart", func(t *testing.T) {
+		err := verifyCartRecoveryLink("secret", primitive.NewObjectID().Hex(), query.Get("expires"), query.Get("signature"), now)
+		require.Equal(t, ErrInvalidCartRecoveryLink, err)
+	})
+}
+
+func TestCouponUsable(t *testing.T) {
+	now := time.Now()
+	coupon := &Coupon{ValidityStart: now.Add(-time.Hour), ValidityExpire: now.Add(time.Hour), UsageLimit: 1}
+	require.True(t, coupon.usable(now, primitive.NilObjectID, ""))
+	require.False(t, coupon.usable(now.Add(2*time.Hour), primitive.NilObjectID, ""))
+
+	coupon.UsedLimit = 1
+	require.False(t, coupon.usable(now, primitive.NilObjectID, ""))
+	coupon.UsedLimit = 0
+
+	t.Run("email restrictions", func(t *testing.T) {
+		restricted := *coupon
+		restricted.EmailRestrictions = []string{"Asha@Example.com", "*@tribe.cab"}
+		require.True(t, restricted.usable(now, primitive.NilObjectID, "asha@example.com"))
+		require.True(t, restricted.usable(now, primitive.NilObjectID, "ops@tribe.cab"))
+		require.False(t, restricted.usable(now, primitive.NilObjectID, "ravi@example.com"))
+		require.False(t, restricted.usable(now, primitive.NilObjectID, ""))
+	})
+
+	t.Run("customer restrictions", func(t *testing.T) {
+		customerID := primitive.NewObjectID()
+		restricted := *coupon
+		restricted.CustomerRestrictions = []primitive.ObjectID{customerID}
+		require.True(t, restricted.usable(now, customerID, ""))
+		require.False(t, restricted.usable(now, primitive.NewObjectID(), ""))
+		require.False(t, restricted.usable(now, primitive.NilObjectID, ""))
+	})
+}
@@ -0,0 +1,552 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/database"
+	"github.com/tribehq/platform/utils/webhooks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"math"
+	"sync"
+	"time"
+)
+
+var (
+	ErrCashLiabilityLimitReached      = errors.New("provider owes more cash than the market allows, it has to be settled before taking cash jobs")
+	ErrInvalidCashLiabilityPayment    = errors.New("cash payment must be more than zero")
+	ErrCashLiabilityReferenceRequired = errors.New("cash payments need a reference")
+	ErrCashLiabilityOverpaid          = errors.New("cash payment is more than the provider owes")
+	ErrCashLiabilityExceeded          = errors.New("more would be taken off the cash liability than the provider owes")
+)
+
+// CashLiability represents the cash a provider collected on behalf of the market and still owes it, in one currency.
+// Cash jobs and orders add to the balance, wallet earnings, settlements and payments of the provider take it off.
+type CashLiability struct {
+	ID              primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	CreatedAt       time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt       time.Time          `json:"updatedAt" bson:"updatedAt"`
+	ProviderID      primitive.ObjectID `json:"providerId" bson:"providerID"`
+	Currency        string             `json:"currency" bson:"currency"`
+	Balance         float64            `json:"balance" bson:"balance"`
+	Version         int64              `json:"-" bson:"version"`         //counts the entries, keys wallet offsets of the balance it was read at
+	Limit           float64            `json:"limit" bson:"-"`           //of the market settings when the liability was read
+	CashJobsBlocked bool               `json:"cashJobsBlocked" bson:"-"` //owes more than the limit
+}
+
+// CashLiabilityEntry represents an immutable change of a cash liability, positive amounts add to what the provider owes.
+type CashLiabilityEntry struct {
+	ID             primitive.ObjectID     `json:"id,omitempty" bson:"_id,omitempty"`
+	CreatedAt      time.Time              `json:"createdAt" bson:"createdAt"`
+	CreatedBy      primitive.ObjectID     `json:"createdBy" bson:"createdBy"`
+	ProviderID     primitive.ObjectID     `json:"providerId" bson:"providerID"`
+	Currency       string                 `json:"currency" bson:"currency"`
+	Type           CashLiabilityEntryType `json:"type" bson:"type"`
+	Amount         float64                `json:"amount" bson:"amount"`
+	Balance        float64                `json:"balance" bson:"balance"` //balance of the liability after the entry
+	JobID          *primitive.ObjectID    `json:"jobId,omitempty" bson:"jobID,omitempty"`
+	OrderID        *primitive.ObjectID    `json:"orderId,omitempty" bson:"orderID,omitempty"`
+	SettlementID   *primitive.ObjectID    `json:"settlementId,omitempty" bson:"settlementID,omitempty"`
+	PostingID      *primitive.ObjectID    `json:"postingId,omitempty" bson:"postingID,omitempty"`
+	Reference      string                 `json:"reference" bson:"reference"`
+	IdempotencyKey string                 `json:"idempotencyKey" bson:"idempotencyKey"`
+	Description    string                 `json:"description" bson:"description"`
+}
+
+var (
+	cashLiabilityIndexesMu    sync.Mutex
+	cashLiabilityIndexesReady bool
+)
+
+// ensureCashLiabilityIndexes makes sure a provider has one liability for each currency and every entry is recorded once.
+// Collections can't be created inside a transaction so this also makes sure they exist.
+func ensureCashLiabilityIndexes() {
+	cashLiabilityIndexesMu.Lock()
+	defer cashLiabilityIndexesMu.Unlock()
+	if cashLiabilityIndexesReady {
+		return
+	}
+	ctx := context.Background()
+	db := database.MongoDB
+	_, err := db.Collection(CashLiabilitiesCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{"providerID", 1}, {"currency", 1}}, Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	_, err = db.Collection(CashLiabilityEntriesCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{"idempotencyKey", 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{"providerID", 1}, {"currency", 1}}},
+		{Keys: bson.D{{"jobID", 1}}},
+		{Keys: bson.D{{"orderID", 1}}},
+	})
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	cashLiabilityIndexesReady = true
+}
+
+// cashLiabilitySetting gives the cash liability settings of the market.
+func cashLiabilitySetting() CashLiabilitySetting {
+	settings, err := GetCurrentMarketSettings()
+	if err != nil || settings == nil {
+		return CashLiabilitySetting{}
+	}
+	return settings.CashLiability
+}
+
+// providerCommissionEnabled tells whether the market takes a commission from the fares of jobs.
+func providerCommissionEnabled() bool {
+	settings, err := GetCurrentMarketSettings()
+	return err == nil && settings != nil && settings.Payment.EnableProviderCommission
+}
+
+// withCashLiabilityLimit fills in the limit of a liability and whether it keeps the provider from cash jobs.
+func withCashLiabilityLimit(liability *CashLiability, limit float64) *CashLiability {
+	liability.Balance = roundAmount(liability.Balance)
+	liability.Limit = limit
+	liability.CashJobsBlocked = limit > 0 && liability.Balance > limit
+	return liability
+}
+
+// GetCashLiability gives what a provider owes in a currency, nil when they never owed anything in it.
+func GetCashLiability(providerID primitive.ObjectID, currency string) (*CashLiability, error) {
+	liability := &CashLiability{}
+	filter := bson.D{{"providerID", providerID}, {"currency", currency}}
+	err := database.MongoDB.Collection(CashLiabilitiesCollection).FindOne(context.Background(), filter).Decode(liability)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	return withCashLiabilityLimit(liability, cashLiabilitySetting().Limit), nil
+}
+
+// GetProviderCashLiabilities gives what a provider owes in each currency.
+func GetProviderCashLiabilities(providerID primitive.ObjectID) ([]*CashLiability, error) {
+	ctx := context.Background()
+	opts := options.Find().SetSort(bson.M{"currency": 1})
+	cur, err := database.MongoDB.Collection(CashLiabilitiesCollection).Find(ctx, bson.D{{"providerID", providerID}}, opts)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	limit := cashLiabilitySetting().Limit
+	liabilities := []*CashLiability{}
+	for cur.Next(ctx) {
+		liability := &CashLiability{}
+		err = cur.Decode(liability)
+		if err != nil {
+			log.Errorln(err)
+			return nil, err
+		}
+		liabilities = append(liabilities, withCashLiabilityLimit(liability, limit))
+	}
+	if err = cur.Err(); err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	return liabilities, nil
+}
+
+// CheckCashJobsAllowed fails with ErrCashLiabilityLimitReached while a provider owes more than the limit of the market in any currency.
+func CheckCashJobsAllowed(providerID primitive.ObjectID) error {
+	if cashLiabilitySetting().Limit <= 0 {
+		return nil
+	}
+	liabilities, err := GetProviderCashLiabilities(providerID)
+	if err != nil {
+		return err
+	}
+	for _, liability := range liabilities {
+		if liability.CashJobsBlocked {
+			return ErrCashLiabilityLimitReached
+		}
+	}
+	return nil
+}
+
+// getOrCreateCashLiability gives the liability of a provider in a currency, creating it on first use.
+func getOrCreateCashLiability(providerID primitive.ObjectID, currency string) (*CashLiability, error) {
+	ensureCashLiabilityIndexes()
+	filter := bson.D{{"providerID", providerID}, {"currency", currency}}
+	now := time.Now()
+	update := bson.D{{"$setOnInsert", bson.D{{"createdAt", now}, {"updatedAt", now}, {"balance", 0}, {"version", 0}}}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	liability := &CashLiability{}
+	err := database.MongoDB.Collection(CashLiabilitiesCollection).FindOneAndUpdate(context.Background(), filter, update, opts).Decode(liability)
+	if err != nil && isDuplicateKeyError(err) {
+		//created by a concurrent request
+		err = database.MongoDB.Collection(CashLiabilitiesCollection).FindOne(context.Background(), filter).Decode(liability)
+	}
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	return liability, nil
+}
+
+// getCashLiabilityEntryByKey gives the entry recorded with an idempotency key, nil when there is none.
+func getCashLiabilityEntryByKey(idempotencyKey string) (*CashLiabilityEntry, error) {
+	entry := &CashLiabilityEntry{}
+	err := database.MongoDB.Collection(CashLiabilityEntriesCollection).FindOne(context.Background(), bson.D{{"idempotencyKey", idempotencyKey}}).Decode(entry)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	return entry, nil
+}
+
+// recordCashLiabilityEntry moves the balance of a provider's liability and records the entry in one transaction,
+// along with the wallet posting that paid it off when one is given. Recording again with the same idempotency key
+// gives back the first entry without moving anything.
+func recordCashLiabilityEntry(entry CashLiabilityEntry, posting *WalletPosting) (*CashLiabilityEntry, error) {
+	ensureCashLiabilityIndexes()
+	existing, err := getCashLiabilityEntryByKey(entry.IdempotencyKey)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+	liability, err := getOrCreateCashLiability(entry.ProviderID, entry.Currency)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	entry.ID = primitive.NewObjectID()
+	entry.CreatedAt = now
+	entry.Amount = roundAmount(entry.Amount)
+	if posting != nil {
+		err = validateWalletPosting(posting)
+		if err != nil {
+			return nil, err
+		}
+		posting.ID = primitive.NewObjectID()
+		posting.CreatedAt = now
+		entry.PostingID = &posting.ID
+	}
+	err = runWalletTransaction(func(sc mongo.SessionContext) error {
+		if posting != nil {
+			err := applyWalletPosting(sc, posting)
+			if err != nil {
+				return err
+			}
+		}
+		return applyCashLiabilityEntry(sc, liability.ID, &entry)
+	})
+	if err != nil {
+		if isDuplicateKeyError(err) {
+			//recorded by a concurrent request with the same key
+			return getCashLiabilityEntryByKey(entry.IdempotencyKey)
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	if posting != nil {
+		postedWalletPosting(posting)
+	}
+	go webhooks.NewWebhookEvent("cash_liability_entry.created", &entry)
+	return &entry, nil
+}
+
+// cashLiabilityMoveFilter matches the liability an entry moves, as long as an entry taking off the balance
+// doesn't take off more than the provider owes at that moment.
+func cashLiabilityMoveFilter(liabilityID primitive.ObjectID, amount float64) bson.D {
+	filter := bson.D{{"_id", liabilityID}}
+	if amount < 0 {
+		filter = append(filter, bson.E{"balance", bson.M{"$gte": -amount}})
+	}
+	return filter
+}
+
+// applyCashLiabilityEntry moves the balance of a liability by an entry and records the entry, within a transaction.
+// Entries taking off more than the provider owes fail with ErrCashLiabilityExceeded, the balance never goes below zero.
+func applyCashLiabilityEntry(sc mongo.SessionContext, liabilityID primitive.ObjectID, entry *CashLiabilityEntry) error {
+	update := bson.D{{"$inc", bson.D{{"balance", entry.Amount}, {"version", 1}}}, {"$set", bson.D{{"updatedAt", entry.CreatedAt}}}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	moved := &CashLiability{}
+	err := database.MongoDB.Collection(CashLiabilitiesCollection).FindOneAndUpdate(sc, cashLiabilityMoveFilter(liabilityID, entry.Amount), update, opts).Decode(moved)
+	if err == mongo.ErrNoDocuments {
+		return ErrCashLiabilityExceeded
+	}
+	if err != nil {
+		return err
+	}
+	entry.Balance = roundAmount(moved.Balance)
+	_, err = database.MongoDB.Collection(CashLiabilityEntriesCollection).InsertOne(sc, entry)
+	return err
+}
+
+// accrueCashLiability adds what a provider owes for cash they collected and pays off what it can out of their wallet right away.
+func accrueCashLiability(entry CashLiabilityEntry) (*CashLiabilityEntry, error) {
+	recorded, err := recordCashLiabilityEntry(entry, nil)
+	if err != nil {
+		return nil, err
+	}
+	err = offsetProviderCashLiability(entry.ProviderID.Hex())
+	if err != nil {
+		log.Errorln(err)
+	}
+	return recorded, nil
+}
+
+// offsetProviderCashLiability pays off what a provider owes out of their wallet, see offsetCashLiabilityFromWallet.
+func offsetProviderCashLiability(providerID string) error {
+	provider := GetServiceProviderByID(providerID)
+	if provider == nil || provider.ID.IsZero() {
+		return nil
+	}
+	_, err := offsetCashLiabilityFromWallet(provider)
+	return err
+}
+
+// recordCashJobLiability adds the commission of a completed cash job to what its provider owes,
+// the provider kept the whole fare.
+func recordCashJobLiability(job *Job) (*CashLiabilityEntry, error) {
+	if job.PaymentMethodType != PaymentMethodTypeCash || job.ProviderID == "" || job.CompletedAt == nil {
+		return nil, nil
+	}
+	provider := GetServiceProviderByID(job.ProviderID)
+	if provider == nil || provider.ID.IsZero() {
+		return nil, fmt.Errorf("provider %s of job %s not found", job.ProviderID, job.ID.Hex())
+	}
+	commission := roundAmount(job.FareAmount * jobCommissionRate(job, providerCommissionEnabled()) / 100)
+	if commission <= 0 {
+		return nil, nil
+	}
+	return accrueCashLiability(CashLiabilityEntry{
+		CreatedBy:      job.CreatedBy,
+		ProviderID:     provider.ID,
+		Currency:       provider.Currency,
+		Type:           CashLiabilityEntryTypeCashJob,
+		Amount:         commission,
+		JobID:          &job.ID,
+		IdempotencyKey: "job:" + job.ID.Hex(),
+		Description:    fmt.Sprintf("Commission of cash booking %s", job.BookingNumber),
+	})
+}
+
+// recordCashOrderLiability adds a delivered cash order to what its delivery provider owes,
+// the order total less the delivery charges the provider earns.
+func recordCashOrderLiability(order *Order) (*CashLiabilityEntry, error) {
+	if order.PaymentMethod.Type != PaymentMethodTypeCash || order.ProviderID.IsZero() || len(order.ChildOrders) > 0 {
+		return nil, nil
+	}
+	amount := roundAmount(order.OrderTotalAmount - order.ShippingTotal)
+	if amount <= 0 {
+		return nil, nil
+	}
+	return accrueCashLiability(CashLiabilityEntry{
+		CreatedBy:      order.CreatedBy,
+		ProviderID:     order.ProviderID,
+		Currency:       order.Currency.CurrencyCode,
+		Type:           CashLiabilityEntryTypeCashOrder,
+		Amount:         amount,
+		OrderID:        &order.ID,
+		IdempotencyKey: "order:" + order.ID.Hex(),
+		Description:    fmt.Sprintf("Cash collected for order %d", order.OrderNumber),
+	})
+}
+
+// cashLiabilityOffsetKey is the idempotency key of paying off a liability out of the wallet at the balance it was read at,
+// so offsets running at once off the same balance take it out of the wallet only once.
+func cashLiabilityOffsetKey(liability *CashLiability) string {
+	return fmt.Sprintf("wallet_offset:%s:%d", liability.ID.Hex(), liability.Version)
+}
+
+// offsetCashLiabilityFromWallet pays off what a provider owes in their currency out of the available balance of their wallet,
+// nil when they owe nothing or have nothing to pay with.
+func offsetCashLiabilityFromWallet(provider *ServiceProvider) (*CashLiabilityEntry, error) {
+	liability, err := GetCashLiability(provider.ID, provider.Currency)
+	if err != nil || liability == nil || liability.Balance <= 0 {
+		return nil, err
+	}
+	wallet, err := GetOrCreateWallet(provider.ID.Hex(), WalletTypeProvider)
+	if err != nil {
+		return nil, err
+	}
+	amount := roundAmount(math.Min(liability.Balance, wallet.AvailableBalance()))
+	if amount <= 0 {
+		return nil, nil
+	}
+	system, err := GetOrCreateWallet(SystemWalletCashLiabilities, WalletTypeSystem)
+	if err != nil {
+		return nil, err
+	}
+	key := cashLiabilityOffsetKey(liability)
+	posting := &WalletPosting{
+		IdempotencyKey: "cash_liability:" + key,
+		Description:    "Cash owed to the market",
+		BalanceFor:     BalanceForBooking,
+		Entries:        []WalletEntry{{WalletID: wallet.ID, Amount: -amount}, {WalletID: system.ID, Amount: amount}},
+	}
+	return recordCashLiabilityEntry(CashLiabilityEntry{
+		ProviderID:     provider.ID,
+		Currency:       provider.Currency,
+		Type:           CashLiabilityEntryTypeWalletOffset,
+		Amount:         -amount,
+		IdempotencyKey: key,
+		Description:    "Taken out of the wallet earnings",
+	}, posting)
+}
+
+// RecordCashLiabilityPayment records cash a provider paid the market towards what they owe.
+// The reference identifies the payment, recording it again gives back the first entry.
+func RecordCashLiabilityPayment(providerID primitive.ObjectID, currency string, amount float64, reference string, createdBy primitive.ObjectID) (*CashLiabilityEntry, error) {
+	amount = roundAmount(amount)
+	if amount <= 0 {
+		return nil, ErrInvalidCashLiabilityPayment
+	}
+	if reference == "" {
+		return nil, ErrCashLiabilityReferenceRequired
+	}
+	key := "payment:" + providerID.Hex() + ":" + reference
+	ensureCashLiabilityIndexes()
+	existing, err := getCashLiabilityEntryByKey(key)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+	liability, err := GetCashLiability(providerID, currency)
+	if err != nil {
+		return nil, err
+	}
+	if liability == nil || amount > liability.Balance {
+		return nil, ErrCashLiabilityOverpaid
+	}
+	entry, err := recordCashLiabilityEntry(CashLiabilityEntry{
+		CreatedBy:      createdBy,
+		ProviderID:     providerID,
+		Currency:       currency,
+		Type:           CashLiabilityEntryTypePayment,
+		Amount:         -amount,
+		Reference:      reference,
+		IdempotencyKey: key,
+		Description:    "Paid in cash",
+	}, nil)
+	if err == ErrCashLiabilityExceeded {
+		//the provider paid off some of it in the meantime
+		return nil, ErrCashLiabilityOverpaid
+	}
+	return entry, err
+}
+
+// settlementCashLiabilityAccrued gives what the cash jobs and orders of a provider settlement added to the provider's liability.
+func settlementCashLiabilityAccrued(settlement *Settlement) (float64, error) {
+	if len(settlement.JobIDs) == 0 && len(settlement.OrderIDs) == 0 {
+		return 0, nil
+	}
+	match := bson.D{
+		{"providerID", settlement.PayeeID},
+		{"currency", settlement.Currency},
+		{"type", bson.M{"$in": bson.A{CashLiabilityEntryTypeCashJob, CashLiabilityEntryTypeCashOrder}}},
+		{"$or", bson.A{
+			bson.D{{"jobID", bson.M{"$in": settlement.JobIDs}}},
+			bson.D{{"orderID", bson.M{"$in": settlement.OrderIDs}}},
+		}},
+	}
+	pipeline := bson.A{
+		bson.D{{"$match", match}},
+		bson.D{{"$group", bson.D{{"_id", nil}, {"amount", bson.D{{"$sum", "$amount"}}}}}},
+	}
+	ctx := context.Background()
+	cur, err := database.MongoDB.Collection(CashLiabilityEntriesCollection).Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Errorln(err)
+		return 0, err
+	}
+	defer cur.Close(ctx)
+	var accrued float64
+	for cur.Next(ctx) {
+		sum := struct {
+			Amount float64 `bson:"amount"`
+		}{}
+		err = cur.Decode(&sum)
+		if err != nil {
+			log.Errorln(err)
+			return 0, err
+		}
+		accrued += sum.Amount
+	}
+	if err = cur.Err(); err != nil {
+		log.Errorln(err)
+		return 0, err
+	}
+	return roundAmount(accrued), nil
+}
+
+// offsetSettlementCashLiability takes the cash liability offset of a settlement off what its provider owes,
+// within the transaction saving the settlement. It gives the entry recorded, nil when there is no offset.
+// It fails with ErrCashLiabilityExceeded when the provider has paid off some of the offset since the settlement was worked out,
+// leaving the settlement to be worked out again.
+func offsetSettlementCashLiability(sc mongo.SessionContext, settlement *Settlement, liabilityID primitive.ObjectID) (*CashLiabilityEntry, error) {
+	if settlement.PayeeType != SettlementPayeeProvider || settlement.CashLiabilityOffset <= 0 {
+		return nil, nil
+	}
+	entry := CashLiabilityEntry{
+		ID:             primitive.NewObjectID(),
+		CreatedAt:      time.Now(),
+		CreatedBy:      settlement.CreatedBy,
+		ProviderID:     settlement.PayeeID,
+		Currency:       settlement.Currency,
+		Type:           CashLiabilityEntryTypeSettlementOffset,
+		Amount:         -settlement.CashLiabilityOffset,
+		SettlementID:   &settlement.ID,
+		IdempotencyKey: "settlement:" + settlement.ID.Hex(),
+		Description: fmt.Sprintf("Taken out of the settlement for %s to %s",
+			settlement.PeriodStart.Format("2006-01-02"), settlement.PeriodEnd.Format("2006-01-02")),
+	}
+	err := applyCashLiabilityEntry(sc, liabilityID, &entry)
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// GetCashLiabilityEntries gives the entries of cash liabilities, oldest first.
+func GetCashLiabilityEntries(filter bson.D, limit int, after *string, before *string, first *int, last *int) (entries []*CashLiabilityEntry, totalCount int64, hasPrevious, hasNext bool, err error) {
+	db := database.MongoDB
+	tcint, filter, err := calcTotalCountWithQueryFilters(CashLiabilityEntriesCollection, filter, after, before)
+	if err != nil {
+		return
+	}
+	totalCount = int64(tcint)
+	pagingInfo, err := PaginationUtility(after, before, first, last, &tcint)
+	if err != nil {
+		return
+	}
+	pagingInfo.QueryOpts.SetSort(bson.M{"_id": 1})
+
+	ctx := context.Background()
+	cur, err := db.Collection(CashLiabilityEntriesCollection).Find(ctx, filter, &pagingInfo.QueryOpts)
+	if err != nil {
+		return
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		entry := &CashLiabilityEntry{}
+		err = cur.Decode(entry)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		entries = append(entries, entry)
+	}
+	if err = cur.Err(); err != nil {
+		return
+	}
+	return entries, totalCount, pagingInfo.HasPreviousPage, pagingInfo.HasNextPage, nil
+}
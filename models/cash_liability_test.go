@@ -0,0 +1,41 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+)
+
+func TestWithCashLiabilityLimit(t *testing.T) {
+	liability := withCashLiabilityLimit(&CashLiability{Balance: 500.004}, 500)
+	require.Equal(t, 500.0, liability.Balance)
+	require.Equal(t, 500.0, liability.Limit)
+	require.False(t, liability.CashJobsBlocked)
+
+	require.True(t, withCashLiabilityLimit(&CashLiability{Balance: 500.01}, 500).CashJobsBlocked)
+	//no limit, no blocking
+	require.False(t, withCashLiabilityLimit(&CashLiability{Balance: 5000}, 0).CashJobsBlocked)
+}
+
+func TestCashLiabilityMoveFilter(t *testing.T) {
+	id := primitive.NewObjectID()
+	require.Equal(t, bson.D{{"_id", id}}, cashLiabilityMoveFilter(id, 40))
+	//taking off the balance only matches while the provider owes at least as much
+	require.Equal(t, bson.D{{"_id", id}, {"balance", bson.M{"$gte": 40.0}}}, cashLiabilityMoveFilter(id, -40))
+}
+
+func TestCashLiabilityOffsetKey(t *testing.T) {
+	liability := &CashLiability{ID: primitive.NewObjectID(), Version: 3}
+	key := cashLiabilityOffsetKey(liability)
+	require.Equal(t, "wallet_offset:"+liability.ID.Hex()+":3", key)
+
+	//offsets reading the same balance share a key, the next entry gives a new one
+	require.Equal(t, key, cashLiabilityOffsetKey(&CashLiability{ID: liability.ID, Version: 3, Balance: 10}))
+	liability.Version++
+	require.NotEqual(t, key, cashLiabilityOffsetKey(liability))
+}
@@ -0,0 +1,504 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/cache"
+	"github.com/tribehq/platform/lib/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"math"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrEmptyCart is returned when checking out a cart without items.
+	ErrEmptyCart = errors.New("cart is empty")
+	// ErrCartItemNotAvailable is returned when a cart item refers to a product or variation that no longer exists.
+	ErrCartItemNotAvailable = errors.New("cart item is not available")
+	// ErrDeliveryAddressNotFound is returned when the checkout delivery address doesn't exist.
+	ErrDeliveryAddressNotFound = errors.New("delivery address not found")
+	// ErrCouponNotApplicable is returned when the checkout coupon is unknown, inactive or below its minimum amount.
+	ErrCouponNotApplicable = errors.New("coupon is not applicable")
+)
+
+// storeCheckout is the priced part of a cart sold by one store.
+type storeCheckout struct {
+	store      *Store
+	items      []OrderItem
+	subtotal   float64
+	discount   float64
+	delivery   *DeliveryFee
+	fees       float64
+	tax        *TaxBreakdown
+	total      float64
+	commission float64
+}
+
+// cartPricing is a cart priced for delivery to an address.
+type cartPricing struct {
+	stores     []*storeCheckout
+	address    *Address
+	coupon     *Coupon
+	subtotal   float64
+	discount   float64
+	delivery   float64
+	fees       float64
+	tax        *TaxBreakdown
+	total      float64
+	commission float64
+	taxSetting TaxSetting
+}
+
+// roundAmount rounds an amount to cents.
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// cartOrderItem gives the priced and tax classed order item of a cart item along with the id of the store selling it.
+func cartOrderItem(item CartItem) (OrderItem, string, error) {
+	product := GetProductByID(item.ProductID.Hex())
+	if product == nil || product.ID.IsZero() {
+		return OrderItem{}, "", ErrCartItemNotAvailable
+	}
+	orderItem := OrderItem{
+		ID:          item.ProductID,
+		VariationID: item.VariationID,
+		Name:        product.Name,
+		Quantity:    item.Quantity,
+		Price:       product.Price,
+		TaxClass:    product.TaxClass,
+		TaxStatus:   product.TaxStatus,
+	}
+	if orderItem.Price == 0 {
+		orderItem.Price = product.RegularPrice
+	}
+	if item.VariationID != nil {
+		variation, err := GetProductVariationByID(*item.VariationID)
+		if err != nil || variation == nil {
+			return OrderItem{}, "", ErrCartItemNotAvailable
+		}
+		orderItem.Price = variation.Price
+		if orderItem.Price == 0 {
+			orderItem.Price = variation.RegularPrice
+		}
+		//variations take the tax class of their product unless they set their own
+		if variation.TaxClass != "" && variation.TaxClass != "parent" {
+			orderItem.TaxClass = variation.TaxClass
+		}
+		if variation.TaxStatus != "" {
+			orderItem.TaxStatus = variation.TaxStatus
+		}
+	}
+	return orderItem, product.Store, nil
+}
+
+// couponDiscount gives the discount the coupon grants on subtotal.
+func couponDiscount(coupon *Coupon, subtotal float64) float64 {
+	var discount float64
+	switch coupon.DiscountType {
+	case "percentage":
+		discount = subtotal * coupon.DiscountAmount / 100
+	default:
+		discount = coupon.DiscountAmount
+	}
+	if coupon.MaximumAmount > 0 && discount > coupon.MaximumAmount {
+		discount = coupon.MaximumAmount
+	}
+	return roundAmount(math.Min(discount, subtotal))
+}
+
+// storeCommissionRate gives the commission percentage the marketplace takes from a store,
+// falling back to the market wide admin commission.
+func storeCommissionRate(store *Store, settings *MarketSettings) float64 {
+	if store.CommissionRate > 0 {
+		return store.CommissionRate
+	}
+	if settings != nil {
+		return float64(settings.Store.AdminCommission)
+	}
+	return 0
+}
+
+// priceCart prices the cart for delivery to an address, split by the stores selling its items.
+// The coupon discount is prorated over the stores by their share of the cart and each store
+// charges its own delivery fee, packing charges, tax and commission.
+func priceCart(cart *Cart, deliveryAddressID primitive.ObjectID, couponCode *string) (*cartPricing, error) {
+	if len(cart.Items) == 0 {
+		return nil, ErrEmptyCart
+	}
+	address := GetAddressByID(deliveryAddressID.Hex())
+	if address == nil || address.ID.IsZero() {
+		return nil, ErrDeliveryAddressNotFound
+	}
+	pricing := &cartPricing{address: address, tax: &TaxBreakdown{}}
+
+	//group the cart items by store keeping the order they were added in
+	storesByID := map[string]*storeCheckout{}
+	for _, item := range cart.Items {
+		orderItem, storeID, err := cartOrderItem(item)
+		if err != nil {
+			return nil, err
+		}
+		checkout, ok := storesByID[storeID]
+		if !ok {
+			store := GetStoreByID(storeID)
+			if store == nil || store.ID.IsZero() {
+				return nil, ErrCartItemNotAvailable
+			}
+			checkout = &storeCheckout{store: store}
+			storesByID[storeID] = checkout
+			pricing.stores = append(pricing.stores, checkout)
+		}
+		checkout.items = append(checkout.items, orderItem)
+		checkout.subtotal += orderItem.Price * float64(orderItem.Quantity)
+		pricing.subtotal += orderItem.Price * float64(orderItem.Quantity)
+	}
+
+	if couponCode != nil && *couponCode != "" {
+		var email string
+		if customer := GetUserByID(cart.UserID.Hex()); customer != nil {
+			email = customer.Email
+		}
+		coupon := GetCouponByFilter(bson.D{{"code", *couponCode}, {"isActive", true}})
+		if coupon == nil || coupon.ID.IsZero() || !coupon.usable(time.Now(), cart.UserID, email) || pricing.subtotal < coupon.MinimumAmount {
+			return nil, ErrCouponNotApplicable
+		}
+		pricing.coupon = coupon
+		pricing.discount = couponDiscount(coupon, pricing.subtotal)
+	}
+
+	settings, err := GetCurrentMarketSettings()
+	if err != nil {
+		log.Errorln(err)
+	}
+	if settings != nil {
+		pricing.taxSetting = settings.Tax
+	}
+	taxLocation := TaxLocationOf(address)
+
+	subtotals := make([]float64, len(pricing.stores))
+	for i, checkout := range pricing.stores {
+		subtotals[i] = checkout.subtotal
+	}
+	discounts := prorateDiscount(pricing.discount, subtotals)
+	for i, checkout := range pricing.stores {
+		checkout.discount = discounts[i]
+
+		checkout.delivery, err = CalculateDeliveryFee(checkout.store, address, checkout.subtotal-checkout.discount)
+		if err != nil {
+			return nil, err
+		}
+		if pricing.coupon != nil && pricing.coupon.FreeShipping {
+			checkout.delivery.Amount = 0
+			checkout.delivery.FreeDelivery = true
+			checkout.delivery.MethodTitle = "Free delivery"
+		}
+		checkout.fees = checkout.store.AdditionalPackingCharges
+
+		//every item is taxed on its value less its share of the store discount
+		taxItems := make([]TaxableItem, len(checkout.items))
+		for j, item := range checkout.items {
+			value := item.Price * float64(item.Quantity)
+			if checkout.subtotal > 0 {
+				value -= checkout.discount * value / checkout.subtotal
+			}
+			taxItems[j] = TaxableItem{Amount: value, TaxClass: item.TaxClass, TaxStatus: item.TaxStatus}
+		}
+		var taxFees []TaxableItem
+		if checkout.fees > 0 {
+			taxFees = append(taxFees, TaxableItem{Amount: checkout.fees})
+		}
+		checkout.tax, err = CalculateTax(taxLocation, taxItems, checkout.delivery.Amount, taxFees, pricing.taxSetting)
+		if err != nil {
+			return nil, err
+		}
+		for j := range checkout.items {
+			checkout.items[j].Tax = checkout.tax.ItemTaxes[j]
+		}
+
+		//tax inclusive prices already hold the items tax
+		addedTax := checkout.tax.Total
+		netItems := checkout.subtotal - checkout.discount
+		if pricing.taxSetting.PricesIncludeTax {
+			addedTax -= checkout.tax.ItemsTax
+			netItems -= checkout.tax.ItemsTax
+		}
+		checkout.total = roundAmount(checkout.subtotal - checkout.discount + checkout.delivery.Amount + checkout.fees + addedTax)
+		checkout.commission = roundAmount(netItems * storeCommissionRate(checkout.store, settings) / 100)
+
+		pricing.delivery += checkout.delivery.Amount
+		pricing.fees += checkout.fees
+		pricing.tax.Merge(checkout.tax)
+		pricing.total += checkout.total
+		pricing.commission += checkout.commission
+	}
+	pricing.subtotal = roundAmount(pricing.subtotal)
+	pricing.delivery = roundAmount(pricing.delivery)
+	pricing.fees = roundAmount(pricing.fees)
+	pricing.total = roundAmount(pricing.total)
+	pricing.commission = roundAmount(pricing.commission)
+	return pricing, nil
+}
+
+// prorateDiscount splits a discount over the subtotals by their share of the whole,
+// the last one taking the rounding remainder.
+func prorateDiscount(discount float64, subtotals []float64) []float64 {
+	var total float64
+	for _, subtotal := range subtotals {
+		total += subtotal
+	}
+	discounts := make([]float64, len(subtotals))
+	remaining := discount
+	for i, subtotal := range subtotals {
+		discounts[i] = remaining
+		if i < len(subtotals)-1 && total > 0 {
+			discounts[i] = roundAmount(discount * subtotal / total)
+		}
+		remaining = roundAmount(remaining - discounts[i])
+	}
+	return discounts
+}
+
+// checkoutCouponLines gives the coupon line of an order carrying part of the coupon discount.
+func checkoutCouponLines(coupon *Coupon, discount float64) CouponLines {
+	return CouponLines{ID: coupon.ID, Code: coupon.Code, Discount: strconv.FormatFloat(discount, 'f', 2, 64)}
+}
+
+// GetCartBreakdown gives the price breakdown of the cart delivered to an address, per store and in total.
+func GetCartBreakdown(cart *Cart, deliveryAddressID primitive.ObjectID, coupon *string) (*CartBreakdown, error) {
+	pricing, err := priceCart(cart, deliveryAddressID, coupon)
+	if err != nil {
+		return nil, err
+	}
+	breakdown := &CartBreakdown{
+		Subtotal:    pricing.subtotal,
+		Discount:    pricing.discount,
+		DeliveryFee: pricing.delivery,
+		Fees:        pricing.fees,
+		Tax:         pricing.tax.Total,
+		Total:       pricing.total,
+		TaxLines:    pricing.tax.TaxLines(),
+	}
+	for _, checkout := range pricing.stores {
+		store := &CartStoreBreakdown{
+			StoreID:      checkout.store.ID,
+			Subtotal:     roundAmount(checkout.subtotal),
+			Discount:     checkout.discount,
+			DeliveryFee:  checkout.delivery.Amount,
+			FreeDelivery: checkout.delivery.FreeDelivery,
+			Fees:         checkout.fees,
+			Tax:          checkout.tax.Total,
+			Total:        checkout.total,
+		}
+		if checkout.delivery.Distance >= 0 {
+			distance := roundAmount(checkout.delivery.Distance)
+			store.Distance = &distance
+			store.DistanceUnit = &checkout.delivery.DistanceUnit
+		}
+		breakdown.Stores = append(breakdown.Stores, store)
+	}
+	return breakdown, nil
+}
+
+// holdDeliverySlots checks every store takes the order now or at the scheduled time and holds the delivery slots chosen.
+func holdDeliverySlots(pricing *cartPricing, input CheckoutInput) ([]*OrderDeliverySlot, error) {
+	now := time.Now()
+	slots := make([]*OrderDeliverySlot, len(pricing.stores))
+	for i, checkout := range pricing.stores {
+		err := GetStoreHours(checkout.store).AcceptOrder(now, input.ScheduledFor)
+		if err == nil {
+			for _, slot := range input.DeliverySlots {
+				if slot.StoreID == checkout.store.ID {
+					slots[i], err = ReserveDeliverySlot(checkout.store, slot.Start)
+					break
+				}
+			}
+		}
+		if err != nil {
+			releaseDeliverySlots(pricing, slots)
+			return nil, err
+		}
+	}
+	return slots, nil
+}
+
+// releaseDeliverySlots gives back the delivery slots held for a checkout that didn't go through.
+func releaseDeliverySlots(pricing *cartPricing, slots []*OrderDeliverySlot) {
+	for i, slot := range slots {
+		if slot != nil {
+			_ = ReleaseDeliverySlot(pricing.stores[i].store.ID, slot)
+		}
+	}
+}
+
+// CheckoutCart places the cart as a parent order with one child order per store.
+// Each child order carries the delivery fee, tax and commission of its store as priced by priceCart
+// and the parent order holds the totals of its children. Stores have to be open, or open at the scheduled
+// time when the order is scheduled, and chosen delivery slots must have room.
+func CheckoutCart(cart *Cart, input CheckoutInput) (*Order, error) {
+	pricing, err := priceCart(cart, input.DeliveryAddressID, input.Coupon)
+	if err != nil {
+		return nil, err
+	}
+	slots, err := holdDeliverySlots(pricing, input)
+	if err != nil {
+		return nil, err
+	}
+
+	paymentMethod := PaymentMethod{Name: input.PaymentMethodTitle, Type: input.PaymentMethod, UserID: cart.UserID.Hex()}
+	parent := Order{
+		CreatedBy:          cart.UserID,
+		CustomerID:         cart.UserID,
+		DeliveryAddress:    *pricing.address,
+		Billing:            Billing(*input.Billing),
+		Shipping:           Shipping(*input.Shipping),
+		PaymentMethod:      paymentMethod,
+		PaymentMethodTitle: input.PaymentMethodTitle,
+		CreatedVia:         "checkout",
+		PricesIncludeTax:   pricing.taxSetting.PricesIncludeTax,
+		ScheduledFor:       input.ScheduledFor,
+		IsActive:           true,
+	}
+	if input.CustomerNote != nil {
+		parent.CustomerNote = *input.CustomerNote
+	}
+	if pricing.coupon != nil {
+		parent.Coupon = pricing.coupon.Code
+		parent.CouponLines = checkoutCouponLines(pricing.coupon, pricing.discount)
+	}
+
+	children := make([]Order, len(pricing.stores))
+	for i, checkout := range pricing.stores {
+		child := parent
+		child.StoreID = checkout.store.ID
+		child.ServiceType = string(checkout.store.ServiceCategory)
+		child.OrderItems = checkout.items
+		child.DiscountAmount = checkout.discount
+		//every child only carries its store's share of the coupon discount
+		if pricing.coupon != nil {
+			child.CouponLines = checkoutCouponLines(pricing.coupon, checkout.discount)
+		}
+		child.ShippingTotal = checkout.delivery.Amount
+		child.ShippingLine = checkout.delivery.ShippingLines(checkout.tax.ShippingTax)
+		child.CartTax = roundAmount(checkout.tax.ItemsTax + checkout.tax.FeesTax)
+		child.ShippingTax = checkout.tax.ShippingTax
+		child.TotalTax = checkout.tax.Total
+		child.TaxLines = checkout.tax.TaxLines()
+		child.OrderTotalAmount = checkout.total
+		child.Commission = checkout.commission
+		child.DeliverySlot = slots[i]
+		if checkout.fees > 0 {
+			child.FeeLines = FeeLines{
+				ID:       primitive.NewObjectID(),
+				Name:     "Packing charges",
+				Total:    strconv.FormatFloat(checkout.fees, 'f', 2, 64),
+				TotalTax: strconv.FormatFloat(checkout.tax.FeeTaxes[0], 'f', 2, 64),
+			}
+		}
+		children[i] = child
+		parent.OrderItems = append(parent.OrderItems, child.OrderItems...)
+	}
+	parent.DiscountAmount = pricing.discount
+	parent.ShippingTotal = pricing.delivery
+	parent.ShippingLine = ShippingLines{
+		ID:          1,
+		MethodTitle: "Delivery",
+		MethodID:    "split",
+		Total:       strconv.FormatFloat(pricing.delivery, 'f', 2, 64),
+		TotalTax:    strconv.FormatFloat(pricing.tax.ShippingTax, 'f', 2, 64),
+		MetaData:    []string{},
+		Taxes:       []string{},
+	}
+	parent.CartTax = roundAmount(pricing.tax.ItemsTax + pricing.tax.FeesTax)
+	parent.ShippingTax = pricing.tax.ShippingTax
+	parent.TotalTax = pricing.tax.Total
+	parent.TaxLines = pricing.tax.TaxLines()
+	parent.OrderTotalAmount = pricing.total
+	parent.Commission = pricing.commission
+
+	if pricing.coupon != nil {
+		err = redeemCoupon(pricing.coupon, cart.UserID)
+		if err != nil {
+			releaseDeliverySlots(pricing, slots)
+			return nil, err
+		}
+	}
+	//a checkout failing halfway gives back what it held and discards the orders it placed
+	var placed []primitive.ObjectID
+	rollback := func() {
+		discardCheckoutOrders(placed)
+		releaseDeliverySlots(pricing, slots)
+		if pricing.coupon != nil {
+			releaseCoupon(pricing.coupon, cart.UserID)
+		}
+	}
+	order, err := CreateOrder(parent)
+	if err != nil {
+		rollback()
+		return nil, err
+	}
+	placed = append(placed, order.ID)
+	for _, child := range children {
+		child.ParentID = order.ID
+		childOrder, err := CreateOrder(child)
+		if err != nil {
+			rollback()
+			return nil, err
+		}
+		placed = append(placed, childOrder.ID)
+		order.ChildOrders = append(order.ChildOrders, childOrder.ID)
+	}
+	order, err = UpdateOrder(order)
+	if err != nil {
+		rollback()
+		return nil, err
+	}
+
+	markCartCheckedOut(cart, order)
+	_, err = DeleteCartByID(cart.ID.Hex())
+	if err != nil {
+		log.Errorln(err)
+	}
+	return order, nil
+}
+
+// discardCheckoutOrders removes the orders placed by a checkout that didn't go through.
+func discardCheckoutOrders(ids []primitive.ObjectID) {
+	if len(ids) == 0 {
+		return
+	}
+	update := bson.D{{"$set", bson.D{{"deletedAt", time.Now()}, {"isActive", false}, {"orderStatus", OrderStatusFailed}}}}
+	_, err := database.MongoDB.Collection(OrdersCollection).UpdateMany(context.Background(), bson.D{{"_id", bson.M{"$in": ids}}}, update)
+	if err != nil {
+		log.Errorln(err)
+	}
+	for _, id := range ids {
+		err = cache.RedisClient.Del(id.Hex()).Err()
+		if err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+// GetChildOrders gives the per store orders of a parent order.
+func GetChildOrders(order *Order) []*Order {
+	var children []*Order
+	for _, id := range order.ChildOrders {
+		child, err := GetOrderByID(id.Hex())
+		if err != nil {
+			log.Errorln(err)
+			continue
+		}
+		if child != nil {
+			children = append(children, child)
+		}
+	}
+	return children
+}
@@ -0,0 +1,49 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+)
+
+func TestCouponDiscount(t *testing.T) {
+	percentage := &Coupon{DiscountType: "percentage", DiscountAmount: 10, MaximumAmount: 15}
+	require.Equal(t, 10.0, couponDiscount(percentage, 100))
+	require.Equal(t, 15.0, couponDiscount(percentage, 300))
+
+	fixed := &Coupon{DiscountType: "fixed_cart", DiscountAmount: 50}
+	require.Equal(t, 50.0, couponDiscount(fixed, 120))
+	require.Equal(t, 20.0, couponDiscount(fixed, 20))
+}
+
+func TestProrateDiscount(t *testing.T) {
+	t.Run("splits by the share of the subtotal", func(t *testing.T) {
+		require.Equal(t, []float64{2.5, 7.5}, prorateDiscount(10, []float64{25, 75}))
+	})
+	t.Run("the last share takes the rounding remainder", func(t *testing.T) {
+		discounts := prorateDiscount(10, []float64{10, 10, 10})
+		require.Equal(t, []float64{3.33, 3.33, 3.34}, discounts)
+	})
+	t.Run("shares add up to the discount", func(t *testing.T) {
+		var total float64
+		for _, discount := range prorateDiscount(17.77, []float64{13.4, 99.99, 0.51, 42}) {
+			total += discount
+		}
+		require.Equal(t, 17.77, roundAmount(total))
+	})
+	t.Run("a single store takes the whole discount", func(t *testing.T) {
+		require.Equal(t, []float64{5}, prorateDiscount(5, []float64{40}))
+	})
+}
+
+func TestCheckoutCouponLines(t *testing.T) {
+	coupon := &Coupon{ID: primitive.NewObjectID(), Code: "SAVE10"}
+	lines := checkoutCouponLines(coupon, 3.5)
+	require.Equal(t, coupon.ID, lines.ID)
+	require.Equal(t, "SAVE10", lines.Code)
+	require.Equal(t, "3.50", lines.Discount)
+}
@@ -57,13 +57,30 @@ const (
 	SubscriptionsCollection                   = "subscriptions"
 	WalletsCollection                         = "wallets"
 	WalletTransactionsCollection              = "transactions"
+	WalletPostingsCollection                  = "wallet_postings"
+	WalletHoldsCollection                     = "wallet_holds"
+	CashLiabilitiesCollection                 = "cash_liabilities"
+	CashLiabilityEntriesCollection            = "cash_liability_entries"
 	OrderNotesCollection                      = "order_notes"
+	OrderRefundsCollection                    = "order_refunds"
+	TaxRulesCollection                        = "tax_rules"
+	DeliverySlotReservationsCollection        = "delivery_slot_reservations"
+	ProductSearchIndexCollection              = "product_search_index"
+	SearchSynonymsCollection                  = "search_synonyms"
+	ProductImportJobsCollection               = "product_import_jobs"
+	DownloadGrantsCollection                  = "download_grants"
+	DownloadLogsCollection                    = "download_logs"
+	PriceRulesCollection                      = "price_rules"
+	SubscriptionPlansCollection               = "subscription_plans"
+	SubscriptionInvoicesCollection            = "subscription_invoices"
+	SubscriptionUsageRecordsCollection        = "subscription_usage_records"
 	InvoiceCollection                         = "invoices"
 	BINDataCollection                         = "card_bin_data"
 	MerchantPromotionsCollection              = "merchant_promotions"
 	UserAuditLogsCollection                   = "users_audit_logs"
 	ChangePasswordRequestsCollection          = "users_change_password_requests"
 	PaymentsCollection                        = "payments"
+	PaymentEventsCollection                   = "payment_events"
 	MerchantsCollection                       = "merchants"
 	UserRewardsTransactionsCollection         = "rewards_transactions"
 	InstallationsCollection                   = "installations"
@@ -71,6 +88,7 @@ const (
 	WebhookLogsCollection                     = "webhooks_logs"
 	SettlementsCollection                     = "settlements"
 	UPIVPACollection                          = "upi_vpas"
+	UPITransactionsCollection                 = "upi_transactions"
 	NotificationsCollection                   = "notifications"
 	EmailTemplateCollection                   = "email_templates"
 	SMSTemplateCollection                     = "sms_templates"
@@ -78,6 +96,7 @@ const (
 	StoresCollection                          = "stores"
 	StoreVehicleTypesCollection               = "store_vehicle_types"
 	UserPaymentMethodsCollection              = "user_payment_methods"
+	LinkedWalletsCollection                   = "linked_wallets"
 	PaymentMethodsCollection                  = "payment_methods"
 	CardsCollection                           = "cards"
 	CampaignsCollection                       = "campaigns"
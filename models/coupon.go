@@ -16,6 +16,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
 	"time"
 )
 
@@ -50,6 +51,7 @@ type Coupon struct {
 	MinimumAmount             float64              `json:"minimumAmount"`
 	MaximumAmount             float64              `json:"maximumAmount"`
 	EmailRestrictions         []string             `json:"emailRestrictions"`
+	CustomerRestrictions      []primitive.ObjectID `json:"customerRestrictions"` //customers who may use the coupon, anyone when empty
 	UsedBy                    []primitive.ObjectID `json:"usedBy"`
 	MetaData                  MetaData             `json:"metaData"`
 }
@@ -231,6 +233,89 @@ func DeleteCouponByID(ID string) (bool, error) {
 	return true, nil
 }
 
+// usable tells whether a coupon is within its validity, may be used by the customer and has uses left.
+func (coupon *Coupon) usable(now time.Time, customerID primitive.ObjectID, email string) bool {
+	if !coupon.ValidityStart.IsZero() && now.Before(coupon.ValidityStart) {
+		return false
+	}
+	if !coupon.ValidityExpire.IsZero() && now.After(coupon.ValidityExpire) {
+		return false
+	}
+	if !coupon.allowsCustomer(customerID) || !coupon.allowsEmail(email) {
+		return false
+	}
+	return coupon.UsageLimit <= 0 || coupon.UsedLimit < coupon.UsageLimit
+}
+
+// allowsCustomer tells whether a customer may use a coupon restricted to some customers.
+func (coupon *Coupon) allowsCustomer(customerID primitive.ObjectID) bool {
+	if len(coupon.CustomerRestrictions) == 0 {
+		return true
+	}
+	for _, restriction := range coupon.CustomerRestrictions {
+		if !customerID.IsZero() && restriction == customerID {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsEmail tells whether a customer email may use a coupon restricted to some emails.
+// Restrictions starting with "*" match any email ending with the rest, like "*@tribe.cab".
+func (coupon *Coupon) allowsEmail(email string) bool {
+	if len(coupon.EmailRestrictions) == 0 {
+		return true
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return false
+	}
+	for _, restriction := range coupon.EmailRestrictions {
+		restriction = strings.ToLower(strings.TrimSpace(restriction))
+		if restriction == email || (strings.HasPrefix(restriction, "*") && strings.HasSuffix(email, restriction[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+// redeemCoupon counts a use of a coupon by a customer, failing when the coupon was used up in the meantime.
+func redeemCoupon(coupon *Coupon, customerID primitive.ObjectID) error {
+	filter := bson.D{{"_id", coupon.ID}}
+	if coupon.UsageLimit > 0 {
+		filter = append(filter, bson.E{"usedLimit", bson.M{"$lt": coupon.UsageLimit}})
+	}
+	update := bson.D{{"$inc", bson.D{{"usedLimit", 1}}}, {"$push", bson.D{{"usedby", customerID}}}}
+	res, err := database.MongoDB.Collection(CouponCollection).UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		log.Errorln(err)
+		return err
+	}
+	if res.ModifiedCount < 1 {
+		return ErrCouponNotApplicable
+	}
+	err = cache.RedisClient.Del(coupon.ID.Hex()).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	return nil
+}
+
+// releaseCoupon gives back a use of a coupon for a checkout that didn't go through.
+func releaseCoupon(coupon *Coupon, customerID primitive.ObjectID) {
+	//only a use the customer made is given back, so the count never drops below the uses recorded
+	filter := bson.D{{"_id", coupon.ID}, {"usedby", customerID}, {"usedLimit", bson.M{"$gt": 0}}}
+	update := bson.D{{"$inc", bson.D{{"usedLimit", -1}}}, {"$pull", bson.D{{"usedby", customerID}}}}
+	_, err := database.MongoDB.Collection(CouponCollection).UpdateOne(context.Background(), filter, update)
+	if err != nil {
+		log.Errorln(err)
+	}
+	err = cache.RedisClient.Del(coupon.ID.Hex()).Err()
+	if err != nil {
+		log.Error(err)
+	}
+}
+
 //UnmarshalBinary required for the redis cache to work
 func (coupon *Coupon) UnmarshalBinary(data []byte) error {
 	if err := json.Unmarshal(data, coupon); err != nil {
@@ -95,6 +95,21 @@ func GetCurrencyByID(ID string) (*Currency, error) {
 	return currency, nil
 }
 
+// GetDefaultCurrency gives the active currency marked as the default, nil when none is.
+func GetDefaultCurrency() (*Currency, error) {
+	currency := &Currency{}
+	filter := bson.D{{"isDefault", true}, {"isActive", true}, {"deletedAt", bson.M{"$exists": false}}}
+	err := database.MongoDB.Collection(CurrenciesCollection).FindOne(context.Background(), filter).Decode(currency)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	return currency, nil
+}
+
 // GetCurrencies gives an array of currencies.
 func GetCurrencies(filter bson.D, limit int, after *string, before *string, first *int, last *int) (currencies []*Currency, totalCount int64, hasPrevious, hasNext bool, err error) {
 
@@ -94,6 +94,23 @@ func GetDeliveryChargeByID(ID string) (*DeliveryCharge, error) {
 	return deliveryCharge, nil
 }
 
+// GetDeliveryChargeByFilter gives the delivery charge matching the filter.
+func GetDeliveryChargeByFilter(filter bson.D) (*DeliveryCharge, error) {
+	db := database.MongoDB
+	deliveryCharge := &DeliveryCharge{}
+	filter = append(filter, bson.E{"deletedAt", bson.M{"$exists": false}}) // we dont want deleted documents
+	ctx := context.Background()
+	err := db.Collection(DeliveryChargesCollection).FindOne(ctx, filter).Decode(&deliveryCharge)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	return deliveryCharge, nil
+}
+
 // GetDeliveryCharges gives an array of delivery charges.
 func GetDeliveryCharges(filter bson.D, limit int, after *string, before *string, first *int, last *int) (deliveryCharges []*DeliveryCharge, totalCount int64, hasPrevious, hasNext bool, err error) {
 
@@ -94,6 +94,23 @@ func GetDeliveryChargesUtilityByID(ID string) (*DeliveryChargesUtility, error) {
 	return deliveryChargesUtility, nil
 }
 
+// GetDeliveryChargesUtilityByFilter returns the delivery charge utility matching the filter.
+func GetDeliveryChargesUtilityByFilter(filter bson.D) (*DeliveryChargesUtility, error) {
+	db := database.MongoDB
+	deliveryChargesUtility := &DeliveryChargesUtility{}
+	filter = append(filter, bson.E{"deletedAt", bson.M{"$exists": false}}) // we dont want deleted documents
+	ctx := context.Background()
+	err := db.Collection(DeliveryChargeUtilitiesCollection).FindOne(ctx, filter).Decode(&deliveryChargesUtility)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	return deliveryChargesUtility, nil
+}
+
 // GetDeliveryChargesUtilities returns a list of delivery charge utilities.
 func GetDeliveryChargesUtilities(filter bson.D, limit int, after *string, before *string, first *int, last *int) (deliveryChargesUtilities []*DeliveryChargesUtility, totalCount int64, hasPrevious, hasNext bool, err error) {
 
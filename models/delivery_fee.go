@@ -0,0 +1,192 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"math"
+	"strconv"
+)
+
+const (
+	earthRadiusKms = 6371.0
+	kmsPerMile     = 1.609344
+)
+
+// ErrNoDeliveryRule is returned when no delivery charge rule covers the city of the delivery address.
+var ErrNoDeliveryRule = errors.New("delivery isn't available to this city")
+
+// DeliveryFee is the delivery fee of a store order along with the rule it was worked out with.
+type DeliveryFee struct {
+	Amount       float64
+	Distance     float64 // from the store to the delivery address in the distance unit of the address' country, -1 when unknown
+	DistanceUnit DistanceUnits
+	FreeDelivery bool
+	RuleID       primitive.ObjectID
+	MethodID     string
+	MethodTitle  string
+}
+
+// deliveryRule is a delivery charge rule, either a DeliveryCharge or a DeliveryChargesUtility.
+type deliveryRule struct {
+	id                   primitive.ObjectID
+	methodID             string
+	orderPrice           float64
+	chargeAboveAmount    float64
+	chargeBelowAmount    float64
+	freeDeliveryAmount   float64
+	freeDeliveryDistance float64
+}
+
+// CalculateDeliveryFee works out the delivery fee of a store order of subtotal delivered to address.
+// The delivery charge of the address' city is used, falling back to its delivery charge utility. Delivery is free
+// within the rule's free delivery radius of the store or from its free delivery order amount, otherwise the charge
+// depends on whether the subtotal reaches the rule's order price. Cities without a rule aren't delivered to.
+func CalculateDeliveryFee(store *Store, address *Address, subtotal float64) (*DeliveryFee, error) {
+	distance := -1.0
+	unit := deliveryDistanceUnit(address)
+	if origin := storeOrigin(store); origin != nil && hasCoordinates(address) {
+		distance = distanceBetween(origin, address, unit)
+	}
+	rule, err := findDeliveryRule(address)
+	if err != nil {
+		return nil, err
+	}
+	return deliveryFeeFor(rule, distance, unit, subtotal)
+}
+
+// deliveryFeeFor works out the delivery fee of a subtotal delivered a distance from the store, -1 when unknown, by a rule.
+func deliveryFeeFor(rule *deliveryRule, distance float64, unit DistanceUnits, subtotal float64) (*DeliveryFee, error) {
+	if rule == nil {
+		return nil, ErrNoDeliveryRule
+	}
+	fee := &DeliveryFee{
+		Distance:     distance,
+		DistanceUnit: unit,
+		FreeDelivery: true,
+		RuleID:       rule.id,
+		MethodID:     rule.methodID,
+		MethodTitle:  "Free delivery",
+	}
+	switch {
+	case rule.freeDeliveryDistance > 0 && fee.Distance >= 0 && fee.Distance <= rule.freeDeliveryDistance:
+		//within the free delivery radius
+	case rule.freeDeliveryAmount > 0 && subtotal >= rule.freeDeliveryAmount:
+		//order is large enough for free delivery
+	case subtotal >= rule.orderPrice:
+		fee.Amount = rule.chargeAboveAmount
+	default:
+		fee.Amount = rule.chargeBelowAmount
+	}
+	if fee.Amount > 0 {
+		fee.FreeDelivery = false
+		fee.MethodTitle = "Delivery"
+	}
+	return fee, nil
+}
+
+// ShippingLines gives the delivery fee as the shipping line of an order.
+func (fee *DeliveryFee) ShippingLines(tax float64) ShippingLines {
+	metaData := []string{}
+	if fee.Distance >= 0 {
+		metaData = append(metaData, "distance:"+strconv.FormatFloat(fee.Distance, 'f', 2, 64)+" "+string(fee.DistanceUnit))
+	}
+	if !fee.RuleID.IsZero() {
+		metaData = append(metaData, "rule:"+fee.RuleID.Hex())
+	}
+	return ShippingLines{
+		ID:          1,
+		MethodTitle: fee.MethodTitle,
+		MethodID:    fee.MethodID,
+		Total:       strconv.FormatFloat(fee.Amount, 'f', 2, 64),
+		TotalTax:    strconv.FormatFloat(tax, 'f', 2, 64),
+		MetaData:    metaData,
+		Taxes:       []string{},
+	}
+}
+
+// findDeliveryRule gives the delivery charge rule of the address' city.
+func findDeliveryRule(address *Address) (*deliveryRule, error) {
+	city := address.City.CityName
+	deliveryCharge, err := GetDeliveryChargeByFilter(bson.D{{"locationName", city}, {"isActive", true}})
+	if err != nil {
+		return nil, err
+	}
+	if deliveryCharge != nil {
+		return &deliveryRule{
+			id:                   deliveryCharge.ID,
+			methodID:             "delivery_charge",
+			orderPrice:           float64(deliveryCharge.OrderPrice),
+			chargeAboveAmount:    float64(deliveryCharge.OrderDeliveryChargesAboveAmount),
+			chargeBelowAmount:    float64(deliveryCharge.OrderDeliveryChargesBelowAmount),
+			freeDeliveryAmount:   float64(deliveryCharge.FreeOrderDeliveryCharges),
+			freeDeliveryDistance: float64(deliveryCharge.FreeDeliveryRadius),
+		}, nil
+	}
+	utility, err := GetDeliveryChargesUtilityByFilter(bson.D{{"location", city}, {"isActive", true}})
+	if err != nil {
+		return nil, err
+	}
+	if utility != nil {
+		return &deliveryRule{
+			id:                   utility.ID,
+			methodID:             "delivery_charges_utility",
+			orderPrice:           float64(utility.OrderPrice),
+			chargeAboveAmount:    float64(utility.OrderDeliveryChargesAboveAmout),
+			chargeBelowAmount:    float64(utility.OrderDeliveryChargesBelowAmount),
+			freeDeliveryAmount:   float64(utility.FreeOrderDeliveryCharges),
+			freeDeliveryDistance: float64(utility.FreeDeliveryRadius),
+		}, nil
+	}
+	return nil, nil
+}
+
+// storeOrigin gives the address orders of a store are delivered from.
+func storeOrigin(store *Store) *Address {
+	if hasCoordinates(&store.StoreLocation.StoreAddress) {
+		return &store.StoreLocation.StoreAddress
+	}
+	if hasCoordinates(&store.StoreAddress) {
+		return &store.StoreAddress
+	}
+	return nil
+}
+
+// hasCoordinates tells whether an address has been located.
+func hasCoordinates(address *Address) bool {
+	return address.Latitude != 0 || address.Longitute != 0
+}
+
+// deliveryDistanceUnit gives the distance unit of the address' country, falling back to the market default.
+func deliveryDistanceUnit(address *Address) DistanceUnits {
+	unit := DistanceUnits(address.Country.DistanceUnit)
+	if unit.IsValid() {
+		return unit
+	}
+	settings, err := GetCurrentMarketSettings()
+	if err != nil {
+		log.Errorln(err)
+	}
+	if settings != nil && settings.General.DefaultDistanceUnit.IsValid() {
+		return settings.General.DefaultDistanceUnit
+	}
+	return DistanceUnitsKms
+}
+
+// distanceBetween gives the great circle distance between two addresses.
+func distanceBetween(from *Address, to *Address, unit DistanceUnits) float64 {
+	lat1, lat2 := from.Latitude*math.Pi/180, to.Latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (to.Longitute - from.Longitute) * math.Pi / 180
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	distance := 2 * earthRadiusKms * math.Asin(math.Min(1, math.Sqrt(h)))
+	if unit == DistanceUnitsMiles {
+		distance /= kmsPerMile
+	}
+	return distance
+}
@@ -0,0 +1,61 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+)
+
+func TestDeliveryFeeFor(t *testing.T) {
+	rule := &deliveryRule{
+		id:                   primitive.NewObjectID(),
+		methodID:             "delivery_charge",
+		orderPrice:           500,
+		chargeAboveAmount:    20,
+		chargeBelowAmount:    40,
+		freeDeliveryAmount:   1000,
+		freeDeliveryDistance: 3,
+	}
+	tests := []struct {
+		name     string
+		distance float64
+		subtotal float64
+		amount   float64
+	}{
+		{"within the free delivery radius", 2.5, 100, 0},
+		{"on the edge of the free delivery radius", 3, 100, 0},
+		{"beyond the radius below the order price", 8, 100, 40},
+		{"beyond the radius above the order price", 8, 600, 20},
+		{"unknown distance", -1, 100, 40},
+		{"free above the free delivery amount", 8, 1000, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fee, err := deliveryFeeFor(rule, test.distance, DistanceUnitsKms, test.subtotal)
+			require.NoError(t, err)
+			require.Equal(t, test.amount, fee.Amount)
+			require.Equal(t, test.amount == 0, fee.FreeDelivery)
+			require.Equal(t, rule.id, fee.RuleID)
+			require.Equal(t, "delivery_charge", fee.MethodID)
+			require.Equal(t, test.distance, fee.Distance)
+		})
+	}
+
+	t.Run("no rule for the city", func(t *testing.T) {
+		_, err := deliveryFeeFor(nil, 2, DistanceUnitsKms, 100)
+		require.Equal(t, ErrNoDeliveryRule, err)
+	})
+}
+
+func TestDistanceBetween(t *testing.T) {
+	from := &Address{Latitude: 17.385, Longitute: 78.4867}
+	to := &Address{Latitude: 17.4401, Longitute: 78.3489}
+	kms := distanceBetween(from, to, DistanceUnitsKms)
+	require.InDelta(t, 15.8, kms, 0.2)
+	require.InDelta(t, kms/kmsPerMile, distanceBetween(from, to, DistanceUnitsMiles), 0.001)
+	require.Equal(t, 0.0, distanceBetween(from, from, DistanceUnitsKms))
+}
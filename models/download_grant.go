@@ -0,0 +1,384 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/database"
+	"github.com/tribehq/platform/utils/webhooks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// DownloadURLLifetime is how long a signed download url stays valid.
+const DownloadURLLifetime = 5 * time.Minute
+
+var (
+	ErrDownloadRevoked         = errors.New("download access has been revoked")
+	ErrDownloadExpired         = errors.New("download access has expired")
+	ErrDownloadLimitReached    = errors.New("download limit reached")
+	ErrInvalidDownloadURL      = errors.New("invalid or expired download link")
+	ErrDownloadURLNotConfigure = errors.New("download links are not configured")
+)
+
+// DownloadGrant is a buyer's access to a file of a downloadable product they paid for.
+// A download limit of zero or less allows unlimited downloads.
+type DownloadGrant struct {
+	ID               primitive.ObjectID  `json:"id,omitempty" bson:"_id,omitempty"`
+	CreatedAt        time.Time           `json:"createdAt" bson:"createdAt"`
+	UpdatedAt        time.Time           `json:"updatedAt" bson:"updatedAt"`
+	OrderID          primitive.ObjectID  `json:"orderID" bson:"orderID"`
+	StoreID          primitive.ObjectID  `json:"storeID" bson:"storeID"`
+	CustomerID       primitive.ObjectID  `json:"customerID" bson:"customerID"`
+	ProductID        primitive.ObjectID  `json:"productID" bson:"productID"`
+	VariationID      *primitive.ObjectID `json:"variationID" bson:"variationID"`
+	DownloadKey      string              `json:"-" bson:"downloadKey"`
+	Name             string              `json:"name" bson:"name"`
+	FileURL          string              `json:"-" bson:"fileURL"`
+	DownloadLimit    int                 `json:"downloadLimit" bson:"downloadLimit"`
+	DownloadCount    int                 `json:"downloadCount" bson:"downloadCount"`
+	ExpiresAt        *time.Time          `json:"expiresAt" bson:"expiresAt"`
+	RevokedAt        *time.Time          `json:"revokedAt" bson:"revokedAt"`
+	LastDownloadedAt *time.Time          `json:"lastDownloadedAt" bson:"lastDownloadedAt"`
+}
+
+// DownloadLog records a download of a granted file.
+type DownloadLog struct {
+	ID         primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt"`
+	GrantID    primitive.ObjectID `json:"grantID" bson:"grantID"`
+	OrderID    primitive.ObjectID `json:"orderID" bson:"orderID"`
+	CustomerID primitive.ObjectID `json:"customerID" bson:"customerID"`
+	IPAddress  string             `json:"ipAddress" bson:"ipAddress"`
+	UserAgent  string             `json:"userAgent" bson:"userAgent"`
+}
+
+// GrantOrderDownloads grants the buyer of a paid order access to the files of its downloadable items.
+// Granting again leaves existing grants as they are.
+func GrantOrderDownloads(order *Order) error {
+	collection := database.MongoDB.Collection(DownloadGrantsCollection)
+	ctx := context.Background()
+	for _, item := range order.OrderItems {
+		product := GetProductByID(item.ID.Hex())
+		if product.ID.IsZero() {
+			continue
+		}
+		downloadable, downloads := product.Downloadable, product.Downloads
+		downloadLimit, downloadExpiry := product.DownloadLimit, product.DownloadExpiry
+		if item.VariationID != nil && !item.VariationID.IsZero() {
+			variation, err := GetProductVariationByID(*item.VariationID)
+			if err != nil {
+				return err
+			}
+			if variation != nil {
+				downloadable, downloads = variation.Downloadable, variation.Downloads
+				downloadLimit, downloadExpiry = variation.DownloadLimit, variation.DownloadExpiry
+			}
+		}
+		if !downloadable {
+			continue
+		}
+		for _, download := range downloads {
+			if download.File == "" {
+				continue
+			}
+			key := download.File
+			if !download.ID.IsZero() {
+				key = download.ID.Hex()
+			}
+			grant := DownloadGrant{
+				ID:            primitive.NewObjectID(),
+				CreatedAt:     time.Now(),
+				UpdatedAt:     time.Now(),
+				OrderID:       order.ID,
+				StoreID:       order.StoreID,
+				CustomerID:    order.CustomerID,
+				ProductID:     product.ID,
+				VariationID:   item.VariationID,
+				DownloadKey:   key,
+				Name:          download.Name,
+				FileURL:       download.File,
+				DownloadLimit: downloadLimit,
+			}
+			if downloadExpiry > 0 {
+				paidAt := order.DatePaid
+				if paidAt.IsZero() {
+					paidAt = time.Now()
+				}
+				expiresAt := paidAt.AddDate(0, 0, downloadExpiry)
+				grant.ExpiresAt = &expiresAt
+			}
+			filter := bson.D{{"orderID", order.ID}, {"productID", product.ID}, {"variationID", item.VariationID}, {"downloadKey", key}}
+			res, err := collection.UpdateOne(ctx, filter, bson.D{{"$setOnInsert", grant}}, options.Update().SetUpsert(true))
+			if err != nil {
+				log.Errorln(err)
+				return err
+			}
+			if res.UpsertedCount > 0 {
+				go webhooks.NewWebhookEvent("download_grant.created", &grant)
+			}
+		}
+	}
+	return nil
+}
+
+// RevokeOrderDownloads revokes every download grant of an order.
+func RevokeOrderDownloads(orderID primitive.ObjectID) error {
+	now := time.Now()
+	filter := bson.D{{"orderID", orderID}, {"revokedAt", nil}}
+	_, err := database.MongoDB.Collection(DownloadGrantsCollection).UpdateMany(context.Background(), filter, bson.D{{"$set", bson.D{{"revokedAt", now}, {"updatedAt", now}}}})
+	return err
+}
+
+// GetDownloadGrantByID gives download grant by id.
+// Grants aren't cached as their download counts keep changing.
+func GetDownloadGrantByID(ID string) (*DownloadGrant, error) {
+	grant := &DownloadGrant{}
+	id, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return nil, err
+	}
+	err = database.MongoDB.Collection(DownloadGrantsCollection).FindOne(context.Background(), bson.D{{"_id", id}}).Decode(&grant)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	return grant, nil
+}
+
+// GetDownloadGrants gives a list of download grants.
+func GetDownloadGrants(filter bson.D, limit int, after *string, before *string, first *int, last *int) (grants []*DownloadGrant, totalCount int64, hasPrevious, hasNext bool, err error) {
+
+	db := database.MongoDB
+
+	tcint, filter, err := calcTotalCountWithQueryFilters(DownloadGrantsCollection, filter, after, before)
+	pagingInfo, err := PaginationUtility(after, before, first, last, &tcint)
+	if err != nil {
+		return
+	}
+	pagingInfo.QueryOpts.SetSort(bson.M{"_id": -1})
+
+	cur, err := db.Collection(DownloadGrantsCollection).Find(context.Background(), filter, &pagingInfo.QueryOpts)
+	if err != nil {
+		return
+	}
+	ctx := context.Background()
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		grant := &DownloadGrant{}
+		err = cur.Decode(&grant)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return
+			}
+			log.Errorln(err)
+		}
+		grants = append(grants, grant)
+	}
+	if err = cur.Err(); err != nil {
+		return
+	}
+	return grants, int64(tcint), pagingInfo.HasPreviousPage, pagingInfo.HasNextPage, nil
+}
+
+// RevokeDownloadGrant revokes a download grant.
+func RevokeDownloadGrant(grant *DownloadGrant) (*DownloadGrant, error) {
+	now := time.Now()
+	return updateDownloadGrant(grant.ID, bson.D{{"$set", bson.D{{"revokedAt", now}, {"updatedAt", now}}}}, "download_grant.revoked")
+}
+
+// ResetDownloadGrant clears the download count and revocation of a download grant.
+// When extendExpiry is set a grant that expires gets its full download window again, counted from now.
+func ResetDownloadGrant(grant *DownloadGrant, extendExpiry bool) (*DownloadGrant, error) {
+	now := time.Now()
+	set := bson.D{{"downloadCount", 0}, {"revokedAt", nil}, {"updatedAt", now}}
+	if extendExpiry && grant.ExpiresAt != nil {
+		expiresAt := now.Add(grant.ExpiresAt.Sub(grant.CreatedAt))
+		set = append(set, bson.E{"expiresAt", expiresAt})
+	}
+	return updateDownloadGrant(grant.ID, bson.D{{"$set", set}}, "download_grant.reset")
+}
+
+func updateDownloadGrant(id primitive.ObjectID, update bson.D, event string) (*DownloadGrant, error) {
+	grant := &DownloadGrant{}
+	findUpdOpts := &options.FindOneAndUpdateOptions{}
+	findUpdOpts.SetReturnDocument(options.After)
+	err := database.MongoDB.Collection(DownloadGrantsCollection).FindOneAndUpdate(context.Background(), bson.D{{"_id", id}}, update, findUpdOpts).Decode(&grant)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	go webhooks.NewWebhookEvent(event, grant)
+	return grant, nil
+}
+
+// Available tells why a grant can't be downloaded from at a time, nil when it can.
+func (grant *DownloadGrant) Available(now time.Time) error {
+	switch {
+	case grant.RevokedAt != nil:
+		return ErrDownloadRevoked
+	case grant.ExpiresAt != nil && !now.Before(*grant.ExpiresAt):
+		return ErrDownloadExpired
+	case grant.DownloadLimit > 0 && grant.DownloadCount >= grant.DownloadLimit:
+		return ErrDownloadLimitReached
+	}
+	return nil
+}
+
+// DownloadsRemaining gives the number of downloads left on a grant, nil when unlimited.
+func (grant *DownloadGrant) DownloadsRemaining() *int {
+	if grant.DownloadLimit <= 0 {
+		return nil
+	}
+	remaining := grant.DownloadLimit - grant.DownloadCount
+	if remaining < 0 {
+		remaining = 0
+	}
+	return &remaining
+}
+
+// SignDownloadURL gives a short-lived signed link to download the file of a grant.
+// Links are served under DOWNLOADS_URL and signed with DOWNLOADS_SECRET.
+func SignDownloadURL(grant *DownloadGrant) (string, time.Time, error) {
+	baseURL, secret := os.Getenv("DOWNLOADS_URL"), os.Getenv("DOWNLOADS_SECRET")
+	if baseURL == "" || secret == "" {
+		return "", time.Time{}, ErrDownloadURLNotConfigure
+	}
+	if err := grant.Available(time.Now()); err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().Add(DownloadURLLifetime)
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", downloadSignature(secret, grant.ID.Hex(), expires))
+	return baseURL + "/" + grant.ID.Hex() + "?" + query.Encode(), expiresAt, nil
+}
+
+// VerifyDownloadURL checks the signature and expiry of a signed download link.
+func VerifyDownloadURL(grantID string, expires string, signature string) error {
+	secret := os.Getenv("DOWNLOADS_SECRET")
+	if secret == "" {
+		return ErrDownloadURLNotConfigure
+	}
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > expiresAt {
+		return ErrInvalidDownloadURL
+	}
+	if !hmac.Equal([]byte(signature), []byte(downloadSignature(secret, grantID, expires))) {
+		return ErrInvalidDownloadURL
+	}
+	return nil
+}
+
+func downloadSignature(secret string, grantID string, expires string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(grantID + ":" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ConsumeDownloadGrant counts a download of a grant and logs it, failing once the grant is revoked, expired or used up.
+func ConsumeDownloadGrant(grantID string, ipAddress string, userAgent string) (*DownloadGrant, error) {
+	id, err := primitive.ObjectIDFromHex(grantID)
+	if err != nil {
+		return nil, ErrInvalidDownloadURL
+	}
+	now := time.Now()
+	filter := bson.D{
+		{"_id", id},
+		{"revokedAt", nil},
+		{"$and", bson.A{
+			bson.M{"$or": bson.A{bson.M{"expiresAt": nil}, bson.M{"expiresAt": bson.M{"$gt": now}}}},
+			bson.M{"$or": bson.A{bson.M{"downloadLimit": bson.M{"$lte": 0}}, bson.M{"$expr": bson.M{"$lt": bson.A{"$downloadCount", "$downloadLimit"}}}}},
+		}},
+	}
+	update := bson.D{{"$inc", bson.D{{"downloadCount", 1}}}, {"$set", bson.D{{"lastDownloadedAt", now}, {"updatedAt", now}}}}
+	findUpdOpts := &options.FindOneAndUpdateOptions{}
+	findUpdOpts.SetReturnDocument(options.After)
+	grant := &DownloadGrant{}
+	err = database.MongoDB.Collection(DownloadGrantsCollection).FindOneAndUpdate(context.Background(), filter, update, findUpdOpts).Decode(&grant)
+	if err == mongo.ErrNoDocuments {
+		//tell why the grant can't be used
+		current, err := GetDownloadGrantByID(grantID)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil {
+			return nil, ErrInvalidDownloadURL
+		}
+		if err := current.Available(now); err != nil {
+			return nil, err
+		}
+		return nil, ErrDownloadLimitReached
+	}
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+
+	downloadLog := DownloadLog{
+		ID:         primitive.NewObjectID(),
+		CreatedAt:  now,
+		GrantID:    grant.ID,
+		OrderID:    grant.OrderID,
+		CustomerID: grant.CustomerID,
+		IPAddress:  ipAddress,
+		UserAgent:  userAgent,
+	}
+	_, err = database.MongoDB.Collection(DownloadLogsCollection).InsertOne(context.Background(), &downloadLog)
+	if err != nil {
+		log.Errorln(err)
+	}
+	return grant, nil
+}
+
+// GetDownloadLogs gives a list of download logs.
+func GetDownloadLogs(filter bson.D, limit int, after *string, before *string, first *int, last *int) (downloadLogs []*DownloadLog, totalCount int64, hasPrevious, hasNext bool, err error) {
+
+	db := database.MongoDB
+
+	tcint, filter, err := calcTotalCountWithQueryFilters(DownloadLogsCollection, filter, after, before)
+	pagingInfo, err := PaginationUtility(after, before, first, last, &tcint)
+	if err != nil {
+		return
+	}
+	pagingInfo.QueryOpts.SetSort(bson.M{"_id": -1})
+
+	cur, err := db.Collection(DownloadLogsCollection).Find(context.Background(), filter, &pagingInfo.QueryOpts)
+	if err != nil {
+		return
+	}
+	ctx := context.Background()
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		downloadLog := &DownloadLog{}
+		err = cur.Decode(&downloadLog)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return
+			}
+			log.Errorln(err)
+		}
+		downloadLogs = append(downloadLogs, downloadLog)
+	}
+	if err = cur.Err(); err != nil {
+		return
+	}
+	return downloadLogs, int64(tcint), pagingInfo.HasPreviousPage, pagingInfo.HasNextPage, nil
+}
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"github.com/go-redis/redis"
 	"github.com/jordan-wright/email"
 	log "github.com/sirupsen/logrus"
@@ -27,6 +28,9 @@ import (
 	"time"
 )
 
+// ErrEmailTemplateNotFound is returned when no email template exists for a template id and language.
+var ErrEmailTemplateNotFound = errors.New("email template not found")
+
 // EmailTemplate represents a email template.
 type EmailTemplate struct {
 	ID         primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
@@ -264,6 +268,9 @@ func parseTemplate(templateID string, templateBody string, data interface{}) (st
 // SendEmail sends email via smtp, attachments passed here are uploaded (already present) in Google Cloud Storage
 func SendEmail(from string, to string, templateID string, language string, data interface{}, attachments []string) error {
 	emailTemplate := GetEmailContents(templateID, language)
+	if emailTemplate == nil {
+		return ErrEmailTemplateNotFound
+	}
 	textBody, err := parseTemplate(templateID+language, emailTemplate.TextBody, data)
 	if err != nil {
 		log.Errorln(err)
@@ -288,6 +295,7 @@ func SendEmail(from string, to string, templateID string, language string, data
 		bucketName := os.Getenv("GCS_BUCKET")
 		if bucket == nil {
 			log.Errorf("failed to get default GCS bucket name: %v", err)
+			return errors.New("storage bucket for email attachments is not configured")
 		}
 
 		for _, attachmentURL := range attachments {
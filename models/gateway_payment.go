@@ -0,0 +1,575 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/cache"
+	"github.com/tribehq/platform/lib/database"
+	"github.com/tribehq/platform/utils/webhooks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+// GatewayPaymentUpdate describes a change to a payment at a payment gateway, as told by the gateway's webhooks.
+type GatewayPaymentUpdate struct {
+	Gateway   string
+	PaymentID string  // the gateway's payment id
+	OrderID   string  // our order id from the payment's metadata, when set
+	JobID     string  // our job id from the payment's metadata, when set
+	Amount    float64 // in the major unit of the currency
+	Currency  string
+	Reason    string // why the payment failed or was cancelled
+}
+
+// GatewayRefundUpdate describes a refund of a payment made at a payment gateway.
+type GatewayRefundUpdate struct {
+	GatewayRefundID string  // the gateway's refund id
+	RefundID        string  // our order refund id from the refund's metadata, when we issued it
+	Amount          float64 // in the major unit of the currency
+	Reason          string
+}
+
+// findGatewayPayment gives the order or job a gateway payment was taken for, by the ids in its metadata or by the payment id.
+// Both are nil for payments that aren't ours to track, like subscription charges.
+func findGatewayPayment(update GatewayPaymentUpdate) (*Order, *Job, error) {
+	if _, err := primitive.ObjectIDFromHex(update.OrderID); err == nil {
+		order, err := GetOrderByID(update.OrderID)
+		if err != nil || order != nil {
+			return order, nil, err
+		}
+	}
+	if _, err := primitive.ObjectIDFromHex(update.JobID); err == nil {
+		job, err := GetJobByID(update.JobID)
+		if err != nil || job != nil {
+			return nil, job, err
+		}
+	}
+	if update.PaymentID == "" {
+		return nil, nil, nil
+	}
+	ctx := context.Background()
+	db := database.MongoDB
+	filter := bson.D{{"paymentGateway", update.Gateway}, {"gatewayPaymentID", update.PaymentID}, {"deletedAt", bson.M{"$exists": false}}}
+	order := &Order{}
+	err := db.Collection(OrdersCollection).FindOne(ctx, filter).Decode(order)
+	if err == nil {
+		return order, nil, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		log.Errorln(err)
+		return nil, nil, err
+	}
+	job := &Job{}
+	err = db.Collection(JobsCollection).FindOne(ctx, filter).Decode(job)
+	if err == nil {
+		return nil, job, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		log.Errorln(err)
+		return nil, nil, err
+	}
+	return nil, nil, nil
+}
+
+// updateJobPayment sets the payment fields of a job.
+func updateJobPayment(job *Job, set bson.D) (*Job, error) {
+	update := bson.D{{"$set", append(set, bson.E{"updatedAt", time.Now()})}}
+	findUpdateOpts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	updated := &Job{}
+	err := database.MongoDB.Collection(JobsCollection).FindOneAndUpdate(context.Background(), bson.D{{"_id", job.ID}}, update, findUpdateOpts).Decode(updated)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	err = cache.RedisClient.Del(job.ID.Hex()).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	go webhooks.NewWebhookEvent("job.updated", updated)
+	return updated, nil
+}
+
+// addPaymentOrderNote notes a payment event on an order for the admins.
+func addPaymentOrderNote(order *Order, author string, note string) {
+	_, err := CreateOrderNote(OrderNote{OrderID: order.ID, Author: author, Note: note, IsActive: true})
+	if err != nil {
+		log.Errorln(err)
+	}
+}
+
+// isJobPaid tells whether the gateway has taken the payment of a job.
+func isJobPaid(job *Job) bool {
+	return job.PaymentStatus != nil && *job.PaymentStatus != JobPaymentStatusPending &&
+		*job.PaymentStatus != JobPaymentStatusFailed && *job.PaymentStatus != JobPaymentStatusCancelled
+}
+
+// paymentBalance compares a payment with the amount due, giving what is still owed and what was paid over it.
+// A payment in another currency pays nothing off, all of it is over what is due.
+func paymentBalance(due float64, dueCurrency string, paid float64, paidCurrency string) (owed, excess float64) {
+	if dueCurrency != "" && paidCurrency != "" && !strings.EqualFold(dueCurrency, paidCurrency) {
+		return roundAmount(due), roundAmount(paid)
+	}
+	owed = roundAmount(due - paid)
+	if owed < 0 {
+		return 0, -owed
+	}
+	return owed, 0
+}
+
+// refundPaymentExcess refunds what a payment took over the amount due through the gateway that took it, giving the gateway's refund id.
+func refundPaymentExcess(update GatewayPaymentUpdate, excess float64) (string, error) {
+	refunder, ok := GetPaymentRefunder(update.Gateway)
+	if !ok {
+		return "", ErrPaymentGatewayNotConfigured
+	}
+	return refunder.RefundPayment(GatewayRefund{
+		RefundID:  "excess-" + update.PaymentID,
+		OrderID:   update.OrderID,
+		PaymentID: update.PaymentID,
+		Amount:    excess,
+		Currency:  update.Currency,
+		Reason:    "Paid over the amount due",
+	})
+}
+
+// RecordGatewayPaymentSucceeded records a payment taken by a gateway, placing an order that was waiting for it or marking a job paid.
+// Only a payment that covers the order total or the fare pays for it, a shortfall is recorded and what was paid over is refunded.
+func RecordGatewayPaymentSucceeded(update GatewayPaymentUpdate) error {
+	order, job, err := findGatewayPayment(update)
+	if err != nil {
+		return err
+	}
+	if job != nil {
+		return recordJobPaymentSucceeded(job, update)
+	}
+	if order == nil {
+		return nil
+	}
+	if order.GatewayPaymentID != "" && order.GatewayPaymentID != update.PaymentID && !order.DatePaid.IsZero() {
+		addPaymentOrderNote(order, update.Gateway, fmt.Sprintf("Another payment %s of %.2f %s was received for this order, it may need refunding.", update.PaymentID, update.Amount, update.Currency))
+		return nil
+	}
+	recorded := order.GatewayPaymentID == update.PaymentID && order.PaidAmount == roundAmount(update.Amount)
+	if !recorded {
+		order.PaymentGateway = update.Gateway
+		order.GatewayPaymentID = update.PaymentID
+		order.PaidAmount = roundAmount(update.Amount)
+		order, err = UpdateOrder(order)
+		if err != nil {
+			return err
+		}
+	}
+	switch currentOrderStatus(order) {
+	case OrderStatusPendingPayment:
+		owed, excess := paymentBalance(order.OrderTotalAmount, order.Currency.CurrencyCode, update.Amount, update.Currency)
+		if owed > 0 {
+			if !recorded {
+				addPaymentOrderNote(order, update.Gateway, fmt.Sprintf("Payment %s of %.2f %s is %.2f short of the order total, the order is waiting for payment.", update.PaymentID, update.Amount, update.Currency, owed))
+			}
+			return nil
+		}
+		order, err = TransitionOrderStatus(order, OrderStatusPlaced, update.Gateway, fmt.Sprintf("Payment %s received.", update.PaymentID))
+		if err != nil {
+			if err != ErrInvalidOrderStatusTransition {
+				return err
+			}
+			return nil
+		}
+		if excess > 0 {
+			refundOrderPaymentExcess(order, update, excess)
+		}
+	case OrderStatusCancelled, OrderStatusFailed, OrderStatusDeclined:
+		addPaymentOrderNote(order, update.Gateway, fmt.Sprintf("Payment %s was received after the order was %s, it may need refunding.", update.PaymentID, strings.ToLower(string(order.OrderStatus))))
+	}
+	return nil
+}
+
+// refundOrderPaymentExcess refunds what was paid over an order's total, noting on the order when it has to be refunded by hand.
+func refundOrderPaymentExcess(order *Order, update GatewayPaymentUpdate, excess float64) {
+	update.OrderID = order.ID.Hex()
+	refundID, err := refundPaymentExcess(update, excess)
+	if err != nil {
+		log.Errorln(err)
+		addPaymentOrderNote(order, update.Gateway, fmt.Sprintf("Payment %s was %.2f %s over the order total and couldn't be refunded, refund it by hand.", update.PaymentID, excess, update.Currency))
+		return
+	}
+	order.ExcessRefundID = refundID
+	if _, err = UpdateOrder(order); err != nil {
+		log.Errorln(err)
+	}
+	addPaymentOrderNote(order, update.Gateway, fmt.Sprintf("Payment %s was %.2f %s over the order total, refund %s was issued for it.", update.PaymentID, excess, update.Currency, refundID))
+}
+
+// recordJobPaymentSucceeded marks a job paid when the payment covers its fare. A short payment leaves the job waiting for payment
+// with the shortfall recorded, what was paid over the fare is refunded.
+func recordJobPaymentSucceeded(job *Job, update GatewayPaymentUpdate) error {
+	if job.GatewayPaymentID == update.PaymentID && (isJobPaid(job) || job.PaymentShortfall > 0) {
+		return nil
+	}
+	set := bson.D{
+		{"paymentGateway", update.Gateway},
+		{"gatewayPaymentID", update.PaymentID},
+		{"paidAmount", roundAmount(update.Amount)},
+	}
+	due, currency, err := JobFareDue(job)
+	if err != nil && err != ErrJobFareNotSet {
+		return err
+	}
+	if err == ErrJobFareNotSet {
+		//nothing to check the payment against, it waits for the fare to be set and settled by hand
+		log.Errorf("payment %s of %.2f %s was received for job %s before its fare was set", update.PaymentID, update.Amount, update.Currency, job.ID.Hex())
+		status := JobPaymentStatusPending
+		_, err = updateJobPayment(job, append(set, bson.E{"paymentStatus", &status}))
+		return err
+	}
+	owed, excess := paymentBalance(due, currency, update.Amount, update.Currency)
+	if owed > 0 {
+		status := JobPaymentStatusPending
+		_, err = updateJobPayment(job, append(set, bson.E{"paymentStatus", &status}, bson.E{"paymentShortfall", owed}))
+		return err
+	}
+	status := JobPaymentStatusPaid
+	updated, err := updateJobPayment(job, append(set, bson.E{"paymentStatus", &status}, bson.E{"paidAt", time.Now()}, bson.E{"paymentShortfall", 0.0}))
+	if err != nil {
+		return err
+	}
+	if excess > 0 {
+		if _, err = refundPaymentExcess(update, excess); err != nil {
+			log.Errorf("payment %s was %.2f %s over the fare of job %s and couldn't be refunded: %v", update.PaymentID, excess, update.Currency, job.ID.Hex(), err)
+			return nil
+		}
+		_, err = updateJobPayment(updated, bson.D{{"excessRefunded", excess}})
+		return err
+	}
+	return nil
+}
+
+// RecordGatewayPaymentFailed records a failed payment attempt, the customer can still retry an order or job that is waiting for payment.
+func RecordGatewayPaymentFailed(update GatewayPaymentUpdate) error {
+	order, job, err := findGatewayPayment(update)
+	if err != nil {
+		return err
+	}
+	if job != nil {
+		if isJobPaid(job) {
+			return nil
+		}
+		status := JobPaymentStatusFailed
+		_, err = updateJobPayment(job, bson.D{{"paymentGateway", update.Gateway}, {"gatewayPaymentID", update.PaymentID}, {"paymentStatus", &status}})
+		return err
+	}
+	if order == nil || currentOrderStatus(order) != OrderStatusPendingPayment {
+		return nil
+	}
+	note := fmt.Sprintf("Payment %s failed.", update.PaymentID)
+	if update.Reason != "" {
+		note = note + " " + update.Reason
+	}
+	addPaymentOrderNote(order, update.Gateway, note)
+	return nil
+}
+
+// RecordGatewayPaymentCancelled records a payment cancelled at the gateway, cancelling the order that was waiting for it.
+func RecordGatewayPaymentCancelled(update GatewayPaymentUpdate) error {
+	order, job, err := findGatewayPayment(update)
+	if err != nil {
+		return err
+	}
+	if job != nil {
+		if isJobPaid(job) || (job.GatewayPaymentID != "" && job.GatewayPaymentID != update.PaymentID) {
+			return nil
+		}
+		status := JobPaymentStatusCancelled
+		_, err = updateJobPayment(job, bson.D{{"paymentStatus", &status}})
+		return err
+	}
+	if order == nil || currentOrderStatus(order) != OrderStatusPendingPayment {
+		return nil
+	}
+	//an abandoned payment attempt doesn't cancel an order the customer paid for another way
+	if order.GatewayPaymentID != "" && order.GatewayPaymentID != update.PaymentID {
+		return nil
+	}
+	note := fmt.Sprintf("Payment %s was cancelled.", update.PaymentID)
+	if update.Reason != "" {
+		note = note + " " + update.Reason
+	}
+	_, err = TransitionOrderStatus(order, OrderStatusCancelled, update.Gateway, note)
+	if err != nil && err != ErrInvalidOrderStatusTransition {
+		return err
+	}
+	return nil
+}
+
+// isKnownOrderRefund tells whether a gateway refund is one we issued or have recorded already.
+func isKnownOrderRefund(gateway string, refund GatewayRefundUpdate) (bool, error) {
+	filter := bson.D{{"gateway", gateway}, {"gatewayRefundID", refund.GatewayRefundID}}
+	if refundID, err := primitive.ObjectIDFromHex(refund.RefundID); err == nil {
+		filter = bson.D{{"$or", bson.A{bson.D{{"_id", refundID}}, filter}}}
+	}
+	count, err := database.MongoDB.Collection(OrderRefundsCollection).CountDocuments(context.Background(), filter)
+	if err != nil {
+		log.Errorln(err)
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// RecordGatewayRefunds records the refunds of a payment made at the gateway, like the ones issued from the gateway's dashboard.
+// Refunds we issued are recorded already, the others are booked against the order as processed refunds.
+// totalRefunded is everything refunded on the payment so far, which is what a job keeps track of.
+func RecordGatewayRefunds(update GatewayPaymentUpdate, refunds []GatewayRefundUpdate, totalRefunded float64) error {
+	order, job, err := findGatewayPayment(update)
+	if err != nil {
+		return err
+	}
+	if job != nil {
+		//what was refunded for being paid over the fare isn't a refund of the fare
+		totalRefunded = roundAmount(totalRefunded - job.ExcessRefunded)
+		if totalRefunded <= job.RefundedAmount {
+			return nil
+		}
+		status := JobPaymentStatusPartiallyRefunded
+		if totalRefunded >= roundAmount(job.FareAmount) {
+			status = JobPaymentStatusRefunded
+		}
+		updated, err := updateJobPayment(job, bson.D{{"refundedAmount", totalRefunded}, {"paymentStatus", &status}})
+		if err != nil {
+			return err
+		}
+		//the provider's share of the refund comes back out of what the gateway transferred to them
+		if len(updated.PaymentTransfers) > 0 {
+			refundID := fmt.Sprintf("%s:%.2f", update.PaymentID, totalRefunded)
+			reversePaymentTransfers(JobsCollection, updated.ID, updated.PaymentTransfers, SettlementPayeeProvider, roundAmount(totalRefunded-job.RefundedAmount), refundID, update.Gateway)
+		}
+		return nil
+	}
+	if order == nil {
+		return nil
+	}
+	for _, gatewayRefund := range refunds {
+		if order.ExcessRefundID != "" && gatewayRefund.GatewayRefundID == order.ExcessRefundID {
+			continue
+		}
+		known, err := isKnownOrderRefund(update.Gateway, gatewayRefund)
+		if err != nil {
+			return err
+		}
+		if known {
+			continue
+		}
+		//refunds of a payment split over several stores can't be told apart by store
+		target := order
+		if len(order.ChildOrders) == 1 {
+			target, err = GetOrderByID(order.ChildOrders[0].Hex())
+			if err != nil {
+				return err
+			}
+		}
+		if target == nil || len(target.ChildOrders) > 0 {
+			addPaymentOrderNote(order, update.Gateway, fmt.Sprintf("Refund %s of %.2f was made at %s, book it against the store orders by hand.", gatewayRefund.GatewayRefundID, gatewayRefund.Amount, update.Gateway))
+			continue
+		}
+		amount := gatewayRefund.Amount
+		if refundable := roundAmount(target.OrderTotalAmount - target.Refunds.Total); amount > refundable {
+			amount = refundable
+		}
+		var tax float64
+		if target.OrderTotalAmount > 0 {
+			tax = roundAmount(target.TotalTax * amount / target.OrderTotalAmount)
+		}
+		now := time.Now()
+		refund, err := CreateOrderRefund(OrderRefund{
+			OrderID:         target.ID,
+			Amount:          amount,
+			Tax:             tax,
+			Reason:          gatewayRefund.Reason,
+			Status:          OrderRefundStatusApproved,
+			Method:          OrderRefundMethodGateway,
+			Gateway:         update.Gateway,
+			GatewayRefundID: gatewayRefund.GatewayRefundID,
+			ProcessedAt:     &now,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = recordOrderRefund(target, refund, update.Gateway)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecordGatewayDispute records a dispute raised against a payment, or its outcome, on the order or job paid for.
+func RecordGatewayDispute(update GatewayPaymentUpdate, dispute PaymentDispute) error {
+	order, job, err := findGatewayPayment(update)
+	if err != nil {
+		return err
+	}
+	if job != nil {
+		if job.Dispute != nil && job.Dispute.ID == dispute.ID {
+			dispute.OpenedAt = job.Dispute.OpenedAt
+		}
+		_, err = updateJobPayment(job, bson.D{{"dispute", &dispute}})
+		return err
+	}
+	if order == nil {
+		return nil
+	}
+	previous := order.Dispute
+	if previous != nil && previous.ID == dispute.ID {
+		dispute.OpenedAt = previous.OpenedAt
+		if previous.Status == dispute.Status {
+			return nil
+		}
+	}
+	order.Dispute = &dispute
+	order, err = UpdateOrder(order)
+	if err != nil {
+		return err
+	}
+	note := fmt.Sprintf("Payment disputed for %.2f %s: %s.", dispute.Amount, dispute.Currency, dispute.Reason)
+	switch dispute.Status {
+	case PaymentDisputeStatusWon:
+		note = fmt.Sprintf("Dispute %s was decided in our favour.", dispute.ID)
+	case PaymentDisputeStatusLost:
+		note = fmt.Sprintf("Dispute %s was lost, %.2f %s went back to the customer.", dispute.ID, dispute.Amount, dispute.Currency)
+	}
+	addPaymentOrderNote(order, update.Gateway, note)
+	return nil
+}
+
+// GetGatewayPaymentMethod gives the saved payment method of a customer at a gateway.
+func GetGatewayPaymentMethod(gateway string, paymentMethodID string) (*PaymentMethod, error) {
+	filter := bson.D{{"gateway", gateway}, {"gatewayPaymentMethodID", paymentMethodID}, {"deletedAt", bson.M{"$exists": false}}}
+	paymentMethod := &PaymentMethod{}
+	err := database.MongoDB.Collection(UserPaymentMethodsCollection).FindOne(context.Background(), filter).Decode(paymentMethod)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	return paymentMethod, nil
+}
+
+// GatewayCustomerUserID gives the user behind a customer of a gateway, by the payment methods and subscriptions saved for it.
+func GatewayCustomerUserID(gateway string, customerID string) (string, error) {
+	if customerID == "" {
+		return "", nil
+	}
+	ctx := context.Background()
+	db := database.MongoDB
+	paymentMethod := &PaymentMethod{}
+	filter := bson.D{{"gateway", gateway}, {"gatewayCustomerID", customerID}, {"userId", bson.M{"$ne": ""}}}
+	err := db.Collection(UserPaymentMethodsCollection).FindOne(ctx, filter).Decode(paymentMethod)
+	if err == nil {
+		return paymentMethod.UserID, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		log.Errorln(err)
+		return "", err
+	}
+	subscription := &Subscription{}
+	filter = bson.D{{"paymentGateway", gateway}, {"gatewayCustomerID", customerID}}
+	err = db.Collection(SubscriptionsCollection).FindOne(ctx, filter).Decode(subscription)
+	if err == nil {
+		return subscription.CustomerID.Hex(), nil
+	}
+	if err != mongo.ErrNoDocuments {
+		log.Errorln(err)
+		return "", err
+	}
+	return "", nil
+}
+
+// GatewayUserCustomerID gives the customer a user is at a gateway, by the payment methods and subscriptions saved for them.
+// It is empty when the user isn't a customer of the gateway yet.
+func GatewayUserCustomerID(gateway string, userID string) (string, error) {
+	ctx := context.Background()
+	db := database.MongoDB
+	paymentMethod := &PaymentMethod{}
+	filter := bson.D{{"gateway", gateway}, {"userId", userID}, {"gatewayCustomerID", bson.M{"$ne": ""}}}
+	err := db.Collection(UserPaymentMethodsCollection).FindOne(ctx, filter).Decode(paymentMethod)
+	if err == nil {
+		return paymentMethod.GatewayCustomerID, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		log.Errorln(err)
+		return "", err
+	}
+	customerID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return "", nil
+	}
+	subscription := &Subscription{}
+	filter = bson.D{{"paymentGateway", gateway}, {"customerID", customerID}, {"gatewayCustomerID", bson.M{"$ne": ""}}}
+	err = db.Collection(SubscriptionsCollection).FindOne(ctx, filter).Decode(subscription)
+	if err == nil {
+		return subscription.GatewayCustomerID, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		log.Errorln(err)
+		return "", err
+	}
+	return "", nil
+}
+
+// SyncGatewayPaymentMethod saves a payment method attached to a customer at a gateway, or brings the saved one up to date.
+func SyncGatewayPaymentMethod(paymentMethod PaymentMethod) (*PaymentMethod, error) {
+	saved, err := GetGatewayPaymentMethod(paymentMethod.Gateway, paymentMethod.GatewayPaymentMethodID)
+	if err != nil {
+		return nil, err
+	}
+	if saved == nil {
+		if paymentMethod.UserID == "" {
+			log.Warnf("no user found for %s payment method %s", paymentMethod.Gateway, paymentMethod.GatewayPaymentMethodID)
+			return nil, nil
+		}
+		saved, _, err = SavePaymentMethod(paymentMethod, false)
+		return saved, err
+	}
+	if saved.ExpMonth != paymentMethod.ExpMonth || saved.ExpYear != paymentMethod.ExpYear {
+		saved.ExpiryRemindedAt = nil
+	}
+	saved.Name = paymentMethod.Name
+	saved.Type = paymentMethod.Type
+	saved.Brand = paymentMethod.Brand
+	saved.Last4 = paymentMethod.Last4
+	saved.ExpMonth = paymentMethod.ExpMonth
+	saved.ExpYear = paymentMethod.ExpYear
+	if paymentMethod.Fingerprint != "" {
+		saved.Fingerprint = paymentMethod.Fingerprint
+	}
+	if paymentMethod.GatewayCustomerID != "" {
+		saved.GatewayCustomerID = paymentMethod.GatewayCustomerID
+	}
+	if paymentMethod.UserID != "" {
+		saved.UserID = paymentMethod.UserID
+	}
+	return UpdateuserPaymentMethod(saved)
+}
+
+// DetachGatewayPaymentMethod removes a payment method the customer detached at the gateway.
+func DetachGatewayPaymentMethod(gateway string, paymentMethodID string) error {
+	saved, err := GetGatewayPaymentMethod(gateway, paymentMethodID)
+	if err != nil || saved == nil {
+		return err
+	}
+	err = RemovePaymentMethod(saved)
+	if err == ErrPaymentMethodNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,60 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type fakeExcessRefunder struct {
+	refunds []GatewayRefund
+}
+
+func (f *fakeExcessRefunder) RefundPayment(refund GatewayRefund) (string, error) {
+	f.refunds = append(f.refunds, refund)
+	return "rfnd_" + refund.RefundID, nil
+}
+
+func TestPaymentBalance(t *testing.T) {
+	owed, excess := paymentBalance(500, "INR", 500, "INR")
+	require.Equal(t, 0.0, owed)
+	require.Equal(t, 0.0, excess)
+
+	owed, excess = paymentBalance(500, "INR", 450.5, "inr")
+	require.Equal(t, 49.5, owed)
+	require.Equal(t, 0.0, excess)
+
+	owed, excess = paymentBalance(500, "INR", 520.25, "INR")
+	require.Equal(t, 0.0, owed)
+	require.Equal(t, 20.25, excess)
+
+	owed, excess = paymentBalance(100.1, "INR", 100.1, "")
+	require.Equal(t, 0.0, owed)
+	require.Equal(t, 0.0, excess)
+
+	owed, excess = paymentBalance(500, "INR", 500, "USD")
+	require.Equal(t, 500.0, owed)
+	require.Equal(t, 500.0, excess)
+}
+
+func TestJobFareDueWithoutFare(t *testing.T) {
+	_, _, err := JobFareDue(&Job{EstimatedFareAmount: 250})
+	require.Equal(t, ErrJobFareNotSet, err)
+}
+
+func TestRefundPaymentExcess(t *testing.T) {
+	update := GatewayPaymentUpdate{Gateway: "excess-test", PaymentID: "pay_1", OrderID: "order_1", Amount: 520, Currency: "INR"}
+
+	_, err := refundPaymentExcess(update, 20)
+	require.Equal(t, ErrPaymentGatewayNotConfigured, err)
+
+	refunder := &fakeExcessRefunder{}
+	RegisterPaymentRefunder("excess-test", refunder)
+	refundID, err := refundPaymentExcess(update, 20)
+	require.NoError(t, err)
+	require.Equal(t, "rfnd_excess-pay_1", refundID)
+	require.Equal(t, []GatewayRefund{{RefundID: "excess-pay_1", OrderID: "order_1", PaymentID: "pay_1", Amount: 20, Currency: "INR", Reason: "Paid over the amount due"}}, refunder.refunds)
+}
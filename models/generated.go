@@ -318,7 +318,7 @@ type AddOAuthApplicationInput struct {
 }
 
 type AddOrderInput struct {
-	OrderItems         *OrderItemInput    `json:"orderItems"`
+	OrderItems         []*OrderItemInput  `json:"orderItems"`
 	ServiceType        string             `json:"serviceType"`
 	Coupon             string             `json:"coupon"`
 	ProviderID         primitive.ObjectID `json:"providerID"`
@@ -338,16 +338,25 @@ type AddOrderInput struct {
 }
 
 type AddOrderNoteInput struct {
-	Author       string `json:"author"`
-	Note         string `json:"note"`
-	CustomerNote bool   `json:"customerNote"`
-	IsActive     bool   `json:"isActive"`
+	OrderID      primitive.ObjectID `json:"orderID"`
+	Author       string             `json:"author"`
+	Note         string             `json:"note"`
+	CustomerNote bool               `json:"customerNote"`
+	IsActive     bool               `json:"isActive"`
 }
 
 type AddOrderStatusUtilityInput struct {
-	StatusTitle       string `json:"statusTitle"`
-	StatusDescription string `json:"statusDescription"`
-	IsActive          bool   `json:"isActive"`
+	StatusTitle       string        `json:"statusTitle"`
+	StatusDescription string        `json:"statusDescription"`
+	Status            OrderStatus   `json:"status"`
+	ServiceCategory   StoreCategory `json:"serviceCategory"`
+	NextStatuses      []OrderStatus `json:"nextStatuses"`
+	NotifyCustomer    bool          `json:"notifyCustomer"`
+	NotifyStore       bool          `json:"notifyStore"`
+	ReleaseStock      bool          `json:"releaseStock"`
+	RefundPayment     bool          `json:"refundPayment"`
+	WebhookEvent      string        `json:"webhookEvent"`
+	IsActive          bool          `json:"isActive"`
 }
 
 type AddPackageType struct {
@@ -372,6 +381,16 @@ type AddPageInput struct {
 	IsActive    *bool  `json:"isActive"`
 }
 
+type AddPriceRuleInput struct {
+	StoreID    primitive.ObjectID `json:"storeID"`
+	Name       string             `json:"name"`
+	Target     PriceRuleTarget    `json:"target"`
+	TargetID   primitive.ObjectID `json:"targetID"`
+	Percentage float64            `json:"percentage"`
+	StartsAt   *time.Time         `json:"startsAt"`
+	EndsAt     *time.Time         `json:"endsAt"`
+}
+
 type AddProductAttributeInput struct {
 	Name        string   `json:"name"`
 	Slug        string   `json:"slug"`
@@ -509,12 +528,10 @@ type AddProductMetadataInput struct {
 
 type AddProductReviewInput struct {
 	ProductID          string                   `json:"productID"`
-	Status             ProductStatus            `json:"status"`
 	Reviewer           string                   `json:"reviewer"`
 	ReviewerEmail      string                   `json:"reviewerEmail"`
 	Review             string                   `json:"review"`
 	Rating             int                      `json:"rating"`
-	Verified           bool                     `json:"verified"`
 	ReviewerAvatarURLs *ReviewerAvatarUrlsInput `json:"reviewerAvatarURLs"`
 }
 
@@ -571,19 +588,15 @@ type AddRentalPackageInput struct {
 }
 
 type AddReviewInput struct {
-	JobID                 primitive.ObjectID `json:"jobId"`
-	UserName              string             `json:"userName"`
-	UserAverageRating     float64            `json:"userAverageRating"`
-	ProviderAverageRating float64            `json:"providerAverageRating"`
-	ProviderName          string             `json:"providerName"`
-	UserRating            float64            `json:"userRating"`
-	ProviderRating        float64            `json:"providerRating"`
-	Type                  ReviewType         `json:"type"`
-	From                  string             `json:"from"`
-	To                    string             `json:"to"`
-	Date                  time.Time          `json:"date"`
-	Comment               string             `json:"comment"`
-	IsActive              bool               `json:"isActive"`
+	JobID          primitive.ObjectID `json:"jobId"`
+	UserName       string             `json:"userName"`
+	ProviderName   string             `json:"providerName"`
+	Type           ReviewType         `json:"type"`
+	From           string             `json:"from"`
+	To             string             `json:"to"`
+	Date           time.Time          `json:"date"`
+	Comment        string             `json:"comment"`
+	IsActive       bool               `json:"isActive"`
 }
 
 type AddRideProfileTypeInput struct {
@@ -599,6 +612,11 @@ type AddRideProfileTypeInput struct {
 	IsActive         *bool  `json:"isActive"`
 }
 
+type AddSearchSynonymInput struct {
+	Terms    []string `json:"terms"`
+	IsActive bool     `json:"isActive"`
+}
+
 type AddServiceCompanyInput struct {
 	Name           string           `json:"name"`
 	ProvidersCount int              `json:"providersCount"`
@@ -751,6 +769,7 @@ type AddStoreInput struct {
 	MaxOrderQuantity         string                   `json:"maxOrderQuantity"`
 	EstimatedOrderTime       int                      `json:"estimatedOrderTime"`
 	OfferAppliesOn           OfferAppliesOn           `json:"offerAppliesOn"`
+	CommissionRate           float64                  `json:"commissionRate"`
 	BankAccountDetails       *UpdateBankDetailsInput  `json:"bankAccountDetails"`
 }
 
@@ -770,6 +789,36 @@ type AddStoreVehicleTypeInput struct {
 	IsActive                  bool                     `json:"isActive"`
 }
 
+type AddSubscriptionPlanInput struct {
+	Nickname        string                          `json:"nickname"`
+	ProductID       *primitive.ObjectID             `json:"productID"`
+	Currency        string                          `json:"currency"`
+	Interval        SubscriptionPlanInterval        `json:"interval"`
+	IntervalCount   *int                            `json:"intervalCount"`
+	UsageType       SubscriptionPlanUsageType       `json:"usageType"`
+	AggregateUsage  *SubscriptionPlanAggregateUsage `json:"aggregateUsage"`
+	BillingScheme   SubscriptionPlanBillingScheme   `json:"billingScheme"`
+	Amount          *float64                        `json:"amount"`
+	TiersMode       *SubscriptionPlanTiersMode      `json:"tiersMode"`
+	Tiers           []*SubscriptionPlanTierInput    `json:"tiers"`
+	TransformUsage  *PlanTransformUsageInput        `json:"transformUsage"`
+	TrialPeriodDays *int                            `json:"trialPeriodDays"`
+}
+
+type AddTaxRuleInput struct {
+	Country  string  `json:"country"`
+	State    string  `json:"state"`
+	City     string  `json:"city"`
+	PostCode string  `json:"postCode"`
+	TaxClass string  `json:"taxClass"`
+	Rate     float64 `json:"rate"`
+	Name     string  `json:"name"`
+	Priority int     `json:"priority"`
+	Compound bool    `json:"compound"`
+	Shipping bool    `json:"shipping"`
+	IsActive bool    `json:"isActive"`
+}
+
 type AddUserInput struct {
 	FirstName    string `json:"firstName"`
 	MobileNo     string `json:"mobileNo"`
@@ -1094,16 +1143,36 @@ type BillingInput struct {
 	Phone     string `json:"phone"`
 }
 
+// List of BillingSubscription
+type BillingSubscriptionConnection struct {
+	// Total number of nodes
+	TotalCount int `json:"totalCount"`
+	// A list of edges
+	Edges []*BillingSubscriptionEdge `json:"edges"`
+	// A list of nodes.
+	Nodes []*Subscription `json:"nodes"`
+	// Information to aid in pagination.
+	PageInfo *PageInfo `json:"pageInfo"`
+}
+
+//  Paginating the node BillingSubscription
+type BillingSubscriptionEdge struct {
+	Cursor string        `json:"cursor"`
+	Node   *Subscription `json:"node"`
+}
+
 type Booking struct {
 	JobID     *primitive.ObjectID `json:"jobId"`
 	VehicleID *primitive.ObjectID `json:"vehicleId"`
 }
 
 type BookingFareEstimate struct {
-	BaseFare  *float64 `json:"baseFare"`
-	Distance  *float64 `json:"distance"`
-	Time      *float64 `json:"time"`
-	TotalFare *float64 `json:"totalFare"`
+	BaseFare  *float64   `json:"baseFare"`
+	Distance  *float64   `json:"distance"`
+	Time      *float64   `json:"time"`
+	Tax       *float64   `json:"tax"`
+	TaxLines  []TaxLines `json:"taxLines"`
+	TotalFare *float64   `json:"totalFare"`
 }
 
 type BookingInput struct {
@@ -1118,6 +1187,8 @@ type BookingInput struct {
 	OtherServiceDetails  *OtherServiceDetailsInput `json:"otherServiceDetails"`
 	Coupon               string                    `json:"coupon"`
 	ProviderID           string                    `json:"providerId"`
+	// How the customer pays, CASH when the provider collects the fare
+	PaymentMethod *PaymentMethodType `json:"paymentMethod"`
 }
 
 //  List of BusinessTripReason
@@ -1174,6 +1245,17 @@ type CancelledReportEdge struct {
 	Node   *CancelledReport `json:"node"`
 }
 
+type CartBreakdown struct {
+	Subtotal    float64               `json:"subtotal"`
+	Discount    float64               `json:"discount"`
+	DeliveryFee float64               `json:"deliveryFee"`
+	Fees        float64               `json:"fees"`
+	Tax         float64               `json:"tax"`
+	Total       float64               `json:"total"`
+	TaxLines    []TaxLines            `json:"taxLines"`
+	Stores      []*CartStoreBreakdown `json:"stores"`
+}
+
 //  List of Carts
 type CartConnection struct {
 	// Total number of nodes
@@ -1192,6 +1274,89 @@ type CartEdge struct {
 	Node   *Cart  `json:"node"`
 }
 
+type CartRecoveryReport struct {
+	FromDate         *time.Time `json:"fromDate"`
+	ToDate           *time.Time `json:"toDate"`
+	RemindedCarts    int        `json:"remindedCarts"`
+	RemindersSent    int        `json:"remindersSent"`
+	ClickedCarts     int        `json:"clickedCarts"`
+	RecoveredCarts   int        `json:"recoveredCarts"`
+	RecoveredRevenue float64    `json:"recoveredRevenue"`
+	ConversionRate   float64    `json:"conversionRate"`
+}
+
+type CartRecoverySetting struct {
+	Enabled          bool                  `json:"enabled"`
+	ReminderDelays   []int                 `json:"reminderDelays"`
+	Channels         []CartRecoveryChannel `json:"channels"`
+	CouponOnReminder int                   `json:"couponOnReminder"`
+	CouponPercentage float64               `json:"couponPercentage"`
+	CouponValidDays  int                   `json:"couponValidDays"`
+}
+
+type CartRecoverySettingInput struct {
+	Enabled          bool                  `json:"enabled"`
+	ReminderDelays   []int                 `json:"reminderDelays"`
+	Channels         []CartRecoveryChannel `json:"channels"`
+	CouponOnReminder int                   `json:"couponOnReminder"`
+	CouponPercentage float64               `json:"couponPercentage"`
+	CouponValidDays  int                   `json:"couponValidDays"`
+}
+
+type CartStoreBreakdown struct {
+	StoreID      primitive.ObjectID `json:"storeID"`
+	Subtotal     float64            `json:"subtotal"`
+	Discount     float64            `json:"discount"`
+	DeliveryFee  float64            `json:"deliveryFee"`
+	FreeDelivery bool               `json:"freeDelivery"`
+	Distance     *float64           `json:"distance"`
+	DistanceUnit *DistanceUnits     `json:"distanceUnit"`
+	Fees         float64            `json:"fees"`
+	Tax          float64            `json:"tax"`
+	Total        float64            `json:"total"`
+}
+
+// List of Cash Liability Entries
+type CashLiabilityEntryConnection struct {
+	// Total number of nodes
+	TotalCount int `json:"totalCount"`
+	// A list of edges
+	Edges []*CashLiabilityEntryEdge `json:"edges"`
+	// A list of nodes.
+	Nodes []*CashLiabilityEntry `json:"nodes"`
+	// Information to aid in pagination.
+	PageInfo *PageInfo `json:"pageInfo"`
+}
+
+//  Paginating the node cash liability entry
+type CashLiabilityEntryEdge struct {
+	Cursor string              `json:"cursor"`
+	Node   *CashLiabilityEntry `json:"node"`
+}
+
+type CashLiabilityPaymentInput struct {
+	ProviderID primitive.ObjectID `json:"providerId"`
+	Currency   string             `json:"currency"`
+	Amount     float64            `json:"amount"`
+	// Receipt or deposit reference of the payment, recording it again with the same reference does nothing
+	Reference string `json:"reference"`
+}
+
+type CashLiabilitySetting struct {
+	// Cash a provider can owe the market before they stop getting cash jobs, no limit when 0
+	Limit float64 `json:"limit"`
+}
+
+type CashLiabilitySettingInput struct {
+	Limit float64 `json:"limit"`
+}
+
+type ChangeSubscriptionPlanInput struct {
+	ID       primitive.ObjectID `json:"id"`
+	PlanID   primitive.ObjectID `json:"planID"`
+	Quantity *int               `json:"quantity"`
+}
+
 type ChatNote struct {
 	Type      *string   `json:"type"`
 	Message   string    `json:"message"`
@@ -1199,6 +1364,24 @@ type ChatNote struct {
 	CreatedAt time.Time `json:"createdAt"`
 }
 
+type CheckoutDeliverySlotInput struct {
+	StoreID primitive.ObjectID `json:"storeID"`
+	Start   time.Time          `json:"start"`
+}
+
+type CheckoutInput struct {
+	CartID             primitive.ObjectID           `json:"cartID"`
+	DeliveryAddressID  primitive.ObjectID           `json:"deliveryAddressID"`
+	Coupon             *string                      `json:"coupon"`
+	Billing            *BillingInput                `json:"billing"`
+	Shipping           *ShippingInput               `json:"shipping"`
+	PaymentMethod      PaymentMethodType            `json:"paymentMethod"`
+	PaymentMethodTitle string                       `json:"paymentMethodTitle"`
+	CustomerNote       *string                      `json:"customerNote"`
+	ScheduledFor       *time.Time                   `json:"scheduledFor"`
+	DeliverySlots      []*CheckoutDeliverySlotInput `json:"deliverySlots"`
+}
+
 //  List of City
 type CityConnection struct {
 	// Total number of nodes
@@ -1261,6 +1444,11 @@ type CouponLines struct {
 	MetaData    *MetaData          `json:"metaData"`
 }
 
+type CreateRazorpayOrderInput struct {
+	OrderID *primitive.ObjectID `json:"orderID"`
+	JobID   *primitive.ObjectID `json:"jobID"`
+}
+
 // List of currencies
 type CurrencyConnection struct {
 	// Total number of nodes
@@ -1395,6 +1583,20 @@ type DeliveryDetailsInput struct {
 	DeliverLater          time.Time          `json:"deliverLater"`
 }
 
+type DeliverySlotAvailability struct {
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Capacity  int       `json:"capacity"`
+	Remaining *int      `json:"remaining"`
+}
+
+type DeliverySlotInput struct {
+	Day      Weekday `json:"day"`
+	Start    string  `json:"start"`
+	End      string  `json:"end"`
+	Capacity int     `json:"capacity"`
+}
+
 //  List of DeliveryVehicleType
 type DeliveryVehicleTypeConnection struct {
 	// Total number of nodes
@@ -1436,6 +1638,40 @@ type DocumentEdge struct {
 	Node   *Document `json:"node"`
 }
 
+// List of Download Grants
+type DownloadGrantConnection struct {
+	TotalCount int                  `json:"totalCount"`
+	Edges      []*DownloadGrantEdge `json:"edges"`
+	Nodes      []*DownloadGrant     `json:"nodes"`
+	PageInfo   *PageInfo            `json:"pageInfo"`
+}
+
+//  Paginating the node download grant
+type DownloadGrantEdge struct {
+	Cursor string         `json:"cursor"`
+	Node   *DownloadGrant `json:"node"`
+}
+
+// List of Download Logs
+type DownloadLogConnection struct {
+	TotalCount int                `json:"totalCount"`
+	Edges      []*DownloadLogEdge `json:"edges"`
+	Nodes      []*DownloadLog     `json:"nodes"`
+	PageInfo   *PageInfo          `json:"pageInfo"`
+}
+
+//  Paginating the node download log
+type DownloadLogEdge struct {
+	Cursor string       `json:"cursor"`
+	Node   *DownloadLog `json:"node"`
+}
+
+// Short-lived signed link to download a granted file
+type DownloadURL struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
 type EmailSetting struct {
 	EmailFromName string `json:"emailFromName"`
 	AdminEmail    string `json:"adminEmail"`
@@ -1789,6 +2025,14 @@ type HelpDetailEdge struct {
 	Node   *HelpDetail `json:"node"`
 }
 
+type HolidayOverrideInput struct {
+	Date   string  `json:"date"`
+	Closed bool    `json:"closed"`
+	Opens  *string `json:"opens"`
+	Closes *string `json:"closes"`
+	Note   *string `json:"note"`
+}
+
 type HotelPaymentReport struct {
 	BookedBy              string `json:"bookedBy"`
 	JobNo                 string `json:"jobNo"`
@@ -2100,6 +2344,12 @@ type OAuthApplicationEdge struct {
 	Node   *OAuthApplication `json:"node"`
 }
 
+type OpeningHoursInput struct {
+	Day    Weekday `json:"day"`
+	Opens  string  `json:"opens"`
+	Closes string  `json:"closes"`
+}
+
 //  List of Order
 type OrderConnection struct {
 	// Total number of nodes
@@ -2119,15 +2369,23 @@ type OrderEdge struct {
 }
 
 type OrderItem struct {
-	ID       primitive.ObjectID `json:"id"`
-	Name     string             `json:"name"`
-	Quantity int                `json:"quantity"`
+	ID                primitive.ObjectID  `json:"id"`
+	VariationID       *primitive.ObjectID `json:"variationID"`
+	Name              string              `json:"name"`
+	Quantity          int                 `json:"quantity"`
+	Price             float64             `json:"price"`
+	TaxClass          string              `json:"taxClass"`
+	TaxStatus         string              `json:"taxStatus"`
+	Tax               float64             `json:"tax"`
+	RefundedQuantity  int                 `json:"refundedQuantity"`
+	RestockedQuantity int                 `json:"restockedQuantity"`
 }
 
 type OrderItemInput struct {
-	ID       primitive.ObjectID `json:"id"`
-	Name     string             `json:"name"`
-	Quantity int                `json:"quantity"`
+	ID          primitive.ObjectID  `json:"id"`
+	VariationID *primitive.ObjectID `json:"variationID"`
+	Name        string              `json:"name"`
+	Quantity    int                 `json:"quantity"`
 }
 
 type OrderNoteConnection struct {
@@ -2147,6 +2405,29 @@ type OrderNoteEdge struct {
 	Node   *OrderNote `json:"node"`
 }
 
+type OrderRefundConnection struct {
+	// Total number of nodes
+	TotalCount int `json:"totalCount"`
+	// A list of edges
+	Edges []*OrderRefundEdge `json:"edges"`
+	// A list of nodes.
+	Nodes []*OrderRefund `json:"nodes"`
+	// Information to aid in pagination.
+	PageInfo *PageInfo `json:"pageInfo"`
+}
+
+//  Paginating the node OrderRefund
+type OrderRefundEdge struct {
+	Cursor string       `json:"cursor"`
+	Node   *OrderRefund `json:"node"`
+}
+
+type OrderRefundLineItemInput struct {
+	ProductID   primitive.ObjectID  `json:"productID"`
+	VariationID *primitive.ObjectID `json:"variationID"`
+	Quantity    int                 `json:"quantity"`
+}
+
 //  List of OrderStatusUtility
 type OrderStatusUtilityConnection struct {
 	// Total number of nodes
@@ -2249,6 +2530,22 @@ type PaidEarningEdge struct {
 	Node   *PaidEarning `json:"node"`
 }
 
+type PayWithPaytmWalletInput struct {
+	OrderID *primitive.ObjectID `json:"orderID"`
+	JobID   *primitive.ObjectID `json:"jobID"`
+}
+
+// Chargeback raised by the customer's bank against a payment
+type PaymentDispute struct {
+	ID       string               `json:"id"`
+	Amount   float64              `json:"amount"`
+	Currency string               `json:"currency"`
+	Reason   string               `json:"reason"`
+	Status   PaymentDisputeStatus `json:"status"`
+	OpenedAt time.Time            `json:"openedAt"`
+	ClosedAt *time.Time           `json:"closedAt"`
+}
+
 type PaymentSetting struct {
 	AppPaymentEnvironment         PaymentEnvironment `json:"appPaymentEnvironment"`
 	PaymentMode                   PaymentMode        `json:"paymentMode"`
@@ -2259,6 +2556,9 @@ type PaymentSetting struct {
 	StripePublisherLiveModeKey    string             `json:"stripePublisherLiveModeKey"`
 	StripeSecretSandboxModeKey    string             `json:"stripeSecretSandboxModeKey"`
 	StripeSecretLiveModeKey       string             `json:"stripeSecretLiveModeKey"`
+	RefundApprovalThreshold       float64            `json:"refundApprovalThreshold"`
+	// Payment gateway payments go through unless a store has its own, the default gateway when empty
+	PaymentGateway string `json:"paymentGateway"`
 }
 
 type PaymentSettingInput struct {
@@ -2271,6 +2571,39 @@ type PaymentSettingInput struct {
 	StripePublisherLiveModeKey    string             `json:"stripePublisherLiveModeKey"`
 	StripeSecretSandboxModeKey    string             `json:"stripeSecretSandboxModeKey"`
 	StripeSecretLiveModeKey       string             `json:"stripeSecretLiveModeKey"`
+	RefundApprovalThreshold       float64            `json:"refundApprovalThreshold"`
+	PaymentGateway                string             `json:"paymentGateway"`
+}
+
+type PaytmAddMoneyForm struct {
+	URL    string                 `json:"url"`
+	Params map[string]interface{} `json:"params"`
+}
+
+type PaytmWalletBalance struct {
+	Balance         float64 `json:"balance"`
+	FundsSufficient bool    `json:"fundsSufficient"`
+	DeficitAmount   float64 `json:"deficitAmount"`
+	AddMoneyAllowed bool    `json:"addMoneyAllowed"`
+}
+
+type PlanTransformUsageInput struct {
+	DivideBy int                                 `json:"divideBy"`
+	Round    SubscriptionPlanTransformUsageRound `json:"round"`
+}
+
+// List of Price Rules
+type PriceRuleConnection struct {
+	TotalCount int              `json:"totalCount"`
+	Edges      []*PriceRuleEdge `json:"edges"`
+	Nodes      []*PriceRule     `json:"nodes"`
+	PageInfo   *PageInfo        `json:"pageInfo"`
+}
+
+//  Paginating the node price rule
+type PriceRuleEdge struct {
+	Cursor string     `json:"cursor"`
+	Node   *PriceRule `json:"node"`
 }
 
 //  List of Product Attributes
@@ -2291,6 +2624,11 @@ type ProductAttributeEdge struct {
 	Node   *ProductAttribute `json:"node"`
 }
 
+type ProductAttributeFilterInput struct {
+	Name  string   `json:"name"`
+	Terms []string `json:"terms"`
+}
+
 //  List of Product Attributes Terms
 type ProductAttributeTermConnection struct {
 	// Total number of nodes
@@ -2423,6 +2761,18 @@ type ProductImageEdge struct {
 	Node   *ProductImage `json:"node"`
 }
 
+type ProductImportJobConnection struct {
+	TotalCount int                     `json:"totalCount"`
+	Edges      []*ProductImportJobEdge `json:"edges"`
+	Nodes      []*ProductImportJob     `json:"nodes"`
+	PageInfo   *PageInfo               `json:"pageInfo"`
+}
+
+type ProductImportJobEdge struct {
+	Cursor string            `json:"cursor"`
+	Node   *ProductImportJob `json:"node"`
+}
+
 // List of Product Metadata
 type ProductMetadataConnection struct {
 	// Total number of nodes
@@ -2441,6 +2791,11 @@ type ProductMetadataEdge struct {
 	Node   *ProductMetadata `json:"node"`
 }
 
+type ProductRatingCount struct {
+	Rating int `json:"rating"`
+	Count  int `json:"count"`
+}
+
 //  List of Product Reviews
 type ProductReviewConnection struct {
 	// Total number of nodes
@@ -2459,6 +2814,32 @@ type ProductReviewEdge struct {
 	Node   *ProductReview `json:"node"`
 }
 
+type ProductSearchConnection struct {
+	TotalCount     int                  `json:"totalCount"`
+	Edges          []*ProductSearchEdge `json:"edges"`
+	Nodes          []*Product           `json:"nodes"`
+	PageInfo       *PageInfo            `json:"pageInfo"`
+	Facets         *ProductSearchFacets `json:"facets"`
+	CorrectedQuery *string              `json:"correctedQuery"`
+}
+
+type ProductSearchEdge struct {
+	Cursor string   `json:"cursor"`
+	Node   *Product `json:"node"`
+	Score  float64  `json:"score"`
+}
+
+type ProductSearchFilter struct {
+	StoreID       *primitive.ObjectID            `json:"storeID"`
+	Categories    []primitive.ObjectID           `json:"categories"`
+	Brands        []primitive.ObjectID           `json:"brands"`
+	Attributes    []*ProductAttributeFilterInput `json:"attributes"`
+	MinPrice      *float64                       `json:"minPrice"`
+	MaxPrice      *float64                       `json:"maxPrice"`
+	StockStatus   []string                       `json:"stockStatus"`
+	IncludeHidden *bool                          `json:"includeHidden"`
+}
+
 // List of ProductTag
 type ProductTagConnection struct {
 	// Total number of nodes
@@ -2575,6 +2956,20 @@ type PushNotificationInput struct {
 	Payload       string          `json:"Payload"`
 }
 
+type RateJobInput struct {
+	JobID   primitive.ObjectID `json:"jobID"`
+	Rating  float64            `json:"rating"`
+	Comment *string            `json:"comment"`
+}
+
+type RazorpayOrder struct {
+	ID       string `json:"id"`
+	KeyID    string `json:"keyID"`
+	Amount   int    `json:"amount"`
+	Currency string `json:"currency"`
+	Receipt  string `json:"receipt"`
+}
+
 type RecentUnpaidEarning struct {
 	ID                     primitive.ObjectID `json:"id"`
 	BookingDate            time.Time          `json:"bookingDate"`
@@ -2610,10 +3005,22 @@ type ReferralReport struct {
 	User     *UserReferralReport `json:"user"`
 }
 
+type RefundOrderInput struct {
+	OrderID primitive.ObjectID `json:"orderID"`
+	// Amount to refund, leave empty to refund the line items or else the remaining order total
+	Amount    *float64                    `json:"amount"`
+	LineItems []*OrderRefundLineItemInput `json:"lineItems"`
+	Restock   bool                        `json:"restock"`
+	// Refund to the customer's wallet instead of the original payment
+	ToWallet *bool   `json:"toWallet"`
+	Reason   *string `json:"reason"`
+}
+
 type Refunds struct {
-	ID     primitive.ObjectID `json:"id"`
-	Reason string             `json:"reason"`
-	Total  float64            `json:"total"`
+	ID       primitive.ObjectID `json:"id"`
+	Reason   string             `json:"reason"`
+	Total    float64            `json:"total"`
+	TotalTax float64            `json:"totalTax"`
 }
 
 //  List of rental packages
@@ -2695,6 +3102,18 @@ type ReviewEdge struct {
 	Node   *Review `json:"node"`
 }
 
+type ReviewSetting struct {
+	RequireApproval bool     `json:"requireApproval"`
+	HoldWords       []string `json:"holdWords"`
+	SpamWords       []string `json:"spamWords"`
+}
+
+type ReviewSettingInput struct {
+	RequireApproval bool     `json:"requireApproval"`
+	HoldWords       []string `json:"holdWords"`
+	SpamWords       []string `json:"spamWords"`
+}
+
 type ReviewerAvatarUrls struct {
 	ID    primitive.ObjectID `json:"id"`
 	Num24 string             `json:"num24"`
@@ -2785,6 +3204,29 @@ type SMSTemplateEdge struct {
 	Node   *SMSTemplate `json:"node"`
 }
 
+type SaveCardInput struct {
+	Gateway            *string `json:"gateway"`
+	PaymentMethodToken string  `json:"paymentMethodToken"`
+	MakeDefault        *bool   `json:"makeDefault"`
+}
+
+type SaveCardPayload struct {
+	PaymentMethod *PaymentMethod `json:"paymentMethod"`
+	Duplicate     bool           `json:"duplicate"`
+}
+
+type SearchSynonymConnection struct {
+	TotalCount int                  `json:"totalCount"`
+	Edges      []*SearchSynonymEdge `json:"edges"`
+	Nodes      []*SearchSynonym     `json:"nodes"`
+	PageInfo   *PageInfo            `json:"pageInfo"`
+}
+
+type SearchSynonymEdge struct {
+	Cursor string         `json:"cursor"`
+	Node   *SearchSynonym `json:"node"`
+}
+
 type ServiceCompaniesConnection struct {
 	TotalCount int                   `json:"totalCount"`
 	Nodes      []*ServiceCompany     `json:"nodes"`
@@ -2938,6 +3380,13 @@ type ServiceVehicleTypeEdge struct {
 	Node   *ServiceVehicleType `json:"node"`
 }
 
+type SetStoreUPIMerchantAccountInput struct {
+	StoreID primitive.ObjectID `json:"storeID"`
+	Mid     string             `json:"mid"`
+	Vpa     string             `json:"vpa"`
+	Name    *string            `json:"name"`
+}
+
 type Shipping struct {
 	FirstName string `json:"firstName"`
 	LastName  string `json:"lastName"`
@@ -3095,6 +3544,15 @@ type StoreEdge struct {
 	Node   *Store `json:"node"`
 }
 
+type StoreHoursInput struct {
+	Timezone              string                  `json:"timezone"`
+	OpeningHours          []*OpeningHoursInput    `json:"openingHours"`
+	HolidayOverrides      []*HolidayOverrideInput `json:"holidayOverrides"`
+	DeliverySlots         []*DeliverySlotInput    `json:"deliverySlots"`
+	AcceptScheduledOrders bool                    `json:"acceptScheduledOrders"`
+	ScheduleDays          *int                    `json:"scheduleDays"`
+}
+
 // List of Store locations
 type StoreLocationConnection struct {
 	// Total number of nodes
@@ -3213,6 +3671,16 @@ type StoreVehicleTypeEdge struct {
 	Node   *StoreVehicleType `json:"node"`
 }
 
+type SubscribeInput struct {
+	PlanID            primitive.ObjectID   `json:"planID"`
+	Quantity          *int                 `json:"quantity"`
+	Billing           *SubscriptionBilling `json:"billing"`
+	DaysUntilDue      *int                 `json:"daysUntilDue"`
+	PaymentGateway    *string              `json:"paymentGateway"`
+	GatewayCustomerID *string              `json:"gatewayCustomerID"`
+	PaymentMethodID   *string              `json:"paymentMethodID"`
+}
+
 type SubscriberPayload struct {
 	ID        *primitive.ObjectID         `json:"id"`
 	Name      *string                     `json:"name"`
@@ -3222,6 +3690,67 @@ type SubscriberPayload struct {
 	IPAddress *string                     `json:"ipAddress"`
 }
 
+type SubscriptionBillingSetting struct {
+	RetryDays         []int `json:"retryDays"`
+	CancelWhenUnpaid  bool  `json:"cancelWhenUnpaid"`
+	TrialReminderDays int   `json:"trialReminderDays"`
+}
+
+type SubscriptionBillingSettingInput struct {
+	RetryDays         []int `json:"retryDays"`
+	CancelWhenUnpaid  bool  `json:"cancelWhenUnpaid"`
+	TrialReminderDays int   `json:"trialReminderDays"`
+}
+
+// List of SubscriptionInvoice
+type SubscriptionInvoiceConnection struct {
+	// Total number of nodes
+	TotalCount int `json:"totalCount"`
+	// A list of edges
+	Edges []*SubscriptionInvoiceEdge `json:"edges"`
+	// A list of nodes.
+	Nodes []*SubscriptionInvoice `json:"nodes"`
+	// Information to aid in pagination.
+	PageInfo *PageInfo `json:"pageInfo"`
+}
+
+//  Paginating the node SubscriptionInvoice
+type SubscriptionInvoiceEdge struct {
+	Cursor string               `json:"cursor"`
+	Node   *SubscriptionInvoice `json:"node"`
+}
+
+// List of SubscriptionPlan
+type SubscriptionPlanConnection struct {
+	// Total number of nodes
+	TotalCount int `json:"totalCount"`
+	// A list of edges
+	Edges []*SubscriptionPlanEdge `json:"edges"`
+	// A list of nodes.
+	Nodes []*SubscriptionPlan `json:"nodes"`
+	// Information to aid in pagination.
+	PageInfo *PageInfo `json:"pageInfo"`
+}
+
+//  Paginating the node SubscriptionPlan
+type SubscriptionPlanEdge struct {
+	Cursor string            `json:"cursor"`
+	Node   *SubscriptionPlan `json:"node"`
+}
+
+type SubscriptionPlanTierInput struct {
+	FlatAmount float64 `json:"flatAmount"`
+	UnitAmount float64 `json:"unitAmount"`
+	UpTo       int     `json:"upTo"`
+}
+
+type SubscriptionUsageInput struct {
+	SubscriptionID primitive.ObjectID       `json:"subscriptionID"`
+	Quantity       int                      `json:"quantity"`
+	Action         *SubscriptionUsageAction `json:"action"`
+	Timestamp      *time.Time               `json:"timestamp"`
+}
+
 type SupportAgent struct {
 	ID          primitive.ObjectID   `json:"id"`
 	User        string               `json:"user"`
@@ -3247,14 +3776,45 @@ type SupportSkills struct {
 }
 
 type TaxLines struct {
-	ID               int      `json:"id"`
-	RateCode         string   `json:"rateCode"`
-	RateID           int      `json:"rateID"`
-	Label            string   `json:"label"`
-	Compound         bool     `json:"compound"`
-	TaxTotal         string   `json:"taxTotal"`
-	ShippingTaxTotal string   `json:"shippingTaxTotal"`
-	MetaData         []string `json:"metaData"`
+	ID               int                 `json:"id"`
+	RateCode         string              `json:"rateCode"`
+	RateID           *primitive.ObjectID `json:"rateID"`
+	Label            string              `json:"label"`
+	Compound         bool                `json:"compound"`
+	RatePercent      float64             `json:"ratePercent"`
+	TaxTotal         string              `json:"taxTotal"`
+	ShippingTaxTotal string              `json:"shippingTaxTotal"`
+	MetaData         []string            `json:"metaData"`
+}
+
+type TaxRuleConnection struct {
+	TotalCount int            `json:"totalCount"`
+	Edges      []*TaxRuleEdge `json:"edges"`
+	Nodes      []*TaxRule     `json:"nodes"`
+	PageInfo   *PageInfo      `json:"pageInfo"`
+}
+
+type TaxRuleEdge struct {
+	Cursor string   `json:"cursor"`
+	Node   *TaxRule `json:"node"`
+}
+
+type TaxSetting struct {
+	EnableTaxes      bool            `json:"enableTaxes"`
+	PricesIncludeTax bool            `json:"pricesIncludeTax"`
+	RoundingMode     TaxRoundingMode `json:"roundingMode"`
+	RoundAtSubtotal  bool            `json:"roundAtSubtotal"`
+	ShippingTaxClass string          `json:"shippingTaxClass"`
+	FareTaxClass     string          `json:"fareTaxClass"`
+}
+
+type TaxSettingInput struct {
+	EnableTaxes      bool            `json:"enableTaxes"`
+	PricesIncludeTax bool            `json:"pricesIncludeTax"`
+	RoundingMode     TaxRoundingMode `json:"roundingMode"`
+	RoundAtSubtotal  bool            `json:"roundAtSubtotal"`
+	ShippingTaxClass string          `json:"shippingTaxClass"`
+	FareTaxClass     string          `json:"fareTaxClass"`
 }
 
 type Taxes struct {
@@ -3263,6 +3823,23 @@ type Taxes struct {
 	Subtotal string `json:"subtotal"`
 }
 
+type UPIAddressValidation struct {
+	Vpa   string  `json:"vpa"`
+	Valid bool    `json:"valid"`
+	Name  *string `json:"name"`
+}
+
+type UPICollectRequestInput struct {
+	OrderID *primitive.ObjectID `json:"orderID"`
+	JobID   *primitive.ObjectID `json:"jobID"`
+	Vpa     string              `json:"vpa"`
+}
+
+type UPIIntentInput struct {
+	OrderID *primitive.ObjectID `json:"orderID"`
+	JobID   *primitive.ObjectID `json:"jobID"`
+}
+
 type UnitPrice struct {
 	Amount      int    `json:"amount"`
 	Currency    string `json:"currency"`
@@ -3588,16 +4165,22 @@ type UpdateManageDocumentInput struct {
 }
 
 type UpdateMarketSettingsInput struct {
-	ID           primitive.ObjectID        `json:"id"`
-	General      *GeneralSettingInput      `json:"general"`
-	Email        *EmailSettingInput        `json:"email"`
-	Appearance   *AppearanceSettingInput   `json:"appearance"`
-	Sms          *SMSSettingInput          `json:"sms"`
-	SocialMedia  *SocialMediaSettingInput  `json:"socialMedia"`
-	App          *AppSettingInput          `json:"app"`
-	Installation *InstallationSettingInput `json:"installation"`
-	Store        *StoreSettingInput        `json:"store"`
-	Payment      *PaymentSettingInput      `json:"payment"`
+	ID                  primitive.ObjectID               `json:"id"`
+	General             *GeneralSettingInput             `json:"general"`
+	Email               *EmailSettingInput               `json:"email"`
+	Appearance          *AppearanceSettingInput          `json:"appearance"`
+	Sms                 *SMSSettingInput                 `json:"sms"`
+	SocialMedia         *SocialMediaSettingInput         `json:"socialMedia"`
+	App                 *AppSettingInput                 `json:"app"`
+	Installation        *InstallationSettingInput        `json:"installation"`
+	Store               *StoreSettingInput               `json:"store"`
+	Payment             *PaymentSettingInput             `json:"payment"`
+	Tax                 *TaxSettingInput                 `json:"tax"`
+	Review              *ReviewSettingInput              `json:"review"`
+	CartRecovery        *CartRecoverySettingInput        `json:"cartRecovery"`
+	SubscriptionBilling *SubscriptionBillingSettingInput `json:"subscriptionBilling"`
+	Withdrawal          *WithdrawalSettingInput          `json:"withdrawal"`
+	CashLiability       *CashLiabilitySettingInput       `json:"cashLiability"`
 }
 
 type UpdateOAuthApplicationInput struct {
@@ -3620,7 +4203,7 @@ type UpdateOAuthApplicationInput struct {
 
 type UpdateOrderInput struct {
 	ID                 primitive.ObjectID `json:"id"`
-	OrderItems         *OrderItemInput    `json:"orderItems"`
+	OrderItems         []*OrderItemInput  `json:"orderItems"`
 	ServiceType        string             `json:"serviceType"`
 	Coupon             string             `json:"coupon"`
 	ProviderID         primitive.ObjectID `json:"providerID"`
@@ -3641,6 +4224,7 @@ type UpdateOrderInput struct {
 
 type UpdateOrderNoteInput struct {
 	ID           primitive.ObjectID `json:"id"`
+	OrderID      primitive.ObjectID `json:"orderID"`
 	Author       string             `json:"author"`
 	Note         string             `json:"note"`
 	CustomerNote bool               `json:"customerNote"`
@@ -3651,6 +4235,14 @@ type UpdateOrderStatusUtilityInput struct {
 	ID                primitive.ObjectID `json:"id"`
 	StatusTitle       string             `json:"statusTitle"`
 	StatusDescription string             `json:"statusDescription"`
+	Status            OrderStatus        `json:"status"`
+	ServiceCategory   StoreCategory      `json:"serviceCategory"`
+	NextStatuses      []OrderStatus      `json:"nextStatuses"`
+	NotifyCustomer    bool               `json:"notifyCustomer"`
+	NotifyStore       bool               `json:"notifyStore"`
+	ReleaseStock      bool               `json:"releaseStock"`
+	RefundPayment     bool               `json:"refundPayment"`
+	WebhookEvent      string             `json:"webhookEvent"`
 	IsActive          bool               `json:"isActive"`
 }
 
@@ -3818,12 +4410,10 @@ type UpdateProductMetadataInput struct {
 type UpdateProductReviewInput struct {
 	ID                 primitive.ObjectID       `json:"id"`
 	ProductID          string                   `json:"productID"`
-	Status             ProductStatus            `json:"status"`
 	Reviewer           string                   `json:"reviewer"`
 	ReviewerEmail      string                   `json:"reviewerEmail"`
 	Review             string                   `json:"review"`
 	Rating             int                      `json:"rating"`
-	Verified           bool                     `json:"verified"`
 	ReviewerAvatarURLs *ReviewerAvatarUrlsInput `json:"reviewerAvatarURLs"`
 }
 
@@ -3883,20 +4473,16 @@ type UpdateRentalPackageInput struct {
 }
 
 type UpdateReviewInput struct {
-	ID                    primitive.ObjectID `json:"id"`
-	JobID                 primitive.ObjectID `json:"jobId"`
-	UserName              string             `json:"userName"`
-	UserAverageRating     float64            `json:"userAverageRating"`
-	ProviderAverageRating float64            `json:"providerAverageRating"`
-	ProviderName          string             `json:"providerName"`
-	UserRating            float64            `json:"userRating"`
-	ProviderRating        float64            `json:"providerRating"`
-	Type                  ReviewType         `json:"type"`
-	From                  string             `json:"from"`
-	To                    string             `json:"to"`
-	Date                  time.Time          `json:"date"`
-	Comment               string             `json:"comment"`
-	IsActive              bool               `json:"isActive"`
+	ID           primitive.ObjectID `json:"id"`
+	JobID        primitive.ObjectID `json:"jobId"`
+	UserName     string             `json:"userName"`
+	ProviderName string             `json:"providerName"`
+	Type         ReviewType         `json:"type"`
+	From         string             `json:"from"`
+	To           string             `json:"to"`
+	Date         time.Time          `json:"date"`
+	Comment      string             `json:"comment"`
+	IsActive     bool               `json:"isActive"`
 }
 
 type UpdateRideProfileTypeInput struct {
@@ -3921,6 +4507,12 @@ type UpdateSEOSettingInput struct {
 	MetaDescription *string             `json:"metaDescription"`
 }
 
+type UpdateSearchSynonymInput struct {
+	ID       primitive.ObjectID `json:"id"`
+	Terms    []string           `json:"terms"`
+	IsActive bool               `json:"isActive"`
+}
+
 type UpdateServiceCompanyInput struct {
 	ID             primitive.ObjectID  `json:"id"`
 	Name           string              `json:"name"`
@@ -4083,7 +4675,9 @@ type UpdateStoreInput struct {
 	MaxOrderQuantity         string                      `json:"maxOrderQuantity"`
 	EstimatedOrderTime       int                         `json:"estimatedOrderTime"`
 	OfferAppliesOn           OfferAppliesOn              `json:"offerAppliesOn"`
+	CommissionRate           float64                     `json:"commissionRate"`
 	BankAccountDetails       *UpdateBankDetailsInput     `json:"bankAccountDetails"`
+	Metadata                 map[string]interface{}      `json:"metadata"`
 }
 
 type UpdateStoreLocationInput struct {
@@ -4104,6 +4698,21 @@ type UpdateStoreVehicleTypeInput struct {
 	IsActive                  bool                     `json:"isActive"`
 }
 
+type UpdateTaxRuleInput struct {
+	ID       primitive.ObjectID `json:"id"`
+	Country  string             `json:"country"`
+	State    string             `json:"state"`
+	City     string             `json:"city"`
+	PostCode string             `json:"postCode"`
+	TaxClass string             `json:"taxClass"`
+	Rate     float64            `json:"rate"`
+	Name     string             `json:"name"`
+	Priority int                `json:"priority"`
+	Compound bool               `json:"compound"`
+	Shipping bool               `json:"shipping"`
+	IsActive bool               `json:"isActive"`
+}
+
 type UpdateUserInput struct {
 	ID           primitive.ObjectID `json:"id"`
 	FirstName    string             `json:"firstName"`
@@ -4341,6 +4950,12 @@ type VehicleServiceTypesInput struct {
 	ServiceOptions []*VehicleServiceOptionInput `json:"serviceOptions"`
 }
 
+type VerifyRazorpayPaymentInput struct {
+	RazorpayOrderID   string `json:"razorpayOrderID"`
+	RazorpayPaymentID string `json:"razorpayPaymentID"`
+	RazorpaySignature string `json:"razorpaySignature"`
+}
+
 //  List of VisitLocation
 type VisitLocationConnection struct {
 	// Total number of nodes
@@ -4359,6 +4974,24 @@ type VisitLocationEdge struct {
 	Node   *VisitLocation `json:"node"`
 }
 
+// List of Wallet Postings
+type WalletPostingConnection struct {
+	// Total number of nodes
+	TotalCount int `json:"totalCount"`
+	// A list of edges
+	Edges []*WalletPostingEdge `json:"edges"`
+	// A list of nodes.
+	Nodes []*WalletPosting `json:"nodes"`
+	// Information to aid in pagination.
+	PageInfo *PageInfo `json:"pageInfo"`
+}
+
+//  Paginating the node wallet posting
+type WalletPostingEdge struct {
+	Cursor string         `json:"cursor"`
+	Node   *WalletPosting `json:"node"`
+}
+
 // List of WalletTransaction
 type WalletTransactionConnection struct {
 	// Total number of nodes
@@ -4452,6 +5085,21 @@ type ProductData struct {
 	Type string             `json:"type"`
 }
 
+type WithdrawalSetting struct {
+	// Smallest amount a provider can withdraw
+	MinimumAmount float64 `json:"minimumAmount"`
+	// Hours a provider waits after a withdrawal request before the next one, none when 0
+	CooldownHours int `json:"cooldownHours"`
+	// Payout provider withdrawals are paid through, manual bank transfers when empty
+	PayoutProvider string `json:"payoutProvider"`
+}
+
+type WithdrawalSettingInput struct {
+	MinimumAmount  float64 `json:"minimumAmount"`
+	CooldownHours  int     `json:"cooldownHours"`
+	PayoutProvider string  `json:"payoutProvider"`
+}
+
 type AddPaymentMethod string
 
 const (
@@ -4672,18 +5320,22 @@ func (e AppStatus) MarshalGQL(w io.Writer) {
 type BalanceFor string
 
 const (
-	BalanceForBooking BalanceFor = "BOOKING"
-	BalanceForDeposit BalanceFor = "DEPOSIT"
+	BalanceForBooking    BalanceFor = "BOOKING"
+	BalanceForDeposit    BalanceFor = "DEPOSIT"
+	BalanceForRefund     BalanceFor = "REFUND"
+	BalanceForWithdrawal BalanceFor = "WITHDRAWAL"
 )
 
 var AllBalanceFor = []BalanceFor{
 	BalanceForBooking,
 	BalanceForDeposit,
+	BalanceForRefund,
+	BalanceForWithdrawal,
 }
 
 func (e BalanceFor) IsValid() bool {
 	switch e {
-	case BalanceForBooking, BalanceForDeposit:
+	case BalanceForBooking, BalanceForDeposit, BalanceForRefund, BalanceForWithdrawal:
 		return true
 	}
 	return false
@@ -5111,98 +5763,188 @@ func (e CartItemType) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
-type CategoryViewType string
+type CartRecoveryChannel string
 
 const (
-	CategoryViewTypeIcon       CategoryViewType = "ICON"
-	CategoryViewTypeBanner     CategoryViewType = "BANNER"
-	CategoryViewTypeIconBanner CategoryViewType = "ICON_BANNER"
+	CartRecoveryChannelEmail CartRecoveryChannel = "EMAIL"
+	CartRecoveryChannelSms   CartRecoveryChannel = "SMS"
+	CartRecoveryChannelPush  CartRecoveryChannel = "PUSH"
 )
 
-var AllCategoryViewType = []CategoryViewType{
-	CategoryViewTypeIcon,
-	CategoryViewTypeBanner,
-	CategoryViewTypeIconBanner,
+var AllCartRecoveryChannel = []CartRecoveryChannel{
+	CartRecoveryChannelEmail,
+	CartRecoveryChannelSms,
+	CartRecoveryChannelPush,
 }
 
-func (e CategoryViewType) IsValid() bool {
+func (e CartRecoveryChannel) IsValid() bool {
 	switch e {
-	case CategoryViewTypeIcon, CategoryViewTypeBanner, CategoryViewTypeIconBanner:
+	case CartRecoveryChannelEmail, CartRecoveryChannelSms, CartRecoveryChannelPush:
 		return true
 	}
 	return false
 }
 
-func (e CategoryViewType) String() string {
+func (e CartRecoveryChannel) String() string {
 	return string(e)
 }
 
-func (e *CategoryViewType) UnmarshalGQL(v interface{}) error {
+func (e *CartRecoveryChannel) UnmarshalGQL(v interface{}) error {
 	str, ok := v.(string)
 	if !ok {
 		return fmt.Errorf("enums must be strings")
 	}
 
-	*e = CategoryViewType(str)
+	*e = CartRecoveryChannel(str)
 	if !e.IsValid() {
-		return fmt.Errorf("%s is not a valid CategoryViewType", str)
+		return fmt.Errorf("%s is not a valid CartRecoveryChannel", str)
 	}
 	return nil
 }
 
-func (e CategoryViewType) MarshalGQL(w io.Writer) {
+func (e CartRecoveryChannel) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
-type ChatMessageType string
+type CashLiabilityEntryType string
 
 const (
-	ChatMessageTypeLiveChat       ChatMessageType = "LIVE_CHAT"
-	ChatMessageTypeOfflineMessage ChatMessageType = "OFFLINE_MESSAGE"
+	CashLiabilityEntryTypeCashJob          CashLiabilityEntryType = "CASH_JOB"
+	CashLiabilityEntryTypeCashOrder        CashLiabilityEntryType = "CASH_ORDER"
+	CashLiabilityEntryTypeWalletOffset     CashLiabilityEntryType = "WALLET_OFFSET"
+	CashLiabilityEntryTypeSettlementOffset CashLiabilityEntryType = "SETTLEMENT_OFFSET"
+	CashLiabilityEntryTypePayment          CashLiabilityEntryType = "PAYMENT"
 )
 
-var AllChatMessageType = []ChatMessageType{
-	ChatMessageTypeLiveChat,
-	ChatMessageTypeOfflineMessage,
+var AllCashLiabilityEntryType = []CashLiabilityEntryType{
+	CashLiabilityEntryTypeCashJob,
+	CashLiabilityEntryTypeCashOrder,
+	CashLiabilityEntryTypeWalletOffset,
+	CashLiabilityEntryTypeSettlementOffset,
+	CashLiabilityEntryTypePayment,
 }
 
-func (e ChatMessageType) IsValid() bool {
+func (e CashLiabilityEntryType) IsValid() bool {
 	switch e {
-	case ChatMessageTypeLiveChat, ChatMessageTypeOfflineMessage:
+	case CashLiabilityEntryTypeCashJob, CashLiabilityEntryTypeCashOrder, CashLiabilityEntryTypeWalletOffset, CashLiabilityEntryTypeSettlementOffset, CashLiabilityEntryTypePayment:
 		return true
 	}
 	return false
 }
 
-func (e ChatMessageType) String() string {
+func (e CashLiabilityEntryType) String() string {
 	return string(e)
 }
 
-func (e *ChatMessageType) UnmarshalGQL(v interface{}) error {
+func (e *CashLiabilityEntryType) UnmarshalGQL(v interface{}) error {
 	str, ok := v.(string)
 	if !ok {
 		return fmt.Errorf("enums must be strings")
 	}
 
-	*e = ChatMessageType(str)
+	*e = CashLiabilityEntryType(str)
 	if !e.IsValid() {
-		return fmt.Errorf("%s is not a valid ChatMessageType", str)
+		return fmt.Errorf("%s is not a valid CashLiabilityEntryType", str)
 	}
 	return nil
 }
 
-func (e ChatMessageType) MarshalGQL(w io.Writer) {
+func (e CashLiabilityEntryType) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
-type CityType string
+type CategoryViewType string
 
 const (
-	CityTypeAll     CityType = "ALL"
-	CityTypeCity    CityType = "CITY"
-	CityTypeState   CityType = "STATE"
-	CityTypeCountry CityType = "COUNTRY"
-	CityTypeStatus  CityType = "STATUS"
+	CategoryViewTypeIcon       CategoryViewType = "ICON"
+	CategoryViewTypeBanner     CategoryViewType = "BANNER"
+	CategoryViewTypeIconBanner CategoryViewType = "ICON_BANNER"
+)
+
+var AllCategoryViewType = []CategoryViewType{
+	CategoryViewTypeIcon,
+	CategoryViewTypeBanner,
+	CategoryViewTypeIconBanner,
+}
+
+func (e CategoryViewType) IsValid() bool {
+	switch e {
+	case CategoryViewTypeIcon, CategoryViewTypeBanner, CategoryViewTypeIconBanner:
+		return true
+	}
+	return false
+}
+
+func (e CategoryViewType) String() string {
+	return string(e)
+}
+
+func (e *CategoryViewType) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = CategoryViewType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid CategoryViewType", str)
+	}
+	return nil
+}
+
+func (e CategoryViewType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ChatMessageType string
+
+const (
+	ChatMessageTypeLiveChat       ChatMessageType = "LIVE_CHAT"
+	ChatMessageTypeOfflineMessage ChatMessageType = "OFFLINE_MESSAGE"
+)
+
+var AllChatMessageType = []ChatMessageType{
+	ChatMessageTypeLiveChat,
+	ChatMessageTypeOfflineMessage,
+}
+
+func (e ChatMessageType) IsValid() bool {
+	switch e {
+	case ChatMessageTypeLiveChat, ChatMessageTypeOfflineMessage:
+		return true
+	}
+	return false
+}
+
+func (e ChatMessageType) String() string {
+	return string(e)
+}
+
+func (e *ChatMessageType) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ChatMessageType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ChatMessageType", str)
+	}
+	return nil
+}
+
+func (e ChatMessageType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type CityType string
+
+const (
+	CityTypeAll     CityType = "ALL"
+	CityTypeCity    CityType = "CITY"
+	CityTypeState   CityType = "STATE"
+	CityTypeCountry CityType = "COUNTRY"
+	CityTypeStatus  CityType = "STATUS"
 )
 
 var AllCityType = []CityType{
@@ -7502,6 +8244,55 @@ func (e JobLaterType) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
+type JobPaymentStatus string
+
+const (
+	JobPaymentStatusPending           JobPaymentStatus = "PENDING"
+	JobPaymentStatusPaid              JobPaymentStatus = "PAID"
+	JobPaymentStatusFailed            JobPaymentStatus = "FAILED"
+	JobPaymentStatusCancelled         JobPaymentStatus = "CANCELLED"
+	JobPaymentStatusPartiallyRefunded JobPaymentStatus = "PARTIALLY_REFUNDED"
+	JobPaymentStatusRefunded          JobPaymentStatus = "REFUNDED"
+)
+
+var AllJobPaymentStatus = []JobPaymentStatus{
+	JobPaymentStatusPending,
+	JobPaymentStatusPaid,
+	JobPaymentStatusFailed,
+	JobPaymentStatusCancelled,
+	JobPaymentStatusPartiallyRefunded,
+	JobPaymentStatusRefunded,
+}
+
+func (e JobPaymentStatus) IsValid() bool {
+	switch e {
+	case JobPaymentStatusPending, JobPaymentStatusPaid, JobPaymentStatusFailed, JobPaymentStatusCancelled, JobPaymentStatusPartiallyRefunded, JobPaymentStatusRefunded:
+		return true
+	}
+	return false
+}
+
+func (e JobPaymentStatus) String() string {
+	return string(e)
+}
+
+func (e *JobPaymentStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = JobPaymentStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid JobPaymentStatus", str)
+	}
+	return nil
+}
+
+func (e JobPaymentStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
 type JobServiceType string
 
 const (
@@ -7863,13 +8654,111 @@ func (e OfferAppliesOn) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
+type OrderRefundMethod string
+
+const (
+	OrderRefundMethodGateway OrderRefundMethod = "GATEWAY"
+	OrderRefundMethodWallet  OrderRefundMethod = "WALLET"
+)
+
+var AllOrderRefundMethod = []OrderRefundMethod{
+	OrderRefundMethodGateway,
+	OrderRefundMethodWallet,
+}
+
+func (e OrderRefundMethod) IsValid() bool {
+	switch e {
+	case OrderRefundMethodGateway, OrderRefundMethodWallet:
+		return true
+	}
+	return false
+}
+
+func (e OrderRefundMethod) String() string {
+	return string(e)
+}
+
+func (e *OrderRefundMethod) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = OrderRefundMethod(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid OrderRefundMethod", str)
+	}
+	return nil
+}
+
+func (e OrderRefundMethod) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type OrderRefundStatus string
+
+const (
+	OrderRefundStatusPendingApproval OrderRefundStatus = "PENDING_APPROVAL"
+	OrderRefundStatusApproved        OrderRefundStatus = "APPROVED"
+	OrderRefundStatusProcessing      OrderRefundStatus = "PROCESSING"
+	OrderRefundStatusProcessed       OrderRefundStatus = "PROCESSED"
+	OrderRefundStatusRejected        OrderRefundStatus = "REJECTED"
+	OrderRefundStatusFailed          OrderRefundStatus = "FAILED"
+)
+
+var AllOrderRefundStatus = []OrderRefundStatus{
+	OrderRefundStatusPendingApproval,
+	OrderRefundStatusApproved,
+	OrderRefundStatusProcessing,
+	OrderRefundStatusProcessed,
+	OrderRefundStatusRejected,
+	OrderRefundStatusFailed,
+}
+
+func (e OrderRefundStatus) IsValid() bool {
+	switch e {
+	case OrderRefundStatusPendingApproval, OrderRefundStatusApproved, OrderRefundStatusProcessing, OrderRefundStatusProcessed, OrderRefundStatusRejected, OrderRefundStatusFailed:
+		return true
+	}
+	return false
+}
+
+func (e OrderRefundStatus) String() string {
+	return string(e)
+}
+
+func (e *OrderRefundStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = OrderRefundStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid OrderRefundStatus", str)
+	}
+	return nil
+}
+
+func (e OrderRefundStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
 type OrderStatus string
 
 const (
-	OrderStatusPlaced     OrderStatus = "PLACED"
-	OrderStatusDeclined   OrderStatus = "DECLINED"
-	OrderStatusDelivered  OrderStatus = "DELIVERED"
-	OrderStatusProcessing OrderStatus = "PROCESSING"
+	OrderStatusPlaced         OrderStatus = "PLACED"
+	OrderStatusDeclined       OrderStatus = "DECLINED"
+	OrderStatusDelivered      OrderStatus = "DELIVERED"
+	OrderStatusProcessing     OrderStatus = "PROCESSING"
+	OrderStatusPendingPayment OrderStatus = "PENDING_PAYMENT"
+	OrderStatusAccepted       OrderStatus = "ACCEPTED"
+	OrderStatusReady          OrderStatus = "READY"
+	OrderStatusDispatched     OrderStatus = "DISPATCHED"
+	OrderStatusCompleted      OrderStatus = "COMPLETED"
+	OrderStatusCancelled      OrderStatus = "CANCELLED"
+	OrderStatusFailed         OrderStatus = "FAILED"
+	OrderStatusRefunded       OrderStatus = "REFUNDED"
 )
 
 var AllOrderStatus = []OrderStatus{
@@ -7877,11 +8766,19 @@ var AllOrderStatus = []OrderStatus{
 	OrderStatusDeclined,
 	OrderStatusDelivered,
 	OrderStatusProcessing,
+	OrderStatusPendingPayment,
+	OrderStatusAccepted,
+	OrderStatusReady,
+	OrderStatusDispatched,
+	OrderStatusCompleted,
+	OrderStatusCancelled,
+	OrderStatusFailed,
+	OrderStatusRefunded,
 }
 
 func (e OrderStatus) IsValid() bool {
 	switch e {
-	case OrderStatusPlaced, OrderStatusDeclined, OrderStatusDelivered, OrderStatusProcessing:
+	case OrderStatusPlaced, OrderStatusDeclined, OrderStatusDelivered, OrderStatusProcessing, OrderStatusPendingPayment, OrderStatusAccepted, OrderStatusReady, OrderStatusDispatched, OrderStatusCompleted, OrderStatusCancelled, OrderStatusFailed, OrderStatusRefunded:
 		return true
 	}
 	return false
@@ -8033,6 +8930,49 @@ func (e PaymentBy) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
+type PaymentDisputeStatus string
+
+const (
+	PaymentDisputeStatusOpen PaymentDisputeStatus = "OPEN"
+	PaymentDisputeStatusWon  PaymentDisputeStatus = "WON"
+	PaymentDisputeStatusLost PaymentDisputeStatus = "LOST"
+)
+
+var AllPaymentDisputeStatus = []PaymentDisputeStatus{
+	PaymentDisputeStatusOpen,
+	PaymentDisputeStatusWon,
+	PaymentDisputeStatusLost,
+}
+
+func (e PaymentDisputeStatus) IsValid() bool {
+	switch e {
+	case PaymentDisputeStatusOpen, PaymentDisputeStatusWon, PaymentDisputeStatusLost:
+		return true
+	}
+	return false
+}
+
+func (e PaymentDisputeStatus) String() string {
+	return string(e)
+}
+
+func (e *PaymentDisputeStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = PaymentDisputeStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid PaymentDisputeStatus", str)
+	}
+	return nil
+}
+
+func (e PaymentDisputeStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
 type PaymentEnvironment string
 
 const (
@@ -8340,137 +9280,313 @@ func (e PriceBasedOn) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
-type ProductSearchType string
+type PriceRuleStatus string
 
 const (
-	ProductSearchTypeAll            ProductSearchType = "ALL"
-	ProductSearchTypeItem           ProductSearchType = "ITEM"
-	ProductSearchTypeCategory       ProductSearchType = "CATEGORY"
-	ProductSearchTypeRestaurantName ProductSearchType = "RESTAURANT_NAME"
+	PriceRuleStatusScheduled  PriceRuleStatus = "SCHEDULED"
+	PriceRuleStatusActive     PriceRuleStatus = "ACTIVE"
+	PriceRuleStatusEnded      PriceRuleStatus = "ENDED"
+	PriceRuleStatusRolledBack PriceRuleStatus = "ROLLED_BACK"
 )
 
-var AllProductSearchType = []ProductSearchType{
-	ProductSearchTypeAll,
-	ProductSearchTypeItem,
-	ProductSearchTypeCategory,
-	ProductSearchTypeRestaurantName,
+var AllPriceRuleStatus = []PriceRuleStatus{
+	PriceRuleStatusScheduled,
+	PriceRuleStatusActive,
+	PriceRuleStatusEnded,
+	PriceRuleStatusRolledBack,
 }
 
-func (e ProductSearchType) IsValid() bool {
+func (e PriceRuleStatus) IsValid() bool {
 	switch e {
-	case ProductSearchTypeAll, ProductSearchTypeItem, ProductSearchTypeCategory, ProductSearchTypeRestaurantName:
+	case PriceRuleStatusScheduled, PriceRuleStatusActive, PriceRuleStatusEnded, PriceRuleStatusRolledBack:
 		return true
 	}
 	return false
 }
 
-func (e ProductSearchType) String() string {
+func (e PriceRuleStatus) String() string {
 	return string(e)
 }
 
-func (e *ProductSearchType) UnmarshalGQL(v interface{}) error {
+func (e *PriceRuleStatus) UnmarshalGQL(v interface{}) error {
 	str, ok := v.(string)
 	if !ok {
 		return fmt.Errorf("enums must be strings")
 	}
 
-	*e = ProductSearchType(str)
+	*e = PriceRuleStatus(str)
 	if !e.IsValid() {
-		return fmt.Errorf("%s is not a valid ProductSearchType", str)
+		return fmt.Errorf("%s is not a valid PriceRuleStatus", str)
 	}
 	return nil
 }
 
-func (e ProductSearchType) MarshalGQL(w io.Writer) {
+func (e PriceRuleStatus) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
-type ProductStatus string
+type PriceRuleTarget string
 
 const (
-	ProductStatusActive   ProductStatus = "ACTIVE"
-	ProductStatusInactive ProductStatus = "INACTIVE"
-	ProductStatusDeleted  ProductStatus = "DELETED"
-	ProductStatusPublish  ProductStatus = "PUBLISH"
-	ProductStatusPost     ProductStatus = "POST"
-	ProductStatusDraft    ProductStatus = "DRAFT"
-	ProductStatusPending  ProductStatus = "PENDING"
-	ProductStatusPrivate  ProductStatus = "PRIVATE"
+	PriceRuleTargetCategory   PriceRuleTarget = "CATEGORY"
+	PriceRuleTargetCollection PriceRuleTarget = "COLLECTION"
 )
 
-var AllProductStatus = []ProductStatus{
-	ProductStatusActive,
-	ProductStatusInactive,
-	ProductStatusDeleted,
-	ProductStatusPublish,
-	ProductStatusPost,
-	ProductStatusDraft,
-	ProductStatusPending,
-	ProductStatusPrivate,
+var AllPriceRuleTarget = []PriceRuleTarget{
+	PriceRuleTargetCategory,
+	PriceRuleTargetCollection,
 }
 
-func (e ProductStatus) IsValid() bool {
+func (e PriceRuleTarget) IsValid() bool {
 	switch e {
-	case ProductStatusActive, ProductStatusInactive, ProductStatusDeleted, ProductStatusPublish, ProductStatusPost, ProductStatusDraft, ProductStatusPending, ProductStatusPrivate:
+	case PriceRuleTargetCategory, PriceRuleTargetCollection:
 		return true
 	}
 	return false
 }
 
-func (e ProductStatus) String() string {
+func (e PriceRuleTarget) String() string {
 	return string(e)
 }
 
-func (e *ProductStatus) UnmarshalGQL(v interface{}) error {
+func (e *PriceRuleTarget) UnmarshalGQL(v interface{}) error {
 	str, ok := v.(string)
 	if !ok {
 		return fmt.Errorf("enums must be strings")
 	}
 
-	*e = ProductStatus(str)
+	*e = PriceRuleTarget(str)
 	if !e.IsValid() {
-		return fmt.Errorf("%s is not a valid ProductStatus", str)
+		return fmt.Errorf("%s is not a valid PriceRuleTarget", str)
 	}
 	return nil
 }
 
-func (e ProductStatus) MarshalGQL(w io.Writer) {
+func (e PriceRuleTarget) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
-type ProviderStatus string
+type ProductImportJobStatus string
 
 const (
-	ProviderStatusActive   ProviderStatus = "ACTIVE"
-	ProviderStatusInactive ProviderStatus = "INACTIVE"
-	ProviderStatusDeleted  ProviderStatus = "DELETED"
+	ProductImportJobStatusQueued    ProductImportJobStatus = "QUEUED"
+	ProductImportJobStatusRunning   ProductImportJobStatus = "RUNNING"
+	ProductImportJobStatusCompleted ProductImportJobStatus = "COMPLETED"
+	ProductImportJobStatusFailed    ProductImportJobStatus = "FAILED"
 )
 
-var AllProviderStatus = []ProviderStatus{
-	ProviderStatusActive,
-	ProviderStatusInactive,
-	ProviderStatusDeleted,
+var AllProductImportJobStatus = []ProductImportJobStatus{
+	ProductImportJobStatusQueued,
+	ProductImportJobStatusRunning,
+	ProductImportJobStatusCompleted,
+	ProductImportJobStatusFailed,
 }
 
-func (e ProviderStatus) IsValid() bool {
+func (e ProductImportJobStatus) IsValid() bool {
 	switch e {
-	case ProviderStatusActive, ProviderStatusInactive, ProviderStatusDeleted:
+	case ProductImportJobStatusQueued, ProductImportJobStatusRunning, ProductImportJobStatusCompleted, ProductImportJobStatusFailed:
 		return true
 	}
 	return false
 }
 
-func (e ProviderStatus) String() string {
+func (e ProductImportJobStatus) String() string {
 	return string(e)
 }
 
-func (e *ProviderStatus) UnmarshalGQL(v interface{}) error {
+func (e *ProductImportJobStatus) UnmarshalGQL(v interface{}) error {
 	str, ok := v.(string)
 	if !ok {
 		return fmt.Errorf("enums must be strings")
 	}
 
-	*e = ProviderStatus(str)
+	*e = ProductImportJobStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ProductImportJobStatus", str)
+	}
+	return nil
+}
+
+func (e ProductImportJobStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ProductReviewStatus string
+
+const (
+	ProductReviewStatusPending  ProductReviewStatus = "PENDING"
+	ProductReviewStatusApproved ProductReviewStatus = "APPROVED"
+	ProductReviewStatusRejected ProductReviewStatus = "REJECTED"
+	ProductReviewStatusSpam     ProductReviewStatus = "SPAM"
+)
+
+var AllProductReviewStatus = []ProductReviewStatus{
+	ProductReviewStatusPending,
+	ProductReviewStatusApproved,
+	ProductReviewStatusRejected,
+	ProductReviewStatusSpam,
+}
+
+func (e ProductReviewStatus) IsValid() bool {
+	switch e {
+	case ProductReviewStatusPending, ProductReviewStatusApproved, ProductReviewStatusRejected, ProductReviewStatusSpam:
+		return true
+	}
+	return false
+}
+
+func (e ProductReviewStatus) String() string {
+	return string(e)
+}
+
+func (e *ProductReviewStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ProductReviewStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ProductReviewStatus", str)
+	}
+	return nil
+}
+
+func (e ProductReviewStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ProductSearchType string
+
+const (
+	ProductSearchTypeAll            ProductSearchType = "ALL"
+	ProductSearchTypeItem           ProductSearchType = "ITEM"
+	ProductSearchTypeCategory       ProductSearchType = "CATEGORY"
+	ProductSearchTypeRestaurantName ProductSearchType = "RESTAURANT_NAME"
+)
+
+var AllProductSearchType = []ProductSearchType{
+	ProductSearchTypeAll,
+	ProductSearchTypeItem,
+	ProductSearchTypeCategory,
+	ProductSearchTypeRestaurantName,
+}
+
+func (e ProductSearchType) IsValid() bool {
+	switch e {
+	case ProductSearchTypeAll, ProductSearchTypeItem, ProductSearchTypeCategory, ProductSearchTypeRestaurantName:
+		return true
+	}
+	return false
+}
+
+func (e ProductSearchType) String() string {
+	return string(e)
+}
+
+func (e *ProductSearchType) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ProductSearchType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ProductSearchType", str)
+	}
+	return nil
+}
+
+func (e ProductSearchType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ProductStatus string
+
+const (
+	ProductStatusActive   ProductStatus = "ACTIVE"
+	ProductStatusInactive ProductStatus = "INACTIVE"
+	ProductStatusDeleted  ProductStatus = "DELETED"
+	ProductStatusPublish  ProductStatus = "PUBLISH"
+	ProductStatusPost     ProductStatus = "POST"
+	ProductStatusDraft    ProductStatus = "DRAFT"
+	ProductStatusPending  ProductStatus = "PENDING"
+	ProductStatusPrivate  ProductStatus = "PRIVATE"
+)
+
+var AllProductStatus = []ProductStatus{
+	ProductStatusActive,
+	ProductStatusInactive,
+	ProductStatusDeleted,
+	ProductStatusPublish,
+	ProductStatusPost,
+	ProductStatusDraft,
+	ProductStatusPending,
+	ProductStatusPrivate,
+}
+
+func (e ProductStatus) IsValid() bool {
+	switch e {
+	case ProductStatusActive, ProductStatusInactive, ProductStatusDeleted, ProductStatusPublish, ProductStatusPost, ProductStatusDraft, ProductStatusPending, ProductStatusPrivate:
+		return true
+	}
+	return false
+}
+
+func (e ProductStatus) String() string {
+	return string(e)
+}
+
+func (e *ProductStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ProductStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ProductStatus", str)
+	}
+	return nil
+}
+
+func (e ProductStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type ProviderStatus string
+
+const (
+	ProviderStatusActive   ProviderStatus = "ACTIVE"
+	ProviderStatusInactive ProviderStatus = "INACTIVE"
+	ProviderStatusDeleted  ProviderStatus = "DELETED"
+)
+
+var AllProviderStatus = []ProviderStatus{
+	ProviderStatusActive,
+	ProviderStatusInactive,
+	ProviderStatusDeleted,
+}
+
+func (e ProviderStatus) IsValid() bool {
+	switch e {
+	case ProviderStatusActive, ProviderStatusInactive, ProviderStatusDeleted:
+		return true
+	}
+	return false
+}
+
+func (e ProviderStatus) String() string {
+	return string(e)
+}
+
+func (e *ProviderStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ProviderStatus(str)
 	if !e.IsValid() {
 		return fmt.Errorf("%s is not a valid ProviderStatus", str)
 	}
@@ -8700,6 +9816,49 @@ func (e RestrictType) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
+type ReviewModerationAction string
+
+const (
+	ReviewModerationActionApprove ReviewModerationAction = "APPROVE"
+	ReviewModerationActionReject  ReviewModerationAction = "REJECT"
+	ReviewModerationActionSpam    ReviewModerationAction = "SPAM"
+)
+
+var AllReviewModerationAction = []ReviewModerationAction{
+	ReviewModerationActionApprove,
+	ReviewModerationActionReject,
+	ReviewModerationActionSpam,
+}
+
+func (e ReviewModerationAction) IsValid() bool {
+	switch e {
+	case ReviewModerationActionApprove, ReviewModerationActionReject, ReviewModerationActionSpam:
+		return true
+	}
+	return false
+}
+
+func (e ReviewModerationAction) String() string {
+	return string(e)
+}
+
+func (e *ReviewModerationAction) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = ReviewModerationAction(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid ReviewModerationAction", str)
+	}
+	return nil
+}
+
+func (e ReviewModerationAction) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
 type ReviewType string
 
 const (
@@ -9607,17 +10766,19 @@ const (
 	StoreCategoryFoodDelivery    StoreCategory = "FOOD_DELIVERY"
 	StoreCategoryGroceryDelivery StoreCategory = "GROCERY_DELIVERY"
 	StoreCategoryWineDelivery    StoreCategory = "WINE_DELIVERY"
+	StoreCategoryRetail          StoreCategory = "RETAIL"
 )
 
 var AllStoreCategory = []StoreCategory{
 	StoreCategoryFoodDelivery,
 	StoreCategoryGroceryDelivery,
 	StoreCategoryWineDelivery,
+	StoreCategoryRetail,
 }
 
 func (e StoreCategory) IsValid() bool {
 	switch e {
-	case StoreCategoryFoodDelivery, StoreCategoryGroceryDelivery, StoreCategoryWineDelivery:
+	case StoreCategoryFoodDelivery, StoreCategoryGroceryDelivery, StoreCategoryWineDelivery, StoreCategoryRetail:
 		return true
 	}
 	return false
@@ -9908,155 +11069,761 @@ func (e StoreVehicleTypeStatus) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
-type TransactionType string
+type SubscriptionBilling string
 
 const (
-	TransactionTypeDebit  TransactionType = "DEBIT"
-	TransactionTypeCredit TransactionType = "CREDIT"
+	SubscriptionBillingChargeAutomatically SubscriptionBilling = "CHARGE_AUTOMATICALLY"
+	SubscriptionBillingSendInvoice         SubscriptionBilling = "SEND_INVOICE"
 )
 
-var AllTransactionType = []TransactionType{
-	TransactionTypeDebit,
-	TransactionTypeCredit,
+var AllSubscriptionBilling = []SubscriptionBilling{
+	SubscriptionBillingChargeAutomatically,
+	SubscriptionBillingSendInvoice,
 }
 
-func (e TransactionType) IsValid() bool {
+func (e SubscriptionBilling) IsValid() bool {
 	switch e {
-	case TransactionTypeDebit, TransactionTypeCredit:
+	case SubscriptionBillingChargeAutomatically, SubscriptionBillingSendInvoice:
 		return true
 	}
 	return false
 }
 
-func (e TransactionType) String() string {
+func (e SubscriptionBilling) String() string {
 	return string(e)
 }
 
-func (e *TransactionType) UnmarshalGQL(v interface{}) error {
+func (e *SubscriptionBilling) UnmarshalGQL(v interface{}) error {
 	str, ok := v.(string)
 	if !ok {
 		return fmt.Errorf("enums must be strings")
 	}
 
-	*e = TransactionType(str)
+	*e = SubscriptionBilling(str)
 	if !e.IsValid() {
-		return fmt.Errorf("%s is not a valid TransactionType", str)
+		return fmt.Errorf("%s is not a valid SubscriptionBilling", str)
 	}
 	return nil
 }
 
-func (e TransactionType) MarshalGQL(w io.Writer) {
+func (e SubscriptionBilling) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
-type UserSearchType string
+type SubscriptionInvoiceBillingReason string
 
 const (
-	UserSearchTypeName   UserSearchType = "NAME"
-	UserSearchTypeEmail  UserSearchType = "EMAIL"
-	UserSearchTypeMobile UserSearchType = "MOBILE"
+	SubscriptionInvoiceBillingReasonSubscriptionCreate SubscriptionInvoiceBillingReason = "SUBSCRIPTION_CREATE"
+	SubscriptionInvoiceBillingReasonSubscriptionCycle  SubscriptionInvoiceBillingReason = "SUBSCRIPTION_CYCLE"
+	SubscriptionInvoiceBillingReasonSubscriptionUpdate SubscriptionInvoiceBillingReason = "SUBSCRIPTION_UPDATE"
 )
 
-var AllUserSearchType = []UserSearchType{
-	UserSearchTypeName,
-	UserSearchTypeEmail,
-	UserSearchTypeMobile,
+var AllSubscriptionInvoiceBillingReason = []SubscriptionInvoiceBillingReason{
+	SubscriptionInvoiceBillingReasonSubscriptionCreate,
+	SubscriptionInvoiceBillingReasonSubscriptionCycle,
+	SubscriptionInvoiceBillingReasonSubscriptionUpdate,
 }
 
-func (e UserSearchType) IsValid() bool {
+func (e SubscriptionInvoiceBillingReason) IsValid() bool {
 	switch e {
-	case UserSearchTypeName, UserSearchTypeEmail, UserSearchTypeMobile:
+	case SubscriptionInvoiceBillingReasonSubscriptionCreate, SubscriptionInvoiceBillingReasonSubscriptionCycle, SubscriptionInvoiceBillingReasonSubscriptionUpdate:
 		return true
 	}
 	return false
 }
 
-func (e UserSearchType) String() string {
+func (e SubscriptionInvoiceBillingReason) String() string {
 	return string(e)
 }
 
-func (e *UserSearchType) UnmarshalGQL(v interface{}) error {
+func (e *SubscriptionInvoiceBillingReason) UnmarshalGQL(v interface{}) error {
 	str, ok := v.(string)
 	if !ok {
 		return fmt.Errorf("enums must be strings")
 	}
 
-	*e = UserSearchType(str)
+	*e = SubscriptionInvoiceBillingReason(str)
 	if !e.IsValid() {
-		return fmt.Errorf("%s is not a valid UserSearchType", str)
+		return fmt.Errorf("%s is not a valid SubscriptionInvoiceBillingReason", str)
 	}
 	return nil
 }
 
-func (e UserSearchType) MarshalGQL(w io.Writer) {
+func (e SubscriptionInvoiceBillingReason) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
-type UserStatus string
+type SubscriptionInvoiceStatus string
 
 const (
-	UserStatusActive   UserStatus = "ACTIVE"
-	UserStatusInactive UserStatus = "INACTIVE"
-	UserStatusDelete   UserStatus = "DELETE"
+	SubscriptionInvoiceStatusOpen          SubscriptionInvoiceStatus = "OPEN"
+	SubscriptionInvoiceStatusPaid          SubscriptionInvoiceStatus = "PAID"
+	SubscriptionInvoiceStatusUncollectible SubscriptionInvoiceStatus = "UNCOLLECTIBLE"
+	SubscriptionInvoiceStatusVoid          SubscriptionInvoiceStatus = "VOID"
 )
 
-var AllUserStatus = []UserStatus{
-	UserStatusActive,
-	UserStatusInactive,
-	UserStatusDelete,
+var AllSubscriptionInvoiceStatus = []SubscriptionInvoiceStatus{
+	SubscriptionInvoiceStatusOpen,
+	SubscriptionInvoiceStatusPaid,
+	SubscriptionInvoiceStatusUncollectible,
+	SubscriptionInvoiceStatusVoid,
 }
 
-func (e UserStatus) IsValid() bool {
+func (e SubscriptionInvoiceStatus) IsValid() bool {
 	switch e {
-	case UserStatusActive, UserStatusInactive, UserStatusDelete:
+	case SubscriptionInvoiceStatusOpen, SubscriptionInvoiceStatusPaid, SubscriptionInvoiceStatusUncollectible, SubscriptionInvoiceStatusVoid:
 		return true
 	}
 	return false
 }
 
-func (e UserStatus) String() string {
+func (e SubscriptionInvoiceStatus) String() string {
 	return string(e)
 }
 
-func (e *UserStatus) UnmarshalGQL(v interface{}) error {
+func (e *SubscriptionInvoiceStatus) UnmarshalGQL(v interface{}) error {
 	str, ok := v.(string)
 	if !ok {
 		return fmt.Errorf("enums must be strings")
 	}
 
-	*e = UserStatus(str)
+	*e = SubscriptionInvoiceStatus(str)
 	if !e.IsValid() {
-		return fmt.Errorf("%s is not a valid UserStatus", str)
+		return fmt.Errorf("%s is not a valid SubscriptionInvoiceStatus", str)
 	}
 	return nil
 }
 
-func (e UserStatus) MarshalGQL(w io.Writer) {
+func (e SubscriptionInvoiceStatus) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
-type UserTypeOptions string
+type SubscriptionPlanAggregateUsage string
 
 const (
-	UserTypeOptionsAllUsers             UserTypeOptions = "ALL_USERS"
-	UserTypeOptionsAllProviders         UserTypeOptions = "ALL_PROVIDERS"
-	UserTypeOptionsAllLoggedinProviders UserTypeOptions = "ALL_LOGGEDIN_PROVIDERS"
-	UserTypeOptionsAllLoggedinUsers     UserTypeOptions = "ALL_LOGGEDIN_USERS"
-	UserTypeOptionsAllStores            UserTypeOptions = "ALL_STORES"
-	UserTypeOptionsAllInactiveUsers     UserTypeOptions = "ALL_INACTIVE_USERS"
-	UserTypeOptionsAllInactiveProviders UserTypeOptions = "ALL_INACTIVE_PROVIDERS"
-	UserTypeOptionsAllLoggedinStores    UserTypeOptions = "ALL_LOGGEDIN_STORES"
-	UserTypeOptionsAllInactiveStores    UserTypeOptions = "ALL_INACTIVE_STORES"
+	SubscriptionPlanAggregateUsageSum              SubscriptionPlanAggregateUsage = "SUM"
+	SubscriptionPlanAggregateUsageMax              SubscriptionPlanAggregateUsage = "MAX"
+	SubscriptionPlanAggregateUsageLastDuringPeriod SubscriptionPlanAggregateUsage = "LAST_DURING_PERIOD"
+	SubscriptionPlanAggregateUsageLastEver         SubscriptionPlanAggregateUsage = "LAST_EVER"
 )
 
-var AllUserTypeOptions = []UserTypeOptions{
-	UserTypeOptionsAllUsers,
-	UserTypeOptionsAllProviders,
-	UserTypeOptionsAllLoggedinProviders,
-	UserTypeOptionsAllLoggedinUsers,
-	UserTypeOptionsAllStores,
-	UserTypeOptionsAllInactiveUsers,
-	UserTypeOptionsAllInactiveProviders,
+var AllSubscriptionPlanAggregateUsage = []SubscriptionPlanAggregateUsage{
+	SubscriptionPlanAggregateUsageSum,
+	SubscriptionPlanAggregateUsageMax,
+	SubscriptionPlanAggregateUsageLastDuringPeriod,
+	SubscriptionPlanAggregateUsageLastEver,
+}
+
+func (e SubscriptionPlanAggregateUsage) IsValid() bool {
+	switch e {
+	case SubscriptionPlanAggregateUsageSum, SubscriptionPlanAggregateUsageMax, SubscriptionPlanAggregateUsageLastDuringPeriod, SubscriptionPlanAggregateUsageLastEver:
+		return true
+	}
+	return false
+}
+
+func (e SubscriptionPlanAggregateUsage) String() string {
+	return string(e)
+}
+
+func (e *SubscriptionPlanAggregateUsage) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SubscriptionPlanAggregateUsage(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SubscriptionPlanAggregateUsage", str)
+	}
+	return nil
+}
+
+func (e SubscriptionPlanAggregateUsage) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type SubscriptionPlanBillingScheme string
+
+const (
+	SubscriptionPlanBillingSchemePerUnit SubscriptionPlanBillingScheme = "PER_UNIT"
+	SubscriptionPlanBillingSchemeTiered  SubscriptionPlanBillingScheme = "TIERED"
+)
+
+var AllSubscriptionPlanBillingScheme = []SubscriptionPlanBillingScheme{
+	SubscriptionPlanBillingSchemePerUnit,
+	SubscriptionPlanBillingSchemeTiered,
+}
+
+func (e SubscriptionPlanBillingScheme) IsValid() bool {
+	switch e {
+	case SubscriptionPlanBillingSchemePerUnit, SubscriptionPlanBillingSchemeTiered:
+		return true
+	}
+	return false
+}
+
+func (e SubscriptionPlanBillingScheme) String() string {
+	return string(e)
+}
+
+func (e *SubscriptionPlanBillingScheme) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SubscriptionPlanBillingScheme(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SubscriptionPlanBillingScheme", str)
+	}
+	return nil
+}
+
+func (e SubscriptionPlanBillingScheme) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type SubscriptionPlanInterval string
+
+const (
+	SubscriptionPlanIntervalDay   SubscriptionPlanInterval = "DAY"
+	SubscriptionPlanIntervalWeek  SubscriptionPlanInterval = "WEEK"
+	SubscriptionPlanIntervalMonth SubscriptionPlanInterval = "MONTH"
+	SubscriptionPlanIntervalYear  SubscriptionPlanInterval = "YEAR"
+)
+
+var AllSubscriptionPlanInterval = []SubscriptionPlanInterval{
+	SubscriptionPlanIntervalDay,
+	SubscriptionPlanIntervalWeek,
+	SubscriptionPlanIntervalMonth,
+	SubscriptionPlanIntervalYear,
+}
+
+func (e SubscriptionPlanInterval) IsValid() bool {
+	switch e {
+	case SubscriptionPlanIntervalDay, SubscriptionPlanIntervalWeek, SubscriptionPlanIntervalMonth, SubscriptionPlanIntervalYear:
+		return true
+	}
+	return false
+}
+
+func (e SubscriptionPlanInterval) String() string {
+	return string(e)
+}
+
+func (e *SubscriptionPlanInterval) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SubscriptionPlanInterval(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SubscriptionPlanInterval", str)
+	}
+	return nil
+}
+
+func (e SubscriptionPlanInterval) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type SubscriptionPlanTiersMode string
+
+const (
+	SubscriptionPlanTiersModeGraduated SubscriptionPlanTiersMode = "GRADUATED"
+	SubscriptionPlanTiersModeVolume    SubscriptionPlanTiersMode = "VOLUME"
+)
+
+var AllSubscriptionPlanTiersMode = []SubscriptionPlanTiersMode{
+	SubscriptionPlanTiersModeGraduated,
+	SubscriptionPlanTiersModeVolume,
+}
+
+func (e SubscriptionPlanTiersMode) IsValid() bool {
+	switch e {
+	case SubscriptionPlanTiersModeGraduated, SubscriptionPlanTiersModeVolume:
+		return true
+	}
+	return false
+}
+
+func (e SubscriptionPlanTiersMode) String() string {
+	return string(e)
+}
+
+func (e *SubscriptionPlanTiersMode) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SubscriptionPlanTiersMode(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SubscriptionPlanTiersMode", str)
+	}
+	return nil
+}
+
+func (e SubscriptionPlanTiersMode) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type SubscriptionPlanTransformUsageRound string
+
+const (
+	SubscriptionPlanTransformUsageRoundDown SubscriptionPlanTransformUsageRound = "DOWN"
+	SubscriptionPlanTransformUsageRoundUp   SubscriptionPlanTransformUsageRound = "UP"
+)
+
+var AllSubscriptionPlanTransformUsageRound = []SubscriptionPlanTransformUsageRound{
+	SubscriptionPlanTransformUsageRoundDown,
+	SubscriptionPlanTransformUsageRoundUp,
+}
+
+func (e SubscriptionPlanTransformUsageRound) IsValid() bool {
+	switch e {
+	case SubscriptionPlanTransformUsageRoundDown, SubscriptionPlanTransformUsageRoundUp:
+		return true
+	}
+	return false
+}
+
+func (e SubscriptionPlanTransformUsageRound) String() string {
+	return string(e)
+}
+
+func (e *SubscriptionPlanTransformUsageRound) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SubscriptionPlanTransformUsageRound(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SubscriptionPlanTransformUsageRound", str)
+	}
+	return nil
+}
+
+func (e SubscriptionPlanTransformUsageRound) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type SubscriptionPlanUsageType string
+
+const (
+	SubscriptionPlanUsageTypeLicensed SubscriptionPlanUsageType = "LICENSED"
+	SubscriptionPlanUsageTypeMetered  SubscriptionPlanUsageType = "METERED"
+)
+
+var AllSubscriptionPlanUsageType = []SubscriptionPlanUsageType{
+	SubscriptionPlanUsageTypeLicensed,
+	SubscriptionPlanUsageTypeMetered,
+}
+
+func (e SubscriptionPlanUsageType) IsValid() bool {
+	switch e {
+	case SubscriptionPlanUsageTypeLicensed, SubscriptionPlanUsageTypeMetered:
+		return true
+	}
+	return false
+}
+
+func (e SubscriptionPlanUsageType) String() string {
+	return string(e)
+}
+
+func (e *SubscriptionPlanUsageType) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SubscriptionPlanUsageType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SubscriptionPlanUsageType", str)
+	}
+	return nil
+}
+
+func (e SubscriptionPlanUsageType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type SubscriptionStatus string
+
+const (
+	SubscriptionStatusTrialing          SubscriptionStatus = "TRIALING"
+	SubscriptionStatusActive            SubscriptionStatus = "ACTIVE"
+	SubscriptionStatusIncomplete        SubscriptionStatus = "INCOMPLETE"
+	SubscriptionStatusIncompleteExpired SubscriptionStatus = "INCOMPLETE_EXPIRED"
+	SubscriptionStatusPastDue           SubscriptionStatus = "PAST_DUE"
+	SubscriptionStatusUnpaid            SubscriptionStatus = "UNPAID"
+	SubscriptionStatusCanceled          SubscriptionStatus = "CANCELED"
+)
+
+var AllSubscriptionStatus = []SubscriptionStatus{
+	SubscriptionStatusTrialing,
+	SubscriptionStatusActive,
+	SubscriptionStatusIncomplete,
+	SubscriptionStatusIncompleteExpired,
+	SubscriptionStatusPastDue,
+	SubscriptionStatusUnpaid,
+	SubscriptionStatusCanceled,
+}
+
+func (e SubscriptionStatus) IsValid() bool {
+	switch e {
+	case SubscriptionStatusTrialing, SubscriptionStatusActive, SubscriptionStatusIncomplete, SubscriptionStatusIncompleteExpired, SubscriptionStatusPastDue, SubscriptionStatusUnpaid, SubscriptionStatusCanceled:
+		return true
+	}
+	return false
+}
+
+func (e SubscriptionStatus) String() string {
+	return string(e)
+}
+
+func (e *SubscriptionStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SubscriptionStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SubscriptionStatus", str)
+	}
+	return nil
+}
+
+func (e SubscriptionStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type SubscriptionUsageAction string
+
+const (
+	SubscriptionUsageActionIncrement SubscriptionUsageAction = "INCREMENT"
+	SubscriptionUsageActionSet       SubscriptionUsageAction = "SET"
+)
+
+var AllSubscriptionUsageAction = []SubscriptionUsageAction{
+	SubscriptionUsageActionIncrement,
+	SubscriptionUsageActionSet,
+}
+
+func (e SubscriptionUsageAction) IsValid() bool {
+	switch e {
+	case SubscriptionUsageActionIncrement, SubscriptionUsageActionSet:
+		return true
+	}
+	return false
+}
+
+func (e SubscriptionUsageAction) String() string {
+	return string(e)
+}
+
+func (e *SubscriptionUsageAction) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = SubscriptionUsageAction(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid SubscriptionUsageAction", str)
+	}
+	return nil
+}
+
+func (e SubscriptionUsageAction) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type TaxRoundingMode string
+
+const (
+	TaxRoundingModeHalfUp   TaxRoundingMode = "HALF_UP"
+	TaxRoundingModeHalfEven TaxRoundingMode = "HALF_EVEN"
+	TaxRoundingModeUp       TaxRoundingMode = "UP"
+	TaxRoundingModeDown     TaxRoundingMode = "DOWN"
+)
+
+var AllTaxRoundingMode = []TaxRoundingMode{
+	TaxRoundingModeHalfUp,
+	TaxRoundingModeHalfEven,
+	TaxRoundingModeUp,
+	TaxRoundingModeDown,
+}
+
+func (e TaxRoundingMode) IsValid() bool {
+	switch e {
+	case TaxRoundingModeHalfUp, TaxRoundingModeHalfEven, TaxRoundingModeUp, TaxRoundingModeDown:
+		return true
+	}
+	return false
+}
+
+func (e TaxRoundingMode) String() string {
+	return string(e)
+}
+
+func (e *TaxRoundingMode) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = TaxRoundingMode(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid TaxRoundingMode", str)
+	}
+	return nil
+}
+
+func (e TaxRoundingMode) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type TransactionType string
+
+const (
+	TransactionTypeDebit  TransactionType = "DEBIT"
+	TransactionTypeCredit TransactionType = "CREDIT"
+)
+
+var AllTransactionType = []TransactionType{
+	TransactionTypeDebit,
+	TransactionTypeCredit,
+}
+
+func (e TransactionType) IsValid() bool {
+	switch e {
+	case TransactionTypeDebit, TransactionTypeCredit:
+		return true
+	}
+	return false
+}
+
+func (e TransactionType) String() string {
+	return string(e)
+}
+
+func (e *TransactionType) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = TransactionType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid TransactionType", str)
+	}
+	return nil
+}
+
+func (e TransactionType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type UPITransactionMode string
+
+const (
+	UPITransactionModeCollect UPITransactionMode = "COLLECT"
+	UPITransactionModeIntent  UPITransactionMode = "INTENT"
+)
+
+var AllUPITransactionMode = []UPITransactionMode{
+	UPITransactionModeCollect,
+	UPITransactionModeIntent,
+}
+
+func (e UPITransactionMode) IsValid() bool {
+	switch e {
+	case UPITransactionModeCollect, UPITransactionModeIntent:
+		return true
+	}
+	return false
+}
+
+func (e UPITransactionMode) String() string {
+	return string(e)
+}
+
+func (e *UPITransactionMode) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = UPITransactionMode(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid UPITransactionMode", str)
+	}
+	return nil
+}
+
+func (e UPITransactionMode) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type UPITransactionStatus string
+
+const (
+	UPITransactionStatusPending UPITransactionStatus = "PENDING"
+	UPITransactionStatusSuccess UPITransactionStatus = "SUCCESS"
+	UPITransactionStatusFailed  UPITransactionStatus = "FAILED"
+	UPITransactionStatusExpired UPITransactionStatus = "EXPIRED"
+)
+
+var AllUPITransactionStatus = []UPITransactionStatus{
+	UPITransactionStatusPending,
+	UPITransactionStatusSuccess,
+	UPITransactionStatusFailed,
+	UPITransactionStatusExpired,
+}
+
+func (e UPITransactionStatus) IsValid() bool {
+	switch e {
+	case UPITransactionStatusPending, UPITransactionStatusSuccess, UPITransactionStatusFailed, UPITransactionStatusExpired:
+		return true
+	}
+	return false
+}
+
+func (e UPITransactionStatus) String() string {
+	return string(e)
+}
+
+func (e *UPITransactionStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = UPITransactionStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid UPITransactionStatus", str)
+	}
+	return nil
+}
+
+func (e UPITransactionStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type UserSearchType string
+
+const (
+	UserSearchTypeName   UserSearchType = "NAME"
+	UserSearchTypeEmail  UserSearchType = "EMAIL"
+	UserSearchTypeMobile UserSearchType = "MOBILE"
+)
+
+var AllUserSearchType = []UserSearchType{
+	UserSearchTypeName,
+	UserSearchTypeEmail,
+	UserSearchTypeMobile,
+}
+
+func (e UserSearchType) IsValid() bool {
+	switch e {
+	case UserSearchTypeName, UserSearchTypeEmail, UserSearchTypeMobile:
+		return true
+	}
+	return false
+}
+
+func (e UserSearchType) String() string {
+	return string(e)
+}
+
+func (e *UserSearchType) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = UserSearchType(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid UserSearchType", str)
+	}
+	return nil
+}
+
+func (e UserSearchType) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type UserStatus string
+
+const (
+	UserStatusActive   UserStatus = "ACTIVE"
+	UserStatusInactive UserStatus = "INACTIVE"
+	UserStatusDelete   UserStatus = "DELETE"
+)
+
+var AllUserStatus = []UserStatus{
+	UserStatusActive,
+	UserStatusInactive,
+	UserStatusDelete,
+}
+
+func (e UserStatus) IsValid() bool {
+	switch e {
+	case UserStatusActive, UserStatusInactive, UserStatusDelete:
+		return true
+	}
+	return false
+}
+
+func (e UserStatus) String() string {
+	return string(e)
+}
+
+func (e *UserStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = UserStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid UserStatus", str)
+	}
+	return nil
+}
+
+func (e UserStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
+type UserTypeOptions string
+
+const (
+	UserTypeOptionsAllUsers             UserTypeOptions = "ALL_USERS"
+	UserTypeOptionsAllProviders         UserTypeOptions = "ALL_PROVIDERS"
+	UserTypeOptionsAllLoggedinProviders UserTypeOptions = "ALL_LOGGEDIN_PROVIDERS"
+	UserTypeOptionsAllLoggedinUsers     UserTypeOptions = "ALL_LOGGEDIN_USERS"
+	UserTypeOptionsAllStores            UserTypeOptions = "ALL_STORES"
+	UserTypeOptionsAllInactiveUsers     UserTypeOptions = "ALL_INACTIVE_USERS"
+	UserTypeOptionsAllInactiveProviders UserTypeOptions = "ALL_INACTIVE_PROVIDERS"
+	UserTypeOptionsAllLoggedinStores    UserTypeOptions = "ALL_LOGGEDIN_STORES"
+	UserTypeOptionsAllInactiveStores    UserTypeOptions = "ALL_INACTIVE_STORES"
+)
+
+var AllUserTypeOptions = []UserTypeOptions{
+	UserTypeOptionsAllUsers,
+	UserTypeOptionsAllProviders,
+	UserTypeOptionsAllLoggedinProviders,
+	UserTypeOptionsAllLoggedinUsers,
+	UserTypeOptionsAllStores,
+	UserTypeOptionsAllInactiveUsers,
+	UserTypeOptionsAllInactiveProviders,
 	UserTypeOptionsAllLoggedinStores,
 	UserTypeOptionsAllInactiveStores,
 }
@@ -10536,6 +12303,49 @@ func (e VisitLocationType) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
+type WalletHoldStatus string
+
+const (
+	WalletHoldStatusHeld     WalletHoldStatus = "HELD"
+	WalletHoldStatusCaptured WalletHoldStatus = "CAPTURED"
+	WalletHoldStatusReleased WalletHoldStatus = "RELEASED"
+)
+
+var AllWalletHoldStatus = []WalletHoldStatus{
+	WalletHoldStatusHeld,
+	WalletHoldStatusCaptured,
+	WalletHoldStatusReleased,
+}
+
+func (e WalletHoldStatus) IsValid() bool {
+	switch e {
+	case WalletHoldStatusHeld, WalletHoldStatusCaptured, WalletHoldStatusReleased:
+		return true
+	}
+	return false
+}
+
+func (e WalletHoldStatus) String() string {
+	return string(e)
+}
+
+func (e *WalletHoldStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = WalletHoldStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid WalletHoldStatus", str)
+	}
+	return nil
+}
+
+func (e WalletHoldStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
 type WalletTransactionType string
 
 const (
@@ -10577,6 +12387,57 @@ func (e WalletTransactionType) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
 
+type Weekday string
+
+const (
+	WeekdayMonday    Weekday = "MONDAY"
+	WeekdayTuesday   Weekday = "TUESDAY"
+	WeekdayWednesday Weekday = "WEDNESDAY"
+	WeekdayThursday  Weekday = "THURSDAY"
+	WeekdayFriday    Weekday = "FRIDAY"
+	WeekdaySaturday  Weekday = "SATURDAY"
+	WeekdaySunday    Weekday = "SUNDAY"
+)
+
+var AllWeekday = []Weekday{
+	WeekdayMonday,
+	WeekdayTuesday,
+	WeekdayWednesday,
+	WeekdayThursday,
+	WeekdayFriday,
+	WeekdaySaturday,
+	WeekdaySunday,
+}
+
+func (e Weekday) IsValid() bool {
+	switch e {
+	case WeekdayMonday, WeekdayTuesday, WeekdayWednesday, WeekdayThursday, WeekdayFriday, WeekdaySaturday, WeekdaySunday:
+		return true
+	}
+	return false
+}
+
+func (e Weekday) String() string {
+	return string(e)
+}
+
+func (e *Weekday) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = Weekday(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid Weekday", str)
+	}
+	return nil
+}
+
+func (e Weekday) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
+
 type WineDeliveryLabelSearch string
 
 const (
@@ -10619,3 +12480,54 @@ func (e *WineDeliveryLabelSearch) UnmarshalGQL(v interface{}) error {
 func (e WineDeliveryLabelSearch) MarshalGQL(w io.Writer) {
 	fmt.Fprint(w, strconv.Quote(e.String()))
 }
+
+type WithdrawalStatus string
+
+const (
+	WithdrawalStatusPending    WithdrawalStatus = "PENDING"
+	WithdrawalStatusApproved   WithdrawalStatus = "APPROVED"
+	WithdrawalStatusProcessing WithdrawalStatus = "PROCESSING"
+	WithdrawalStatusPaid       WithdrawalStatus = "PAID"
+	WithdrawalStatusRejected   WithdrawalStatus = "REJECTED"
+	WithdrawalStatusFailed     WithdrawalStatus = "FAILED"
+	WithdrawalStatusReversed   WithdrawalStatus = "REVERSED"
+)
+
+var AllWithdrawalStatus = []WithdrawalStatus{
+	WithdrawalStatusPending,
+	WithdrawalStatusApproved,
+	WithdrawalStatusProcessing,
+	WithdrawalStatusPaid,
+	WithdrawalStatusRejected,
+	WithdrawalStatusFailed,
+	WithdrawalStatusReversed,
+}
+
+func (e WithdrawalStatus) IsValid() bool {
+	switch e {
+	case WithdrawalStatusPending, WithdrawalStatusApproved, WithdrawalStatusProcessing, WithdrawalStatusPaid, WithdrawalStatusRejected, WithdrawalStatusFailed, WithdrawalStatusReversed:
+		return true
+	}
+	return false
+}
+
+func (e WithdrawalStatus) String() string {
+	return string(e)
+}
+
+func (e *WithdrawalStatus) UnmarshalGQL(v interface{}) error {
+	str, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("enums must be strings")
+	}
+
+	*e = WithdrawalStatus(str)
+	if !e.IsValid() {
+		return fmt.Errorf("%s is not a valid WithdrawalStatus", str)
+	}
+	return nil
+}
+
+func (e WithdrawalStatus) MarshalGQL(w io.Writer) {
+	fmt.Fprint(w, strconv.Quote(e.String()))
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/cache"
+	"github.com/tribehq/platform/lib/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrGuestCartNotConfigured = errors.New("guest carts are not configured")
+	ErrInvalidGuestCartToken  = errors.New("invalid guest cart token")
+)
+
+// IsGuest tells whether a cart was started by a customer who hasn't logged in.
+func (cart *Cart) IsGuest() bool {
+	return cart.UserID.IsZero()
+}
+
+// guestCartTokenLifetime is how long a guest can come back to their cart with a token.
+const guestCartTokenLifetime = 30 * 24 * time.Hour
+
+// GuestCartToken gives the signed token a guest keeps to come back to their cart.
+func GuestCartToken(cart *Cart) (string, error) {
+	secret := os.Getenv("GUEST_CART_SECRET")
+	if secret == "" {
+		return "", ErrGuestCartNotConfigured
+	}
+	return guestCartToken(secret, cart.ID.Hex(), time.Now().Add(guestCartTokenLifetime)), nil
+}
+
+func guestCartToken(secret string, cartID string, expiresAt time.Time) string {
+	expires := strconv.FormatInt(expiresAt.Unix(), 10)
+	return cartID + "." + expires + "." + guestCartSignature(secret, cartID, expires)
+}
+
+func guestCartSignature(secret string, cartID string, expires string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("guest-cart:" + cartID + ":" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// guestCartID checks the signature and expiry of a guest cart token and gives the cart it stands for.
+func guestCartID(token string) (primitive.ObjectID, error) {
+	secret := os.Getenv("GUEST_CART_SECRET")
+	if secret == "" {
+		return primitive.NilObjectID, ErrGuestCartNotConfigured
+	}
+	return verifyGuestCartToken(secret, token, time.Now())
+}
+
+func verifyGuestCartToken(secret string, token string, now time.Time) (primitive.ObjectID, error) {
+	parts := strings.SplitN(token, ".", 3)
+	if len(parts) != 3 || !hmac.Equal([]byte(parts[2]), []byte(guestCartSignature(secret, parts[0], parts[1]))) {
+		return primitive.NilObjectID, ErrInvalidGuestCartToken
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || now.After(time.Unix(expires, 0)) {
+		return primitive.NilObjectID, ErrInvalidGuestCartToken
+	}
+	cartID, err := primitive.ObjectIDFromHex(parts[0])
+	if err != nil {
+		return primitive.NilObjectID, ErrInvalidGuestCartToken
+	}
+	return cartID, nil
+}
+
+// GetGuestCart gets the guest cart of a token, nil when it was checked out, removed or taken over by a customer.
+func GetGuestCart(token string) (*Cart, error) {
+	cartID, err := guestCartID(token)
+	if err != nil {
+		return nil, err
+	}
+	cart := &Cart{}
+	filter := bson.D{{"_id", cartID}, {"userID", primitive.NilObjectID}, {"deletedAt", bson.M{"$exists": false}}}
+	err = database.MongoDB.Collection(CartCollection).FindOne(context.Background(), filter).Decode(cart)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	return cart, nil
+}
+
+// SetCartItem sets the quantity of a product or variation in cart items, removing it when the quantity is zero.
+func SetCartItem(items []CartItem, item CartItem) []CartItem {
+	for i := range items {
+		if sameCartItem(items[i], item) {
+			if item.Quantity <= 0 {
+				return append(items[:i], items[i+1:]...)
+			}
+			items[i].Quantity = item.Quantity
+			return items
+		}
+	}
+	if item.Quantity <= 0 {
+		return items
+	}
+	return append(items, item)
+}
+
+// MergeGuestCart hands the guest cart of a token over to a customer who logged in or signed up.
+// The items go into the customer's cart of the same store, keeping the larger quantity of items both carts hold,
+// and the guest cart becomes the customer's cart when they have none.
+func MergeGuestCart(token string, userID primitive.ObjectID) (*Cart, error) {
+	cartID, err := guestCartID(token)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	collection := database.MongoDB.Collection(CartCollection)
+
+	//Claim the guest cart so it is merged only once
+	guest := &Cart{}
+	now := time.Now()
+	filter := bson.D{{"_id", cartID}, {"userID", primitive.NilObjectID}, {"deletedAt", bson.M{"$exists": false}}}
+	update := bson.D{{"$set", bson.D{{"deletedAt", now}}}}
+	err = collection.FindOneAndUpdate(ctx, filter, update).Decode(guest)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	err = cache.RedisClient.Del(guest.ID.Hex()).Err()
+	if err != nil {
+		log.Error(err)
+	}
+
+	current, err := GetCartByFilter(bson.D{{"userID", userID}, {"storeID", guest.StoreID}})
+	if err != nil {
+		return nil, err
+	}
+	if current != nil && !current.ID.IsZero() {
+		current.Items = mergeCartItems(current.Items, guest.Items)
+		return UpdateCart(current)
+	}
+
+	filter = bson.D{{"_id", guest.ID}}
+	update = bson.D{
+		{"$set", bson.D{{"userID", userID}, {"createdBy", userID}, {"updatedAt", now}}},
+		{"$unset", bson.D{{"deletedAt", ""}}},
+	}
+	findUpdateOpts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	cart := &Cart{}
+	err = collection.FindOneAndUpdate(ctx, filter, update, findUpdateOpts).Decode(cart)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	return cart, nil
+}
@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGuestCartToken(t *testing.T) {
+	now := time.Now()
+	cartID := primitive.NewObjectID()
+	token := guestCartToken("secret", cartID.Hex(), now.Add(time.Hour))
+
+	id, err := verifyGuestCartToken("secret", token, now)
+	require.NoError(t, err)
+	require.Equal(t, cartID, id)
+
+	t.Run("expired tokens are refused", func(t *testing.T) {
+		_, err := verifyGuestCartToken("secret", token, now.Add(2*time.Hour))
+		require.Equal(t, ErrInvalidGuestCartToken, err)
+	})
+	t.Run("the expiry can't be pushed back", func(t *testing.T) {
+		parts := strings.Split(token, ".")
+		parts[1] = strconv.FormatInt(now.Add(48*time.Hour).Unix(), 10)
+		_, err := verifyGuestCartToken("secret", strings.Join(parts, "."), now.Add(2*time.Hour))
+		require.Equal(t, ErrInvalidGuestCartToken, err)
+	})
+	t.Run("tokens are bound to their cart", func(t *testing.T) {
+		parts := strings.Split(token, ".")
+		parts[0] = primitive.NewObjectID().Hex()
+		_, err := verifyGuestCartToken("secret", strings.Join(parts, "."), now)
+		require.Equal(t, ErrInvalidGuestCartToken, err)
+	})
+	t.Run("tokens signed with another secret are refused", func(t *testing.T) {
+		_, err := verifyGuestCartToken("other", token, now)
+		require.Equal(t, ErrInvalidGuestCartToken, err)
+	})
+	t.Run("malformed tokens are refused", func(t *testing.T) {
+		for _, malformed := range []string{"", cartID.Hex(), cartID.Hex() + ".signature", "not-an-id." + strings.SplitN(token, ".", 2)[1]} {
+			_, err := verifyGuestCartToken("secret", malformed, now)
+			require.Equal(t, ErrInvalidGuestCartToken, err, malformed)
+		}
+	})
+}
+
+func TestMergeCartItems(t *testing.T) {
+	shoes, socks, shirt := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	small, large := primitive.NewObjectID(), primitive.NewObjectID()
+
+	t.Run("into a customer's existing cart", func(t *testing.T) {
+		current := []CartItem{
+			{ProductID: shoes, Quantity: 1},
+			{ProductID: shirt, VariationID: &small, Quantity: 3},
+		}
+		guest := []CartItem{
+			{ProductID: shoes, Quantity: 2},
+			{ProductID: shirt, VariationID: &small, Quantity: 1},
+			{ProductID: shirt, VariationID: &large, Quantity: 1},
+			{ProductID: socks, Quantity: 4},
+		}
+		merged := mergeCartItems(current, guest)
+		require.Equal(t, []CartItem{
+			{ProductID: shoes, Quantity: 2},
+			{ProductID: shirt, VariationID: &small, Quantity: 3},
+			{ProductID: shirt, VariationID: &large, Quantity: 1},
+			{ProductID: socks, Quantity: 4},
+		}, merged)
+	})
+	t.Run("into an empty cart", func(t *testing.T) {
+		guest := []CartItem{{ProductID: socks, Quantity: 4}}
+		require.Equal(t, guest, mergeCartItems(nil, guest))
+	})
+	t.Run("a product and its variation are kept apart", func(t *testing.T) {
+		merged := mergeCartItems([]CartItem{{ProductID: shirt, Quantity: 1}}, []CartItem{{ProductID: shirt, VariationID: &small, Quantity: 2}})
+		require.Len(t, merged, 2)
+	})
+}
+
+func TestSetCartItem(t *testing.T) {
+	shoes, socks := primitive.NewObjectID(), primitive.NewObjectID()
+	items := []CartItem{{ProductID: shoes, Quantity: 1}}
+
+	items = SetCartItem(items, CartItem{ProductID: socks, Quantity: 2})
+	require.Equal(t, []CartItem{{ProductID: shoes, Quantity: 1}, {ProductID: socks, Quantity: 2}}, items)
+	items = SetCartItem(items, CartItem{ProductID: shoes, Quantity: 3})
+	require.Equal(t, []CartItem{{ProductID: shoes, Quantity: 3}, {ProductID: socks, Quantity: 2}}, items)
+	items = SetCartItem(items, CartItem{ProductID: shoes, Quantity: 0})
+	require.Equal(t, []CartItem{{ProductID: socks, Quantity: 2}}, items)
+	items = SetCartItem(items, CartItem{ProductID: shoes, Quantity: 0})
+	require.Equal(t, []CartItem{{ProductID: socks, Quantity: 2}}, items)
+}
@@ -26,6 +26,7 @@ type Job struct {
 	UpdatedAt           time.Time             `json:"updatedAt" bson:"updatedAt"`
 	CreatedBy           primitive.ObjectID    `json:"createdBy" bson:"createdBy"`
 	CancelledAt         *time.Time            `json:"cancelledAt" bson:"cancelledAt"`
+	CompletedAt         *time.Time            `json:"completedAt" bson:"completedAt"`
 	JobType             ServiceCategory       `json:"jobType" bson:"jobType"`
 	BookedFor           string                `json:"bookedFor" bson:"bookedFor"`
 	BookingNumber       string                `json:"bookingNumber" bson:"bookingNumber"`
@@ -41,6 +42,20 @@ type Job struct {
 	ServiceType         string                `json:"serviceType" bson:"serviceType"`
 	ServiceOrderItems   *[]*ServiceOrderInput `json:"serviceOrderItems" bson:"serviceOrderItems"`
 	InvoiceID           string                `json:"invoiceId" bson:"invoiceId"`
+	PaymentGateway      string                `json:"paymentGateway" bson:"paymentGateway"`
+	GatewayPaymentID    string                `json:"gatewayPaymentID" bson:"gatewayPaymentID"`
+	PaymentStatus       *JobPaymentStatus     `json:"paymentStatus" bson:"paymentStatus"`
+	PaidAt              *time.Time            `json:"paidAt" bson:"paidAt"`
+	PaidAmount          float64               `json:"paidAmount" bson:"paidAmount,omitempty"`             //what the gateway took, checked against the fare
+	PaymentShortfall    float64               `json:"paymentShortfall" bson:"paymentShortfall,omitempty"` //how much the payment fell short of the fare
+	ExcessRefunded      float64               `json:"excessRefunded" bson:"excessRefunded,omitempty"`     //refunded for being paid over the fare, not a refund of the fare
+	RefundedAmount      float64               `json:"refundedAmount" bson:"refundedAmount"`
+	SettledRefunds      float64               `json:"settledRefunds" bson:"settledRefunds,omitempty"` //of the refunded amount, what settlements took back from the provider
+	Dispute             *PaymentDispute       `json:"dispute" bson:"dispute"`
+	PaymentTransfers    []PaymentTransfer     `json:"paymentTransfers" bson:"paymentTransfers"`
+	PaymentMethodID     *primitive.ObjectID   `json:"paymentMethodID" bson:"paymentMethodID,omitempty"` //saved payment method the fare is charged to after the job
+	FareChargeAttempts  int                   `json:"fareChargeAttempts" bson:"fareChargeAttempts"`
+	PaymentMethodType   PaymentMethodType     `json:"paymentMethodType" bson:"paymentMethodType,omitempty"` //CASH when the provider collects the fare
 }
 
 // CreateJob creates new job.
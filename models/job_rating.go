@@ -0,0 +1,451 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/cache"
+	"github.com/tribehq/platform/lib/database"
+	"github.com/tribehq/platform/utils/webhooks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	JobRatingWindow          = 7 * 24 * time.Hour // how long after completion both sides of a job may rate each other
+	RollingRatingCount       = 50                 // number of latest ratings the rolling average is taken over
+	LowRating                = 2                  // ratings at or below this count as low
+	MinRatingsForQualityFlag = 10                 // rolling ratings needed before quality is judged
+	QualityFlagAverage       = 4.0                // rolling averages below this raise the quality flag
+	QualityFlagLowRatings    = 5                  // low ratings among the rolling ones that raise the quality flag
+)
+
+var (
+	ErrJobCancelled          = errors.New("job was cancelled")
+	ErrJobAlreadyCompleted   = errors.New("job is already completed")
+	ErrJobNotCompleted       = errors.New("job is not completed yet")
+	ErrJobRatingWindowClosed = errors.New("job can no longer be rated")
+	ErrJobAlreadyRated       = errors.New("job is already rated")
+	ErrNotJobParticipant     = errors.New("only the user and provider of a job can do this")
+	ErrJobReviewRemoved      = errors.New("review of the job was removed")
+	ErrNoProviderAvailable   = errors.New("no service provider is available for the job")
+)
+
+var (
+	jobReviewIndexesMu    sync.Mutex
+	jobReviewIndexesReady bool
+)
+
+// RatingSummary represents the ratings a user or provider received.
+type RatingSummary struct {
+	AverageRating        float64             `json:"averageRating" bson:"averageRating"`
+	RatingCount          int                 `json:"ratingCount" bson:"ratingCount"`
+	RollingAverageRating float64             `json:"rollingAverageRating" bson:"rollingAverageRating"`
+	RollingRatingCount   int                 `json:"rollingRatingCount" bson:"rollingRatingCount"`
+	LowRatingCount       int                 `json:"lowRatingCount" bson:"lowRatingCount"` //among the rolling ratings
+	QualityFlagged       bool                `json:"qualityFlagged" bson:"qualityFlagged"`
+	QualityFlaggedAt     *time.Time          `json:"qualityFlaggedAt" bson:"qualityFlaggedAt"`
+	QualityReviewedAt    *time.Time          `json:"qualityReviewedAt" bson:"qualityReviewedAt"`
+	QualityReviewedBy    *primitive.ObjectID `json:"qualityReviewedBy" bson:"qualityReviewedBy"`
+}
+
+// DispatchPriority ranks a user or provider for dispatch by their rolling average, counting those without ratings yet as perfect.
+// Flagged ones are halved so they are only offered jobs when nobody better is around.
+func (summary RatingSummary) DispatchPriority() float64 {
+	priority := 5.0
+	if summary.RollingRatingCount > 0 {
+		priority = summary.RollingAverageRating
+	}
+	if summary.QualityFlagged {
+		priority /= 2
+	}
+	return priority
+}
+
+// DispatchPriority ranks a provider for dispatch by the ratings they received.
+func (serviceProvider *ServiceProvider) DispatchPriority() float64 {
+	return serviceProvider.Rating.DispatchPriority()
+}
+
+// rankProvidersForDispatch orders providers by their dispatch priority, best first, keeping the given order among equals.
+func rankProvidersForDispatch(providers []*ServiceProvider) {
+	sort.SliceStable(providers, func(i, j int) bool {
+		return providers[i].DispatchPriority() > providers[j].DispatchPriority()
+	})
+}
+
+// DispatchProvider picks the best ranked active provider offering a service sub category for a new job.
+// Cash jobs skip providers who owe more cash than the market allows.
+func DispatchProvider(serviceSubCategoryID primitive.ObjectID, cash bool) (*ServiceProvider, error) {
+	filter := bson.D{
+		{"serviceSubCategory", serviceSubCategoryID},
+		{"isActive", true},
+		{"blocked", bson.M{"$ne": true}},
+		{"approvedAt", bson.M{"$ne": nil}},
+		{"deletedAt", bson.M{"$exists": false}},
+	}
+	ctx := context.Background()
+	cur, err := database.MongoDB.Collection(ServiceProvidersCollection).Find(ctx, filter)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	var providers []*ServiceProvider
+	err = cur.All(ctx, &providers)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	rankProvidersForDispatch(providers)
+	for _, provider := range providers {
+		if cash && CheckCashJobsAllowed(provider.ID) != nil {
+			continue
+		}
+		return provider, nil
+	}
+	return nil, ErrNoProviderAvailable
+}
+
+// IsJobParticipant tells whether a user is the user of a job or the provider it was assigned to.
+func IsJobParticipant(job *Job, userID primitive.ObjectID) bool {
+	if userID.Hex() == job.UserID {
+		return true
+	}
+	provider := GetServiceProviderByID(job.ProviderID)
+	return !provider.ID.IsZero() && provider.User == userID
+}
+
+// CompleteJob marks a job as completed, opening it for rating by both its user and provider.
+func CompleteJob(job *Job) (*Job, error) {
+	if job.CancelledAt != nil {
+		return nil, ErrJobCancelled
+	}
+	now := time.Now()
+	filter := bson.D{{"_id", job.ID}, {"completedAt", nil}, {"cancelledAt", nil}}
+	update := bson.D{{"$set", bson.D{{"completedAt", now}, {"updatedAt", now}}}}
+	findUpdateOpts := &options.FindOneAndUpdateOptions{}
+	findUpdateOpts.SetReturnDocument(options.After)
+	completed := &Job{}
+	err := database.MongoDB.Collection(JobsCollection).FindOneAndUpdate(context.Background(), filter, update, findUpdateOpts).Decode(completed)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrJobAlreadyCompleted
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	go webhooks.NewWebhookEvent("job.completed", completed)
+	//Update cache item
+	err = cache.RedisClient.Del(completed.ID.Hex()).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	_, err = jobReview(completed)
+	if err != nil {
+		log.Errorln(err)
+	}
+	//the provider is paid out the share of the fare the gateway held for them
+	if len(completed.PaymentTransfers) > 0 {
+		releasePaymentTransfers(JobsCollection, completed.ID, completed.PaymentTransfers)
+	}
+	//pay the provider out of the fare held for the job
+	captured, err := captureJobFare(completed)
+	if err != nil {
+		log.Errorln(err)
+	}
+	//the provider owes the commission of a fare they collected in cash
+	_, err = recordCashJobLiability(completed)
+	if err != nil {
+		log.Errorln(err)
+	}
+	//and pays off what they owe out of a fare paid into their wallet
+	if captured != nil {
+		err = offsetProviderCashLiability(completed.ProviderID)
+		if err != nil {
+			log.Errorln(err)
+		}
+	}
+	//charge the fare to the saved payment method picked for the job
+	charged, err := ChargeJobFare(completed)
+	if err != nil {
+		log.Errorln(err)
+	} else {
+		completed = charged
+	}
+	return completed, nil
+}
+
+// jobReview gives the review holding the ratings of a job, starting it if neither side rated yet.
+func jobReview(job *Job) (*Review, error) {
+	now := time.Now()
+	review := Review{
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		CreatedBy:  job.CreatedBy,
+		JobID:      job.ID,
+		UserID:     job.UserID,
+		ProviderID: job.ProviderID,
+		IsActive:   true,
+	}
+	if job.CompletedAt != nil {
+		review.Date = *job.CompletedAt
+	}
+	if user := GetUserByID(job.UserID); user != nil {
+		review.UserName = user.FirstName + " " + user.LastName
+	}
+	if provider := GetServiceProviderByID(job.ProviderID); !provider.ID.IsZero() {
+		review.ProviderName = provider.FirstName + " " + provider.LastName
+	}
+	ensureJobReviewIndexes()
+	//a job has a single review, removed ones included, so a removed review can't be rated again
+	filter := bson.D{{"jobNumber", job.ID}}
+	update := bson.D{{"$setOnInsert", review}}
+	findUpdateOpts := &options.FindOneAndUpdateOptions{}
+	findUpdateOpts.SetUpsert(true)
+	findUpdateOpts.SetReturnDocument(options.After)
+	collection := database.MongoDB.Collection(ReviewsCollection)
+	err := collection.FindOneAndUpdate(context.Background(), filter, update, findUpdateOpts).Decode(&review)
+	if err != nil && isDuplicateKeyError(err) {
+		//both sides started the review at once, the other upsert won
+		err = collection.FindOne(context.Background(), filter).Decode(&review)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if review.DeletedAt != nil {
+		return nil, ErrJobReviewRemoved
+	}
+	return &review, nil
+}
+
+// ensureJobReviewIndexes keeps a single review per job.
+// Reviews not tied to a job carry a nil job number and are left out.
+func ensureJobReviewIndexes() {
+	jobReviewIndexesMu.Lock()
+	defer jobReviewIndexesMu.Unlock()
+	if jobReviewIndexesReady {
+		return
+	}
+	_, err := database.MongoDB.Collection(ReviewsCollection).Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"jobNumber", 1}},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.D{{"jobNumber", bson.M{"$gt": primitive.NilObjectID}}}),
+	})
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	jobReviewIndexesReady = true
+}
+
+// RateJob records the rating one side of a completed job gives the other and refreshes the ratings of the rated side.
+// Each side rates a job once, within the rating window after its completion.
+func RateJob(job *Job, raterID primitive.ObjectID, rating float64, comment string) (*Review, error) {
+	if rating < 1 || rating > 5 {
+		return nil, ErrInvalidReviewRating
+	}
+	if job.CompletedAt == nil {
+		return nil, ErrJobNotCompleted
+	}
+	now := time.Now()
+	if now.After(job.CompletedAt.Add(JobRatingWindow)) {
+		return nil, ErrJobRatingWindowClosed
+	}
+	if !IsJobParticipant(job, raterID) {
+		return nil, ErrNotJobParticipant
+	}
+	byUser := raterID.Hex() == job.UserID
+
+	review, err := jobReview(job)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	//the user rates the provider and the provider rates the user
+	ratedAtField, ratingField, commentField := "ratedByUserAt", "providerRating", "comment"
+	if !byUser {
+		ratedAtField, ratingField, commentField = "ratedByProviderAt", "userRating", "providerComment"
+	}
+	filter := bson.D{{"_id", review.ID}, {ratedAtField, nil}}
+	update := bson.D{{"$set", bson.D{{ratedAtField, now}, {ratingField, rating}, {commentField, comment}, {"updatedAt", now}}}}
+	findUpdateOpts := &options.FindOneAndUpdateOptions{}
+	findUpdateOpts.SetReturnDocument(options.After)
+	err = database.MongoDB.Collection(ReviewsCollection).FindOneAndUpdate(context.Background(), filter, update, findUpdateOpts).Decode(review)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrJobAlreadyRated
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+
+	//keep the average the rated side had once this rating counted
+	averageField := "providerAverageRating"
+	var summary *RatingSummary
+	if byUser {
+		summary = refreshProviderRating(review.ProviderID, rating)
+	} else {
+		averageField = "userAverageRating"
+		summary = refreshUserRating(review.UserID, rating)
+	}
+	if summary != nil {
+		if byUser {
+			review.ProviderAverageRating = summary.AverageRating
+		} else {
+			review.UserAverageRating = summary.AverageRating
+		}
+		_, err = database.MongoDB.Collection(ReviewsCollection).UpdateOne(context.Background(), bson.D{{"_id", review.ID}}, bson.D{{"$set", bson.D{{averageField, summary.AverageRating}}}})
+		if err != nil {
+			log.Errorln(err)
+		}
+	}
+	go webhooks.NewWebhookEvent("review.rated", review)
+	//Update cache item
+	err = cache.RedisClient.Del(review.ID.Hex()).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	return review, nil
+}
+
+// refreshReviewRatings recounts the ratings of both sides of a review after it was changed or removed.
+func refreshReviewRatings(review *Review) {
+	if review.RatedByUserAt != nil {
+		refreshProviderRating(review.ProviderID, 0)
+	}
+	if review.RatedByProviderAt != nil {
+		refreshUserRating(review.UserID, 0)
+	}
+}
+
+// refreshProviderRating recounts the ratings a provider received from users, latest being the rating just given if any.
+func refreshProviderRating(providerID string, latest float64) *RatingSummary {
+	provider := GetServiceProviderByID(providerID)
+	if provider.ID.IsZero() {
+		return nil
+	}
+	filter := bson.D{{"providerID", providerID}, {"ratedByUserAt", bson.M{"$ne": nil}}}
+	if !countRatings(&provider.Rating, filter, "providerRating", "ratedByUserAt", latest) {
+		return nil
+	}
+	_, err := UpdateServiceProvider(provider)
+	if err != nil {
+		log.Errorln(err)
+	}
+	return &provider.Rating
+}
+
+// refreshUserRating recounts the ratings a user received from providers, latest being the rating just given if any.
+func refreshUserRating(userID string, latest float64) *RatingSummary {
+	user := GetUserByID(userID)
+	if user == nil {
+		return nil
+	}
+	filter := bson.D{{"userID", userID}, {"ratedByProviderAt", bson.M{"$ne": nil}}}
+	if !countRatings(&user.Rating, filter, "userRating", "ratedByProviderAt", latest) {
+		return nil
+	}
+	_, err := UpdateUser(user)
+	if err != nil {
+		log.Errorln(err)
+	}
+	return &user.Rating
+}
+
+// countRatings fills the lifetime and rolling averages of a rating summary from the active reviews matching a filter
+// and raises or drops its quality flag. It tells whether the ratings could be counted.
+func countRatings(summary *RatingSummary, filter bson.D, ratingField string, ratedAtField string, latest float64) bool {
+	ctx := context.Background()
+	collection := database.MongoDB.Collection(ReviewsCollection)
+	filter = append(filter, bson.E{"isActive", true}, bson.E{"deletedAt", bson.M{"$exists": false}})
+
+	pipeline := bson.A{
+		bson.M{"$match": filter},
+		bson.M{"$group": bson.M{"_id": nil, "average": bson.M{"$avg": "$" + ratingField}, "count": bson.M{"$sum": 1}}},
+	}
+	cur, err := collection.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Errorln(err)
+		return false
+	}
+	var lifetime []struct {
+		Average float64 `bson:"average"`
+		Count   int     `bson:"count"`
+	}
+	err = cur.All(ctx, &lifetime)
+	if err != nil {
+		log.Errorln(err)
+		return false
+	}
+	summary.AverageRating, summary.RatingCount = 0, 0
+	if len(lifetime) > 0 {
+		summary.AverageRating, summary.RatingCount = roundRating(lifetime[0].Average), lifetime[0].Count
+	}
+
+	findOpts := options.Find().SetSort(bson.M{ratedAtField: -1}).SetLimit(RollingRatingCount).SetProjection(bson.M{ratingField: 1})
+	cur, err = collection.Find(ctx, filter, findOpts)
+	if err != nil {
+		log.Errorln(err)
+		return false
+	}
+	var rolling []bson.M
+	err = cur.All(ctx, &rolling)
+	if err != nil {
+		log.Errorln(err)
+		return false
+	}
+	total := 0.0
+	summary.RollingAverageRating, summary.RollingRatingCount, summary.LowRatingCount = 0, len(rolling), 0
+	for _, item := range rolling {
+		rating, _ := item[ratingField].(float64)
+		total += rating
+		if rating <= LowRating {
+			summary.LowRatingCount++
+		}
+	}
+	if len(rolling) > 0 {
+		summary.RollingAverageRating = roundRating(total / float64(len(rolling)))
+	}
+
+	assessRatingQuality(summary, latest, time.Now())
+	return true
+}
+
+// assessRatingQuality raises the quality flag of a summary once its rolling ratings are poor and drops it once they recover.
+// After ops reviewed a flag, only a fresh low rating raises it again.
+func assessRatingQuality(summary *RatingSummary, latest float64, now time.Time) {
+	poor := summary.RollingRatingCount >= MinRatingsForQualityFlag &&
+		(summary.RollingAverageRating < QualityFlagAverage || summary.LowRatingCount >= QualityFlagLowRatings)
+	switch {
+	case !poor:
+		summary.QualityFlagged = false
+		summary.QualityFlaggedAt = nil
+	case summary.QualityFlagged:
+	case summary.QualityReviewedAt == nil || (latest > 0 && latest <= LowRating):
+		summary.QualityFlagged = true
+		summary.QualityFlaggedAt = &now
+	}
+}
+
+// ReviewQualityFlag records that ops looked into the quality flag of a rating summary, lowering it.
+func ReviewQualityFlag(summary *RatingSummary, reviewerID primitive.ObjectID) {
+	now := time.Now()
+	summary.QualityFlagged = false
+	summary.QualityReviewedAt = &now
+	summary.QualityReviewedBy = &reviewerID
+}
+
+// roundRating rounds an average rating to two decimals.
+func roundRating(rating float64) float64 {
+	return math.Round(rating*100) / 100
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestDispatchPriority(t *testing.T) {
+	require.Equal(t, 5.0, RatingSummary{}.DispatchPriority())
+	require.Equal(t, 4.2, RatingSummary{RollingRatingCount: 12, RollingAverageRating: 4.2}.DispatchPriority())
+	require.Equal(t, 1.8, RatingSummary{RollingRatingCount: 12, RollingAverageRating: 3.6, QualityFlagged: true}.DispatchPriority())
+}
+
+func TestRankProvidersForDispatch(t *testing.T) {
+	provider := func(name string, rating RatingSummary) *ServiceProvider {
+		return &ServiceProvider{FirstName: name, Rating: rating}
+	}
+	providers := []*ServiceProvider{
+		provider("flagged", RatingSummary{RollingRatingCount: 20, RollingAverageRating: 4.8, QualityFlagged: true}),
+		provider("average", RatingSummary{RollingRatingCount: 20, RollingAverageRating: 4.1}),
+		provider("new", RatingSummary{}),
+		provider("good", RatingSummary{RollingRatingCount: 20, RollingAverageRating: 4.7}),
+		provider("newer", RatingSummary{}),
+	}
+	rankProvidersForDispatch(providers)
+
+	var names []string
+	for _, provider := range providers {
+		names = append(names, provider.FirstName)
+	}
+	require.Equal(t, []string{"new", "newer", "good", "average", "flagged"}, names)
+}
+
+func TestAssessRatingQuality(t *testing.T) {
+	now := time.Now()
+	poor := RatingSummary{RollingRatingCount: MinRatingsForQualityFlag, RollingAverageRating: 3.5}
+
+	t.Run("poor ratings raise the flag", func(t *testing.T) {
+		summary := poor
+		assessRatingQuality(&summary, 4, now)
+		require.True(t, summary.QualityFlagged)
+	})
+	t.Run("a reviewed flag is only raised again by a low rating", func(t *testing.T) {
+		summary := poor
+		summary.QualityReviewedAt = &now
+		assessRatingQuality(&summary, 4, now)
+		require.False(t, summary.QualityFlagged)
+		assessRatingQuality(&summary, LowRating, now)
+		require.True(t, summary.QualityFlagged)
+	})
+	t.Run("recovered ratings drop the flag", func(t *testing.T) {
+		summary := poor
+		summary.QualityFlagged = true
+		summary.RollingAverageRating = 4.6
+		assessRatingQuality(&summary, 0, now)
+		require.False(t, summary.QualityFlagged)
+		require.Nil(t, summary.QualityFlaggedAt)
+	})
+}
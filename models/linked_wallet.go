@@ -0,0 +1,320 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Statuses of a wallet linked to a user's account.
+const (
+	LinkedWalletStatusPending = "pending" // waiting for the otp the provider sent the user
+	LinkedWalletStatusLinked  = "linked"
+	LinkedWalletStatusRevoked = "revoked"
+)
+
+var (
+	// ErrWalletNotLinked is returned when the user has no linked wallet at the provider, or its token expired.
+	ErrWalletNotLinked = errors.New("wallet not linked")
+	// ErrWalletLinkNotStarted is returned when an otp is given for a wallet that isn't waiting for one.
+	ErrWalletLinkNotStarted = errors.New("wallet linking not started")
+	// ErrWalletTokensNotConfigured is returned when there is no key to keep the access tokens of linked wallets with.
+	ErrWalletTokensNotConfigured = errors.New("linked wallet tokens are not configured")
+	// ErrInvalidWalletToken is returned when a kept access token can't be decrypted with the key.
+	ErrInvalidWalletToken = errors.New("invalid linked wallet token")
+)
+
+// sealedWalletTokenPrefix marks the access tokens kept encrypted, tokens kept before they were are plain.
+const sealedWalletTokenPrefix = "sealed:"
+
+// LinkedWallet is a user's account at a wallet provider, like paytm, linked so its balance can be checked and paid with.
+// The provider's access token is kept for debiting the wallet, encrypted with LINKED_WALLET_SECRET, and is never sent to clients.
+// Wallets read with the functions here carry the decrypted token.
+type LinkedWallet struct {
+	ID             primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	CreatedAt      time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt      time.Time          `json:"updatedAt" bson:"updatedAt"`
+	UserID         primitive.ObjectID `json:"userID" bson:"userID"`
+	Provider       string             `json:"provider" bson:"provider"`
+	Mobile         string             `json:"mobile" bson:"mobile"`
+	Status         string             `json:"status" bson:"status"`
+	ProviderUserID string             `json:"-" bson:"providerUserID,omitempty"`
+	OTPState       string             `json:"-" bson:"otpState,omitempty"`
+	Token          string             `json:"-" bson:"token,omitempty"`
+	TokenExpiresAt *time.Time         `json:"tokenExpiresAt" bson:"tokenExpiresAt,omitempty"`
+	LinkedAt       *time.Time         `json:"linkedAt" bson:"linkedAt,omitempty"`
+	RevokedAt      *time.Time         `json:"revokedAt" bson:"revokedAt,omitempty"`
+}
+
+// IsUsable tells whether the wallet is linked with a token that hasn't expired.
+func (w *LinkedWallet) IsUsable() bool {
+	if w.Status != LinkedWalletStatusLinked || w.Token == "" {
+		return false
+	}
+	return w.TokenExpiresAt == nil || w.TokenExpiresAt.After(time.Now())
+}
+
+// walletTokenCipher gives the cipher access tokens of linked wallets are encrypted with.
+func walletTokenCipher() (cipher.AEAD, error) {
+	secret := os.Getenv("LINKED_WALLET_SECRET")
+	if secret == "" {
+		return nil, ErrWalletTokensNotConfigured
+	}
+	key := sha256.Sum256([]byte("linked-wallet-token:" + secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealWalletToken encrypts an access token to be kept.
+func sealWalletToken(token string) (string, error) {
+	aead, err := walletTokenCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(token), nil)
+	return sealedWalletTokenPrefix + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// openWalletToken decrypts a kept access token. Tokens kept before they were encrypted are given as they are.
+func openWalletToken(kept string) (string, error) {
+	if !strings.HasPrefix(kept, sealedWalletTokenPrefix) {
+		return kept, nil
+	}
+	aead, err := walletTokenCipher()
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(kept, sealedWalletTokenPrefix))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrInvalidWalletToken
+	}
+	token, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", ErrInvalidWalletToken
+	}
+	return string(token), nil
+}
+
+// openLinkedWallet decrypts the access token of a wallet read from the database. A token kept plain from before
+// tokens were encrypted is encrypted in place, when it can be.
+func openLinkedWallet(wallet *LinkedWallet) (*LinkedWallet, error) {
+	if wallet.Token == "" {
+		return wallet, nil
+	}
+	kept := wallet.Token
+	token, err := openWalletToken(kept)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	wallet.Token = token
+	if kept == token {
+		sealed, err := sealWalletToken(token)
+		if err != nil {
+			log.Errorln(err)
+			return wallet, nil
+		}
+		filter := bson.D{{"_id", wallet.ID}, {"token", kept}}
+		_, err = database.MongoDB.Collection(LinkedWalletsCollection).UpdateOne(context.Background(), filter, bson.D{{"$set", bson.D{{"token", sealed}}}})
+		if err != nil {
+			log.Errorln(err)
+		}
+	}
+	return wallet, nil
+}
+
+var (
+	linkedWalletIndexesMu    sync.Mutex
+	linkedWalletIndexesReady bool
+)
+
+// ensureLinkedWalletIndexes makes sure a user links only one wallet at each provider.
+func ensureLinkedWalletIndexes() {
+	linkedWalletIndexesMu.Lock()
+	defer linkedWalletIndexesMu.Unlock()
+	if linkedWalletIndexesReady {
+		return
+	}
+	_, err := database.MongoDB.Collection(LinkedWalletsCollection).Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"userID", 1}, {"provider", 1}}, Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	linkedWalletIndexesReady = true
+}
+
+// StartWalletLink keeps the state of the otp a wallet provider sent the user, until the user gives it back.
+// Linking again replaces the wallet linked before, which stays usable until the new one is linked.
+func StartWalletLink(userID primitive.ObjectID, provider string, mobile string, otpState string) (*LinkedWallet, error) {
+	ensureLinkedWalletIndexes()
+	now := time.Now()
+	filter := bson.D{{"userID", userID}, {"provider", provider}}
+	update := bson.D{
+		{"$set", bson.D{{"mobile", mobile}, {"otpState", otpState}, {"updatedAt", now}}},
+		{"$setOnInsert", bson.D{{"createdAt", now}, {"status", LinkedWalletStatusPending}}},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	wallet := &LinkedWallet{}
+	err := database.MongoDB.Collection(LinkedWalletsCollection).FindOneAndUpdate(context.Background(), filter, update, opts).Decode(wallet)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	if wallet.Status == LinkedWalletStatusRevoked {
+		return setLinkedWallet(wallet, bson.D{{"status", LinkedWalletStatusPending}})
+	}
+	return openLinkedWallet(wallet)
+}
+
+// CompleteWalletLink keeps the access token the provider gave for the user's otp, linking the wallet.
+func CompleteWalletLink(wallet *LinkedWallet, token string, expiresAt *time.Time, providerUserID string) (*LinkedWallet, error) {
+	if wallet.OTPState == "" {
+		return nil, ErrWalletLinkNotStarted
+	}
+	sealed, err := sealWalletToken(token)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	now := time.Now()
+	set := bson.D{
+		{"status", LinkedWalletStatusLinked},
+		{"token", sealed},
+		{"providerUserID", providerUserID},
+		{"linkedAt", now},
+	}
+	unset := bson.D{{"otpState", ""}, {"revokedAt", ""}}
+	if expiresAt != nil {
+		set = append(set, bson.E{"tokenExpiresAt", expiresAt})
+	} else {
+		unset = append(unset, bson.E{"tokenExpiresAt", ""})
+	}
+	collection := database.MongoDB.Collection(LinkedWalletsCollection)
+	update := bson.D{{"$set", append(set, bson.E{"updatedAt", now})}, {"$unset", unset}}
+	updated := &LinkedWallet{}
+	filter := bson.D{{"_id", wallet.ID}, {"otpState", wallet.OTPState}}
+	err = collection.FindOneAndUpdate(context.Background(), filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(updated)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrWalletLinkNotStarted
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	updated.Token = token
+	saveLinkedWalletPaymentMethod(updated)
+	return updated, nil
+}
+
+// RevokeLinkedWallet unlinks a wallet, dropping its access token.
+func RevokeLinkedWallet(wallet *LinkedWallet) (*LinkedWallet, error) {
+	now := time.Now()
+	update := bson.D{
+		{"$set", bson.D{{"status", LinkedWalletStatusRevoked}, {"revokedAt", now}, {"updatedAt", now}}},
+		{"$unset", bson.D{{"token", ""}, {"otpState", ""}, {"tokenExpiresAt", ""}}},
+	}
+	updated := &LinkedWallet{}
+	err := database.MongoDB.Collection(LinkedWalletsCollection).FindOneAndUpdate(context.Background(), bson.D{{"_id", wallet.ID}}, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(updated)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	removeLinkedWalletPaymentMethod(updated)
+	return updated, nil
+}
+
+// setLinkedWallet sets fields of a linked wallet.
+func setLinkedWallet(wallet *LinkedWallet, set bson.D) (*LinkedWallet, error) {
+	update := bson.D{{"$set", append(set, bson.E{"updatedAt", time.Now()})}}
+	updated := &LinkedWallet{}
+	err := database.MongoDB.Collection(LinkedWalletsCollection).FindOneAndUpdate(context.Background(), bson.D{{"_id", wallet.ID}}, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(updated)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	return openLinkedWallet(updated)
+}
+
+// GetLinkedWallet gives the user's wallet at a provider, nil when they never linked one.
+func GetLinkedWallet(userID primitive.ObjectID, provider string) (*LinkedWallet, error) {
+	wallet := &LinkedWallet{}
+	filter := bson.D{{"userID", userID}, {"provider", provider}}
+	err := database.MongoDB.Collection(LinkedWalletsCollection).FindOne(context.Background(), filter).Decode(wallet)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	return openLinkedWallet(wallet)
+}
+
+// getLinkedWalletByID gives a linked wallet by id.
+func getLinkedWalletByID(id primitive.ObjectID) (*LinkedWallet, error) {
+	wallet := &LinkedWallet{}
+	err := database.MongoDB.Collection(LinkedWalletsCollection).FindOne(context.Background(), bson.D{{"_id", id}}).Decode(wallet)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	return openLinkedWallet(wallet)
+}
+
+// GetLinkedWallets gives the wallets the user has linked.
+func GetLinkedWallets(userID primitive.ObjectID) ([]*LinkedWallet, error) {
+	ctx := context.Background()
+	filter := bson.D{{"userID", userID}, {"status", LinkedWalletStatusLinked}}
+	cur, err := database.MongoDB.Collection(LinkedWalletsCollection).Find(ctx, filter, options.Find().SetSort(bson.D{{"provider", 1}}))
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var wallets []*LinkedWallet
+	for cur.Next(ctx) {
+		wallet := &LinkedWallet{}
+		if err = cur.Decode(wallet); err != nil {
+			log.Errorln(err)
+			return nil, err
+		}
+		if wallet, err = openLinkedWallet(wallet); err != nil {
+			return nil, err
+		}
+		wallets = append(wallets, wallet)
+	}
+	return wallets, cur.Err()
+}
@@ -0,0 +1,43 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"github.com/stretchr/testify/require"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWalletTokenSealing(t *testing.T) {
+	os.Unsetenv("LINKED_WALLET_SECRET")
+	_, err := sealWalletToken("access-token")
+	require.Equal(t, ErrWalletTokensNotConfigured, err)
+
+	os.Setenv("LINKED_WALLET_SECRET", "secret")
+	defer os.Unsetenv("LINKED_WALLET_SECRET")
+	sealed, err := sealWalletToken("access-token")
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(sealed, sealedWalletTokenPrefix))
+	require.NotContains(t, sealed, "access-token")
+	again, err := sealWalletToken("access-token")
+	require.NoError(t, err)
+	require.NotEqual(t, sealed, again)
+
+	token, err := openWalletToken(sealed)
+	require.NoError(t, err)
+	require.Equal(t, "access-token", token)
+
+	//tokens kept before they were encrypted are read as they are
+	token, err = openWalletToken("plain-token")
+	require.NoError(t, err)
+	require.Equal(t, "plain-token", token)
+
+	_, err = openWalletToken(sealed[:len(sealed)-2] + "xx")
+	require.Equal(t, ErrInvalidWalletToken, err)
+	os.Setenv("LINKED_WALLET_SECRET", "another secret")
+	_, err = openWalletToken(sealed)
+	require.Equal(t, ErrInvalidWalletToken, err)
+}
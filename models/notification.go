@@ -5,17 +5,20 @@
 package models
 
 import (
+	"cloud.google.com/go/pubsub"
 	"context"
 	"encoding/json"
 	"github.com/go-redis/redis"
 	log "github.com/sirupsen/logrus"
 	"github.com/tribehq/platform/lib/cache"
 	"github.com/tribehq/platform/lib/database"
+	ps "github.com/tribehq/platform/lib/pubsub"
 	"github.com/tribehq/platform/utils/webhooks"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"os"
 	"time"
 )
 
@@ -235,3 +238,49 @@ func (notification *PushNotification) UnmarshalBinary(data []byte) error {
 func (notification *PushNotification) MarshalBinary() ([]byte, error) {
 	return json.Marshal(notification)
 }
+
+// pushMessage is the payload the push worker delivers to a device.
+type pushMessage struct {
+	FCMToken string            `json:"fcm_token"`
+	Title    string            `json:"title"`
+	Body     string            `json:"body"`
+	Data     map[string]string `json:"data"`
+}
+
+// SendPush queues the sms template with a code in a language, rendered with data, as a push notification to every device of a user.
+func SendPush(userID string, code string, language string, data interface{}, payload map[string]string) error {
+	smsTemplate, err := GetSMSTemplateByCode(code, language)
+	if err != nil {
+		return err
+	}
+	if smsTemplate == nil {
+		return ErrSMSTemplateNotFound
+	}
+	title, body, err := renderSMSTemplate(smsTemplate, data)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	filter := bson.D{{"userId", userID}, {"fcmToken", bson.M{"$ne": ""}}, {"deletedAt", bson.M{"$exists": false}}}
+	cur, err := database.MongoDB.Collection(InstallationsCollection).Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	var installations []*Installation
+	err = cur.All(ctx, &installations)
+	if err != nil {
+		return err
+	}
+	topic := ps.PubsubClient.Topic(os.Getenv("PUBSUB_PUSH_TOPIC"))
+	for _, installation := range installations {
+		b, err := json.Marshal(&pushMessage{FCMToken: installation.FcmToken, Title: title, Body: body, Data: payload})
+		if err != nil {
+			return err
+		}
+		_, err = topic.Publish(ctx, &pubsub.Message{Data: b}).Get(ctx)
+		if err != nil {
+			log.Errorln(err)
+		}
+	}
+	return nil
+}
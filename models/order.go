@@ -21,57 +21,68 @@ import (
 
 // Order represents a order.
 type Order struct {
-	ID                           primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	CreatedAt                    time.Time          `json:"createdAt" bson:"createdAt"`
-	DeletedAt                    *time.Time         `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
-	UpdatedAt                    time.Time          `json:"updatedAt" bson:"updatedAt"`
-	CreatedBy                    primitive.ObjectID `json:"createdBy" bson:"createdBy"`
-	ParentID                     primitive.ObjectID `json:"parentID" bson:"parentID"`
-	OrderNumber                  int                `json:"orderNumber" bson:"orderNumber"`
-	OrderType                    string             `json:"orderType" bson:"orderType"`
-	StoreID                      primitive.ObjectID `json:"storeId" bson:"storeId"`
-	OrderItems                   OrderItem          `json:"orderItems" bson:"orderItems"`
-	ServiceType                  string             `json:"serviceType" bson:"serviceType"`
-	Coupon                       string             `json:"coupon" bson:"coupon"`
-	ProviderID                   primitive.ObjectID `json:"providerId" bson:"providerId"`
-	DeliveryDriver               string             `json:"deliveryDriver" bson:"deliveryDriver"`
-	DeliveryAddress              Address            `json:"deliveryAddress" bson:"deliveryAddress"`
-	ExpectedEarning              float64            `json:"expectedEarning" bson:"expectedEarning"`
-	EarnedAmount                 float64            `json:"earnedAmount" bson:"earnedAmount"`
-	CancellationAndRefundDetails string             `json:"cancellationAndRefundDetails" bson:"cancellationAndRefundDetails"`
-	OrderKey                     string             `json:"orderKey" bson:"orderKey"`
-	CreatedVia                   string             `json:"createdVia" bson:"createdVia"`
-	Version                      string             `json:"version" bson:"version"`
-	OrderStatus                  OrderStatus        `json:"orderStatus" bson:"orderStatus"`
-	Currency                     Currency           `json:"currency" bson:"currency"`
-	DiscountAmount               float64            `json:"discountAmount" bson:"discountAmount"`
-	DiscountTax                  float64            `json:"discountTax" bson:"discountTax"`
-	ShippingTotal                float64            `json:"shippingTotal" bson:"shippingTotal"`
-	ShippingTax                  float64            `json:"shippingTax" bson:"shippingTax"`
-	CartTax                      float64            `json:"cartTax" bson:"cartTax"`
-	OrderTotalAmount             float64            `json:"orderTotalAmount" bson:"orderTotalAmount"`
-	TotalTax                     float64            `json:"totalTax" bson:"totalTax"`
-	PricesIncludeTax             bool               `json:"pricesIncludeTax" bson:"pricesIncludeTax"`
-	CustomerID                   primitive.ObjectID `json:"customerID" bson:"customerID"`
-	CustomerIPAddress            string             `json:"customerIPAddress" bson:"customerIPAddress"`
-	CustomerUserAgent            string             `json:"customerUserAgent" bson:"customerUserAgent"`
-	CustomerNote                 string             `json:"customerNote" bson:"customerNote"`
-	Billing                      Billing            `json:"billing" bson:"billing"`
-	Shipping                     Shipping           `json:"shipping" bson:"shipping"`
-	PaymentMethod                PaymentMethod      `json:"paymentMethod" bson:"paymentMethod"`
-	PaymentMethodTitle           string             `json:"paymentMethodTitle" bson:"paymentMethodTitle"`
-	TransactionID                primitive.ObjectID `json:"transactionID" bson:"transactionID"`
-	DatePaid                     time.Time          `json:"datePaid" bson:"datePaid"`
-	DateCompleted                time.Time          `json:"dateCompleted" bson:"dateCompleted"`
-	CartHash                     string             `json:"cartHash" bson:"cartHash"`
-	Metadata                     MetaData           `json:"metadata" bson:"metadata"`
-	LineItems                    LineItems          `json:"lineItems" bson:"lineItems"`
-	TaxLines                     TaxLines           `json:"taxLines" bson:"taxLines"`
-	ShippingLine                 ShippingLines      `json:"shippingLines" bson:"shippingLines"`
-	FeeLines                     FeeLines           `json:"feeLines" bson:"feeLines"`
-	CouponLines                  CouponLines        `json:"couponLines" bson:"couponLines"`
-	Refunds                      Refunds            `json:"refunds" bson:"refunds"`
-	IsActive                     bool               `json:"isActive" bson:"isActive"`
+	ID                           primitive.ObjectID   `json:"id,omitempty" bson:"_id,omitempty"`
+	CreatedAt                    time.Time            `json:"createdAt" bson:"createdAt"`
+	DeletedAt                    *time.Time           `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	UpdatedAt                    time.Time            `json:"updatedAt" bson:"updatedAt"`
+	CreatedBy                    primitive.ObjectID   `json:"createdBy" bson:"createdBy"`
+	ParentID                     primitive.ObjectID   `json:"parentID" bson:"parentID"`
+	OrderNumber                  int                  `json:"orderNumber" bson:"orderNumber"`
+	OrderType                    string               `json:"orderType" bson:"orderType"`
+	StoreID                      primitive.ObjectID   `json:"storeId" bson:"storeId"`
+	OrderItems                   []OrderItem          `json:"orderItems" bson:"orderItems"`
+	ServiceType                  string               `json:"serviceType" bson:"serviceType"`
+	Coupon                       string               `json:"coupon" bson:"coupon"`
+	ProviderID                   primitive.ObjectID   `json:"providerId" bson:"providerId"`
+	DeliveryDriver               string               `json:"deliveryDriver" bson:"deliveryDriver"`
+	DeliveryAddress              Address              `json:"deliveryAddress" bson:"deliveryAddress"`
+	ExpectedEarning              float64              `json:"expectedEarning" bson:"expectedEarning"`
+	EarnedAmount                 float64              `json:"earnedAmount" bson:"earnedAmount"`
+	CancellationAndRefundDetails string               `json:"cancellationAndRefundDetails" bson:"cancellationAndRefundDetails"`
+	OrderKey                     string               `json:"orderKey" bson:"orderKey"`
+	CreatedVia                   string               `json:"createdVia" bson:"createdVia"`
+	Version                      string               `json:"version" bson:"version"`
+	OrderStatus                  OrderStatus          `json:"orderStatus" bson:"orderStatus"`
+	Currency                     Currency             `json:"currency" bson:"currency"`
+	DiscountAmount               float64              `json:"discountAmount" bson:"discountAmount"`
+	DiscountTax                  float64              `json:"discountTax" bson:"discountTax"`
+	ShippingTotal                float64              `json:"shippingTotal" bson:"shippingTotal"`
+	ShippingTax                  float64              `json:"shippingTax" bson:"shippingTax"`
+	CartTax                      float64              `json:"cartTax" bson:"cartTax"`
+	OrderTotalAmount             float64              `json:"orderTotalAmount" bson:"orderTotalAmount"`
+	TotalTax                     float64              `json:"totalTax" bson:"totalTax"`
+	PricesIncludeTax             bool                 `json:"pricesIncludeTax" bson:"pricesIncludeTax"`
+	CustomerID                   primitive.ObjectID   `json:"customerID" bson:"customerID"`
+	CustomerIPAddress            string               `json:"customerIPAddress" bson:"customerIPAddress"`
+	CustomerUserAgent            string               `json:"customerUserAgent" bson:"customerUserAgent"`
+	CustomerNote                 string               `json:"customerNote" bson:"customerNote"`
+	Billing                      Billing              `json:"billing" bson:"billing"`
+	Shipping                     Shipping             `json:"shipping" bson:"shipping"`
+	PaymentMethod                PaymentMethod        `json:"paymentMethod" bson:"paymentMethod"`
+	PaymentMethodTitle           string               `json:"paymentMethodTitle" bson:"paymentMethodTitle"`
+	PaymentGateway               string               `json:"paymentGateway" bson:"paymentGateway"`
+	GatewayPaymentID             string               `json:"gatewayPaymentID" bson:"gatewayPaymentID"`
+	PaidAmount                   float64              `json:"paidAmount" bson:"paidAmount,omitempty"`         //what the gateway took, checked against the order total
+	ExcessRefundID               string               `json:"excessRefundID" bson:"excessRefundID,omitempty"` //gateway refund of what was paid over the order total
+	TransactionID                primitive.ObjectID   `json:"transactionID" bson:"transactionID"`
+	DatePaid                     time.Time            `json:"datePaid" bson:"datePaid"`
+	DateCompleted                time.Time            `json:"dateCompleted" bson:"dateCompleted"`
+	CartHash                     string               `json:"cartHash" bson:"cartHash"`
+	Metadata                     MetaData             `json:"metadata" bson:"metadata"`
+	LineItems                    LineItems            `json:"lineItems" bson:"lineItems"`
+	TaxLines                     []TaxLines           `json:"taxLines" bson:"taxLines"`
+	ShippingLine                 ShippingLines        `json:"shippingLines" bson:"shippingLines"`
+	FeeLines                     FeeLines             `json:"feeLines" bson:"feeLines"`
+	CouponLines                  CouponLines          `json:"couponLines" bson:"couponLines"`
+	Refunds                      Refunds              `json:"refunds" bson:"refunds"`
+	StockReduced                 bool                 `json:"stockReduced" bson:"stockReduced"`
+	Commission                   float64              `json:"commission" bson:"commission"`
+	ChildOrders                  []primitive.ObjectID `json:"childOrders" bson:"childOrders"`
+	ScheduledFor                 *time.Time           `json:"scheduledFor" bson:"scheduledFor"`
+	DeliverySlot                 *OrderDeliverySlot   `json:"deliverySlot" bson:"deliverySlot"`
+	Dispute                      *PaymentDispute      `json:"dispute" bson:"dispute"`
+	PaymentTransfers             []PaymentTransfer    `json:"paymentTransfers" bson:"paymentTransfers"`
+	IsActive                     bool                 `json:"isActive" bson:"isActive"`
 }
 
 // CreateOrder creates new order.
@@ -79,6 +90,9 @@ func CreateOrder(order Order) (*Order, error) {
 	order.CreatedAt = time.Now()
 	order.UpdatedAt = time.Now()
 	order.ID = primitive.NewObjectID()
+	if order.OrderStatus == "" {
+		order.OrderStatus = OrderStatusPendingPayment
+	}
 	db := database.MongoDB
 	ordersCollection := db.Collection(OrdersCollection)
 	ctx := context.Background()
@@ -25,6 +25,7 @@ type OrderNote struct {
 	DeletedAt    *time.Time         `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
 	UpdatedAt    time.Time          `json:"updatedAt" bson:"updatedAt"`
 	CreatedBy    primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	OrderID      primitive.ObjectID `json:"orderID" bson:"orderID"`
 	Author       string             `json:"author" bson:"author"`
 	Note         string             `json:"note" bson:"note"`
 	CustomerNote bool               `json:"customerNote" bson:"customerNote"`
@@ -0,0 +1,676 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/cache"
+	"github.com/tribehq/platform/lib/database"
+	"github.com/tribehq/platform/utils/webhooks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+var (
+	// ErrOrderNotFound is returned when the refunded order no longer exists.
+	ErrOrderNotFound = errors.New("order not found")
+	// ErrRefundParentOrder is returned when refunding an order that was split into store orders.
+	ErrRefundParentOrder = errors.New("refund the store orders of this order instead")
+	// ErrOrderNotPaid is returned when refunding an order that hasn't been paid.
+	ErrOrderNotPaid = errors.New("order has not been paid")
+	// ErrInvalidRefundAmount is returned when the refund is empty or more than what is left to refund.
+	ErrInvalidRefundAmount = errors.New("refund amount exceeds the refundable amount")
+	// ErrInvalidRefundLineItem is returned when a refund line isn't part of the order or exceeds its quantity.
+	ErrInvalidRefundLineItem = errors.New("refund line item is not part of the order")
+	// ErrOrderRefundNotPending is returned when approving or rejecting a refund that isn't waiting for approval.
+	ErrOrderRefundNotPending = errors.New("order refund is not waiting for approval")
+	// ErrOrderRefundNotApproved is returned when processing a refund that isn't approved or is processed by another request.
+	ErrOrderRefundNotApproved = errors.New("order refund is not approved or is already being processed")
+	// ErrOrderRefundStatusChanged is returned when the status of a refund changed after it was read.
+	ErrOrderRefundStatusChanged = errors.New("order refund status changed in the meantime")
+	// ErrOrderChanged is returned when an order changed after it was read.
+	ErrOrderChanged = errors.New("order changed in the meantime, reload the order and try again")
+)
+
+// OrderRefund represents a refund of an order.
+type OrderRefund struct {
+	ID              primitive.ObjectID    `json:"id,omitempty" bson:"_id,omitempty"`
+	CreatedAt       time.Time             `json:"createdAt" bson:"createdAt"`
+	DeletedAt       *time.Time            `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	UpdatedAt       time.Time             `json:"updatedAt" bson:"updatedAt"`
+	CreatedBy       primitive.ObjectID    `json:"createdBy" bson:"createdBy"`
+	OrderID         primitive.ObjectID    `json:"orderID" bson:"orderID"`
+	Amount          float64               `json:"amount" bson:"amount"`
+	Tax             float64               `json:"tax" bson:"tax"`
+	Reason          string                `json:"reason" bson:"reason"`
+	LineItems       []OrderRefundLineItem `json:"lineItems" bson:"lineItems"`
+	Restock         bool                  `json:"restock" bson:"restock"`
+	Status          OrderRefundStatus     `json:"status" bson:"status"`
+	Method          OrderRefundMethod     `json:"method" bson:"method"`
+	Gateway         string                `json:"gateway" bson:"gateway"`
+	GatewayRefundID string                `json:"gatewayRefundID" bson:"gatewayRefundID"`
+	Reversed        float64               `json:"reversed" bson:"reversed,omitempty"` // taken back from the store's linked account
+	RequestedBy     primitive.ObjectID    `json:"requestedBy" bson:"requestedBy"`
+	ApprovedBy      *primitive.ObjectID   `json:"approvedBy" bson:"approvedBy"`
+	FailureReason   string                `json:"failureReason" bson:"failureReason"`
+	ProcessedAt     *time.Time            `json:"processedAt" bson:"processedAt"`
+}
+
+// OrderRefundLineItem represents the refunded quantity of an order item.
+type OrderRefundLineItem struct {
+	ProductID   primitive.ObjectID  `json:"productID" bson:"productID"`
+	VariationID *primitive.ObjectID `json:"variationID" bson:"variationID"`
+	Quantity    int                 `json:"quantity" bson:"quantity"`
+	Amount      float64             `json:"amount" bson:"amount"`
+}
+
+// CreateOrderRefund creates new order refund.
+func CreateOrderRefund(orderRefund OrderRefund) (*OrderRefund, error) {
+	orderRefund.CreatedAt = time.Now()
+	orderRefund.UpdatedAt = time.Now()
+	orderRefund.ID = primitive.NewObjectID()
+	db := database.MongoDB
+	collection := db.Collection(OrderRefundsCollection)
+	ctx := context.Background()
+	_, err := collection.InsertOne(ctx, &orderRefund)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	go webhooks.NewWebhookEvent("order_refund.created", &orderRefund)
+	cacheClient := cache.RedisClient
+	//set cache item
+	err = cacheClient.Set(orderRefund.ID.Hex(), orderRefund, DefaultRedisCacheTime).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	return &orderRefund, nil
+}
+
+// GetOrderRefundByID gives order refund by id.
+func GetOrderRefundByID(ID string) (*OrderRefund, error) {
+	db := database.MongoDB
+	orderRefund := &OrderRefund{}
+	//try finding item in cache
+	cacheClient := cache.RedisClient
+	err := cacheClient.Get(ID).Scan(orderRefund)
+	if err != nil && err != redis.Nil {
+		log.Error(err)
+	} else if err == redis.Nil {
+		//key is empty or not set
+	}
+	id, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.D{{"_id", id}, {"deletedAt", bson.M{"$exists": false}}}
+	ctx := context.Background()
+	err = db.Collection(OrderRefundsCollection).FindOne(ctx, filter).Decode(&orderRefund)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	//set cache item
+	err = cacheClient.Set(ID, orderRefund, DefaultRedisCacheTime).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	return orderRefund, nil
+}
+
+// GetOrderRefunds gives a list of order refunds.
+func GetOrderRefunds(filter bson.D, limit int, after *string, before *string, first *int, last *int) (orderRefunds []*OrderRefund, totalCount int64, hasPrevious, hasNext bool, err error) {
+
+	db := database.MongoDB
+
+	tcint, filter, err := calcTotalCountWithQueryFilters(OrderRefundsCollection, filter, after, before)
+	pagingInfo, err := PaginationUtility(after, before, first, last, &tcint)
+	if err != nil {
+		return
+	}
+	pagingInfo.QueryOpts.SetSort(bson.M{"_id": 1})
+
+	cur, err := db.Collection(OrderRefundsCollection).Find(context.Background(), filter, &pagingInfo.QueryOpts)
+	if err != nil {
+		return
+	}
+	ctx := context.Background()
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		orderRefund := &OrderRefund{}
+		err = cur.Decode(&orderRefund)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return
+			}
+			log.Errorln(err)
+		}
+		orderRefunds = append(orderRefunds, orderRefund)
+	}
+	if err = cur.Err(); err != nil {
+		return
+	}
+	return orderRefunds, int64(tcint), pagingInfo.HasPreviousPage, pagingInfo.HasNextPage, nil
+}
+
+// UpdateOrderRefund updates order refund.
+func UpdateOrderRefund(r *OrderRefund) (*OrderRefund, error) {
+	orderRefund := r
+	orderRefund.UpdatedAt = time.Now()
+	filter := bson.D{{"_id", orderRefund.ID}}
+	db := database.MongoDB
+	orderRefundsCollection := db.Collection(OrderRefundsCollection)
+	findRepOpts := &options.FindOneAndReplaceOptions{}
+	findRepOpts.SetReturnDocument(options.After)
+	err := orderRefundsCollection.FindOneAndReplace(context.Background(), filter, orderRefund, findRepOpts).Decode(&orderRefund)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	go webhooks.NewWebhookEvent("order_refund.updated", &orderRefund)
+	//Update cache item
+	cacheClient := cache.RedisClient
+	err = cacheClient.Del(orderRefund.ID.Hex()).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	return orderRefund, nil
+}
+
+//UnmarshalBinary required for the redis cache to work
+func (orderRefund *OrderRefund) UnmarshalBinary(data []byte) error {
+	if err := json.Unmarshal(data, orderRefund); err != nil {
+		return err
+	}
+	return nil
+}
+
+//MarshalBinary required for the redis cache to work
+func (orderRefund *OrderRefund) MarshalBinary() ([]byte, error) {
+	return json.Marshal(orderRefund)
+}
+
+// getOpenOrderRefunds gives the refunds of an order that are waiting for approval or being processed.
+func getOpenOrderRefunds(orderID primitive.ObjectID) ([]*OrderRefund, error) {
+	var orderRefunds []*OrderRefund
+	filter := bson.D{
+		{"orderID", orderID},
+		{"status", bson.M{"$in": []OrderRefundStatus{OrderRefundStatusPendingApproval, OrderRefundStatusApproved, OrderRefundStatusProcessing}}},
+		{"deletedAt", bson.M{"$exists": false}},
+	}
+	ctx := context.Background()
+	cur, err := database.MongoDB.Collection(OrderRefundsCollection).Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		orderRefund := &OrderRefund{}
+		err = cur.Decode(&orderRefund)
+		if err != nil {
+			log.Errorln(err)
+			continue
+		}
+		orderRefunds = append(orderRefunds, orderRefund)
+	}
+	return orderRefunds, cur.Err()
+}
+
+// claimOrderRefund moves a refund out of the status it is expected in, setting the given fields along.
+// It fails with ErrOrderRefundStatusChanged when another request moved the refund first.
+func claimOrderRefund(id primitive.ObjectID, from OrderRefundStatus, set bson.D) (*OrderRefund, error) {
+	set = append(set, bson.E{"updatedAt", time.Now()})
+	filter := bson.D{{"_id", id}, {"status", from}}
+	findUpdateOpts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	orderRefund := &OrderRefund{}
+	err := database.MongoDB.Collection(OrderRefundsCollection).FindOneAndUpdate(context.Background(), filter, bson.D{{"$set", set}}, findUpdateOpts).Decode(orderRefund)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrOrderRefundStatusChanged
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	go webhooks.NewWebhookEvent("order_refund.updated", orderRefund)
+	//Update cache item
+	err = cache.RedisClient.Del(orderRefund.ID.Hex()).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	return orderRefund, nil
+}
+
+// failOrderRefund marks a refund being processed as failed.
+func failOrderRefund(refund *OrderRefund, reason error) {
+	_, err := claimOrderRefund(refund.ID, OrderRefundStatusProcessing, bson.D{{"status", OrderRefundStatusFailed}, {"failureReason", reason.Error()}})
+	if err != nil {
+		log.Errorln(err)
+	}
+}
+
+// orderPayment gives the gateway, gateway payment id and order id of the payment that paid for the order,
+// child orders are paid through their parent order.
+func orderPayment(order *Order) (gateway string, paymentID string, orderID primitive.ObjectID) {
+	if order.PaymentGateway == "" && !order.ParentID.IsZero() {
+		parent, err := GetOrderByID(order.ParentID.Hex())
+		if err != nil {
+			log.Errorln(err)
+		}
+		if parent != nil {
+			return parent.PaymentGateway, parent.GatewayPaymentID, parent.ID
+		}
+	}
+	return order.PaymentGateway, order.GatewayPaymentID, order.ID
+}
+
+// refundApprovalThreshold gives the refund amount above which refunds wait for an admin's approval, zero disables approvals.
+func refundApprovalThreshold() float64 {
+	settings, err := GetCurrentMarketSettings()
+	if err != nil {
+		log.Errorln(err)
+	}
+	if settings == nil {
+		return 0
+	}
+	return settings.Payment.RefundApprovalThreshold
+}
+
+// orderRefundable gives what is left to refund of an order and the quantities of its items already refunded or being refunded.
+func orderRefundable(order *Order, openRefunds []*OrderRefund) (float64, map[string]int) {
+	refundable := order.OrderTotalAmount - order.Refunds.Total
+	quantities := map[string]int{}
+	for _, item := range order.OrderItems {
+		quantities[orderItemKey(item.ID, item.VariationID)] += item.RefundedQuantity
+	}
+	for _, openRefund := range openRefunds {
+		refundable -= openRefund.Amount
+		for _, line := range openRefund.LineItems {
+			quantities[orderItemKey(line.ProductID, line.VariationID)] += line.Quantity
+		}
+	}
+	return roundAmount(refundable), quantities
+}
+
+// overRefunded tells whether the refunds of an order add up to more than the order, by amount or by item quantities.
+func overRefunded(order *Order, openRefunds []*OrderRefund) bool {
+	refundable, quantities := orderRefundable(order, openRefunds)
+	if refundable < 0 {
+		return true
+	}
+	for _, item := range order.OrderItems {
+		if quantities[orderItemKey(item.ID, item.VariationID)] > item.Quantity {
+			return true
+		}
+	}
+	return false
+}
+
+// priceOrderRefund gives the amount, tax and lines of a refund of an order in full, by amount or by line items,
+// failing when it asks for more than what is left to refund.
+func priceOrderRefund(order *Order, input RefundOrderInput, openRefunds []*OrderRefund) (float64, float64, []OrderRefundLineItem, error) {
+	refundable, refundedQuantities := orderRefundable(order, openRefunds)
+
+	//price the refunded lines, sharing the order discount and cart tax out by line value
+	var itemsSubtotal float64
+	for _, item := range order.OrderItems {
+		itemsSubtotal += item.Price * float64(item.Quantity)
+	}
+	var lines []OrderRefundLineItem
+	var linesAmount, linesTax float64
+	for _, line := range input.LineItems {
+		item := findOrderItem(order, line.ProductID, line.VariationID)
+		key := orderItemKey(line.ProductID, line.VariationID)
+		if item == nil || line.Quantity <= 0 || line.Quantity > item.Quantity-refundedQuantities[key] {
+			return 0, 0, nil, ErrInvalidRefundLineItem
+		}
+		refundedQuantities[key] += line.Quantity
+		value := item.Price * float64(line.Quantity)
+		amount := value
+		var tax float64
+		if itemsSubtotal > 0 {
+			amount -= order.DiscountAmount * value / itemsSubtotal
+			tax = order.CartTax * value / itemsSubtotal
+		}
+		//items taxed at checkout carry their own tax
+		if len(order.TaxLines) > 0 && item.Quantity > 0 {
+			tax = item.Tax * float64(line.Quantity) / float64(item.Quantity)
+		}
+		if !order.PricesIncludeTax {
+			amount += tax
+		}
+		amount = roundAmount(amount)
+		lines = append(lines, OrderRefundLineItem{ProductID: line.ProductID, VariationID: line.VariationID, Quantity: line.Quantity, Amount: amount})
+		linesAmount += amount
+		linesTax += tax
+	}
+
+	amount := refundable
+	tax := order.TotalTax - order.Refunds.TotalTax
+	switch {
+	case input.Amount != nil:
+		amount = roundAmount(*input.Amount)
+		if order.OrderTotalAmount > 0 {
+			tax = order.TotalTax * amount / order.OrderTotalAmount
+		}
+	case len(lines) > 0:
+		amount, tax = roundAmount(linesAmount), linesTax
+	}
+	if amount <= 0 || amount > refundable {
+		return 0, 0, nil, ErrInvalidRefundAmount
+	}
+	return amount, roundAmount(tax), lines, nil
+}
+
+// RequestOrderRefund refunds an order in full, by amount or by line items.
+// Refunds above the approval threshold wait for ApproveOrderRefund, others are processed right away.
+func RequestOrderRefund(order *Order, input RefundOrderInput, requestedBy primitive.ObjectID, author string) (*OrderRefund, error) {
+	if len(order.ChildOrders) > 0 {
+		return nil, ErrRefundParentOrder
+	}
+	if order.DatePaid.IsZero() {
+		return nil, ErrOrderNotPaid
+	}
+	openRefunds, err := getOpenOrderRefunds(order.ID)
+	if err != nil {
+		return nil, err
+	}
+	amount, tax, lines, err := priceOrderRefund(order, input, openRefunds)
+	if err != nil {
+		return nil, err
+	}
+
+	orderRefund := OrderRefund{
+		CreatedBy:   requestedBy,
+		OrderID:     order.ID,
+		Amount:      amount,
+		Tax:         tax,
+		LineItems:   lines,
+		Restock:     input.Restock,
+		Status:      OrderRefundStatusApproved,
+		Method:      OrderRefundMethodWallet,
+		RequestedBy: requestedBy,
+	}
+	if input.Reason != nil {
+		orderRefund.Reason = *input.Reason
+	}
+	gateway, _, _ := orderPayment(order)
+	if _, ok := GetPaymentRefunder(gateway); ok && (input.ToWallet == nil || !*input.ToWallet) {
+		orderRefund.Method = OrderRefundMethodGateway
+		orderRefund.Gateway = gateway
+	}
+	if threshold := refundApprovalThreshold(); threshold > 0 && amount > threshold {
+		orderRefund.Status = OrderRefundStatusPendingApproval
+	}
+	refund, err := CreateOrderRefund(orderRefund)
+	if err != nil {
+		return nil, err
+	}
+
+	//refunds requested at the same time only see each other once both are saved, the one that tips the order over is rejected
+	err = checkOrderRefundConflict(refund)
+	if err != nil {
+		return nil, err
+	}
+	if refund.Status == OrderRefundStatusPendingApproval {
+		_, err = CreateOrderNote(OrderNote{OrderID: order.ID, Author: author, Note: fmt.Sprintf("Refund of %.2f is waiting for approval.", refund.Amount), IsActive: true})
+		if err != nil {
+			log.Errorln(err)
+		}
+		return refund, nil
+	}
+	return ProcessOrderRefund(refund, author)
+}
+
+// checkOrderRefundConflict rejects a refund just requested when, together with the other refunds of its order,
+// it refunds more than the order.
+func checkOrderRefundConflict(refund *OrderRefund) error {
+	order, err := GetOrderByID(refund.OrderID.Hex())
+	if err != nil {
+		return err
+	}
+	if order == nil {
+		return ErrOrderNotFound
+	}
+	openRefunds, err := getOpenOrderRefunds(order.ID)
+	if err != nil {
+		return err
+	}
+	if !overRefunded(order, openRefunds) {
+		return nil
+	}
+	_, err = claimOrderRefund(refund.ID, refund.Status, bson.D{{"status", OrderRefundStatusRejected}, {"failureReason", ErrInvalidRefundAmount.Error()}})
+	if err != nil {
+		log.Errorln(err)
+	}
+	return ErrInvalidRefundAmount
+}
+
+// ApproveOrderRefund approves a refund waiting for approval and processes it.
+func ApproveOrderRefund(refund *OrderRefund, approvedBy primitive.ObjectID, author string) (*OrderRefund, error) {
+	refund, err := claimOrderRefund(refund.ID, OrderRefundStatusPendingApproval, bson.D{{"status", OrderRefundStatusApproved}, {"approvedBy", approvedBy}})
+	if err == ErrOrderRefundStatusChanged {
+		return nil, ErrOrderRefundNotPending
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ProcessOrderRefund(refund, author)
+}
+
+// RejectOrderRefund rejects a refund waiting for approval.
+func RejectOrderRefund(refund *OrderRefund, rejectedBy primitive.ObjectID, reason string) (*OrderRefund, error) {
+	refund, err := claimOrderRefund(refund.ID, OrderRefundStatusPendingApproval, bson.D{{"status", OrderRefundStatusRejected}, {"approvedBy", rejectedBy}, {"failureReason", reason}})
+	if err == ErrOrderRefundStatusChanged {
+		return nil, ErrOrderRefundNotPending
+	}
+	return refund, err
+}
+
+// ProcessOrderRefund pays an approved refund back through the original gateway or to the customer's wallet,
+// restocks the refunded items and updates the order totals. Fully refunded orders move to REFUNDED.
+// The refund is claimed before paying it back so only one request pays it, and its id is the idempotency key
+// of the gateway refund or wallet credit.
+func ProcessOrderRefund(refund *OrderRefund, author string) (*OrderRefund, error) {
+	refund, err := claimOrderRefund(refund.ID, OrderRefundStatusApproved, bson.D{{"status", OrderRefundStatusProcessing}})
+	if err == ErrOrderRefundStatusChanged {
+		return nil, ErrOrderRefundNotApproved
+	}
+	if err != nil {
+		return nil, err
+	}
+	order, err := GetOrderByID(refund.OrderID.Hex())
+	if err == nil && order == nil {
+		err = ErrOrderNotFound
+	}
+	if err != nil {
+		failOrderRefund(refund, err)
+		return nil, err
+	}
+
+	switch refund.Method {
+	case OrderRefundMethodGateway:
+		gateway, paymentID, paymentOrderID := orderPayment(order)
+		refunder, ok := GetPaymentRefunder(gateway)
+		if !ok || paymentID == "" {
+			refund.Method = OrderRefundMethodWallet
+			break
+		}
+		refund.GatewayRefundID, err = refunder.RefundPayment(GatewayRefund{
+			RefundID:  refund.ID.Hex(),
+			OrderID:   paymentOrderID.Hex(),
+			PaymentID: paymentID,
+			Amount:    refund.Amount,
+			Currency:  order.Currency.CurrencyCode,
+			Reason:    refund.Reason,
+		})
+		if err != nil {
+			failOrderRefund(refund, err)
+			return nil, err
+		}
+	}
+	if refund.Method == OrderRefundMethodWallet {
+		posting, err := CreditUserWallet(order.CustomerID.Hex(), refund.Amount, BalanceForRefund, fmt.Sprintf("Refund for order #%d", order.OrderNumber), "order_refund:"+refund.ID.Hex(), refund)
+		if err != nil {
+			failOrderRefund(refund, err)
+			return nil, err
+		}
+		refund.Gateway = "wallet"
+		refund.GatewayRefundID = posting.ID.Hex()
+	}
+	return recordOrderRefund(order, refund, author)
+}
+
+// recordOrderRefund books a refund paid back to the customer against its order, restocking the refunded items,
+// updating the order totals and moving fully refunded orders to REFUNDED.
+func recordOrderRefund(order *Order, refund *OrderRefund, author string) (*OrderRefund, error) {
+	var err error
+	for attempt := 0; ; attempt++ {
+		var stockChanges []orderStockChange
+		order, stockChanges, err = bookOrderRefund(order, refund)
+		if err != ErrOrderChanged || attempt == 2 {
+			if err == nil {
+				applyOrderStockChanges(stockChanges)
+			}
+			break
+		}
+		order, err = GetOrderByID(refund.OrderID.Hex())
+		if err == nil && order == nil {
+			err = ErrOrderNotFound
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err != nil {
+		//the money went back already, keep the gateway refund on the record so it can be booked by hand
+		_, updateErr := claimOrderRefund(refund.ID, OrderRefundStatusProcessing, bson.D{{"method", refund.Method}, {"gateway", refund.Gateway}, {"gatewayRefundID", refund.GatewayRefundID}})
+		if updateErr != nil {
+			log.Errorln(updateErr)
+		}
+		return nil, err
+	}
+
+	//the store's share of the refund comes back out of what the gateway transferred to it
+	if len(order.PaymentTransfers) > 0 {
+		refund.Reversed = reversePaymentTransfers(OrdersCollection, order.ID, order.PaymentTransfers, SettlementPayeeStore, refund.Amount, refund.ID.Hex(), refund.Gateway)
+	}
+	refund, err = claimOrderRefund(refund.ID, OrderRefundStatusProcessing, bson.D{
+		{"status", OrderRefundStatusProcessed},
+		{"processedAt", time.Now()},
+		{"method", refund.Method},
+		{"gateway", refund.Gateway},
+		{"gatewayRefundID", refund.GatewayRefundID},
+		{"reversed", refund.Reversed},
+	})
+	if err != nil {
+		return nil, err
+	}
+	note := fmt.Sprintf("Refunded %.2f via %s.", refund.Amount, refund.Gateway)
+	if refund.Reason != "" {
+		note = note + " " + refund.Reason
+	}
+	_, err = CreateOrderNote(OrderNote{OrderID: order.ID, Author: author, Note: note, CustomerNote: true, IsActive: true})
+	if err != nil {
+		log.Errorln(err)
+	}
+	go webhooks.NewWebhookEvent("order.refunded", refund)
+
+	if order.Refunds.Total >= order.OrderTotalAmount && CanTransitionOrderStatus(order, OrderStatusRefunded) {
+		_, err = TransitionOrderStatus(order, OrderStatusRefunded, author, refund.Reason)
+		if err != nil {
+			log.Errorln(err)
+		}
+	} else if !order.ParentID.IsZero() {
+		err = rollUpParentOrderStatus(order.ParentID, author)
+		if err != nil {
+			log.Errorln(err)
+		}
+	}
+	return refund, nil
+}
+
+// applyOrderRefund records the refunded lines and totals of a refund on its order and gives the stock to hand back.
+func applyOrderRefund(order *Order, refund *OrderRefund) []orderStockChange {
+	var stockChanges []orderStockChange
+	for _, line := range refund.LineItems {
+		item := findOrderItem(order, line.ProductID, line.VariationID)
+		if item == nil {
+			continue
+		}
+		item.RefundedQuantity += line.Quantity
+		if refund.Restock && order.StockReduced && item.RestockedQuantity < item.Quantity {
+			quantity := line.Quantity
+			if quantity > item.Quantity-item.RestockedQuantity {
+				quantity = item.Quantity - item.RestockedQuantity
+			}
+			item.RestockedQuantity += quantity
+			stockChanges = append(stockChanges, orderStockChange{productID: item.ID, variationID: item.VariationID, quantity: quantity})
+		}
+	}
+	order.Refunds = Refunds{
+		ID:       refund.ID,
+		Reason:   refund.Reason,
+		Total:    roundAmount(order.Refunds.Total + refund.Amount),
+		TotalTax: roundAmount(order.Refunds.TotalTax + refund.Tax),
+	}
+	return stockChanges
+}
+
+// bookOrderRefund saves a refund on its order unless the order changed since it was read,
+// so refunds processed at the same time don't overwrite each other's totals.
+func bookOrderRefund(order *Order, refund *OrderRefund) (*Order, []orderStockChange, error) {
+	//the database keeps times to the millisecond, orders read from the cache may carry more
+	previousUpdatedAt := order.UpdatedAt.Truncate(time.Millisecond)
+	stockChanges := applyOrderRefund(order, refund)
+	order.UpdatedAt = time.Now()
+	filter := bson.D{{"_id", order.ID}, {"updatedAt", previousUpdatedAt}}
+	findRepOpts := options.FindOneAndReplace().SetReturnDocument(options.After)
+	updated := &Order{}
+	err := database.MongoDB.Collection(OrdersCollection).FindOneAndReplace(context.Background(), filter, order, findRepOpts).Decode(updated)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil, ErrOrderChanged
+		}
+		log.Errorln(err)
+		return nil, nil, err
+	}
+	go webhooks.NewWebhookEvent("order.updated", updated)
+	//Update cache item
+	err = cache.RedisClient.Del(updated.ID.Hex()).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	return updated, stockChanges, nil
+}
+
+// orderItemKey identifies an order item by its product and variation.
+func orderItemKey(productID primitive.ObjectID, variationID *primitive.ObjectID) string {
+	if variationID == nil {
+		return productID.Hex()
+	}
+	return productID.Hex() + "/" + variationID.Hex()
+}
+
+// findOrderItem gives the order item of a product and variation.
+func findOrderItem(order *Order, productID primitive.ObjectID, variationID *primitive.ObjectID) *OrderItem {
+	key := orderItemKey(productID, variationID)
+	for i := range order.OrderItems {
+		if orderItemKey(order.OrderItems[i].ID, order.OrderItems[i].VariationID) == key {
+			return &order.OrderItems[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+)
+
+// refundTestOrder gives a paid order of two items with a discount and cart tax.
+func refundTestOrder() *Order {
+	return &Order{
+		ID: primitive.NewObjectID(),
+		OrderItems: []OrderItem{
+			{ID: primitive.NewObjectID(), Price: 10, Quantity: 2},
+			{ID: primitive.NewObjectID(), Price: 30, Quantity: 1},
+		},
+		DiscountAmount:   5,
+		CartTax:          4.5,
+		TotalTax:         4.5,
+		OrderTotalAmount: 49.5,
+		StockReduced:     true,
+	}
+}
+
+func TestPriceOrderRefund(t *testing.T) {
+	t.Run("refunds the rest of the order by default", func(t *testing.T) {
+		order := refundTestOrder()
+		amount, tax, lines, err := priceOrderRefund(order, RefundOrderInput{}, nil)
+		require.NoError(t, err)
+		require.Equal(t, 49.5, amount)
+		require.Equal(t, 4.5, tax)
+		require.Empty(t, lines)
+	})
+	t.Run("prices line items with their share of discount and tax", func(t *testing.T) {
+		order := refundTestOrder()
+		input := RefundOrderInput{LineItems: []*OrderRefundLineItemInput{{ProductID: order.OrderItems[0].ID, Quantity: 1}}}
+		amount, tax, lines, err := priceOrderRefund(order, input, nil)
+		require.NoError(t, err)
+		require.Equal(t, 9.9, amount)
+		require.Equal(t, 0.9, tax)
+		require.Len(t, lines, 1)
+		require.Equal(t, 9.9, lines[0].Amount)
+	})
+	t.Run("open refunds count against the refundable amount", func(t *testing.T) {
+		order := refundTestOrder()
+		requested := 10.0
+		open := []*OrderRefund{{Amount: 40}}
+		_, _, _, err := priceOrderRefund(order, RefundOrderInput{Amount: &requested}, open)
+		require.Equal(t, ErrInvalidRefundAmount, err)
+	})
+	t.Run("refunded and open quantities can't be refunded again", func(t *testing.T) {
+		order := refundTestOrder()
+		order.OrderItems[0].RefundedQuantity = 1
+		open := []*OrderRefund{{Amount: 9.9, LineItems: []OrderRefundLineItem{{ProductID: order.OrderItems[0].ID, Quantity: 1}}}}
+		input := RefundOrderInput{LineItems: []*OrderRefundLineItemInput{{ProductID: order.OrderItems[0].ID, Quantity: 1}}}
+		_, _, _, err := priceOrderRefund(order, input, open)
+		require.Equal(t, ErrInvalidRefundLineItem, err)
+	})
+	t.Run("items not in the order are rejected", func(t *testing.T) {
+		order := refundTestOrder()
+		input := RefundOrderInput{LineItems: []*OrderRefundLineItemInput{{ProductID: primitive.NewObjectID(), Quantity: 1}}}
+		_, _, _, err := priceOrderRefund(order, input, nil)
+		require.Equal(t, ErrInvalidRefundLineItem, err)
+	})
+}
+
+func TestOverRefunded(t *testing.T) {
+	order := refundTestOrder()
+	require.False(t, overRefunded(order, []*OrderRefund{{Amount: 30}}))
+	//two refunds requested at the same time for more than the order together
+	require.True(t, overRefunded(order, []*OrderRefund{{Amount: 30}, {Amount: 30}}))
+
+	itemID := order.OrderItems[1].ID
+	line := OrderRefundLineItem{ProductID: itemID, Quantity: 1}
+	require.True(t, overRefunded(order, []*OrderRefund{{Amount: 1, LineItems: []OrderRefundLineItem{line}}, {Amount: 1, LineItems: []OrderRefundLineItem{line}}}))
+}
+
+func TestApplyOrderRefund(t *testing.T) {
+	order := refundTestOrder()
+	refund := &OrderRefund{
+		ID:        primitive.NewObjectID(),
+		Amount:    9.9,
+		Tax:       0.9,
+		Restock:   true,
+		LineItems: []OrderRefundLineItem{{ProductID: order.OrderItems[0].ID, Quantity: 1}},
+	}
+	changes := applyOrderRefund(order, refund)
+	require.Equal(t, []orderStockChange{{productID: order.OrderItems[0].ID, quantity: 1}}, changes)
+	require.Equal(t, 1, order.OrderItems[0].RefundedQuantity)
+	require.Equal(t, 1, order.OrderItems[0].RestockedQuantity)
+	require.Equal(t, 9.9, order.Refunds.Total)
+	require.Equal(t, 0.9, order.Refunds.TotalTax)
+
+	//a second refund adds up and orders whose stock was never taken aren't restocked
+	order.StockReduced = false
+	changes = applyOrderRefund(order, refund)
+	require.Empty(t, changes)
+	require.Equal(t, 2, order.OrderItems[0].RefundedQuantity)
+	require.Equal(t, 19.8, order.Refunds.Total)
+}
@@ -28,6 +28,14 @@ type OrderStatusUtility struct {
 	CreatedBy         primitive.ObjectID `json:"createdBy" bson:"createdBy"`
 	StatusTitle       string             `json:"statusTitle" bson:"statusTitle"`
 	StatusDescription string             `json:"statusDescription" bson:"statusDescription"`
+	Status            OrderStatus        `json:"status" bson:"status"`
+	ServiceCategory   StoreCategory      `json:"serviceCategory" bson:"serviceCategory"`
+	NextStatuses      []OrderStatus      `json:"nextStatuses" bson:"nextStatuses"`
+	NotifyCustomer    bool               `json:"notifyCustomer" bson:"notifyCustomer"`
+	NotifyStore       bool               `json:"notifyStore" bson:"notifyStore"`
+	ReleaseStock      bool               `json:"releaseStock" bson:"releaseStock"`
+	RefundPayment     bool               `json:"refundPayment" bson:"refundPayment"`
+	WebhookEvent      string             `json:"webhookEvent" bson:"webhookEvent"`
 	IsActive          bool               `json:"isActive" bson:"isActive"`
 }
 
@@ -89,6 +97,23 @@ func GetOrderStatusUtilityByID(ID string) (*OrderStatusUtility, error) {
 	return orderStatusUtility, nil
 }
 
+// GetOrderStatusUtilityByFilter gives order status utility by query filter.
+func GetOrderStatusUtilityByFilter(filter bson.D) (*OrderStatusUtility, error) {
+	db := database.MongoDB
+	orderStatusUtility := &OrderStatusUtility{}
+	filter = append(filter, bson.E{"deletedAt", bson.M{"$exists": false}}) // we dont want deleted documents
+	ctx := context.Background()
+	err := db.Collection(OrderStatusUtilityCollection).FindOne(ctx, filter).Decode(&orderStatusUtility)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	return orderStatusUtility, nil
+}
+
 // GetOrderstatusUtilities gives a list of order status utilities.
 func GetOrderstatusUtilities(filter bson.D, limit int, after *string, before *string, first *int, last *int) (orderSatusUtilities []*OrderStatusUtility, totalCount int64, hasPrevious, hasNext bool, err error) {
 
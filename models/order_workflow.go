@@ -0,0 +1,500 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/cache"
+	"github.com/tribehq/platform/lib/database"
+	"github.com/tribehq/platform/utils/webhooks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidOrderStatusTransition is returned when an order can't move to the requested status.
+	ErrInvalidOrderStatusTransition = errors.New("order status transition is not allowed")
+	// ErrOrderStatusChanged is returned when the status of an order changed after it was read.
+	ErrOrderStatusChanged = errors.New("order status changed in the meantime, reload the order and try again")
+)
+
+// orderStatusTransitions maps a status to the statuses an order can move to from it.
+type orderStatusTransitions map[OrderStatus][]OrderStatus
+
+// foodOrderStatusTransitions is the default workflow for food orders, which can't be cancelled once the kitchen starts preparing them.
+var foodOrderStatusTransitions = orderStatusTransitions{
+	OrderStatusPendingPayment: {OrderStatusPlaced, OrderStatusCancelled, OrderStatusFailed},
+	OrderStatusPlaced:         {OrderStatusAccepted, OrderStatusDeclined, OrderStatusCancelled},
+	OrderStatusAccepted:       {OrderStatusProcessing, OrderStatusCancelled},
+	OrderStatusProcessing:     {OrderStatusReady},
+	OrderStatusReady:          {OrderStatusDispatched, OrderStatusDelivered},
+	OrderStatusDispatched:     {OrderStatusDelivered, OrderStatusFailed},
+	OrderStatusDelivered:      {OrderStatusCompleted, OrderStatusRefunded},
+	OrderStatusCompleted:      {OrderStatusRefunded},
+	OrderStatusDeclined:       {OrderStatusRefunded},
+	OrderStatusCancelled:      {OrderStatusRefunded},
+	OrderStatusFailed:         {OrderStatusRefunded},
+}
+
+// groceryOrderStatusTransitions is the default workflow for grocery and wine orders, which can be cancelled until dispatched.
+var groceryOrderStatusTransitions = orderStatusTransitions{
+	OrderStatusPendingPayment: {OrderStatusPlaced, OrderStatusCancelled, OrderStatusFailed},
+	OrderStatusPlaced:         {OrderStatusAccepted, OrderStatusDeclined, OrderStatusCancelled},
+	OrderStatusAccepted:       {OrderStatusProcessing, OrderStatusCancelled},
+	OrderStatusProcessing:     {OrderStatusReady, OrderStatusCancelled},
+	OrderStatusReady:          {OrderStatusDispatched, OrderStatusDelivered, OrderStatusCancelled},
+	OrderStatusDispatched:     {OrderStatusDelivered, OrderStatusFailed},
+	OrderStatusDelivered:      {OrderStatusCompleted, OrderStatusRefunded},
+	OrderStatusCompleted:      {OrderStatusRefunded},
+	OrderStatusDeclined:       {OrderStatusRefunded},
+	OrderStatusCancelled:      {OrderStatusRefunded},
+	OrderStatusFailed:         {OrderStatusRefunded},
+}
+
+// retailOrderStatusTransitions is the default workflow for retail orders, which skip acceptance and can be returned after delivery.
+var retailOrderStatusTransitions = orderStatusTransitions{
+	OrderStatusPendingPayment: {OrderStatusPlaced, OrderStatusCancelled, OrderStatusFailed},
+	OrderStatusPlaced:         {OrderStatusProcessing, OrderStatusDeclined, OrderStatusCancelled},
+	OrderStatusProcessing:     {OrderStatusReady, OrderStatusCancelled},
+	OrderStatusReady:          {OrderStatusDispatched, OrderStatusCancelled},
+	OrderStatusDispatched:     {OrderStatusDelivered, OrderStatusFailed},
+	OrderStatusDelivered:      {OrderStatusCompleted, OrderStatusRefunded},
+	OrderStatusCompleted:      {OrderStatusRefunded},
+	OrderStatusDeclined:       {OrderStatusRefunded},
+	OrderStatusCancelled:      {OrderStatusRefunded},
+	OrderStatusFailed:         {OrderStatusRefunded},
+}
+
+// defaultOrderStatusTransitions gives the built-in workflow of a service category.
+func defaultOrderStatusTransitions(category StoreCategory) orderStatusTransitions {
+	switch category {
+	case StoreCategoryFoodDelivery:
+		return foodOrderStatusTransitions
+	case StoreCategoryGroceryDelivery, StoreCategoryWineDelivery:
+		return groceryOrderStatusTransitions
+	default:
+		return retailOrderStatusTransitions
+	}
+}
+
+// defaultOrderStatusUtility gives the side effects of entering a status when the admin hasn't configured any.
+func defaultOrderStatusUtility(category StoreCategory, status OrderStatus) *OrderStatusUtility {
+	utility := &OrderStatusUtility{
+		StatusTitle:     strings.Title(strings.ToLower(strings.Replace(string(status), "_", " ", -1))),
+		Status:          status,
+		ServiceCategory: category,
+		NextStatuses:    defaultOrderStatusTransitions(category)[status],
+		NotifyCustomer:  status != OrderStatusPendingPayment,
+		IsActive:        true,
+	}
+	switch status {
+	case OrderStatusPlaced:
+		utility.NotifyStore = true
+	case OrderStatusCancelled, OrderStatusDeclined:
+		utility.NotifyStore = true
+		utility.ReleaseStock = true
+		utility.RefundPayment = true
+	case OrderStatusFailed:
+		utility.ReleaseStock = true
+	case OrderStatusRefunded:
+		utility.ReleaseStock = true
+		utility.RefundPayment = true
+	}
+	return utility
+}
+
+// GetOrderStatusWorkflow gives the order status utility describing a status of a service category,
+// falling back to the built-in workflow when no active utility is configured.
+func GetOrderStatusWorkflow(category StoreCategory, status OrderStatus) *OrderStatusUtility {
+	utility, err := GetOrderStatusUtilityByFilter(bson.D{{"serviceCategory", category}, {"status", status}, {"isActive", true}})
+	if err != nil {
+		log.Errorln(err)
+	}
+	if utility == nil {
+		return defaultOrderStatusUtility(category, status)
+	}
+	return utility
+}
+
+// OrderServiceCategory gives the service category whose workflow applies to the order.
+func OrderServiceCategory(order *Order) StoreCategory {
+	if !order.StoreID.IsZero() {
+		store := GetStoreByID(order.StoreID.Hex())
+		if store != nil && store.ServiceCategory.IsValid() {
+			return store.ServiceCategory
+		}
+	}
+	return StoreCategory(order.ServiceType)
+}
+
+// currentOrderStatus gives the status of the order, orders created before the workflow existed are pending payment.
+func currentOrderStatus(order *Order) OrderStatus {
+	if order.OrderStatus == "" {
+		return OrderStatusPendingPayment
+	}
+	return order.OrderStatus
+}
+
+// CanTransitionOrderStatus tells whether the order can move to status from its current status.
+func CanTransitionOrderStatus(order *Order, status OrderStatus) bool {
+	workflow := GetOrderStatusWorkflow(OrderServiceCategory(order), currentOrderStatus(order))
+	for _, next := range workflow.NextStatuses {
+		if next == status {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionOrderStatus moves the order to status, records an order note and applies the side effects configured for the status.
+// Moving a parent order moves each of its child orders that can make the transition, moving a child order rolls its status up to the parent.
+func TransitionOrderStatus(order *Order, status OrderStatus, author string, note string) (*Order, error) {
+	if len(order.ChildOrders) > 0 {
+		return transitionParentOrderStatus(order, status, author, note)
+	}
+	return transitionOrderStatus(order, status, author, note, true)
+}
+
+// transitionOrderStatus moves a single order, rollUp tells whether its parent order should follow right away.
+func transitionOrderStatus(order *Order, status OrderStatus, author string, note string, rollUp bool) (*Order, error) {
+	if !status.IsValid() || !CanTransitionOrderStatus(order, status) {
+		return nil, ErrInvalidOrderStatusTransition
+	}
+	previousStatus := currentOrderStatus(order)
+	workflow := GetOrderStatusWorkflow(OrderServiceCategory(order), status)
+	now := time.Now()
+	order.OrderStatus = status
+
+	//fill in the order timestamps
+	isCashOrder := order.PaymentMethod.Type == PaymentMethodTypeCash
+	justPaid := false
+	if order.DatePaid.IsZero() {
+		if (!isCashOrder && previousStatus == OrderStatusPendingPayment && status == OrderStatusPlaced) ||
+			(isCashOrder && (status == OrderStatusDelivered || status == OrderStatusCompleted)) {
+			order.DatePaid = now
+			justPaid = true
+		}
+	}
+	justCompleted := false
+	if order.DateCompleted.IsZero() && (status == OrderStatusDelivered || status == OrderStatusCompleted) {
+		order.DateCompleted = now
+		justCompleted = true
+	}
+
+	//reserve stock once the order is placed and hand it back when the order is called off
+	var stockChanges []orderStockChange
+	if status == OrderStatusPlaced && !order.StockReduced {
+		stockChanges = orderStockChanges(order, -1)
+		order.StockReduced = true
+	}
+	if workflow.ReleaseStock && order.StockReduced {
+		stockChanges = orderStockChanges(order, 1)
+		order.StockReduced = false
+	}
+	releaseSlot := workflow.ReleaseStock && order.DeliverySlot != nil && !order.DeliverySlot.Released
+
+	//only the transition that moves the order out of its previous status applies its side effects
+	order, err := updateOrderFromStatus(order, previousStatus)
+	if err != nil {
+		return nil, err
+	}
+	applyOrderStockChanges(stockChanges)
+	if releaseSlot {
+		err = ReleaseDeliverySlot(order.StoreID, order.DeliverySlot)
+		if err != nil {
+			log.Errorln(err)
+		}
+	}
+
+	orderNote := fmt.Sprintf("Order status changed from %s to %s.", previousStatus, status)
+	if note != "" {
+		orderNote = orderNote + " " + note
+	}
+	_, err = CreateOrderNote(OrderNote{OrderID: order.ID, Author: author, Note: orderNote, CustomerNote: workflow.NotifyCustomer, IsActive: true})
+	if err != nil {
+		log.Errorln(err)
+	}
+
+	webhookEvent := workflow.WebhookEvent
+	if webhookEvent == "" {
+		webhookEvent = "order." + strings.ToLower(string(status))
+	}
+	go webhooks.NewWebhookEvent(webhookEvent, order)
+	go notifyOrderStatus(order, workflow)
+
+	//hand out the files of downloadable items once paid and take them back when the order is called off
+	if justPaid {
+		paid := *order
+		go func() {
+			if err := GrantOrderDownloads(&paid); err != nil {
+				log.Errorln(err)
+			}
+		}()
+	}
+	//the store is paid out the share of the payment the gateway held for it
+	if justCompleted && len(order.PaymentTransfers) > 0 {
+		releasePaymentTransfers(OrdersCollection, order.ID, order.PaymentTransfers)
+	}
+	//the provider who handed over a cash order owes the market what they collected for the store
+	if justPaid && isCashOrder {
+		_, err = recordCashOrderLiability(order)
+		if err != nil {
+			log.Errorln(err)
+		}
+	}
+	if workflow.ReleaseStock || workflow.RefundPayment {
+		err = RevokeOrderDownloads(order.ID)
+		if err != nil {
+			log.Errorln(err)
+		}
+	}
+
+	//pay back whatever is left of a paid order
+	if workflow.RefundPayment && !order.DatePaid.IsZero() && order.Refunds.Total < order.OrderTotalAmount {
+		reason := note
+		_, err = RequestOrderRefund(order, RefundOrderInput{OrderID: order.ID, Reason: &reason}, primitive.NilObjectID, author)
+		if err != nil && err != ErrInvalidRefundAmount {
+			log.Errorln(err)
+		}
+		if refreshed, err := GetOrderByID(order.ID.Hex()); err == nil && refreshed != nil {
+			order = refreshed
+		}
+	}
+
+	if rollUp && !order.ParentID.IsZero() {
+		err = rollUpParentOrderStatus(order.ParentID, author)
+		if err != nil {
+			log.Errorln(err)
+		}
+	}
+	return order, nil
+}
+
+// orderStatusProgress ranks the statuses of an order moving towards completion.
+var orderStatusProgress = map[OrderStatus]int{
+	OrderStatusPendingPayment: 0,
+	OrderStatusPlaced:         1,
+	OrderStatusAccepted:       2,
+	OrderStatusProcessing:     3,
+	OrderStatusReady:          4,
+	OrderStatusDispatched:     5,
+	OrderStatusDelivered:      6,
+	OrderStatusCompleted:      7,
+}
+
+// transitionParentOrderStatus moves every child order that can make the transition, the parent follows its children.
+func transitionParentOrderStatus(order *Order, status OrderStatus, author string, note string) (*Order, error) {
+	if !status.IsValid() {
+		return nil, ErrInvalidOrderStatusTransition
+	}
+	moved := false
+	for _, child := range GetChildOrders(order) {
+		if !CanTransitionOrderStatus(child, status) {
+			continue
+		}
+		_, err := transitionOrderStatus(child, status, author, note, false)
+		if err != nil {
+			return nil, err
+		}
+		moved = true
+	}
+	if !moved {
+		return nil, ErrInvalidOrderStatusTransition
+	}
+	err := rollUpParentOrderStatus(order.ID, author)
+	if err != nil {
+		return nil, err
+	}
+	return GetOrderByID(order.ID.Hex())
+}
+
+// parentOrderStatus gives the status of a parent order from the statuses of its children,
+// the least advanced of the children still going or, when all of them were called off, their common status.
+func parentOrderStatus(children []*Order) OrderStatus {
+	var status OrderStatus
+	for _, child := range children {
+		childStatus := currentOrderStatus(child)
+		progress, ok := orderStatusProgress[childStatus]
+		if !ok {
+			continue
+		}
+		if current, ok := orderStatusProgress[status]; status == "" || (ok && progress < current) {
+			status = childStatus
+		}
+	}
+	if status != "" {
+		return status
+	}
+	for _, child := range children {
+		childStatus := currentOrderStatus(child)
+		if status != "" && childStatus != status {
+			return OrderStatusCancelled
+		}
+		status = childStatus
+	}
+	return status
+}
+
+// rollUpParentOrderStatus brings the status and dates of a parent order in line with its child orders.
+// A roll up losing the race to a concurrent one starts over from the children as they are now.
+func rollUpParentOrderStatus(parentID primitive.ObjectID, author string) error {
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		err = rollUpParentOrderStatusOnce(parentID, author)
+		if err != ErrOrderStatusChanged {
+			return err
+		}
+	}
+	return err
+}
+
+// rollUpParentOrderStatusOnce rolls the children of a parent order up into it once.
+func rollUpParentOrderStatusOnce(parentID primitive.ObjectID, author string) error {
+	parent, err := GetOrderByID(parentID.Hex())
+	if err != nil || parent == nil {
+		return err
+	}
+	children := GetChildOrders(parent)
+	if len(children) == 0 {
+		return nil
+	}
+	previousStatus := currentOrderStatus(parent)
+	status := parentOrderStatus(children)
+
+	var refunded, refundedTax float64
+	paid, completed := true, true
+	for _, child := range children {
+		refunded += child.Refunds.Total
+		refundedTax += child.Refunds.TotalTax
+		if child.DatePaid.IsZero() {
+			paid = false
+		} else if parent.DatePaid.IsZero() || child.DatePaid.After(parent.DatePaid) {
+			parent.DatePaid = child.DatePaid
+		}
+		if child.DateCompleted.IsZero() {
+			completed = false
+		} else if child.DateCompleted.After(parent.DateCompleted) {
+			parent.DateCompleted = child.DateCompleted
+		}
+	}
+	if !paid {
+		parent.DatePaid = time.Time{}
+	}
+	if !completed {
+		parent.DateCompleted = time.Time{}
+	}
+	parent.Refunds.Total = roundAmount(refunded)
+	parent.Refunds.TotalTax = roundAmount(refundedTax)
+	parent.OrderStatus = status
+	parent, err = updateOrderFromStatus(parent, previousStatus)
+	if err != nil {
+		return err
+	}
+	if previousStatus == status {
+		return nil
+	}
+
+	_, err = CreateOrderNote(OrderNote{OrderID: parent.ID, Author: author, Note: fmt.Sprintf("Order status changed from %s to %s.", previousStatus, status), CustomerNote: false, IsActive: true})
+	if err != nil {
+		log.Errorln(err)
+	}
+	go webhooks.NewWebhookEvent("order."+strings.ToLower(string(status)), parent)
+	return nil
+}
+
+// orderStockChange is a change of the stock of an ordered product or variation.
+type orderStockChange struct {
+	productID   primitive.ObjectID
+	variationID *primitive.ObjectID
+	quantity    int
+}
+
+// orderStockChanges gives the stock changes of every order item by its quantity in the given direction,
+// and marks the items restocked on the order. Items already restocked by a refund aren't restocked again.
+func orderStockChanges(order *Order, direction int) []orderStockChange {
+	var changes []orderStockChange
+	for i, item := range order.OrderItems {
+		quantity := item.Quantity
+		if direction > 0 {
+			quantity -= item.RestockedQuantity
+			order.OrderItems[i].RestockedQuantity = item.Quantity
+		} else {
+			order.OrderItems[i].RestockedQuantity = 0
+		}
+		if quantity <= 0 {
+			continue
+		}
+		changes = append(changes, orderStockChange{productID: item.ID, variationID: item.VariationID, quantity: direction * quantity})
+	}
+	return changes
+}
+
+// applyOrderStockChanges changes the stock of the products, once the order recording them is saved.
+func applyOrderStockChanges(changes []orderStockChange) {
+	for _, change := range changes {
+		err := AdjustProductStock(change.productID, change.variationID, change.quantity)
+		if err != nil {
+			log.Errorln(err)
+		}
+	}
+}
+
+// updateOrderFromStatus saves an order only while it still has the status it was read with,
+// so of two concurrent transitions of an order only one is saved. ErrOrderStatusChanged when the other one won.
+func updateOrderFromStatus(order *Order, previousStatus OrderStatus) (*Order, error) {
+	order.UpdatedAt = time.Now()
+	filter := bson.D{{"_id", order.ID}, {"orderStatus", previousStatus}}
+	if previousStatus == OrderStatusPendingPayment {
+		//orders created before the workflow existed have no status
+		filter = bson.D{{"_id", order.ID}, {"orderStatus", bson.M{"$in": bson.A{previousStatus, "", nil}}}}
+	}
+	findRepOpts := options.FindOneAndReplace().SetReturnDocument(options.After)
+	updated := &Order{}
+	err := database.MongoDB.Collection(OrdersCollection).FindOneAndReplace(context.Background(), filter, order, findRepOpts).Decode(updated)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrOrderStatusChanged
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	go webhooks.NewWebhookEvent("order.updated", updated)
+	//Update cache item
+	err = cache.RedisClient.Del(updated.ID.Hex()).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	return updated, nil
+}
+
+// notifyOrderStatus emails the customer and the store about the new order status.
+func notifyOrderStatus(order *Order, workflow *OrderStatusUtility) {
+	templateID := "order.status." + strings.ToLower(string(order.OrderStatus))
+	if workflow.NotifyCustomer {
+		customer := GetUserByID(order.CustomerID.Hex())
+		if customer != nil && customer.Email != "" {
+			err := SendEmail("no-reply@tribe.cab", customer.Email, templateID, customer.Language, order, nil)
+			if err != nil {
+				log.Errorln(err)
+			}
+		}
+	}
+	if workflow.NotifyStore && !order.StoreID.IsZero() {
+		store := GetStoreByID(order.StoreID.Hex())
+		if store != nil && store.Email != "" {
+			err := SendEmail("no-reply@tribe.cab", store.Email, "store."+templateID, store.Language, order, nil)
+			if err != nil {
+				log.Errorln(err)
+			}
+		}
+	}
+}
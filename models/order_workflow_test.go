@@ -0,0 +1,103 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+)
+
+func TestDefaultOrderStatusTransitions(t *testing.T) {
+	canMove := func(category StoreCategory, from OrderStatus, to OrderStatus) bool {
+		for _, next := range defaultOrderStatusTransitions(category)[from] {
+			if next == to {
+				return true
+			}
+		}
+		return false
+	}
+
+	t.Run("food orders can't be cancelled once preparing", func(t *testing.T) {
+		require.True(t, canMove(StoreCategoryFoodDelivery, OrderStatusAccepted, OrderStatusCancelled))
+		require.False(t, canMove(StoreCategoryFoodDelivery, OrderStatusProcessing, OrderStatusCancelled))
+	})
+	t.Run("grocery orders can be cancelled until dispatched", func(t *testing.T) {
+		require.True(t, canMove(StoreCategoryGroceryDelivery, OrderStatusReady, OrderStatusCancelled))
+		require.False(t, canMove(StoreCategoryGroceryDelivery, OrderStatusDispatched, OrderStatusCancelled))
+	})
+	t.Run("retail orders skip acceptance", func(t *testing.T) {
+		require.True(t, canMove(StoreCategory(""), OrderStatusPlaced, OrderStatusProcessing))
+		require.False(t, canMove(StoreCategory(""), OrderStatusPlaced, OrderStatusAccepted))
+	})
+	t.Run("completed orders can only be refunded", func(t *testing.T) {
+		require.Equal(t, []OrderStatus{OrderStatusRefunded}, defaultOrderStatusTransitions(StoreCategoryFoodDelivery)[OrderStatusCompleted])
+	})
+}
+
+func TestDefaultOrderStatusUtility(t *testing.T) {
+	cancelled := defaultOrderStatusUtility(StoreCategoryFoodDelivery, OrderStatusCancelled)
+	require.True(t, cancelled.ReleaseStock)
+	require.True(t, cancelled.RefundPayment)
+	require.True(t, cancelled.NotifyStore)
+
+	failed := defaultOrderStatusUtility(StoreCategoryFoodDelivery, OrderStatusFailed)
+	require.True(t, failed.ReleaseStock)
+	require.False(t, failed.RefundPayment)
+
+	pending := defaultOrderStatusUtility(StoreCategoryFoodDelivery, OrderStatusPendingPayment)
+	require.False(t, pending.NotifyCustomer)
+}
+
+func TestParentOrderStatus(t *testing.T) {
+	child := func(status OrderStatus) *Order {
+		return &Order{OrderStatus: status}
+	}
+
+	t.Run("follows the least advanced child still going", func(t *testing.T) {
+		status := parentOrderStatus([]*Order{child(OrderStatusDelivered), child(OrderStatusProcessing), child(OrderStatusCancelled)})
+		require.Equal(t, OrderStatusProcessing, status)
+	})
+	t.Run("children without a status are pending payment", func(t *testing.T) {
+		status := parentOrderStatus([]*Order{child(""), child(OrderStatusPlaced)})
+		require.Equal(t, OrderStatusPendingPayment, status)
+	})
+	t.Run("takes the common status of children all called off", func(t *testing.T) {
+		status := parentOrderStatus([]*Order{child(OrderStatusDeclined), child(OrderStatusDeclined)})
+		require.Equal(t, OrderStatusDeclined, status)
+	})
+	t.Run("is cancelled when children were called off differently", func(t *testing.T) {
+		status := parentOrderStatus([]*Order{child(OrderStatusDeclined), child(OrderStatusFailed)})
+		require.Equal(t, OrderStatusCancelled, status)
+	})
+}
+
+func TestOrderStockChanges(t *testing.T) {
+	productID := primitive.NewObjectID()
+	variationID := primitive.NewObjectID()
+	order := &Order{OrderItems: []OrderItem{
+		{ID: productID, Quantity: 3},
+		{ID: productID, VariationID: &variationID, Quantity: 2},
+	}}
+
+	reserved := orderStockChanges(order, -1)
+	require.Equal(t, []orderStockChange{
+		{productID: productID, quantity: -3},
+		{productID: productID, variationID: &variationID, quantity: -2},
+	}, reserved)
+
+	//a refund restocked one of the first item already
+	order.OrderItems[0].RestockedQuantity = 1
+	released := orderStockChanges(order, 1)
+	require.Equal(t, []orderStockChange{
+		{productID: productID, quantity: 2},
+		{productID: productID, variationID: &variationID, quantity: 2},
+	}, released)
+	require.Equal(t, 3, order.OrderItems[0].RestockedQuantity)
+	require.Equal(t, 2, order.OrderItems[1].RestockedQuantity)
+
+	//everything is back in stock, releasing again changes nothing
+	require.Empty(t, orderStockChanges(order, 1))
+}
@@ -0,0 +1,53 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ErrPaymentDeclined is returned when the gateway declines a payment. A charge that failed any other way may still have been taken.
+var ErrPaymentDeclined = errors.New("payment declined")
+
+// GatewayCharge describes a charge of a customer's saved payment method through a payment gateway.
+type GatewayCharge struct {
+	ChargeID        string  // our id for the charge, gateways use it as the idempotency key
+	CustomerID      string  // the gateway's customer
+	PaymentMethodID string  // the gateway's saved payment method of the customer
+	OrderID         string  // the order the charge pays for, when it pays for one
+	JobID           string  // the job the charge pays for, when it pays for one
+	Amount          float64 // in the major unit of the currency
+	Currency        string
+	Description     string
+}
+
+// PaymentCharger charges saved payment methods through a payment gateway without the customer being present.
+type PaymentCharger interface {
+	// ChargePayment takes the payment and gives the gateway's id for it.
+	ChargePayment(charge GatewayCharge) (string, error)
+}
+
+var (
+	paymentChargersMu sync.RWMutex
+	paymentChargers   = map[string]PaymentCharger{}
+)
+
+// RegisterPaymentCharger makes a payment gateway available for charges under the given name.
+// Payment gateways are registered with payments.RegisterGateway, which makes them available for charges too.
+func RegisterPaymentCharger(gateway string, charger PaymentCharger) {
+	paymentChargersMu.Lock()
+	defer paymentChargersMu.Unlock()
+	paymentChargers[strings.ToLower(gateway)] = charger
+}
+
+// GetPaymentCharger gives the charger registered for a payment gateway.
+func GetPaymentCharger(gateway string) (PaymentCharger, bool) {
+	paymentChargersMu.RLock()
+	defer paymentChargersMu.RUnlock()
+	charger, ok := paymentChargers[strings.ToLower(gateway)]
+	return charger, ok
+}
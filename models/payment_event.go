@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sync"
+	"time"
+)
+
+// Statuses of a payment gateway webhook event.
+const (
+	PaymentEventStatusProcessing = "processing"
+	PaymentEventStatusProcessed  = "processed"
+)
+
+// paymentEventClaimTimeout is how long an event stays claimed by a handler that never finished it.
+const paymentEventClaimTimeout = 10 * time.Minute
+
+// PaymentEvent records a payment gateway webhook event so it is handled only once however often the gateway delivers it.
+type PaymentEvent struct {
+	ID          primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time          `json:"updatedAt" bson:"updatedAt"`
+	Gateway     string             `json:"gateway" bson:"gateway"`
+	EventID     string             `json:"eventID" bson:"eventID"`
+	Type        string             `json:"type" bson:"type"`
+	Status      string             `json:"status" bson:"status"`
+	ClaimedAt   time.Time          `json:"claimedAt" bson:"claimedAt"`
+	ProcessedAt *time.Time         `json:"processedAt" bson:"processedAt"`
+}
+
+var (
+	paymentEventIndexesMu    sync.Mutex
+	paymentEventIndexesReady bool
+)
+
+// ensurePaymentEventIndexes makes sure an event of a gateway is recorded only once.
+func ensurePaymentEventIndexes() {
+	paymentEventIndexesMu.Lock()
+	defer paymentEventIndexesMu.Unlock()
+	if paymentEventIndexesReady {
+		return
+	}
+	_, err := database.MongoDB.Collection(PaymentEventsCollection).Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"gateway", 1}, {"eventID", 1}}, Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	paymentEventIndexesReady = true
+}
+
+// ClaimPaymentEvent claims a webhook event for handling, nil when it has been handled already or another handler is on it.
+// An event claimed by a handler that didn't finish it within the claim timeout can be claimed again.
+func ClaimPaymentEvent(gateway string, eventID string, eventType string) (*PaymentEvent, error) {
+	ensurePaymentEventIndexes()
+	now := time.Now()
+	event := &PaymentEvent{
+		ID:        primitive.NewObjectID(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Gateway:   gateway,
+		EventID:   eventID,
+		Type:      eventType,
+		Status:    PaymentEventStatusProcessing,
+		ClaimedAt: now,
+	}
+	collection := database.MongoDB.Collection(PaymentEventsCollection)
+	ctx := context.Background()
+	_, err := collection.InsertOne(ctx, event)
+	if err == nil {
+		return event, nil
+	}
+	if !isDuplicateKeyError(err) {
+		log.Errorln(err)
+		return nil, err
+	}
+	filter := bson.D{
+		{"gateway", gateway},
+		{"eventID", eventID},
+		{"status", PaymentEventStatusProcessing},
+		{"claimedAt", bson.M{"$lt": now.Add(-paymentEventClaimTimeout)}},
+	}
+	update := bson.D{{"$set", bson.D{{"claimedAt", now}, {"updatedAt", now}}}}
+	claimed := &PaymentEvent{}
+	err = collection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(claimed)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// FinishPaymentEvent marks a claimed event processed, or gives it up when handling failed so the gateway's retry handles it again.
+func FinishPaymentEvent(event *PaymentEvent, handleErr error) error {
+	collection := database.MongoDB.Collection(PaymentEventsCollection)
+	ctx := context.Background()
+	if handleErr != nil {
+		_, err := collection.DeleteOne(ctx, bson.D{{"_id", event.ID}, {"status", PaymentEventStatusProcessing}})
+		if err != nil {
+			log.Errorln(err)
+		}
+		return err
+	}
+	now := time.Now()
+	update := bson.D{{"$set", bson.D{{"status", PaymentEventStatusProcessed}, {"processedAt", now}, {"updatedAt", now}}}}
+	_, err := collection.UpdateOne(ctx, bson.D{{"_id", event.ID}}, update)
+	if err != nil {
+		log.Errorln(err)
+		return err
+	}
+	event.Status = PaymentEventStatusProcessed
+	event.ProcessedAt = &now
+	return nil
+}
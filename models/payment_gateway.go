@@ -0,0 +1,39 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"strings"
+)
+
+// StorePaymentGatewayKey is the metadata key a store keeps the payment gateway it takes payments through under.
+const StorePaymentGatewayKey = "payment_gateway"
+
+// PaymentGatewayNameFor gives the payment gateway payments to a store go through, the store's own, else the market's.
+// It is empty when neither has one, and the default gateway is used.
+func PaymentGatewayNameFor(storeID string) string {
+	var store *Store
+	if storeID != "" {
+		store = GetStoreByID(storeID)
+	}
+	settings, err := GetCurrentMarketSettings()
+	if err != nil {
+		return paymentGatewayName(store, nil)
+	}
+	return paymentGatewayName(store, settings)
+}
+
+// paymentGatewayName picks the payment gateway of the store, falling back to the market wide one.
+func paymentGatewayName(store *Store, settings *MarketSettings) string {
+	if store != nil {
+		if name := linkedAccountID(store.Metadata, StorePaymentGatewayKey); name != "" {
+			return strings.ToLower(name)
+		}
+	}
+	if settings != nil {
+		return strings.ToLower(settings.Payment.PaymentGateway)
+	}
+	return ""
+}
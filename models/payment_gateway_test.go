@@ -0,0 +1,23 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestPaymentGatewayName(t *testing.T) {
+	settings := &MarketSettings{Payment: PaymentSetting{PaymentGateway: "Razorpay"}}
+	store := &Store{Metadata: map[string]interface{}{StorePaymentGatewayKey: "Stripe"}}
+
+	require.Equal(t, "stripe", paymentGatewayName(store, settings))
+	require.Equal(t, "razorpay", paymentGatewayName(&Store{}, settings))
+	require.Equal(t, "razorpay", paymentGatewayName(&Store{Metadata: map[string]interface{}{StorePaymentGatewayKey: ""}}, settings))
+	require.Equal(t, "razorpay", paymentGatewayName(nil, settings))
+	require.Equal(t, "stripe", paymentGatewayName(store, nil))
+	require.Equal(t, "", paymentGatewayName(nil, &MarketSettings{}))
+	require.Equal(t, "", paymentGatewayName(nil, nil))
+}
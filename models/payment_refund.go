@@ -0,0 +1,47 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"strings"
+	"sync"
+)
+
+// GatewayRefund describes a refund to issue through the payment gateway that took the payment.
+type GatewayRefund struct {
+	RefundID  string  // our refund id, gateways use it as the idempotency key
+	OrderID   string  // the order the payment was taken for
+	PaymentID string  // the gateway's payment, charge or transaction id
+	Amount    float64 // in the major unit of the currency
+	Currency  string
+	Reason    string
+}
+
+// PaymentRefunder refunds payments taken through a payment gateway.
+type PaymentRefunder interface {
+	// RefundPayment issues the refund and gives the gateway's id for it.
+	RefundPayment(refund GatewayRefund) (string, error)
+}
+
+var (
+	paymentRefundersMu sync.RWMutex
+	paymentRefunders   = map[string]PaymentRefunder{}
+)
+
+// RegisterPaymentRefunder makes a payment gateway available for refunds under the given name.
+// Payment gateways are registered with payments.RegisterGateway, which makes them available for refunds too.
+func RegisterPaymentRefunder(gateway string, refunder PaymentRefunder) {
+	paymentRefundersMu.Lock()
+	defer paymentRefundersMu.Unlock()
+	paymentRefunders[strings.ToLower(gateway)] = refunder
+}
+
+// GetPaymentRefunder gives the refunder registered for a payment gateway.
+func GetPaymentRefunder(gateway string) (PaymentRefunder, bool) {
+	paymentRefundersMu.RLock()
+	defer paymentRefundersMu.RUnlock()
+	refunder, ok := paymentRefunders[strings.ToLower(gateway)]
+	return refunder, ok
+}
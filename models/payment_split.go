@@ -0,0 +1,469 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/cache"
+	"github.com/tribehq/platform/lib/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RazorpayRouteAccountKey is the metadata key the razorpay route linked account of a store or provider is kept under.
+const RazorpayRouteAccountKey = "razorpay_route_account_id"
+
+// PaymentSplit is the share of a payment due to a store or provider that has a linked account at the payment gateway.
+type PaymentSplit struct {
+	PayeeType string // SettlementPayeeStore or SettlementPayeeProvider
+	PayeeID   primitive.ObjectID
+	OrderID   primitive.ObjectID // the store's order, for splits of order payments
+	JobID     primitive.ObjectID // for splits of job payments
+	AccountID string             // the payee's linked account at the gateway
+	Amount    float64            // in the major unit of the currency
+	Currency  string
+	OnHold    bool // held by the gateway until the order or job is completed
+}
+
+// Statuses of a payment transfer.
+const (
+	PaymentTransferStatusPending     = "pending" // about to be made, the gateway may or may not have made it
+	PaymentTransferStatusTransferred = "transferred"
+)
+
+// PaymentTransfer is the share of a payment the payment gateway transferred straight to a store's or provider's linked account,
+// or a payment the customer made straight into it. Settlements take it off what the store or provider is owed. Transfers are recorded as pending before they are asked of the
+// gateway, so a transfer the gateway made but we didn't get to record can be found by its key instead of being made again.
+type PaymentTransfer struct {
+	ID             string                    `json:"id" bson:"id"` // the gateway's transfer id
+	Key            string                    `json:"key" bson:"key,omitempty"`
+	Status         string                    `json:"status" bson:"status,omitempty"`
+	Gateway        string                    `json:"gateway" bson:"gateway"`
+	PaymentID      string                    `json:"paymentID" bson:"paymentID"`
+	AccountID      string                    `json:"accountID" bson:"accountID"`
+	PayeeType      string                    `json:"payeeType" bson:"payeeType"`
+	PayeeID        primitive.ObjectID        `json:"payeeID" bson:"payeeID"`
+	Amount         float64                   `json:"amount" bson:"amount"`
+	Currency       string                    `json:"currency" bson:"currency"`
+	OnHold         bool                      `json:"onHold" bson:"onHold,omitempty"`
+	Direct         bool                      `json:"direct" bson:"direct,omitempty"` // paid by the customer straight into the payee's own account
+	ReleasedAt     *time.Time                `json:"releasedAt" bson:"releasedAt,omitempty"`
+	ReversedAmount float64                   `json:"reversedAmount" bson:"reversedAmount,omitempty"`
+	Reversals      []PaymentTransferReversal `json:"reversals" bson:"reversals,omitempty"`
+	TransferredAt  time.Time                 `json:"transferredAt" bson:"transferredAt"`
+}
+
+// PaymentTransferReversal is part of a transfer taken back from the linked account for a refund.
+type PaymentTransferReversal struct {
+	ID         string    `json:"id" bson:"id"` // the gateway's reversal id
+	RefundID   string    `json:"refundID" bson:"refundID"`
+	Amount     float64   `json:"amount" bson:"amount"`
+	ReversedAt time.Time `json:"reversedAt" bson:"reversedAt"`
+}
+
+// PaymentTransferrer moves the transfers a payment gateway made to linked accounts.
+type PaymentTransferrer interface {
+	// ReleaseTransfer lets a held transfer be paid out to the linked account.
+	ReleaseTransfer(transfer PaymentTransfer) error
+	// ReverseTransfer takes part of a transfer back from the linked account for a refund and gives the gateway's id for the reversal.
+	ReverseTransfer(transfer PaymentTransfer, amount float64, refundID string) (string, error)
+}
+
+var (
+	paymentTransferrersMu sync.RWMutex
+	paymentTransferrers   = map[string]PaymentTransferrer{}
+)
+
+// RegisterPaymentTransferrer makes a payment gateway available for releasing and reversing its transfers under the given name.
+// Payment gateways are registered with payments.RegisterGateway, which registers the ones that split payments here too.
+func RegisterPaymentTransferrer(gateway string, transferrer PaymentTransferrer) {
+	paymentTransferrersMu.Lock()
+	defer paymentTransferrersMu.Unlock()
+	paymentTransferrers[strings.ToLower(gateway)] = transferrer
+}
+
+// GetPaymentTransferrer gives the transferrer registered for a payment gateway.
+func GetPaymentTransferrer(gateway string) (PaymentTransferrer, bool) {
+	paymentTransferrersMu.RLock()
+	defer paymentTransferrersMu.RUnlock()
+	transferrer, ok := paymentTransferrers[strings.ToLower(gateway)]
+	return transferrer, ok
+}
+
+// PaymentTransferKey identifies the transfer of a split of a payment, the same however often the payment is split.
+func PaymentTransferKey(paymentID string, split PaymentSplit) string {
+	return paymentID + ":" + split.PayeeType + ":" + split.PayeeID.Hex()
+}
+
+// linkedAccountID gives the linked account kept in metadata under the key, empty when there is none.
+func linkedAccountID(metadata map[string]interface{}, key string) string {
+	if metadata == nil {
+		return ""
+	}
+	account, ok := metadata[key]
+	if !ok || account == nil {
+		return ""
+	}
+	return fmt.Sprint(account)
+}
+
+// transferredAmount adds up the transfers made to a kind of payee, leaving out the ones that may not have been made.
+// Reversals are left in, the refunds they were made for are settled net of them.
+func transferredAmount(transfers []PaymentTransfer, payeeType string) float64 {
+	total := 0.0
+	for _, transfer := range transfers {
+		if transfer.PayeeType == payeeType && transfer.Status != PaymentTransferStatusPending {
+			total += transfer.Amount
+		}
+	}
+	return total
+}
+
+// reversedAmount adds up what was taken back out of the transfers made to a kind of payee.
+func reversedAmount(transfers []PaymentTransfer, payeeType string) float64 {
+	total := 0.0
+	for _, transfer := range transfers {
+		if transfer.PayeeType == payeeType {
+			total += transfer.ReversedAmount
+		}
+	}
+	return roundAmount(total)
+}
+
+// paymentTransfersMade tells whether a payment was split already: it has transfers and none of them is pending.
+// A payment with pending transfers is split again, which finds the transfers the gateway made by their keys.
+func paymentTransfersMade(transfers []PaymentTransfer) bool {
+	for _, transfer := range transfers {
+		if transfer.Status == PaymentTransferStatusPending {
+			return false
+		}
+	}
+	return len(transfers) > 0
+}
+
+// OrderPaymentSplits gives the shares of an order's payment due to its stores, for the stores with a linked account
+// kept under the account key. A store's share is what it sold for less the commission and delivery, the same it would
+// be settled, and the rest of the payment stays with the platform. Cash orders aren't split.
+func OrderPaymentSplits(order *Order, accountKey string) []PaymentSplit {
+	if order.PaymentMethod.Type == PaymentMethodTypeCash {
+		return nil
+	}
+	orders := []*Order{order}
+	if len(order.ChildOrders) > 0 {
+		orders = GetChildOrders(order)
+	}
+	var splits []PaymentSplit
+	for _, storeOrder := range orders {
+		if storeOrder.StoreID.IsZero() || paymentTransfersMade(storeOrder.PaymentTransfers) {
+			continue
+		}
+		amount := roundAmount(storeOrder.OrderTotalAmount - storeOrder.Commission - storeOrder.ShippingTotal)
+		if amount <= 0 {
+			continue
+		}
+		store := GetStoreByID(storeOrder.StoreID.Hex())
+		if store == nil {
+			continue
+		}
+		account := linkedAccountID(store.Metadata, accountKey)
+		if account == "" {
+			continue
+		}
+		splits = append(splits, PaymentSplit{
+			PayeeType: SettlementPayeeStore,
+			PayeeID:   store.ID,
+			OrderID:   storeOrder.ID,
+			AccountID: account,
+			Amount:    amount,
+			Currency:  storeOrder.Currency.CurrencyCode,
+			OnHold:    storeOrder.DateCompleted.IsZero(),
+		})
+	}
+	return splits
+}
+
+// JobPaymentSplits gives the share of a job's payment due to its provider when the provider has a linked account kept
+// under the account key: the amount paid less the commission the market takes on the job's service type.
+func JobPaymentSplits(job *Job, amount float64, currency string, accountKey string) []PaymentSplit {
+	if job.ProviderID == "" || paymentTransfersMade(job.PaymentTransfers) {
+		return nil
+	}
+	provider := GetServiceProviderByID(job.ProviderID)
+	if provider == nil {
+		return nil
+	}
+	account := linkedAccountID(provider.Metadata, accountKey)
+	if account == "" {
+		return nil
+	}
+	share := roundAmount(amount - roundAmount(amount*jobCommissionRate(job, providerCommissionEnabled())/100))
+	if share <= 0 {
+		return nil
+	}
+	return []PaymentSplit{{
+		PayeeType: SettlementPayeeProvider,
+		PayeeID:   provider.ID,
+		JobID:     job.ID,
+		AccountID: account,
+		Amount:    share,
+		Currency:  currency,
+		OnHold:    job.CompletedAt == nil,
+	}}
+}
+
+// paymentTransferTarget gives the collection and id of the order or job a split is for.
+func paymentTransferTarget(split PaymentSplit) (string, primitive.ObjectID) {
+	if !split.JobID.IsZero() {
+		return JobsCollection, split.JobID
+	}
+	return OrdersCollection, split.OrderID
+}
+
+// updatePaymentTransfers applies an update to the transfers of an order or job matching the filter and tells whether it matched.
+// The update time moves on with it, so an order saved whole from an earlier read, like a refund does, can't write over the transfers.
+func updatePaymentTransfers(collectionName string, id primitive.ObjectID, filter bson.D, update bson.D) (bool, error) {
+	filter = append(bson.D{{"_id", id}}, filter...)
+	set := bson.D{{"updatedAt", time.Now()}}
+	var withUpdatedAt bson.D
+	for _, operator := range update {
+		if fields, ok := operator.Value.(bson.D); ok && operator.Key == "$set" {
+			set = append(fields, set...)
+			continue
+		}
+		withUpdatedAt = append(withUpdatedAt, operator)
+	}
+	withUpdatedAt = append(withUpdatedAt, bson.E{"$set", set})
+	result, err := database.MongoDB.Collection(collectionName).UpdateOne(context.Background(), filter, withUpdatedAt)
+	if err != nil {
+		log.Errorln(err)
+		return false, err
+	}
+	err = cache.RedisClient.Del(id.Hex()).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	return result.MatchedCount > 0, nil
+}
+
+// RecordPendingPaymentTransfers keeps the transfers of the splits of a payment as pending on their orders or jobs,
+// before they are asked of the gateway. Splits with a transfer kept already are left as they are.
+func RecordPendingPaymentTransfers(gateway string, paymentID string, splits []PaymentSplit) error {
+	now := time.Now()
+	for _, split := range splits {
+		key := PaymentTransferKey(paymentID, split)
+		collectionName, id := paymentTransferTarget(split)
+		transfer := PaymentTransfer{
+			Key:           key,
+			Status:        PaymentTransferStatusPending,
+			Gateway:       gateway,
+			PaymentID:     paymentID,
+			AccountID:     split.AccountID,
+			PayeeType:     split.PayeeType,
+			PayeeID:       split.PayeeID,
+			Amount:        split.Amount,
+			Currency:      split.Currency,
+			OnHold:        split.OnHold,
+			TransferredAt: now,
+		}
+		filter := bson.D{{"paymentTransfers.key", bson.M{"$ne": key}}}
+		_, err := updatePaymentTransfers(collectionName, id, filter, bson.D{{"$push", bson.D{{"paymentTransfers", transfer}}}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RecordPaymentTransfer keeps the transfer the gateway made for a split on the order or job it was made for,
+// in place of its pending transfer.
+func RecordPaymentTransfer(split PaymentSplit, transfer PaymentTransfer) error {
+	transfer.Key = PaymentTransferKey(transfer.PaymentID, split)
+	transfer.Status = PaymentTransferStatusTransferred
+	transfer.PayeeType = split.PayeeType
+	transfer.PayeeID = split.PayeeID
+	if transfer.AccountID == "" {
+		transfer.AccountID = split.AccountID
+	}
+	if transfer.TransferredAt.IsZero() {
+		transfer.TransferredAt = time.Now()
+	}
+	collectionName, id := paymentTransferTarget(split)
+	filter := bson.D{{"paymentTransfers.key", transfer.Key}}
+	matched, err := updatePaymentTransfers(collectionName, id, filter, bson.D{{"$set", bson.D{{"paymentTransfers.$", transfer}}}})
+	if err != nil || matched {
+		return err
+	}
+	filter = bson.D{{"paymentTransfers.key", bson.M{"$ne": transfer.Key}}}
+	_, err = updatePaymentTransfers(collectionName, id, filter, bson.D{{"$push", bson.D{{"paymentTransfers", transfer}}}})
+	return err
+}
+
+// releasePaymentTransfers releases the held transfers of an order or job once it is completed.
+// Transfers that fail to be released stay held and are tried again the next time.
+func releasePaymentTransfers(collectionName string, id primitive.ObjectID, transfers []PaymentTransfer) {
+	for _, transfer := range transfers {
+		if !transfer.OnHold || transfer.Status == PaymentTransferStatusPending || transfer.ID == "" {
+			continue
+		}
+		transferrer, ok := GetPaymentTransferrer(transfer.Gateway)
+		if !ok {
+			log.Errorf("no payment transferrer for %s to release transfer %s", transfer.Gateway, transfer.ID)
+			continue
+		}
+		err := transferrer.ReleaseTransfer(transfer)
+		if err != nil {
+			log.Errorln(err)
+			continue
+		}
+		filter := bson.D{{"paymentTransfers.id", transfer.ID}}
+		update := bson.D{{"$set", bson.D{{"paymentTransfers.$.onHold", false}, {"paymentTransfers.$.releasedAt", time.Now()}}}}
+		_, err = updatePaymentTransfers(collectionName, id, filter, update)
+		if err != nil {
+			log.Errorln(err)
+		}
+	}
+}
+
+// paymentTransferReversals plans the reversals that take an amount back out of the transfers made to a kind of payee,
+// the most that is left of each transfer in turn. Transfers reversed for the refund already are left out, so are pending ones.
+// Payments made straight into the payee's account are only taken back by refunds made through the same gateway,
+// which refunds them out of that account.
+func paymentTransferReversals(transfers []PaymentTransfer, payeeType string, amount float64, refundID string, refundGateway string) map[int]float64 {
+	reversals := map[int]float64{}
+	left := roundAmount(amount)
+	for i, transfer := range transfers {
+		if left <= 0 {
+			break
+		}
+		if transfer.PayeeType != payeeType || transfer.Status == PaymentTransferStatusPending || transfer.ID == "" {
+			continue
+		}
+		if transfer.Direct && !strings.EqualFold(transfer.Gateway, refundGateway) {
+			continue
+		}
+		reversed := false
+		for _, reversal := range transfer.Reversals {
+			if reversal.RefundID == refundID {
+				reversed = true
+				left = roundAmount(left - reversal.Amount)
+			}
+		}
+		remaining := roundAmount(transfer.Amount - transfer.ReversedAmount)
+		if reversed || remaining <= 0 {
+			continue
+		}
+		reversals[i] = math.Min(remaining, left)
+		left = roundAmount(left - reversals[i])
+	}
+	return reversals
+}
+
+// reversePaymentTransfers takes a refund made through a gateway back out of the transfers made to a kind of payee and gives what
+// was taken back for the refund. What isn't taken back is left to the settlement to take off what the payee is owed.
+func reversePaymentTransfers(collectionName string, id primitive.ObjectID, transfers []PaymentTransfer, payeeType string, amount float64, refundID string, refundGateway string) float64 {
+	reversed := 0.0
+	for _, transfer := range transfers {
+		for _, reversal := range transfer.Reversals {
+			if reversal.RefundID == refundID && transfer.PayeeType == payeeType {
+				reversed += reversal.Amount
+			}
+		}
+	}
+	for i, reverse := range paymentTransferReversals(transfers, payeeType, amount, refundID, refundGateway) {
+		transfer := transfers[i]
+		reversalID, err := reversePaymentTransfer(transfer, reverse, refundID)
+		if err != nil {
+			log.Errorln(err)
+			continue
+		}
+		reversal := PaymentTransferReversal{ID: reversalID, RefundID: refundID, Amount: reverse, ReversedAt: time.Now()}
+		filter := bson.D{{"paymentTransfers.id", transfer.ID}}
+		update := bson.D{
+			{"$push", bson.D{{"paymentTransfers.$.reversals", reversal}}},
+			{"$inc", bson.D{{"paymentTransfers.$.reversedAmount", reverse}}},
+		}
+		_, err = updatePaymentTransfers(collectionName, id, filter, update)
+		if err != nil {
+			log.Errorln(err)
+		}
+		reversed += reverse
+	}
+	return roundAmount(reversed)
+}
+
+// reversePaymentTransfer takes part of a transfer back through its gateway for a refund. A payment made straight
+// into the payee's account was refunded out of it by the gateway already, the refund is its reversal.
+func reversePaymentTransfer(transfer PaymentTransfer, amount float64, refundID string) (string, error) {
+	if transfer.Direct {
+		return refundID, nil
+	}
+	transferrer, ok := GetPaymentTransferrer(transfer.Gateway)
+	if !ok {
+		return "", fmt.Errorf("no payment transferrer for %s to reverse transfer %s", transfer.Gateway, transfer.ID)
+	}
+	return transferrer.ReverseTransfer(transfer, amount, refundID)
+}
+
+// ReleaseCompletedPaymentTransfers releases the transfers still held for orders and jobs that are completed, the ones
+// whose release failed when they were completed included, and gives how many orders and jobs it went through.
+func ReleaseCompletedPaymentTransfers() (int, error) {
+	held := bson.E{"paymentTransfers", bson.D{{"$elemMatch", bson.D{{"onHold", true}, {"status", PaymentTransferStatusTransferred}}}}}
+	completed := []struct {
+		collection string
+		filter     bson.D
+	}{
+		{OrdersCollection, bson.D{{"dateCompleted", bson.M{"$gt": time.Time{}}}, held}},
+		{JobsCollection, bson.D{{"completedAt", bson.M{"$ne": nil}}, held}},
+	}
+	ctx := context.Background()
+	count := 0
+	for _, target := range completed {
+		findOpts := options.Find().SetProjection(bson.D{{"paymentTransfers", 1}})
+		cur, err := database.MongoDB.Collection(target.collection).Find(ctx, target.filter, findOpts)
+		if err != nil {
+			log.Errorln(err)
+			return count, err
+		}
+		for cur.Next(ctx) {
+			var doc struct {
+				ID               primitive.ObjectID `bson:"_id"`
+				PaymentTransfers []PaymentTransfer  `bson:"paymentTransfers"`
+			}
+			err = cur.Decode(&doc)
+			if err != nil {
+				log.Errorln(err)
+				continue
+			}
+			releasePaymentTransfers(target.collection, doc.ID, doc.PaymentTransfers)
+			count++
+		}
+		err = cur.Err()
+		cur.Close(ctx)
+		if err != nil {
+			log.Errorln(err)
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// RunPaymentTransferRelease releases the held transfers of completed orders and jobs at every interval.
+func RunPaymentTransferRelease(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := ReleaseCompletedPaymentTransfers(); err != nil {
+			log.Errorln(err)
+		}
+		<-ticker.C
+	}
+}
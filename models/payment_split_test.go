@@ -0,0 +1,82 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+)
+
+func TestPaymentTransferKey(t *testing.T) {
+	payee := primitive.NewObjectID()
+	split := PaymentSplit{PayeeType: SettlementPayeeStore, PayeeID: payee, Amount: 10}
+	require.Equal(t, "pay_1:"+SettlementPayeeStore+":"+payee.Hex(), PaymentTransferKey("pay_1", split))
+
+	//the key doesn't change with the amount, so a payment split again finds its transfers
+	split.Amount = 20
+	require.Equal(t, "pay_1:"+SettlementPayeeStore+":"+payee.Hex(), PaymentTransferKey("pay_1", split))
+	require.NotEqual(t, PaymentTransferKey("pay_1", split), PaymentTransferKey("pay_2", split))
+}
+
+func TestPaymentTransfersMade(t *testing.T) {
+	require.False(t, paymentTransfersMade(nil))
+	require.True(t, paymentTransfersMade([]PaymentTransfer{{ID: "t1", Status: PaymentTransferStatusTransferred}}))
+	//transfers recorded before the pending status are made
+	require.True(t, paymentTransfersMade([]PaymentTransfer{{ID: "t1"}}))
+	require.False(t, paymentTransfersMade([]PaymentTransfer{
+		{ID: "t1", Status: PaymentTransferStatusTransferred},
+		{Key: "k2", Status: PaymentTransferStatusPending},
+	}))
+}
+
+func TestTransferredAndReversedAmount(t *testing.T) {
+	transfers := []PaymentTransfer{
+		{ID: "t1", PayeeType: SettlementPayeeStore, Amount: 100, ReversedAmount: 25},
+		{ID: "t2", PayeeType: SettlementPayeeStore, Amount: 50, Status: PaymentTransferStatusTransferred},
+		{Key: "k3", PayeeType: SettlementPayeeStore, Amount: 70, Status: PaymentTransferStatusPending},
+		{ID: "t4", PayeeType: SettlementPayeeProvider, Amount: 40, ReversedAmount: 10},
+	}
+	require.Equal(t, 150.0, transferredAmount(transfers, SettlementPayeeStore))
+	require.Equal(t, 40.0, transferredAmount(transfers, SettlementPayeeProvider))
+	require.Equal(t, 25.0, reversedAmount(transfers, SettlementPayeeStore))
+	require.Equal(t, 10.0, reversedAmount(transfers, SettlementPayeeProvider))
+}
+
+func TestPaymentTransferReversals(t *testing.T) {
+	transfers := []PaymentTransfer{
+		{ID: "t1", PayeeType: SettlementPayeeStore, Amount: 100, ReversedAmount: 80},
+		{Key: "k2", PayeeType: SettlementPayeeStore, Amount: 50, Status: PaymentTransferStatusPending},
+		{ID: "t3", PayeeType: SettlementPayeeProvider, Amount: 60},
+		{ID: "t4", PayeeType: SettlementPayeeStore, Amount: 60},
+	}
+	//the refund is taken out of what is left of each transfer in turn, pending ones and other payees left out
+	require.Equal(t, map[int]float64{0: 20, 3: 30}, paymentTransferReversals(transfers, SettlementPayeeStore, 50, "r1", "razorpay"))
+	//no more is reversed than was transferred
+	require.Equal(t, map[int]float64{0: 20, 3: 60}, paymentTransferReversals(transfers, SettlementPayeeStore, 500, "r1", "razorpay"))
+	require.Equal(t, map[int]float64{2: 45.5}, paymentTransferReversals(transfers, SettlementPayeeProvider, 45.5, "r1", "razorpay"))
+
+	//a refund reversed already isn't reversed again
+	transfers[0].ReversedAmount = 100
+	transfers[0].Reversals = []PaymentTransferReversal{{ID: "rv1", RefundID: "r1", Amount: 20}}
+	transfers[3].ReversedAmount = 30
+	transfers[3].Reversals = []PaymentTransferReversal{{ID: "rv2", RefundID: "r1", Amount: 30}}
+	require.Empty(t, paymentTransferReversals(transfers, SettlementPayeeStore, 50, "r1", "razorpay"))
+	require.Equal(t, map[int]float64{3: 10}, paymentTransferReversals(transfers, SettlementPayeeStore, 10, "r2", "razorpay"))
+}
+
+func TestPaymentTransferReversalsOfDirectPayments(t *testing.T) {
+	transfers := []PaymentTransfer{
+		{ID: "upi_1", Gateway: "upi", Direct: true, PayeeType: SettlementPayeeStore, Amount: 100, Status: PaymentTransferStatusTransferred},
+	}
+	//a refund through the gateway came out of the store's own account
+	require.Equal(t, map[int]float64{0: 40}, paymentTransferReversals(transfers, SettlementPayeeStore, 40, "r1", "upi"))
+	//a refund the market made another way is taken from the store by the settlement
+	require.Empty(t, paymentTransferReversals(transfers, SettlementPayeeStore, 40, "r1", "wallet"))
+
+	reversalID, err := reversePaymentTransfer(transfers[0], 40, "r1")
+	require.NoError(t, err)
+	require.Equal(t, "r1", reversalID)
+}
@@ -0,0 +1,512 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/cache"
+	"github.com/tribehq/platform/lib/database"
+	"github.com/tribehq/platform/utils/webhooks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"sync"
+	"time"
+)
+
+const paymentMethodExpiringTemplate = "payment_method.expiring"
+
+// PaymentMethodExpiryReminderDays is how long before a saved card expires its user is reminded to replace it.
+const PaymentMethodExpiryReminderDays = 30
+
+var (
+	// ErrPaymentMethodNotFound is returned when the user has no saved payment method with the id.
+	ErrPaymentMethodNotFound = errors.New("payment method not found")
+	// ErrPaymentMethodExpired is returned when a saved card is charged after it expired.
+	ErrPaymentMethodExpired = errors.New("payment method expired")
+	// ErrDefaultCurrencyNotSet is returned when fares are charged without a default currency to charge them in.
+	ErrDefaultCurrencyNotSet = errors.New("default currency is not set")
+	// ErrJobFareNotSet is returned when a job is charged before its fare is set.
+	ErrJobFareNotSet = errors.New("fare of the job is not set yet")
+)
+
+// paymentMethodExpiryNotice is what payment method expiry templates are rendered with.
+type paymentMethodExpiryNotice struct {
+	PaymentMethod *PaymentMethod
+	Customer      *User
+	ExpiresAt     time.Time
+}
+
+// ExpiresAt gives when a saved card stops working: cards are good through the last day of their expiry month.
+// It is the zero time for payment methods that don't expire.
+func (paymentInstrument *PaymentMethod) ExpiresAt() time.Time {
+	if paymentInstrument.ExpYear < 1 || paymentInstrument.ExpMonth < 1 {
+		return time.Time{}
+	}
+	return time.Date(paymentInstrument.ExpYear, time.Month(paymentInstrument.ExpMonth)+1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Expired tells whether a saved card has expired.
+func (paymentInstrument *PaymentMethod) Expired() bool {
+	expiresAt := paymentInstrument.ExpiresAt()
+	return !expiresAt.IsZero() && !time.Now().Before(expiresAt)
+}
+
+var (
+	paymentMethodIndexesMu    sync.Mutex
+	paymentMethodIndexesReady bool
+)
+
+// ensurePaymentMethodIndexes makes sure a user has only one default payment method, and indexes the lookups of the vault.
+func ensurePaymentMethodIndexes() {
+	paymentMethodIndexesMu.Lock()
+	defer paymentMethodIndexesMu.Unlock()
+	if paymentMethodIndexesReady {
+		return
+	}
+	_, err := database.MongoDB.Collection(UserPaymentMethodsCollection).Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{
+			Keys:    bson.D{{"userId", 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.D{{"isDefault", true}}).SetName("userId_default"),
+		},
+		{Keys: bson.D{{"userId", 1}, {"gateway", 1}, {"fingerprint", 1}}},
+		{Keys: bson.D{{"gateway", 1}, {"gatewayPaymentMethodID", 1}}},
+	})
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	paymentMethodIndexesReady = true
+}
+
+// findPaymentMethod gives the saved payment method matching the filter, leaving out removed ones.
+func findPaymentMethod(filter bson.D, findOneOpts ...*options.FindOneOptions) (*PaymentMethod, error) {
+	filter = append(filter, bson.E{"deletedAt", bson.M{"$exists": false}})
+	paymentMethod := &PaymentMethod{}
+	err := database.MongoDB.Collection(UserPaymentMethodsCollection).FindOne(context.Background(), filter, findOneOpts...).Decode(paymentMethod)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	return paymentMethod, nil
+}
+
+// updatePaymentMethod updates a saved payment method, nil when it was removed meanwhile.
+func updatePaymentMethod(paymentMethod *PaymentMethod, update bson.D) (*PaymentMethod, error) {
+	filter := bson.D{{"_id", paymentMethod.ID}, {"deletedAt", bson.M{"$exists": false}}}
+	updated := &PaymentMethod{}
+	findUpdateOpts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := database.MongoDB.Collection(UserPaymentMethodsCollection).FindOneAndUpdate(context.Background(), filter, update, findUpdateOpts).Decode(updated)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	err = cache.RedisClient.Del(updated.ID.Hex()).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	go webhooks.NewWebhookEvent("user_payment_method.updated", updated)
+	return updated, nil
+}
+
+// SavePaymentMethod saves a card or wallet a gateway tokenized for a user. A card the user already saved at the gateway,
+// told apart by the gateway's fingerprint of it, isn't saved twice: the saved one takes the new token and expiry and is given back as a duplicate.
+// The user's first payment method becomes their default.
+func SavePaymentMethod(paymentMethod PaymentMethod, makeDefault bool) (saved *PaymentMethod, duplicate bool, err error) {
+	ensurePaymentMethodIndexes()
+	if paymentMethod.Fingerprint != "" {
+		saved, err = findPaymentMethod(bson.D{
+			{"userId", paymentMethod.UserID},
+			{"gateway", paymentMethod.Gateway},
+			{"fingerprint", paymentMethod.Fingerprint},
+		})
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if saved != nil {
+		set := bson.D{
+			{"gatewayPaymentMethodID", paymentMethod.GatewayPaymentMethodID},
+			{"name", paymentMethod.Name},
+			{"type", paymentMethod.Type},
+			{"brand", paymentMethod.Brand},
+			{"last4", paymentMethod.Last4},
+			{"expMonth", paymentMethod.ExpMonth},
+			{"expYear", paymentMethod.ExpYear},
+			{"updatedAt", time.Now()},
+		}
+		if paymentMethod.GatewayCustomerID != "" {
+			set = append(set, bson.E{"gatewayCustomerID", paymentMethod.GatewayCustomerID})
+		}
+		update := bson.D{{"$set", set}}
+		if saved.ExpMonth != paymentMethod.ExpMonth || saved.ExpYear != paymentMethod.ExpYear {
+			//a renewed card is reminded of again when it nears its new expiry
+			update = append(update, bson.E{"$unset", bson.D{{"expiryRemindedAt", ""}}})
+		}
+		saved, err = updatePaymentMethod(saved, update)
+		if err != nil || saved == nil {
+			return saved, true, err
+		}
+		if makeDefault && !saved.IsDefault {
+			saved, err = SetDefaultPaymentMethod(saved)
+		}
+		return saved, true, err
+	}
+
+	current, err := GetDefaultPaymentMethod(paymentMethod.UserID)
+	if err != nil {
+		return nil, false, err
+	}
+	paymentMethod.IsDefault = current == nil
+	paymentMethod.ExpiryRemindedAt = nil
+	saved, err = CreatePaymentMethod(paymentMethod)
+	if err != nil && paymentMethod.IsDefault && isDuplicateKeyError(err) {
+		//another payment method of the user became the default meanwhile
+		paymentMethod.IsDefault = false
+		saved, err = CreatePaymentMethod(paymentMethod)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if makeDefault && !saved.IsDefault {
+		saved, err = SetDefaultPaymentMethod(saved)
+	}
+	return saved, false, err
+}
+
+// SetDefaultPaymentMethod makes a saved payment method the one its user pays with unless they pick another.
+func SetDefaultPaymentMethod(paymentMethod *PaymentMethod) (*PaymentMethod, error) {
+	ensurePaymentMethodIndexes()
+	now := time.Now()
+	filter := bson.D{{"userId", paymentMethod.UserID}, {"isDefault", true}, {"_id", bson.M{"$ne": paymentMethod.ID}}}
+	_, err := database.MongoDB.Collection(UserPaymentMethodsCollection).UpdateMany(context.Background(), filter,
+		bson.D{{"$set", bson.D{{"isDefault", false}, {"updatedAt", now}}}})
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	updated, err := updatePaymentMethod(paymentMethod, bson.D{{"$set", bson.D{{"isDefault", true}, {"updatedAt", now}}}})
+	if err != nil {
+		return nil, err
+	}
+	if updated == nil {
+		return nil, ErrPaymentMethodNotFound
+	}
+	return updated, nil
+}
+
+// RemovePaymentMethod removes a saved payment method. When it was the default, the user's most recently saved card
+// that hasn't expired becomes the default.
+func RemovePaymentMethod(paymentMethod *PaymentMethod) error {
+	now := time.Now()
+	removed, err := updatePaymentMethod(paymentMethod, bson.D{{"$set", bson.D{{"deletedAt", now}, {"isDefault", false}, {"updatedAt", now}}}})
+	if err != nil {
+		return err
+	}
+	if removed == nil {
+		return ErrPaymentMethodNotFound
+	}
+	go webhooks.NewWebhookEvent("user_payment_method.deleted", removed)
+	if !paymentMethod.IsDefault {
+		return nil
+	}
+	remaining, err := GetUserPaymentMethods(paymentMethod.UserID)
+	if err != nil {
+		return err
+	}
+	for _, next := range remaining {
+		if next.Expired() {
+			continue
+		}
+		_, err = SetDefaultPaymentMethod(next)
+		return err
+	}
+	return nil
+}
+
+// GetUserPaymentMethod gives one of the user's saved payment methods.
+func GetUserPaymentMethod(userID string, id primitive.ObjectID) (*PaymentMethod, error) {
+	paymentMethod, err := findPaymentMethod(bson.D{{"_id", id}, {"userId", userID}})
+	if err != nil {
+		return nil, err
+	}
+	if paymentMethod == nil {
+		return nil, ErrPaymentMethodNotFound
+	}
+	return paymentMethod, nil
+}
+
+// GetDefaultPaymentMethod gives the user's default payment method, nil when they saved none.
+func GetDefaultPaymentMethod(userID string) (*PaymentMethod, error) {
+	return findPaymentMethod(bson.D{{"userId", userID}, {"isDefault", true}})
+}
+
+// GetUserPaymentMethods gives the user's saved payment methods, the default first and then the most recently saved.
+func GetUserPaymentMethods(userID string) ([]*PaymentMethod, error) {
+	ctx := context.Background()
+	filter := bson.D{{"userId", userID}, {"deletedAt", bson.M{"$exists": false}}}
+	findOpts := options.Find().SetSort(bson.D{{"isDefault", -1}, {"createdAt", -1}})
+	cur, err := database.MongoDB.Collection(UserPaymentMethodsCollection).Find(ctx, filter, findOpts)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var paymentMethods []*PaymentMethod
+	for cur.Next(ctx) {
+		paymentMethod := &PaymentMethod{}
+		if err = cur.Decode(paymentMethod); err != nil {
+			log.Errorln(err)
+			return nil, err
+		}
+		paymentMethods = append(paymentMethods, paymentMethod)
+	}
+	return paymentMethods, cur.Err()
+}
+
+// saveLinkedWalletPaymentMethod saves a linked wallet as a payment method of its user, so it can be picked like a saved card.
+// The wallet's access token stays on the linked wallet, the payment method only refers to it.
+func saveLinkedWalletPaymentMethod(wallet *LinkedWallet) {
+	_, _, err := SavePaymentMethod(PaymentMethod{
+		Name:                   strings.Title(wallet.Provider) + " wallet",
+		Type:                   PaymentMethodTypeWallet,
+		UserID:                 wallet.UserID.Hex(),
+		Gateway:                wallet.Provider,
+		GatewayPaymentMethodID: wallet.ID.Hex(),
+		GatewayCustomerID:      wallet.UserID.Hex(),
+		Fingerprint:            "wallet:" + wallet.ID.Hex(),
+	}, false)
+	if err != nil {
+		log.Errorln(err)
+	}
+}
+
+// removeLinkedWalletPaymentMethod removes the payment method of a wallet that was unlinked.
+func removeLinkedWalletPaymentMethod(wallet *LinkedWallet) {
+	paymentMethod, err := findPaymentMethod(bson.D{{"gateway", wallet.Provider}, {"gatewayPaymentMethodID", wallet.ID.Hex()}})
+	if err != nil || paymentMethod == nil {
+		return
+	}
+	err = RemovePaymentMethod(paymentMethod)
+	if err != nil && err != ErrPaymentMethodNotFound {
+		log.Errorln(err)
+	}
+}
+
+// chargeToken gives what the gateway charges a saved payment method with. Linked wallets are charged with
+// the access token of the wallet, which is only kept on the linked wallet.
+func chargeToken(paymentMethod *PaymentMethod) (string, error) {
+	if paymentMethod.Type != PaymentMethodTypeWallet {
+		return paymentMethod.GatewayPaymentMethodID, nil
+	}
+	walletID, err := primitive.ObjectIDFromHex(paymentMethod.GatewayPaymentMethodID)
+	if err != nil {
+		return "", ErrWalletNotLinked
+	}
+	wallet, err := getLinkedWalletByID(walletID)
+	if err != nil {
+		return "", err
+	}
+	if wallet == nil || !wallet.IsUsable() {
+		return "", ErrWalletNotLinked
+	}
+	return wallet.Token, nil
+}
+
+// SetJobPaymentMethod picks the saved payment method the fare of a job is charged to once the job is completed.
+// A job that was completed without being paid is charged right away.
+func SetJobPaymentMethod(job *Job, paymentMethod *PaymentMethod) (*Job, error) {
+	if job.CancelledAt != nil {
+		return nil, ErrJobCancelled
+	}
+	if paymentMethod.Expired() {
+		return nil, ErrPaymentMethodExpired
+	}
+	job, err := updateJobPayment(job, bson.D{{"paymentMethodID", paymentMethod.ID}})
+	if err != nil {
+		return nil, err
+	}
+	if job.CompletedAt == nil {
+		return job, nil
+	}
+	return ChargeJobFare(job)
+}
+
+// fareChargeID is the charge id of the next attempt to charge a job's fare, numbered after the declined ones.
+func fareChargeID(job *Job) string {
+	if job.FareChargeAttempts > 0 {
+		return fmt.Sprintf("%s-%d", job.ID.Hex(), job.FareChargeAttempts+1)
+	}
+	return job.ID.Hex()
+}
+
+// JobFareDue gives the fare a job is paid with and the currency it is paid in. Jobs are paid their fare once it is set,
+// never the estimate they were booked with.
+func JobFareDue(job *Job) (float64, string, error) {
+	if job.FareAmount <= 0 {
+		return 0, "", ErrJobFareNotSet
+	}
+	currency, err := GetDefaultCurrency()
+	if err != nil {
+		return 0, "", err
+	}
+	if currency == nil {
+		return 0, "", ErrDefaultCurrencyNotSet
+	}
+	return roundAmount(job.FareAmount), currency.CurrencyCode, nil
+}
+
+// ChargeJobFare charges the fare of a completed job to the saved payment method picked for it, without the customer being present.
+// Jobs without a payment method, paid already or paid from a wallet hold are left as they are. The charge id stays the same
+// until the gateway declines a charge, so a retry after a timeout or an outage can't charge twice while a declined one can be tried again.
+func ChargeJobFare(job *Job) (*Job, error) {
+	if job.PaymentMethodID == nil || isJobPaid(job) {
+		return job, nil
+	}
+	if job.CompletedAt == nil {
+		return nil, ErrJobNotCompleted
+	}
+	hold, err := GetWalletHoldByFilter(bson.D{{"jobID", job.ID}, {"status", bson.M{"$ne": WalletHoldStatusReleased}}})
+	if err != nil {
+		return nil, err
+	}
+	if hold != nil {
+		return job, nil
+	}
+	paymentMethod, err := GetUserPaymentMethod(job.UserID, *job.PaymentMethodID)
+	if err != nil {
+		return nil, err
+	}
+	if paymentMethod.Expired() {
+		return nil, ErrPaymentMethodExpired
+	}
+	charger, ok := GetPaymentCharger(paymentMethod.Gateway)
+	if !ok {
+		return nil, ErrPaymentGatewayNotConfigured
+	}
+	token, err := chargeToken(paymentMethod)
+	if err != nil {
+		return nil, err
+	}
+	amount, currency, err := JobFareDue(job)
+	if err != nil {
+		return nil, err
+	}
+	paymentID, chargeErr := charger.ChargePayment(GatewayCharge{
+		ChargeID:        fareChargeID(job),
+		CustomerID:      paymentMethod.GatewayCustomerID,
+		PaymentMethodID: token,
+		JobID:           job.ID.Hex(),
+		Amount:          amount,
+		Currency:        currency,
+		Description:     fmt.Sprintf("Fare of booking %s", job.BookingNumber),
+	})
+	update := GatewayPaymentUpdate{
+		Gateway:   paymentMethod.Gateway,
+		PaymentID: paymentID,
+		JobID:     job.ID.Hex(),
+		Amount:    amount,
+		Currency:  currency,
+	}
+	if chargeErr == ErrPaymentDeclined {
+		update.Reason = chargeErr.Error()
+		_, err = updateJobPayment(job, bson.D{{"fareChargeAttempts", job.FareChargeAttempts + 1}})
+		if err != nil {
+			log.Errorln(err)
+		}
+		if paymentID != "" {
+			if err = RecordGatewayPaymentFailed(update); err != nil {
+				log.Errorln(err)
+			}
+		}
+		return nil, chargeErr
+	}
+	if chargeErr != nil {
+		return nil, chargeErr
+	}
+	err = RecordGatewayPaymentSucceeded(update)
+	if err != nil {
+		return nil, err
+	}
+	return GetJobByID(job.ID.Hex())
+}
+
+// SendPaymentMethodExpiryReminders reminds users of the saved cards that expire within PaymentMethodExpiryReminderDays,
+// once for each expiry. It gives the number of reminders sent.
+func SendPaymentMethodExpiryReminders(now time.Time) (int, error) {
+	month := func(t time.Time) int {
+		return t.Year()*12 + int(t.Month()) - 1
+	}
+	expiryMonth := bson.M{"$add": bson.A{bson.M{"$multiply": bson.A{"$expYear", 12}}, "$expMonth", -1}}
+	filter := bson.D{
+		{"deletedAt", bson.M{"$exists": false}},
+		{"type", bson.M{"$in": bson.A{PaymentMethodTypeCredit, PaymentMethodTypeDebit}}},
+		{"expYear", bson.M{"$gt": 0}},
+		{"expiryRemindedAt", bson.M{"$exists": false}},
+		{"$expr", bson.M{"$and": bson.A{
+			bson.M{"$gte": bson.A{expiryMonth, month(now)}},
+			bson.M{"$lte": bson.A{expiryMonth, month(now.AddDate(0, 0, PaymentMethodExpiryReminderDays))}},
+		}}},
+	}
+	ctx := context.Background()
+	collection := database.MongoDB.Collection(UserPaymentMethodsCollection)
+	cur, err := collection.Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	var paymentMethods []*PaymentMethod
+	err = cur.All(ctx, &paymentMethods)
+	if err != nil {
+		return 0, err
+	}
+	sent := 0
+	for _, paymentMethod := range paymentMethods {
+		//claim the reminder first so that concurrent runs don't send it twice
+		claim := bson.D{{"$set", bson.D{{"expiryRemindedAt", now}}}}
+		res, err := collection.UpdateOne(ctx, bson.D{{"_id", paymentMethod.ID}, {"expiryRemindedAt", bson.M{"$exists": false}}}, claim)
+		if err != nil {
+			log.Errorln(err)
+			continue
+		}
+		if res.ModifiedCount < 1 {
+			continue
+		}
+		customer := GetUserByID(paymentMethod.UserID)
+		if customer == nil || customer.Email == "" {
+			continue
+		}
+		notice := &paymentMethodExpiryNotice{PaymentMethod: paymentMethod, Customer: customer, ExpiresAt: paymentMethod.ExpiresAt()}
+		err = SendEmail("no-reply@tribe.cab", customer.Email, paymentMethodExpiringTemplate, customer.Language, notice, nil)
+		if err != nil {
+			log.Errorln(err)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// RunPaymentMethodExpiryReminders sends the reminders of expiring cards that are due, checking every interval.
+func RunPaymentMethodExpiryReminders(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := SendPaymentMethodExpiryReminders(time.Now()); err != nil {
+			log.Errorln(err)
+		}
+		<-ticker.C
+	}
+}
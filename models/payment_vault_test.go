@@ -0,0 +1,36 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+	"time"
+)
+
+func TestPaymentMethodExpiresAt(t *testing.T) {
+	card := &PaymentMethod{ExpMonth: 12, ExpYear: 2030}
+	require.Equal(t, time.Date(2031, time.January, 1, 0, 0, 0, 0, time.UTC), card.ExpiresAt())
+	require.False(t, card.Expired())
+
+	expired := &PaymentMethod{ExpMonth: 1, ExpYear: 2019}
+	require.True(t, expired.Expired())
+
+	wallet := &PaymentMethod{Type: PaymentMethodTypeWallet}
+	require.True(t, wallet.ExpiresAt().IsZero())
+	require.False(t, wallet.Expired())
+}
+
+func TestFareChargeID(t *testing.T) {
+	job := &Job{ID: primitive.NewObjectID()}
+	require.Equal(t, job.ID.Hex(), fareChargeID(job))
+
+	//the id only moves on once a charge was declined, so a retry of an unanswered charge can't charge twice
+	job.FareChargeAttempts = 1
+	require.Equal(t, job.ID.Hex()+"-2", fareChargeID(job))
+	job.FareChargeAttempts = 2
+	require.Equal(t, job.ID.Hex()+"-3", fareChargeID(job))
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"strings"
+	"sync"
+)
+
+// ManualPayoutProvider pays withdrawals by a bank transfer an admin makes by hand and then marks paid.
+const ManualPayoutProvider = "manual"
+
+// GatewayPayout describes a transfer of a provider's withdrawal to their bank account.
+type GatewayPayout struct {
+	WithdrawalID      string  // our withdrawal id, payout providers use it as the idempotency key
+	Amount            float64 // in the major unit of the currency
+	Currency          string
+	AccountHolderName string
+	AccountNumber     string
+	IfscCode          string
+	RoutingNumber     string
+	SwiftCode         string
+	BankName          string
+	BankCountry       string
+}
+
+// PayoutStatus is what a payout provider knows of the outcome of a payout.
+type PayoutStatus string
+
+// Payout statuses, only failed and reversed payouts give the held funds back to the provider.
+const (
+	PayoutStatusPending  PayoutStatus = "pending"  //queued or being processed, the outcome isn't known yet
+	PayoutStatusPaid     PayoutStatus = "paid"     //the money reached the bank account
+	PayoutStatusFailed   PayoutStatus = "failed"   //the payout was turned down and no money went out
+	PayoutStatusReversed PayoutStatus = "reversed" //the bank sent the money back
+)
+
+// PayoutResult describes the state of the payout of a withdrawal at a payout provider.
+type PayoutResult struct {
+	WithdrawalID string
+	Reference    string //the payout provider's reference for the payout
+	Status       PayoutStatus
+	Reason       string //why the payout failed or was reversed
+}
+
+// PayoutProvider transfers withdrawals to the bank accounts of providers.
+type PayoutProvider interface {
+	// Payout makes the transfer, or gives the payout made for the withdrawal already.
+	// Payouts are often still pending when this returns, their outcome comes through GetPayout or a webhook.
+	// An error means the outcome isn't known, the payout may still have been made.
+	Payout(payout GatewayPayout) (*PayoutResult, error)
+	// GetPayout gives the payout made for a withdrawal, looked up by its reference when there is one,
+	// nil when no payout was made for the withdrawal.
+	GetPayout(withdrawalID string, reference string) (*PayoutResult, error)
+}
+
+var (
+	payoutProvidersMu sync.RWMutex
+	payoutProviders   = map[string]PayoutProvider{}
+)
+
+// RegisterPayoutProvider makes a payout provider available for withdrawals under the given name.
+func RegisterPayoutProvider(name string, provider PayoutProvider) {
+	payoutProvidersMu.Lock()
+	defer payoutProvidersMu.Unlock()
+	payoutProviders[strings.ToLower(name)] = provider
+}
+
+// GetPayoutProvider gives the payout provider registered under a name.
+func GetPayoutProvider(name string) (PayoutProvider, bool) {
+	payoutProvidersMu.RLock()
+	defer payoutProvidersMu.RUnlock()
+	provider, ok := payoutProviders[strings.ToLower(name)]
+	return provider, ok
+}
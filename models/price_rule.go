@@ -0,0 +1,352 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/database"
+	"github.com/tribehq/platform/utils/webhooks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidMarkdownPercentage = errors.New("markdown percentage must be more than 0 and less than 100")
+	ErrInvalidPriceRuleSchedule  = errors.New("price rule must end in the future and after it starts")
+	ErrPriceRuleTargetNotFound   = errors.New("price rule category or collection not found")
+	ErrPriceRuleRolledBack       = errors.New("price rule has already been rolled back")
+)
+
+// PriceRule is a percentage markdown put on the products of a category or collection for a while.
+// The markdown is written as scheduled sale prices so the price scheduler starts and ends it.
+type PriceRule struct {
+	ID           primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	CreatedAt    time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt    time.Time          `json:"updatedAt" bson:"updatedAt"`
+	CreatedBy    primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	Store        string             `json:"store" bson:"store"`
+	Name         string             `json:"name" bson:"name"`
+	Target       PriceRuleTarget    `json:"target" bson:"target"`
+	TargetID     primitive.ObjectID `json:"targetID" bson:"targetID"`
+	Percentage   float64            `json:"percentage" bson:"percentage"`
+	StartsAt     time.Time          `json:"startsAt" bson:"startsAt"`
+	EndsAt       *time.Time         `json:"endsAt" bson:"endsAt"`
+	Status       PriceRuleStatus    `json:"status" bson:"status"`
+	Items        []*PriceRuleItem   `json:"items" bson:"items"`
+	RolledBackAt *time.Time         `json:"rolledBackAt" bson:"rolledBackAt"`
+}
+
+// PriceRuleItem is a product or variation marked down by a price rule along with the sale it had before.
+type PriceRuleItem struct {
+	ProductID              primitive.ObjectID  `json:"productID" bson:"productID"`
+	VariationID            *primitive.ObjectID `json:"variationID" bson:"variationID"`
+	RegularPrice           float64             `json:"regularPrice" bson:"regularPrice"`
+	SalePrice              float64             `json:"salePrice" bson:"salePrice"`
+	PreviousSalePrice      float64             `json:"previousSalePrice" bson:"previousSalePrice"`
+	PreviousDateOnSaleFrom time.Time           `json:"previousDateOnSaleFrom" bson:"previousDateOnSaleFrom"`
+	PreviousDateOnSaleTo   time.Time           `json:"previousDateOnSaleTo" bson:"previousDateOnSaleTo"`
+}
+
+// CreatePriceRule creates a price rule and marks down the products it targets.
+func CreatePriceRule(priceRule PriceRule) (*PriceRule, error) {
+	now := time.Now()
+	err := priceRule.schedule(now)
+	if err != nil {
+		return nil, err
+	}
+	products, err := priceRuleProducts(&priceRule)
+	if err != nil {
+		return nil, err
+	}
+	priceRule.CreatedAt = now
+	priceRule.UpdatedAt = now
+	priceRule.ID = primitive.NewObjectID()
+	priceRule.Items = []*PriceRuleItem{}
+
+	//the rule goes in first so every markdown is recorded against it before the product changes
+	collection := database.MongoDB.Collection(PriceRulesCollection)
+	_, err = collection.InsertOne(context.Background(), &priceRule)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	for _, product := range products {
+		items, err := priceRule.markDown(product)
+		if err != nil {
+			log.Errorln(err)
+		}
+		priceRule.Items = append(priceRule.Items, items...)
+	}
+	go webhooks.NewWebhookEvent("price_rule.created", &priceRule)
+	return &priceRule, nil
+}
+
+// schedule checks the markdown and window of a new price rule, starting it now when no start is given,
+// and gives it the status it has at the time.
+func (priceRule *PriceRule) schedule(now time.Time) error {
+	if priceRule.Percentage <= 0 || priceRule.Percentage >= 100 {
+		return ErrInvalidMarkdownPercentage
+	}
+	if priceRule.StartsAt.IsZero() {
+		priceRule.StartsAt = now
+	}
+	if priceRule.EndsAt != nil && (!priceRule.EndsAt.After(priceRule.StartsAt) || !priceRule.EndsAt.After(now)) {
+		return ErrInvalidPriceRuleSchedule
+	}
+	priceRule.Status = PriceRuleStatusScheduled
+	if !priceRule.StartsAt.After(now) {
+		priceRule.Status = PriceRuleStatusActive
+	}
+	return nil
+}
+
+// item gives the markdown of a price rule on a regular price, remembering the sale it takes the place of.
+// The markdown is the sale for the window of the rule, newer rules taking the place of older ones.
+func (priceRule *PriceRule) item(regularPrice float64, salePrice float64, dateOnSaleFrom time.Time, dateOnSaleTo time.Time) *PriceRuleItem {
+	return &PriceRuleItem{
+		RegularPrice:           regularPrice,
+		SalePrice:              markdownPrice(regularPrice, priceRule.Percentage),
+		PreviousSalePrice:      salePrice,
+		PreviousDateOnSaleFrom: dateOnSaleFrom,
+		PreviousDateOnSaleTo:   dateOnSaleTo,
+	}
+}
+
+// saleWindow gives the sale dates the markdown of a price rule runs for, an open end when the rule doesn't end.
+func (priceRule *PriceRule) saleWindow() (time.Time, time.Time) {
+	if priceRule.EndsAt != nil {
+		return priceRule.StartsAt, *priceRule.EndsAt
+	}
+	return priceRule.StartsAt, time.Time{}
+}
+
+// previousSale gives the sale rolling back an item puts back, false when the sale was changed since the markdown,
+// by a newer price rule or by hand, and is left as it is.
+func (item *PriceRuleItem) previousSale(salePrice float64) (float64, time.Time, time.Time, bool) {
+	if salePrice != item.SalePrice {
+		return 0, time.Time{}, time.Time{}, false
+	}
+	return item.PreviousSalePrice, item.PreviousDateOnSaleFrom, item.PreviousDateOnSaleTo, true
+}
+
+// recordItem adds an item to the stored price rule ahead of marking it down, so a rollback finds it.
+func (priceRule *PriceRule) recordItem(item *PriceRuleItem) error {
+	_, err := database.MongoDB.Collection(PriceRulesCollection).UpdateOne(context.Background(),
+		bson.D{{"_id", priceRule.ID}},
+		bson.D{{"$push", bson.D{{"items", item}}}, {"$set", bson.D{{"updatedAt", time.Now()}}}})
+	return err
+}
+
+// priceRuleProducts gives the products a price rule targets.
+func priceRuleProducts(priceRule *PriceRule) ([]*Product, error) {
+	filter := bson.D{{"deletedAt", bson.M{"$exists": false}}}
+	if priceRule.Store != "" {
+		filter = append(filter, bson.E{"store", priceRule.Store})
+	}
+	switch priceRule.Target {
+	case PriceRuleTargetCategory:
+		category := GetProductCategoryByID(priceRule.TargetID.Hex())
+		if category == nil || category.ID.IsZero() {
+			return nil, ErrPriceRuleTargetNotFound
+		}
+		filter = append(filter, bson.E{"categories._id", category.ID})
+	case PriceRuleTargetCollection:
+		collection := GetProductCollectionByID(priceRule.TargetID.Hex())
+		if collection == nil || collection.ID.IsZero() {
+			return nil, ErrPriceRuleTargetNotFound
+		}
+		var ids []primitive.ObjectID
+		for _, relationship := range collection.Relationships {
+			if relationship != nil && (relationship.Type == "" || strings.EqualFold(relationship.Type, "product")) {
+				ids = append(ids, relationship.ID)
+			}
+		}
+		filter = append(filter, bson.E{"_id", bson.M{"$in": ids}})
+	default:
+		return nil, ErrPriceRuleTargetNotFound
+	}
+
+	var products []*Product
+	ctx := context.Background()
+	cur, err := database.MongoDB.Collection(ProductsCollection).Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	err = cur.All(ctx, &products)
+	return products, err
+}
+
+// markDown puts the sale price of a rule on a product, or on its variations for variable products.
+func (priceRule *PriceRule) markDown(product *Product) ([]*PriceRuleItem, error) {
+	var items []*PriceRuleItem
+	dateOnSaleFrom, dateOnSaleTo := priceRule.saleWindow()
+	if product.Type != ProductTypeVariable {
+		if product.RegularPrice <= 0 {
+			return nil, nil
+		}
+		item := priceRule.item(product.RegularPrice, product.SalePrice, product.DateOnSaleFrom, product.DateOnSaleTo)
+		item.ProductID = product.ID
+		if err := priceRule.recordItem(item); err != nil {
+			return nil, err
+		}
+		product.SalePrice, product.DateOnSaleFrom, product.DateOnSaleTo = item.SalePrice, dateOnSaleFrom, dateOnSaleTo
+		_, err := UpdateProduct(product)
+		if err != nil {
+			return append(items, item), err
+		}
+		return append(items, item), nil
+	}
+
+	variations, err := productVariationsOf(product.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, variation := range variations {
+		if variation.RegularPrice <= 0 {
+			continue
+		}
+		variationID := variation.ID
+		item := priceRule.item(variation.RegularPrice, variation.SalePrice, variation.DateOnSaleFrom, variation.DateOnSaleTo)
+		item.ProductID, item.VariationID = product.ID, &variationID
+		if err := priceRule.recordItem(item); err != nil {
+			return items, err
+		}
+		items = append(items, item)
+		variation.SalePrice, variation.DateOnSaleFrom, variation.DateOnSaleTo = item.SalePrice, dateOnSaleFrom, dateOnSaleTo
+		UpdateProductVariation(variation)
+	}
+	return items, nil
+}
+
+// markdownPrice gives a price taken down by a percentage.
+func markdownPrice(price float64, percentage float64) float64 {
+	return roundAmount(price * (100 - percentage) / 100)
+}
+
+// GetPriceRuleByID gives price rule by id.
+func GetPriceRuleByID(ID string) (*PriceRule, error) {
+	priceRule := &PriceRule{}
+	id, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return nil, err
+	}
+	err = database.MongoDB.Collection(PriceRulesCollection).FindOne(context.Background(), bson.D{{"_id", id}}).Decode(&priceRule)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	return priceRule, nil
+}
+
+// GetPriceRules gives a list of price rules.
+func GetPriceRules(filter bson.D, limit int, after *string, before *string, first *int, last *int) (priceRules []*PriceRule, totalCount int64, hasPrevious, hasNext bool, err error) {
+
+	db := database.MongoDB
+
+	tcint, filter, err := calcTotalCountWithQueryFilters(PriceRulesCollection, filter, after, before)
+	pagingInfo, err := PaginationUtility(after, before, first, last, &tcint)
+	if err != nil {
+		return
+	}
+	pagingInfo.QueryOpts.SetSort(bson.M{"_id": -1})
+
+	cur, err := db.Collection(PriceRulesCollection).Find(context.Background(), filter, &pagingInfo.QueryOpts)
+	if err != nil {
+		return
+	}
+	ctx := context.Background()
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		priceRule := &PriceRule{}
+		err = cur.Decode(&priceRule)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return
+			}
+			log.Errorln(err)
+		}
+		priceRules = append(priceRules, priceRule)
+	}
+	if err = cur.Err(); err != nil {
+		return
+	}
+	return priceRules, int64(tcint), pagingInfo.HasPreviousPage, pagingInfo.HasNextPage, nil
+}
+
+// RollbackPriceRule puts back the sales the products of a price rule had before the markdown.
+// Items whose sale price was changed since are left as they are.
+func RollbackPriceRule(priceRule *PriceRule) (*PriceRule, error) {
+	//claim the rollback first so the sales are put back only once
+	now := time.Now()
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	claimed := &PriceRule{}
+	err := database.MongoDB.Collection(PriceRulesCollection).FindOneAndUpdate(context.Background(),
+		bson.D{{"_id", priceRule.ID}, {"status", bson.M{"$ne": PriceRuleStatusRolledBack}}},
+		bson.D{{"$set", bson.D{{"status", PriceRuleStatusRolledBack}, {"rolledBackAt", now}, {"updatedAt", now}}}},
+		opts).Decode(claimed)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrPriceRuleRolledBack
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+
+	for _, item := range claimed.Items {
+		if item.VariationID != nil {
+			variation, err := GetProductVariationByID(*item.VariationID)
+			if err != nil || variation == nil {
+				continue
+			}
+			salePrice, from, to, ok := item.previousSale(variation.SalePrice)
+			if !ok {
+				continue
+			}
+			variation.SalePrice, variation.DateOnSaleFrom, variation.DateOnSaleTo = salePrice, from, to
+			UpdateProductVariation(variation)
+			continue
+		}
+		product := GetProductByID(item.ProductID.Hex())
+		if product.ID.IsZero() {
+			continue
+		}
+		salePrice, from, to, ok := item.previousSale(product.SalePrice)
+		if !ok {
+			continue
+		}
+		product.SalePrice, product.DateOnSaleFrom, product.DateOnSaleTo = salePrice, from, to
+		_, err := UpdateProduct(product)
+		if err != nil {
+			log.Errorln(err)
+		}
+	}
+	go webhooks.NewWebhookEvent("price_rule.rolled_back", claimed)
+	return claimed, nil
+}
+
+// advancePriceRules moves price rules to active once they start and to ended once they end.
+func advancePriceRules(now time.Time) error {
+	collection := database.MongoDB.Collection(PriceRulesCollection)
+	ctx := context.Background()
+	_, err := collection.UpdateMany(ctx,
+		bson.D{{"status", PriceRuleStatusScheduled}, {"startsAt", bson.M{"$lte": now}}},
+		bson.D{{"$set", bson.D{{"status", PriceRuleStatusActive}, {"updatedAt", now}}}})
+	if err != nil {
+		return err
+	}
+	_, err = collection.UpdateMany(ctx,
+		bson.D{{"status", bson.M{"$in": bson.A{PriceRuleStatusScheduled, PriceRuleStatusActive}}}, {"endsAt", bson.M{"$lte": now}}},
+		bson.D{{"$set", bson.D{{"status", PriceRuleStatusEnded}, {"updatedAt", now}}}})
+	return err
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestPriceRuleSchedule(t *testing.T) {
+	now := time.Date(2019, time.November, 1, 10, 0, 0, 0, time.UTC)
+	later, earlier := now.Add(48*time.Hour), now.Add(-time.Hour)
+
+	rule := &PriceRule{Percentage: 20}
+	require.NoError(t, rule.schedule(now))
+	require.Equal(t, now, rule.StartsAt)
+	require.Equal(t, PriceRuleStatusActive, rule.Status)
+
+	scheduled := &PriceRule{Percentage: 20, StartsAt: now.Add(time.Hour), EndsAt: &later}
+	require.NoError(t, scheduled.schedule(now))
+	require.Equal(t, PriceRuleStatusScheduled, scheduled.Status)
+
+	for _, invalid := range []*PriceRule{
+		{Percentage: 20, EndsAt: &earlier},
+		{Percentage: 20, StartsAt: later, EndsAt: &later},
+		{Percentage: 20, StartsAt: later.Add(time.Hour), EndsAt: &later},
+	} {
+		require.Equal(t, ErrInvalidPriceRuleSchedule, invalid.schedule(now))
+	}
+	require.Equal(t, ErrInvalidMarkdownPercentage, (&PriceRule{Percentage: 0}).schedule(now))
+	require.Equal(t, ErrInvalidMarkdownPercentage, (&PriceRule{Percentage: 100}).schedule(now))
+}
+
+func TestPriceRuleWindow(t *testing.T) {
+	startsAt := time.Date(2019, time.November, 1, 0, 0, 0, 0, time.UTC)
+	endsAt := startsAt.Add(72 * time.Hour)
+	rule := &PriceRule{Percentage: 25, StartsAt: startsAt, EndsAt: &endsAt}
+	item := rule.item(200, 0, time.Time{}, time.Time{})
+	require.Equal(t, 150.0, item.SalePrice)
+
+	from, to := rule.saleWindow()
+	require.Equal(t, startsAt, from)
+	require.Equal(t, endsAt, to)
+	product := &Product{Type: ProductTypeSimple, RegularPrice: 200, SalePrice: item.SalePrice, DateOnSaleFrom: from, DateOnSaleTo: to}
+
+	//before the window the regular price holds
+	product.applySaleSchedule(startsAt.Add(-time.Minute))
+	require.Equal(t, 200.0, product.Price)
+	require.False(t, product.OnSale)
+	//within it the markdown does, up to and including its end
+	product.applySaleSchedule(startsAt)
+	require.Equal(t, 150.0, product.Price)
+	require.True(t, product.OnSale)
+	product.applySaleSchedule(endsAt)
+	require.Equal(t, 150.0, product.Price)
+	//after it the markdown is cleared
+	require.True(t, product.applySaleSchedule(endsAt.Add(time.Second)))
+	require.Equal(t, 200.0, product.Price)
+	require.Equal(t, 0.0, product.SalePrice)
+	require.False(t, product.OnSale)
+
+	from, to = (&PriceRule{StartsAt: startsAt}).saleWindow()
+	require.Equal(t, startsAt, from)
+	require.True(t, to.IsZero())
+}
+
+func TestPriceRulePrecedence(t *testing.T) {
+	ownSaleFrom := time.Date(2019, time.October, 1, 0, 0, 0, 0, time.UTC)
+	ownSaleTo := ownSaleFrom.AddDate(0, 3, 0)
+	older := &PriceRule{Percentage: 10, StartsAt: ownSaleFrom.AddDate(0, 1, 0)}
+	newer := &PriceRule{Percentage: 30, StartsAt: ownSaleFrom.AddDate(0, 1, 1)}
+
+	//a rule takes the place of the product's own sale, remembering it
+	first := older.item(100, 95, ownSaleFrom, ownSaleTo)
+	require.Equal(t, 90.0, first.SalePrice)
+	//a newer rule takes the place of the older one
+	second := newer.item(100, first.SalePrice, older.StartsAt, time.Time{})
+	require.Equal(t, 70.0, second.SalePrice)
+	require.Equal(t, 90.0, second.PreviousSalePrice)
+
+	//rolling back the older rule leaves the newer markdown in place
+	_, _, _, ok := first.previousSale(second.SalePrice)
+	require.False(t, ok)
+	//rolling back the newer rule puts back what it replaced
+	salePrice, from, to, ok := second.previousSale(second.SalePrice)
+	require.True(t, ok)
+	require.Equal(t, 90.0, salePrice)
+	require.Equal(t, older.StartsAt, from)
+	require.True(t, to.IsZero())
+	//and rolling back the older one then puts back the product's own sale
+	salePrice, from, to, ok = first.previousSale(salePrice)
+	require.True(t, ok)
+	require.Equal(t, 95.0, salePrice)
+	require.Equal(t, ownSaleFrom, from)
+	require.Equal(t, ownSaleTo, to)
+}
+
+func TestCurrentPrice(t *testing.T) {
+	now := time.Date(2019, time.November, 1, 0, 0, 0, 0, time.UTC)
+	price, onSale := currentPrice(100, 80, time.Time{}, time.Time{}, now)
+	require.Equal(t, 80.0, price)
+	require.True(t, onSale)
+
+	price, onSale = currentPrice(100, 80, now.Add(time.Hour), time.Time{}, now)
+	require.Equal(t, 100.0, price)
+	require.False(t, onSale)
+
+	price, _ = currentPrice(100, 80, time.Time{}, now.Add(-time.Hour), now)
+	require.Equal(t, 100.0, price)
+	price, _ = currentPrice(100, 0, time.Time{}, time.Time{}, now)
+	require.Equal(t, 100.0, price)
+}
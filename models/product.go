@@ -33,6 +33,13 @@ const (
 	ProductTypeVariable ProductType = "variable"
 )
 
+// List of values that a product's stock status can take.
+const (
+	ProductStockStatusInStock     = "instock"
+	ProductStockStatusOutOfStock  = "outofstock"
+	ProductStockStatusOnBackorder = "onbackorder"
+)
+
 // Product represents a product.
 type Product struct {
 	ID                primitive.ObjectID   `json:"id,omitempty" bson:"_id,omitempty"`
@@ -89,6 +96,7 @@ type Product struct {
 	ReviewsAllowed    bool                 `json:"reviewsAllowed" bson:"reviewsAllowed"`
 	AverageRating     string               `json:"averageRating" bson:"averageRating"`
 	RatingCount       int                  `json:"ratingCount" bson:"ratingCount"`
+	RatingHistogram   []ProductRatingCount `json:"ratingHistogram" bson:"ratingHistogram"`
 	RelatedIds        []string             `json:"relatedIds" bson:"relatedIds"`
 	UpsellIds         []string             `json:"upsellIds" bson:"upsellIds"`
 	CrossSellIds      []string             `json:"crossSellIds" bson:"crossSellIds"`
@@ -118,6 +126,7 @@ func CreateProduct(product Product) (*Product, error) {
 	product.CreatedAt = time.Now()
 	product.UpdatedAt = time.Now()
 	product.ID = primitive.NewObjectID()
+	product.applySaleSchedule(time.Now())
 	db := database.MongoDB
 	installationCollection := db.Collection(ProductsCollection)
 	ctx := context.Background()
@@ -127,6 +136,7 @@ func CreateProduct(product Product) (*Product, error) {
 		return nil, err
 	}
 	go webhooks.NewWebhookEvent("product.created", &product)
+	go reindexProduct(product)
 	cacheClient := cache.RedisClient
 	//set cache item
 	err = cacheClient.Set(product.ID.Hex(), product, DefaultRedisCacheTime).Err()
@@ -210,6 +220,7 @@ ctx := context.Background()
 func UpdateProduct(p *Product) (*Product, error) {
 	product := p
 	product.UpdatedAt = time.Now()
+	product.applySaleSchedule(time.Now())
 	filter := bson.D{{"_id", product.ID}}
 	db := database.MongoDB
 	productsCollection := db.Collection(ProductsCollection)
@@ -220,6 +231,7 @@ func UpdateProduct(p *Product) (*Product, error) {
 		log.Error(err)
 	}
 	go webhooks.NewWebhookEvent("product.updated", &product)
+	go reindexProduct(*product)
 	//Update cache item
 	cacheClient := cache.RedisClient
 	err = cacheClient.Del(product.ID.Hex()).Err()
@@ -244,6 +256,12 @@ func DeleteProductByID(ID string) (bool, error) {
 		return false, nil
 	}
 	go webhooks.NewWebhookEvent("product.deleted", &res)
+	go func() {
+		err := RemoveProductFromIndex(id)
+		if err != nil {
+			log.Errorln(err)
+		}
+	}()
 	//Delete cache item
 	cacheClient := cache.RedisClient
 	err = cacheClient.Del(ID).Err()
@@ -253,6 +271,51 @@ func DeleteProductByID(ID string) (bool, error) {
 	return true, nil
 }
 
+// AdjustProductStock atomically changes the stock quantity of a stock managed product or its variation by delta.
+func AdjustProductStock(productID primitive.ObjectID, variationID *primitive.ObjectID, delta int) error {
+	db := database.MongoDB
+	collectionName := ProductsCollection
+	id := productID
+	if variationID != nil && !variationID.IsZero() {
+		collectionName = ProductVariationCollection
+		id = *variationID
+	}
+	filter := bson.D{{"_id", id}, {"manageStock", true}}
+	update := bson.D{{"$inc", bson.D{{"stockQuantity", delta}}}, {"$set", bson.D{{"updatedAt", time.Now()}}}}
+	findUpdOpts := &options.FindOneAndUpdateOptions{}
+	findUpdOpts.SetReturnDocument(options.After)
+	stock := struct {
+		StockQuantity int `bson:"stockQuantity"`
+	}{}
+	ctx := context.Background()
+	err := db.Collection(collectionName).FindOneAndUpdate(ctx, filter, update, findUpdOpts).Decode(&stock)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			//stock is not managed for this item
+			return nil
+		}
+		log.Errorln(err)
+		return err
+	}
+	stockStatus := ProductStockStatusInStock
+	if stock.StockQuantity <= 0 {
+		stockStatus = ProductStockStatusOutOfStock
+	}
+	_, err = db.Collection(collectionName).UpdateOne(ctx, bson.D{{"_id", id}}, bson.D{{"$set", bson.D{{"stockStatus", stockStatus}}}})
+	if err != nil {
+		log.Errorln(err)
+		return err
+	}
+	//Delete cache item
+	cacheClient := cache.RedisClient
+	err = cacheClient.Del(id.Hex()).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	go reindexProductByID(productID.Hex())
+	return nil
+}
+
 //UnmarshalBinary required for the redis cache to work
 func (product *Product) UnmarshalBinary(data []byte) error {
 	if err := json.Unmarshal(data, product); err != nil {
@@ -47,6 +47,7 @@ func CreateProductBrand(productBrand ProductBrand) (*ProductBrand, error) {
 		return nil, err
 	}
 	go webhooks.NewWebhookEvent("product_brand.created", &productBrand)
+	go reindexBrandProducts(productBrand.ID, productBrand.Relationships)
 	cacheClient := cache.RedisClient
 	//set cache item
 	err = cacheClient.Set(productBrand.ID.Hex(), productBrand, DefaultRedisCacheTime).Err()
@@ -137,6 +138,7 @@ func UpdateProductBrand(c *ProductBrand) (*ProductBrand, error) {
 		log.Error(err)
 	}
 	go webhooks.NewWebhookEvent("product_brand.updated", &productBrand)
+	go reindexBrandProducts(productBrand.ID, productBrand.Relationships)
 	//Update cache item
 	cacheClient := cache.RedisClient
 	err = cacheClient.Del(productBrand.ID.Hex()).Err()
@@ -162,6 +164,7 @@ func DeleteProductBrandByID(ID string) (bool, error) {
 		return false, nil
 	}
 	go webhooks.NewWebhookEvent("product_brand.deleted", &res)
+	go reindexBrandProducts(oID, nil)
 	//Delete cache item
 	cacheClient := cache.RedisClient
 	err = cacheClient.Del(ID).Err()
@@ -29,6 +29,7 @@ type ProductCategory struct {
 	Name         string             `json:"name" bson:"name"`
 	Slug         string             `json:"slug" bson:"slug"`
 	Parent       int                `json:"parent" bson:"parent"`
+	ParentID     primitive.ObjectID `json:"parentID" bson:"parentID,omitempty"`
 	Store        string             `json:"store" bson:"store"`
 	Description  string             `json:"description" bson:"description"`
 	DisplayOrder int                `json:"displayOrder" bson:"displayOrder"`
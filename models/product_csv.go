@@ -0,0 +1,955 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"github.com/tribehq/platform/lib/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Columns of the WooCommerce product CSV format.
+const (
+	productCSVType             = "Type"
+	productCSVSku              = "SKU"
+	productCSVName             = "Name"
+	productCSVPublished        = "Published"
+	productCSVFeatured         = "Is featured?"
+	productCSVVisibility       = "Visibility in catalog"
+	productCSVShortDescription = "Short description"
+	productCSVDescription      = "Description"
+	productCSVSaleFrom         = "Date sale price starts"
+	productCSVSaleTo           = "Date sale price ends"
+	productCSVTaxStatus        = "Tax status"
+	productCSVTaxClass         = "Tax class"
+	productCSVInStock          = "In stock?"
+	productCSVStock            = "Stock"
+	productCSVBackorders       = "Backorders allowed?"
+	productCSVSoldIndividually = "Sold individually?"
+	productCSVWeight           = "Weight"
+	productCSVLength           = "Length"
+	productCSVWidth            = "Width"
+	productCSVHeight           = "Height"
+	productCSVReviews          = "Allow customer reviews?"
+	productCSVPurchaseNote     = "Purchase note"
+	productCSVSalePrice        = "Sale price"
+	productCSVRegularPrice     = "Regular price"
+	productCSVCategories       = "Categories"
+	productCSVTags             = "Tags"
+	productCSVShippingClass    = "Shipping class"
+	productCSVImages           = "Images"
+	productCSVDownloadLimit    = "Download limit"
+	productCSVDownloadExpiry   = "Download expiry days"
+	productCSVParent           = "Parent"
+	productCSVGrouped          = "Grouped products"
+	productCSVUpsells          = "Upsells"
+	productCSVCrossSells       = "Cross-sells"
+	productCSVExternalURL      = "External URL"
+	productCSVButtonText       = "Button text"
+	productCSVPosition         = "Position"
+)
+
+// productCSVColumns is the column order of exported product CSV files, attribute and download columns follow.
+var productCSVColumns = []string{
+	productCSVType, productCSVSku, productCSVName, productCSVPublished, productCSVFeatured, productCSVVisibility,
+	productCSVShortDescription, productCSVDescription, productCSVSaleFrom, productCSVSaleTo, productCSVTaxStatus,
+	productCSVTaxClass, productCSVInStock, productCSVStock, productCSVBackorders, productCSVSoldIndividually,
+	productCSVWeight + " (kg)", productCSVLength + " (cm)", productCSVWidth + " (cm)", productCSVHeight + " (cm)",
+	productCSVReviews, productCSVPurchaseNote, productCSVSalePrice, productCSVRegularPrice, productCSVCategories,
+	productCSVTags, productCSVShippingClass, productCSVImages, productCSVDownloadLimit, productCSVDownloadExpiry,
+	productCSVParent, productCSVGrouped, productCSVUpsells, productCSVCrossSells, productCSVExternalURL,
+	productCSVButtonText, productCSVPosition,
+}
+
+var (
+	productCSVAttributeColumn = regexp.MustCompile(`^Attribute (\d+) (name|value\(s\)|visible|global|default)$`)
+	productCSVDownloadColumn  = regexp.MustCompile(`^Download (\d+) (name|URL)$`)
+	productCSVUnitSuffix      = regexp.MustCompile(`^(Weight|Length|Width|Height) \(.*\)$`)
+)
+
+var (
+	ErrEmptyProductCSV = errors.New("the csv file has no header row")
+)
+
+// productCSVRow is a row of a product CSV file by column.
+type productCSVRow struct {
+	line   int
+	values map[string]string
+}
+
+func (row *productCSVRow) has(column string) bool {
+	_, ok := row.values[column]
+	return ok
+}
+
+func (row *productCSVRow) get(column string) string {
+	return strings.TrimSpace(row.values[column])
+}
+
+// productCSVAttribute is an attribute of a product CSV row.
+type productCSVAttribute struct {
+	name         string
+	values       []string
+	visible      bool
+	global       bool
+	defaultValue string
+}
+
+// productCSVRecord is a validated row of a product CSV file.
+type productCSVRecord struct {
+	*productCSVRow
+	kind             ProductType
+	variation        bool
+	virtual          bool
+	downloadable     bool
+	sku              string
+	status           ProductStatus
+	featured         bool
+	saleFrom         time.Time
+	saleTo           time.Time
+	stockStatus      string
+	stock            int
+	backorders       string
+	soldIndividually bool
+	weight           float64
+	dimensions       ProductDimensions
+	reviewsAllowed   bool
+	salePrice        float64
+	regularPrice     float64
+	categories       [][]string
+	tags             []string
+	images           []string
+	downloadLimit    int
+	downloadExpiry   int
+	grouped          []string
+	upsells          []string
+	crossSells       []string
+	position         int
+	attributes       []productCSVAttribute
+	downloads        []ProductDownload
+}
+
+// readProductCSV gives the rows of a product CSV file.
+func readProductCSV(data []byte) ([]*productCSVRow, error) {
+	reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, ErrEmptyProductCSV
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, column := range header {
+		column = strings.TrimSpace(column)
+		if match := productCSVUnitSuffix.FindStringSubmatch(column); match != nil {
+			column = match[1]
+		}
+		header[i] = column
+	}
+	var rows []*productCSVRow
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		row := &productCSVRow{line: line, values: map[string]string{}}
+		empty := true
+		for i, value := range record {
+			if i < len(header) {
+				row.values[header[i]] = value
+				empty = empty && strings.TrimSpace(value) == ""
+			}
+		}
+		if !empty {
+			rows = append(rows, row)
+		}
+	}
+	return rows, nil
+}
+
+// parseProductCSVRow validates a product CSV row.
+func parseProductCSVRow(row *productCSVRow) (*productCSVRecord, []*ProductImportRowError) {
+	record := &productCSVRecord{productCSVRow: row, sku: row.get(productCSVSku)}
+	var rowErrors []*ProductImportRowError
+	fail := func(column string, message string) {
+		rowErrors = append(rowErrors, &ProductImportRowError{Row: row.line, Sku: record.sku, Column: column, Message: message})
+	}
+	parseBool := func(column string) bool {
+		value, err := parseCSVBool(row.get(column))
+		if err != nil {
+			fail(column, "must be 1 or 0")
+		}
+		return value
+	}
+	parseFloat := func(column string) float64 {
+		if row.get(column) == "" {
+			return 0
+		}
+		value, err := strconv.ParseFloat(row.get(column), 64)
+		if err != nil || value < 0 {
+			fail(column, "must be a positive number")
+		}
+		return value
+	}
+	parseInt := func(column string) int {
+		if row.get(column) == "" {
+			return 0
+		}
+		value, err := strconv.Atoi(row.get(column))
+		if err != nil {
+			fail(column, "must be a whole number")
+		}
+		return value
+	}
+	parseDate := func(column string) time.Time {
+		if row.get(column) == "" {
+			return time.Time{}
+		}
+		value, err := parseCSVDate(row.get(column))
+		if err != nil {
+			fail(column, "must be a date like 2006-01-02")
+		}
+		return value
+	}
+
+	if record.sku == "" {
+		fail(productCSVSku, "is required, products are matched by SKU")
+	}
+	record.kind = ProductTypeSimple
+	for i, kind := range csvList(strings.ToLower(row.get(productCSVType))) {
+		switch {
+		case kind == "virtual":
+			record.virtual = true
+		case kind == "downloadable":
+			record.downloadable = true
+		case i > 0:
+			fail(productCSVType, "unknown product type "+kind)
+		case kind == "variation":
+			record.variation = true
+		case kind == string(ProductTypeSimple), kind == string(ProductTypeVariable), kind == string(ProductTypeGrouped), kind == string(ProductTypeExternal):
+			record.kind = ProductType(kind)
+		default:
+			fail(productCSVType, "unknown product type "+kind)
+		}
+	}
+	if record.variation && row.get(productCSVParent) == "" {
+		fail(productCSVParent, "is required for variations")
+	}
+
+	switch row.get(productCSVPublished) {
+	case "1", "":
+		record.status = ProductStatusPublish
+	case "0":
+		record.status = ProductStatusDraft
+	case "-1":
+		record.status = ProductStatusPrivate
+	default:
+		fail(productCSVPublished, "must be 1, 0 or -1")
+	}
+	switch strings.ToLower(row.get(productCSVVisibility)) {
+	case "", "visible", "catalog", "search", "hidden":
+	default:
+		fail(productCSVVisibility, "must be visible, catalog, search or hidden")
+	}
+	switch strings.ToLower(row.get(productCSVTaxStatus)) {
+	case "", "taxable", "shipping", "none":
+	default:
+		fail(productCSVTaxStatus, "must be taxable, shipping or none")
+	}
+	switch strings.ToLower(row.get(productCSVInStock)) {
+	case "1", "", "yes", "true":
+		record.stockStatus = ProductStockStatusInStock
+	case "0", "no", "false":
+		record.stockStatus = ProductStockStatusOutOfStock
+	case "backorder":
+		record.stockStatus = ProductStockStatusOnBackorder
+	default:
+		fail(productCSVInStock, "must be 1, 0 or backorder")
+	}
+	switch strings.ToLower(row.get(productCSVBackorders)) {
+	case "0", "", "no", "false":
+		record.backorders = "no"
+	case "1", "yes", "true":
+		record.backorders = "yes"
+	case "notify":
+		record.backorders = "notify"
+	default:
+		fail(productCSVBackorders, "must be 1, 0 or notify")
+	}
+
+	record.featured = parseBool(productCSVFeatured)
+	record.soldIndividually = parseBool(productCSVSoldIndividually)
+	record.reviewsAllowed = parseBool(productCSVReviews)
+	record.saleFrom = parseDate(productCSVSaleFrom)
+	record.saleTo = parseDate(productCSVSaleTo)
+	if !record.saleTo.IsZero() {
+		//sales run through the whole of their last day
+		record.saleTo = record.saleTo.AddDate(0, 0, 1).Add(-time.Second)
+	}
+	record.stock = parseInt(productCSVStock)
+	record.weight = parseFloat(productCSVWeight)
+	record.dimensions = ProductDimensions{Length: parseFloat(productCSVLength), Width: parseFloat(productCSVWidth), Height: parseFloat(productCSVHeight)}
+	record.salePrice = parseFloat(productCSVSalePrice)
+	record.regularPrice = parseFloat(productCSVRegularPrice)
+	record.downloadLimit = parseInt(productCSVDownloadLimit)
+	record.downloadExpiry = parseInt(productCSVDownloadExpiry)
+	record.position = parseInt(productCSVPosition)
+	if record.salePrice > 0 && record.salePrice > record.regularPrice {
+		fail(productCSVSalePrice, "must not be more than the regular price")
+	}
+	if !record.saleFrom.IsZero() && !record.saleTo.IsZero() && record.saleTo.Before(record.saleFrom) {
+		fail(productCSVSaleTo, "must not be before the sale start date")
+	}
+
+	for _, category := range csvList(row.get(productCSVCategories)) {
+		var categoryPath []string
+		for _, name := range strings.Split(category, ">") {
+			if name = strings.TrimSpace(name); name != "" {
+				categoryPath = append(categoryPath, name)
+			}
+		}
+		if len(categoryPath) > 0 {
+			record.categories = append(record.categories, categoryPath)
+		}
+	}
+	record.tags = csvList(row.get(productCSVTags))
+	record.images = csvList(row.get(productCSVImages))
+	record.grouped = csvList(row.get(productCSVGrouped))
+	record.upsells = csvList(row.get(productCSVUpsells))
+	record.crossSells = csvList(row.get(productCSVCrossSells))
+
+	attributes := map[int]*productCSVAttribute{}
+	downloads := map[int]*ProductDownload{}
+	var attributeNumbers, downloadNumbers []int
+	for column := range row.values {
+		if match := productCSVAttributeColumn.FindStringSubmatch(column); match != nil {
+			n, _ := strconv.Atoi(match[1])
+			attribute, ok := attributes[n]
+			if !ok {
+				attribute = &productCSVAttribute{visible: true, global: true}
+				attributes[n] = attribute
+				attributeNumbers = append(attributeNumbers, n)
+			}
+			switch match[2] {
+			case "name":
+				attribute.name = row.get(column)
+			case "value(s)":
+				attribute.values = csvList(row.get(column))
+			case "visible":
+				attribute.visible = row.get(column) == "" || parseBool(column)
+			case "global":
+				attribute.global = row.get(column) == "" || parseBool(column)
+			case "default":
+				attribute.defaultValue = row.get(column)
+			}
+		}
+		if match := productCSVDownloadColumn.FindStringSubmatch(column); match != nil {
+			n, _ := strconv.Atoi(match[1])
+			download, ok := downloads[n]
+			if !ok {
+				download = &ProductDownload{}
+				downloads[n] = download
+				downloadNumbers = append(downloadNumbers, n)
+			}
+			if match[2] == "name" {
+				download.Name = row.get(column)
+			} else {
+				download.File = row.get(column)
+			}
+		}
+	}
+	sort.Ints(attributeNumbers)
+	sort.Ints(downloadNumbers)
+	for _, n := range attributeNumbers {
+		attribute := attributes[n]
+		if attribute.name == "" {
+			if len(attribute.values) > 0 {
+				fail("Attribute "+strconv.Itoa(n)+" name", "is required with attribute values")
+			}
+			continue
+		}
+		record.attributes = append(record.attributes, *attribute)
+	}
+	for _, n := range downloadNumbers {
+		download := downloads[n]
+		if download.File == "" {
+			continue
+		}
+		if download.Name == "" {
+			download.Name = path.Base(download.File)
+		}
+		record.downloads = append(record.downloads, *download)
+	}
+	return record, rowErrors
+}
+
+// price gives the current price of the record, its sale price while the sale is on.
+func (record *productCSVRecord) price() (float64, bool) {
+	return currentPrice(record.regularPrice, record.salePrice, record.saleFrom, record.saleTo, time.Now())
+}
+
+// applyToProduct sets the fields of a product from the columns present in the record.
+func (record *productCSVRecord) applyToProduct(product *Product) {
+	product.Sku = record.sku
+	if record.has(productCSVType) {
+		product.Type = record.kind
+		product.Virtual = record.virtual
+		product.Downloadable = record.downloadable
+	}
+	if record.has(productCSVName) {
+		product.Name = record.get(productCSVName)
+	}
+	if record.has(productCSVPublished) {
+		product.Status = string(record.status)
+	}
+	if record.has(productCSVFeatured) {
+		product.IsFeatured = record.featured
+	}
+	if record.has(productCSVVisibility) {
+		product.CatalogVisibility = strings.ToLower(record.get(productCSVVisibility))
+	}
+	if record.has(productCSVShortDescription) {
+		product.ShortDescription = record.get(productCSVShortDescription)
+	}
+	if record.has(productCSVDescription) {
+		product.Description = record.get(productCSVDescription)
+	}
+	if record.has(productCSVSaleFrom) {
+		product.DateOnSaleFrom = record.saleFrom
+	}
+	if record.has(productCSVSaleTo) {
+		product.DateOnSaleTo = record.saleTo
+	}
+	if record.has(productCSVTaxStatus) {
+		product.TaxStatus = strings.ToLower(record.get(productCSVTaxStatus))
+	}
+	if record.has(productCSVTaxClass) {
+		product.TaxClass = record.get(productCSVTaxClass)
+	}
+	if record.has(productCSVInStock) {
+		product.StockStatus = record.stockStatus
+	}
+	if record.has(productCSVStock) {
+		product.ManageStock = record.get(productCSVStock) != ""
+		product.StockQuantity = record.stock
+	}
+	if record.has(productCSVBackorders) {
+		product.BackOrders = record.backorders
+		product.BackOrdersAllowed = record.backorders != "no"
+	}
+	if record.has(productCSVSoldIndividually) {
+		product.SoldIndividually = record.soldIndividually
+	}
+	if record.has(productCSVWeight) {
+		product.Weight = record.weight
+	}
+	if record.has(productCSVLength) || record.has(productCSVWidth) || record.has(productCSVHeight) {
+		product.Dimensions = record.dimensions
+	}
+	if record.has(productCSVReviews) {
+		product.ReviewsAllowed = record.reviewsAllowed
+	}
+	if record.has(productCSVPurchaseNote) {
+		product.PurchaseNote = record.get(productCSVPurchaseNote)
+	}
+	if record.has(productCSVSalePrice) {
+		product.SalePrice = record.salePrice
+	}
+	if record.has(productCSVRegularPrice) {
+		product.RegularPrice = record.regularPrice
+	}
+	if record.has(productCSVSalePrice) || record.has(productCSVRegularPrice) {
+		product.Price, product.OnSale = record.price()
+	}
+	if record.has(productCSVShippingClass) {
+		product.ShippingClass = record.get(productCSVShippingClass)
+	}
+	if record.has(productCSVImages) {
+		product.Images = []ProductImage{}
+		for _, src := range record.images {
+			product.Images = append(product.Images, ProductImage{ID: primitive.NewObjectID(), CreatedAt: time.Now(), UpdatedAt: time.Now(), Src: src, Name: path.Base(src)})
+		}
+	}
+	if record.has(productCSVDownloadLimit) {
+		product.DownloadLimit = record.downloadLimit
+	}
+	if record.has(productCSVDownloadExpiry) {
+		product.DownloadExpiry = record.downloadExpiry
+	}
+	if len(record.downloads) > 0 {
+		product.Downloads = record.downloads
+	}
+	if record.has(productCSVExternalURL) {
+		product.ExternalURL = record.get(productCSVExternalURL)
+	}
+	if record.has(productCSVButtonText) {
+		product.ButtonText = record.get(productCSVButtonText)
+	}
+	if record.has(productCSVPosition) {
+		product.MenuOrder = record.position
+	}
+	product.ShippingRequired = !product.Virtual
+	product.Purchasable = product.Status == string(ProductStatusPublish)
+}
+
+// applyToVariation sets the fields of a product variation from the columns present in the record.
+func (record *productCSVRecord) applyToVariation(variation *ProductVariation) {
+	variation.Sku = record.sku
+	if record.has(productCSVType) {
+		variation.Virtual = record.virtual
+		variation.Downloadable = record.downloadable
+	}
+	if record.has(productCSVPublished) {
+		variation.Status = record.status
+		variation.Purchasable = record.status == ProductStatusPublish
+	}
+	if record.has(productCSVDescription) {
+		variation.Description = record.get(productCSVDescription)
+	}
+	if record.has(productCSVSaleFrom) {
+		variation.DateOnSaleFrom = record.saleFrom
+	}
+	if record.has(productCSVSaleTo) {
+		variation.DateOnSaleTo = record.saleTo
+	}
+	if record.has(productCSVTaxStatus) {
+		variation.TaxStatus = strings.ToLower(record.get(productCSVTaxStatus))
+	}
+	if record.has(productCSVTaxClass) {
+		variation.TaxClass = record.get(productCSVTaxClass)
+	}
+	if record.has(productCSVInStock) {
+		variation.StockStatus = record.stockStatus
+	}
+	if record.has(productCSVStock) {
+		variation.ManageStock = record.get(productCSVStock) != ""
+		variation.StockQuantity = record.stock
+	}
+	if record.has(productCSVBackorders) {
+		variation.BackOrders = record.backorders
+		variation.BackOrdersAllowed = record.backorders != "no"
+	}
+	if record.has(productCSVWeight) {
+		variation.Weight = record.weight
+	}
+	if record.has(productCSVLength) || record.has(productCSVWidth) || record.has(productCSVHeight) {
+		variation.Dimensions = record.dimensions
+	}
+	if record.has(productCSVSalePrice) {
+		variation.SalePrice = record.salePrice
+	}
+	if record.has(productCSVRegularPrice) {
+		variation.RegularPrice = record.regularPrice
+	}
+	if record.has(productCSVSalePrice) || record.has(productCSVRegularPrice) {
+		variation.Price, variation.OnSale = record.price()
+	}
+	if record.has(productCSVShippingClass) {
+		variation.ShippingClass = record.get(productCSVShippingClass)
+	}
+	if record.has(productCSVImages) && len(record.images) > 0 {
+		src := record.images[0]
+		variation.Image = ProductImage{ID: primitive.NewObjectID(), CreatedAt: time.Now(), UpdatedAt: time.Now(), Src: src, Name: path.Base(src)}
+	}
+	if record.has(productCSVDownloadLimit) {
+		variation.DownloadLimit = record.downloadLimit
+	}
+	if record.has(productCSVDownloadExpiry) {
+		variation.DownloadExpiry = record.downloadExpiry
+	}
+	if len(record.downloads) > 0 {
+		variation.Downloads = record.downloads
+	}
+	if record.has(productCSVPosition) {
+		variation.MenuOrder = record.position
+	}
+}
+
+// ExportProductsCSV writes the products of a store and their variations in the WooCommerce product CSV format.
+func ExportProductsCSV(storeID string, w io.Writer) error {
+	ctx := context.Background()
+	cur, err := database.MongoDB.Collection(ProductsCollection).Find(ctx, bson.D{{"store", storeID}, {"deletedAt", bson.M{"$exists": false}}})
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+	var products []*Product
+	for cur.Next(ctx) {
+		product := &Product{}
+		if err = cur.Decode(&product); err != nil {
+			return err
+		}
+		products = append(products, product)
+	}
+	if err = cur.Err(); err != nil {
+		return err
+	}
+
+	type exportRow struct {
+		values     map[string]string
+		attributes []ProductAttribute
+		defaults   []ProductAttribute
+		downloads  []ProductDownload
+	}
+	var rows []exportRow
+	attributeColumns, downloadColumns := 0, 0
+	categoriesByID := map[primitive.ObjectID]*ProductCategory{}
+	parentCategory := func(id primitive.ObjectID) *ProductCategory {
+		if category, ok := categoriesByID[id]; ok {
+			return category
+		}
+		category := GetProductCategoryByID(id.Hex())
+		if category != nil && category.ID.IsZero() {
+			category = nil
+		}
+		categoriesByID[id] = category
+		return category
+	}
+	for _, product := range products {
+		kind := []string{string(product.Type)}
+		if product.Type == "" {
+			kind = []string{string(ProductTypeSimple)}
+		}
+		if product.Virtual {
+			kind = append(kind, "virtual")
+		}
+		if product.Downloadable {
+			kind = append(kind, "downloadable")
+		}
+		values := map[string]string{
+			productCSVType:             strings.Join(kind, ", "),
+			productCSVSku:              product.Sku,
+			productCSVName:             product.Name,
+			productCSVPublished:        csvPublished(ProductStatus(strings.ToUpper(product.Status))),
+			productCSVFeatured:         csvBool(product.IsFeatured),
+			productCSVVisibility:       product.CatalogVisibility,
+			productCSVShortDescription: product.ShortDescription,
+			productCSVDescription:      product.Description,
+			productCSVSaleFrom:         csvDate(product.DateOnSaleFrom),
+			productCSVSaleTo:           csvDate(product.DateOnSaleTo),
+			productCSVTaxStatus:        product.TaxStatus,
+			productCSVTaxClass:         product.TaxClass,
+			productCSVInStock:          csvStockStatus(product.StockStatus),
+			productCSVStock:            csvStock(product.ManageStock, product.StockQuantity),
+			productCSVBackorders:       csvBackorders(product.BackOrders),
+			productCSVSoldIndividually: csvBool(product.SoldIndividually),
+			productCSVWeight:           csvFloat(product.Weight),
+			productCSVLength:           csvFloat(product.Dimensions.Length),
+			productCSVWidth:            csvFloat(product.Dimensions.Width),
+			productCSVHeight:           csvFloat(product.Dimensions.Height),
+			productCSVReviews:          csvBool(product.ReviewsAllowed),
+			productCSVPurchaseNote:     product.PurchaseNote,
+			productCSVSalePrice:        csvFloat(product.SalePrice),
+			productCSVRegularPrice:     csvFloat(product.RegularPrice),
+			productCSVShippingClass:    product.ShippingClass,
+			productCSVDownloadLimit:    csvInt(product.DownloadLimit),
+			productCSVDownloadExpiry:   csvInt(product.DownloadExpiry),
+			productCSVGrouped:          csvJoin(productSkus(product.GroupedProducts)),
+			productCSVUpsells:          csvJoin(productSkus(objectIDs(product.UpsellIds))),
+			productCSVCrossSells:       csvJoin(productSkus(objectIDs(product.CrossSellIds))),
+			productCSVExternalURL:      product.ExternalURL,
+			productCSVButtonText:       product.ButtonText,
+			productCSVPosition:         strconv.Itoa(product.MenuOrder),
+		}
+		var categories, tags, images []string
+		for _, category := range product.Categories {
+			categories = append(categories, productCategoryPath(category, parentCategory))
+		}
+		for _, tag := range product.Tags {
+			tags = append(tags, tag.Name)
+		}
+		for _, image := range product.Images {
+			images = append(images, image.Src)
+		}
+		values[productCSVCategories] = csvJoin(categories)
+		values[productCSVTags] = csvJoin(tags)
+		values[productCSVImages] = csvJoin(images)
+		rows = append(rows, exportRow{values: values, attributes: product.Attributes, defaults: product.DefaultAttributes, downloads: product.Downloads})
+		attributeColumns = maxInt(attributeColumns, len(product.Attributes))
+		downloadColumns = maxInt(downloadColumns, len(product.Downloads))
+
+		variations, err := productVariationsOf(product.ID)
+		if err != nil {
+			return err
+		}
+		parent := product.Sku
+		if parent == "" {
+			parent = "id:" + product.ID.Hex()
+		}
+		for _, variation := range variations {
+			kind := []string{"variation"}
+			if variation.Virtual {
+				kind = append(kind, "virtual")
+			}
+			if variation.Downloadable {
+				kind = append(kind, "downloadable")
+			}
+			values := map[string]string{
+				productCSVType:           strings.Join(kind, ", "),
+				productCSVSku:            variation.Sku,
+				productCSVName:           product.Name,
+				productCSVPublished:      csvPublished(variation.Status),
+				productCSVDescription:    variation.Description,
+				productCSVSaleFrom:       csvDate(variation.DateOnSaleFrom),
+				productCSVSaleTo:         csvDate(variation.DateOnSaleTo),
+				productCSVTaxStatus:      variation.TaxStatus,
+				productCSVTaxClass:       variation.TaxClass,
+				productCSVInStock:        csvStockStatus(variation.StockStatus),
+				productCSVStock:          csvStock(variation.ManageStock, variation.StockQuantity),
+				productCSVBackorders:     csvBackorders(variation.BackOrders),
+				productCSVWeight:         csvFloat(variation.Weight),
+				productCSVLength:         csvFloat(variation.Dimensions.Length),
+				productCSVWidth:          csvFloat(variation.Dimensions.Width),
+				productCSVHeight:         csvFloat(variation.Dimensions.Height),
+				productCSVSalePrice:      csvFloat(variation.SalePrice),
+				productCSVRegularPrice:   csvFloat(variation.RegularPrice),
+				productCSVShippingClass:  variation.ShippingClass,
+				productCSVImages:         variation.Image.Src,
+				productCSVDownloadLimit:  csvInt(variation.DownloadLimit),
+				productCSVDownloadExpiry: csvInt(variation.DownloadExpiry),
+				productCSVParent:         parent,
+				productCSVPosition:       strconv.Itoa(variation.MenuOrder),
+			}
+			rows = append(rows, exportRow{values: values, attributes: variation.Attributes, downloads: variation.Downloads})
+			attributeColumns = maxInt(attributeColumns, len(variation.Attributes))
+			downloadColumns = maxInt(downloadColumns, len(variation.Downloads))
+		}
+	}
+
+	header := append([]string{}, productCSVColumns...)
+	for n := 1; n <= attributeColumns; n++ {
+		prefix := "Attribute " + strconv.Itoa(n) + " "
+		header = append(header, prefix+"name", prefix+"value(s)", prefix+"visible", prefix+"global", prefix+"default")
+	}
+	for n := 1; n <= downloadColumns; n++ {
+		prefix := "Download " + strconv.Itoa(n) + " "
+		header = append(header, prefix+"name", prefix+"URL")
+	}
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		record := make([]string, 0, len(header))
+		for _, column := range productCSVColumns {
+			if match := productCSVUnitSuffix.FindStringSubmatch(column); match != nil {
+				column = match[1]
+			}
+			record = append(record, row.values[column])
+		}
+		for n := 0; n < attributeColumns; n++ {
+			if n >= len(row.attributes) {
+				record = append(record, "", "", "", "", "")
+				continue
+			}
+			attribute := row.attributes[n]
+			defaultValue := ""
+			for _, defaultAttribute := range row.defaults {
+				if defaultAttribute.Name == attribute.Name && len(defaultAttribute.Option) > 0 {
+					defaultValue = defaultAttribute.Option[0]
+				}
+			}
+			record = append(record, attribute.Name, csvJoin(attribute.Option), csvBool(attribute.Visible), csvBool(!attribute.ID.IsZero()), defaultValue)
+		}
+		for n := 0; n < downloadColumns; n++ {
+			if n >= len(row.downloads) {
+				record = append(record, "", "")
+				continue
+			}
+			record = append(record, row.downloads[n].Name, row.downloads[n].File)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// productCategoryPath gives the path of a category from its top category as written in product CSV files, "Clothing > Shirts".
+func productCategoryPath(category ProductCategory, parentOf func(id primitive.ObjectID) *ProductCategory) string {
+	path := []string{category.Name}
+	seen := map[primitive.ObjectID]bool{category.ID: true}
+	for parentID := category.ParentID; !parentID.IsZero() && !seen[parentID]; {
+		parent := parentOf(parentID)
+		if parent == nil {
+			break
+		}
+		seen[parentID] = true
+		path = append([]string{parent.Name}, path...)
+		parentID = parent.ParentID
+	}
+	return strings.Join(path, " > ")
+}
+
+// productSkus gives the SKUs of products, products without one are given by id.
+func productSkus(ids []primitive.ObjectID) []string {
+	var skus []string
+	for _, id := range ids {
+		product := GetProductByID(id.Hex())
+		if product.ID.IsZero() {
+			continue
+		}
+		if product.Sku != "" {
+			skus = append(skus, product.Sku)
+		} else {
+			skus = append(skus, "id:"+product.ID.Hex())
+		}
+	}
+	return skus
+}
+
+func objectIDs(hexes []string) []primitive.ObjectID {
+	var ids []primitive.ObjectID
+	for _, hex := range hexes {
+		if id, err := primitive.ObjectIDFromHex(hex); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// csvList splits a comma separated CSV value, commas escaped with a backslash are kept.
+func csvList(value string) []string {
+	var items []string
+	var item strings.Builder
+	escaped := false
+	flush := func() {
+		if text := strings.TrimSpace(item.String()); text != "" {
+			items = append(items, text)
+		}
+		item.Reset()
+	}
+	for _, r := range value {
+		switch {
+		case escaped:
+			item.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == ',':
+			flush()
+		default:
+			item.WriteRune(r)
+		}
+	}
+	flush()
+	return items
+}
+
+// csvJoin joins values into a comma separated CSV value, escaping their commas.
+func csvJoin(values []string) string {
+	escaped := make([]string, 0, len(values))
+	for _, value := range values {
+		escaped = append(escaped, strings.Replace(value, ",", `\,`, -1))
+	}
+	return strings.Join(escaped, ", ")
+}
+
+func parseCSVBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "1", "yes", "true":
+		return true, nil
+	case "0", "", "no", "false":
+		return false, nil
+	}
+	return false, strconv.ErrSyntax
+}
+
+func parseCSVDate(value string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04:05", time.RFC3339} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date, nil
+		}
+	}
+	return time.Time{}, strconv.ErrSyntax
+}
+
+func csvBool(value bool) string {
+	if value {
+		return "1"
+	}
+	return "0"
+}
+
+func csvFloat(value float64) string {
+	if value == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func csvInt(value int) string {
+	if value == 0 {
+		return ""
+	}
+	return strconv.Itoa(value)
+}
+
+func csvDate(value time.Time) string {
+	if value.IsZero() {
+		return ""
+	}
+	return value.Format("2006-01-02")
+}
+
+func csvPublished(status ProductStatus) string {
+	switch status {
+	case ProductStatusDraft, ProductStatusPending:
+		return "0"
+	case ProductStatusPrivate:
+		return "-1"
+	}
+	return "1"
+}
+
+func csvStockStatus(status string) string {
+	switch status {
+	case ProductStockStatusOutOfStock:
+		return "0"
+	case ProductStockStatusOnBackorder:
+		return "backorder"
+	}
+	return "1"
+}
+
+func csvStock(manageStock bool, quantity int) string {
+	if !manageStock {
+		return ""
+	}
+	return strconv.Itoa(quantity)
+}
+
+func csvBackorders(backorders string) string {
+	switch backorders {
+	case "yes":
+		return "1"
+	case "notify":
+		return "notify"
+	}
+	return "0"
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
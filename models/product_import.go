@@ -0,0 +1,622 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/database"
+	"github.com/tribehq/platform/utils/webhooks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	productImportProgressEvery = 25               // rows imported between progress updates
+	productImportMaxErrors     = 1000             // row errors kept on a job
+	productImportStaleAfter    = 15 * time.Minute // how long a queued or running job goes without progress before it is taken as interrupted
+)
+
+// ProductImportJob represents a product CSV import running in the background.
+type ProductImportJob struct {
+	ID            primitive.ObjectID       `json:"id,omitempty" bson:"_id,omitempty"`
+	CreatedAt     time.Time                `json:"createdAt" bson:"createdAt"`
+	UpdatedAt     time.Time                `json:"updatedAt" bson:"updatedAt"`
+	CreatedBy     primitive.ObjectID       `json:"createdBy" bson:"createdBy"`
+	Store         string                   `json:"store" bson:"store"`
+	FileName      string                   `json:"fileName" bson:"fileName"`
+	DryRun        bool                     `json:"dryRun" bson:"dryRun"`
+	Status        ProductImportJobStatus   `json:"status" bson:"status"`
+	TotalRows     int                      `json:"totalRows" bson:"totalRows"`
+	ProcessedRows int                      `json:"processedRows" bson:"processedRows"`
+	Created       int                      `json:"created" bson:"created"`
+	Updated       int                      `json:"updated" bson:"updated"`
+	Skipped       int                      `json:"skipped" bson:"skipped"`
+	Errors        []*ProductImportRowError `json:"errors" bson:"errors"`
+	Failure       string                   `json:"failure" bson:"failure"`
+	StartedAt     *time.Time               `json:"startedAt" bson:"startedAt"`
+	FinishedAt    *time.Time               `json:"finishedAt" bson:"finishedAt"`
+}
+
+// ProductImportRowError is a validation error of a row of an imported CSV file, the row is skipped.
+type ProductImportRowError struct {
+	Row     int    `json:"row" bson:"row"`
+	Sku     string `json:"sku" bson:"sku"`
+	Column  string `json:"column" bson:"column"`
+	Message string `json:"message" bson:"message"`
+}
+
+// CreateProductImportJob creates new product import job.
+func CreateProductImportJob(job ProductImportJob) (*ProductImportJob, error) {
+	job.CreatedAt = time.Now()
+	job.UpdatedAt = time.Now()
+	job.ID = primitive.NewObjectID()
+	job.Status = ProductImportJobStatusQueued
+	job.Errors = []*ProductImportRowError{}
+	db := database.MongoDB
+	collection := db.Collection(ProductImportJobsCollection)
+	ctx := context.Background()
+	_, err := collection.InsertOne(ctx, &job)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	go webhooks.NewWebhookEvent("product_import.created", &job)
+	return &job, nil
+}
+
+// GetProductImportJobByID gives product import job by id.
+// Jobs aren't cached as their progress keeps changing.
+func GetProductImportJobByID(ID string) (*ProductImportJob, error) {
+	db := database.MongoDB
+	job := &ProductImportJob{}
+	id, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.D{{"_id", id}}
+	ctx := context.Background()
+	err = db.Collection(ProductImportJobsCollection).FindOne(ctx, filter).Decode(&job)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	return job, nil
+}
+
+// GetProductImportJobs gives a list of product import jobs.
+func GetProductImportJobs(filter bson.D, limit int, after *string, before *string, first *int, last *int) (jobs []*ProductImportJob, totalCount int64, hasPrevious, hasNext bool, err error) {
+
+	db := database.MongoDB
+
+	tcint, filter, err := calcTotalCountWithQueryFilters(ProductImportJobsCollection, filter, after, before)
+	pagingInfo, err := PaginationUtility(after, before, first, last, &tcint)
+	if err != nil {
+		return
+	}
+	pagingInfo.QueryOpts.SetSort(bson.M{"_id": -1})
+
+	cur, err := db.Collection(ProductImportJobsCollection).Find(context.Background(), filter, &pagingInfo.QueryOpts)
+	if err != nil {
+		return
+	}
+	ctx := context.Background()
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		job := &ProductImportJob{}
+		err = cur.Decode(&job)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return
+			}
+			log.Errorln(err)
+		}
+		jobs = append(jobs, job)
+	}
+	if err = cur.Err(); err != nil {
+		return
+	}
+	return jobs, int64(tcint), pagingInfo.HasPreviousPage, pagingInfo.HasNextPage, nil
+}
+
+// saveProductImportJob stores the progress of a product import job.
+func saveProductImportJob(job *ProductImportJob) {
+	job.UpdatedAt = time.Now()
+	_, err := database.MongoDB.Collection(ProductImportJobsCollection).ReplaceOne(context.Background(), bson.D{{"_id", job.ID}}, job)
+	if err != nil {
+		log.Errorln(err)
+	}
+}
+
+// RecoverProductImportJobs fails the queued and running import jobs that stopped making progress,
+// their server went away before finishing and the uploaded file went with it.
+func RecoverProductImportJobs(now time.Time) (int, error) {
+	filter := bson.D{
+		{"status", bson.M{"$in": []ProductImportJobStatus{ProductImportJobStatusQueued, ProductImportJobStatusRunning}}},
+		{"updatedAt", bson.M{"$lt": now.Add(-productImportStaleAfter)}},
+	}
+	update := bson.D{{"$set", bson.D{
+		{"status", ProductImportJobStatusFailed},
+		{"failure", "import was interrupted, upload the file again"},
+		{"finishedAt", now},
+		{"updatedAt", now},
+	}}}
+	res, err := database.MongoDB.Collection(ProductImportJobsCollection).UpdateMany(context.Background(), filter, update)
+	if err != nil {
+		log.Errorln(err)
+		return 0, err
+	}
+	return int(res.ModifiedCount), nil
+}
+
+// RunProductImportRecovery fails interrupted product import jobs every interval.
+func RunProductImportRecovery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := RecoverProductImportJobs(time.Now()); err != nil {
+			log.Errorln(err)
+		}
+		<-ticker.C
+	}
+}
+
+// RunProductImport imports the products of a WooCommerce product CSV file into the job's store, upserting them by SKU.
+// Rows failing validation are skipped and reported on the job. Dry runs validate and count without saving anything.
+func RunProductImport(job *ProductImportJob, data []byte) {
+	startedAt := time.Now()
+	job.Status = ProductImportJobStatusRunning
+	job.StartedAt = &startedAt
+	saveProductImportJob(job)
+
+	rows, err := readProductCSV(data)
+	if err != nil {
+		finishedAt := time.Now()
+		job.Status = ProductImportJobStatusFailed
+		job.Failure = err.Error()
+		job.FinishedAt = &finishedAt
+		saveProductImportJob(job)
+		return
+	}
+	job.TotalRows = len(rows)
+	saveProductImportJob(job)
+
+	importer := &productImporter{
+		job:        job,
+		skus:       map[string]primitive.ObjectID{},
+		variations: map[string]bool{},
+		categories: map[string]ProductCategory{},
+		tags:       map[string]ProductTag{},
+		attributes: map[string]ProductAttribute{},
+	}
+	for i, row := range rows {
+		importer.importRow(row)
+		job.ProcessedRows = i + 1
+		if job.ProcessedRows%productImportProgressEvery == 0 {
+			saveProductImportJob(job)
+		}
+	}
+	importer.linkProducts()
+
+	finishedAt := time.Now()
+	job.Status = ProductImportJobStatusCompleted
+	job.FinishedAt = &finishedAt
+	saveProductImportJob(job)
+	go webhooks.NewWebhookEvent("product_import.completed", job)
+}
+
+// productImporter imports the rows of a product CSV file.
+type productImporter struct {
+	job        *ProductImportJob
+	skus       map[string]primitive.ObjectID // products of the file by SKU, ids are zero on dry runs
+	variations map[string]bool               // SKUs of the variations of the file
+	categories map[string]ProductCategory
+	tags       map[string]ProductTag
+	attributes map[string]ProductAttribute
+	links      []productImportLink
+}
+
+// productImportLink is a product referencing other products by SKU, linked once every row is imported.
+type productImportLink struct {
+	row        *productCSVRecord
+	productID  primitive.ObjectID
+	grouped    []string
+	upsells    []string
+	crossSells []string
+}
+
+func (importer *productImporter) fail(rowErrors ...*ProductImportRowError) {
+	for _, rowError := range rowErrors {
+		if len(importer.job.Errors) < productImportMaxErrors {
+			importer.job.Errors = append(importer.job.Errors, rowError)
+		}
+	}
+}
+
+func (importer *productImporter) importRow(row *productCSVRow) {
+	record, rowErrors := parseProductCSVRow(row)
+	if len(rowErrors) > 0 {
+		importer.fail(rowErrors...)
+		importer.job.Skipped++
+		return
+	}
+	if record.variation {
+		err := importer.importVariation(record)
+		if err != nil {
+			importer.fail(err)
+			importer.job.Skipped++
+		}
+		return
+	}
+	err := importer.importProduct(record)
+	if err != nil {
+		importer.fail(err)
+		importer.job.Skipped++
+	}
+}
+
+// importProduct creates or updates the product of a row by its SKU.
+func (importer *productImporter) importProduct(record *productCSVRecord) *ProductImportRowError {
+	job := importer.job
+	product, err := getStoreProductBySku(job.Store, record.sku)
+	if err != nil {
+		return record.error("", err.Error())
+	}
+	if product == nil && record.get(productCSVName) == "" {
+		return record.error(productCSVName, "is required for new products")
+	}
+	if importer.skuRepeated(record.sku) {
+		return record.error(productCSVSku, "is repeated in the file")
+	}
+
+	isNew := product == nil
+	if isNew {
+		product = &Product{Store: job.Store, CreatedBy: job.CreatedBy, IsActive: true, Type: ProductTypeSimple, Status: string(ProductStatusPublish), StockStatus: ProductStockStatusInStock}
+	}
+	record.applyToProduct(product)
+	if isNew && product.Slug == "" {
+		product.Slug = slugify(product.Name)
+	}
+	if record.has(productCSVCategories) {
+		product.Categories = []ProductCategory{}
+		for _, categoryPath := range record.categories {
+			category, err := importer.category(categoryPath)
+			if err != nil {
+				return record.error(productCSVCategories, err.Error())
+			}
+			product.Categories = append(product.Categories, category)
+		}
+	}
+	if record.has(productCSVTags) {
+		product.Tags = []ProductTag{}
+		for _, name := range record.tags {
+			tag, err := importer.tag(name)
+			if err != nil {
+				return record.error(productCSVTags, err.Error())
+			}
+			product.Tags = append(product.Tags, tag)
+		}
+	}
+	if len(record.attributes) > 0 {
+		product.Attributes, product.DefaultAttributes = nil, nil
+		for position, csvAttribute := range record.attributes {
+			attribute, err := importer.attribute(csvAttribute, position, product.Type == ProductTypeVariable)
+			if err != nil {
+				return record.error("", err.Error())
+			}
+			product.Attributes = append(product.Attributes, attribute)
+			if csvAttribute.defaultValue != "" {
+				product.DefaultAttributes = append(product.DefaultAttributes, ProductAttribute{ID: attribute.ID, Name: attribute.Name, Slug: attribute.Slug, Option: []string{csvAttribute.defaultValue}})
+			}
+		}
+	}
+
+	if !job.DryRun {
+		if isNew {
+			product, err = CreateProduct(*product)
+		} else {
+			product, err = UpdateProduct(product)
+		}
+		if err != nil {
+			return record.error("", err.Error())
+		}
+	}
+	importer.skus[record.sku] = product.ID
+	if len(record.grouped) > 0 || len(record.upsells) > 0 || len(record.crossSells) > 0 {
+		importer.links = append(importer.links, productImportLink{row: record, productID: product.ID, grouped: record.grouped, upsells: record.upsells, crossSells: record.crossSells})
+	}
+	if isNew {
+		job.Created++
+	} else {
+		job.Updated++
+	}
+	return nil
+}
+
+// importVariation creates or updates the variation of a row by its SKU under the row's parent product.
+func (importer *productImporter) importVariation(record *productCSVRecord) *ProductImportRowError {
+	job := importer.job
+	parentID, found, err := importer.productRef(record.get(productCSVParent))
+	if err != nil {
+		return record.error(productCSVParent, err.Error())
+	}
+	if !found {
+		return record.error(productCSVParent, "is not a product of the store or an earlier row")
+	}
+	if importer.skuRepeated(record.sku) {
+		return record.error(productCSVSku, "is repeated in the file")
+	}
+	variation, err := getStoreProductVariationBySku(job.Store, record.sku)
+	if err != nil {
+		return record.error("", err.Error())
+	}
+	if variation != nil && variation.ParentProductID != parentID.Hex() && !parentID.IsZero() {
+		return record.error(productCSVSku, "belongs to a variation of another product")
+	}
+
+	isNew := variation == nil
+	if isNew {
+		variation = &ProductVariation{ParentProductID: parentID.Hex(), CreatedBy: job.CreatedBy, Status: ProductStatusPublish, Purchasable: true, StockStatus: ProductStockStatusInStock, TaxClass: "parent"}
+	}
+	record.applyToVariation(variation)
+	if len(record.attributes) > 0 {
+		variation.Attributes = nil
+		for _, csvAttribute := range record.attributes {
+			attribute := ProductAttribute{Name: csvAttribute.name, Slug: slugify(csvAttribute.name), Option: csvAttribute.values}
+			if global, ok := importer.attributes[strings.ToLower(csvAttribute.name)]; ok {
+				attribute.ID, attribute.Slug = global.ID, global.Slug
+			}
+			variation.Attributes = append(variation.Attributes, attribute)
+		}
+	}
+
+	if !job.DryRun {
+		if isNew {
+			variation, err = CreateProductVariation(*variation)
+			if err != nil {
+				return record.error("", err.Error())
+			}
+			parent := GetProductByID(parentID.Hex())
+			if !parent.ID.IsZero() {
+				parent.Variations = append(parent.Variations, variation.ID)
+				if parent.Type != ProductTypeVariable {
+					parent.Type = ProductTypeVariable
+				}
+				_, err = UpdateProduct(parent)
+				if err != nil {
+					return record.error(productCSVParent, err.Error())
+				}
+			}
+		} else {
+			variation = UpdateProductVariation(variation)
+		}
+	}
+	importer.variations[record.sku] = true
+	if isNew {
+		job.Created++
+	} else {
+		job.Updated++
+	}
+	return nil
+}
+
+// skuRepeated tells whether a product or variation of an earlier row of the file has the SKU.
+func (importer *productImporter) skuRepeated(sku string) bool {
+	_, ok := importer.skus[sku]
+	return ok || importer.variations[sku]
+}
+
+// linkProducts sets the grouped products, upsells and cross-sells of the imported products once every row is imported.
+func (importer *productImporter) linkProducts() {
+	for _, link := range importer.links {
+		resolve := func(column string, refs []string) []primitive.ObjectID {
+			var ids []primitive.ObjectID
+			for _, ref := range refs {
+				id, found, err := importer.productRef(ref)
+				if err != nil || !found {
+					importer.fail(link.row.error(column, "unknown product "+ref))
+					continue
+				}
+				ids = append(ids, id)
+			}
+			return ids
+		}
+		grouped := resolve(productCSVGrouped, link.grouped)
+		upsells := resolve(productCSVUpsells, link.upsells)
+		crossSells := resolve(productCSVCrossSells, link.crossSells)
+		if importer.job.DryRun {
+			continue
+		}
+		product := GetProductByID(link.productID.Hex())
+		if product.ID.IsZero() {
+			continue
+		}
+		if link.row.has(productCSVGrouped) {
+			product.GroupedProducts = grouped
+		}
+		if link.row.has(productCSVUpsells) {
+			product.UpsellIds = hexIDs(upsells)
+		}
+		if link.row.has(productCSVCrossSells) {
+			product.CrossSellIds = hexIDs(crossSells)
+		}
+		_, err := UpdateProduct(product)
+		if err != nil {
+			importer.fail(link.row.error("", err.Error()))
+		}
+	}
+}
+
+// productRef resolves a product reference of a CSV file, either a SKU or id:<product id>, within the job's store.
+func (importer *productImporter) productRef(ref string) (primitive.ObjectID, bool, error) {
+	if strings.HasPrefix(ref, "id:") {
+		product := GetProductByID(strings.TrimPrefix(ref, "id:"))
+		if product.ID.IsZero() || product.Store != importer.job.Store {
+			return primitive.NilObjectID, false, nil
+		}
+		return product.ID, true, nil
+	}
+	if id, ok := importer.skus[ref]; ok {
+		return id, true, nil
+	}
+	product, err := getStoreProductBySku(importer.job.Store, ref)
+	if err != nil || product == nil {
+		return primitive.NilObjectID, false, err
+	}
+	return product.ID, true, nil
+}
+
+// category gives the category at the end of a category path of the store, creating the missing categories of the path.
+func (importer *productImporter) category(categoryPath []string) (ProductCategory, error) {
+	var category ProductCategory
+	for i, name := range categoryPath {
+		key := strings.ToLower(strings.Join(categoryPath[:i+1], ">"))
+		if cached, ok := importer.categories[key]; ok {
+			category = cached
+			continue
+		}
+		slug := slugify(strings.Join(categoryPath[:i+1], "-"))
+		existing := &ProductCategory{}
+		err := database.MongoDB.Collection(ProductCategoriesCollection).FindOne(context.Background(), bson.D{{"store", importer.job.Store}, {"slug", slug}}).Decode(&existing)
+		switch {
+		case err == nil:
+			category = *existing
+		case err != mongo.ErrNoDocuments:
+			return category, err
+		case importer.job.DryRun:
+			category = ProductCategory{Name: name, Slug: slug, Store: importer.job.Store, ParentID: category.ID, IsActive: true}
+		default:
+			created, err := CreateProductCategory(ProductCategory{CreatedBy: importer.job.CreatedBy, Name: name, Slug: slug, Store: importer.job.Store, ParentID: category.ID, IsActive: true})
+			if err != nil {
+				return category, err
+			}
+			category = *created
+		}
+		importer.categories[key] = category
+	}
+	return category, nil
+}
+
+// tag gives the product tag by its name, creating it when missing.
+func (importer *productImporter) tag(name string) (ProductTag, error) {
+	key := strings.ToLower(name)
+	if cached, ok := importer.tags[key]; ok {
+		return cached, nil
+	}
+	tag := &ProductTag{}
+	err := database.MongoDB.Collection(ProductTagCollection).FindOne(context.Background(), bson.D{{"slug", slugify(name)}}).Decode(&tag)
+	switch {
+	case err == nil:
+	case err != mongo.ErrNoDocuments:
+		return ProductTag{}, err
+	case importer.job.DryRun:
+		tag = &ProductTag{Name: name, Slug: slugify(name)}
+	default:
+		tag, err = CreateProductTag(ProductTag{CreatedBy: importer.job.CreatedBy, Name: name, Slug: slugify(name)})
+		if err != nil {
+			return ProductTag{}, err
+		}
+	}
+	importer.tags[key] = *tag
+	return *tag, nil
+}
+
+// attribute gives the product attribute of a CSV attribute, global attributes are looked up by name and created when missing.
+func (importer *productImporter) attribute(csvAttribute productCSVAttribute, position int, variation bool) (ProductAttribute, error) {
+	attribute := ProductAttribute{
+		Name:      csvAttribute.name,
+		Slug:      slugify(csvAttribute.name),
+		Type:      "select",
+		Position:  position,
+		Visible:   csvAttribute.visible,
+		Variation: variation,
+		Option:    csvAttribute.values,
+	}
+	if !csvAttribute.global {
+		return attribute, nil
+	}
+	key := strings.ToLower(csvAttribute.name)
+	global, ok := importer.attributes[key]
+	if !ok {
+		existing := &ProductAttribute{}
+		err := database.MongoDB.Collection(productAttributeCollection).FindOne(context.Background(), bson.D{{"slug", "pa_" + attribute.Slug}}).Decode(&existing)
+		switch {
+		case err == nil:
+			global = *existing
+		case err != mongo.ErrNoDocuments:
+			return attribute, err
+		case importer.job.DryRun:
+			global = ProductAttribute{Name: attribute.Name, Slug: "pa_" + attribute.Slug}
+		default:
+			created, err := CreateProductAttribute(ProductAttribute{CreatedBy: importer.job.CreatedBy, Name: attribute.Name, Slug: "pa_" + attribute.Slug, Type: "select", OrderBy: "menu_order", Visible: true})
+			if err != nil {
+				return attribute, err
+			}
+			global = *created
+		}
+		importer.attributes[key] = global
+	}
+	attribute.ID, attribute.Slug = global.ID, global.Slug
+	return attribute, nil
+}
+
+func (record *productCSVRecord) error(column string, message string) *ProductImportRowError {
+	return &ProductImportRowError{Row: record.line, Sku: record.sku, Column: column, Message: message}
+}
+
+// getStoreProductBySku gives the product of a store by its SKU.
+func getStoreProductBySku(storeID string, sku string) (*Product, error) {
+	product := &Product{}
+	filter := bson.D{{"store", storeID}, {"sku", sku}, {"deletedAt", bson.M{"$exists": false}}}
+	err := database.MongoDB.Collection(ProductsCollection).FindOne(context.Background(), filter).Decode(&product)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	return product, nil
+}
+
+// getStoreProductVariationBySku gives the variation of a product of a store by its SKU.
+func getStoreProductVariationBySku(storeID string, sku string) (*ProductVariation, error) {
+	ctx := context.Background()
+	filter := bson.D{{"sku", sku}, {"deletedAt", bson.M{"$exists": false}}}
+	cur, err := database.MongoDB.Collection(ProductVariationCollection).Find(ctx, filter)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	//SKUs are unique within a store only, so the variation is the one whose product is the store's
+	for cur.Next(ctx) {
+		variation := &ProductVariation{}
+		err = cur.Decode(&variation)
+		if err != nil {
+			log.Errorln(err)
+			continue
+		}
+		parent := GetProductByID(variation.ParentProductID)
+		if parent != nil && !parent.ID.IsZero() && parent.Store == storeID {
+			return variation, nil
+		}
+	}
+	return nil, cur.Err()
+}
+
+var slugSeparators = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slugify gives the url slug of a name.
+func slugify(name string) string {
+	return strings.Trim(slugSeparators.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+)
+
+// parseTestProductCSV reads and validates the rows of a product CSV file.
+func parseTestProductCSV(t *testing.T, data string) []*productCSVRecord {
+	rows, err := readProductCSV([]byte(data))
+	require.NoError(t, err)
+	var records []*productCSVRecord
+	for _, row := range rows {
+		record, rowErrors := parseProductCSVRow(row)
+		require.Empty(t, rowErrors)
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestParseProductCSVCategories(t *testing.T) {
+	records := parseTestProductCSV(t, "Type,SKU,Name,Categories\n"+
+		"simple,SHIRT-1,Shirt,\"Clothing > Shirts, Sale\"\n")
+	require.Equal(t, [][]string{{"Clothing", "Shirts"}, {"Sale"}}, records[0].categories)
+}
+
+func TestProductCategoryPath(t *testing.T) {
+	clothing := &ProductCategory{ID: primitive.NewObjectID(), Name: "Clothing"}
+	shirts := &ProductCategory{ID: primitive.NewObjectID(), Name: "Shirts", ParentID: clothing.ID}
+	formal := ProductCategory{ID: primitive.NewObjectID(), Name: "Formal", ParentID: shirts.ID}
+	categories := map[primitive.ObjectID]*ProductCategory{clothing.ID: clothing, shirts.ID: shirts}
+	parentOf := func(id primitive.ObjectID) *ProductCategory {
+		return categories[id]
+	}
+
+	require.Equal(t, "Clothing > Shirts > Formal", productCategoryPath(formal, parentOf))
+	require.Equal(t, "Clothing", productCategoryPath(*clothing, parentOf))
+
+	//the exported path reads back as the same category path
+	records := parseTestProductCSV(t, "Type,SKU,Name,Categories\nsimple,S1,Shirt,"+productCategoryPath(formal, parentOf)+"\n")
+	require.Equal(t, [][]string{{"Clothing", "Shirts", "Formal"}}, records[0].categories)
+
+	//a category whose parent is gone starts the path
+	delete(categories, clothing.ID)
+	require.Equal(t, "Shirts > Formal", productCategoryPath(formal, parentOf))
+}
+
+func TestProductImportRejectsRepeatedVariationSkus(t *testing.T) {
+	records := parseTestProductCSV(t, "Type,SKU,Name,Parent\n"+
+		"variation,SHIRT-S,Small,SHIRT\n"+
+		"variation,SHIRT-S,Small again,SHIRT\n"+
+		"variation,SHIRT,Same as product,SHIRT\n")
+	importer := &productImporter{
+		job:        &ProductImportJob{Store: primitive.NewObjectID().Hex(), DryRun: true},
+		skus:       map[string]primitive.ObjectID{"SHIRT": primitive.NilObjectID},
+		variations: map[string]bool{"SHIRT-S": true},
+	}
+
+	for _, record := range records[1:] {
+		rowError := importer.importVariation(record)
+		require.NotNil(t, rowError)
+		require.Equal(t, productCSVSku, rowError.Column)
+		require.Equal(t, "is repeated in the file", rowError.Message)
+	}
+	require.True(t, importer.skuRepeated("SHIRT-S"))
+	require.False(t, importer.skuRepeated("SHIRT-M"))
+}
@@ -0,0 +1,190 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"time"
+)
+
+// currentPrice gives the price a product sells at, its sale price while the sale is on.
+// Sales without a start run from now and sales without an end never run out.
+func currentPrice(regularPrice float64, salePrice float64, from time.Time, to time.Time, now time.Time) (float64, bool) {
+	onSale := salePrice > 0 &&
+		(from.IsZero() || !now.Before(from)) &&
+		(to.IsZero() || !now.After(to))
+	if onSale {
+		return salePrice, true
+	}
+	return regularPrice, false
+}
+
+// priceHTML gives the price markup shown in stores, striking out the regular price during a sale.
+func priceHTML(regularPrice float64, price float64, onSale bool) string {
+	if onSale && price < regularPrice {
+		return fmt.Sprintf(`<del><span class="amount">%.2f</span></del> <ins><span class="amount">%.2f</span></ins>`, regularPrice, price)
+	}
+	return fmt.Sprintf(`<span class="amount">%.2f</span>`, price)
+}
+
+// applySaleSchedule brings the price and sale flag of a product in line with its sale schedule, clearing sales that ran out.
+// Variable products and products without a regular price are left as they are. It tells whether anything changed.
+func (product *Product) applySaleSchedule(now time.Time) bool {
+	if product.Type == ProductTypeVariable || product.RegularPrice <= 0 {
+		return false
+	}
+	changed := false
+	if !product.DateOnSaleTo.IsZero() && now.After(product.DateOnSaleTo) {
+		product.SalePrice = 0
+		product.DateOnSaleFrom = time.Time{}
+		product.DateOnSaleTo = time.Time{}
+		changed = true
+	}
+	price, onSale := currentPrice(product.RegularPrice, product.SalePrice, product.DateOnSaleFrom, product.DateOnSaleTo, now)
+	html := priceHTML(product.RegularPrice, price, onSale)
+	if price != product.Price || onSale != product.OnSale || html != product.PriceHTML {
+		product.Price, product.OnSale, product.PriceHTML = price, onSale, html
+		changed = true
+	}
+	return changed
+}
+
+// applySaleSchedule brings the price and sale flag of a variation in line with its sale schedule, clearing sales that ran out.
+func (productVariation *ProductVariation) applySaleSchedule(now time.Time) bool {
+	if productVariation.RegularPrice <= 0 {
+		return false
+	}
+	changed := false
+	if !productVariation.DateOnSaleTo.IsZero() && now.After(productVariation.DateOnSaleTo) {
+		productVariation.SalePrice = 0
+		productVariation.DateOnSaleFrom = time.Time{}
+		productVariation.DateOnSaleTo = time.Time{}
+		changed = true
+	}
+	price, onSale := currentPrice(productVariation.RegularPrice, productVariation.SalePrice, productVariation.DateOnSaleFrom, productVariation.DateOnSaleTo, now)
+	if price != productVariation.Price || onSale != productVariation.OnSale {
+		productVariation.Price, productVariation.OnSale = price, onSale
+		changed = true
+	}
+	return changed
+}
+
+// refreshVariableProductPrice prices a variable product from its cheapest variation, on sale while any variation is.
+// It tells whether the product was updated.
+func refreshVariableProductPrice(productID string) (bool, error) {
+	product := GetProductByID(productID)
+	if product.ID.IsZero() || product.Type != ProductTypeVariable {
+		return false, nil
+	}
+	variations, err := productVariationsOf(product.ID)
+	if err != nil || len(variations) == 0 {
+		return false, err
+	}
+	price, regularPrice, onSale := variations[0].Price, variations[0].RegularPrice, false
+	for _, variation := range variations {
+		if variation.Price < price {
+			price, regularPrice = variation.Price, variation.RegularPrice
+		}
+		onSale = onSale || variation.OnSale
+	}
+	html := priceHTML(regularPrice, price, onSale)
+	if price == product.Price && onSale == product.OnSale && html == product.PriceHTML {
+		return false, nil
+	}
+	product.Price, product.OnSale, product.PriceHTML = price, onSale, html
+	_, err = UpdateProduct(product)
+	return err == nil, err
+}
+
+// syncVariationParent refreshes the price and search entry of the product a variation belongs to.
+func syncVariationParent(productID string) {
+	updated, err := refreshVariableProductPrice(productID)
+	if err != nil {
+		log.Errorln(err)
+	}
+	if !updated {
+		reindexProductByID(productID)
+	}
+}
+
+// saleScheduleDueFilter matches the items whose sale starts or ends by a time without having been switched yet.
+func saleScheduleDueFilter(now time.Time) bson.D {
+	return bson.D{
+		{"deletedAt", bson.M{"$exists": false}},
+		{"regularPrice", bson.M{"$gt": 0}},
+		{"$or", bson.A{
+			bson.D{{"onSale", false}, {"salePrice", bson.M{"$gt": 0}}, {"dateOnSaleFrom", bson.M{"$lte": now}},
+				{"$or", bson.A{bson.D{{"dateOnSaleTo", time.Time{}}}, bson.D{{"dateOnSaleTo", bson.M{"$gte": now}}}}}},
+			bson.D{{"dateOnSaleTo", bson.M{"$gt": time.Time{}, "$lt": now}}},
+		}},
+	}
+}
+
+// SyncScheduledSales starts and ends the sales of products and variations that are due, keeping their prices, sale flags and search entries in sync.
+// It gives the number of products and variations switched.
+func SyncScheduledSales(now time.Time) (int, error) {
+	db := database.MongoDB
+	ctx := context.Background()
+	switched := 0
+
+	cur, err := db.Collection(ProductsCollection).Find(ctx, saleScheduleDueFilter(now))
+	if err != nil {
+		return switched, err
+	}
+	var products []*Product
+	err = cur.All(ctx, &products)
+	if err != nil {
+		return switched, err
+	}
+	for _, product := range products {
+		if !product.applySaleSchedule(now) {
+			continue
+		}
+		_, err = UpdateProduct(product)
+		if err != nil {
+			log.Errorln(err)
+			continue
+		}
+		switched++
+	}
+
+	cur, err = db.Collection(ProductVariationCollection).Find(ctx, saleScheduleDueFilter(now))
+	if err != nil {
+		return switched, err
+	}
+	var variations []*ProductVariation
+	err = cur.All(ctx, &variations)
+	if err != nil {
+		return switched, err
+	}
+	for _, variation := range variations {
+		if !variation.applySaleSchedule(now) {
+			continue
+		}
+		UpdateProductVariation(variation)
+		switched++
+	}
+	return switched, nil
+}
+
+// RunPriceScheduler switches scheduled sales and price rules as they fall due, checking every interval.
+func RunPriceScheduler(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		if _, err := SyncScheduledSales(now); err != nil {
+			log.Errorln(err)
+		}
+		if err := advancePriceRules(now); err != nil {
+			log.Errorln(err)
+		}
+		<-ticker.C
+	}
+}
@@ -21,23 +21,37 @@ import (
 
 //ProductReview represents product review.
 type ProductReview struct {
-	ID                 primitive.ObjectID `json:"id" bson:"_id"`
-	CreatedAt          time.Time          `json:"createdAt" bson:"createdAt"`
-	DeletedAt          *time.Time         `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
-	UpdatedAt          time.Time          `json:"updatedAt" bson:"updatedAt"`
-	CreatedBy          primitive.ObjectID `json:"createdBy" bson:"createdBy"`
-	ProductID          primitive.ObjectID `json:"productID" bson:"productID"`
-	Status             string             `json:"status" bson:"status"`
-	Reviewer           string             `json:"reviewer" bson:"reviewer"`
-	ReviewerEmail      string             `json:"reviewerEmail" bson:"reviewerEmail"`
-	Review             string             `json:"review" bson:"review"`
-	Rating             int                `json:"rating" bson:"rating"`
-	Verified           bool               `json:"verified" bson:"verified"`
-	ReviewerAvatarURLs ReviewerAvatarUrls `json:"reviewerAvatarURLs" bson:"reviewerAvatarURLs"`
+	ID                 primitive.ObjectID  `json:"id" bson:"_id"`
+	CreatedAt          time.Time           `json:"createdAt" bson:"createdAt"`
+	DeletedAt          *time.Time          `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	UpdatedAt          time.Time           `json:"updatedAt" bson:"updatedAt"`
+	CreatedBy          primitive.ObjectID  `json:"createdBy" bson:"createdBy"`
+	ProductID          primitive.ObjectID  `json:"productID" bson:"productID"`
+	Store              string              `json:"store" bson:"store"`
+	Status             ProductReviewStatus `json:"status" bson:"status"`
+	Reviewer           string              `json:"reviewer" bson:"reviewer"`
+	ReviewerEmail      string              `json:"reviewerEmail" bson:"reviewerEmail"`
+	Review             string              `json:"review" bson:"review"`
+	Rating             int                 `json:"rating" bson:"rating"`
+	Verified           bool                `json:"verified" bson:"verified"`
+	ReviewerAvatarURLs ReviewerAvatarUrls  `json:"reviewerAvatarURLs" bson:"reviewerAvatarURLs"`
+	ModeratedBy        *primitive.ObjectID `json:"moderatedBy" bson:"moderatedBy"`
+	ModeratedAt        *time.Time          `json:"moderatedAt" bson:"moderatedAt"`
 }
 
 // CreateProductReview creates new product review.
+// Reviews of buyers with a completed order for the product are marked verified and every review is screened for moderation.
 func CreateProductReview(productReview ProductReview) (*ProductReview, error) {
+	if productReview.Rating < 1 || productReview.Rating > 5 {
+		return nil, ErrInvalidReviewRating
+	}
+	product := GetProductByID(productReview.ProductID.Hex())
+	if product.ID.IsZero() {
+		return nil, ErrReviewProductNotFound
+	}
+	productReview.Store = product.Store
+	productReview.Verified = hasCompletedOrderFor(productReview.CreatedBy, product.ID)
+	productReview.Status = screenProductReview(&productReview)
 	productReview.CreatedAt = time.Now()
 	productReview.UpdatedAt = time.Now()
 	productReview.ID = primitive.NewObjectID()
@@ -50,6 +64,10 @@ func CreateProductReview(productReview ProductReview) (*ProductReview, error) {
 		return nil, err
 	}
 	go webhooks.NewWebhookEvent("product_review.created", &productReview)
+	go notifyNewProductReview(productReview, product)
+	if productReview.Status == ProductReviewStatusApproved {
+		go refreshProductRating(productReview.ProductID)
+	}
 	cacheClient := cache.RedisClient
 	//set cache item
 	err = cacheClient.Set(productReview.ID.Hex(), productReview, DefaultRedisCacheTime).Err()
@@ -105,7 +123,7 @@ func GetProductReviews(filter bson.D, limit int, after *string, before *string,
 	if err != nil {
 		return
 	}
-	pagingInfo.QueryOpts.SetSort(bson.M{"_id": 1})
+	pagingInfo.QueryOpts.SetSort(bson.M{"_id": -1})
 
 	cur, err := db.Collection(ProductReviewCollection).Find(context.Background(), filter, &pagingInfo.QueryOpts)
 	if err != nil {
@@ -127,7 +145,7 @@ ctx := context.Background()
 	if err = cur.Err(); err != nil {
 		return
 	}
-	return prodReviews, totalCount, pagingInfo.HasPreviousPage, pagingInfo.HasNextPage, nil
+	return prodReviews, int64(tcint), pagingInfo.HasPreviousPage, pagingInfo.HasNextPage, nil
 }
 
 // UpdateProductReview updates product review.
@@ -143,6 +161,7 @@ func UpdateProductReview(productReview *ProductReview) *ProductReview {
 		log.Error(err)
 	}
 	go webhooks.NewWebhookEvent("product_review.updated", &productReview)
+	go refreshProductRating(productReview.ProductID)
 	//Update cache item
 	cacheClient := cache.RedisClient
 	err = cacheClient.Del(productReview.ID.Hex()).Err()
@@ -155,7 +174,11 @@ func UpdateProductReview(productReview *ProductReview) *ProductReview {
 // DeleteProductReviewByID deletes product review by id.
 func DeleteProductReviewByID(ID string) (bool, error) {
 	db := database.MongoDB
-	filter := bson.D{{"_id", ID}}
+	id, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return false, err
+	}
+	filter := bson.D{{"_id", id}}
 	productReviewCollection := db.Collection(ProductReviewCollection)
 	res, err := productReviewCollection.UpdateOne(context.Background(), filter, bson.D{{"$set", bson.D{{"deletedAt", time.Now()}}}})
 	log.Warningln(res)
@@ -167,6 +190,13 @@ func DeleteProductReviewByID(ID string) (bool, error) {
 		return false, nil
 	}
 	go webhooks.NewWebhookEvent("product_review.deleted", &res)
+	go func() {
+		productReview := &ProductReview{}
+		err := productReviewCollection.FindOne(context.Background(), filter).Decode(&productReview)
+		if err == nil {
+			refreshProductRating(productReview.ProductID)
+		}
+	}()
 	//Delete cache item
 	cacheClient := cache.RedisClient
 	err = cacheClient.Del(ID).Err()
@@ -0,0 +1,824 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	productSearchMaxCorrections = 3 // indexed words tried in place of a misspelt query word
+	productSearchPriceBuckets   = 5
+	productSearchVocabularyTTL  = 10 * time.Minute // how long the indexed words are kept before they are loaded again
+)
+
+var (
+	productSearchIndexesMu    sync.Mutex
+	productSearchIndexesReady bool
+	productSearchVocabulary   = &searchVocabulary{}
+)
+
+// searchVocabulary holds the words of the visible products in the search index by their first letter,
+// misspelt query words are corrected against it instead of querying the index for every word.
+type searchVocabulary struct {
+	mu       sync.RWMutex
+	words    map[string]map[string]bool
+	loadedAt time.Time
+}
+
+// productSearchDocument is the search index entry of a product.
+// Terms holds the normalised words of every searchable field and is the vocabulary typos are corrected against.
+type productSearchDocument struct {
+	ID            primitive.ObjectID    `bson:"_id"`
+	Store         string                `bson:"store"`
+	Name          string                `bson:"name"`
+	Sku           []string              `bson:"sku"`
+	Tags          []string              `bson:"tags"`
+	Brands        []string              `bson:"brands"`
+	CategoryNames []string              `bson:"categoryNames"`
+	Description   string                `bson:"description"`
+	Terms         []string              `bson:"terms"`
+	Categories    []searchFacetRef      `bson:"categories"`
+	BrandRefs     []searchFacetRef      `bson:"brandRefs"`
+	Attributes    []searchAttributeTerm `bson:"attributes"`
+	Price         float64               `bson:"price"`
+	StockStatus   string                `bson:"stockStatus"`
+	Visible       bool                  `bson:"visible"`
+	UpdatedAt     time.Time             `bson:"updatedAt"`
+}
+
+type searchFacetRef struct {
+	ID   string `bson:"id"`
+	Name string `bson:"name"`
+}
+
+type searchAttributeTerm struct {
+	Name string `bson:"name"`
+	Term string `bson:"term"`
+}
+
+// ProductSearch is a page of product search results along with the facet counts of every matching product.
+type ProductSearch struct {
+	Hits           []*ProductSearchHit
+	TotalCount     int
+	Facets         *ProductSearchFacets
+	CorrectedQuery *string
+}
+
+// ProductSearchHit is a product matching a search and its relevance score.
+type ProductSearchHit struct {
+	Product *Product
+	Score   float64
+}
+
+// ProductSearchFacets represents the facet counts of a product search.
+type ProductSearchFacets struct {
+	Categories  []*SearchFacetValue `json:"categories"`
+	Brands      []*SearchFacetValue `json:"brands"`
+	Attributes  []*AttributeFacet   `json:"attributes"`
+	PriceRanges []*PriceRangeFacet  `json:"priceRanges"`
+	StockStatus []*SearchFacetValue `json:"stockStatus"`
+}
+
+// SearchFacetValue is the number of matching products having a facet value.
+type SearchFacetValue struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+	Count int    `json:"count"`
+}
+
+// AttributeFacet represents the counts of the terms of a product attribute.
+type AttributeFacet struct {
+	Name  string              `json:"name"`
+	Terms []*SearchFacetValue `json:"terms"`
+}
+
+// PriceRangeFacet is the number of matching products priced within a range.
+type PriceRangeFacet struct {
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Count int     `json:"count"`
+}
+
+// IndexProduct adds or refreshes the search index entry of a product, deleted products are removed from the index.
+func IndexProduct(product *Product) error {
+	if product == nil || product.ID.IsZero() {
+		return nil
+	}
+	ensureProductSearchIndexes()
+	collection := database.MongoDB.Collection(ProductSearchIndexCollection)
+	ctx := context.Background()
+	if product.DeletedAt != nil {
+		_, err := collection.DeleteOne(ctx, bson.D{{"_id", product.ID}})
+		return err
+	}
+	document, err := newProductSearchDocument(product)
+	if err != nil {
+		return err
+	}
+	_, err = collection.ReplaceOne(ctx, bson.D{{"_id", product.ID}}, document, options.Replace().SetUpsert(true))
+	if err != nil {
+		return err
+	}
+	if document.Visible {
+		productSearchVocabulary.add(document.Terms)
+	}
+	return nil
+}
+
+// RemoveProductFromIndex removes a product from the search index.
+func RemoveProductFromIndex(productID primitive.ObjectID) error {
+	_, err := database.MongoDB.Collection(ProductSearchIndexCollection).DeleteOne(context.Background(), bson.D{{"_id", productID}})
+	return err
+}
+
+// ReindexProducts rebuilds the search index from every product and gives the number of products indexed.
+func ReindexProducts() (int, error) {
+	startedAt := time.Now()
+	ctx := context.Background()
+	cur, err := database.MongoDB.Collection(ProductsCollection).Find(ctx, bson.D{{"deletedAt", bson.M{"$exists": false}}})
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(ctx)
+	count := 0
+	for cur.Next(ctx) {
+		product := &Product{}
+		err = cur.Decode(&product)
+		if err != nil {
+			log.Errorln(err)
+			continue
+		}
+		err = IndexProduct(product)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err = cur.Err(); err != nil {
+		return count, err
+	}
+	//drop entries of products that are gone
+	_, err = database.MongoDB.Collection(ProductSearchIndexCollection).DeleteMany(ctx, bson.D{{"updatedAt", bson.M{"$lt": startedAt}}})
+	return count, err
+}
+
+// SearchProducts gives the products matching a text query and filter ordered by relevance, along with the facet counts of all matches.
+// Query words are expanded with their synonyms and, when a word isn't indexed, with the indexed words within typo distance of it.
+// Without query words every product matching the filter is given in name order.
+func SearchProducts(query string, filter *ProductSearchFilter, offset int, limit int) (*ProductSearch, error) {
+	ensureProductSearchIndexes()
+	result := &ProductSearch{Facets: &ProductSearchFacets{}}
+	words := searchWords(query)
+	match := bson.D{}
+	if len(words) > 0 {
+		terms, corrected, err := expandSearchWords(query, words)
+		if err != nil {
+			return nil, err
+		}
+		match = append(match, bson.E{"$text", bson.M{"$search": strings.Join(terms, " ")}})
+		if corrected != "" {
+			result.CorrectedQuery = &corrected
+		}
+	}
+	match = append(match, productSearchFilter(filter)...)
+
+	collection := database.MongoDB.Collection(ProductSearchIndexCollection)
+	ctx := context.Background()
+	totalCount, err := collection.CountDocuments(ctx, match)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	result.TotalCount = int(totalCount)
+
+	findOpts := options.Find().SetSkip(int64(offset)).SetLimit(int64(limit))
+	if len(words) > 0 {
+		findOpts.SetProjection(bson.M{"_id": 1, "score": bson.M{"$meta": "textScore"}})
+		findOpts.SetSort(bson.D{{"score", bson.M{"$meta": "textScore"}}, {"_id", 1}})
+	} else {
+		findOpts.SetProjection(bson.M{"_id": 1})
+		findOpts.SetSort(bson.D{{"name", 1}, {"_id", 1}})
+	}
+	cur, err := collection.Find(ctx, match, findOpts)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		hit := struct {
+			ID    primitive.ObjectID `bson:"_id"`
+			Score float64            `bson:"score"`
+		}{}
+		err = cur.Decode(&hit)
+		if err != nil {
+			log.Errorln(err)
+			continue
+		}
+		product := GetProductByID(hit.ID.Hex())
+		if product.ID.IsZero() {
+			//product is gone, its entry is dropped on the next reindex
+			continue
+		}
+		result.Hits = append(result.Hits, &ProductSearchHit{Product: product, Score: hit.Score})
+	}
+	if err = cur.Err(); err != nil {
+		return nil, err
+	}
+
+	result.Facets, err = productSearchFacets(match)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// newProductSearchDocument gives the search index entry of a product along with its variations and brands.
+func newProductSearchDocument(product *Product) (*productSearchDocument, error) {
+	document := &productSearchDocument{
+		ID:          product.ID,
+		Store:       product.Store,
+		Name:        product.Name,
+		Description: strings.TrimSpace(product.ShortDescription + " " + product.Description),
+		Price:       product.Price,
+		StockStatus: product.StockStatus,
+		Visible:     productSearchable(product),
+		UpdatedAt:   time.Now(),
+	}
+	if product.Sku != "" {
+		document.Sku = append(document.Sku, product.Sku)
+	}
+	for _, tag := range product.Tags {
+		document.Tags = append(document.Tags, tag.Name)
+	}
+	for _, category := range product.Categories {
+		document.CategoryNames = append(document.CategoryNames, category.Name)
+		document.Categories = append(document.Categories, searchFacetRef{ID: category.ID.Hex(), Name: category.Name})
+	}
+	for _, attribute := range product.Attributes {
+		for _, option := range attribute.Option {
+			document.addAttributeTerm(attribute.Name, option)
+		}
+	}
+
+	brands, err := productBrandsOf(product.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, brand := range brands {
+		document.Brands = append(document.Brands, brand.Name)
+		document.BrandRefs = append(document.BrandRefs, searchFacetRef{ID: brand.ID.Hex(), Name: brand.Name})
+	}
+
+	variations, err := productVariationsOf(product.ID)
+	if err != nil {
+		return nil, err
+	}
+	inStock := false
+	for _, variation := range variations {
+		if variation.Sku != "" {
+			document.Sku = append(document.Sku, variation.Sku)
+		}
+		for _, attribute := range variation.Attributes {
+			for _, option := range attribute.Option {
+				document.addAttributeTerm(attribute.Name, option)
+			}
+		}
+		if variation.Price > 0 && (document.Price == 0 || variation.Price < document.Price) {
+			document.Price = variation.Price
+		}
+		inStock = inStock || variation.StockStatus != ProductStockStatusOutOfStock
+	}
+	if len(variations) > 0 {
+		//a variable product is available while any of its variations is
+		document.StockStatus = ProductStockStatusOutOfStock
+		if inStock {
+			document.StockStatus = ProductStockStatusInStock
+		}
+	}
+
+	fields := []string{document.Name, document.Description}
+	fields = append(fields, document.Sku...)
+	fields = append(fields, document.Tags...)
+	fields = append(fields, document.Brands...)
+	fields = append(fields, document.CategoryNames...)
+	seen := map[string]bool{}
+	for _, field := range fields {
+		for _, word := range searchWords(field) {
+			if !seen[word] {
+				seen[word] = true
+				document.Terms = append(document.Terms, word)
+			}
+		}
+	}
+	return document, nil
+}
+
+func (document *productSearchDocument) addAttributeTerm(name string, term string) {
+	for _, attributeTerm := range document.Attributes {
+		if attributeTerm.Name == name && attributeTerm.Term == term {
+			return
+		}
+	}
+	document.Attributes = append(document.Attributes, searchAttributeTerm{Name: name, Term: term})
+}
+
+// productSearchable tells whether a product is listed in shop searches.
+func productSearchable(product *Product) bool {
+	if !product.IsActive || product.ParentID != "" {
+		return false
+	}
+	switch strings.ToLower(product.Status) {
+	case "draft", "pending", "private", "inactive", "deleted":
+		return false
+	}
+	switch strings.ToLower(product.CatalogVisibility) {
+	case "hidden", "catalog":
+		return false
+	}
+	return true
+}
+
+// productBrandsOf gives the active brands listing the product in their relationships.
+func productBrandsOf(productID primitive.ObjectID) ([]*ProductBrand, error) {
+	var brands []*ProductBrand
+	filter := bson.D{{"relationships", productID.Hex()}, {"isActive", true}, {"deletedAt", bson.M{"$exists": false}}}
+	ctx := context.Background()
+	cur, err := database.MongoDB.Collection(ProductBrandCollection).Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		brand := &ProductBrand{}
+		err = cur.Decode(&brand)
+		if err != nil {
+			log.Errorln(err)
+			continue
+		}
+		brands = append(brands, brand)
+	}
+	return brands, cur.Err()
+}
+
+// productVariationsOf gives the variations of a product.
+func productVariationsOf(productID primitive.ObjectID) ([]*ProductVariation, error) {
+	var variations []*ProductVariation
+	filter := bson.D{{"parentProductID", productID.Hex()}, {"deletedAt", bson.M{"$exists": false}}}
+	ctx := context.Background()
+	cur, err := database.MongoDB.Collection(ProductVariationCollection).Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		variation := &ProductVariation{}
+		err = cur.Decode(&variation)
+		if err != nil {
+			log.Errorln(err)
+			continue
+		}
+		variations = append(variations, variation)
+	}
+	return variations, cur.Err()
+}
+
+// reindexProduct refreshes the search index entry of a product in the background.
+func reindexProduct(product Product) {
+	err := IndexProduct(&product)
+	if err != nil {
+		log.Errorln(err)
+	}
+}
+
+// reindexProductByID refreshes the search index entry of a product by its id.
+func reindexProductByID(ID string) {
+	product := GetProductByID(ID)
+	if product.ID.IsZero() {
+		id, err := primitive.ObjectIDFromHex(ID)
+		if err != nil {
+			return
+		}
+		err = RemoveProductFromIndex(id)
+		if err != nil {
+			log.Errorln(err)
+		}
+		return
+	}
+	reindexProduct(*product)
+}
+
+// reindexBrandProducts refreshes the search index entries of the products related to a brand, before and after its change.
+func reindexBrandProducts(brandID primitive.ObjectID, relationships []string) {
+	productIDs := map[string]bool{}
+	for _, productID := range relationships {
+		productIDs[productID] = true
+	}
+	ctx := context.Background()
+	cur, err := database.MongoDB.Collection(ProductSearchIndexCollection).Find(ctx, bson.D{{"brandRefs.id", brandID.Hex()}}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		entry := struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}{}
+		if err := cur.Decode(&entry); err == nil {
+			productIDs[entry.ID.Hex()] = true
+		}
+	}
+	for productID := range productIDs {
+		reindexProductByID(productID)
+	}
+}
+
+// productSearchFilter gives the search index query of a product search filter.
+func productSearchFilter(filter *ProductSearchFilter) bson.D {
+	query := bson.D{}
+	if filter == nil || filter.IncludeHidden == nil || !*filter.IncludeHidden {
+		query = append(query, bson.E{"visible", true})
+	}
+	if filter == nil {
+		return query
+	}
+	if filter.StoreID != nil {
+		query = append(query, bson.E{"store", filter.StoreID.Hex()})
+	}
+	if len(filter.Categories) > 0 {
+		query = append(query, bson.E{"categories.id", bson.M{"$in": hexIDs(filter.Categories)}})
+	}
+	if len(filter.Brands) > 0 {
+		query = append(query, bson.E{"brandRefs.id", bson.M{"$in": hexIDs(filter.Brands)}})
+	}
+	if len(filter.Attributes) > 0 {
+		var attributes bson.A
+		for _, attribute := range filter.Attributes {
+			attributes = append(attributes, bson.M{"attributes": bson.M{"$elemMatch": bson.M{"name": attribute.Name, "term": bson.M{"$in": attribute.Terms}}}})
+		}
+		query = append(query, bson.E{"$and", attributes})
+	}
+	price := bson.M{}
+	if filter.MinPrice != nil {
+		price["$gte"] = *filter.MinPrice
+	}
+	if filter.MaxPrice != nil {
+		price["$lte"] = *filter.MaxPrice
+	}
+	if len(price) > 0 {
+		query = append(query, bson.E{"price", price})
+	}
+	if len(filter.StockStatus) > 0 {
+		query = append(query, bson.E{"stockStatus", bson.M{"$in": filter.StockStatus}})
+	}
+	return query
+}
+
+func hexIDs(ids []primitive.ObjectID) []string {
+	hexes := make([]string, 0, len(ids))
+	for _, id := range ids {
+		hexes = append(hexes, id.Hex())
+	}
+	return hexes
+}
+
+// productSearchFacets counts the categories, brands, attribute terms, prices and stock statuses of the products matching a query.
+func productSearchFacets(match bson.D) (*ProductSearchFacets, error) {
+	refFacet := func(field string) bson.A {
+		return bson.A{
+			bson.D{{"$unwind", field}},
+			bson.D{{"$group", bson.D{{"_id", field}, {"count", bson.M{"$sum": 1}}}}},
+			bson.D{{"$sort", bson.D{{"count", -1}, {"_id.name", 1}}}},
+		}
+	}
+	pipeline := bson.A{
+		bson.D{{"$match", match}},
+		bson.D{{"$facet", bson.D{
+			{"categories", refFacet("$categories")},
+			{"brands", refFacet("$brandRefs")},
+			{"attributes", bson.A{
+				bson.D{{"$unwind", "$attributes"}},
+				bson.D{{"$group", bson.D{{"_id", "$attributes"}, {"count", bson.M{"$sum": 1}}}}},
+				bson.D{{"$sort", bson.D{{"_id.name", 1}, {"count", -1}, {"_id.term", 1}}}},
+			}},
+			{"priceRanges", bson.A{
+				bson.D{{"$bucketAuto", bson.D{{"groupBy", "$price"}, {"buckets", productSearchPriceBuckets}}}},
+			}},
+			{"stockStatus", bson.A{
+				bson.D{{"$sortByCount", "$stockStatus"}},
+			}},
+		}}},
+	}
+	ctx := context.Background()
+	cur, err := database.MongoDB.Collection(ProductSearchIndexCollection).Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	counts := struct {
+		Categories []struct {
+			Ref   searchFacetRef `bson:"_id"`
+			Count int            `bson:"count"`
+		} `bson:"categories"`
+		Brands []struct {
+			Ref   searchFacetRef `bson:"_id"`
+			Count int            `bson:"count"`
+		} `bson:"brands"`
+		Attributes []struct {
+			Term  searchAttributeTerm `bson:"_id"`
+			Count int                 `bson:"count"`
+		} `bson:"attributes"`
+		PriceRanges []struct {
+			Range struct {
+				Min float64 `bson:"min"`
+				Max float64 `bson:"max"`
+			} `bson:"_id"`
+			Count int `bson:"count"`
+		} `bson:"priceRanges"`
+		StockStatus []struct {
+			Status string `bson:"_id"`
+			Count  int    `bson:"count"`
+		} `bson:"stockStatus"`
+	}{}
+	if cur.Next(ctx) {
+		err = cur.Decode(&counts)
+		if err != nil {
+			log.Errorln(err)
+			return nil, err
+		}
+	}
+	if err = cur.Err(); err != nil {
+		return nil, err
+	}
+
+	facets := &ProductSearchFacets{}
+	for _, category := range counts.Categories {
+		facets.Categories = append(facets.Categories, &SearchFacetValue{Value: category.Ref.ID, Label: category.Ref.Name, Count: category.Count})
+	}
+	for _, brand := range counts.Brands {
+		facets.Brands = append(facets.Brands, &SearchFacetValue{Value: brand.Ref.ID, Label: brand.Ref.Name, Count: brand.Count})
+	}
+	for _, attribute := range counts.Attributes {
+		var facet *AttributeFacet
+		if n := len(facets.Attributes); n > 0 && facets.Attributes[n-1].Name == attribute.Term.Name {
+			facet = facets.Attributes[n-1]
+		} else {
+			facet = &AttributeFacet{Name: attribute.Term.Name}
+			facets.Attributes = append(facets.Attributes, facet)
+		}
+		facet.Terms = append(facet.Terms, &SearchFacetValue{Value: attribute.Term.Term, Label: attribute.Term.Term, Count: attribute.Count})
+	}
+	for _, priceRange := range counts.PriceRanges {
+		facets.PriceRanges = append(facets.PriceRanges, &PriceRangeFacet{Min: priceRange.Range.Min, Max: priceRange.Range.Max, Count: priceRange.Count})
+	}
+	for _, stockStatus := range counts.StockStatus {
+		facets.StockStatus = append(facets.StockStatus, &SearchFacetValue{Value: stockStatus.Status, Label: stockStatus.Status, Count: stockStatus.Count})
+	}
+	return facets, nil
+}
+
+// expandSearchWords gives the terms a query is searched with: its words, the indexed words close to its misspelt
+// words and the synonyms of both. The query with its misspelt words corrected is also given when there were any.
+func expandSearchWords(query string, words []string) (terms []string, corrected string, err error) {
+	seen := map[string]bool{}
+	add := func(term string) {
+		if !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	correctedWords := make([]string, 0, len(words))
+	changed := false
+	for _, word := range words {
+		add(word)
+		corrections, err := correctSearchWord(word)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, correction := range corrections {
+			add(correction)
+		}
+		if len(corrections) > 0 {
+			correctedWords = append(correctedWords, corrections[0])
+			changed = true
+		} else {
+			correctedWords = append(correctedWords, word)
+		}
+	}
+
+	phrases := append([]string{strings.Join(words, " ")}, terms...)
+	if changed {
+		phrases = append(phrases, strings.Join(correctedWords, " "))
+	}
+	synonyms, err := searchSynonymsOf(phrases)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, synonym := range synonyms {
+		for _, word := range searchWords(synonym) {
+			add(word)
+		}
+	}
+	if changed {
+		corrected = strings.Join(correctedWords, " ")
+	}
+	return terms, corrected, nil
+}
+
+// correctSearchWord gives the indexed words within typo distance of a word that isn't indexed, closest first.
+// Short words aren't corrected and the first letter of a word is taken to be right.
+func correctSearchWord(word string) ([]string, error) {
+	if allowedTypos(word) == 0 {
+		return nil, nil
+	}
+	terms, err := productSearchVocabulary.termsStartingWith(string([]rune(word)[:1]))
+	if err != nil {
+		return nil, err
+	}
+	return closestSearchTerms(word, terms), nil
+}
+
+// closestSearchTerms gives the terms within typo distance of a word, closest first, none when the word is one of them.
+func closestSearchTerms(word string, terms []string) []string {
+	maxTypos := allowedTypos(word)
+	type candidate struct {
+		term     string
+		distance int
+	}
+	var candidates []candidate
+	for _, term := range terms {
+		if term == word {
+			return nil
+		}
+		if distance := searchEditDistance(word, term); distance <= maxTypos {
+			candidates = append(candidates, candidate{term: term, distance: distance})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].term < candidates[j].term
+	})
+	var corrections []string
+	for i := 0; i < len(candidates) && i < productSearchMaxCorrections; i++ {
+		corrections = append(corrections, candidates[i].term)
+	}
+	return corrections
+}
+
+// termsStartingWith gives the indexed words starting with prefix, loading the vocabulary when it is stale.
+func (vocabulary *searchVocabulary) termsStartingWith(prefix string) ([]string, error) {
+	vocabulary.mu.RLock()
+	fresh := vocabulary.words != nil && time.Since(vocabulary.loadedAt) < productSearchVocabularyTTL
+	vocabulary.mu.RUnlock()
+	if !fresh {
+		err := vocabulary.load()
+		if err != nil {
+			return nil, err
+		}
+	}
+	vocabulary.mu.RLock()
+	defer vocabulary.mu.RUnlock()
+	terms := make([]string, 0, len(vocabulary.words[prefix]))
+	for term := range vocabulary.words[prefix] {
+		terms = append(terms, term)
+	}
+	return terms, nil
+}
+
+// load reads the words of the visible products from the search index.
+func (vocabulary *searchVocabulary) load() error {
+	values, err := database.MongoDB.Collection(ProductSearchIndexCollection).Distinct(context.Background(), "terms", bson.D{{"visible", true}})
+	if err != nil {
+		log.Errorln(err)
+		return err
+	}
+	words := map[string]map[string]bool{}
+	for _, value := range values {
+		if term, ok := value.(string); ok {
+			addSearchTerm(words, term)
+		}
+	}
+	vocabulary.mu.Lock()
+	vocabulary.words = words
+	vocabulary.loadedAt = time.Now()
+	vocabulary.mu.Unlock()
+	return nil
+}
+
+// add puts the words of a newly indexed product in the vocabulary, words of products taken out are dropped on the next load.
+func (vocabulary *searchVocabulary) add(terms []string) {
+	vocabulary.mu.Lock()
+	defer vocabulary.mu.Unlock()
+	if vocabulary.words == nil {
+		return
+	}
+	for _, term := range terms {
+		addSearchTerm(vocabulary.words, term)
+	}
+}
+
+// addSearchTerm files a term under its first letter.
+func addSearchTerm(words map[string]map[string]bool, term string) {
+	if term == "" {
+		return
+	}
+	prefix := string([]rune(term)[:1])
+	if words[prefix] == nil {
+		words[prefix] = map[string]bool{}
+	}
+	words[prefix][term] = true
+}
+
+// allowedTypos gives the number of typos tolerated in a word of its length.
+func allowedTypos(word string) int {
+	switch n := len([]rune(word)); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// searchEditDistance gives the number of insertions, deletions, substitutions and transpositions between two words.
+func searchEditDistance(a string, b string) int {
+	s, t := []rune(a), []rune(b)
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, minInt(d[i][j-1]+1, d[i-1][j-1]+cost))
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// searchWords splits text into lower cased words.
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// ensureProductSearchIndexes creates the text index the product search relies on.
+func ensureProductSearchIndexes() {
+	productSearchIndexesMu.Lock()
+	defer productSearchIndexesMu.Unlock()
+	if productSearchIndexesReady {
+		return
+	}
+	indexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{"name", "text"}, {"sku", "text"}, {"tags", "text"}, {"brands", "text"}, {"categoryNames", "text"}, {"description", "text"}},
+			Options: options.Index().SetName("product_search_text").
+				SetWeights(bson.D{{"name", 10}, {"sku", 10}, {"tags", 5}, {"brands", 5}, {"categoryNames", 5}, {"description", 1}}),
+		},
+		{Keys: bson.D{{"terms", 1}}},
+		{Keys: bson.D{{"store", 1}, {"visible", 1}}},
+	}
+	_, err := database.MongoDB.Collection(ProductSearchIndexCollection).Indexes().CreateMany(context.Background(), indexes)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	productSearchIndexesReady = true
+}
@@ -0,0 +1,63 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestSearchWords(t *testing.T) {
+	require.Equal(t, []string{"red", "t", "shirt", "2xl"}, searchWords("Red T-Shirt, 2XL!"))
+}
+
+func TestSearchEditDistance(t *testing.T) {
+	require.Equal(t, 0, searchEditDistance("shirt", "shirt"))
+	require.Equal(t, 1, searchEditDistance("shirt", "shrt"))
+	require.Equal(t, 1, searchEditDistance("shirt", "sihrt"))
+	require.Equal(t, 2, searchEditDistance("trousers", "trowsrs"))
+}
+
+func TestClosestSearchTerms(t *testing.T) {
+	terms := []string{"shirt", "shirts", "short", "shorts", "skirt", "sweater"}
+
+	t.Run("indexed words are not corrected", func(t *testing.T) {
+		require.Nil(t, closestSearchTerms("shirt", terms))
+	})
+	t.Run("gives the closest words first", func(t *testing.T) {
+		require.Equal(t, []string{"shirt", "shirts"}, closestSearchTerms("shirtt", terms))
+	})
+	t.Run("short words allow one typo", func(t *testing.T) {
+		require.Equal(t, []string{"shirt", "short"}, closestSearchTerms("shrt", terms))
+		require.Empty(t, closestSearchTerms("swter", terms))
+	})
+	t.Run("long words allow two typos", func(t *testing.T) {
+		require.Equal(t, []string{"sweater"}, closestSearchTerms("swaeterr", terms))
+	})
+	t.Run("gives at most a few corrections", func(t *testing.T) {
+		require.Equal(t, []string{"bolta", "boltb", "boltc"}, closestSearchTerms("boltz", []string{"boltd", "boltc", "boltb", "bolta"}))
+	})
+}
+
+func TestSearchVocabularyAdd(t *testing.T) {
+	vocabulary := &searchVocabulary{}
+	//nothing is kept before the vocabulary is loaded
+	vocabulary.add([]string{"shirt"})
+	require.Nil(t, vocabulary.words)
+
+	vocabulary.words = map[string]map[string]bool{}
+	vocabulary.add([]string{"shirt", "skirt", "trousers", ""})
+	require.Equal(t, map[string]bool{"shirt": true, "skirt": true}, vocabulary.words["s"])
+	require.Equal(t, map[string]bool{"trousers": true}, vocabulary.words["t"])
+}
+
+func TestPermissionsGrant(t *testing.T) {
+	require.True(t, permissionsGrant([]string{"Product:Update"}, "Product:Update"))
+	require.True(t, permissionsGrant([]string{"Product:*"}, "Product:Update"))
+	require.True(t, permissionsGrant([]string{"*:*"}, "Product:Update"))
+	//the service and the action have to be granted by the same permission
+	require.False(t, permissionsGrant([]string{"Product:List", "Order:Update"}, "Product:Update"))
+	require.False(t, permissionsGrant(nil, "Product:Update"))
+}
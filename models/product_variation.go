@@ -66,6 +66,7 @@ func CreateProductVariation(productVariation ProductVariation) (*ProductVariatio
 	productVariation.CreatedAt = time.Now()
 	productVariation.UpdatedAt = time.Now()
 	productVariation.ID = primitive.NewObjectID()
+	productVariation.applySaleSchedule(time.Now())
 	db := database.MongoDB
 	installationCollection := db.Collection(ProductVariationCollection)
 	ctx := context.Background()
@@ -75,6 +76,7 @@ func CreateProductVariation(productVariation ProductVariation) (*ProductVariatio
 		return nil, err
 	}
 	go webhooks.NewWebhookEvent("product_variation.created", &productVariation)
+	go syncVariationParent(productVariation.ParentProductID)
 	cacheClient := cache.RedisClient
 	//set cache item
 	err = cacheClient.Set(productVariation.ID.Hex(), productVariation, DefaultRedisCacheTime).Err()
@@ -153,6 +155,7 @@ ctx := context.Background()
 // UpdateProductVariation updates product variation.
 func UpdateProductVariation(productVariation *ProductVariation) *ProductVariation {
 	productVariation.UpdatedAt = time.Now()
+	productVariation.applySaleSchedule(time.Now())
 	filter := bson.D{{"_id", productVariation.ID}}
 	db := database.MongoDB
 	productVariationCollection := db.Collection(ProductVariationCollection)
@@ -163,6 +166,7 @@ func UpdateProductVariation(productVariation *ProductVariation) *ProductVariatio
 		log.Error(err)
 	}
 	go webhooks.NewWebhookEvent("product_variation.updated", &productVariation)
+	go syncVariationParent(productVariation.ParentProductID)
 	//Update cache item
 	cacheClient := cache.RedisClient
 	err = cacheClient.Del(productVariation.ID.Hex()).Err()
@@ -187,6 +191,15 @@ func DeleteProductVariationByID(ID string) (bool, error) {
 		return false, nil
 	}
 	go webhooks.NewWebhookEvent("product_variation.deleted", &res)
+	if id, err := primitive.ObjectIDFromHex(ID); err == nil {
+		go func() {
+			variation := &ProductVariation{}
+			err := productVariationCollection.FindOne(context.Background(), bson.D{{"_id", id}}).Decode(&variation)
+			if err == nil {
+				syncVariationParent(variation.ParentProductID)
+			}
+		}()
+	}
 	//Delete cache item
 	cacheClient := cache.RedisClient
 	err = cacheClient.Del(ID).Err()
@@ -428,6 +428,10 @@ type ProviderPaymentReport struct {
 	DeletedAt                                            *time.Time         `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
 	UpdatedAt                                            time.Time          `json:"updatedAt" bson:"updatedAt"`
 	CreatedBy                                            primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	SettlementID                                         primitive.ObjectID `json:"settlementID" bson:"settlementID"`
+	ProviderID                                           primitive.ObjectID `json:"providerID" bson:"providerID"`
+	PeriodStart                                          time.Time          `json:"periodStart" bson:"periodStart"`
+	PeriodEnd                                            time.Time          `json:"periodEnd" bson:"periodEnd"`
 	ProviderName                                         string             `json:"providerName" bson:"providerName"`
 	ProviderBankDetails                                  string             `json:"providerBankDetails" bson:"providerBankDetails"`
 	TotalJobCommissionTakeFromProviderForCashJobs        string             `json:"totalJobCommissionTakeFromProviderForCashJobs" bson:"totalJobCommissionTakeFromProviderForCashJobs"`
@@ -537,6 +541,9 @@ type StorePaymentReport struct {
 	DeletedAt         *time.Time         `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
 	UpdatedAt         time.Time          `json:"updatedAt" bson:"updatedAt"`
 	CreatedBy         primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	SettlementID      primitive.ObjectID `json:"settlementID" bson:"settlementID"`
+	StoreID           primitive.ObjectID `json:"storeID" bson:"storeID"`
+	OrderID           primitive.ObjectID `json:"orderID" bson:"orderID"`
 	SelectStore       string             `json:"selectStore" bson:"selectStore"`
 	ServiceType       string             `json:"serviceType" bson:"serviceType"`
 	StoreName         string             `json:"storeName" bson:"storeName"`
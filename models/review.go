@@ -205,7 +205,10 @@ type Review struct {
 	From                  string             `json:"from" bson:"from"`
 	To                    string             `json:"to" bson:"to"`
 	Date                  time.Time          `json:"date" bson:"date"`
-	Comment               string             `json:"comment" bson:"comment"`
+	Comment               string             `json:"comment" bson:"comment"`                 //by the user on the provider
+	ProviderComment       string             `json:"providerComment" bson:"providerComment"` //by the provider on the user
+	RatedByUserAt         *time.Time         `json:"ratedByUserAt" bson:"ratedByUserAt"`
+	RatedByProviderAt     *time.Time         `json:"ratedByProviderAt" bson:"ratedByProviderAt"`
 	IsActive              bool               `json:"isActive" bson:"isActive"`
 }
 
@@ -299,7 +302,7 @@ ctx := context.Background()
 	if err = cur.Err(); err != nil {
 		return
 	}
-	return reviews, totalCount, pagingInfo.HasPreviousPage, pagingInfo.HasNextPage, nil
+	return reviews, int64(tcint), pagingInfo.HasPreviousPage, pagingInfo.HasNextPage, nil
 }
 
 // UpdateReview updates reviews.
@@ -316,6 +319,7 @@ func UpdateReview(c *Review) (*Review, error) {
 		log.Error(err)
 	}
 	go webhooks.NewWebhookEvent("review.updated", &review)
+	go refreshReviewRatings(review)
 	//Update cache item
 	cacheClient := cache.RedisClient
 	err = cacheClient.Del(review.ID.Hex()).Err()
@@ -328,7 +332,11 @@ func UpdateReview(c *Review) (*Review, error) {
 // DeleteReviewByID deletes reviews by id.
 func DeleteReviewByID(ID string) (bool, error) {
 	db := database.MongoDB
-	id, err := primitive.ObjectIDFromHex(ID)
+	review, err := GetReviewByID(ID)
+	if err != nil || review == nil {
+		return false, err
+	}
+	id := review.ID
 	filter := bson.D{{"_id", id}}
 	reviewsCollection := db.Collection(ReviewsCollection)
 	res, err := reviewsCollection.UpdateOne(context.Background(), filter, bson.D{{"$set", bson.D{{"deletedAt", time.Now()}}}})
@@ -340,6 +348,7 @@ func DeleteReviewByID(ID string) (bool, error) {
 		return false, nil
 	}
 	go webhooks.NewWebhookEvent("review.deleted", &res)
+	go refreshReviewRatings(review)
 	//Delete cache item
 	cacheClient := cache.RedisClient
 	err = cacheClient.Del(ID).Err()
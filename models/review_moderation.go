@@ -0,0 +1,196 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidReviewRating   = errors.New("rating must be between 1 and 5")
+	ErrReviewProductNotFound = errors.New("reviewed product not found")
+)
+
+// hasCompletedOrderFor tells whether a customer has a delivered or completed order containing a product.
+func hasCompletedOrderFor(customerID primitive.ObjectID, productID primitive.ObjectID) bool {
+	if customerID.IsZero() {
+		return false
+	}
+	filter := bson.D{
+		{"customerID", customerID},
+		{"orderStatus", bson.M{"$in": bson.A{OrderStatusDelivered, OrderStatusCompleted}}},
+		{"orderItems.id", productID},
+	}
+	count, err := database.MongoDB.Collection(OrdersCollection).CountDocuments(context.Background(), filter)
+	if err != nil {
+		log.Errorln(err)
+		return false
+	}
+	return count > 0
+}
+
+// screenProductReview gives the status a new review starts in.
+// Reviews matching the spam words of the market settings go to spam, those matching the hold words wait for moderation
+// and the rest are approved unless every review needs approval.
+func screenProductReview(productReview *ProductReview) ProductReviewStatus {
+	settings, err := GetCurrentMarketSettings()
+	if err != nil || settings == nil {
+		return ProductReviewStatusApproved
+	}
+	return screenReview(productReview, settings.Review)
+}
+
+// screenReview gives the status a review starts in under the review settings of the market.
+func screenReview(productReview *ProductReview, setting ReviewSetting) ProductReviewStatus {
+	text := productReview.Reviewer + " " + productReview.ReviewerEmail + " " + productReview.Review
+	switch {
+	case reviewTextMatches(text, setting.SpamWords):
+		return ProductReviewStatusSpam
+	case reviewTextMatches(text, setting.HoldWords):
+		return ProductReviewStatusPending
+	case setting.RequireApproval:
+		return ProductReviewStatusPending
+	}
+	return ProductReviewStatusApproved
+}
+
+// reviewTextMatches tells whether a text contains any of the words or phrases of a list as whole words.
+func reviewTextMatches(text string, phrases []string) bool {
+	words := " " + strings.Join(searchWords(text), " ") + " "
+	for _, phrase := range phrases {
+		phraseWords := searchWords(phrase)
+		if len(phraseWords) == 0 {
+			continue
+		}
+		if strings.Contains(words, " "+strings.Join(phraseWords, " ")+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// ResubmitProductReview saves an edited review and sends it back to moderation, screening it again like a new review.
+func ResubmitProductReview(productReview *ProductReview) *ProductReview {
+	productReview.Status = resubmittedStatus(screenProductReview(productReview))
+	productReview.ModeratedBy = nil
+	productReview.ModeratedAt = nil
+	return UpdateProductReview(productReview)
+}
+
+// resubmittedStatus gives the status of an edited review screened again, edits never go out without a moderator's approval.
+func resubmittedStatus(screened ProductReviewStatus) ProductReviewStatus {
+	if screened == ProductReviewStatusApproved {
+		return ProductReviewStatusPending
+	}
+	return screened
+}
+
+// moderatedStatus gives the status a moderation action moves a review to, its current one for unknown actions.
+func moderatedStatus(status ProductReviewStatus, action ReviewModerationAction) ProductReviewStatus {
+	switch action {
+	case ReviewModerationActionApprove:
+		return ProductReviewStatusApproved
+	case ReviewModerationActionReject:
+		return ProductReviewStatusRejected
+	case ReviewModerationActionSpam:
+		return ProductReviewStatusSpam
+	}
+	return status
+}
+
+// ModerateProductReview approves, rejects or marks a review as spam.
+func ModerateProductReview(productReview *ProductReview, action ReviewModerationAction, moderatorID primitive.ObjectID) *ProductReview {
+	productReview.Status = moderatedStatus(productReview.Status, action)
+	now := time.Now()
+	productReview.ModeratedBy = &moderatorID
+	productReview.ModeratedAt = &now
+	return UpdateProductReview(productReview)
+}
+
+// reviewRatingCount is the number of approved reviews of a product giving a rating.
+type reviewRatingCount struct {
+	Rating int `bson:"_id"`
+	Count  int `bson:"count"`
+}
+
+// productRating gives the average rating, number of ratings and rating histogram of the approved reviews of a product.
+func productRating(ratings []reviewRatingCount) (string, int, []ProductRatingCount) {
+	histogram := make([]ProductRatingCount, 5)
+	for i := range histogram {
+		histogram[i].Rating = i + 1
+	}
+	count, total := 0, 0
+	for _, rating := range ratings {
+		if rating.Rating < 1 || rating.Rating > 5 {
+			continue
+		}
+		histogram[rating.Rating-1].Count += rating.Count
+		count += rating.Count
+		total += rating.Rating * rating.Count
+	}
+	averageRating := "0"
+	if count > 0 {
+		averageRating = fmt.Sprintf("%.2f", float64(total)/float64(count))
+	}
+	return averageRating, count, histogram
+}
+
+// ratedReviewsFilter matches the reviews counted in the rating of a product, its approved ones.
+func ratedReviewsFilter(productID primitive.ObjectID) bson.D {
+	return bson.D{{"productID", productID}, {"status", ProductReviewStatusApproved}, {"deletedAt", bson.M{"$exists": false}}}
+}
+
+// refreshProductRating recounts the average rating and rating histogram of a product from its approved reviews.
+func refreshProductRating(productID primitive.ObjectID) {
+	ctx := context.Background()
+	pipeline := bson.A{
+		bson.M{"$match": ratedReviewsFilter(productID)},
+		bson.M{"$group": bson.M{"_id": "$rating", "count": bson.M{"$sum": 1}}},
+	}
+	cur, err := database.MongoDB.Collection(ProductReviewCollection).Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	var ratings []reviewRatingCount
+	err = cur.All(ctx, &ratings)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	averageRating, count, histogram := productRating(ratings)
+
+	product := GetProductByID(productID.Hex())
+	if product.ID.IsZero() {
+		return
+	}
+	product.AverageRating = averageRating
+	product.RatingCount = count
+	product.RatingHistogram = histogram
+	_, err = UpdateProduct(product)
+	if err != nil {
+		log.Errorln(err)
+	}
+}
+
+// notifyNewProductReview emails the store selling a product about a new review of it.
+func notifyNewProductReview(productReview ProductReview, product *Product) {
+	store := GetStoreByID(product.Store)
+	if store == nil || store.Email == "" {
+		return
+	}
+	err := SendEmail("no-reply@tribe.cab", store.Email, "store.product_review.created", store.Language, &productReview, nil)
+	if err != nil {
+		log.Errorln(err)
+	}
+}
@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+)
+
+func TestScreenReview(t *testing.T) {
+	setting := ReviewSetting{SpamWords: []string{"cheap pills"}, HoldWords: []string{"refund"}}
+	require.Equal(t, ProductReviewStatusApproved, screenReview(&ProductReview{Review: "Great blender, works well"}, setting))
+	require.Equal(t, ProductReviewStatusSpam, screenReview(&ProductReview{Review: "Buy CHEAP pills here"}, setting))
+	require.Equal(t, ProductReviewStatusPending, screenReview(&ProductReview{Review: "Asked for a refund twice"}, setting))
+	//words match whole, not inside other words
+	require.Equal(t, ProductReviewStatusApproved, screenReview(&ProductReview{Review: "Refunded quickly"}, setting))
+	//the reviewer's name and email are screened too
+	require.Equal(t, ProductReviewStatusSpam, screenReview(&ProductReview{Reviewer: "cheap pills", Review: "ok"}, setting))
+
+	setting.RequireApproval = true
+	require.Equal(t, ProductReviewStatusPending, screenReview(&ProductReview{Review: "Great blender"}, setting))
+	require.Equal(t, ProductReviewStatusSpam, screenReview(&ProductReview{Review: "cheap pills"}, setting))
+}
+
+func TestReviewModerationTransitions(t *testing.T) {
+	statuses := []ProductReviewStatus{ProductReviewStatusPending, ProductReviewStatusApproved, ProductReviewStatusRejected, ProductReviewStatusSpam}
+	for _, status := range statuses {
+		require.Equal(t, ProductReviewStatusApproved, moderatedStatus(status, ReviewModerationActionApprove))
+		require.Equal(t, ProductReviewStatusRejected, moderatedStatus(status, ReviewModerationActionReject))
+		require.Equal(t, ProductReviewStatusSpam, moderatedStatus(status, ReviewModerationActionSpam))
+		require.Equal(t, status, moderatedStatus(status, ReviewModerationAction("PUBLISH")))
+	}
+
+	//edits go back to moderation instead of staying approved
+	require.Equal(t, ProductReviewStatusPending, resubmittedStatus(ProductReviewStatusApproved))
+	require.Equal(t, ProductReviewStatusPending, resubmittedStatus(ProductReviewStatusPending))
+	require.Equal(t, ProductReviewStatusSpam, resubmittedStatus(ProductReviewStatusSpam))
+}
+
+func TestProductRating(t *testing.T) {
+	average, count, histogram := productRating([]reviewRatingCount{{Rating: 5, Count: 3}, {Rating: 2, Count: 1}, {Rating: 9, Count: 4}})
+	require.Equal(t, "4.25", average)
+	require.Equal(t, 4, count)
+	require.Equal(t, []ProductRatingCount{{1, 0}, {2, 1}, {3, 0}, {4, 0}, {5, 3}}, histogram)
+
+	average, count, histogram = productRating(nil)
+	require.Equal(t, "0", average)
+	require.Equal(t, 0, count)
+	require.Len(t, histogram, 5)
+
+	//only approved reviews count, so rejecting or marking an approved review as spam takes it out of the rating
+	productID := primitive.NewObjectID()
+	require.Equal(t, bson.D{{"productID", productID}, {"status", ProductReviewStatusApproved}, {"deletedAt", bson.M{"$exists": false}}},
+		ratedReviewsFilter(productID))
+}
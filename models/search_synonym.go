@@ -0,0 +1,230 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/cache"
+	"github.com/tribehq/platform/lib/database"
+	"github.com/tribehq/platform/utils/webhooks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+// SearchSynonym represents a group of words and phrases searched for one another.
+type SearchSynonym struct {
+	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	DeletedAt *time.Time         `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+	CreatedBy primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	Terms     []string           `json:"terms" bson:"terms"`
+	IsActive  bool               `json:"isActive" bson:"isActive"`
+}
+
+// CreateSearchSynonym creates new search synonym.
+func CreateSearchSynonym(searchSynonym SearchSynonym) (*SearchSynonym, error) {
+	searchSynonym.Terms = normalizeSynonymTerms(searchSynonym.Terms)
+	searchSynonym.CreatedAt = time.Now()
+	searchSynonym.UpdatedAt = time.Now()
+	searchSynonym.ID = primitive.NewObjectID()
+	db := database.MongoDB
+	collection := db.Collection(SearchSynonymsCollection)
+	ctx := context.Background()
+	_, err := collection.InsertOne(ctx, &searchSynonym)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	go webhooks.NewWebhookEvent("search_synonym.created", &searchSynonym)
+	cacheClient := cache.RedisClient
+	//set cache item
+	err = cacheClient.Set(searchSynonym.ID.Hex(), searchSynonym, DefaultRedisCacheTime).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	return &searchSynonym, nil
+}
+
+// GetSearchSynonymByID gives search synonym by id.
+func GetSearchSynonymByID(ID string) (*SearchSynonym, error) {
+	db := database.MongoDB
+	searchSynonym := &SearchSynonym{}
+	//try finding item in cache
+	cacheClient := cache.RedisClient
+	err := cacheClient.Get(ID).Scan(searchSynonym)
+	if err != nil && err != redis.Nil {
+		log.Error(err)
+	} else if err == redis.Nil {
+		//key is empty or not set
+	}
+	id, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.D{{"_id", id}, {"deletedAt", bson.M{"$exists": false}}}
+	ctx := context.Background()
+	err = db.Collection(SearchSynonymsCollection).FindOne(ctx, filter).Decode(&searchSynonym)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	//set cache item
+	err = cacheClient.Set(ID, searchSynonym, DefaultRedisCacheTime).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	return searchSynonym, nil
+}
+
+// GetSearchSynonyms gives a list of search synonyms.
+func GetSearchSynonyms(filter bson.D, limit int, after *string, before *string, first *int, last *int) (searchSynonyms []*SearchSynonym, totalCount int64, hasPrevious, hasNext bool, err error) {
+
+	db := database.MongoDB
+
+	tcint, filter, err := calcTotalCountWithQueryFilters(SearchSynonymsCollection, filter, after, before)
+	pagingInfo, err := PaginationUtility(after, before, first, last, &tcint)
+	if err != nil {
+		return
+	}
+	pagingInfo.QueryOpts.SetSort(bson.M{"_id": 1})
+
+	cur, err := db.Collection(SearchSynonymsCollection).Find(context.Background(), filter, &pagingInfo.QueryOpts)
+	if err != nil {
+		return
+	}
+	ctx := context.Background()
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		searchSynonym := &SearchSynonym{}
+		err = cur.Decode(&searchSynonym)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return
+			}
+			log.Errorln(err)
+		}
+		searchSynonyms = append(searchSynonyms, searchSynonym)
+	}
+	if err = cur.Err(); err != nil {
+		return
+	}
+	return searchSynonyms, int64(tcint), pagingInfo.HasPreviousPage, pagingInfo.HasNextPage, nil
+}
+
+// searchSynonymsOf gives the terms of the active synonym groups containing any of the phrases.
+func searchSynonymsOf(phrases []string) ([]string, error) {
+	var terms []string
+	filter := bson.D{
+		{"terms", bson.M{"$in": phrases}},
+		{"isActive", true},
+		{"deletedAt", bson.M{"$exists": false}},
+	}
+	ctx := context.Background()
+	cur, err := database.MongoDB.Collection(SearchSynonymsCollection).Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		searchSynonym := &SearchSynonym{}
+		err = cur.Decode(&searchSynonym)
+		if err != nil {
+			log.Errorln(err)
+			continue
+		}
+		terms = append(terms, searchSynonym.Terms...)
+	}
+	return terms, cur.Err()
+}
+
+// normalizeSynonymTerms lower cases the terms of a synonym group the way the search index does, dropping empty and repeated terms.
+func normalizeSynonymTerms(terms []string) []string {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, term := range terms {
+		term = strings.Join(searchWords(term), " ")
+		if term != "" && !seen[term] {
+			seen[term] = true
+			normalized = append(normalized, term)
+		}
+	}
+	return normalized
+}
+
+// UpdateSearchSynonym updates search synonym.
+func UpdateSearchSynonym(r *SearchSynonym) (*SearchSynonym, error) {
+	searchSynonym := r
+	searchSynonym.Terms = normalizeSynonymTerms(searchSynonym.Terms)
+	searchSynonym.UpdatedAt = time.Now()
+	filter := bson.D{{"_id", searchSynonym.ID}}
+	db := database.MongoDB
+	searchSynonymsCollection := db.Collection(SearchSynonymsCollection)
+	findRepOpts := &options.FindOneAndReplaceOptions{}
+	findRepOpts.SetReturnDocument(options.After)
+	err := searchSynonymsCollection.FindOneAndReplace(context.Background(), filter, searchSynonym, findRepOpts).Decode(&searchSynonym)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	go webhooks.NewWebhookEvent("search_synonym.updated", &searchSynonym)
+	//Update cache item
+	cacheClient := cache.RedisClient
+	err = cacheClient.Del(searchSynonym.ID.Hex()).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	return searchSynonym, nil
+}
+
+// DeleteSearchSynonymByID deletes search synonym by id.
+func DeleteSearchSynonymByID(ID string) (bool, error) {
+	db := database.MongoDB
+	id, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return false, err
+	}
+	filter := bson.D{{"_id", id}}
+	searchSynonymsCollection := db.Collection(SearchSynonymsCollection)
+	res, err := searchSynonymsCollection.UpdateOne(context.Background(), filter, bson.D{{"$set", bson.D{{"deletedAt", time.Now()}}}})
+	if err != nil {
+		log.Errorln(err)
+		return false, err
+	}
+	if res.MatchedCount < 1 {
+		return false, nil
+	}
+	go webhooks.NewWebhookEvent("search_synonym.deleted", &res)
+	//Delete cache item
+	cacheClient := cache.RedisClient
+	err = cacheClient.Del(ID).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	return true, nil
+}
+
+//UnmarshalBinary required for the redis cache to work
+func (searchSynonym *SearchSynonym) UnmarshalBinary(data []byte) error {
+	if err := json.Unmarshal(data, searchSynonym); err != nil {
+		return err
+	}
+	return nil
+}
+
+//MarshalBinary required for the redis cache to work
+func (searchSynonym *SearchSynonym) MarshalBinary() ([]byte, error) {
+	return json.Marshal(searchSynonym)
+}
@@ -50,7 +50,8 @@ type ServiceProvider struct {
 	ApprovedAt         *time.Time             `json:"approvedAt" bson:"approvedAt"`
 	ApprovedBy         *primitive.ObjectID    `json:"approvedBy" bson:"approvedBy"`
 	IsActive           bool                   `json:"isActive" bson:"isActive"`
-	//RazorPay Account ID is stored in metadata key "razorpay_route_account_id" same goes for
+	Rating             RatingSummary          `json:"rating" bson:"rating"` //given by users
+	//RazorPay Account ID is stored in metadata key "razorpay_route_account_id" same goes for stores
 }
 
 // CreateServiceProvider creates new service provider.
@@ -96,6 +96,24 @@ func GetCoreServiceScopes() []string {
 		"OrderStatusUtility:List",
 		"Order:Read",
 		"Order:List",
+		"OrderRefund:Read",
+		"OrderRefund:List",
+		"TaxRule:Read",
+		"TaxRule:List",
+		"SearchSynonym:Read",
+		"SearchSynonym:List",
+		"ProductImportJob:Read",
+		"ProductImportJob:List",
+		"DownloadGrant:Read",
+		"DownloadGrant:List",
+		"DownloadLog:List",
+		"PriceRule:Read",
+		"PriceRule:List",
+		"SubscriptionPlan:Read",
+		"SubscriptionPlan:List",
+		"Subscription:Read",
+		"Subscription:List",
+		"SubscriptionInvoice:List",
 		"StoreItemType:Read",
 		"StoreItemType:List",
 		"StoreItem:Read",
@@ -142,6 +160,10 @@ func GetCoreServiceScopes() []string {
 		"AppInstallation:List",
 		"Wallet:Read",
 		"Wallet:List",
+		"LinkedWallet:Read",
+		"PaymentMethod:Read",
+		"CashLiability:Read",
+		"CashLiability:List",
 		"ServiceVehicleType:Read",
 		"ServiceVehicleType:List",
 		"ServiceProviderVehicle:Read",
@@ -227,6 +249,41 @@ func GetCoreServiceScopes() []string {
 		"Order:Create",
 		"Order:Update",
 		"Order:Delete",
+		"OrderRefund:Create",
+		"OrderRefund:Approve",
+		"TaxRule:Create",
+		"TaxRule:Update",
+		"TaxRule:Delete",
+		"SearchSynonym:Create",
+		"SearchSynonym:Update",
+		"SearchSynonym:Delete",
+		"ProductImportJob:Create",
+		"DownloadGrant:Update",
+		"PriceRule:Create",
+		"PriceRule:Update",
+		"ProductReview:Moderate",
+		"Job:Update",
+		"Job:Manage",
+		"Review:Rate",
+		"SubscriptionPlan:Create",
+		"SubscriptionPlan:Update",
+		"Subscription:Create",
+		"Subscription:Update",
+		"Subscription:Manage",
+		"Subscription:ReportUsage",
+		"SubscriptionInvoice:Update",
+		"Wallet:Hold",
+		"Wallet:Reverse",
+		"Wallet:Manage",
+		"Withdrawal:Request",
+		"Withdrawal:Review",
+		"CashLiability:Settle",
+		"Payment:Create",
+		"LinkedWallet:Create",
+		"LinkedWallet:Delete",
+		"PaymentMethod:Create",
+		"PaymentMethod:Update",
+		"PaymentMethod:Delete",
 		"OrderStatusUtility:Create",
 		"OrderStatusUtility:Update",
 		"OrderStatusUtility:Delete",
@@ -15,25 +15,32 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"time"
 )
 
 // MarketSettings represents a market settings.
 type MarketSettings struct {
-	ID           primitive.ObjectID  `json:"id,omitempty" bson:"_id,omitempty"`
-	CreatedAt    time.Time           `json:"createdAt" bson:"createdAt"`
-	DeletedAt    *time.Time          `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
-	UpdatedAt    time.Time           `json:"updatedAt" bson:"updatedAt"`
-	General      GeneralSetting      `json:"general" bson:"general"`
-	Email        EmailSetting        `json:"email" bson:"email"`
-	Appearance   AppearanceSetting   `json:"appearance" bson:"appearance"`
-	Sms          SMSSetting          `json:"sms" bson:"sms"`
-	SocialMedia  SocialMediaSetting  `json:"socialMedia" bson:"socialMedia"`
-	App          AppSetting          `json:"app" bson:"app"`
-	Installation InstallationSetting `json:"installation" bson:"installation"`
-	Store        StoreSetting        `json:"store" bson:"store"`
-	Payment      PaymentSetting      `json:"payment" bson:"payment"`
-	IsActive     bool                `json:"isActive" bson:"isActive"`
+	ID                  primitive.ObjectID         `json:"id,omitempty" bson:"_id,omitempty"`
+	CreatedAt           time.Time                  `json:"createdAt" bson:"createdAt"`
+	DeletedAt           *time.Time                 `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	UpdatedAt           time.Time                  `json:"updatedAt" bson:"updatedAt"`
+	General             GeneralSetting             `json:"general" bson:"general"`
+	Email               EmailSetting               `json:"email" bson:"email"`
+	Appearance          AppearanceSetting          `json:"appearance" bson:"appearance"`
+	Sms                 SMSSetting                 `json:"sms" bson:"sms"`
+	SocialMedia         SocialMediaSetting         `json:"socialMedia" bson:"socialMedia"`
+	App                 AppSetting                 `json:"app" bson:"app"`
+	Installation        InstallationSetting        `json:"installation" bson:"installation"`
+	Store               StoreSetting               `json:"store" bson:"store"`
+	Payment             PaymentSetting             `json:"payment" bson:"payment"`
+	Tax                 TaxSetting                 `json:"tax" bson:"tax"`
+	Review              ReviewSetting              `json:"review" bson:"review"`
+	CartRecovery        CartRecoverySetting        `json:"cartRecovery" bson:"cartRecovery"`
+	SubscriptionBilling SubscriptionBillingSetting `json:"subscriptionBilling" bson:"subscriptionBilling"`
+	Withdrawal          WithdrawalSetting          `json:"withdrawal" bson:"withdrawal"`
+	CashLiability       CashLiabilitySetting       `json:"cashLiability" bson:"cashLiability"`
+	IsActive            bool                       `json:"isActive" bson:"isActive"`
 }
 
 // CreateMarketSettings creates market settings.
@@ -129,6 +136,24 @@ ctx := context.Background()
 	return marketSettings, totalCount, pagingInfo.HasPreviousPage, pagingInfo.HasNextPage, nil
 }
 
+// GetCurrentMarketSettings gives the most recently saved market settings.
+func GetCurrentMarketSettings() (*MarketSettings, error) {
+	db := database.MongoDB
+	setting := &MarketSettings{}
+	filter := bson.D{{"deletedAt", bson.M{"$exists": false}}}
+	findOneOpts := &options.FindOneOptions{}
+	findOneOpts.SetSort(bson.M{"_id": -1})
+	err := db.Collection(MarketSettingsCollection).FindOne(context.Background(), filter, findOneOpts).Decode(&setting)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	return setting, nil
+}
+
 //UnmarshalBinary required for the redis cache to work
 func (setting *MarketSettings) UnmarshalBinary(data []byte) error {
 	if err := json.Unmarshal(data, setting); err != nil {
@@ -0,0 +1,1001 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/database"
+	"github.com/tribehq/platform/utils/webhooks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrSettlementPeriodInvalid = errors.New("settlement period must end after it starts")
+	ErrSettlementPeriodOverlap = errors.New("settlement period overlaps an earlier settlement run")
+	ErrSettlementCarryChanged  = errors.New("outstanding settlements of the payee changed while settling, run the settlement again")
+)
+
+// Payees of a settlement.
+const (
+	SettlementPayeeStore    = "store"
+	SettlementPayeeProvider = "provider"
+)
+
+// Statuses of a settlement.
+const (
+	// SettlementStatusPending is owed to the payee and waits for the next payout file.
+	SettlementStatusPending = "pending"
+	// SettlementStatusExporting has been claimed for a bank payout file that is being written.
+	SettlementStatusExporting = "exporting"
+	// SettlementStatusExported has been written to a bank payout file.
+	SettlementStatusExported = "exported"
+	// SettlementStatusPaid has been confirmed paid by the bank.
+	SettlementStatusPaid = "paid"
+	// SettlementStatusOutstanding is owed by the payee and is taken back from their next settlement.
+	SettlementStatusOutstanding = "outstanding"
+	// SettlementStatusCarriedForward has been taken back from a later settlement.
+	SettlementStatusCarriedForward = "carried_forward"
+	// SettlementStatusSettled had nothing left to pay either way.
+	SettlementStatusSettled = "settled"
+)
+
+// Settlement represents what the market owes a store or provider for the orders and jobs of a period.
+// A positive net amount is paid out to the payee, a negative one is taken back from their next settlement.
+// The cash a provider collected for the market is owed through their cash liability, which a positive net amount pays off first.
+type Settlement struct {
+	ID                   primitive.ObjectID   `json:"id,omitempty" bson:"_id,omitempty"`
+	CreatedAt            time.Time            `json:"createdAt" bson:"createdAt"`
+	DeletedAt            *time.Time           `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	UpdatedAt            time.Time            `json:"updatedAt" bson:"updatedAt"`
+	CreatedBy            primitive.ObjectID   `json:"createdBy" bson:"createdBy"`
+	PayeeType            string               `json:"payeeType" bson:"payeeType"`
+	PayeeID              primitive.ObjectID   `json:"payeeID" bson:"payeeID"`
+	PayeeName            string               `json:"payeeName" bson:"payeeName"`
+	BankAccountID        *primitive.ObjectID  `json:"bankAccountID" bson:"bankAccountID"`
+	Currency             string               `json:"currency" bson:"currency"`
+	PeriodStart          time.Time            `json:"periodStart" bson:"periodStart"`
+	PeriodEnd            time.Time            `json:"periodEnd" bson:"periodEnd"`
+	OrderIDs             []primitive.ObjectID `json:"orderIDs" bson:"orderIDs"`
+	JobIDs               []primitive.ObjectID `json:"jobIDs" bson:"jobIDs"`
+	Gross                float64              `json:"gross" bson:"gross"`
+	Commission           float64              `json:"commission" bson:"commission"`
+	DeliveryCharges      float64              `json:"deliveryCharges" bson:"deliveryCharges"`
+	Refunds              float64              `json:"refunds" bson:"refunds"`
+	CashCollected        float64              `json:"cashCollected" bson:"cashCollected"`
+	WalletCredited       float64              `json:"walletCredited" bson:"walletCredited"`
+	Transferred          float64              `json:"transferred" bson:"transferred"`
+	CarriedForward       float64              `json:"carriedForward" bson:"carriedForward"`
+	CashLiabilityAccrued float64              `json:"cashLiabilityAccrued" bson:"cashLiabilityAccrued"` //cash commission owed through the provider's cash liability instead
+	CashLiabilityOffset  float64              `json:"cashLiabilityOffset" bson:"cashLiabilityOffset"`   //taken off the provider's cash liability
+	NetAmount            float64              `json:"netAmount" bson:"netAmount"`
+	Status               string               `json:"status" bson:"status"`
+	CarriedTo            *primitive.ObjectID  `json:"carriedTo" bson:"carriedTo"`
+	PayoutFile           string               `json:"payoutFile" bson:"payoutFile"`
+	ExportedAt           *time.Time           `json:"exportedAt" bson:"exportedAt"`
+	PaidAt               *time.Time           `json:"paidAt" bson:"paidAt"`
+}
+
+// settlementBatch gathers the orders and jobs of one payee while a settlement run adds them up.
+type settlementBatch struct {
+	settlement        *Settlement
+	orders            []*Order
+	cashJobCommission float64
+	cardJobAmount     float64
+	jobRefunds        map[primitive.ObjectID]float64 //refunded amount of each job taken back by the settlement
+}
+
+// Ways the fare of a job reaches its provider.
+const (
+	jobFareUnpaid   = ""
+	jobFareWallet   = "wallet"   //captured from the customer's wallet hold and credited to the provider's wallet
+	jobFareTransfer = "transfer" //paid by the gateway to the provider's linked account
+	jobFareGateway  = "gateway"  //paid to the market through a gateway, owed to the provider by the settlement
+	jobFareCash     = "cash"     //collected by the provider in cash
+)
+
+// jobFarePayment tells how the fare of a job reached its provider, jobFareUnpaid while it hasn't been paid yet.
+func jobFarePayment(job *Job, walletCaptured bool) string {
+	switch {
+	case walletCaptured:
+		return jobFareWallet
+	case transferredAmount(job.PaymentTransfers, SettlementPayeeProvider) > 0:
+		return jobFareTransfer
+	case job.PaymentMethodType == PaymentMethodTypeCash:
+		return jobFareCash
+	case isJobPaid(job):
+		return jobFareGateway
+	}
+	return jobFareUnpaid
+}
+
+var (
+	settlementIndexesMu    sync.Mutex
+	settlementIndexesReady bool
+)
+
+// ensureSettlementIndexes makes sure a payee is settled only once for a period.
+func ensureSettlementIndexes() {
+	settlementIndexesMu.Lock()
+	defer settlementIndexesMu.Unlock()
+	if settlementIndexesReady {
+		return
+	}
+	ctx := context.Background()
+	db := database.MongoDB
+	_, err := db.Collection(SettlementsCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{"payeeType", 1}, {"payeeID", 1}, {"currency", 1}, {"periodStart", 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{"status", 1}}},
+		{Keys: bson.D{{"payoutFile", 1}}},
+	})
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	//settlements are saved along with their reports in a transaction, which can't create the collections
+	for _, collection := range []string{StorePaymentReportCollection, ProviderPaymentReportCollection} {
+		_, err = db.Collection(collection).Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{"settlementID", 1}}})
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+	}
+	ensureCashLiabilityIndexes()
+	settlementIndexesReady = true
+}
+
+// RunSettlements settles the stores and providers for the orders and jobs completed in [start, end).
+// Orders and jobs are settled by the period they completed in, so runs have to cover back to back periods,
+// running a period again only adds the payees that weren't settled the first time.
+func RunSettlements(start time.Time, end time.Time, createdBy primitive.ObjectID) ([]*Settlement, error) {
+	if !end.After(start) {
+		return nil, ErrSettlementPeriodInvalid
+	}
+	ensureSettlementIndexes()
+	ctx := context.Background()
+	collection := database.MongoDB.Collection(SettlementsCollection)
+	overlapping := bson.D{
+		{"periodStart", bson.M{"$lt": end}},
+		{"periodEnd", bson.M{"$gt": start}},
+		{"$or", bson.A{bson.M{"periodStart": bson.M{"$ne": start}}, bson.M{"periodEnd": bson.M{"$ne": end}}}},
+	}
+	count, err := collection.CountDocuments(ctx, overlapping)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrSettlementPeriodOverlap
+	}
+
+	batches := map[string]*settlementBatch{}
+	batchFor := func(payeeType string, payeeID primitive.ObjectID, currency string) *settlementBatch {
+		key := payeeType + ":" + payeeID.Hex() + ":" + currency
+		batch, ok := batches[key]
+		if !ok {
+			batch = &settlementBatch{settlement: &Settlement{
+				PayeeType:   payeeType,
+				PayeeID:     payeeID,
+				Currency:    currency,
+				PeriodStart: start,
+				PeriodEnd:   end,
+				CreatedBy:   createdBy,
+			}}
+			batches[key] = batch
+		}
+		return batch
+	}
+	err = addSettlementOrders(start, end, batchFor)
+	if err != nil {
+		return nil, err
+	}
+	var settledOrders bson.A
+	for _, batch := range batches {
+		for _, order := range batch.orders {
+			settledOrders = append(settledOrders, order.ID)
+		}
+	}
+	err = addSettlementRefunds(start, end, settledOrders, batchFor)
+	if err != nil {
+		return nil, err
+	}
+	err = addSettlementJobs(start, end, batchFor)
+	if err != nil {
+		return nil, err
+	}
+	err = addSettlementJobRefunds(end, batchFor)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(batches))
+	for key := range batches {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var settlements []*Settlement
+	for _, key := range keys {
+		settlement, err := saveSettlement(batches[key])
+		if err != nil {
+			return settlements, err
+		}
+		if settlement != nil {
+			settlements = append(settlements, settlement)
+		}
+	}
+	return settlements, nil
+}
+
+// Statuses of the orders a settlement pays the stores for, orders refunded after they were delivered included.
+var settledOrderStatuses = []OrderStatus{OrderStatusDelivered, OrderStatusCompleted, OrderStatusRefunded}
+
+// settlesOrder tells whether settlements pay the store of an order for it, in the period it completed in.
+// Orders refunded in full after they were delivered are settled as well, their refunds are taken back along with them.
+func settlesOrder(order *Order) bool {
+	if order.DateCompleted.IsZero() || order.DatePaid.IsZero() || len(order.ChildOrders) > 0 {
+		return false
+	}
+	for _, status := range settledOrderStatuses {
+		if order.OrderStatus == status {
+			return true
+		}
+	}
+	return false
+}
+
+// addSettlementOrders adds the store orders completed and paid in the period to their store and delivery provider.
+func addSettlementOrders(start time.Time, end time.Time, batchFor func(string, primitive.ObjectID, string) *settlementBatch) error {
+	filter := bson.D{
+		{"orderStatus", bson.M{"$in": settledOrderStatuses}},
+		{"dateCompleted", bson.M{"$gte": start, "$lt": end}},
+		{"datePaid", bson.M{"$gt": time.Time{}}},
+		{"childOrders.0", bson.M{"$exists": false}},
+		{"deletedAt", bson.M{"$exists": false}},
+	}
+	ctx := context.Background()
+	cur, err := database.MongoDB.Collection(OrdersCollection).Find(ctx, filter, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		log.Errorln(err)
+		return err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		order := &Order{}
+		err = cur.Decode(order)
+		if err != nil {
+			log.Errorln(err)
+			return err
+		}
+		addSettlementOrder(order, batchFor)
+	}
+	if err = cur.Err(); err != nil {
+		log.Errorln(err)
+		return err
+	}
+	return nil
+}
+
+// addSettlementOrder adds a store order to its store and delivery provider.
+// The store earns the order total less the delivery charges and the site commission, the delivery provider earns the delivery charges.
+// Whoever handed over a cash order collected its total already.
+func addSettlementOrder(order *Order, batchFor func(string, primitive.ObjectID, string) *settlementBatch) {
+	if order.StoreID.IsZero() {
+		return
+	}
+	currency := order.Currency.CurrencyCode
+	isCashOrder := order.PaymentMethod.Type == PaymentMethodTypeCash
+	delivered := !order.ProviderID.IsZero()
+
+	store := batchFor(SettlementPayeeStore, order.StoreID, currency)
+	store.orders = append(store.orders, order)
+	store.settlement.OrderIDs = append(store.settlement.OrderIDs, order.ID)
+	store.settlement.Gross += order.OrderTotalAmount
+	store.settlement.Commission += order.Commission
+	store.settlement.DeliveryCharges += order.ShippingTotal
+	if isCashOrder && !delivered {
+		store.settlement.CashCollected += order.OrderTotalAmount
+	}
+	store.settlement.Transferred += transferredAmount(order.PaymentTransfers, SettlementPayeeStore)
+	if delivered {
+		provider := batchFor(SettlementPayeeProvider, order.ProviderID, currency)
+		provider.settlement.OrderIDs = append(provider.settlement.OrderIDs, order.ID)
+		provider.settlement.Gross += order.ShippingTotal
+		if isCashOrder {
+			provider.settlement.CashCollected += order.OrderTotalAmount
+		}
+	}
+}
+
+// addSettlementRefunds takes the refunds of settled orders back from the stores that sold the orders.
+// A refund is taken back in the period by the end of which both the refund was processed and its order was settled,
+// so refunds of orders that are never settled, like orders cancelled before they were delivered, aren't taken at all.
+// settledOrders are the orders settled in the period, whose refunds from earlier periods are taken back now.
+func addSettlementRefunds(start time.Time, end time.Time, settledOrders bson.A, batchFor func(string, primitive.ObjectID, string) *settlementBatch) error {
+	processed := bson.A{bson.D{{"processedAt", bson.M{"$gte": start, "$lt": end}}}}
+	if len(settledOrders) > 0 {
+		processed = append(processed, bson.D{{"processedAt", bson.M{"$lt": start}}, {"orderID", bson.M{"$in": settledOrders}}})
+	}
+	filter := bson.D{
+		{"status", OrderRefundStatusProcessed},
+		{"$or", processed},
+		{"deletedAt", bson.M{"$exists": false}},
+	}
+	ctx := context.Background()
+	cur, err := database.MongoDB.Collection(OrderRefundsCollection).Find(ctx, filter)
+	if err != nil {
+		log.Errorln(err)
+		return err
+	}
+	defer cur.Close(ctx)
+	orders := map[primitive.ObjectID]*Order{}
+	for cur.Next(ctx) {
+		refund := &OrderRefund{}
+		err = cur.Decode(refund)
+		if err != nil {
+			log.Errorln(err)
+			return err
+		}
+		order, ok := orders[refund.OrderID]
+		if !ok {
+			order = &Order{}
+			err = database.MongoDB.Collection(OrdersCollection).FindOne(ctx, bson.D{{"_id", refund.OrderID}}).Decode(order)
+			if err != nil && err != mongo.ErrNoDocuments {
+				log.Errorln(err)
+				return err
+			}
+			orders[refund.OrderID] = order
+		}
+		addSettlementRefund(refund, order, start, end, batchFor)
+	}
+	if err = cur.Err(); err != nil {
+		log.Errorln(err)
+		return err
+	}
+	return nil
+}
+
+// orderRefundSettledIn tells whether the refund of an order is taken back in the period [start, end),
+// the one by the end of which the refund was processed and the order was settled.
+func orderRefundSettledIn(refund *OrderRefund, order *Order, start time.Time, end time.Time) bool {
+	if refund.ProcessedAt == nil || !settlesOrder(order) {
+		return false
+	}
+	settledAt := *refund.ProcessedAt
+	if order.DateCompleted.After(settledAt) {
+		settledAt = order.DateCompleted
+	}
+	return !settledAt.Before(start) && settledAt.Before(end)
+}
+
+// addSettlementRefund takes the refund of an order settled by the period back from the store that sold it.
+func addSettlementRefund(refund *OrderRefund, order *Order, start time.Time, end time.Time, batchFor func(string, primitive.ObjectID, string) *settlementBatch) {
+	if order.StoreID.IsZero() || !orderRefundSettledIn(refund, order, start, end) {
+		return
+	}
+	//what was taken back from the store's linked account for the refund isn't taken again
+	store := batchFor(SettlementPayeeStore, order.StoreID, order.Currency.CurrencyCode)
+	store.settlement.Refunds += roundAmount(refund.Amount - refund.Reversed)
+}
+
+// addSettlementJobs adds the jobs completed in the period to their providers, see jobFarePayment for how their fares were paid.
+// The market takes the commission of the service type on each of them. Jobs completed but not paid yet are settled in the period they are paid in.
+func addSettlementJobs(start time.Time, end time.Time, batchFor func(string, primitive.ObjectID, string) *settlementBatch) error {
+	filter := bson.D{
+		{"$or", bson.A{
+			bson.D{{"completedAt", bson.M{"$gte": start, "$lt": end}}},
+			bson.D{{"completedAt", bson.M{"$lt": start}}, {"paidAt", bson.M{"$gte": start, "$lt": end}}},
+		}},
+		{"cancelledAt", nil},
+		{"providerId", bson.M{"$ne": ""}},
+		{"deletedAt", bson.M{"$exists": false}},
+	}
+	ctx := context.Background()
+	cur, err := database.MongoDB.Collection(JobsCollection).Find(ctx, filter, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		log.Errorln(err)
+		return err
+	}
+	defer cur.Close(ctx)
+	var jobs []*Job
+	var jobIDs bson.A
+	for cur.Next(ctx) {
+		job := &Job{}
+		err = cur.Decode(job)
+		if err != nil {
+			log.Errorln(err)
+			return err
+		}
+		//a job completed in an earlier period is only settled now when it was left out unpaid then
+		if job.CompletedAt.Before(start) && (job.PaymentMethodType == PaymentMethodTypeCash || !isJobPaid(job)) {
+			continue
+		}
+		jobs = append(jobs, job)
+		jobIDs = append(jobIDs, job.ID)
+	}
+	if err = cur.Err(); err != nil {
+		log.Errorln(err)
+		return err
+	}
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	captured := map[primitive.ObjectID]float64{}
+	holdFilter := bson.D{{"jobID", bson.M{"$in": jobIDs}}, {"status", WalletHoldStatusCaptured}}
+	holdCur, err := database.MongoDB.Collection(WalletHoldsCollection).Find(ctx, holdFilter)
+	if err != nil {
+		log.Errorln(err)
+		return err
+	}
+	defer holdCur.Close(ctx)
+	for holdCur.Next(ctx) {
+		hold := &WalletHold{}
+		err = holdCur.Decode(hold)
+		if err != nil {
+			log.Errorln(err)
+			return err
+		}
+		if hold.JobID != nil {
+			captured[*hold.JobID] += hold.CapturedAmount
+		}
+	}
+	if err = holdCur.Err(); err != nil {
+		log.Errorln(err)
+		return err
+	}
+
+	commissionEnabled := providerCommissionEnabled()
+	providers := map[string]*ServiceProvider{}
+	commissionRates := map[string]float64{}
+	for _, job := range jobs {
+		provider, ok := providers[job.ProviderID]
+		if !ok {
+			provider = GetServiceProviderByID(job.ProviderID)
+			providers[job.ProviderID] = provider
+		}
+		if provider == nil {
+			log.Errorf("provider %s of job %s not found", job.ProviderID, job.ID.Hex())
+			continue
+		}
+		walletAmount, walletCaptured := captured[job.ID]
+		payment := jobFarePayment(job, walletCaptured)
+		if payment == jobFareUnpaid {
+			log.Warnf("job %s of provider %s isn't paid yet, it is settled once it is", job.ID.Hex(), job.ProviderID)
+			continue
+		}
+		rate, ok := commissionRates[job.ServiceType]
+		if !ok {
+			rate = jobCommissionRate(job, commissionEnabled)
+			commissionRates[job.ServiceType] = rate
+		}
+		commission := roundAmount(job.FareAmount * rate / 100)
+		batch := batchFor(SettlementPayeeProvider, provider.ID, provider.Currency)
+		batch.settlement.JobIDs = append(batch.settlement.JobIDs, job.ID)
+		batch.settlement.Gross += job.FareAmount
+		batch.settlement.Commission += commission
+		switch payment {
+		case jobFareWallet:
+			batch.settlement.WalletCredited += walletAmount
+			batch.cardJobAmount += walletAmount - commission
+		case jobFareTransfer:
+			//paid to the provider's linked account by the gateway, less the commission
+			batch.settlement.Transferred += transferredAmount(job.PaymentTransfers, SettlementPayeeProvider)
+		case jobFareGateway:
+			batch.cardJobAmount += job.FareAmount - commission
+		case jobFareCash:
+			batch.settlement.CashCollected += job.FareAmount
+			batch.cashJobCommission += commission
+		}
+	}
+	return nil
+}
+
+// addSettlementJobRefunds takes the refunds of paid jobs back from their providers, those made since the job was last settled.
+// Only jobs completed before the end of the period are taken, the others are settled along with their fares.
+func addSettlementJobRefunds(end time.Time, batchFor func(string, primitive.ObjectID, string) *settlementBatch) error {
+	filter := bson.D{
+		{"completedAt", bson.M{"$lt": end}},
+		{"providerId", bson.M{"$ne": ""}},
+		{"refundedAmount", bson.M{"$gt": 0}},
+		{"$expr", bson.D{{"$gt", bson.A{"$refundedAmount", bson.D{{"$ifNull", bson.A{"$settledRefunds", 0}}}}}}},
+		{"deletedAt", bson.M{"$exists": false}},
+	}
+	ctx := context.Background()
+	cur, err := database.MongoDB.Collection(JobsCollection).Find(ctx, filter, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		log.Errorln(err)
+		return err
+	}
+	defer cur.Close(ctx)
+	providers := map[string]*ServiceProvider{}
+	for cur.Next(ctx) {
+		job := &Job{}
+		err = cur.Decode(job)
+		if err != nil {
+			log.Errorln(err)
+			return err
+		}
+		provider, ok := providers[job.ProviderID]
+		if !ok {
+			provider = GetServiceProviderByID(job.ProviderID)
+			providers[job.ProviderID] = provider
+		}
+		if provider == nil {
+			log.Errorf("provider %s of job %s not found", job.ProviderID, job.ID.Hex())
+			continue
+		}
+		refund := jobRefundToSettle(job)
+		if refund <= 0 {
+			//taken back from the provider's linked account already
+			continue
+		}
+		batch := batchFor(SettlementPayeeProvider, provider.ID, provider.Currency)
+		batch.settlement.Refunds += refund
+		if batch.jobRefunds == nil {
+			batch.jobRefunds = map[primitive.ObjectID]float64{}
+		}
+		batch.jobRefunds[job.ID] = settledJobRefunds(job)
+	}
+	if err = cur.Err(); err != nil {
+		log.Errorln(err)
+		return err
+	}
+	return nil
+}
+
+// jobRefundToSettle gives what has been refunded on a job since it was last settled and isn't taken back from the provider's linked account.
+func jobRefundToSettle(job *Job) float64 {
+	return math.Max(roundAmount(settledJobRefunds(job)-job.SettledRefunds), 0)
+}
+
+// settledJobRefunds gives the refunds of a job settlements take from its provider, what was refunded less what was
+// taken back from the provider's linked account for it.
+func settledJobRefunds(job *Job) float64 {
+	return roundAmount(job.RefundedAmount - reversedAmount(job.PaymentTransfers, SettlementPayeeProvider))
+}
+
+// jobCommissionRate gives the commission percentage the market takes from the fare of a job, by its service type.
+func jobCommissionRate(job *Job, commissionEnabled bool) float64 {
+	if !commissionEnabled {
+		return 0
+	}
+	if _, err := primitive.ObjectIDFromHex(job.ServiceType); err != nil {
+		return 0
+	}
+	serviceType, err := GetServiceTypeByID(job.ServiceType)
+	if err != nil || serviceType == nil {
+		return 0
+	}
+	return serviceType.Commission
+}
+
+// saveSettlement works out the net amount of a batch and stores it along with its payment reports,
+// nil when the payee was settled for the period already. The settlement, its cash liability offset, the outstanding
+// settlements it carries forward, the job refunds it takes back and its reports are saved in one transaction.
+func saveSettlement(batch *settlementBatch) (*Settlement, error) {
+	settlement := batch.settlement
+	ctx := context.Background()
+	collection := database.MongoDB.Collection(SettlementsCollection)
+	key := bson.D{{"payeeType", settlement.PayeeType}, {"payeeID", settlement.PayeeID}, {"currency", settlement.Currency}, {"periodStart", settlement.PeriodStart}}
+	count, err := collection.CountDocuments(ctx, key)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	if count > 0 {
+		return nil, nil
+	}
+
+	var bankAccountID primitive.ObjectID
+	switch settlement.PayeeType {
+	case SettlementPayeeStore:
+		store := GetStoreByID(settlement.PayeeID.Hex())
+		if store != nil {
+			settlement.PayeeName = store.StoreName
+			bankAccountID = store.BankAccountDetails
+		}
+	case SettlementPayeeProvider:
+		provider := GetServiceProviderByID(settlement.PayeeID.Hex())
+		if provider != nil {
+			settlement.PayeeName = strings.TrimSpace(provider.FirstName + " " + provider.LastName)
+			bankAccountID = provider.BankDetails
+		}
+	}
+	if !bankAccountID.IsZero() {
+		settlement.BankAccountID = &bankAccountID
+	}
+
+	//take back what the payee still owes from earlier settlements
+	outstandingFilter := bson.D{
+		{"payeeType", settlement.PayeeType},
+		{"payeeID", settlement.PayeeID},
+		{"currency", settlement.Currency},
+		{"status", SettlementStatusOutstanding},
+		{"periodEnd", bson.M{"$lte": settlement.PeriodStart}},
+	}
+	cur, err := collection.Find(ctx, outstandingFilter)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	var outstandingIDs bson.A
+	for cur.Next(ctx) {
+		outstanding := &Settlement{}
+		err = cur.Decode(outstanding)
+		if err != nil {
+			cur.Close(ctx)
+			log.Errorln(err)
+			return nil, err
+		}
+		settlement.CarriedForward -= outstanding.NetAmount
+		outstandingIDs = append(outstandingIDs, outstanding.ID)
+	}
+	cur.Close(ctx)
+
+	settlement.Gross = roundAmount(settlement.Gross)
+	settlement.Commission = roundAmount(settlement.Commission)
+	settlement.DeliveryCharges = roundAmount(settlement.DeliveryCharges)
+	settlement.Refunds = roundAmount(settlement.Refunds)
+	settlement.CashCollected = roundAmount(settlement.CashCollected)
+	settlement.WalletCredited = roundAmount(settlement.WalletCredited)
+	settlement.Transferred = roundAmount(settlement.Transferred)
+	settlement.CarriedForward = roundAmount(settlement.CarriedForward)
+	settlement.NetAmount = roundAmount(settlement.Gross - settlement.Commission - settlement.DeliveryCharges - settlement.Refunds -
+		settlement.CashCollected - settlement.WalletCredited - settlement.Transferred - settlement.CarriedForward)
+	var liability *CashLiability
+	if settlement.PayeeType == SettlementPayeeProvider {
+		settlement.CashLiabilityAccrued, err = settlementCashLiabilityAccrued(settlement)
+		if err != nil {
+			return nil, err
+		}
+		settlement.NetAmount = roundAmount(settlement.NetAmount + settlement.CashLiabilityAccrued)
+		if settlement.NetAmount > 0 {
+			liability, err = GetCashLiability(settlement.PayeeID, settlement.Currency)
+			if err != nil {
+				return nil, err
+			}
+			if liability != nil && liability.Balance > 0 {
+				settlement.CashLiabilityOffset = roundAmount(math.Min(settlement.NetAmount, liability.Balance))
+				settlement.NetAmount = roundAmount(settlement.NetAmount - settlement.CashLiabilityOffset)
+			}
+		}
+	}
+	switch {
+	case settlement.NetAmount > 0:
+		settlement.Status = SettlementStatusPending
+	case settlement.NetAmount < 0:
+		settlement.Status = SettlementStatusOutstanding
+	default:
+		settlement.Status = SettlementStatusSettled
+	}
+	now := time.Now()
+	settlement.ID = primitive.NewObjectID()
+	settlement.CreatedAt = now
+	settlement.UpdatedAt = now
+	var offset *CashLiabilityEntry
+	err = runWalletTransaction(func(sc mongo.SessionContext) error {
+		_, err := collection.InsertOne(sc, settlement)
+		if err != nil {
+			return err
+		}
+		if liability != nil {
+			offset, err = offsetSettlementCashLiability(sc, settlement, liability.ID)
+			if err != nil {
+				return err
+			}
+		}
+		if len(outstandingIDs) > 0 {
+			filter := bson.D{{"_id", bson.M{"$in": outstandingIDs}}, {"status", SettlementStatusOutstanding}}
+			update := bson.D{{"$set", bson.D{{"status", SettlementStatusCarriedForward}, {"carriedTo", settlement.ID}, {"updatedAt", now}}}}
+			result, err := collection.UpdateMany(sc, filter, update)
+			if err != nil {
+				return err
+			}
+			if result.ModifiedCount != int64(len(outstandingIDs)) {
+				return ErrSettlementCarryChanged
+			}
+			err = updateSettlementReports(sc, outstandingIDs, PaymentStatusSettled)
+			if err != nil {
+				return err
+			}
+		}
+		for jobID, refunded := range batch.jobRefunds {
+			update := bson.D{{"$max", bson.D{{"settledRefunds", refunded}}}, {"$set", bson.D{{"updatedAt", now}}}}
+			_, err = database.MongoDB.Collection(JobsCollection).UpdateOne(sc, bson.D{{"_id", jobID}}, update)
+			if err != nil {
+				return err
+			}
+		}
+		return createSettlementReports(sc, batch)
+	})
+	if err != nil {
+		if isDuplicateKeyError(err) {
+			//settled by a concurrent run
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	if offset != nil {
+		go webhooks.NewWebhookEvent("cash_liability_entry.created", offset)
+	}
+	return settlement, nil
+}
+
+// settlementPaymentStatus tells whether the payee of a settlement has been paid, or owes nothing more.
+func settlementPaymentStatus(settlement *Settlement) PaymentStatus {
+	switch settlement.Status {
+	case SettlementStatusPaid, SettlementStatusSettled, SettlementStatusCarriedForward:
+		return PaymentStatusSettled
+	}
+	return PaymentStatusUnsettled
+}
+
+// formatSettlementAmount formats an amount for the payment reports.
+func formatSettlementAmount(amount float64) string {
+	return fmt.Sprintf("%.2f", roundAmount(amount))
+}
+
+// settlementBankDetails describes the bank account a settlement is paid into for the payment reports.
+func settlementBankDetails(settlement *Settlement) *BankAccount {
+	if settlement.BankAccountID == nil {
+		return nil
+	}
+	bankAccount, err := GetBankAccountByID(settlement.BankAccountID.Hex())
+	if err != nil {
+		log.Errorln(err)
+		return nil
+	}
+	return bankAccount
+}
+
+// createSettlementReports writes the store payment report of each settled order, or the provider payment report of a provider settlement.
+func createSettlementReports(ctx context.Context, batch *settlementBatch) error {
+	settlement := batch.settlement
+	bankAccount := settlementBankDetails(settlement)
+	now := time.Now()
+	db := database.MongoDB
+
+	if settlement.PayeeType == SettlementPayeeProvider {
+		report := ProviderPaymentReport{
+			ID:           primitive.NewObjectID(),
+			CreatedAt:    now,
+			UpdatedAt:    now,
+			CreatedBy:    settlement.CreatedBy,
+			SettlementID: settlement.ID,
+			ProviderID:   settlement.PayeeID,
+			PeriodStart:  settlement.PeriodStart,
+			PeriodEnd:    settlement.PeriodEnd,
+			ProviderName: settlement.PayeeName,
+			TotalJobCommissionTakeFromProviderForCashJobs:        formatSettlementAmount(batch.cashJobCommission),
+			TotalJobAmountPayToProviderForCardJobs:               formatSettlementAmount(batch.cardJobAmount),
+			TotalFare:                                            formatSettlementAmount(settlement.Gross),
+			TotalCashReceived:                                    formatSettlementAmount(settlement.CashCollected),
+			TotalTaxAmountPayToProvider:                          formatSettlementAmount(0),
+			TotalTipAmountPayToProvider:                          formatSettlementAmount(0),
+			TotalWalletAdjustmentAmountPaytoProviderForCashJobs:  formatSettlementAmount(settlement.WalletCredited),
+			TotalCouponDiscountAmountPayToProviderForCashJobs:    formatSettlementAmount(0),
+			TotalJobOutstandingAmountTakeFromProviderForCashJobs: formatSettlementAmount(settlement.CarriedForward),
+			TotalJobBookingFeeForCash:                            formatSettlementAmount(0),
+			FinalAmountPayToProvider:                             formatSettlementAmount(0),
+			FinalAmountToTakebackFromProvider:                    formatSettlementAmount(0),
+			ProviderPaymentStatus:                                string(settlementPaymentStatus(settlement)),
+			IsActive:                                             true,
+		}
+		if bankAccount != nil {
+			report.ProviderBankDetails = strings.TrimSpace(bankAccount.BankName + " " + bankAccount.AccountNumber)
+		}
+		if settlement.NetAmount > 0 {
+			report.FinalAmountPayToProvider = formatSettlementAmount(settlement.NetAmount)
+		} else {
+			report.FinalAmountToTakebackFromProvider = formatSettlementAmount(-settlement.NetAmount)
+		}
+		_, err := db.Collection(ProviderPaymentReportCollection).InsertOne(ctx, &report)
+		return err
+	}
+
+	store := GetStoreByID(settlement.PayeeID.Hex())
+	var reports []interface{}
+	for _, order := range batch.orders {
+		isCashOrder := order.PaymentMethod.Type == PaymentMethodTypeCash
+		report := StorePaymentReport{
+			ID:                primitive.NewObjectID(),
+			CreatedAt:         now,
+			UpdatedAt:         now,
+			CreatedBy:         settlement.CreatedBy,
+			SettlementID:      settlement.ID,
+			StoreID:           settlement.PayeeID,
+			OrderID:           order.ID,
+			SelectStore:       settlement.PayeeID.Hex(),
+			ServiceType:       order.ServiceType,
+			StoreName:         settlement.PayeeName,
+			FinalAmount:       formatSettlementAmount(storeOrderAmount(order)),
+			PaymentStatus:     settlementPaymentStatus(settlement),
+			PaymentMethod:     PaymentTypeCard,
+			OrderNumber:       fmt.Sprint(order.OrderNumber),
+			UserName:          strings.TrimSpace(order.Billing.FirstName + " " + order.Billing.LastName),
+			OrderDate:         order.CreatedAt,
+			OrderStatus:       string(order.OrderStatus),
+			OrderAmount:       formatSettlementAmount(order.OrderTotalAmount),
+			SiteCommission:    formatSettlementAmount(order.Commission),
+			DeliveryCharges:   formatSettlementAmount(order.ShippingTotal),
+			OfferAmount:       formatSettlementAmount(order.DiscountAmount),
+			OutstandingAmount: formatSettlementAmount(0),
+			StoreAmount:       formatSettlementAmount(order.OrderTotalAmount - order.ShippingTotal - order.Commission),
+			IsActive:          true,
+		}
+		if store != nil && report.ServiceType == "" {
+			report.ServiceType = string(store.ServiceCategory)
+		}
+		if isCashOrder {
+			report.PaymentMethod = PaymentTypeCash
+		}
+		if isCashOrder && order.ProviderID.IsZero() {
+			//the store kept the cash, it owes the commission and delivery charges back
+			report.OutstandingAmount = formatSettlementAmount(order.ShippingTotal + order.Commission)
+		}
+		if !order.ProviderID.IsZero() {
+			provider := GetServiceProviderByID(order.ProviderID.Hex())
+			if provider != nil {
+				report.ProviderName = strings.TrimSpace(provider.FirstName + " " + provider.LastName)
+			}
+		}
+		if bankAccount != nil {
+			report.StoreAccountName = bankAccount.AccountHolderName
+			report.BankName = bankAccount.BankName
+			report.AccountNumber = bankAccount.AccountNumber
+			report.SortCode = bankAccount.RoutingNumber
+			if report.SortCode == "" {
+				report.SortCode = bankAccount.IfscCode
+			}
+		}
+		reports = append(reports, report)
+	}
+	if len(reports) == 0 {
+		return nil
+	}
+	_, err := db.Collection(StorePaymentReportCollection).InsertMany(ctx, reports)
+	return err
+}
+
+// storeOrderAmount gives what the market owes a store for an order, negative when the store kept the cash and owes the market.
+func storeOrderAmount(order *Order) float64 {
+	amount := order.OrderTotalAmount - order.ShippingTotal - order.Commission
+	if order.PaymentMethod.Type == PaymentMethodTypeCash && order.ProviderID.IsZero() {
+		amount -= order.OrderTotalAmount
+	}
+	return roundAmount(amount - transferredAmount(order.PaymentTransfers, SettlementPayeeStore))
+}
+
+// updateSettlementReports brings the payment status of the reports of settlements in line with the settlements.
+func updateSettlementReports(ctx context.Context, settlementIDs bson.A, status PaymentStatus) error {
+	db := database.MongoDB
+	filter := bson.D{{"settlementID", bson.M{"$in": settlementIDs}}}
+	_, err := db.Collection(StorePaymentReportCollection).UpdateMany(ctx, filter, bson.D{{"$set", bson.D{{"paymentStatus", status}, {"updatedAt", time.Now()}}}})
+	if err != nil {
+		log.Errorln(err)
+		return err
+	}
+	_, err = db.Collection(ProviderPaymentReportCollection).UpdateMany(ctx, filter, bson.D{{"$set", bson.D{{"providerPaymentStatus", string(status)}, {"updatedAt", time.Now()}}}})
+	if err != nil {
+		log.Errorln(err)
+		return err
+	}
+	return nil
+}
+
+// GetSettlementsByFilter gives the settlements matching a filter, oldest first.
+func GetSettlementsByFilter(filter bson.D) ([]*Settlement, error) {
+	ctx := context.Background()
+	cur, err := database.MongoDB.Collection(SettlementsCollection).Find(ctx, filter, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var settlements []*Settlement
+	for cur.Next(ctx) {
+		settlement := &Settlement{}
+		err = cur.Decode(settlement)
+		if err != nil {
+			log.Errorln(err)
+			return nil, err
+		}
+		settlements = append(settlements, settlement)
+	}
+	if err = cur.Err(); err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	return settlements, nil
+}
+
+// ClaimSettlementPayouts claims the pending settlements of the payouts for a payout file before it is written,
+// giving the payouts it claimed. Settlements claimed for another file by a concurrent run are left out.
+func ClaimSettlementPayouts(payouts []SettlementPayout, payoutFile string, now time.Time) ([]SettlementPayout, error) {
+	if len(payouts) == 0 {
+		return nil, nil
+	}
+	var ids bson.A
+	for _, payout := range payouts {
+		ids = append(ids, payout.Settlement.ID)
+	}
+	filter := bson.D{{"_id", bson.M{"$in": ids}}, {"status", SettlementStatusPending}}
+	update := bson.D{{"$set", bson.D{{"status", SettlementStatusExporting}, {"payoutFile", payoutFile}, {"updatedAt", now}}}}
+	_, err := database.MongoDB.Collection(SettlementsCollection).UpdateMany(context.Background(), filter, update)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	settlements, err := GetSettlementsByFilter(bson.D{{"payoutFile", payoutFile}, {"status", SettlementStatusExporting}})
+	if err != nil {
+		return nil, err
+	}
+	claimed := map[primitive.ObjectID]*Settlement{}
+	for _, settlement := range settlements {
+		claimed[settlement.ID] = settlement
+	}
+	var claimedPayouts []SettlementPayout
+	for _, payout := range payouts {
+		if settlement, ok := claimed[payout.Settlement.ID]; ok {
+			claimedPayouts = append(claimedPayouts, SettlementPayout{Settlement: settlement, BankAccount: payout.BankAccount})
+		}
+	}
+	return claimedPayouts, nil
+}
+
+// ReleaseSettlementPayouts gives the settlements claimed for a payout file that couldn't be written back to the next file.
+func ReleaseSettlementPayouts(payoutFile string, now time.Time) error {
+	filter := bson.D{{"payoutFile", payoutFile}, {"status", SettlementStatusExporting}}
+	update := bson.D{{"$set", bson.D{{"status", SettlementStatusPending}, {"payoutFile", ""}, {"updatedAt", now}}}}
+	_, err := database.MongoDB.Collection(SettlementsCollection).UpdateMany(context.Background(), filter, update)
+	if err != nil {
+		log.Errorln(err)
+		return err
+	}
+	return nil
+}
+
+// MarkSettlementsExported marks the settlements claimed for a payout file exported once the file is written, giving how many were marked.
+func MarkSettlementsExported(payoutFile string, now time.Time) (int, error) {
+	filter := bson.D{{"payoutFile", payoutFile}, {"status", SettlementStatusExporting}}
+	update := bson.D{{"$set", bson.D{{"status", SettlementStatusExported}, {"exportedAt", now}, {"updatedAt", now}}}}
+	result, err := database.MongoDB.Collection(SettlementsCollection).UpdateMany(context.Background(), filter, update)
+	if err != nil {
+		log.Errorln(err)
+		return 0, err
+	}
+	return int(result.ModifiedCount), nil
+}
+
+// MarkSettlementsPaid marks the settlements of a payout file paid once the bank has confirmed it, giving how many were marked.
+func MarkSettlementsPaid(payoutFile string, now time.Time) (int, error) {
+	settlements, err := GetSettlementsByFilter(bson.D{{"payoutFile", payoutFile}, {"status", SettlementStatusExported}})
+	if err != nil || len(settlements) == 0 {
+		return 0, err
+	}
+	var ids bson.A
+	for _, settlement := range settlements {
+		ids = append(ids, settlement.ID)
+	}
+	filter := bson.D{{"_id", bson.M{"$in": ids}}}
+	update := bson.D{{"$set", bson.D{{"status", SettlementStatusPaid}, {"paidAt", now}, {"updatedAt", now}}}}
+	_, err = database.MongoDB.Collection(SettlementsCollection).UpdateMany(context.Background(), filter, update)
+	if err != nil {
+		log.Errorln(err)
+		return 0, err
+	}
+	return len(settlements), updateSettlementReports(context.Background(), ids, PaymentStatusSettled)
+}
@@ -0,0 +1,452 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var (
+	ErrNACHAOriginatorInvalid = errors.New("ACH originator needs a destination, origin, company id and originating bank")
+	ErrInvalidRoutingNumber   = errors.New("invalid ABA routing number")
+	ErrBankFileFormatInvalid  = errors.New("invalid bank file format")
+	ErrNACHAAmountInvalid     = errors.New("amount doesn't fit its field of the ACH file")
+)
+
+// Layouts of a bank payout file.
+const (
+	BankFileLayoutCSV   = "csv"
+	BankFileLayoutFixed = "fixed"
+)
+
+// Fields a bank payout file column can take its value from.
+const (
+	BankFileFieldConst             = "const"
+	BankFileFieldPayeeName         = "payeeName"
+	BankFileFieldAccountHolderName = "accountHolderName"
+	BankFileFieldAccountNumber     = "accountNumber"
+	BankFileFieldIfscCode          = "ifscCode"
+	BankFileFieldRoutingNumber     = "routingNumber"
+	BankFileFieldSwiftCode         = "swiftCode"
+	BankFileFieldBankName          = "bankName"
+	BankFileFieldAmount            = "amount"
+	BankFileFieldAmountMinor       = "amountMinor"
+	BankFileFieldCurrency          = "currency"
+	BankFileFieldReference         = "reference"
+	BankFileFieldNarration         = "narration"
+	BankFileFieldDate              = "date"
+)
+
+// SettlementPayout is a settlement along with the bank account it is paid into.
+type SettlementPayout struct {
+	Settlement  *Settlement
+	BankAccount *BankAccount
+}
+
+// NACHAOriginator describes the company sending an ACH file and the bank it is sent through.
+type NACHAOriginator struct {
+	ImmediateDestination     string `json:"immediateDestination"`
+	ImmediateDestinationName string `json:"immediateDestinationName"`
+	ImmediateOrigin          string `json:"immediateOrigin"`
+	ImmediateOriginName      string `json:"immediateOriginName"`
+	CompanyName              string `json:"companyName"`
+	CompanyID                string `json:"companyID"`
+	OriginatingDFI           string `json:"originatingDFI"`
+	EntryDescription         string `json:"entryDescription"`
+}
+
+// BankFileColumn is a column of a bank payout file, fixed width files pad or cut each value to its width.
+type BankFileColumn struct {
+	Title      string `json:"title"`
+	Field      string `json:"field"`
+	Value      string `json:"value"`
+	Width      int    `json:"width"`
+	AlignRight bool   `json:"alignRight"`
+	Pad        string `json:"pad"`
+}
+
+// BankFileFormat describes the bulk payment upload file of a bank, either a delimited or a fixed width file.
+type BankFileFormat struct {
+	Layout     string           `json:"layout"`
+	Delimiter  string           `json:"delimiter"`
+	Header     bool             `json:"header"`
+	DateFormat string           `json:"dateFormat"`
+	Columns    []BankFileColumn `json:"columns"`
+}
+
+// AxisBankFileFormat is the bulk NEFT upload of Axis Bank, the default format of bank payout files.
+var AxisBankFileFormat = BankFileFormat{
+	Layout:     BankFileLayoutCSV,
+	Delimiter:  ",",
+	Header:     true,
+	DateFormat: "02-01-2006",
+	Columns: []BankFileColumn{
+		{Title: "Payment Mode", Field: BankFileFieldConst, Value: "NEFT"},
+		{Title: "Amount", Field: BankFileFieldAmount},
+		{Title: "Value Date", Field: BankFileFieldDate},
+		{Title: "Beneficiary Name", Field: BankFileFieldAccountHolderName},
+		{Title: "Beneficiary Account Number", Field: BankFileFieldAccountNumber},
+		{Title: "IFSC Code", Field: BankFileFieldIfscCode},
+		{Title: "Customer Reference Number", Field: BankFileFieldReference},
+		{Title: "Narration", Field: BankFileFieldNarration},
+	},
+}
+
+// GetSettlementPayouts gives the pending settlements along with their bank accounts, leaving out the ones without a usable bank account.
+func GetSettlementPayouts() ([]SettlementPayout, error) {
+	settlements, err := GetSettlementsByFilter(bson.D{{"status", SettlementStatusPending}})
+	if err != nil {
+		return nil, err
+	}
+	var payouts []SettlementPayout
+	for _, settlement := range settlements {
+		bankAccount := settlementBankDetails(settlement)
+		if bankAccount == nil || bankAccount.AccountNumber == "" {
+			log.Warnf("%s %s has no bank account to pay settlement %s into", settlement.PayeeType, settlement.PayeeID.Hex(), settlement.ID.Hex())
+			continue
+		}
+		payouts = append(payouts, SettlementPayout{Settlement: settlement, BankAccount: bankAccount})
+	}
+	return payouts, nil
+}
+
+// SplitACHPayouts separates the payouts into accounts reachable over ACH, the ones with an ABA routing number, and the rest.
+func SplitACHPayouts(payouts []SettlementPayout) (ach []SettlementPayout, others []SettlementPayout) {
+	for _, payout := range payouts {
+		if ValidRoutingNumber(payout.BankAccount.RoutingNumber) {
+			ach = append(ach, payout)
+		} else {
+			others = append(others, payout)
+		}
+	}
+	return ach, others
+}
+
+// ValidRoutingNumber checks the length and check digit of an ABA routing number.
+func ValidRoutingNumber(routingNumber string) bool {
+	if len(routingNumber) != 9 {
+		return false
+	}
+	weights := []int{3, 7, 1}
+	sum := 0
+	for i, r := range routingNumber {
+		if r < '0' || r > '9' {
+			return false
+		}
+		sum += int(r-'0') * weights[i%3]
+	}
+	return sum%10 == 0
+}
+
+// payoutReference is the reference of a settlement on bank statements.
+func payoutReference(settlement *Settlement) string {
+	return strings.ToUpper(settlement.ID.Hex())
+}
+
+// minorUnits gives an amount in cents or paise.
+func minorUnits(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// nachaField pads or cuts a value to the width of a NACHA field, text is left aligned and padded with spaces, numbers right aligned with zeros.
+// Only text and the entry hash, which keeps its rightmost digits, may be cut, amounts go through nachaAmount.
+func nachaField(value string, width int, numeric bool) string {
+	value = strings.ToUpper(value)
+	if len(value) > width {
+		if numeric {
+			return value[len(value)-width:]
+		}
+		return value[:width]
+	}
+	if numeric {
+		return strings.Repeat("0", width-len(value)) + value
+	}
+	return value + strings.Repeat(" ", width-len(value))
+}
+
+// nachaAmount formats an amount in cents for a NACHA field, failing instead of cutting an amount too wide for the field.
+func nachaAmount(amount int64, width int) (string, error) {
+	value := strconv.FormatInt(amount, 10)
+	if amount < 0 || len(value) > width {
+		return "", ErrNACHAAmountInvalid
+	}
+	return nachaField(value, width, true), nil
+}
+
+// nachaRoutingField formats the immediate destination or origin of a NACHA file, a routing number goes in with a leading space.
+func nachaRoutingField(value string) string {
+	if len(value) == 9 {
+		return " " + value
+	}
+	return nachaField(value, 10, false)
+}
+
+// WriteNACHAFile writes a NACHA ACH file crediting each payout to its checking account, stores and providers in their own CCD and PPD batches.
+func WriteNACHAFile(w io.Writer, originator NACHAOriginator, payouts []SettlementPayout, now time.Time) error {
+	if !ValidRoutingNumber(originator.ImmediateDestination) || originator.ImmediateOrigin == "" || originator.CompanyID == "" || len(originator.OriginatingDFI) != 8 {
+		return ErrNACHAOriginatorInvalid
+	}
+	description := originator.EntryDescription
+	if description == "" {
+		description = "SETTLEMENT"
+	}
+	var lines []string
+	lines = append(lines, "1"+"01"+
+		nachaRoutingField(originator.ImmediateDestination)+
+		nachaRoutingField(originator.ImmediateOrigin)+
+		now.Format("060102")+now.Format("1504")+"A"+"094"+"10"+"1"+
+		nachaField(originator.ImmediateDestinationName, 23, false)+
+		nachaField(originator.ImmediateOriginName, 23, false)+
+		nachaField("", 8, false))
+
+	batches := []struct {
+		payeeType string
+		secCode   string
+	}{{SettlementPayeeStore, "CCD"}, {SettlementPayeeProvider, "PPD"}}
+	batchCount, entryCount := 0, 0
+	var fileHash, fileCredit int64
+	for _, batch := range batches {
+		var entries []SettlementPayout
+		for _, payout := range payouts {
+			if payout.Settlement.PayeeType == batch.payeeType {
+				entries = append(entries, payout)
+			}
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		batchCount++
+		batchNumber := strconv.Itoa(batchCount)
+		lines = append(lines, "5"+"220"+
+			nachaField(originator.CompanyName, 16, false)+
+			nachaField("", 20, false)+
+			nachaField(originator.CompanyID, 10, false)+
+			batch.secCode+
+			nachaField(description, 10, false)+
+			now.Format("060102")+now.Format("060102")+
+			nachaField("", 3, false)+"1"+
+			originator.OriginatingDFI+
+			nachaField(batchNumber, 7, true))
+		var batchHash, batchCredit int64
+		for _, payout := range entries {
+			routingNumber := payout.BankAccount.RoutingNumber
+			if !ValidRoutingNumber(routingNumber) {
+				return ErrInvalidRoutingNumber
+			}
+			entryCount++
+			receivingDFI, _ := strconv.ParseInt(routingNumber[:8], 10, 64)
+			amount := minorUnits(payout.Settlement.NetAmount)
+			batchHash += receivingDFI
+			batchCredit += amount
+			//the counter at the end of the settlement id keeps the individual id unique
+			reference := payoutReference(payout.Settlement)
+			name := payout.BankAccount.AccountHolderName
+			if name == "" {
+				name = payout.Settlement.PayeeName
+			}
+			amountField, err := nachaAmount(amount, 10)
+			if err != nil {
+				return err
+			}
+			lines = append(lines, "6"+"22"+routingNumber+
+				nachaField(payout.BankAccount.AccountNumber, 17, false)+
+				amountField+
+				nachaField(reference[len(reference)-15:], 15, false)+
+				nachaField(name, 22, false)+
+				nachaField("", 2, false)+"0"+
+				originator.OriginatingDFI+nachaField(strconv.Itoa(entryCount), 7, true))
+		}
+		batchCreditField, err := nachaAmount(batchCredit, 12)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, "8"+"220"+
+			nachaField(strconv.Itoa(len(entries)), 6, true)+
+			nachaField(strconv.FormatInt(batchHash, 10), 10, true)+
+			nachaField("0", 12, true)+
+			batchCreditField+
+			nachaField(originator.CompanyID, 10, false)+
+			nachaField("", 19, false)+nachaField("", 6, false)+
+			originator.OriginatingDFI+
+			nachaField(batchNumber, 7, true))
+		fileHash += batchHash
+		fileCredit += batchCredit
+	}
+
+	fileCreditField, err := nachaAmount(fileCredit, 12)
+	if err != nil {
+		return err
+	}
+	blockCount := (len(lines) + 1 + 9) / 10
+	lines = append(lines, "9"+
+		nachaField(strconv.Itoa(batchCount), 6, true)+
+		nachaField(strconv.Itoa(blockCount), 6, true)+
+		nachaField(strconv.Itoa(entryCount), 8, true)+
+		nachaField(strconv.FormatInt(fileHash, 10), 10, true)+
+		nachaField("0", 12, true)+
+		fileCreditField+
+		nachaField("", 39, false))
+	//fill the last block up with lines of nines
+	for len(lines)%10 != 0 {
+		lines = append(lines, strings.Repeat("9", 94))
+	}
+
+	buf := bufio.NewWriter(w)
+	for _, line := range lines {
+		_, err := buf.WriteString(line + "\n")
+		if err != nil {
+			return err
+		}
+	}
+	return buf.Flush()
+}
+
+// Validate checks the layout of a bank file format and the fields of its columns.
+func (format BankFileFormat) Validate() error {
+	if len(format.Columns) == 0 {
+		return ErrBankFileFormatInvalid
+	}
+	switch format.Layout {
+	case BankFileLayoutCSV:
+		if utf8.RuneCountInString(format.Delimiter) > 1 {
+			return ErrBankFileFormatInvalid
+		}
+	case BankFileLayoutFixed:
+	default:
+		return ErrBankFileFormatInvalid
+	}
+	for _, column := range format.Columns {
+		if format.Layout == BankFileLayoutFixed && column.Width <= 0 {
+			return ErrBankFileFormatInvalid
+		}
+		switch column.Field {
+		case BankFileFieldConst, BankFileFieldPayeeName, BankFileFieldAccountHolderName, BankFileFieldAccountNumber,
+			BankFileFieldIfscCode, BankFileFieldRoutingNumber, BankFileFieldSwiftCode, BankFileFieldBankName,
+			BankFileFieldAmount, BankFileFieldAmountMinor, BankFileFieldCurrency, BankFileFieldReference,
+			BankFileFieldNarration, BankFileFieldDate:
+		default:
+			return ErrBankFileFormatInvalid
+		}
+	}
+	return nil
+}
+
+// bankFileValue gives the value of a column for a payout.
+func (format BankFileFormat) bankFileValue(column BankFileColumn, payout SettlementPayout, now time.Time) string {
+	settlement, bankAccount := payout.Settlement, payout.BankAccount
+	switch column.Field {
+	case BankFileFieldConst:
+		return column.Value
+	case BankFileFieldPayeeName:
+		return settlement.PayeeName
+	case BankFileFieldAccountHolderName:
+		if bankAccount.AccountHolderName != "" {
+			return bankAccount.AccountHolderName
+		}
+		return settlement.PayeeName
+	case BankFileFieldAccountNumber:
+		return bankAccount.AccountNumber
+	case BankFileFieldIfscCode:
+		return bankAccount.IfscCode
+	case BankFileFieldRoutingNumber:
+		return bankAccount.RoutingNumber
+	case BankFileFieldSwiftCode:
+		return bankAccount.SwiftCode
+	case BankFileFieldBankName:
+		return bankAccount.BankName
+	case BankFileFieldAmount:
+		return fmt.Sprintf("%.2f", settlement.NetAmount)
+	case BankFileFieldAmountMinor:
+		return strconv.FormatInt(minorUnits(settlement.NetAmount), 10)
+	case BankFileFieldCurrency:
+		return settlement.Currency
+	case BankFileFieldReference:
+		return payoutReference(settlement)
+	case BankFileFieldNarration:
+		return fmt.Sprintf("Settlement %s to %s", settlement.PeriodStart.Format("2006-01-02"), settlement.PeriodEnd.Format("2006-01-02"))
+	case BankFileFieldDate:
+		dateFormat := format.DateFormat
+		if dateFormat == "" {
+			dateFormat = "2006-01-02"
+		}
+		return now.Format(dateFormat)
+	}
+	return ""
+}
+
+// fixedWidthField pads or cuts a value to the width of its column.
+func fixedWidthField(column BankFileColumn, value string) string {
+	pad := " "
+	if column.Pad != "" {
+		pad = string([]rune(column.Pad)[:1])
+	}
+	runes := []rune(value)
+	if len(runes) > column.Width {
+		return string(runes[:column.Width])
+	}
+	padding := strings.Repeat(pad, column.Width-len(runes))
+	if column.AlignRight {
+		return padding + value
+	}
+	return value + padding
+}
+
+// WriteBankFile writes the payouts in the bulk payment upload format of a bank.
+func WriteBankFile(w io.Writer, format BankFileFormat, payouts []SettlementPayout, now time.Time) error {
+	err := format.Validate()
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	if format.Header {
+		var header []string
+		for _, column := range format.Columns {
+			header = append(header, column.Title)
+		}
+		rows = append(rows, header)
+	}
+	for _, payout := range payouts {
+		var row []string
+		for _, column := range format.Columns {
+			row = append(row, format.bankFileValue(column, payout, now))
+		}
+		rows = append(rows, row)
+	}
+
+	if format.Layout == BankFileLayoutCSV {
+		writer := csv.NewWriter(w)
+		if format.Delimiter != "" {
+			writer.Comma, _ = utf8.DecodeRuneInString(format.Delimiter)
+		}
+		err = writer.WriteAll(rows)
+		if err != nil {
+			return err
+		}
+		return writer.Error()
+	}
+	buf := bufio.NewWriter(w)
+	for _, row := range rows {
+		var line strings.Builder
+		for i, column := range format.Columns {
+			line.WriteString(fixedWidthField(column, row[i]))
+		}
+		_, err = buf.WriteString(line.String() + "\n")
+		if err != nil {
+			return err
+		}
+	}
+	return buf.Flush()
+}
@@ -0,0 +1,182 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJobFarePayment(t *testing.T) {
+	paid := JobPaymentStatusPaid
+	failed := JobPaymentStatusFailed
+
+	require.Equal(t, jobFareWallet, jobFarePayment(&Job{}, true))
+	require.Equal(t, jobFareTransfer, jobFarePayment(&Job{PaymentStatus: &paid, PaymentTransfers: []PaymentTransfer{{PayeeType: SettlementPayeeProvider, Amount: 80}}}, false))
+	require.Equal(t, jobFareCash, jobFarePayment(&Job{PaymentMethodType: PaymentMethodTypeCash}, false))
+	//charged to a saved card after the job, the market holds the fare
+	require.Equal(t, jobFareGateway, jobFarePayment(&Job{PaymentMethodType: PaymentMethodTypeCredit, PaymentStatus: &paid}, false))
+	//neither paid nor cash, nothing is settled for it yet
+	require.Equal(t, jobFareUnpaid, jobFarePayment(&Job{}, false))
+	require.Equal(t, jobFareUnpaid, jobFarePayment(&Job{PaymentMethodType: PaymentMethodTypeCredit, PaymentStatus: &failed}, false))
+}
+
+func TestJobRefundToSettle(t *testing.T) {
+	require.Equal(t, 30.0, jobRefundToSettle(&Job{RefundedAmount: 30}))
+	require.Equal(t, 20.0, jobRefundToSettle(&Job{RefundedAmount: 50, SettledRefunds: 30}))
+	require.Equal(t, 0.0, jobRefundToSettle(&Job{RefundedAmount: 50, SettledRefunds: 50}))
+
+	//what was taken back from the provider's linked account isn't settled again
+	reversed := []PaymentTransfer{{ID: "t1", PayeeType: SettlementPayeeProvider, Amount: 80, ReversedAmount: 30}}
+	require.Equal(t, 20.0, jobRefundToSettle(&Job{RefundedAmount: 50, PaymentTransfers: reversed}))
+	require.Equal(t, 0.0, jobRefundToSettle(&Job{RefundedAmount: 30, PaymentTransfers: reversed}))
+}
+
+func TestSettlesOrder(t *testing.T) {
+	now := time.Now()
+	require.True(t, settlesOrder(&Order{OrderStatus: OrderStatusDelivered, DateCompleted: now, DatePaid: now}))
+	//refunded in full after it was delivered
+	require.True(t, settlesOrder(&Order{OrderStatus: OrderStatusRefunded, DateCompleted: now, DatePaid: now}))
+	//cancelled and refunded before it was delivered
+	require.False(t, settlesOrder(&Order{OrderStatus: OrderStatusRefunded, DatePaid: now}))
+	require.False(t, settlesOrder(&Order{OrderStatus: OrderStatusDelivered, DateCompleted: now}))
+	require.False(t, settlesOrder(&Order{OrderStatus: OrderStatusCompleted, DateCompleted: now, DatePaid: now, ChildOrders: []primitive.ObjectID{primitive.NewObjectID()}}))
+}
+
+func TestOrderRefundSettledIn(t *testing.T) {
+	start := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 7)
+	before, during, after := start.Add(-time.Hour), start.Add(time.Hour), end.Add(time.Hour)
+	order := func(status OrderStatus, completed time.Time) *Order {
+		return &Order{OrderStatus: status, DateCompleted: completed, DatePaid: start.AddDate(0, 0, -7)}
+	}
+	tests := []struct {
+		name      string
+		processed time.Time
+		order     *Order
+		settled   bool
+	}{
+		{"order refunded in full in the period it completed in", during, order(OrderStatusRefunded, during), true},
+		{"refund of an order settled in an earlier period", during, order(OrderStatusCompleted, before), true},
+		{"refund made before the order was settled in the period", before, order(OrderStatusDelivered, during), true},
+		{"refund taken back in an earlier period", before, order(OrderStatusCompleted, before), false},
+		{"refund of an order settled in a later period", during, order(OrderStatusDelivered, after), false},
+		{"refund of an order cancelled before it was delivered", during, order(OrderStatusRefunded, time.Time{}), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			processed := test.processed
+			refund := &OrderRefund{ProcessedAt: &processed}
+			require.Equal(t, test.settled, orderRefundSettledIn(refund, test.order, start, end))
+		})
+	}
+	require.False(t, orderRefundSettledIn(&OrderRefund{}, order(OrderStatusCompleted, during), start, end))
+}
+
+func TestSettlementOfOrderRefundedInFull(t *testing.T) {
+	start := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 7)
+	delivered, refunded := start.Add(time.Hour), start.Add(2*time.Hour)
+	settle := func(periods ...time.Time) map[string]*settlementBatch {
+		batches := map[string]*settlementBatch{}
+		batchFor := func(payeeType string, payeeID primitive.ObjectID, currency string) *settlementBatch {
+			if batches[payeeType] == nil {
+				batches[payeeType] = &settlementBatch{settlement: &Settlement{PayeeType: payeeType, PayeeID: payeeID, Currency: currency}}
+			}
+			return batches[payeeType]
+		}
+		order := &Order{
+			ID:               primitive.NewObjectID(),
+			StoreID:          primitive.NewObjectID(),
+			ProviderID:       primitive.NewObjectID(),
+			OrderStatus:      OrderStatusRefunded,
+			OrderTotalAmount: 110,
+			ShippingTotal:    10,
+			Commission:       15,
+			DateCompleted:    delivered,
+			DatePaid:         delivered,
+			PaymentMethod:    PaymentMethod{Type: PaymentMethodTypeCredit},
+		}
+		refund := &OrderRefund{OrderID: order.ID, Amount: 110, ProcessedAt: &refunded}
+		for i := 0; i+1 < len(periods); i++ {
+			if !order.DateCompleted.Before(periods[i]) && order.DateCompleted.Before(periods[i+1]) {
+				addSettlementOrder(order, batchFor)
+			}
+			addSettlementRefund(refund, order, periods[i], periods[i+1], batchFor)
+		}
+		return batches
+	}
+
+	batches := settle(start, end)
+	store := batches[SettlementPayeeStore].settlement
+	require.Equal(t, 110.0, store.Gross)
+	require.Equal(t, 110.0, store.Refunds)
+	require.Equal(t, 15.0, store.Commission)
+	require.Equal(t, 10.0, batches[SettlementPayeeProvider].settlement.Gross)
+
+	//settled the same as when the refund comes in the period after the order
+	refunded = end.Add(time.Hour)
+	split := settle(start, end, end.AddDate(0, 0, 7))[SettlementPayeeStore].settlement
+	require.Equal(t, []float64{store.Gross, store.Commission, store.DeliveryCharges, store.Refunds},
+		[]float64{split.Gross, split.Commission, split.DeliveryCharges, split.Refunds})
+
+	//the refund is taken back once across the periods
+	refunded = start.Add(2 * time.Hour)
+	require.Equal(t, 110.0, settle(start.AddDate(0, 0, -7), start, end, end.AddDate(0, 0, 7))[SettlementPayeeStore].settlement.Refunds)
+}
+
+func TestStoreOrderAmount(t *testing.T) {
+	card := &Order{OrderTotalAmount: 110, ShippingTotal: 10, Commission: 15, PaymentMethod: PaymentMethod{Type: PaymentMethodTypeCredit}}
+	require.Equal(t, 85.0, storeOrderAmount(card))
+
+	//part of it was transferred to the store's linked account already
+	card.PaymentTransfers = []PaymentTransfer{{PayeeType: SettlementPayeeStore, Amount: 85}}
+	require.Equal(t, 0.0, storeOrderAmount(card))
+
+	//the store kept the cash, it owes the commission and delivery charges
+	cash := &Order{OrderTotalAmount: 110, ShippingTotal: 10, Commission: 15, PaymentMethod: PaymentMethod{Type: PaymentMethodTypeCash}}
+	require.Equal(t, -25.0, storeOrderAmount(cash))
+
+	//a delivery provider collected the cash and owes it instead
+	cash.ProviderID = primitive.NewObjectID()
+	require.Equal(t, 85.0, storeOrderAmount(cash))
+}
+
+func TestNACHAAmount(t *testing.T) {
+	field, err := nachaAmount(12345, 10)
+	require.NoError(t, err)
+	require.Equal(t, "0000012345", field)
+
+	_, err = nachaAmount(12345678901, 10)
+	require.Equal(t, ErrNACHAAmountInvalid, err)
+	_, err = nachaAmount(-1, 10)
+	require.Equal(t, ErrNACHAAmountInvalid, err)
+}
+
+func TestWriteNACHAFile(t *testing.T) {
+	originator := NACHAOriginator{ImmediateDestination: "011000015", ImmediateOrigin: "1234567890", CompanyID: "1234567890", OriginatingDFI: "01100001", CompanyName: "Tribe"}
+	payout := SettlementPayout{
+		Settlement:  &Settlement{ID: primitive.NewObjectID(), PayeeType: SettlementPayeeStore, PayeeName: "Store", NetAmount: 125.5},
+		BankAccount: &BankAccount{RoutingNumber: "011000015", AccountNumber: "12345", AccountHolderName: "Store"},
+	}
+	now := time.Date(2019, 10, 1, 9, 30, 0, 0, time.UTC)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, WriteNACHAFile(buf, originator, []SettlementPayout{payout}, now))
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 10)
+	for _, line := range lines {
+		require.Len(t, line, 94)
+	}
+	require.Equal(t, "0000012550", lines[2][29:39])
+
+	//an amount too wide for its field fails the file instead of being cut
+	payout.Settlement.NetAmount = 123456789.01
+	require.Equal(t, ErrNACHAAmountInvalid, WriteNACHAFile(&bytes.Buffer{}, originator, []SettlementPayout{payout}, now))
+}
@@ -1,20 +1,28 @@
 package models
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"github.com/go-redis/redis"
 	log "github.com/sirupsen/logrus"
 	"github.com/tribehq/platform/lib/cache"
 	"github.com/tribehq/platform/lib/database"
+	"github.com/tribehq/platform/lib/msg91"
 	"github.com/tribehq/platform/utils/webhooks"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"text/template"
 	"time"
 )
 
+// ErrSMSTemplateNotFound is returned when no sms template exists for a code and language.
+var ErrSMSTemplateNotFound = errors.New("sms template not found")
+
 // SMSTemplate represents a sms template.
 type SMSTemplate struct {
 	ID         primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
@@ -172,6 +180,55 @@ func DeleteSMSTemplateByID(ID string) (bool, error) {
 	return true, nil
 }
 
+// GetSMSTemplateByCode gives the sms template with a code in a language.
+func GetSMSTemplateByCode(code string, language string) (*SMSTemplate, error) {
+	smsTemplate := &SMSTemplate{}
+	filter := bson.D{{"code", code}, {"language", language}, {"deletedAt", bson.M{"$exists": false}}}
+	err := database.MongoDB.Collection(SMSTemplateCollection).FindOne(context.Background(), filter).Decode(smsTemplate)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	return smsTemplate, nil
+}
+
+// renderSMSTemplate renders the title and body of a sms template with data.
+func renderSMSTemplate(smsTemplate *SMSTemplate, data interface{}) (string, string, error) {
+	var rendered [2]string
+	for i, text := range []string{smsTemplate.Title, smsTemplate.Body} {
+		t, err := template.New(smsTemplate.Code).Parse(text)
+		if err != nil {
+			return "", "", err
+		}
+		buf := new(bytes.Buffer)
+		if err = t.Execute(buf, data); err != nil {
+			return "", "", err
+		}
+		rendered[i] = buf.String()
+	}
+	return rendered[0], rendered[1], nil
+}
+
+// SendSMS sends the sms template with a code in a language, rendered with data, to a mobile number.
+func SendSMS(mobileNo string, code string, language string, data interface{}) error {
+	smsTemplate, err := GetSMSTemplateByCode(code, language)
+	if err != nil {
+		return err
+	}
+	if smsTemplate == nil {
+		return ErrSMSTemplateNotFound
+	}
+	_, body, err := renderSMSTemplate(smsTemplate, data)
+	if err != nil {
+		return err
+	}
+	_, err = msg91.SendMessage(body, false, strings.TrimPrefix(mobileNo, "+"))
+	return err
+}
+
 //UnmarshalBinary required for the redis cache to work
 func (smsTemplate *SMSTemplate) UnmarshalBinary(data []byte) error {
 	if err := json.Unmarshal(data, smsTemplate); err != nil {
@@ -21,38 +21,41 @@ import (
 
 // Store represents a store.
 type Store struct {
-	ID                       primitive.ObjectID  `json:"id,omitempty" bson:"_id,omitempty"`
-	CreatedAt                time.Time           `json:"createdAt" bson:"createdAt"`
-	DeletedAt                *time.Time          `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
-	UpdatedAt                time.Time           `json:"updatedAt" bson:"updatedAt"`
-	CreatedBy                primitive.ObjectID  `json:"createdBy" bson:"createdBy"`
-	StoreName                string              `json:"storeName" bson:"storeName"`
-	StoreLocation            StoreLocation       `json:"storeLocation" bson:"storeLocation"`
-	ServiceCategory          StoreCategory       `json:"serviceCategory" bson:"serviceCategory"`
-	Email                    string              `json:"email" bson:"email"`
-	Password                 string              `json:"password" bson:"password"`
-	StoreAddress             Address             `json:"storeAddress" bson:"storeAddress"`
-	ZipCode                  string              `json:"zipCode" bson:"zipCode"`
-	Country                  string              `json:"country" bson:"country"`
-	State                    string              `json:"state" bson:"state"`
-	ContactPersonName        string              `json:"contactPersonName" bson:"contactPersonName"`
-	MobileNumber             string              `json:"mobileNumber" bson:"mobileNumber"`
-	StoreLogo                string              `json:"storeLogo" bson:"storeLogo"`
-	Language                 string              `json:"language" bson:"language"`
-	AvailableStoreItemTypes  string              `json:"availableStoreItemTypes" bson:"availableStoreItemTypes"`
-	Slot1                    time.Time           `json:"slot1" bson:"slot1"`
-	Slot2                    time.Time           `json:"slot2" bson:"slot2"`
-	MinimumAmountPerOrder    float64             `json:"minimumAmountPerOrder" bson:"minimumAmountPerOrder"`
-	AdditionalPackingCharges float64             `json:"additionalPackingCharges" bson:"additionalPackingCharges"`
-	MaxOrderQuantity         string              `json:"maxOrderQuantity" bson:"maxOrderQuantity"`
-	EstimatedOrderTime       int                 `json:"estimatedOrderTime" bson:"estimatedOrderTime"`
-	OfferAppliesOn           OfferAppliesOn      `json:"offerAppliesOn" bson:"offerAppliesOn"`
-	BankAccountDetails       primitive.ObjectID  `json:"bankAccountDetails" bson:"bankAccountDetails"`
-	IsActive                 bool                `json:"isActive" bson:"isActive"`
-	IsMultiLocationEnabled   bool                `json:"isMultiLocationEnabled"`
-	Blocked                  bool                `json:"blocked" bson:"blocked"`
-	ApprovedAt               *time.Time          `json:"approvedAt" bson:"approvedAt"`
-	ApprovedBy               *primitive.ObjectID `json:"approvedBy" bson:"approvedBy"`
+	ID                       primitive.ObjectID     `json:"id,omitempty" bson:"_id,omitempty"`
+	CreatedAt                time.Time              `json:"createdAt" bson:"createdAt"`
+	DeletedAt                *time.Time             `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	UpdatedAt                time.Time              `json:"updatedAt" bson:"updatedAt"`
+	CreatedBy                primitive.ObjectID     `json:"createdBy" bson:"createdBy"`
+	StoreName                string                 `json:"storeName" bson:"storeName"`
+	StoreLocation            StoreLocation          `json:"storeLocation" bson:"storeLocation"`
+	ServiceCategory          StoreCategory          `json:"serviceCategory" bson:"serviceCategory"`
+	Email                    string                 `json:"email" bson:"email"`
+	Password                 string                 `json:"password" bson:"password"`
+	StoreAddress             Address                `json:"storeAddress" bson:"storeAddress"`
+	ZipCode                  string                 `json:"zipCode" bson:"zipCode"`
+	Country                  string                 `json:"country" bson:"country"`
+	State                    string                 `json:"state" bson:"state"`
+	ContactPersonName        string                 `json:"contactPersonName" bson:"contactPersonName"`
+	MobileNumber             string                 `json:"mobileNumber" bson:"mobileNumber"`
+	StoreLogo                string                 `json:"storeLogo" bson:"storeLogo"`
+	Language                 string                 `json:"language" bson:"language"`
+	AvailableStoreItemTypes  string                 `json:"availableStoreItemTypes" bson:"availableStoreItemTypes"`
+	Slot1                    time.Time              `json:"slot1" bson:"slot1"`
+	Slot2                    time.Time              `json:"slot2" bson:"slot2"`
+	MinimumAmountPerOrder    float64                `json:"minimumAmountPerOrder" bson:"minimumAmountPerOrder"`
+	AdditionalPackingCharges float64                `json:"additionalPackingCharges" bson:"additionalPackingCharges"`
+	MaxOrderQuantity         string                 `json:"maxOrderQuantity" bson:"maxOrderQuantity"`
+	EstimatedOrderTime       int                    `json:"estimatedOrderTime" bson:"estimatedOrderTime"`
+	OfferAppliesOn           OfferAppliesOn         `json:"offerAppliesOn" bson:"offerAppliesOn"`
+	CommissionRate           float64                `json:"commissionRate" bson:"commissionRate"`
+	BankAccountDetails       primitive.ObjectID     `json:"bankAccountDetails" bson:"bankAccountDetails"`
+	IsActive                 bool                   `json:"isActive" bson:"isActive"`
+	IsMultiLocationEnabled   bool                   `json:"isMultiLocationEnabled"`
+	Blocked                  bool                   `json:"blocked" bson:"blocked"`
+	ApprovedAt               *time.Time             `json:"approvedAt" bson:"approvedAt"`
+	ApprovedBy               *primitive.ObjectID    `json:"approvedBy" bson:"approvedBy"`
+	Hours                    *StoreHours            `json:"hours" bson:"hours"`
+	Metadata                 map[string]interface{} `json:"metadata" bson:"metadata"`
 }
 
 type StoreLocation struct {
@@ -64,6 +67,7 @@ type StoreLocation struct {
 	StoreID           primitive.ObjectID `json:"storeID" bson:"storeID"`
 	StoreLocationName string             `json:"storeLocation" bson:"storeLocation"`
 	StoreAddress      Address            `json:"storeAddress" bson:"storeAddress"`
+	Hours             *StoreHours        `json:"hours" bson:"hours"`
 }
 
 // CreateStore creates a store.
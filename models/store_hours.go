@@ -0,0 +1,436 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/database"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidStoreHours is returned when store hours have an unknown timezone, a malformed time or date.
+	ErrInvalidStoreHours = errors.New("invalid store hours")
+	// ErrStoreClosed is returned when ordering from a store outside its opening hours.
+	ErrStoreClosed = errors.New("store is closed, schedule the order for when it is open")
+	// ErrScheduledOrderNotAccepted is returned when scheduling an order with a store that doesn't take scheduled orders,
+	// in the past or too far ahead.
+	ErrScheduledOrderNotAccepted = errors.New("store does not accept orders scheduled for that time")
+	// ErrDeliverySlotNotAvailable is returned when choosing a delivery slot the store doesn't have or that is full.
+	ErrDeliverySlotNotAvailable = errors.New("delivery slot is not available")
+)
+
+var (
+	deliverySlotIndexesMu    sync.Mutex
+	deliverySlotIndexesReady bool
+)
+
+// storeHoursSearchDays is how far ahead the next opening of a store is looked for.
+const storeHoursSearchDays = 14
+
+// StoreHours are the weekly opening hours, holidays and delivery slots of a store or store location in its timezone.
+// Without opening hours a store is open all day except on its holidays.
+type StoreHours struct {
+	Timezone              string            `json:"timezone" bson:"timezone"`
+	OpeningHours          []OpeningHours    `json:"openingHours" bson:"openingHours"`
+	HolidayOverrides      []HolidayOverride `json:"holidayOverrides" bson:"holidayOverrides"`
+	DeliverySlots         []DeliverySlot    `json:"deliverySlots" bson:"deliverySlots"`
+	AcceptScheduledOrders bool              `json:"acceptScheduledOrders" bson:"acceptScheduledOrders"`
+	ScheduleDays          int               `json:"scheduleDays" bson:"scheduleDays"`
+}
+
+// OpeningHours is one opening period of a store on a day of the week, as HH:MM.
+type OpeningHours struct {
+	Day    Weekday `json:"day" bson:"day"`
+	Opens  string  `json:"opens" bson:"opens"`
+	Closes string  `json:"closes" bson:"closes"`
+}
+
+// HolidayOverride replaces the opening hours of a store on a date.
+type HolidayOverride struct {
+	Date   string `json:"date" bson:"date"`
+	Closed bool   `json:"closed" bson:"closed"`
+	Opens  string `json:"opens" bson:"opens"`
+	Closes string `json:"closes" bson:"closes"`
+	Note   string `json:"note" bson:"note"`
+}
+
+// DeliverySlot is a weekly delivery window of a store taking up to capacity orders, zero for no limit.
+type DeliverySlot struct {
+	Day      Weekday `json:"day" bson:"day"`
+	Start    string  `json:"start" bson:"start"`
+	End      string  `json:"end" bson:"end"`
+	Capacity int     `json:"capacity" bson:"capacity"`
+}
+
+// OrderDeliverySlot is the delivery slot an order was placed for.
+type OrderDeliverySlot struct {
+	Start    time.Time `json:"start" bson:"start"`
+	End      time.Time `json:"end" bson:"end"`
+	Released bool      `json:"released" bson:"released"`
+}
+
+// period is a span of time a store is open or a slot delivers in.
+type period struct {
+	start    time.Time
+	end      time.Time
+	capacity int
+}
+
+var weekdays = map[time.Weekday]Weekday{
+	time.Monday:    WeekdayMonday,
+	time.Tuesday:   WeekdayTuesday,
+	time.Wednesday: WeekdayWednesday,
+	time.Thursday:  WeekdayThursday,
+	time.Friday:    WeekdayFriday,
+	time.Saturday:  WeekdaySaturday,
+	time.Sunday:    WeekdaySunday,
+}
+
+// NewStoreHours validates store hours input.
+func NewStoreHours(input StoreHoursInput) (*StoreHours, error) {
+	if _, err := time.LoadLocation(input.Timezone); err != nil {
+		return nil, ErrInvalidStoreHours
+	}
+	hours := &StoreHours{
+		Timezone:              input.Timezone,
+		OpeningHours:          []OpeningHours{},
+		HolidayOverrides:      []HolidayOverride{},
+		DeliverySlots:         []DeliverySlot{},
+		AcceptScheduledOrders: input.AcceptScheduledOrders,
+	}
+	if input.ScheduleDays != nil {
+		hours.ScheduleDays = *input.ScheduleDays
+	}
+	for _, openingHours := range input.OpeningHours {
+		if !openingHours.Day.IsValid() || !validClock(openingHours.Opens) || !validClock(openingHours.Closes) {
+			return nil, ErrInvalidStoreHours
+		}
+		hours.OpeningHours = append(hours.OpeningHours, OpeningHours(*openingHours))
+	}
+	for _, holiday := range input.HolidayOverrides {
+		if _, err := time.Parse("2006-01-02", holiday.Date); err != nil {
+			return nil, ErrInvalidStoreHours
+		}
+		override := HolidayOverride{Date: holiday.Date, Closed: holiday.Closed}
+		if holiday.Opens != nil && holiday.Closes != nil {
+			override.Opens, override.Closes = *holiday.Opens, *holiday.Closes
+		}
+		if holiday.Note != nil {
+			override.Note = *holiday.Note
+		}
+		if !override.Closed && (!validClock(override.Opens) || !validClock(override.Closes)) {
+			return nil, ErrInvalidStoreHours
+		}
+		hours.HolidayOverrides = append(hours.HolidayOverrides, override)
+	}
+	for _, slot := range input.DeliverySlots {
+		if !slot.Day.IsValid() || !validClock(slot.Start) || !validClock(slot.End) || slot.Capacity < 0 {
+			return nil, ErrInvalidStoreHours
+		}
+		hours.DeliverySlots = append(hours.DeliverySlots, DeliverySlot(*slot))
+	}
+	return hours, nil
+}
+
+// GetStoreHours gives the hours orders from a store are taken in, the hours of its location when it has its own.
+// Stores without hours take orders at any time.
+func GetStoreHours(store *Store) *StoreHours {
+	if store.StoreLocation.Hours != nil {
+		return store.StoreLocation.Hours
+	}
+	if !store.StoreLocation.ID.IsZero() {
+		storeLocation, err := GetStoreLocationByID(store.StoreLocation.ID.Hex())
+		if err != nil {
+			log.Errorln(err)
+		}
+		if storeLocation != nil && storeLocation.Hours != nil {
+			return storeLocation.Hours
+		}
+	}
+	return store.Hours
+}
+
+// IsOpenAt tells whether the store is open at t.
+func (hours *StoreHours) IsOpenAt(t time.Time) bool {
+	if hours == nil {
+		return true
+	}
+	local := t.In(hours.location())
+	//periods of the day before can run past midnight
+	for _, day := range []time.Time{local.AddDate(0, 0, -1), local} {
+		for _, open := range hours.openingsOn(day) {
+			if !local.Before(open.start) && local.Before(open.end) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NextOpeningAt gives when the store opens next after t, nil when it is open or doesn't open in the next two weeks.
+func (hours *StoreHours) NextOpeningAt(t time.Time) *time.Time {
+	if hours.IsOpenAt(t) {
+		return nil
+	}
+	local := t.In(hours.location())
+	for i := 0; i < storeHoursSearchDays; i++ {
+		for _, open := range hours.openingsOn(local.AddDate(0, 0, i)) {
+			if open.start.After(t) {
+				opensAt := open.start
+				return &opensAt
+			}
+		}
+	}
+	return nil
+}
+
+// AcceptOrder checks the store takes an order placed at now, for scheduledFor when it is set.
+func (hours *StoreHours) AcceptOrder(now time.Time, scheduledFor *time.Time) error {
+	if scheduledFor == nil {
+		if !hours.IsOpenAt(now) {
+			return ErrStoreClosed
+		}
+		return nil
+	}
+	if hours == nil {
+		return nil
+	}
+	if !hours.AcceptScheduledOrders || !scheduledFor.After(now) ||
+		(hours.ScheduleDays > 0 && scheduledFor.After(now.AddDate(0, 0, hours.ScheduleDays))) {
+		return ErrScheduledOrderNotAccepted
+	}
+	if !hours.IsOpenAt(*scheduledFor) {
+		return ErrStoreClosed
+	}
+	return nil
+}
+
+// deliverySlotsOn gives the delivery slots of the store on the day of date in the store's timezone.
+func (hours *StoreHours) deliverySlotsOn(date time.Time) []period {
+	if hours == nil {
+		return nil
+	}
+	day := date.In(hours.location())
+	if holiday := hours.holiday(day); holiday != nil && holiday.Closed {
+		return nil
+	}
+	var slots []period
+	for _, slot := range hours.DeliverySlots {
+		if slot.Day != weekdays[day.Weekday()] {
+			continue
+		}
+		if slotPeriod, ok := clockPeriod(day, slot.Start, slot.End); ok {
+			slotPeriod.capacity = slot.Capacity
+			slots = append(slots, slotPeriod)
+		}
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].start.Before(slots[j].start) })
+	return slots
+}
+
+// deliverySlotAt gives the delivery slot of the store starting at start.
+func (hours *StoreHours) deliverySlotAt(start time.Time) (period, bool) {
+	for _, slot := range hours.deliverySlotsOn(start) {
+		if slot.start.Equal(start) {
+			return slot, true
+		}
+	}
+	return period{}, false
+}
+
+// openingsOn gives the opening periods of the store on the day of day in the store's timezone.
+func (hours *StoreHours) openingsOn(day time.Time) []period {
+	if holiday := hours.holiday(day); holiday != nil {
+		if holiday.Closed {
+			return nil
+		}
+		if open, ok := clockPeriod(day, holiday.Opens, holiday.Closes); ok {
+			return []period{open}
+		}
+		return nil
+	}
+	if len(hours.OpeningHours) == 0 {
+		open, _ := clockPeriod(day, "00:00", "24:00")
+		return []period{open}
+	}
+	var openings []period
+	for _, openingHours := range hours.OpeningHours {
+		if openingHours.Day != weekdays[day.Weekday()] {
+			continue
+		}
+		if open, ok := clockPeriod(day, openingHours.Opens, openingHours.Closes); ok {
+			openings = append(openings, open)
+		}
+	}
+	sort.Slice(openings, func(i, j int) bool { return openings[i].start.Before(openings[j].start) })
+	return openings
+}
+
+// holiday gives the holiday override of the day, if any.
+func (hours *StoreHours) holiday(day time.Time) *HolidayOverride {
+	date := day.Format("2006-01-02")
+	for i := range hours.HolidayOverrides {
+		if hours.HolidayOverrides[i].Date == date {
+			return &hours.HolidayOverrides[i]
+		}
+	}
+	return nil
+}
+
+// location gives the store's timezone, UTC when it has none.
+func (hours *StoreHours) location() *time.Location {
+	location, err := time.LoadLocation(hours.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return location
+}
+
+// clockPeriod gives the period between two HH:MM times on day, ending the next day when end isn't after start.
+func clockPeriod(day time.Time, start string, end string) (period, bool) {
+	startMinutes, ok := parseClock(start)
+	if !ok {
+		return period{}, false
+	}
+	endMinutes, ok := parseClock(end)
+	if !ok {
+		return period{}, false
+	}
+	midnight := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	if endMinutes <= startMinutes {
+		endMinutes += 24 * 60
+	}
+	return period{
+		start: midnight.Add(time.Duration(startMinutes) * time.Minute),
+		end:   midnight.Add(time.Duration(endMinutes) * time.Minute),
+	}, true
+}
+
+// parseClock gives the minutes since midnight of a HH:MM time, 24:00 being the end of the day.
+func parseClock(clock string) (int, bool) {
+	parts := strings.Split(clock, ":")
+	if len(parts) != 2 || len(parts[1]) != 2 {
+		return 0, false
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, false
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 || hour < 0 || hour > 24 || (hour == 24 && minute > 0) {
+		return 0, false
+	}
+	return hour*60 + minute, true
+}
+
+// validClock tells whether clock is a HH:MM time.
+func validClock(clock string) bool {
+	_, ok := parseClock(clock)
+	return ok
+}
+
+// GetDeliverySlotAvailability gives the delivery slots of a store on the day of date and the orders they can still take.
+func GetDeliverySlotAvailability(store *Store, date time.Time) ([]*DeliverySlotAvailability, error) {
+	availability := []*DeliverySlotAvailability{}
+	for _, slot := range GetStoreHours(store).deliverySlotsOn(date) {
+		slotAvailability := &DeliverySlotAvailability{Start: slot.start, End: slot.end, Capacity: slot.capacity}
+		if slot.capacity > 0 {
+			reserved, err := deliverySlotReservations(store.ID, slot.start)
+			if err != nil {
+				return nil, err
+			}
+			remaining := slot.capacity - reserved
+			if remaining < 0 {
+				remaining = 0
+			}
+			slotAvailability.Remaining = &remaining
+		}
+		availability = append(availability, slotAvailability)
+	}
+	return availability, nil
+}
+
+// ensureDeliverySlotIndexes creates the unique index that keeps one reservation count per delivery slot.
+func ensureDeliverySlotIndexes() {
+	deliverySlotIndexesMu.Lock()
+	defer deliverySlotIndexesMu.Unlock()
+	if deliverySlotIndexesReady {
+		return
+	}
+	_, err := database.MongoDB.Collection(DeliverySlotReservationsCollection).Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{"storeID", 1}, {"start", 1}}, Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	deliverySlotIndexesReady = true
+}
+
+// ReserveDeliverySlot takes a place in the store's delivery slot starting at start.
+func ReserveDeliverySlot(store *Store, start time.Time) (*OrderDeliverySlot, error) {
+	slot, ok := GetStoreHours(store).deliverySlotAt(start)
+	if !ok || !slot.start.After(time.Now()) {
+		return nil, ErrDeliverySlotNotAvailable
+	}
+	orderSlot := &OrderDeliverySlot{Start: slot.start, End: slot.end}
+	if slot.capacity == 0 {
+		return orderSlot, nil
+	}
+	ensureDeliverySlotIndexes()
+	//take the place in one conditional update, a full slot doesn't match and the upsert then trips the unique
+	//index on the slot, so concurrent checkouts can't overbook it
+	filter := bson.D{{"storeID", store.ID}, {"start", slot.start}, {"count", bson.M{"$lt": slot.capacity}}}
+	update := bson.D{{"$inc", bson.D{{"count", 1}}}}
+	_, err := database.MongoDB.Collection(DeliverySlotReservationsCollection).UpdateOne(context.Background(), filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		if isDuplicateKeyError(err) {
+			return nil, ErrDeliverySlotNotAvailable
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	return orderSlot, nil
+}
+
+// ReleaseDeliverySlot gives back the place an order took in its store's delivery slot.
+func ReleaseDeliverySlot(storeID primitive.ObjectID, slot *OrderDeliverySlot) error {
+	filter := bson.D{{"storeID", storeID}, {"start", slot.Start}, {"count", bson.M{"$gt": 0}}}
+	_, err := database.MongoDB.Collection(DeliverySlotReservationsCollection).UpdateOne(context.Background(), filter, bson.D{{"$inc", bson.D{{"count", -1}}}})
+	if err != nil {
+		log.Errorln(err)
+		return err
+	}
+	slot.Released = true
+	return nil
+}
+
+// deliverySlotReservations gives the number of orders placed in a store's delivery slot.
+func deliverySlotReservations(storeID primitive.ObjectID, start time.Time) (int, error) {
+	var reservation struct {
+		Count int `bson:"count"`
+	}
+	filter := bson.D{{"storeID", storeID}, {"start", start}}
+	err := database.MongoDB.Collection(DeliverySlotReservationsCollection).FindOne(context.Background(), filter).Decode(&reservation)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return 0, nil
+		}
+		log.Errorln(err)
+		return 0, err
+	}
+	return reservation.Count, nil
+}
@@ -0,0 +1,72 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// storeHoursTestHours gives the hours of a store open mornings and evenings on mondays, past midnight on fridays.
+func storeHoursTestHours() *StoreHours {
+	return &StoreHours{
+		Timezone: "UTC",
+		OpeningHours: []OpeningHours{
+			{Day: WeekdayMonday, Opens: "09:00", Closes: "12:00"},
+			{Day: WeekdayMonday, Opens: "17:00", Closes: "21:00"},
+			{Day: WeekdayFriday, Opens: "20:00", Closes: "02:00"},
+		},
+		HolidayOverrides: []HolidayOverride{{Date: "2019-12-23", Closed: true}},
+		DeliverySlots: []DeliverySlot{
+			{Day: WeekdayMonday, Start: "10:00", End: "11:00", Capacity: 5},
+		},
+		AcceptScheduledOrders: true,
+		ScheduleDays:          7,
+	}
+}
+
+func TestStoreHoursIsOpenAt(t *testing.T) {
+	hours := storeHoursTestHours()
+	monday := time.Date(2019, 12, 16, 0, 0, 0, 0, time.UTC)
+
+	require.True(t, hours.IsOpenAt(monday.Add(10*time.Hour)))
+	require.False(t, hours.IsOpenAt(monday.Add(14*time.Hour)))
+	require.True(t, hours.IsOpenAt(monday.Add(18*time.Hour)))
+	//friday evening hours run into saturday
+	require.True(t, hours.IsOpenAt(time.Date(2019, 12, 21, 1, 0, 0, 0, time.UTC)))
+	//closed for the holiday
+	require.False(t, hours.IsOpenAt(time.Date(2019, 12, 23, 10, 0, 0, 0, time.UTC)))
+
+	var noHours *StoreHours
+	require.True(t, noHours.IsOpenAt(monday))
+}
+
+func TestStoreHoursAcceptOrder(t *testing.T) {
+	hours := storeHoursTestHours()
+	now := time.Date(2019, 12, 16, 14, 0, 0, 0, time.UTC)
+
+	require.Equal(t, ErrStoreClosed, hours.AcceptOrder(now, nil))
+	evening := now.Add(4 * time.Hour)
+	require.NoError(t, hours.AcceptOrder(now, &evening))
+	tooFar := now.AddDate(0, 0, 14)
+	require.Equal(t, ErrScheduledOrderNotAccepted, hours.AcceptOrder(now, &tooFar))
+	require.Equal(t, time.Date(2019, 12, 16, 17, 0, 0, 0, time.UTC), *hours.NextOpeningAt(now))
+}
+
+func TestStoreHoursDeliverySlotAt(t *testing.T) {
+	hours := storeHoursTestHours()
+
+	slot, ok := hours.deliverySlotAt(time.Date(2019, 12, 16, 10, 0, 0, 0, time.UTC))
+	require.True(t, ok)
+	require.Equal(t, 5, slot.capacity)
+	require.Equal(t, time.Date(2019, 12, 16, 11, 0, 0, 0, time.UTC), slot.end)
+
+	_, ok = hours.deliverySlotAt(time.Date(2019, 12, 16, 10, 30, 0, 0, time.UTC))
+	require.False(t, ok)
+	//no deliveries on holidays
+	_, ok = hours.deliverySlotAt(time.Date(2019, 12, 23, 10, 0, 0, 0, time.UTC))
+	require.False(t, ok)
+}
@@ -19,133 +19,42 @@ import (
 	"time"
 )
 
-// PlanInterval is the list of allowed values for a plan's interval.
-type SubscriptionPlanInterval string
-
-// List of values that PlanInterval can take.
-const (
-	SubscriptionPlanIntervalDay   SubscriptionPlanInterval = "day"
-	SubscriptionPlanIntervalWeek  SubscriptionPlanInterval = "week"
-	SubscriptionPlanIntervalMonth SubscriptionPlanInterval = "month"
-	SubscriptionPlanIntervalYear  SubscriptionPlanInterval = "year"
-)
-
-// PlanBillingScheme is the list of allowed values for a plan's billing scheme.
-type SubscriptionPlanBillingScheme string
-
-// List of values that PlanBillingScheme can take.
-const (
-	SubscriptionPlanBillingSchemePerUnit SubscriptionPlanBillingScheme = "perUnit"
-	SubscriptionPlanBillingSchemeTiered  SubscriptionPlanBillingScheme = "tiered"
-)
-
-// PlanUsageType is the list of allowed values for a plan's usage type.
-type SubscriptionPlanUsageType string
-
-// List of values that PlanUsageType can take.
-const (
-	SubscriptionPlanUsageTypeLicensed SubscriptionPlanUsageType = "licensed"
-	SubscriptionPlanUsageTypeMetered  SubscriptionPlanUsageType = "metered"
-)
-
-// PlanTiersMode is the list of allowed values for a plan's tiers mode.
-type SubscriptionPlanTiersMode string
-
-// List of values that PlanTiersMode can take.
-const (
-	SubscriptionPlanTiersModeGraduated SubscriptionPlanTiersMode = "graduated"
-	SubscriptionPlanTiersModeVolume    SubscriptionPlanTiersMode = "volume"
-)
-
-// PlanTransformUsageRound is the list of allowed values for a plan's transform usage round logic.
-type SubscriptionPlanTransformUsageRound string
-
-// List of values that PlanTransformUsageRound can take.
-const (
-	SubscriptionPlanTransformUsageRoundDown SubscriptionPlanTransformUsageRound = "down"
-	SubscriptionPlanTransformUsageRoundUp   SubscriptionPlanTransformUsageRound = "up"
-)
-
-// PlanAggregateUsage is the list of allowed values for a plan's aggregate usage.
-type SubscriptionPlanAggregateUsage string
-
-// List of values that PlanAggregateUsage can take.
-const (
-	SubscriptionPlanAggregateUsageLastDuringPeriod SubscriptionPlanAggregateUsage = "lastDuringPeriod"
-	SubscriptionPlanAggregateUsageLastEver         SubscriptionPlanAggregateUsage = "lastEver"
-	SubscriptionPlanAggregateUsageMax              SubscriptionPlanAggregateUsage = "max"
-	SubscriptionPlanAggregateUsageSum              SubscriptionPlanAggregateUsage = "sum"
-)
-
-// PlanTier configures tiered pricing
+// SubscriptionPlanTier prices the units up to a quantity on a tiered plan.
 type SubscriptionPlanTier struct {
-	FlatAmount int64 `json:"flat_amount"`
-	UnitAmount int64 `json:"unit_amount"`
-	UpTo       int64 `json:"up_to"`
-}
-
-type SubscriptionPlan struct {
-	ID              primitive.ObjectID            `json:"id,omitempty" bson:"_id,omitempty"`
-	CreatedAt       time.Time                     `json:"createdAt" bson:"createdAt"`
-	DeletedAt       *time.Time                    `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
-	UpdatedAt       time.Time                     `json:"updatedAt" bson:"updatedAt"`
-	CreatedBy       primitive.ObjectID            `json:"createdBy" bson:"createdBy"`
-	Active          bool                          `json:"active"`
-	AggregateUsage  string                        `json:"aggregateUsage"`
-	Amount          int64                         `json:"amount"`
-	BillingScheme   SubscriptionPlanBillingScheme `json:"billingScheme"`
-	Created         int64                         `json:"created"`
-	Currency        Currency                      `json:"currency"`
-	Deleted         bool                          `json:"deleted"`
-	Interval        SubscriptionPlanInterval      `json:"interval"`
-	IntervalCount   int64                         `json:"intervalCount"`
-	Livemode        bool                          `json:"livemode"`
-	Metadata        map[string]string             `json:"metadata"`
-	Nickname        string                        `json:"nickname"`
-	Product         *Product                      `json:"product"`
-	Tiers           []*SubscriptionPlanTier       `json:"tiers"`
-	TiersMode       string                        `json:"tiersMode"`
-	TransformUsage  *PlanTransformUsage           `json:"transformUsage"`
-	TrialPeriodDays int64                         `json:"trialPeriodDays"`
-	UsageType       SubscriptionPlanUsageType     `json:"usageType"`
+	FlatAmount float64 `json:"flatAmount" bson:"flatAmount"`
+	UnitAmount float64 `json:"unitAmount" bson:"unitAmount"`
+	UpTo       int     `json:"upTo" bson:"upTo"` //0 for the last tier
 }
 
 // PlanTransformUsage represents the bucket billing configuration.
 type PlanTransformUsage struct {
-	DivideBy int64                               `json:"divideBy"`
-	Round    SubscriptionPlanTransformUsageRound `json:"round"`
+	DivideBy int                                 `json:"divideBy" bson:"divideBy"`
+	Round    SubscriptionPlanTransformUsageRound `json:"round" bson:"round"`
 }
 
-// SubscriptionBillingThresholds is a structure representing the billing thresholds for a subscription.
-type SubscriptionBillingThresholds struct {
-	AmountGTE               int64 `json:"amountGte"`
-	ResetBillingCycleAnchor bool  `json:"resetBillingCycleAnchor"`
+// SubscriptionPlan is the price and billing interval customers subscribe to.
+type SubscriptionPlan struct {
+	ID              primitive.ObjectID             `json:"id,omitempty" bson:"_id,omitempty"`
+	CreatedAt       time.Time                      `json:"createdAt" bson:"createdAt"`
+	DeletedAt       *time.Time                     `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	UpdatedAt       time.Time                      `json:"updatedAt" bson:"updatedAt"`
+	CreatedBy       primitive.ObjectID             `json:"createdBy" bson:"createdBy"`
+	Nickname        string                         `json:"nickname" bson:"nickname"`
+	ProductID       *primitive.ObjectID            `json:"productID" bson:"productID"`
+	Active          bool                           `json:"active" bson:"active"`
+	Currency        string                         `json:"currency" bson:"currency"`
+	Interval        SubscriptionPlanInterval       `json:"interval" bson:"interval"`
+	IntervalCount   int                            `json:"intervalCount" bson:"intervalCount"`
+	UsageType       SubscriptionPlanUsageType      `json:"usageType" bson:"usageType"`
+	AggregateUsage  SubscriptionPlanAggregateUsage `json:"aggregateUsage" bson:"aggregateUsage"`
+	BillingScheme   SubscriptionPlanBillingScheme  `json:"billingScheme" bson:"billingScheme"`
+	Amount          float64                        `json:"amount" bson:"amount"` //per unit
+	TiersMode       SubscriptionPlanTiersMode      `json:"tiersMode" bson:"tiersMode"`
+	Tiers           []SubscriptionPlanTier         `json:"tiers" bson:"tiers"`
+	TransformUsage  *PlanTransformUsage            `json:"transformUsage" bson:"transformUsage"`
+	TrialPeriodDays int                            `json:"trialPeriodDays" bson:"trialPeriodDays"`
 }
 
-// SubscriptionStatus is the list of allowed values for the subscription's status.
-type SubscriptionStatus string
-
-// List of values that SubscriptionStatus can take.
-const (
-	SubscriptionStatusActive            SubscriptionStatus = "active"
-	SubscriptionStatusAll               SubscriptionStatus = "all"
-	SubscriptionStatusCanceled          SubscriptionStatus = "canceled"
-	SubscriptionStatusIncomplete        SubscriptionStatus = "incomplete"
-	SubscriptionStatusIncompleteExpired SubscriptionStatus = "incomplete_expired"
-	SubscriptionStatusPastDue           SubscriptionStatus = "past_due"
-	SubscriptionStatusTrialing          SubscriptionStatus = "trialing"
-	SubscriptionStatusUnpaid            SubscriptionStatus = "unpaid"
-)
-
-// SubscriptionBilling is the type of billing method for this subscription's invoices.
-type SubscriptionBilling string
-
-// List of values that SubscriptionBilling can take.
-const (
-	SubscriptionBillingChargeAutomatically SubscriptionBilling = "charge_automatically"
-	SubscriptionBillingSendInvoice         SubscriptionBilling = "send_invoice"
-)
-
 // TaxRate is the resource representing a Stripe tax rate.
 // For more details see https://stripe.com/docs/api/tax_rates/object.
 type TaxRate struct {
@@ -197,62 +106,34 @@ type PaymentSource struct {
 	Type PaymentSourceType `json:"object"`
 }
 
+// Subscription bills a customer for a plan every interval.
 type Subscription struct {
-	ID                    primitive.ObjectID             `json:"id,omitempty" bson:"_id,omitempty"`
-	CreatedAt             time.Time                      `json:"createdAt" bson:"createdAt"`
-	DeletedAt             *time.Time                     `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
-	UpdatedAt             time.Time                      `json:"updatedAt" bson:"updatedAt"`
-	CreatedBy             primitive.ObjectID             `json:"createdBy" bson:"createdBy"`
-	ApplicationFeePercent float64                        `json:"applicationFeePercent"`
-	Billing               SubscriptionBilling            `json:"billing"`
-	BillingCycleAnchor    int64                          `json:"billingCycleAnchor"`
-	BillingThresholds     *SubscriptionBillingThresholds `json:"billingThresholds"`
-	CancelAt              int64                          `json:"cancelAt"`
-	CancelAtPeriodEnd     bool                           `json:"cancelAtPeriodEnd"`
-	CanceledAt            time.Time                      `json:"canceledAt"`
-	Created               int64                          `json:"created"`
-	CurrentPeriodEnd      int64                          `json:"currentPeriodEnd"`
-	CurrentPeriodStart    int64                          `json:"currentPeriodStart"`
-	Customer              *Customer                      `json:"customer"`
-	DaysUntilDue          int64                          `json:"daysUntilDue"`
-	DefaultPaymentMethod  *PaymentMethod                 `json:"defaultPaymentMethod"`
-	DefaultSource         *PaymentSource                 `json:"defaultSource"`
-	DefaultTaxRates       []*TaxRate                     `json:"defaultTaxRates"`
-	Discount              *Discount                      `json:"discount"`
-	EndedAt               int64                          `json:"endedAt"`
-	Items                 *SubscriptionItem              `json:"items"`
-	LatestInvoice         *Invoice                       `json:"latestInvoice"`
-	Livemode              bool                           `json:"livemode"`
-	Metadata              map[string]string              `json:"metadata"`
-	Object                string                         `json:"object"`
-	//OnBehalfOf            *Account                       `json:"onBehalfOf"`
-	Plan      *SubscriptionPlan  `json:"plan"`
-	Quantity  int64              `json:"quantity"`
-	StartDate int64              `json:"startDate"`
-	Status    SubscriptionStatus `json:"status"`
-	//TransferData          *SubscriptionTransferData      `json:"transferData"`
-	TrialEnd   time.Time `json:"trialEnd"`
-	TrialStart time.Time `json:"trialStart"`
-}
-
-// SubscriptionItemBillingThresholds is a structure representing the billing thresholds for a
-// subscription item.
-type SubscriptionItemBillingThresholds struct {
-	UsageGTE int64 `json:"usageGte"`
-}
-
-// SubscriptionItem is the resource representing a Stripe subscription item.
-// For more details see https://stripe.com/docs/api#subscription_items.
-type SubscriptionItem struct {
-	BillingThresholds SubscriptionItemBillingThresholds `json:"billingThresholds"`
-	Created           int64                             `json:"created"`
-	Deleted           bool                              `json:"deleted"`
-	ID                string                            `json:"id"`
-	Metadata          map[string]string                 `json:"metadata"`
-	Plan              *SubscriptionPlan                 `json:"plan"`
-	Quantity          int64                             `json:"quantity"`
-	Subscription      string                            `json:"subscription"`
-	TaxRates          []*TaxRate                        `json:"taxRates"`
+	ID                 primitive.ObjectID  `json:"id,omitempty" bson:"_id,omitempty"`
+	CreatedAt          time.Time           `json:"createdAt" bson:"createdAt"`
+	DeletedAt          *time.Time          `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	UpdatedAt          time.Time           `json:"updatedAt" bson:"updatedAt"`
+	CreatedBy          primitive.ObjectID  `json:"createdBy" bson:"createdBy"`
+	CustomerID         primitive.ObjectID  `json:"customerID" bson:"customerID"`
+	PlanID             primitive.ObjectID  `json:"planID" bson:"planID"`
+	Quantity           int                 `json:"quantity" bson:"quantity"`
+	Status             SubscriptionStatus  `json:"status" bson:"status"`
+	Billing            SubscriptionBilling `json:"billing" bson:"billing"`
+	DaysUntilDue       int                 `json:"daysUntilDue" bson:"daysUntilDue"`
+	PaymentGateway     string              `json:"paymentGateway" bson:"paymentGateway"`
+	GatewayCustomerID  string              `json:"gatewayCustomerID" bson:"gatewayCustomerID"`
+	PaymentMethodID    string              `json:"paymentMethodID" bson:"paymentMethodID"` //gateway's saved payment method
+	BillingCycleAnchor time.Time           `json:"billingCycleAnchor" bson:"billingCycleAnchor"`
+	CurrentPeriodStart time.Time           `json:"currentPeriodStart" bson:"currentPeriodStart"`
+	CurrentPeriodEnd   time.Time           `json:"currentPeriodEnd" bson:"currentPeriodEnd"`
+	TrialStart         *time.Time          `json:"trialStart" bson:"trialStart"`
+	TrialEnd           *time.Time          `json:"trialEnd" bson:"trialEnd"`
+	TrialEndNotifiedAt *time.Time          `json:"trialEndNotifiedAt" bson:"trialEndNotifiedAt"`
+	CancelAtPeriodEnd  bool                `json:"cancelAtPeriodEnd" bson:"cancelAtPeriodEnd"`
+	CanceledAt         *time.Time          `json:"canceledAt" bson:"canceledAt"`
+	EndedAt            *time.Time          `json:"endedAt" bson:"endedAt"`
+	LatestInvoiceID    *primitive.ObjectID `json:"latestInvoiceID" bson:"latestInvoiceID"`
+	//Prorations and credits billed with the next invoice
+	PendingLines []SubscriptionInvoiceLine `json:"pendingLines" bson:"pendingLines"`
 }
 
 // CreateSubscription creates new subscriptions.
@@ -261,9 +142,9 @@ func CreateSubscription(subscription Subscription) (*Subscription, error) {
 	subscription.UpdatedAt = time.Now()
 	subscription.ID = primitive.NewObjectID()
 	db := database.MongoDB
-	installationCollection := db.Collection(SubscriptionsCollection)
+	subscriptionsCollection := db.Collection(SubscriptionsCollection)
 	ctx := context.Background()
-	_, err := installationCollection.InsertOne(ctx, &subscription)
+	_, err := subscriptionsCollection.InsertOne(ctx, &subscription)
 	if err != nil {
 		log.Errorln(err)
 		return nil, err
@@ -324,12 +205,13 @@ func GetSubscriptions(filter bson.D, limit int, after *string, before *string, f
 		return
 	}
 	pagingInfo.QueryOpts.SetSort(bson.M{"_id": 1})
+	totalCount = int64(tcint)
 
 	cur, err := db.Collection(SubscriptionsCollection).Find(context.Background(), filter, &pagingInfo.QueryOpts)
 	if err != nil {
 		return
 	}
-ctx := context.Background()
+	ctx := context.Background()
 	defer cur.Close(ctx)
 	for cur.Next(ctx) {
 		subscription := &Subscription{}
@@ -407,3 +289,127 @@ func (subscription *Subscription) UnmarshalBinary(data []byte) error {
 func (subscription *Subscription) MarshalBinary() ([]byte, error) {
 	return json.Marshal(subscription)
 }
+
+// CreateSubscriptionPlan creates new subscription plans.
+func CreateSubscriptionPlan(plan SubscriptionPlan) (*SubscriptionPlan, error) {
+	plan.CreatedAt = time.Now()
+	plan.UpdatedAt = time.Now()
+	plan.ID = primitive.NewObjectID()
+	db := database.MongoDB
+	collection := db.Collection(SubscriptionPlansCollection)
+	_, err := collection.InsertOne(context.Background(), &plan)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	go webhooks.NewWebhookEvent("subscription_plan.created", &plan)
+	cacheClient := cache.RedisClient
+	//set cache item
+	err = cacheClient.Set(plan.ID.Hex(), plan, DefaultRedisCacheTime).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	return &plan, nil
+}
+
+// GetSubscriptionPlanByID gives requested subscription plan by id, nil when it doesn't exist.
+func GetSubscriptionPlanByID(ID string) (*SubscriptionPlan, error) {
+	db := database.MongoDB
+	plan := &SubscriptionPlan{}
+	//try finding item in cache
+	cacheClient := cache.RedisClient
+	err := cacheClient.Get(ID).Scan(plan)
+	if err != nil && err != redis.Nil {
+		log.Error(err)
+	} else if err == redis.Nil {
+		//key is empty or not set
+	}
+	id, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.D{{"_id", id}, {"deletedAt", bson.M{"$exists": false}}}
+	err = db.Collection(SubscriptionPlansCollection).FindOne(context.Background(), filter).Decode(&plan)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	//set cache item
+	err = cacheClient.Set(ID, plan, DefaultRedisCacheTime).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	return plan, nil
+}
+
+// GetSubscriptionPlans gives a list of subscription plans.
+func GetSubscriptionPlans(filter bson.D, limit int, after *string, before *string, first *int, last *int) (plans []*SubscriptionPlan, totalCount int64, hasPrevious, hasNext bool, err error) {
+	db := database.MongoDB
+	tcint, filter, err := calcTotalCountWithQueryFilters(SubscriptionPlansCollection, filter, after, before)
+	pagingInfo, err := PaginationUtility(after, before, first, last, &tcint)
+	if err != nil {
+		return
+	}
+	pagingInfo.QueryOpts.SetSort(bson.M{"_id": 1})
+	totalCount = int64(tcint)
+
+	ctx := context.Background()
+	cur, err := db.Collection(SubscriptionPlansCollection).Find(ctx, filter, &pagingInfo.QueryOpts)
+	if err != nil {
+		return
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		plan := &SubscriptionPlan{}
+		err = cur.Decode(&plan)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		plans = append(plans, plan)
+	}
+	if err = cur.Err(); err != nil {
+		return
+	}
+	return plans, totalCount, pagingInfo.HasPreviousPage, pagingInfo.HasNextPage, nil
+}
+
+// UpdateSubscriptionPlan updates the subscription plan.
+func UpdateSubscriptionPlan(p *SubscriptionPlan) (*SubscriptionPlan, error) {
+	plan := p
+	plan.UpdatedAt = time.Now()
+	filter := bson.D{{"_id", plan.ID}}
+	db := database.MongoDB
+	collection := db.Collection(SubscriptionPlansCollection)
+	findRepOpts := &options.FindOneAndReplaceOptions{}
+	findRepOpts.SetReturnDocument(options.After)
+	err := collection.FindOneAndReplace(context.Background(), filter, plan, findRepOpts).Decode(&plan)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	go webhooks.NewWebhookEvent("subscription_plan.updated", &plan)
+	//Update cache item
+	cacheClient := cache.RedisClient
+	err = cacheClient.Del(plan.ID.Hex()).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	return plan, nil
+}
+
+//UnmarshalBinary required for the redis cache to work
+func (plan *SubscriptionPlan) UnmarshalBinary(data []byte) error {
+	if err := json.Unmarshal(data, plan); err != nil {
+		return err
+	}
+	return nil
+}
+
+//MarshalBinary required for the redis cache to work
+func (plan *SubscriptionPlan) MarshalBinary() ([]byte, error) {
+	return json.Marshal(plan)
+}
@@ -0,0 +1,907 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/cache"
+	"github.com/tribehq/platform/lib/database"
+	"github.com/tribehq/platform/utils/webhooks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"time"
+)
+
+const (
+	subscriptionInvoiceTemplate       = "subscription.invoice"
+	subscriptionPaymentFailedTemplate = "subscription.payment_failed"
+	subscriptionTrialEndingTemplate   = "subscription.trial_will_end"
+)
+
+var (
+	ErrInvalidSubscriptionPlan           = errors.New("subscription plans need a currency, a positive interval count and amounts that aren't negative")
+	ErrInvalidSubscriptionPlanTiers      = errors.New("tiered plans need tiers of growing upper bounds, the last one without a bound")
+	ErrSubscriptionPlanNotFound          = errors.New("subscription plan not found")
+	ErrSubscriptionPlanInactive          = errors.New("subscription plan is not active")
+	ErrSubscriptionPaymentMethodRequired = errors.New("subscriptions charged automatically need a payment gateway and payment method")
+	ErrSubscriptionEnded                 = errors.New("subscription has ended")
+	ErrSubscriptionCurrencyMismatch      = errors.New("plans of a subscription must be in the same currency")
+	ErrSubscriptionNotMetered            = errors.New("subscription plan is not metered")
+	ErrInvalidUsageQuantity              = errors.New("usage quantity can't be negative")
+	ErrUsageOutsidePeriod                = errors.New("usage must fall in the current billing period")
+	ErrPaymentGatewayNotConfigured       = errors.New("payment gateway can't charge saved payment methods")
+	ErrSubscriptionInvoiceNotOpen        = errors.New("subscription invoice is not open")
+	ErrSubscriptionChanged               = errors.New("subscription changed in the meantime, try again")
+)
+
+// defaultSubscriptionRetryDays are the days waited after each failed charge when the settings have none.
+var defaultSubscriptionRetryDays = []int{1, 3, 5}
+
+// defaultTrialReminderDays is how long before the end of a trial customers hear of it when the settings don't say.
+const defaultTrialReminderDays = 3
+
+// SubscriptionUsageRecord reports usage of a metered subscription.
+type SubscriptionUsageRecord struct {
+	ID             primitive.ObjectID      `json:"id,omitempty" bson:"_id,omitempty"`
+	CreatedAt      time.Time               `json:"createdAt" bson:"createdAt"`
+	SubscriptionID primitive.ObjectID      `json:"subscriptionID" bson:"subscriptionID"`
+	Quantity       int                     `json:"quantity" bson:"quantity"`
+	Action         SubscriptionUsageAction `json:"action" bson:"action"`
+	Timestamp      time.Time               `json:"timestamp" bson:"timestamp"`
+}
+
+// subscriptionNotice is what subscription email templates are rendered with.
+type subscriptionNotice struct {
+	Subscription *Subscription
+	Customer     *User
+	Invoice      *SubscriptionInvoice
+}
+
+// ValidateSubscriptionPlan checks that a plan can be priced.
+func ValidateSubscriptionPlan(plan *SubscriptionPlan) error {
+	if plan.Currency == "" || plan.IntervalCount < 1 || plan.Amount < 0 || plan.TrialPeriodDays < 0 {
+		return ErrInvalidSubscriptionPlan
+	}
+	if plan.TransformUsage != nil && plan.TransformUsage.DivideBy < 1 {
+		return ErrInvalidSubscriptionPlan
+	}
+	if plan.BillingScheme != SubscriptionPlanBillingSchemeTiered {
+		return nil
+	}
+	if len(plan.Tiers) == 0 || !plan.TiersMode.IsValid() {
+		return ErrInvalidSubscriptionPlanTiers
+	}
+	below := 0
+	for i, tier := range plan.Tiers {
+		if tier.FlatAmount < 0 || tier.UnitAmount < 0 {
+			return ErrInvalidSubscriptionPlan
+		}
+		last := i == len(plan.Tiers)-1
+		if (last && tier.UpTo != 0) || (!last && tier.UpTo <= below) {
+			return ErrInvalidSubscriptionPlanTiers
+		}
+		below = tier.UpTo
+	}
+	return nil
+}
+
+// transformUsage applies the bucket billing of a plan to a quantity.
+func transformUsage(plan *SubscriptionPlan, quantity int) int {
+	if plan.TransformUsage == nil || plan.TransformUsage.DivideBy <= 1 {
+		return quantity
+	}
+	divideBy := plan.TransformUsage.DivideBy
+	if plan.TransformUsage.Round == SubscriptionPlanTransformUsageRoundUp {
+		return (quantity + divideBy - 1) / divideBy
+	}
+	return quantity / divideBy
+}
+
+// PlanAmount gives what a quantity of a plan costs for one period.
+// Volume tiers price every unit at the tier the quantity falls in, graduated tiers price the units within each tier at that tier.
+func PlanAmount(plan *SubscriptionPlan, quantity int) float64 {
+	if quantity < 0 {
+		quantity = 0
+	}
+	if plan.BillingScheme != SubscriptionPlanBillingSchemeTiered {
+		return roundAmount(plan.Amount * float64(transformUsage(plan, quantity)))
+	}
+	if plan.TiersMode == SubscriptionPlanTiersModeVolume {
+		for _, tier := range plan.Tiers {
+			if tier.UpTo == 0 || quantity <= tier.UpTo {
+				return roundAmount(tier.FlatAmount + tier.UnitAmount*float64(quantity))
+			}
+		}
+		return 0
+	}
+	amount, below := 0.0, 0
+	for _, tier := range plan.Tiers {
+		if quantity <= below {
+			break
+		}
+		units := quantity - below
+		if tier.UpTo != 0 && tier.UpTo < quantity {
+			units = tier.UpTo - below
+		}
+		amount += tier.FlatAmount + tier.UnitAmount*float64(units)
+		if tier.UpTo == 0 {
+			break
+		}
+		below = tier.UpTo
+	}
+	return roundAmount(amount)
+}
+
+// addBillingInterval moves a time on by the interval of a plan, keeping to the day of month of the billing cycle anchor.
+func addBillingInterval(t time.Time, plan *SubscriptionPlan, anchor time.Time) time.Time {
+	count := plan.IntervalCount
+	if count < 1 {
+		count = 1
+	}
+	months := count
+	switch plan.Interval {
+	case SubscriptionPlanIntervalDay:
+		return t.AddDate(0, 0, count)
+	case SubscriptionPlanIntervalWeek:
+		return t.AddDate(0, 0, 7*count)
+	case SubscriptionPlanIntervalYear:
+		months = 12 * count
+	}
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	day := anchor.Day()
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+// prorationFactor gives the share of a billing period left at a time.
+func prorationFactor(now time.Time, start time.Time, end time.Time) float64 {
+	if !end.After(start) || !now.Before(end) {
+		return 0
+	}
+	if now.Before(start) {
+		return 1
+	}
+	return float64(end.Sub(now)) / float64(end.Sub(start))
+}
+
+// sameBillingCycle tells whether two plans bill on the same interval.
+func sameBillingCycle(a *SubscriptionPlan, b *SubscriptionPlan) bool {
+	return a.Interval == b.Interval && a.IntervalCount == b.IntervalCount
+}
+
+// aggregateUsage totals usage records sorted by time the way a plan aggregates usage.
+// Summed usage starts over from the quantity of a record that sets it.
+func aggregateUsage(records []SubscriptionUsageRecord, aggregate SubscriptionPlanAggregateUsage) int {
+	total := 0
+	for _, record := range records {
+		switch aggregate {
+		case SubscriptionPlanAggregateUsageMax:
+			if record.Quantity > total {
+				total = record.Quantity
+			}
+		case SubscriptionPlanAggregateUsageLastDuringPeriod, SubscriptionPlanAggregateUsageLastEver:
+			total = record.Quantity
+		default:
+			if record.Action == SubscriptionUsageActionSet {
+				total = record.Quantity
+			} else {
+				total += record.Quantity
+			}
+		}
+	}
+	return total
+}
+
+// periodUsage gives the usage of a metered subscription between two times.
+func periodUsage(subscription *Subscription, plan *SubscriptionPlan, start time.Time, end time.Time) (int, error) {
+	filter := bson.D{{"subscriptionID", subscription.ID}, {"timestamp", bson.M{"$gte": start, "$lt": end}}}
+	findOpts := options.Find().SetSort(bson.D{{"timestamp", 1}, {"_id", 1}})
+	if plan.AggregateUsage == SubscriptionPlanAggregateUsageLastEver {
+		filter = bson.D{{"subscriptionID", subscription.ID}, {"timestamp", bson.M{"$lt": end}}}
+		findOpts = options.Find().SetSort(bson.D{{"timestamp", -1}, {"_id", -1}}).SetLimit(1)
+	}
+	ctx := context.Background()
+	cur, err := database.MongoDB.Collection(SubscriptionUsageRecordsCollection).Find(ctx, filter, findOpts)
+	if err != nil {
+		return 0, err
+	}
+	var records []SubscriptionUsageRecord
+	err = cur.All(ctx, &records)
+	if err != nil {
+		return 0, err
+	}
+	return aggregateUsage(records, plan.AggregateUsage), nil
+}
+
+func planLine(plan *SubscriptionPlan, quantity int, start time.Time, end time.Time) SubscriptionInvoiceLine {
+	return SubscriptionInvoiceLine{
+		Description: plan.Nickname,
+		PlanID:      plan.ID,
+		Quantity:    quantity,
+		Amount:      PlanAmount(plan, quantity),
+		PeriodStart: start,
+		PeriodEnd:   end,
+	}
+}
+
+func prorationLine(description string, plan *SubscriptionPlan, quantity int, factor float64, start time.Time, end time.Time) SubscriptionInvoiceLine {
+	return SubscriptionInvoiceLine{
+		Description: description + plan.Nickname,
+		PlanID:      plan.ID,
+		Quantity:    quantity,
+		Amount:      roundAmount(PlanAmount(plan, quantity) * factor),
+		Proration:   true,
+		PeriodStart: start,
+		PeriodEnd:   end,
+	}
+}
+
+// subscriptionEnded tells whether a subscription will bill no more.
+func subscriptionEnded(subscription *Subscription) bool {
+	return subscription.Status == SubscriptionStatusCanceled || subscription.Status == SubscriptionStatusIncompleteExpired
+}
+
+// subscriptionBillingSetting gives the dunning settings of the market, with defaults for the ones not set.
+func subscriptionBillingSetting() SubscriptionBillingSetting {
+	setting := SubscriptionBillingSetting{}
+	settings, err := GetCurrentMarketSettings()
+	if err == nil && settings != nil {
+		setting = settings.SubscriptionBilling
+	}
+	if len(setting.RetryDays) == 0 {
+		setting.RetryDays = defaultSubscriptionRetryDays
+	}
+	if setting.TrialReminderDays <= 0 {
+		setting.TrialReminderDays = defaultTrialReminderDays
+	}
+	return setting
+}
+
+// updateSubscription applies an update to the subscription matching a filter, nil when none does.
+func updateSubscription(filter bson.D, update bson.D) (*Subscription, error) {
+	subscription := &Subscription{}
+	findUpdateOpts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := database.MongoDB.Collection(SubscriptionsCollection).FindOneAndUpdate(context.Background(), filter, update, findUpdateOpts).Decode(subscription)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	err = cache.RedisClient.Del(subscription.ID.Hex()).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	go webhooks.NewWebhookEvent("subscription.updated", subscription)
+	return subscription, nil
+}
+
+// notifySubscriptionCustomer emails the customer of a subscription.
+func notifySubscriptionCustomer(subscription *Subscription, template string, invoice *SubscriptionInvoice) {
+	customer := GetUserByID(subscription.CustomerID.Hex())
+	if customer == nil || customer.Email == "" {
+		return
+	}
+	notice := &subscriptionNotice{Subscription: subscription, Customer: customer, Invoice: invoice}
+	err := SendEmail("no-reply@tribe.cab", customer.Email, template, customer.Language, notice, nil)
+	if err != nil {
+		log.Errorln(err)
+	}
+}
+
+// Subscribe starts a subscription to a plan, with a trial when the plan gives one.
+// Subscriptions to licensed plans without a trial are invoiced for the first period right away and stay incomplete until it is paid.
+func Subscribe(subscription Subscription, now time.Time) (*Subscription, error) {
+	plan, err := GetSubscriptionPlanByID(subscription.PlanID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if plan == nil {
+		return nil, ErrSubscriptionPlanNotFound
+	}
+	if !plan.Active {
+		return nil, ErrSubscriptionPlanInactive
+	}
+	if subscription.Billing == "" {
+		subscription.Billing = SubscriptionBillingChargeAutomatically
+	}
+	if subscription.Billing == SubscriptionBillingChargeAutomatically && (subscription.PaymentGateway == "" || subscription.PaymentMethodID == "") {
+		return nil, ErrSubscriptionPaymentMethodRequired
+	}
+	if plan.UsageType == SubscriptionPlanUsageTypeMetered {
+		subscription.Quantity = 0
+	} else if subscription.Quantity < 1 {
+		subscription.Quantity = 1
+	}
+
+	days := plan.TrialPeriodDays
+	subscription.BillingCycleAnchor = now
+	subscription.CurrentPeriodStart = now
+	if days > 0 {
+		trialEnd := now.AddDate(0, 0, days)
+		subscription.Status = SubscriptionStatusTrialing
+		subscription.TrialStart = &now
+		subscription.TrialEnd = &trialEnd
+		subscription.BillingCycleAnchor = trialEnd
+		subscription.CurrentPeriodEnd = trialEnd
+		return CreateSubscription(subscription)
+	}
+
+	subscription.CurrentPeriodEnd = addBillingInterval(now, plan, now)
+	subscription.Status = SubscriptionStatusActive
+	if plan.UsageType == SubscriptionPlanUsageTypeLicensed {
+		subscription.Status = SubscriptionStatusIncomplete
+	}
+	created, err := CreateSubscription(subscription)
+	if err != nil {
+		return nil, err
+	}
+	if plan.UsageType != SubscriptionPlanUsageTypeLicensed {
+		return created, nil
+	}
+	lines := []SubscriptionInvoiceLine{planLine(plan, created.Quantity, created.CurrentPeriodStart, created.CurrentPeriodEnd)}
+	_, err = invoiceSubscription(created, plan, SubscriptionInvoiceBillingReasonSubscriptionCreate, lines, now)
+	if err != nil {
+		log.Errorln(err)
+	}
+	return GetSubscriptionByID(created.ID.Hex()), nil
+}
+
+// invoiceSubscription invoices a subscription for lines along with its pending prorations, then collects the invoice.
+// Credits beyond what is owed are carried to the next invoice.
+func invoiceSubscription(subscription *Subscription, plan *SubscriptionPlan, reason SubscriptionInvoiceBillingReason, lines []SubscriptionInvoiceLine, now time.Time) (*SubscriptionInvoice, error) {
+	ctx := context.Background()
+	collection := database.MongoDB.Collection(SubscriptionsCollection)
+
+	//take the pending lines off the subscription so that they are billed once
+	previous := &Subscription{}
+	err := collection.FindOneAndUpdate(ctx, bson.D{{"_id", subscription.ID}}, bson.D{{"$set", bson.D{{"pendingLines", bson.A{}}}}}).Decode(previous)
+	if err != nil {
+		return nil, err
+	}
+	lines = append(lines, previous.PendingLines...)
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	invoice := SubscriptionInvoice{
+		SubscriptionID: subscription.ID,
+		CustomerID:     subscription.CustomerID,
+		Status:         SubscriptionInvoiceStatusOpen,
+		BillingReason:  reason,
+		Currency:       plan.Currency,
+		Lines:          lines,
+		PeriodStart:    lines[0].PeriodStart,
+		PeriodEnd:      lines[0].PeriodEnd,
+		PaymentGateway: subscription.PaymentGateway,
+	}
+	for _, line := range lines {
+		invoice.Total += line.Amount
+		if line.PeriodStart.Before(invoice.PeriodStart) {
+			invoice.PeriodStart = line.PeriodStart
+		}
+		if line.PeriodEnd.After(invoice.PeriodEnd) {
+			invoice.PeriodEnd = line.PeriodEnd
+		}
+	}
+	invoice.Total = roundAmount(invoice.Total)
+	invoice.AmountDue = invoice.Total
+	if invoice.Total <= 0 {
+		invoice.Status = SubscriptionInvoiceStatusPaid
+		invoice.AmountDue = 0
+		invoice.PaidAt = &now
+	}
+	if subscription.Billing == SubscriptionBillingSendInvoice {
+		dueDate := now.AddDate(0, 0, subscription.DaysUntilDue)
+		invoice.DueDate = &dueDate
+	}
+	created, err := CreateSubscriptionInvoice(invoice)
+	if err != nil {
+		//put the pending lines back for the next invoice
+		_, pushErr := collection.UpdateOne(ctx, bson.D{{"_id", subscription.ID}}, bson.D{{"$push", bson.D{{"pendingLines", bson.D{{"$each", previous.PendingLines}}}}}})
+		if pushErr != nil {
+			log.Errorln(pushErr)
+		}
+		return nil, err
+	}
+
+	update := bson.D{{"$set", bson.D{{"latestInvoiceID", created.ID}, {"updatedAt", now}}}}
+	if created.Total < 0 {
+		credit := SubscriptionInvoiceLine{Description: "Credit carried forward", Amount: created.Total, PeriodStart: now, PeriodEnd: now}
+		update = append(update, bson.E{"$push", bson.D{{"pendingLines", credit}}})
+	}
+	updated, err := updateSubscription(bson.D{{"_id", subscription.ID}}, update)
+	if err != nil {
+		return created, err
+	}
+	if updated != nil {
+		subscription = updated
+	}
+
+	switch {
+	case created.Status == SubscriptionInvoiceStatusPaid:
+		go webhooks.NewWebhookEvent("subscription_invoice.paid", created)
+		reinstateSubscription(created, now)
+	case subscription.Billing == SubscriptionBillingSendInvoice:
+		go notifySubscriptionCustomer(subscription, subscriptionInvoiceTemplate, created)
+	default:
+		err = collectSubscriptionInvoice(created, subscription, now)
+	}
+	return created, err
+}
+
+// collectSubscriptionInvoice charges an open invoice to the payment method of its subscription.
+// A failed charge is retried after the days of the dunning settings, once they run out the invoice is uncollectible
+// and the subscription is canceled or left unpaid.
+func collectSubscriptionInvoice(invoice *SubscriptionInvoice, subscription *Subscription, now time.Time) error {
+	attempt := invoice.AttemptCount + 1
+	paymentID, chargeErr := chargeSubscriptionInvoice(invoice, subscription, attempt)
+	if chargeErr == nil {
+		_, err := PaySubscriptionInvoice(invoice, subscription.PaymentGateway, paymentID, now)
+		return err
+	}
+
+	setting := subscriptionBillingSetting()
+	final := attempt > len(setting.RetryDays)
+	invoice.AttemptCount = attempt
+	invoice.LastPaymentError = chargeErr.Error()
+	invoice.NextPaymentAttempt = nil
+	if final {
+		invoice.Status = SubscriptionInvoiceStatusUncollectible
+	} else {
+		next := now.AddDate(0, 0, setting.RetryDays[attempt-1])
+		invoice.NextPaymentAttempt = &next
+	}
+	set := bson.D{
+		{"status", invoice.Status},
+		{"attemptCount", invoice.AttemptCount},
+		{"lastPaymentError", invoice.LastPaymentError},
+		{"nextPaymentAttempt", invoice.NextPaymentAttempt},
+		{"updatedAt", now},
+	}
+	filter := bson.D{{"_id", invoice.ID}, {"status", SubscriptionInvoiceStatusOpen}}
+	_, err := database.MongoDB.Collection(SubscriptionInvoicesCollection).UpdateOne(context.Background(), filter, bson.D{{"$set", set}})
+	if err != nil {
+		log.Errorln(err)
+	}
+	err = cache.RedisClient.Del(invoice.ID.Hex()).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	go webhooks.NewWebhookEvent("subscription_invoice.payment_failed", invoice)
+	go notifySubscriptionCustomer(subscription, subscriptionPaymentFailedTemplate, invoice)
+
+	status := SubscriptionStatusPastDue
+	switch {
+	case invoice.BillingReason == SubscriptionInvoiceBillingReasonSubscriptionCreate && final:
+		status = SubscriptionStatusIncompleteExpired
+	case invoice.BillingReason == SubscriptionInvoiceBillingReasonSubscriptionCreate:
+		status = SubscriptionStatusIncomplete
+	case final && setting.CancelWhenUnpaid:
+		status = SubscriptionStatusCanceled
+	case final:
+		status = SubscriptionStatusUnpaid
+	}
+	subscriptionSet := bson.D{{"status", status}, {"updatedAt", now}}
+	if status == SubscriptionStatusCanceled || status == SubscriptionStatusIncompleteExpired {
+		subscriptionSet = append(subscriptionSet, bson.E{"canceledAt", now}, bson.E{"endedAt", now})
+	}
+	filter = bson.D{
+		{"_id", subscription.ID},
+		{"status", bson.M{"$nin": bson.A{SubscriptionStatusCanceled, SubscriptionStatusIncompleteExpired}}},
+	}
+	updated, err := updateSubscription(filter, bson.D{{"$set", subscriptionSet}})
+	if err != nil {
+		log.Errorln(err)
+	}
+	if updated != nil && status == SubscriptionStatusCanceled {
+		go webhooks.NewWebhookEvent("subscription.canceled", updated)
+	}
+	return chargeErr
+}
+
+func chargeSubscriptionInvoice(invoice *SubscriptionInvoice, subscription *Subscription, attempt int) (string, error) {
+	charger, ok := GetPaymentCharger(subscription.PaymentGateway)
+	if !ok {
+		return "", ErrPaymentGatewayNotConfigured
+	}
+	return charger.ChargePayment(GatewayCharge{
+		ChargeID:        fmt.Sprintf("%s-%d", invoice.ID.Hex(), attempt),
+		CustomerID:      subscription.GatewayCustomerID,
+		PaymentMethodID: subscription.PaymentMethodID,
+		Amount:          invoice.AmountDue,
+		Currency:        invoice.Currency,
+		Description:     "Subscription invoice " + invoice.ID.Hex(),
+	})
+}
+
+// PaySubscriptionInvoice marks an open or uncollectible invoice paid, putting its subscription back in good standing.
+func PaySubscriptionInvoice(invoice *SubscriptionInvoice, gateway string, paymentID string, now time.Time) (*SubscriptionInvoice, error) {
+	filter := bson.D{
+		{"_id", invoice.ID},
+		{"status", bson.M{"$in": bson.A{SubscriptionInvoiceStatusOpen, SubscriptionInvoiceStatusUncollectible}}},
+	}
+	update := bson.D{{"$set", bson.D{
+		{"status", SubscriptionInvoiceStatusPaid},
+		{"amountPaid", invoice.AmountDue},
+		{"paidAt", now},
+		{"paymentGateway", gateway},
+		{"paymentID", paymentID},
+		{"nextPaymentAttempt", nil},
+		{"updatedAt", now},
+	}}}
+	paid := &SubscriptionInvoice{}
+	findUpdateOpts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := database.MongoDB.Collection(SubscriptionInvoicesCollection).FindOneAndUpdate(context.Background(), filter, update, findUpdateOpts).Decode(paid)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrSubscriptionInvoiceNotOpen
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	err = cache.RedisClient.Del(paid.ID.Hex()).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	go webhooks.NewWebhookEvent("subscription_invoice.paid", paid)
+	reinstateSubscription(paid, now)
+	return paid, nil
+}
+
+// reinstateSubscription makes a subscription active again once its latest invoice is paid.
+func reinstateSubscription(invoice *SubscriptionInvoice, now time.Time) {
+	filter := bson.D{
+		{"_id", invoice.SubscriptionID},
+		{"latestInvoiceID", invoice.ID},
+		{"status", bson.M{"$in": bson.A{SubscriptionStatusIncomplete, SubscriptionStatusPastDue, SubscriptionStatusUnpaid}}},
+	}
+	_, err := updateSubscription(filter, bson.D{{"$set", bson.D{{"status", SubscriptionStatusActive}, {"updatedAt", now}}}})
+	if err != nil {
+		log.Errorln(err)
+	}
+}
+
+// ChangeSubscriptionPlan moves a subscription to another plan or quantity.
+// On the same billing interval the unused time of the old plan is credited and the rest of the period on the new plan
+// charged with the next invoice. A new interval restarts the billing cycle and is invoiced right away.
+func ChangeSubscriptionPlan(subscription *Subscription, plan *SubscriptionPlan, quantity *int, now time.Time) (*Subscription, error) {
+	if subscriptionEnded(subscription) {
+		return nil, ErrSubscriptionEnded
+	}
+	if !plan.Active {
+		return nil, ErrSubscriptionPlanInactive
+	}
+	current, err := GetSubscriptionPlanByID(subscription.PlanID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		return nil, ErrSubscriptionPlanNotFound
+	}
+	if !strings.EqualFold(current.Currency, plan.Currency) {
+		return nil, ErrSubscriptionCurrencyMismatch
+	}
+	newQuantity := subscription.Quantity
+	if quantity != nil {
+		newQuantity = *quantity
+	}
+	if plan.UsageType == SubscriptionPlanUsageTypeMetered {
+		newQuantity = 0
+	} else if newQuantity < 1 {
+		newQuantity = 1
+	}
+	start, end := subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd
+	//only what the change touches is written, and only while the subscription is still on the plan and period read,
+	//so renewals and invoices taking the pending lines meanwhile aren't overwritten
+	filter := bson.D{
+		{"_id", subscription.ID},
+		{"planID", current.ID},
+		{"quantity", subscription.Quantity},
+		{"status", subscription.Status},
+		{"currentPeriodEnd", end.Truncate(time.Millisecond)},
+	}
+	set := bson.D{{"planID", plan.ID}, {"quantity", newQuantity}, {"updatedAt", now}}
+	if subscription.Status == SubscriptionStatusTrialing {
+		return changeSubscription(filter, set, nil)
+	}
+
+	factor := prorationFactor(now, start, end)
+	var lines []SubscriptionInvoiceLine
+	if current.UsageType == SubscriptionPlanUsageTypeLicensed && factor > 0 {
+		credit := prorationLine("Unused time on ", current, subscription.Quantity, factor, now, end)
+		credit.Amount = -credit.Amount
+		lines = append(lines, credit)
+	}
+	if sameBillingCycle(current, plan) {
+		if plan.UsageType == SubscriptionPlanUsageTypeLicensed && factor > 0 {
+			lines = append(lines, prorationLine("Remaining time on ", plan, newQuantity, factor, now, end))
+		}
+		return changeSubscription(filter, set, lines)
+	}
+
+	if current.UsageType == SubscriptionPlanUsageTypeMetered {
+		usage, err := periodUsage(subscription, current, start, now)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, planLine(current, usage, start, now))
+	}
+	set = append(set,
+		bson.E{"billingCycleAnchor", now},
+		bson.E{"currentPeriodStart", now},
+		bson.E{"currentPeriodEnd", addBillingInterval(now, plan, now)})
+	updated, err := changeSubscription(filter, set, lines)
+	if err != nil {
+		return nil, err
+	}
+	var cycle []SubscriptionInvoiceLine
+	if plan.UsageType == SubscriptionPlanUsageTypeLicensed {
+		cycle = append(cycle, planLine(plan, newQuantity, updated.CurrentPeriodStart, updated.CurrentPeriodEnd))
+	}
+	_, err = invoiceSubscription(updated, plan, SubscriptionInvoiceBillingReasonSubscriptionUpdate, cycle, now)
+	if err != nil {
+		log.Errorln(err)
+	}
+	return GetSubscriptionByID(updated.ID.Hex()), nil
+}
+
+// changeSubscription sets fields of the subscription matching a filter and adds lines to its pending ones,
+// failing with ErrSubscriptionChanged when it no longer matches.
+func changeSubscription(filter bson.D, set bson.D, lines []SubscriptionInvoiceLine) (*Subscription, error) {
+	update := bson.D{{"$set", set}}
+	if len(lines) > 0 {
+		update = append(update, bson.E{"$push", bson.D{{"pendingLines", bson.D{{"$each", lines}}}}})
+	}
+	changed, err := updateSubscription(filter, update)
+	if err != nil {
+		return nil, err
+	}
+	if changed == nil {
+		return nil, ErrSubscriptionChanged
+	}
+	return changed, nil
+}
+
+// CancelSubscription ends a subscription now, voiding its open invoices, or at the end of the current period.
+func CancelSubscription(subscription *Subscription, atPeriodEnd bool, now time.Time) (*Subscription, error) {
+	if subscriptionEnded(subscription) {
+		return nil, ErrSubscriptionEnded
+	}
+	if atPeriodEnd {
+		return updateSubscription(bson.D{{"_id", subscription.ID}}, bson.D{{"$set", bson.D{{"cancelAtPeriodEnd", true}, {"updatedAt", now}}}})
+	}
+	filter := bson.D{
+		{"_id", subscription.ID},
+		{"status", bson.M{"$nin": bson.A{SubscriptionStatusCanceled, SubscriptionStatusIncompleteExpired}}},
+	}
+	update := bson.D{{"$set", bson.D{{"status", SubscriptionStatusCanceled}, {"canceledAt", now}, {"endedAt", now}, {"updatedAt", now}}}}
+	canceled, err := updateSubscription(filter, update)
+	if err != nil {
+		return nil, err
+	}
+	if canceled == nil {
+		return nil, ErrSubscriptionEnded
+	}
+	//stop collecting the invoices left open
+	filter = bson.D{{"subscriptionID", subscription.ID}, {"status", SubscriptionInvoiceStatusOpen}}
+	update = bson.D{{"$set", bson.D{{"status", SubscriptionInvoiceStatusVoid}, {"nextPaymentAttempt", nil}, {"updatedAt", now}}}}
+	_, err = database.MongoDB.Collection(SubscriptionInvoicesCollection).UpdateMany(context.Background(), filter, update)
+	if err != nil {
+		log.Errorln(err)
+	}
+	go webhooks.NewWebhookEvent("subscription.canceled", canceled)
+	return canceled, nil
+}
+
+// RecordSubscriptionUsage reports usage of a metered subscription in its current period.
+func RecordSubscriptionUsage(subscription *Subscription, quantity int, action SubscriptionUsageAction, timestamp time.Time) (*SubscriptionUsageRecord, error) {
+	if subscriptionEnded(subscription) {
+		return nil, ErrSubscriptionEnded
+	}
+	if quantity < 0 {
+		return nil, ErrInvalidUsageQuantity
+	}
+	plan, err := GetSubscriptionPlanByID(subscription.PlanID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if plan == nil || plan.UsageType != SubscriptionPlanUsageTypeMetered {
+		return nil, ErrSubscriptionNotMetered
+	}
+	if timestamp.Before(subscription.CurrentPeriodStart) || !timestamp.Before(subscription.CurrentPeriodEnd) {
+		return nil, ErrUsageOutsidePeriod
+	}
+	if action == "" {
+		action = SubscriptionUsageActionIncrement
+	}
+	record := SubscriptionUsageRecord{
+		ID:             primitive.NewObjectID(),
+		CreatedAt:      time.Now(),
+		SubscriptionID: subscription.ID,
+		Quantity:       quantity,
+		Action:         action,
+		Timestamp:      timestamp,
+	}
+	_, err = database.MongoDB.Collection(SubscriptionUsageRecordsCollection).InsertOne(context.Background(), &record)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	return &record, nil
+}
+
+// BillSubscriptions starts the next period of the subscriptions whose period is over, invoicing metered usage in arrears
+// and licensed plans in advance. Subscriptions set to cancel at period end are ended instead. It gives the number renewed.
+func BillSubscriptions(now time.Time) (int, error) {
+	filter := bson.D{
+		{"deletedAt", bson.M{"$exists": false}},
+		{"status", bson.M{"$in": bson.A{SubscriptionStatusTrialing, SubscriptionStatusActive, SubscriptionStatusPastDue}}},
+		{"currentPeriodEnd", bson.M{"$lte": now}},
+	}
+	ctx := context.Background()
+	cur, err := database.MongoDB.Collection(SubscriptionsCollection).Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	var subscriptions []*Subscription
+	err = cur.All(ctx, &subscriptions)
+	if err != nil {
+		return 0, err
+	}
+	renewed := 0
+	for _, subscription := range subscriptions {
+		err = renewSubscription(subscription, now)
+		if err != nil {
+			log.Errorln(err)
+			continue
+		}
+		renewed++
+	}
+	return renewed, nil
+}
+
+func renewSubscription(subscription *Subscription, now time.Time) error {
+	plan, err := GetSubscriptionPlanByID(subscription.PlanID.Hex())
+	if err != nil {
+		return err
+	}
+	if plan == nil {
+		return ErrSubscriptionPlanNotFound
+	}
+	start, end := subscription.CurrentPeriodStart, subscription.CurrentPeriodEnd
+	nextEnd := addBillingInterval(end, plan, subscription.BillingCycleAnchor)
+	set := bson.D{{"currentPeriodStart", end}, {"currentPeriodEnd", nextEnd}, {"updatedAt", now}}
+	ending := subscription.CancelAtPeriodEnd
+	if ending {
+		set = bson.D{{"status", SubscriptionStatusCanceled}, {"canceledAt", now}, {"endedAt", end}, {"updatedAt", now}}
+	} else if subscription.Status == SubscriptionStatusTrialing {
+		set = append(set, bson.E{"status", SubscriptionStatusActive})
+	}
+	//claim the period first so that concurrent runs don't bill it twice
+	filter := bson.D{{"_id", subscription.ID}, {"currentPeriodEnd", end}, {"status", subscription.Status}}
+	renewed, err := updateSubscription(filter, bson.D{{"$set", set}})
+	if err != nil || renewed == nil {
+		return err
+	}
+	if ending {
+		go webhooks.NewWebhookEvent("subscription.canceled", renewed)
+	}
+
+	var lines []SubscriptionInvoiceLine
+	if plan.UsageType == SubscriptionPlanUsageTypeMetered && subscription.Status != SubscriptionStatusTrialing {
+		usage, err := periodUsage(subscription, plan, start, end)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, planLine(plan, usage, start, end))
+	}
+	if plan.UsageType == SubscriptionPlanUsageTypeLicensed && !ending {
+		lines = append(lines, planLine(plan, subscription.Quantity, end, nextEnd))
+	}
+	_, err = invoiceSubscription(renewed, plan, SubscriptionInvoiceBillingReasonSubscriptionCycle, lines, now)
+	return err
+}
+
+// RetrySubscriptionInvoices charges the open invoices whose next payment attempt is due. It gives the number paid.
+func RetrySubscriptionInvoices(now time.Time) (int, error) {
+	ctx := context.Background()
+	collection := database.MongoDB.Collection(SubscriptionInvoicesCollection)
+	filter := bson.D{{"status", SubscriptionInvoiceStatusOpen}, {"nextPaymentAttempt", bson.M{"$lte": now}}}
+	cur, err := collection.Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	var invoices []*SubscriptionInvoice
+	err = cur.All(ctx, &invoices)
+	if err != nil {
+		return 0, err
+	}
+	paid := 0
+	for _, invoice := range invoices {
+		//claim the attempt first so that concurrent runs don't charge twice
+		claim := bson.D{{"$set", bson.D{{"nextPaymentAttempt", nil}}}}
+		res, err := collection.UpdateOne(ctx, bson.D{{"_id", invoice.ID}, {"nextPaymentAttempt", invoice.NextPaymentAttempt}}, claim)
+		if err != nil {
+			log.Errorln(err)
+			continue
+		}
+		if res.ModifiedCount < 1 {
+			continue
+		}
+		subscription := GetSubscriptionByID(invoice.SubscriptionID.Hex())
+		if subscription.ID.IsZero() || subscriptionEnded(subscription) {
+			continue
+		}
+		err = collectSubscriptionInvoice(invoice, subscription, now)
+		if err != nil {
+			log.Errorln(err)
+			continue
+		}
+		paid++
+	}
+	return paid, nil
+}
+
+// NotifyEndingTrials lets customers know their trial ends soon, once per subscription. It gives the number notified.
+func NotifyEndingTrials(now time.Time) (int, error) {
+	setting := subscriptionBillingSetting()
+	filter := bson.D{
+		{"deletedAt", bson.M{"$exists": false}},
+		{"status", SubscriptionStatusTrialing},
+		{"trialEnd", bson.M{"$lte": now.AddDate(0, 0, setting.TrialReminderDays)}},
+		{"trialEndNotifiedAt", nil},
+	}
+	ctx := context.Background()
+	cur, err := database.MongoDB.Collection(SubscriptionsCollection).Find(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	var subscriptions []*Subscription
+	err = cur.All(ctx, &subscriptions)
+	if err != nil {
+		return 0, err
+	}
+	notified := 0
+	for _, subscription := range subscriptions {
+		claim := bson.D{{"$set", bson.D{{"trialEndNotifiedAt", now}, {"updatedAt", now}}}}
+		claimed, err := updateSubscription(bson.D{{"_id", subscription.ID}, {"trialEndNotifiedAt", nil}}, claim)
+		if err != nil || claimed == nil {
+			continue
+		}
+		go webhooks.NewWebhookEvent("subscription.trial_will_end", claimed)
+		go notifySubscriptionCustomer(claimed, subscriptionTrialEndingTemplate, nil)
+		notified++
+	}
+	return notified, nil
+}
+
+// RunSubscriptionBilling renews subscriptions and retries failed charges, checking every interval.
+func RunSubscriptionBilling(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		if _, err := NotifyEndingTrials(now); err != nil {
+			log.Errorln(err)
+		}
+		if _, err := BillSubscriptions(now); err != nil {
+			log.Errorln(err)
+		}
+		if _, err := RetrySubscriptionInvoices(now); err != nil {
+			log.Errorln(err)
+		}
+		<-ticker.C
+	}
+}
@@ -0,0 +1,45 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestPlanAmount(t *testing.T) {
+	t.Run("per unit with usage in buckets", func(t *testing.T) {
+		plan := &SubscriptionPlan{Amount: 2.5, TransformUsage: &PlanTransformUsage{DivideBy: 100, Round: SubscriptionPlanTransformUsageRoundUp}}
+		require.Equal(t, 7.5, PlanAmount(plan, 201))
+	})
+	tiers := []SubscriptionPlanTier{{UpTo: 10, UnitAmount: 5}, {UpTo: 50, UnitAmount: 4, FlatAmount: 10}, {UnitAmount: 3}}
+	t.Run("volume tiers price every unit at the tier reached", func(t *testing.T) {
+		plan := &SubscriptionPlan{BillingScheme: SubscriptionPlanBillingSchemeTiered, TiersMode: SubscriptionPlanTiersModeVolume, Tiers: tiers}
+		require.Equal(t, 130.0, PlanAmount(plan, 30))
+		require.Equal(t, 180.0, PlanAmount(plan, 60))
+	})
+	t.Run("graduated tiers price the units within each tier", func(t *testing.T) {
+		plan := &SubscriptionPlan{BillingScheme: SubscriptionPlanBillingSchemeTiered, TiersMode: SubscriptionPlanTiersModeGraduated, Tiers: tiers}
+		require.Equal(t, 140.0, PlanAmount(plan, 30))
+		require.Equal(t, 250.0, PlanAmount(plan, 60))
+	})
+}
+
+func TestAddBillingInterval(t *testing.T) {
+	anchor := time.Date(2019, time.January, 31, 10, 0, 0, 0, time.UTC)
+	plan := &SubscriptionPlan{Interval: SubscriptionPlanIntervalMonth, IntervalCount: 1}
+	february := addBillingInterval(anchor, plan, anchor)
+	require.Equal(t, time.Date(2019, time.February, 28, 10, 0, 0, 0, time.UTC), february)
+	require.Equal(t, time.Date(2019, time.March, 31, 10, 0, 0, 0, time.UTC), addBillingInterval(february, plan, anchor))
+}
+
+func TestProrationFactor(t *testing.T) {
+	start := time.Date(2019, time.June, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 0, 30)
+	require.Equal(t, 0.5, prorationFactor(start.AddDate(0, 0, 15), start, end))
+	require.Equal(t, 1.0, prorationFactor(start.Add(-time.Hour), start, end))
+	require.Equal(t, 0.0, prorationFactor(end, start, end))
+}
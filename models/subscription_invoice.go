@@ -0,0 +1,156 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/cache"
+	"github.com/tribehq/platform/lib/database"
+	"github.com/tribehq/platform/utils/webhooks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+// SubscriptionInvoice bills a subscription for a period.
+type SubscriptionInvoice struct {
+	ID                 primitive.ObjectID               `json:"id,omitempty" bson:"_id,omitempty"`
+	CreatedAt          time.Time                        `json:"createdAt" bson:"createdAt"`
+	DeletedAt          *time.Time                       `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	UpdatedAt          time.Time                        `json:"updatedAt" bson:"updatedAt"`
+	SubscriptionID     primitive.ObjectID               `json:"subscriptionID" bson:"subscriptionID"`
+	CustomerID         primitive.ObjectID               `json:"customerID" bson:"customerID"`
+	Status             SubscriptionInvoiceStatus        `json:"status" bson:"status"`
+	BillingReason      SubscriptionInvoiceBillingReason `json:"billingReason" bson:"billingReason"`
+	Currency           string                           `json:"currency" bson:"currency"`
+	Lines              []SubscriptionInvoiceLine        `json:"lines" bson:"lines"`
+	Total              float64                          `json:"total" bson:"total"`
+	AmountDue          float64                          `json:"amountDue" bson:"amountDue"`
+	AmountPaid         float64                          `json:"amountPaid" bson:"amountPaid"`
+	PeriodStart        time.Time                        `json:"periodStart" bson:"periodStart"`
+	PeriodEnd          time.Time                        `json:"periodEnd" bson:"periodEnd"`
+	DueDate            *time.Time                       `json:"dueDate" bson:"dueDate"`
+	PaymentGateway     string                           `json:"paymentGateway" bson:"paymentGateway"`
+	PaymentID          string                           `json:"paymentID" bson:"paymentID"`
+	AttemptCount       int                              `json:"attemptCount" bson:"attemptCount"`
+	NextPaymentAttempt *time.Time                       `json:"nextPaymentAttempt" bson:"nextPaymentAttempt"`
+	LastPaymentError   string                           `json:"lastPaymentError" bson:"lastPaymentError"`
+	PaidAt             *time.Time                       `json:"paidAt" bson:"paidAt"`
+}
+
+// SubscriptionInvoiceLine is a charge or credit of a subscription invoice.
+type SubscriptionInvoiceLine struct {
+	Description string             `json:"description" bson:"description"`
+	PlanID      primitive.ObjectID `json:"planID" bson:"planID"`
+	Quantity    int                `json:"quantity" bson:"quantity"`
+	Amount      float64            `json:"amount" bson:"amount"`
+	Proration   bool               `json:"proration" bson:"proration"`
+	PeriodStart time.Time          `json:"periodStart" bson:"periodStart"`
+	PeriodEnd   time.Time          `json:"periodEnd" bson:"periodEnd"`
+}
+
+// CreateSubscriptionInvoice creates new subscription invoices.
+func CreateSubscriptionInvoice(invoice SubscriptionInvoice) (*SubscriptionInvoice, error) {
+	invoice.CreatedAt = time.Now()
+	invoice.UpdatedAt = time.Now()
+	invoice.ID = primitive.NewObjectID()
+	db := database.MongoDB
+	collection := db.Collection(SubscriptionInvoicesCollection)
+	_, err := collection.InsertOne(context.Background(), &invoice)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	go webhooks.NewWebhookEvent("subscription_invoice.created", &invoice)
+	cacheClient := cache.RedisClient
+	//set cache item
+	err = cacheClient.Set(invoice.ID.Hex(), invoice, DefaultRedisCacheTime).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	return &invoice, nil
+}
+
+// GetSubscriptionInvoiceByID gives requested subscription invoice by id, nil when it doesn't exist.
+func GetSubscriptionInvoiceByID(ID string) (*SubscriptionInvoice, error) {
+	db := database.MongoDB
+	invoice := &SubscriptionInvoice{}
+	//try finding item in cache
+	cacheClient := cache.RedisClient
+	err := cacheClient.Get(ID).Scan(invoice)
+	if err != nil && err != redis.Nil {
+		log.Error(err)
+	} else if err == redis.Nil {
+		//key is empty or not set
+	}
+	id, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.D{{"_id", id}, {"deletedAt", bson.M{"$exists": false}}}
+	err = db.Collection(SubscriptionInvoicesCollection).FindOne(context.Background(), filter).Decode(&invoice)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	//set cache item
+	err = cacheClient.Set(ID, invoice, DefaultRedisCacheTime).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	return invoice, nil
+}
+
+// GetSubscriptionInvoices gives a list of subscription invoices.
+func GetSubscriptionInvoices(filter bson.D, limit int, after *string, before *string, first *int, last *int) (invoices []*SubscriptionInvoice, totalCount int64, hasPrevious, hasNext bool, err error) {
+	db := database.MongoDB
+	tcint, filter, err := calcTotalCountWithQueryFilters(SubscriptionInvoicesCollection, filter, after, before)
+	pagingInfo, err := PaginationUtility(after, before, first, last, &tcint)
+	if err != nil {
+		return
+	}
+	pagingInfo.QueryOpts.SetSort(bson.M{"_id": 1})
+	totalCount = int64(tcint)
+
+	ctx := context.Background()
+	cur, err := db.Collection(SubscriptionInvoicesCollection).Find(ctx, filter, &pagingInfo.QueryOpts)
+	if err != nil {
+		return
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		invoice := &SubscriptionInvoice{}
+		err = cur.Decode(&invoice)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		invoices = append(invoices, invoice)
+	}
+	if err = cur.Err(); err != nil {
+		return
+	}
+	return invoices, totalCount, pagingInfo.HasPreviousPage, pagingInfo.HasNextPage, nil
+}
+
+//UnmarshalBinary required for the redis cache to work
+func (invoice *SubscriptionInvoice) UnmarshalBinary(data []byte) error {
+	if err := json.Unmarshal(data, invoice); err != nil {
+		return err
+	}
+	return nil
+}
+
+//MarshalBinary required for the redis cache to work
+func (invoice *SubscriptionInvoice) MarshalBinary() ([]byte, error) {
+	return json.Marshal(invoice)
+}
@@ -0,0 +1,437 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	log "github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TaxLocation is the place an order is delivered to or a fare is charged in.
+type TaxLocation struct {
+	Country  string // country code
+	State    string // state code
+	City     string
+	PostCode string
+}
+
+// TaxableItem is an amount to tax, after discounts and including tax when prices include tax.
+type TaxableItem struct {
+	Amount    float64
+	TaxClass  string
+	TaxStatus string
+}
+
+// TaxBreakdown is the tax worked out for an order or a fare.
+type TaxBreakdown struct {
+	ItemTaxes   []float64 // tax of each item in the order they were given
+	FeeTaxes    []float64 // tax of each fee in the order they were given
+	ItemsTax    float64
+	FeesTax     float64
+	ShippingTax float64
+	Total       float64
+	rates       []*rateTax
+}
+
+// taxRate is a tax rate resolved for a location.
+type taxRate struct {
+	id       *primitive.ObjectID
+	code     string
+	label    string
+	rate     float64
+	priority int
+	compound bool
+	shipping bool
+}
+
+// rateTax is the tax collected by one rate.
+type rateTax struct {
+	rate        taxRate
+	tax         float64
+	shippingTax float64
+}
+
+// taxCalculator resolves tax rates for a location once per tax class while taxing an order.
+type taxCalculator struct {
+	location TaxLocation
+	setting  TaxSetting
+	country  *Country
+	rates    map[string][]taxRate
+}
+
+// TaxLocationOf gives the tax location of an address.
+func TaxLocationOf(address *Address) TaxLocation {
+	location := TaxLocation{
+		Country: address.Country.Code,
+		State:   address.State.StateCode,
+		City:    address.City.CityName,
+	}
+	if location.Country == "" {
+		location.Country = address.City.CountryCode
+	}
+	if location.State == "" {
+		location.State = address.City.StateCode
+	}
+	if address.PostCode > 0 {
+		location.PostCode = strconv.Itoa(address.PostCode)
+	}
+	return location
+}
+
+// currentTaxSetting gives the tax settings of the market, taxes are disabled when the market has no settings.
+func currentTaxSetting() TaxSetting {
+	settings, err := GetCurrentMarketSettings()
+	if err != nil {
+		log.Errorln(err)
+	}
+	if settings == nil {
+		return TaxSetting{}
+	}
+	return settings.Tax
+}
+
+// CalculateTax works out the tax on items, shipping and fees delivered to location.
+// Items are tax inclusive when the setting says prices include tax, shipping and fees are always tax exclusive.
+func CalculateTax(location TaxLocation, items []TaxableItem, shipping float64, fees []TaxableItem, setting TaxSetting) (*TaxBreakdown, error) {
+	breakdown := &TaxBreakdown{ItemTaxes: make([]float64, len(items)), FeeTaxes: make([]float64, len(fees))}
+	if !setting.EnableTaxes {
+		return breakdown, nil
+	}
+	calculator := &taxCalculator{location: location, setting: setting, rates: map[string][]taxRate{}}
+
+	var itemsTax, feesTax, shippingTax float64
+	for i, item := range items {
+		tax, err := calculator.tax(breakdown, item, setting.PricesIncludeTax, false)
+		if err != nil {
+			return nil, err
+		}
+		breakdown.ItemTaxes[i] = roundAmount(tax)
+		itemsTax += tax
+	}
+	for i, fee := range fees {
+		tax, err := calculator.tax(breakdown, fee, false, false)
+		if err != nil {
+			return nil, err
+		}
+		breakdown.FeeTaxes[i] = roundAmount(tax)
+		feesTax += tax
+	}
+	if shipping > 0 {
+		tax, err := calculator.tax(breakdown, TaxableItem{Amount: shipping, TaxClass: setting.ShippingTaxClass}, false, true)
+		if err != nil {
+			return nil, err
+		}
+		shippingTax = tax
+	}
+
+	if setting.RoundAtSubtotal {
+		for _, rate := range breakdown.rates {
+			rate.tax = roundTax(rate.tax, setting.RoundingMode)
+			rate.shippingTax = roundTax(rate.shippingTax, setting.RoundingMode)
+		}
+		itemsTax = roundTax(itemsTax, setting.RoundingMode)
+		feesTax = roundTax(feesTax, setting.RoundingMode)
+		shippingTax = roundTax(shippingTax, setting.RoundingMode)
+	}
+	breakdown.ItemsTax = roundAmount(itemsTax)
+	breakdown.FeesTax = roundAmount(feesTax)
+	breakdown.ShippingTax = roundAmount(shippingTax)
+	breakdown.Total = roundAmount(breakdown.ItemsTax + breakdown.FeesTax + breakdown.ShippingTax)
+	return breakdown, nil
+}
+
+// Merge adds the tax of another breakdown, used to total the tax of split orders.
+func (b *TaxBreakdown) Merge(other *TaxBreakdown) {
+	for _, rate := range other.rates {
+		b.add(rate.rate, rate.tax, false)
+		b.add(rate.rate, rate.shippingTax, true)
+	}
+	b.ItemsTax = roundAmount(b.ItemsTax + other.ItemsTax)
+	b.FeesTax = roundAmount(b.FeesTax + other.FeesTax)
+	b.ShippingTax = roundAmount(b.ShippingTax + other.ShippingTax)
+	b.Total = roundAmount(b.Total + other.Total)
+}
+
+// TaxLines gives the tax collected per rate as order tax lines.
+func (b *TaxBreakdown) TaxLines() []TaxLines {
+	lines := []TaxLines{}
+	for i, rate := range b.rates {
+		lines = append(lines, TaxLines{
+			ID:               i + 1,
+			RateCode:         rate.rate.code,
+			RateID:           rate.rate.id,
+			Label:            rate.rate.label,
+			Compound:         rate.rate.compound,
+			RatePercent:      rate.rate.rate,
+			TaxTotal:         strconv.FormatFloat(roundAmount(rate.tax), 'f', 2, 64),
+			ShippingTaxTotal: strconv.FormatFloat(roundAmount(rate.shippingTax), 'f', 2, 64),
+			MetaData:         []string{},
+		})
+	}
+	return lines
+}
+
+// add books tax collected by a rate.
+func (b *TaxBreakdown) add(rate taxRate, tax float64, shipping bool) {
+	var total *rateTax
+	for _, existing := range b.rates {
+		if existing.rate.code == rate.code {
+			total = existing
+			break
+		}
+	}
+	if total == nil {
+		total = &rateTax{rate: rate}
+		b.rates = append(b.rates, total)
+	}
+	if shipping {
+		total.shippingTax += tax
+	} else {
+		total.tax += tax
+	}
+}
+
+// tax works out and books the tax of one item, giving the item's total tax.
+func (c *taxCalculator) tax(breakdown *TaxBreakdown, item TaxableItem, inclusive bool, shipping bool) (float64, error) {
+	if item.Amount <= 0 || (item.TaxStatus != "" && item.TaxStatus != "taxable") {
+		return 0, nil
+	}
+	rates, err := c.resolve(item.TaxClass)
+	if err != nil {
+		return 0, err
+	}
+	if shipping {
+		var shippingRates []taxRate
+		for _, rate := range rates {
+			if rate.shipping {
+				shippingRates = append(shippingRates, rate)
+			}
+		}
+		rates = shippingRates
+	}
+	var total float64
+	for i, tax := range taxesOn(item.Amount, rates, inclusive) {
+		if !c.setting.RoundAtSubtotal {
+			tax = roundTax(tax, c.setting.RoundingMode)
+		}
+		breakdown.add(rates[i], tax, shipping)
+		total += tax
+	}
+	return total, nil
+}
+
+// resolve gives the tax rates of a tax class in the calculator's location.
+// Per priority only the most specific matching rule applies, when the country has no rules at all
+// the rate configured on the country for the tax class is used.
+func (c *taxCalculator) resolve(taxClass string) ([]taxRate, error) {
+	taxClass = normalizeTaxClass(taxClass)
+	if rates, ok := c.rates[taxClass]; ok {
+		return rates, nil
+	}
+	rules, err := getActiveTaxRules(c.location.Country, taxClass)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID.Hex() < rules[j].ID.Hex() })
+
+	best := map[int]*TaxRule{}
+	bestScore := map[int]int{}
+	for _, rule := range rules {
+		score, ok := taxRuleMatch(rule, c.location)
+		if !ok {
+			continue
+		}
+		if current, found := bestScore[rule.Priority]; !found || score > current {
+			best[rule.Priority] = rule
+			bestScore[rule.Priority] = score
+		}
+	}
+
+	var rates []taxRate
+	for _, rule := range best {
+		id := rule.ID
+		rates = append(rates, taxRate{
+			id:       &id,
+			code:     taxRateCode(rule.Country, rule.State, rule.Name, rule.Priority),
+			label:    rule.Name,
+			rate:     rule.Rate,
+			priority: rule.Priority,
+			compound: rule.Compound,
+			shipping: rule.Shipping,
+		})
+	}
+	if len(rules) == 0 {
+		rate, err := c.countryRate(taxClass)
+		if err != nil {
+			return nil, err
+		}
+		if rate > 0 {
+			rates = append(rates, taxRate{code: taxRateCode(c.location.Country, "", "Tax", 1), label: "Tax", rate: rate, priority: 1, shipping: true})
+		}
+	}
+	sort.Slice(rates, func(i, j int) bool {
+		if rates[i].compound != rates[j].compound {
+			return !rates[i].compound
+		}
+		return rates[i].priority < rates[j].priority
+	})
+	c.rates[taxClass] = rates
+	return rates, nil
+}
+
+// countryRate gives the rate the country configures for a tax class, zero when it has none.
+func (c *taxCalculator) countryRate(taxClass string) (float64, error) {
+	if c.country == nil {
+		if c.location.Country == "" {
+			return 0, nil
+		}
+		country, err := GetCountryByCode(c.location.Country)
+		if err != nil {
+			return 0, err
+		}
+		if country == nil {
+			return 0, nil
+		}
+		c.country = country
+	}
+	key := taxClass
+	if key == "" {
+		key = "standard"
+	}
+	value, ok := c.country.Tax[key]
+	if !ok {
+		return 0, nil
+	}
+	rate, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "%"), 64)
+	if err != nil {
+		log.Errorln(err)
+		return 0, nil
+	}
+	return rate, nil
+}
+
+// taxesOn gives the tax of each rate on amount. Compound rates are charged on the amount plus the taxes before them,
+// inclusive amounts have the tax taken out of them first.
+func taxesOn(amount float64, rates []taxRate, inclusive bool) []float64 {
+	net := amount
+	if inclusive {
+		var regular float64
+		compound := 1.0
+		for _, rate := range rates {
+			if rate.compound {
+				compound *= 1 + rate.rate/100
+			} else {
+				regular += rate.rate / 100
+			}
+		}
+		net = amount / ((1 + regular) * compound)
+	}
+	taxes := make([]float64, len(rates))
+	base := net
+	for i, rate := range rates {
+		if !rate.compound {
+			taxes[i] = net * rate.rate / 100
+			base += taxes[i]
+		}
+	}
+	for i, rate := range rates {
+		if rate.compound {
+			taxes[i] = base * rate.rate / 100
+			base += taxes[i]
+		}
+	}
+	return taxes
+}
+
+// taxRuleMatch tells whether a rule applies to location and how specific it is.
+// Post codes ending in * match by prefix.
+func taxRuleMatch(rule *TaxRule, location TaxLocation) (int, bool) {
+	score := 0
+	if rule.State != "" {
+		if !strings.EqualFold(rule.State, location.State) {
+			return 0, false
+		}
+		score++
+	}
+	if rule.City != "" {
+		if !strings.EqualFold(rule.City, location.City) {
+			return 0, false
+		}
+		score += 2
+	}
+	if rule.PostCode != "" {
+		if strings.HasSuffix(rule.PostCode, "*") {
+			if !strings.HasPrefix(location.PostCode, strings.TrimSuffix(rule.PostCode, "*")) {
+				return 0, false
+			}
+		} else if rule.PostCode != location.PostCode {
+			return 0, false
+		}
+		score += 4
+	}
+	return score, true
+}
+
+// normalizeTaxClass gives the tax class as stored on tax rules, the standard class is empty.
+func normalizeTaxClass(taxClass string) string {
+	taxClass = strings.ToLower(strings.TrimSpace(taxClass))
+	if taxClass == "standard" {
+		return ""
+	}
+	return taxClass
+}
+
+// taxRateCode gives the code of a tax rate, like IN-KA-GST-1.
+func taxRateCode(country string, state string, name string, priority int) string {
+	var parts []string
+	for _, part := range []string{country, state, name} {
+		if part != "" {
+			parts = append(parts, strings.ToUpper(part))
+		}
+	}
+	return strings.Join(append(parts, strconv.Itoa(priority)), "-")
+}
+
+// roundTax rounds a tax amount to cents using the rounding mode.
+func roundTax(amount float64, mode TaxRoundingMode) float64 {
+	//drop floating point noise before rounding so 1.005 isn't taken for 1.00499
+	cents := math.Round(amount*100*1e6) / 1e6
+	switch mode {
+	case TaxRoundingModeHalfEven:
+		cents = math.RoundToEven(cents)
+	case TaxRoundingModeUp:
+		cents = math.Ceil(cents)
+	case TaxRoundingModeDown:
+		cents = math.Floor(cents)
+	default:
+		cents = math.Round(cents)
+	}
+	return cents / 100
+}
+
+// TaxBookingFare adds the tax on a booking fare charged in address to the fare estimate.
+func TaxBookingFare(estimate *BookingFareEstimate, address *Address) error {
+	if estimate.TotalFare == nil {
+		return nil
+	}
+	setting := currentTaxSetting()
+	items := []TaxableItem{{Amount: *estimate.TotalFare, TaxClass: setting.FareTaxClass}}
+	breakdown, err := CalculateTax(TaxLocationOf(address), items, 0, nil, setting)
+	if err != nil {
+		return err
+	}
+	tax := breakdown.Total
+	estimate.Tax = &tax
+	estimate.TaxLines = breakdown.TaxLines()
+	if !setting.PricesIncludeTax {
+		totalFare := roundAmount(*estimate.TotalFare + tax)
+		estimate.TotalFare = &totalFare
+	}
+	return nil
+}
@@ -0,0 +1,224 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/cache"
+	"github.com/tribehq/platform/lib/database"
+	"github.com/tribehq/platform/utils/webhooks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"time"
+)
+
+// TaxRule represents a tax rate charged in a location on a tax class.
+// Empty location fields match every location and an empty tax class is the standard class.
+type TaxRule struct {
+	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	DeletedAt *time.Time         `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+	CreatedBy primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	Country   string             `json:"country" bson:"country"`
+	State     string             `json:"state" bson:"state"`
+	City      string             `json:"city" bson:"city"`
+	PostCode  string             `json:"postCode" bson:"postCode"`
+	TaxClass  string             `json:"taxClass" bson:"taxClass"`
+	Rate      float64            `json:"rate" bson:"rate"`
+	Name      string             `json:"name" bson:"name"`
+	Priority  int                `json:"priority" bson:"priority"`
+	Compound  bool               `json:"compound" bson:"compound"`
+	Shipping  bool               `json:"shipping" bson:"shipping"`
+	IsActive  bool               `json:"isActive" bson:"isActive"`
+}
+
+// CreateTaxRule creates new tax rule.
+func CreateTaxRule(taxRule TaxRule) (*TaxRule, error) {
+	taxRule.CreatedAt = time.Now()
+	taxRule.UpdatedAt = time.Now()
+	taxRule.ID = primitive.NewObjectID()
+	db := database.MongoDB
+	collection := db.Collection(TaxRulesCollection)
+	ctx := context.Background()
+	_, err := collection.InsertOne(ctx, &taxRule)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	go webhooks.NewWebhookEvent("tax_rule.created", &taxRule)
+	cacheClient := cache.RedisClient
+	//set cache item
+	err = cacheClient.Set(taxRule.ID.Hex(), taxRule, DefaultRedisCacheTime).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	return &taxRule, nil
+}
+
+// GetTaxRuleByID gives tax rule by id.
+func GetTaxRuleByID(ID string) (*TaxRule, error) {
+	db := database.MongoDB
+	taxRule := &TaxRule{}
+	//try finding item in cache
+	cacheClient := cache.RedisClient
+	err := cacheClient.Get(ID).Scan(taxRule)
+	if err != nil && err != redis.Nil {
+		log.Error(err)
+	} else if err == redis.Nil {
+		//key is empty or not set
+	}
+	id, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.D{{"_id", id}, {"deletedAt", bson.M{"$exists": false}}}
+	ctx := context.Background()
+	err = db.Collection(TaxRulesCollection).FindOne(ctx, filter).Decode(&taxRule)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	//set cache item
+	err = cacheClient.Set(ID, taxRule, DefaultRedisCacheTime).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	return taxRule, nil
+}
+
+// GetTaxRules gives a list of tax rules.
+func GetTaxRules(filter bson.D, limit int, after *string, before *string, first *int, last *int) (taxRules []*TaxRule, totalCount int64, hasPrevious, hasNext bool, err error) {
+
+	db := database.MongoDB
+
+	tcint, filter, err := calcTotalCountWithQueryFilters(TaxRulesCollection, filter, after, before)
+	pagingInfo, err := PaginationUtility(after, before, first, last, &tcint)
+	if err != nil {
+		return
+	}
+	pagingInfo.QueryOpts.SetSort(bson.M{"_id": 1})
+
+	cur, err := db.Collection(TaxRulesCollection).Find(context.Background(), filter, &pagingInfo.QueryOpts)
+	if err != nil {
+		return
+	}
+	ctx := context.Background()
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		taxRule := &TaxRule{}
+		err = cur.Decode(&taxRule)
+		if err != nil {
+			if err == mongo.ErrNoDocuments {
+				return
+			}
+			log.Errorln(err)
+		}
+		taxRules = append(taxRules, taxRule)
+	}
+	if err = cur.Err(); err != nil {
+		return
+	}
+	return taxRules, int64(tcint), pagingInfo.HasPreviousPage, pagingInfo.HasNextPage, nil
+}
+
+// getActiveTaxRules gives the active tax rules of a country on a tax class, including the rules for every country.
+func getActiveTaxRules(country string, taxClass string) ([]*TaxRule, error) {
+	var taxRules []*TaxRule
+	filter := bson.D{
+		{"country", bson.M{"$in": []string{country, ""}}},
+		{"taxClass", taxClass},
+		{"isActive", true},
+		{"deletedAt", bson.M{"$exists": false}},
+	}
+	ctx := context.Background()
+	cur, err := database.MongoDB.Collection(TaxRulesCollection).Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		taxRule := &TaxRule{}
+		err = cur.Decode(&taxRule)
+		if err != nil {
+			log.Errorln(err)
+			continue
+		}
+		taxRules = append(taxRules, taxRule)
+	}
+	return taxRules, cur.Err()
+}
+
+// UpdateTaxRule updates tax rule.
+func UpdateTaxRule(r *TaxRule) (*TaxRule, error) {
+	taxRule := r
+	taxRule.UpdatedAt = time.Now()
+	filter := bson.D{{"_id", taxRule.ID}}
+	db := database.MongoDB
+	taxRulesCollection := db.Collection(TaxRulesCollection)
+	findRepOpts := &options.FindOneAndReplaceOptions{}
+	findRepOpts.SetReturnDocument(options.After)
+	err := taxRulesCollection.FindOneAndReplace(context.Background(), filter, taxRule, findRepOpts).Decode(&taxRule)
+	if err != nil {
+		log.Error(err)
+		return nil, err
+	}
+	go webhooks.NewWebhookEvent("tax_rule.updated", &taxRule)
+	//Update cache item
+	cacheClient := cache.RedisClient
+	err = cacheClient.Del(taxRule.ID.Hex()).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	return taxRule, nil
+}
+
+// DeleteTaxRuleByID deletes tax rule by id.
+func DeleteTaxRuleByID(ID string) (bool, error) {
+	db := database.MongoDB
+	id, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return false, err
+	}
+	filter := bson.D{{"_id", id}}
+	taxRulesCollection := db.Collection(TaxRulesCollection)
+	res, err := taxRulesCollection.UpdateOne(context.Background(), filter, bson.D{{"$set", bson.D{{"deletedAt", time.Now()}}}})
+	if err != nil {
+		log.Errorln(err)
+		return false, err
+	}
+	if res.MatchedCount < 1 {
+		return false, nil
+	}
+	go webhooks.NewWebhookEvent("tax_rule.deleted", &res)
+	//Delete cache item
+	cacheClient := cache.RedisClient
+	err = cacheClient.Del(ID).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	return true, nil
+}
+
+//UnmarshalBinary required for the redis cache to work
+func (taxRule *TaxRule) UnmarshalBinary(data []byte) error {
+	if err := json.Unmarshal(data, taxRule); err != nil {
+		return err
+	}
+	return nil
+}
+
+//MarshalBinary required for the redis cache to work
+func (taxRule *TaxRule) MarshalBinary() ([]byte, error) {
+	return json.Marshal(taxRule)
+}
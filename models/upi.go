@@ -0,0 +1,310 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/database"
+	"github.com/tribehq/platform/lib/payments/upi"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrMerchantNotFound is returned when no merchant has the MID.
+	ErrMerchantNotFound = errors.New("merchant not found")
+	// ErrInvalidVPA is returned for a UPI address that isn't well formed.
+	ErrInvalidVPA = errors.New("invalid upi address")
+	// ErrVPAInUse is returned when a UPI address already collects payments for another store.
+	ErrVPAInUse = errors.New("upi address is used by another store")
+)
+
+// UPIMerchantAccount is the VPA a merchant collects UPI payments to, for a store of theirs.
+// The VPA belongs to the merchant with the MID at the bank, and is the payee of the store's UPI payments.
+type UPIMerchantAccount struct {
+	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
+	StoreID   primitive.ObjectID `json:"storeID" bson:"storeID"`
+	MID       string             `json:"mid" bson:"mid"`
+	VPA       string             `json:"vpa" bson:"vpa"`
+	Name      string             `json:"name" bson:"name"` // the payee name UPI apps show
+	MCC       string             `json:"mcc" bson:"mcc"`
+	IsActive  bool               `json:"isActive" bson:"isActive"`
+}
+
+// UPITransaction is a UPI payment of an order or job, collected from the payer's VPA or made from their UPI app through an intent.
+// A transaction we expired because the payer didn't pay in time still takes the final status the bank reports for it later.
+type UPITransaction struct {
+	ID            primitive.ObjectID   `json:"id,omitempty" bson:"_id,omitempty"`
+	CreatedAt     time.Time            `json:"createdAt" bson:"createdAt"`
+	UpdatedAt     time.Time            `json:"updatedAt" bson:"updatedAt"`
+	TxnRef        string               `json:"txnRef" bson:"txnRef"` // our reference, the bank reports the payment's status by it
+	Bank          string               `json:"bank" bson:"bank"`
+	Mode          UPITransactionMode   `json:"mode" bson:"mode"`
+	Status        UPITransactionStatus `json:"status" bson:"status"`
+	OrderID       *primitive.ObjectID  `json:"orderID" bson:"orderID,omitempty"`
+	JobID         *primitive.ObjectID  `json:"jobID" bson:"jobID,omitempty"`
+	PayerVPA      string               `json:"payerVPA" bson:"payerVPA,omitempty"`
+	PayeeVPA      string               `json:"payeeVPA" bson:"payeeVPA"`
+	PayeeName     string               `json:"payeeName" bson:"payeeName"`
+	MID           string               `json:"mid" bson:"mid"`
+	StoreID       *primitive.ObjectID  `json:"storeID" bson:"storeID,omitempty"` // when collected to the store's own VPA
+	Amount        float64              `json:"amount" bson:"amount"`
+	PaidAmount    float64              `json:"paidAmount" bson:"paidAmount,omitempty"`     // what the payer paid, when it was less than the amount
+	BankRefundID  string               `json:"bankRefundID" bson:"bankRefundID,omitempty"` // the bank's refund of a payment of less than the amount
+	Currency      string               `json:"currency" bson:"currency"`
+	IntentURL     string               `json:"intentURL" bson:"intentURL,omitempty"`
+	BankTxnID     string               `json:"bankTxnID" bson:"bankTxnID,omitempty"`
+	RRN           string               `json:"rrn" bson:"rrn,omitempty"` // the retrieval reference number the payer's bank statement shows
+	FailureReason string               `json:"failureReason" bson:"failureReason,omitempty"`
+	ExpiresAt     time.Time            `json:"expiresAt" bson:"expiresAt"`
+	CompletedAt   *time.Time           `json:"completedAt" bson:"completedAt,omitempty"`
+}
+
+var (
+	upiIndexesMu    sync.Mutex
+	upiIndexesReady bool
+)
+
+// ensureUPIIndexes makes sure a VPA collects for one store only, a store has one VPA and transaction references are unique.
+func ensureUPIIndexes() {
+	upiIndexesMu.Lock()
+	defer upiIndexesMu.Unlock()
+	if upiIndexesReady {
+		return
+	}
+	ctx := context.Background()
+	db := database.MongoDB
+	_, err := db.Collection(UPIVPACollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{"vpa", 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{"storeID", 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{"mid", 1}}, Options: options.Index().SetUnique(false)},
+	})
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	_, err = db.Collection(UPITransactionsCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{"txnRef", 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{"status", 1}, {"createdAt", 1}}, Options: options.Index().SetUnique(false)},
+		{Keys: bson.D{{"status", 1}, {"expiresAt", 1}}, Options: options.Index().SetUnique(false)},
+	})
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	upiIndexesReady = true
+}
+
+// SetStoreUPIMerchantAccount maps the VPA of the merchant with the MID to a store, replacing the one it had.
+// The payee name and category default to the merchant's.
+func SetStoreUPIMerchantAccount(storeID primitive.ObjectID, mid string, vpa string, name string) (*UPIMerchantAccount, error) {
+	vpa = upi.NormalizeVPA(vpa)
+	if !upi.ValidVPA(vpa) {
+		return nil, ErrInvalidVPA
+	}
+	merchant, err := (&Merchant{}).GetMerchantByMID(mid)
+	if err != nil {
+		return nil, err
+	}
+	if merchant == nil {
+		return nil, ErrMerchantNotFound
+	}
+	if name == "" {
+		name = merchant.Name
+	}
+	ensureUPIIndexes()
+	now := time.Now()
+	update := bson.D{
+		{"$set", bson.D{
+			{"mid", merchant.MID},
+			{"vpa", vpa},
+			{"name", name},
+			{"mcc", merchant.MCC},
+			{"isActive", true},
+			{"updatedAt", now},
+		}},
+		{"$setOnInsert", bson.D{{"createdAt", now}}},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	account := &UPIMerchantAccount{}
+	err = database.MongoDB.Collection(UPIVPACollection).FindOneAndUpdate(context.Background(), bson.D{{"storeID", storeID}}, update, opts).Decode(account)
+	if err != nil {
+		if isDuplicateKeyError(err) {
+			return nil, ErrVPAInUse
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	return account, nil
+}
+
+// GetStoreUPIMerchantAccount gives the VPA a store collects UPI payments to, nil when it has none.
+func GetStoreUPIMerchantAccount(storeID primitive.ObjectID) (*UPIMerchantAccount, error) {
+	account := &UPIMerchantAccount{}
+	err := database.MongoDB.Collection(UPIVPACollection).FindOne(context.Background(), bson.D{{"storeID", storeID}}).Decode(account)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	return account, nil
+}
+
+// NewUPITransactionRef gives a new UPI transaction reference, UPI references are alphanumeric and at most 35 long.
+func NewUPITransactionRef() string {
+	return "TRB" + primitive.NewObjectID().Hex()
+}
+
+// CreateUPITransaction records a UPI payment waiting for the payer, with a new transaction reference when it has none.
+func CreateUPITransaction(txn UPITransaction) (*UPITransaction, error) {
+	ensureUPIIndexes()
+	txn.ID = primitive.NewObjectID()
+	txn.CreatedAt = time.Now()
+	txn.UpdatedAt = txn.CreatedAt
+	if txn.TxnRef == "" {
+		txn.TxnRef = NewUPITransactionRef()
+	}
+	txn.Status = UPITransactionStatusPending
+	txn.Currency = upi.Currency
+	_, err := database.MongoDB.Collection(UPITransactionsCollection).InsertOne(context.Background(), &txn)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	return &txn, nil
+}
+
+// GetUPITransactionByRef gives the UPI transaction with our reference, nil when there is none.
+func GetUPITransactionByRef(txnRef string) (*UPITransaction, error) {
+	txn := &UPITransaction{}
+	err := database.MongoDB.Collection(UPITransactionsCollection).FindOne(context.Background(), bson.D{{"txnRef", txnRef}}).Decode(txn)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	return txn, nil
+}
+
+// SetUPITransactionBankTxnID keeps the bank's id of a pending UPI transaction.
+func SetUPITransactionBankTxnID(txn *UPITransaction, bankTxnID string) (*UPITransaction, error) {
+	update := bson.D{{"$set", bson.D{{"bankTxnID", bankTxnID}, {"updatedAt", time.Now()}}}}
+	updated := &UPITransaction{}
+	err := database.MongoDB.Collection(UPITransactionsCollection).FindOneAndUpdate(context.Background(), bson.D{{"_id", txn.ID}}, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(updated)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	return updated, nil
+}
+
+// CompleteUPITransaction records how a pending UPI transaction ended. It tells whether this call completed it,
+// so a transaction reported by both a callback and a status poll is recorded once. A transaction we expired
+// is completed again with the bank's success or failure, the payer may have paid after we stopped waiting.
+func CompleteUPITransaction(txn *UPITransaction, completed UPITransaction) (*UPITransaction, bool, error) {
+	now := time.Now()
+	set := bson.D{{"status", completed.Status}, {"completedAt", now}, {"updatedAt", now}}
+	if completed.BankTxnID != "" {
+		set = append(set, bson.E{"bankTxnID", completed.BankTxnID})
+	}
+	if completed.RRN != "" {
+		set = append(set, bson.E{"rrn", completed.RRN})
+	}
+	if completed.PayerVPA != "" {
+		set = append(set, bson.E{"payerVPA", upi.NormalizeVPA(completed.PayerVPA)})
+	}
+	if completed.FailureReason != "" {
+		set = append(set, bson.E{"failureReason", completed.FailureReason})
+	}
+	if completed.PaidAmount > 0 {
+		set = append(set, bson.E{"paidAmount", completed.PaidAmount})
+	}
+	collection := database.MongoDB.Collection(UPITransactionsCollection)
+	ctx := context.Background()
+	filter := bson.D{{"_id", txn.ID}, {"status", bson.M{"$in": completableUPIStatuses(completed.Status)}}}
+	updated := &UPITransaction{}
+	err := collection.FindOneAndUpdate(ctx, filter, bson.D{{"$set", set}}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(updated)
+	if err == nil {
+		return updated, true, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		log.Errorln(err)
+		return nil, false, err
+	}
+	err = collection.FindOne(ctx, bson.D{{"_id", txn.ID}}).Decode(updated)
+	if err != nil {
+		log.Errorln(err)
+		return nil, false, err
+	}
+	return updated, false, nil
+}
+
+// completableUPIStatuses gives the statuses of the transactions that can be completed with the status.
+func completableUPIStatuses(status UPITransactionStatus) bson.A {
+	if status == UPITransactionStatusSuccess || status == UPITransactionStatusFailed {
+		return bson.A{UPITransactionStatusPending, UPITransactionStatusExpired}
+	}
+	return bson.A{UPITransactionStatusPending}
+}
+
+// SetUPITransactionRefund keeps the bank's refund of a UPI payment of less than was asked for.
+func SetUPITransactionRefund(txn *UPITransaction, bankRefundID string) (*UPITransaction, error) {
+	update := bson.D{{"$set", bson.D{{"bankRefundID", bankRefundID}, {"updatedAt", time.Now()}}}}
+	updated := &UPITransaction{}
+	err := database.MongoDB.Collection(UPITransactionsCollection).FindOneAndUpdate(context.Background(), bson.D{{"_id", txn.ID}}, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(updated)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	return updated, nil
+}
+
+// GetPendingUPITransactions gives UPI transactions still waiting for the payer that were created before the time, oldest first.
+func GetPendingUPITransactions(createdBefore time.Time, limit int64) ([]*UPITransaction, error) {
+	filter := bson.D{{"status", UPITransactionStatusPending}, {"createdAt", bson.M{"$lt": createdBefore}}}
+	return findUPITransactions(filter, bson.D{{"createdAt", 1}}, limit)
+}
+
+// GetExpiredUPITransactions gives UPI transactions we expired since the time, newest first, whose payment the bank may still report.
+func GetExpiredUPITransactions(expiredSince time.Time, limit int64) ([]*UPITransaction, error) {
+	filter := bson.D{{"status", UPITransactionStatusExpired}, {"expiresAt", bson.M{"$gte": expiredSince}}}
+	return findUPITransactions(filter, bson.D{{"expiresAt", -1}}, limit)
+}
+
+// findUPITransactions gives the UPI transactions matching the filter in the order.
+func findUPITransactions(filter bson.D, sort bson.D, limit int64) ([]*UPITransaction, error) {
+	ctx := context.Background()
+	opts := options.Find().SetSort(sort).SetLimit(limit)
+	cur, err := database.MongoDB.Collection(UPITransactionsCollection).Find(ctx, filter, opts)
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	var txns []*UPITransaction
+	for cur.Next(ctx) {
+		txn := &UPITransaction{}
+		if err = cur.Decode(txn); err != nil {
+			log.Errorln(err)
+			return nil, err
+		}
+		txns = append(txns, txn)
+	}
+	return txns, cur.Err()
+}
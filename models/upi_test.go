@@ -0,0 +1,19 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+)
+
+func TestCompletableUPIStatuses(t *testing.T) {
+	//the bank's final status is taken for transactions we expired, our own expiry isn't
+	final := bson.A{UPITransactionStatusPending, UPITransactionStatusExpired}
+	require.Equal(t, final, completableUPIStatuses(UPITransactionStatusSuccess))
+	require.Equal(t, final, completableUPIStatuses(UPITransactionStatusFailed))
+	require.Equal(t, bson.A{UPITransactionStatusPending}, completableUPIStatuses(UPITransactionStatusExpired))
+}
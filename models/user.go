@@ -16,6 +16,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
 	"time"
 )
 
@@ -44,6 +45,7 @@ type User struct {
 	DateOfBirth      time.Time          `json:"dateOfBirth" bson:"dateOfBirth"`
 	ReferralCode     string             `json:"referralCode" bson:"referralCode"`
 	Language         string             `json:"language" bson:"language"`
+	Rating           RatingSummary      `json:"rating" bson:"rating"` //given by providers
 }
 
 //UnmarshalBinary required for the redis cache to work
@@ -288,6 +290,29 @@ func GetMergedUserPermissions(userId string) *[]string {
 	return &result
 }
 
+// UserHasScope tells whether the roles of a user grant a scope such as "Product:Update".
+func UserHasScope(userId string, scope string) bool {
+	return permissionsGrant(*GetMergedUserPermissions(userId), scope)
+}
+
+// permissionsGrant tells whether one of the permissions grants a scope, either part of a permission can be a "*" wildcard.
+func permissionsGrant(permissions []string, scope string) bool {
+	service, action := scope, ""
+	if i := strings.Index(scope, ":"); i >= 0 {
+		service, action = scope[:i], scope[i+1:]
+	}
+	for _, permission := range permissions {
+		permService, permAction := permission, ""
+		if i := strings.Index(permission, ":"); i >= 0 {
+			permService, permAction = permission[:i], permission[i+1:]
+		}
+		if (permService == "*" || permService == service) && (permAction == "*" || permAction == action) {
+			return true
+		}
+	}
+	return false
+}
+
 // UserRole represents a user role.
 type UserRole struct {
 	ID          primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
@@ -19,15 +19,25 @@ import (
 	"time"
 )
 
-//PaymentMethod represents a payment method.
+//PaymentMethod represents a payment method. Saved cards and wallets only keep the gateway's token for them, never the card number.
 type PaymentMethod struct {
-	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
-	DeletedAt *time.Time         `json:"-,omitempty" bson:"deletedAt,omitempty"`
-	UpdatedAt time.Time          `json:"updatedAt" bson:"updatedAt"`
-	Name      string             `json:"name" bson:"name"`
-	Type      PaymentMethodType  `json:"type" bson:"type"`
-	UserID    string             `json:"userId" bson:"userId"`
+	ID                     primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	CreatedAt              time.Time          `json:"createdAt" bson:"createdAt"`
+	DeletedAt              *time.Time         `json:"-,omitempty" bson:"deletedAt,omitempty"`
+	UpdatedAt              time.Time          `json:"updatedAt" bson:"updatedAt"`
+	Name                   string             `json:"name" bson:"name"`
+	Type                   PaymentMethodType  `json:"type" bson:"type"`
+	UserID                 string             `json:"userId" bson:"userId"`
+	Gateway                string             `json:"gateway" bson:"gateway"`
+	GatewayPaymentMethodID string             `json:"gatewayPaymentMethodID" bson:"gatewayPaymentMethodID"`
+	GatewayCustomerID      string             `json:"gatewayCustomerID" bson:"gatewayCustomerID"`
+	Brand                  string             `json:"brand" bson:"brand"`
+	Last4                  string             `json:"last4" bson:"last4"`
+	ExpMonth               int                `json:"expMonth" bson:"expMonth"`
+	ExpYear                int                `json:"expYear" bson:"expYear"`
+	Fingerprint            string             `json:"fingerprint" bson:"fingerprint,omitempty"` //gateway's fingerprint of the card number, the same for every token of a card
+	IsDefault              bool               `json:"isDefault" bson:"isDefault"`
+	ExpiryRemindedAt       *time.Time         `json:"expiryRemindedAt" bson:"expiryRemindedAt,omitempty"`
 }
 
 //CreatePaymentMethod creates payment method.
@@ -149,7 +159,7 @@ func DeleteUserPaymentMethodByID(ID string) (bool, error) {
 	oID, err := primitive.ObjectIDFromHex(ID)
 	filter := bson.D{{"_id", oID}}
 	userPaymentMethodsCollection := db.Collection(UserPaymentMethodsCollection)
-	res, err := userPaymentMethodsCollection.UpdateOne(context.Background(), filter, bson.D{{"$set", bson.D{{"deletedAt", time.Now()}}}})
+	res, err := userPaymentMethodsCollection.UpdateOne(context.Background(), filter, bson.D{{"$set", bson.D{{"deletedAt", time.Now()}, {"isDefault", false}}}})
 	if err != nil || res.ModifiedCount < 1 {
 		log.Errorln(err)
 		return false, err
@@ -21,13 +21,15 @@ import (
 
 // Wallet represents a wallet.
 type Wallet struct {
-	ID         primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	UserID     string             `json:"userId" bson:"userId"`
-	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt"`
-	DeletedAt  *time.Time         `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
-	UpdatedAt  time.Time          `json:"updatedAt" bson:"updatedAt"`
-	CreatedBy  primitive.ObjectID `json:"createdBy" bson:"createdBy"`
-	WalletType string             `json:"walletType" bson:"walletType"` //wallet type - user wallet , driver wallet
+	ID          primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID      string             `json:"userId" bson:"userId"`
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
+	DeletedAt   *time.Time         `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	UpdatedAt   time.Time          `json:"updatedAt" bson:"updatedAt"`
+	CreatedBy   primitive.ObjectID `json:"createdBy" bson:"createdBy"`
+	WalletType  string             `json:"walletType" bson:"walletType"`   //wallet type - user wallet , provider wallet , system wallet
+	Balance     float64            `json:"balance" bson:"balance"`         //changed only by wallet postings
+	HeldBalance float64            `json:"heldBalance" bson:"heldBalance"` //held for jobs in progress
 }
 
 // CreateWallet creates wallet.
@@ -35,8 +37,11 @@ func CreateWallet(wallet Wallet) (*Wallet, error) {
 	wallet.CreatedAt = time.Now()
 	wallet.UpdatedAt = time.Now()
 	wallet.ID = primitive.NewObjectID()
+	//balances start empty and only move through postings
+	wallet.Balance = 0
+	wallet.HeldBalance = 0
 	db := database.MongoDB
-	collection := db.Collection(ProviderWalletTransactionsCollection)
+	collection := db.Collection(WalletsCollection)
 	_, err := collection.InsertOne(context.Background(), &wallet)
 	if err != nil {
 		log.Errorln(err)
@@ -86,6 +91,22 @@ func GetWalletByID(ID string) (*Wallet, error) {
 	return wallet, nil
 }
 
+// GetWalletByFilter gives the wallet matching the filter.
+func GetWalletByFilter(filter bson.D) (*Wallet, error) {
+	db := database.MongoDB
+	wallet := &Wallet{}
+	filter = append(filter, bson.E{"deletedAt", bson.M{"$exists": false}}) // we dont want deleted documents
+	err := db.Collection(WalletsCollection).FindOne(context.Background(), filter).Decode(&wallet)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	return wallet, nil
+}
+
 // GetWallets gives a list of wallets.
 func GetWallets(filter bson.D, limit int, after *string, before *string, first *int, last *int) (wallets []*Wallet, totalCount int64, hasPrevious, hasNext bool, err error) {
 
@@ -121,16 +142,17 @@ ctx := context.Background()
 	return wallets, totalCount, pagingInfo.HasPreviousPage, pagingInfo.HasNextPage, nil
 }
 
-// UpdateWallet updates wallet.
+// UpdateWallet updates wallet, leaving its balances to the wallet postings.
 func UpdateWallet(c *Wallet) (*Wallet, error) {
 	wallet := c
 	wallet.UpdatedAt = time.Now()
 	filter := bson.D{{"_id", wallet.ID}}
 	db := database.MongoDB
 	walletsCollection := db.Collection(WalletsCollection)
-	findRepOpts := &options.FindOneAndReplaceOptions{}
-	findRepOpts.SetReturnDocument(options.After)
-	err := walletsCollection.FindOneAndReplace(context.Background(), filter, wallet, findRepOpts).Decode(&wallet)
+	findUpdateOpts := &options.FindOneAndUpdateOptions{}
+	findUpdateOpts.SetReturnDocument(options.After)
+	update := bson.D{{"$set", bson.D{{"userId", wallet.UserID}, {"walletType", wallet.WalletType}, {"updatedAt", wallet.UpdatedAt}}}}
+	err := walletsCollection.FindOneAndUpdate(context.Background(), filter, update, findUpdateOpts).Decode(&wallet)
 	if err != nil {
 		log.Error(err)
 	}
@@ -192,34 +214,12 @@ type WalletTransaction struct {
 	Description      string             `json:"description" bson:"description"`
 	Amount           float64            `json:"amount" bson:"amount"`
 	BalanceFor       BalanceFor         `json:"balanceFor" bson:"balanceFor"`
-	Type             TransactionType    `json:"type" bson:"type"` //credit / debit
-	RemainingBalance float64            `json:"remainingBalance" bson:"remainingBalance"`
+	Type             TransactionType    `json:"type" bson:"type"`                         //credit / debit
+	RemainingBalance float64            `json:"remainingBalance" bson:"remainingBalance"` //balance after the posting
+	PostingID        primitive.ObjectID `json:"postingId" bson:"postingId"`
 	Metadata         interface{}        `json:"metadata" bson:"metadata"`
 }
 
-// CreateWalletTransaction creates wallet transaction.
-func CreateWalletTransaction(walletTransaction WalletTransaction) (*WalletTransaction, error) {
-	walletTransaction.CreatedAt = time.Now()
-	walletTransaction.UpdatedAt = time.Now()
-	walletTransaction.ID = primitive.NewObjectID()
-	db := database.MongoDB
-	collection := db.Collection(WalletTransactionsCollection)
-	ctx := context.Background()
-	_, err := collection.InsertOne(ctx, &walletTransaction)
-	if err != nil {
-		log.Errorln(err)
-		return nil, err
-	}
-	go webhooks.NewWebhookEvent("wallet_transaction.created", &walletTransaction)
-	cacheClient := cache.RedisClient
-	//set cache item
-	err = cacheClient.Set(walletTransaction.ID.Hex(), walletTransaction, DefaultRedisCacheTime).Err()
-	if err != nil {
-		log.Error(err)
-	}
-	return &walletTransaction, nil
-}
-
 // GetWalletTransactionByID gives wallet transaction by id.
 func GetWalletTransactionByID(ID string) (*WalletTransaction, error) {
 	db := database.MongoDB
@@ -305,13 +305,15 @@ func (walletTransaction *WalletTransaction) MarshalBinary() ([]byte, error) {
 // ProviderWalletTransaction represents a provider wallet transaction.
 type ProviderWalletTransaction struct {
 	ID          primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	WalletID    string             `json:"walletId" bson:"walletId"`
 	Description string             `json:"description" bson:"description"`
 	Amount      float64            `json:"amount" bson:"amount"`
 	BalanceFor  BalanceFor         `json:"balanceFor" bson:"balanceFor"`
 	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
 	CreatedBy   primitive.ObjectID `json:"createdBy" bson:"createdBy"`
 	Type        TransactionType    `json:"type" bson:"type"`
-	Balance     float64            `json:"balance" bson:"balance"`
+	Balance     float64            `json:"balance" bson:"balance"` //balance after the posting
+	PostingID   primitive.ObjectID `json:"postingId" bson:"postingId"`
 }
 
 // GetProviderWalletTransactionByID gives a provider wallet transaction by id.
@@ -396,17 +398,30 @@ func (transaction *ProviderWalletTransaction) MarshalBinary() ([]byte, error) {
 	return json.Marshal(transaction)
 }
 
-// Withdrawal represents a withdrawal.
+// Withdrawal represents a request of a provider to cash out their wallet to a bank account.
 type Withdrawal struct {
-	ID                     primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	BookingDate            time.Time          `json:"bookingDate" bson:"bookingDate"`
-	FareAmount             float64            `json:"fareAmount" bson:"fareAmount"`
-	Commission             float64            `json:"commission" bson:"commission"`
-	BookingCharge          float64            `json:"bookingCharge" bson:"bookingCharge"`
-	Tip                    float64            `json:"tip" bson:"tip"`
-	PaymentAfterCommission float64            `json:"paymentAfterCommission" bson:"paymentAfterCommission"`
-	PaymentMethod          PaymentMethod      `json:"paymentMethod" bson:"paymentMethod"`
-	Invoice                Invoice            `json:"invoice" bson:"invoice"`
+	ID                primitive.ObjectID  `json:"id,omitempty" bson:"_id,omitempty"`
+	CreatedAt         time.Time           `json:"createdAt" bson:"createdAt"`
+	UpdatedAt         time.Time           `json:"updatedAt" bson:"updatedAt"`
+	CreatedBy         primitive.ObjectID  `json:"createdBy" bson:"createdBy"`
+	ProviderID        primitive.ObjectID  `json:"providerId" bson:"providerID"`
+	WalletID          primitive.ObjectID  `json:"walletId" bson:"walletID"`
+	BankAccountID     primitive.ObjectID  `json:"bankAccountId" bson:"bankAccountID"`
+	Amount            float64             `json:"amount" bson:"amount"`
+	Currency          string              `json:"currency" bson:"currency"`
+	Status            WithdrawalStatus    `json:"status" bson:"status"`
+	PayoutProvider    string              `json:"payoutProvider" bson:"payoutProvider"`
+	HoldID            *primitive.ObjectID `json:"holdId,omitempty" bson:"holdID,omitempty"`
+	PostingID         *primitive.ObjectID `json:"postingId,omitempty" bson:"postingID,omitempty"`
+	PayoutReference   string              `json:"payoutReference" bson:"payoutReference"`
+	RejectionReason   string              `json:"rejectionReason" bson:"rejectionReason"`
+	FailureReason     string              `json:"failureReason" bson:"failureReason"`
+	ReviewedBy        *primitive.ObjectID `json:"reviewedBy,omitempty" bson:"reviewedBy,omitempty"`
+	ReviewedAt        *time.Time          `json:"reviewedAt,omitempty" bson:"reviewedAt,omitempty"`
+	PaidAt            *time.Time          `json:"paidAt,omitempty" bson:"paidAt,omitempty"`
+	ReversalPostingID *primitive.ObjectID `json:"reversalPostingId,omitempty" bson:"reversalPostingID,omitempty"`
+	ReversedAt        *time.Time          `json:"reversedAt,omitempty" bson:"reversedAt,omitempty"`
+	Open              bool                `json:"-" bson:"open,omitempty"`
 }
 
 // GetWithdrawalByID gives withdrawal by id.
@@ -0,0 +1,968 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/cache"
+	"github.com/tribehq/platform/lib/database"
+	"github.com/tribehq/platform/utils/webhooks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"math"
+	"sync"
+	"time"
+)
+
+var (
+	ErrWalletNotFound              = errors.New("wallet not found")
+	ErrInsufficientWalletBalance   = errors.New("insufficient wallet balance")
+	ErrWalletPostingKeyRequired    = errors.New("wallet postings need an idempotency key")
+	ErrWalletPostingKeyReused      = errors.New("idempotency key was already used for a different wallet posting")
+	ErrInvalidWalletPosting        = errors.New("wallet postings need at least two non zero entries")
+	ErrUnbalancedWalletPosting     = errors.New("wallet posting entries must add up to zero")
+	ErrWalletPostingNotFound       = errors.New("wallet posting not found")
+	ErrWalletPostingReversed       = errors.New("wallet posting is already reversed")
+	ErrWalletReversalNotReversible = errors.New("reversal postings cannot be reversed")
+	ErrInvalidWalletHoldAmount     = errors.New("hold amount must be more than zero")
+	ErrWalletHoldNotFound          = errors.New("wallet hold not found")
+	ErrWalletHoldSettled           = errors.New("wallet hold is already captured or released")
+	ErrWalletHoldExceeded          = errors.New("captured amount is more than the held amount")
+	ErrJobFareUnknown              = errors.New("job has no fare or fare estimate to hold")
+)
+
+// Wallet types, user and provider wallets can't go below zero while system wallets can.
+const (
+	WalletTypeUser     = "user"
+	WalletTypeProvider = "provider"
+	WalletTypeSystem   = "system"
+)
+
+// System wallets the money of user and provider wallets comes from and goes to.
+const (
+	SystemWalletDeposits        = "deposits"
+	SystemWalletRefunds         = "refunds"
+	SystemWalletBookings        = "bookings"
+	SystemWalletPayouts         = "payouts"
+	SystemWalletCashLiabilities = "cash_liabilities"
+	SystemWalletOpeningBalances = "opening_balances"
+)
+
+var (
+	walletLedgerIndexesMu    sync.Mutex
+	walletLedgerIndexesReady bool
+)
+
+// WalletEntry is one side of a wallet posting, credits are positive and debits negative.
+type WalletEntry struct {
+	WalletID primitive.ObjectID `json:"walletId" bson:"walletID"`
+	Amount   float64            `json:"amount" bson:"amount"`
+	Balance  float64            `json:"balance" bson:"balance"` //balance of the wallet after the entry
+}
+
+// WalletPosting represents an immutable double-entry posting moving money between wallets.
+type WalletPosting struct {
+	ID             primitive.ObjectID  `json:"id,omitempty" bson:"_id,omitempty"`
+	CreatedAt      time.Time           `json:"createdAt" bson:"createdAt"`
+	CreatedBy      primitive.ObjectID  `json:"createdBy" bson:"createdBy"`
+	IdempotencyKey string              `json:"idempotencyKey" bson:"idempotencyKey"`
+	Description    string              `json:"description" bson:"description"`
+	BalanceFor     BalanceFor          `json:"balanceFor" bson:"balanceFor"`
+	Entries        []WalletEntry       `json:"entries" bson:"entries"`
+	HoldID         *primitive.ObjectID `json:"holdId,omitempty" bson:"holdID,omitempty"`
+	ReversalOf     *primitive.ObjectID `json:"reversalOf,omitempty" bson:"reversalOf,omitempty"`
+	ReversedBy     *primitive.ObjectID `json:"reversedBy,omitempty" bson:"reversedBy,omitempty"`
+	Metadata       interface{}         `json:"metadata" bson:"metadata"`
+}
+
+// WalletHold represents money held on a wallet for a job in progress.
+type WalletHold struct {
+	ID             primitive.ObjectID  `json:"id,omitempty" bson:"_id,omitempty"`
+	CreatedAt      time.Time           `json:"createdAt" bson:"createdAt"`
+	UpdatedAt      time.Time           `json:"updatedAt" bson:"updatedAt"`
+	CreatedBy      primitive.ObjectID  `json:"createdBy" bson:"createdBy"`
+	WalletID       primitive.ObjectID  `json:"walletId" bson:"walletID"`
+	JobID          *primitive.ObjectID `json:"jobId,omitempty" bson:"jobID,omitempty"`
+	IdempotencyKey string              `json:"idempotencyKey" bson:"idempotencyKey"`
+	Description    string              `json:"description" bson:"description"`
+	Amount         float64             `json:"amount" bson:"amount"`
+	CapturedAmount float64             `json:"capturedAmount" bson:"capturedAmount"`
+	Status         WalletHoldStatus    `json:"status" bson:"status"`
+	PostingID      *primitive.ObjectID `json:"postingId,omitempty" bson:"postingID,omitempty"`
+	SettledAt      *time.Time          `json:"settledAt,omitempty" bson:"settledAt,omitempty"`
+}
+
+// WalletDiscrepancy is a wallet or posting the reconciliation found out of line with the postings.
+type WalletDiscrepancy struct {
+	WalletID      primitive.ObjectID  `json:"walletId"`
+	PostingID     *primitive.ObjectID `json:"postingId,omitempty"`
+	Balance       float64             `json:"balance"`
+	PostedBalance float64             `json:"postedBalance"`
+	HeldBalance   float64             `json:"heldBalance"`
+	ActiveHolds   float64             `json:"activeHolds"`
+	Reason        string              `json:"reason"`
+}
+
+// AvailableBalance gives the balance of a wallet which isn't held for jobs in progress.
+func (wallet *Wallet) AvailableBalance() float64 {
+	return roundAmount(wallet.Balance - wallet.HeldBalance)
+}
+
+// ensureWalletLedgerIndexes creates the unique indexes the ledger relies on for idempotency.
+// Collections can't be created inside a transaction so this also makes sure they exist.
+func ensureWalletLedgerIndexes() {
+	walletLedgerIndexesMu.Lock()
+	defer walletLedgerIndexesMu.Unlock()
+	if walletLedgerIndexesReady {
+		return
+	}
+	ctx := context.Background()
+	db := database.MongoDB
+	_, err := db.Collection(WalletsCollection).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{"userId", 1}, {"walletType", 1}}, Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	_, err = db.Collection(WalletPostingsCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{"idempotencyKey", 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{"entries.walletID", 1}}},
+	})
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	_, err = db.Collection(WalletHoldsCollection).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{"idempotencyKey", 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{"jobID", 1}, {"status", 1}}},
+	})
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	for _, collection := range []string{WalletTransactionsCollection, ProviderWalletTransactionsCollection} {
+		_, err = db.Collection(collection).Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{"postingId", 1}}})
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+	}
+	walletLedgerIndexesReady = true
+}
+
+// isDuplicateKeyError tells whether a write failed on a unique index.
+func isDuplicateKeyError(err error) bool {
+	switch e := err.(type) {
+	case mongo.WriteException:
+		for _, writeErr := range e.WriteErrors {
+			if writeErr.Code == 11000 {
+				return true
+			}
+		}
+	case mongo.CommandError:
+		return e.Code == 11000
+	}
+	return false
+}
+
+// runWalletTransaction runs fn in a MongoDB transaction, retrying it on transient errors.
+func runWalletTransaction(fn func(sc mongo.SessionContext) error) error {
+	ensureWalletLedgerIndexes()
+	ctx := context.Background()
+	session, err := database.MongoDBClient.StartSession()
+	if err != nil {
+		log.Errorln(err)
+		return err
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	return err
+}
+
+// GetOrCreateWallet gives the wallet of a user, provider or system account, creating it on first use.
+func GetOrCreateWallet(ownerID string, walletType string) (*Wallet, error) {
+	ensureWalletLedgerIndexes()
+	wallet, err := GetWalletByFilter(bson.D{{"userId", ownerID}, {"walletType", walletType}})
+	if err != nil || wallet != nil {
+		return wallet, err
+	}
+	wallet, err = CreateWallet(Wallet{UserID: ownerID, WalletType: walletType})
+	if err != nil && isDuplicateKeyError(err) {
+		//created by a concurrent request
+		return GetWalletByFilter(bson.D{{"userId", ownerID}, {"walletType", walletType}})
+	}
+	return wallet, err
+}
+
+// systemWalletFor gives the system wallet money for a balance comes from.
+func systemWalletFor(balanceFor BalanceFor) (*Wallet, error) {
+	switch balanceFor {
+	case BalanceForRefund:
+		return GetOrCreateWallet(SystemWalletRefunds, WalletTypeSystem)
+	case BalanceForBooking:
+		return GetOrCreateWallet(SystemWalletBookings, WalletTypeSystem)
+	case BalanceForWithdrawal:
+		return GetOrCreateWallet(SystemWalletPayouts, WalletTypeSystem)
+	}
+	return GetOrCreateWallet(SystemWalletDeposits, WalletTypeSystem)
+}
+
+// validateWalletPosting rounds the entries of a posting to cents and checks that they balance.
+func validateWalletPosting(posting *WalletPosting) error {
+	if posting.IdempotencyKey == "" {
+		return ErrWalletPostingKeyRequired
+	}
+	if len(posting.Entries) < 2 {
+		return ErrInvalidWalletPosting
+	}
+	var total float64
+	for i := range posting.Entries {
+		posting.Entries[i].Amount = roundAmount(posting.Entries[i].Amount)
+		if posting.Entries[i].Amount == 0 || posting.Entries[i].WalletID.IsZero() {
+			return ErrInvalidWalletPosting
+		}
+		total += posting.Entries[i].Amount
+	}
+	if math.Abs(roundAmount(total)) > 0 {
+		return ErrUnbalancedWalletPosting
+	}
+	return nil
+}
+
+// sameWalletEntries tells whether two postings move the same amounts between the same wallets.
+func sameWalletEntries(a []WalletEntry, b []WalletEntry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].WalletID != b[i].WalletID || roundAmount(a[i].Amount) != roundAmount(b[i].Amount) {
+			return false
+		}
+	}
+	return true
+}
+
+// replayWalletPosting gives the posting already made with the idempotency key of a posting, nil when there is none.
+func replayWalletPosting(posting *WalletPosting) (*WalletPosting, error) {
+	existing := &WalletPosting{}
+	filter := bson.D{{"idempotencyKey", posting.IdempotencyKey}}
+	err := database.MongoDB.Collection(WalletPostingsCollection).FindOne(context.Background(), filter).Decode(existing)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	if !sameWalletEntries(existing.Entries, posting.Entries) {
+		return nil, ErrWalletPostingKeyReused
+	}
+	return existing, nil
+}
+
+// moveWalletBalance changes the balance of a wallet within a transaction.
+// Debits of user and provider wallets fail when they are more than the available balance.
+func moveWalletBalance(sc mongo.SessionContext, walletID primitive.ObjectID, amount float64, now time.Time) (*Wallet, error) {
+	filter := bson.D{{"_id", walletID}}
+	if amount < 0 {
+		filter = append(filter, bson.E{"$or", bson.A{
+			bson.D{{"walletType", WalletTypeSystem}},
+			bson.D{{"$expr", bson.D{{"$gte", bson.A{bson.D{{"$subtract", bson.A{"$balance", "$heldBalance"}}}, -amount}}}}},
+		}})
+	}
+	update := bson.D{{"$inc", bson.D{{"balance", amount}}}, {"$set", bson.D{{"updatedAt", now}}}}
+	findUpdateOpts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	wallet := &Wallet{}
+	err := database.MongoDB.Collection(WalletsCollection).FindOneAndUpdate(sc, filter, update, findUpdateOpts).Decode(wallet)
+	if err == mongo.ErrNoDocuments {
+		count, countErr := database.MongoDB.Collection(WalletsCollection).CountDocuments(sc, bson.D{{"_id", walletID}})
+		if countErr != nil {
+			return nil, countErr
+		}
+		if count == 0 {
+			return nil, ErrWalletNotFound
+		}
+		return nil, ErrInsufficientWalletBalance
+	}
+	if err != nil {
+		return nil, err
+	}
+	return wallet, nil
+}
+
+// writeWalletStatement writes the statement line the wallet transaction queries show for an entry.
+func writeWalletStatement(sc mongo.SessionContext, wallet *Wallet, posting *WalletPosting, entry WalletEntry) error {
+	transactionType := TransactionTypeCredit
+	if entry.Amount < 0 {
+		transactionType = TransactionTypeDebit
+	}
+	var err error
+	switch wallet.WalletType {
+	case WalletTypeUser:
+		_, err = database.MongoDB.Collection(WalletTransactionsCollection).InsertOne(sc, WalletTransaction{
+			ID:               primitive.NewObjectID(),
+			WalletID:         wallet.ID.Hex(),
+			CreatedAt:        posting.CreatedAt,
+			UpdatedAt:        posting.CreatedAt,
+			CreatedBy:        posting.CreatedBy,
+			Description:      posting.Description,
+			Amount:           math.Abs(entry.Amount),
+			BalanceFor:       posting.BalanceFor,
+			Type:             transactionType,
+			RemainingBalance: roundAmount(entry.Balance),
+			PostingID:        posting.ID,
+			Metadata:         posting.Metadata,
+		})
+	case WalletTypeProvider:
+		_, err = database.MongoDB.Collection(ProviderWalletTransactionsCollection).InsertOne(sc, ProviderWalletTransaction{
+			ID:          primitive.NewObjectID(),
+			WalletID:    wallet.ID.Hex(),
+			Description: posting.Description,
+			Amount:      math.Abs(entry.Amount),
+			BalanceFor:  posting.BalanceFor,
+			CreatedAt:   posting.CreatedAt,
+			CreatedBy:   posting.CreatedBy,
+			Type:        transactionType,
+			Balance:     roundAmount(entry.Balance),
+			PostingID:   posting.ID,
+		})
+	}
+	return err
+}
+
+// applyWalletPosting moves the balances of a posting and records it within a transaction.
+func applyWalletPosting(sc mongo.SessionContext, posting *WalletPosting) error {
+	for i, entry := range posting.Entries {
+		wallet, err := moveWalletBalance(sc, entry.WalletID, entry.Amount, posting.CreatedAt)
+		if err != nil {
+			return err
+		}
+		posting.Entries[i].Balance = roundAmount(wallet.Balance)
+		err = writeWalletStatement(sc, wallet, posting, posting.Entries[i])
+		if err != nil {
+			return err
+		}
+	}
+	_, err := database.MongoDB.Collection(WalletPostingsCollection).InsertOne(sc, posting)
+	return err
+}
+
+// postedWalletPosting clears the cached wallets of a committed posting and tells the webhooks about it.
+func postedWalletPosting(posting *WalletPosting) {
+	for _, entry := range posting.Entries {
+		err := cache.RedisClient.Del(entry.WalletID.Hex()).Err()
+		if err != nil {
+			log.Error(err)
+		}
+	}
+	go webhooks.NewWebhookEvent("wallet_posting.created", posting)
+}
+
+// PostWalletEntries records a balanced posting and moves the wallet balances in one transaction.
+// Posting again with the same idempotency key gives back the first posting without moving any money.
+func PostWalletEntries(posting WalletPosting) (*WalletPosting, error) {
+	err := validateWalletPosting(&posting)
+	if err != nil {
+		return nil, err
+	}
+	ensureWalletLedgerIndexes()
+	existing, err := replayWalletPosting(&posting)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+	posting.ID = primitive.NewObjectID()
+	posting.CreatedAt = time.Now()
+	posting.ReversedBy = nil
+	err = runWalletTransaction(func(sc mongo.SessionContext) error {
+		return applyWalletPosting(sc, &posting)
+	})
+	if err != nil {
+		if isDuplicateKeyError(err) {
+			//posted by a concurrent request with the same key
+			return replayWalletPosting(&posting)
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	postedWalletPosting(&posting)
+	return &posting, nil
+}
+
+// CreditUserWallet credits amount to the wallet of a user from the system wallet of the balance, creating the wallet on first use.
+func CreditUserWallet(userID string, amount float64, balanceFor BalanceFor, description string, idempotencyKey string, metadata interface{}) (*WalletPosting, error) {
+	wallet, err := GetOrCreateWallet(userID, WalletTypeUser)
+	if err != nil {
+		return nil, err
+	}
+	source, err := systemWalletFor(balanceFor)
+	if err != nil {
+		return nil, err
+	}
+	return PostWalletEntries(WalletPosting{
+		IdempotencyKey: idempotencyKey,
+		Description:    description,
+		BalanceFor:     balanceFor,
+		Entries: []WalletEntry{
+			{WalletID: source.ID, Amount: -amount},
+			{WalletID: wallet.ID, Amount: amount},
+		},
+		Metadata: metadata,
+	})
+}
+
+// ReverseWalletPosting posts the opposite entries of a posting, a posting is reversed only once.
+func ReverseWalletPosting(posting *WalletPosting, description string, createdBy primitive.ObjectID) (*WalletPosting, error) {
+	if posting.ReversalOf != nil {
+		return nil, ErrWalletReversalNotReversible
+	}
+	reversal := WalletPosting{
+		CreatedBy:      createdBy,
+		IdempotencyKey: "reversal:" + posting.ID.Hex(),
+		Description:    description,
+		BalanceFor:     posting.BalanceFor,
+		ReversalOf:     &posting.ID,
+	}
+	for _, entry := range posting.Entries {
+		reversal.Entries = append(reversal.Entries, WalletEntry{WalletID: entry.WalletID, Amount: -entry.Amount})
+	}
+	err := validateWalletPosting(&reversal)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := replayWalletPosting(&reversal)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+	reversal.ID = primitive.NewObjectID()
+	reversal.CreatedAt = time.Now()
+	err = runWalletTransaction(func(sc mongo.SessionContext) error {
+		filter := bson.D{{"_id", posting.ID}, {"reversedBy", bson.M{"$exists": false}}}
+		res, err := database.MongoDB.Collection(WalletPostingsCollection).UpdateOne(sc, filter, bson.D{{"$set", bson.D{{"reversedBy", reversal.ID}}}})
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount < 1 {
+			return ErrWalletPostingReversed
+		}
+		return applyWalletPosting(sc, &reversal)
+	})
+	if err != nil {
+		if isDuplicateKeyError(err) {
+			return replayWalletPosting(&reversal)
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	posting.ReversedBy = &reversal.ID
+	postedWalletPosting(&reversal)
+	return &reversal, nil
+}
+
+// legacyWalletBalances gives the balance of each wallet from its statement lines written before the ledger,
+// the remaining balance of the latest line of the wallet.
+func legacyWalletBalances(transactions []*WalletTransaction) map[string]float64 {
+	latest := map[string]*WalletTransaction{}
+	for _, transaction := range transactions {
+		current, ok := latest[transaction.WalletID]
+		if !ok || transaction.CreatedAt.After(current.CreatedAt) ||
+			(transaction.CreatedAt.Equal(current.CreatedAt) && transaction.ID.Hex() > current.ID.Hex()) {
+			latest[transaction.WalletID] = transaction
+		}
+	}
+	balances := map[string]float64{}
+	for walletID, transaction := range latest {
+		balances[walletID] = roundAmount(transaction.RemainingBalance)
+	}
+	return balances
+}
+
+// openingWalletPosting gives the posting bringing the balance a wallet had before the ledger into it.
+func openingWalletPosting(walletID primitive.ObjectID, source primitive.ObjectID, balance float64) WalletPosting {
+	return WalletPosting{
+		IdempotencyKey: "opening-balance:" + walletID.Hex(),
+		Description:    "Opening balance",
+		BalanceFor:     BalanceForDeposit,
+		Entries: []WalletEntry{
+			{WalletID: source, Amount: -balance},
+			{WalletID: walletID, Amount: balance},
+		},
+	}
+}
+
+// PostOpeningWalletBalances posts the balances wallets had before the ledger, taken from their older statement lines,
+// against the opening balances system wallet. It can be run again safely, each wallet gets a single opening posting.
+func PostOpeningWalletBalances() (int, error) {
+	ctx := context.Background()
+	filter := bson.D{{"postingId", bson.M{"$exists": false}}, {"deletedAt", bson.M{"$exists": false}}}
+	findOptions := options.Find().SetProjection(bson.D{{"walletId", 1}, {"createdAt", 1}, {"remainingBalance", 1}})
+	cur, err := database.MongoDB.Collection(WalletTransactionsCollection).Find(ctx, filter, findOptions)
+	if err != nil {
+		log.Errorln(err)
+		return 0, err
+	}
+	defer cur.Close(ctx)
+	var transactions []*WalletTransaction
+	for cur.Next(ctx) {
+		transaction := &WalletTransaction{}
+		err = cur.Decode(transaction)
+		if err != nil {
+			log.Errorln(err)
+			return 0, err
+		}
+		transactions = append(transactions, transaction)
+	}
+	if err = cur.Err(); err != nil {
+		return 0, err
+	}
+
+	source, err := GetOrCreateWallet(SystemWalletOpeningBalances, WalletTypeSystem)
+	if err != nil {
+		return 0, err
+	}
+	posted := 0
+	for hexID, balance := range legacyWalletBalances(transactions) {
+		walletID, err := primitive.ObjectIDFromHex(hexID)
+		if err != nil || balance == 0 {
+			continue
+		}
+		_, err = PostWalletEntries(openingWalletPosting(walletID, source.ID, balance))
+		if err != nil {
+			log.Errorf("opening balance of wallet %s: %v", hexID, err)
+			continue
+		}
+		posted++
+	}
+	return posted, nil
+}
+
+// GetWalletPostingByID gives a wallet posting by id.
+func GetWalletPostingByID(ID string) (*WalletPosting, error) {
+	id, err := primitive.ObjectIDFromHex(ID)
+	if err != nil {
+		return nil, err
+	}
+	posting := &WalletPosting{}
+	err = database.MongoDB.Collection(WalletPostingsCollection).FindOne(context.Background(), bson.D{{"_id", id}}).Decode(posting)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	return posting, nil
+}
+
+// GetWalletPostings gives a list of wallet postings.
+func GetWalletPostings(filter bson.D, limit int, after *string, before *string, first *int, last *int) (postings []*WalletPosting, totalCount int64, hasPrevious, hasNext bool, err error) {
+	db := database.MongoDB
+	tcint, filter, err := calcTotalCountWithQueryFilters(WalletPostingsCollection, filter, after, before)
+	if err != nil {
+		return
+	}
+	totalCount = int64(tcint)
+	pagingInfo, err := PaginationUtility(after, before, first, last, &tcint)
+	if err != nil {
+		return
+	}
+	pagingInfo.QueryOpts.SetSort(bson.M{"_id": 1})
+
+	ctx := context.Background()
+	cur, err := db.Collection(WalletPostingsCollection).Find(ctx, filter, &pagingInfo.QueryOpts)
+	if err != nil {
+		return
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		posting := &WalletPosting{}
+		err = cur.Decode(posting)
+		if err != nil {
+			log.Errorln(err)
+			return
+		}
+		postings = append(postings, posting)
+	}
+	if err = cur.Err(); err != nil {
+		return
+	}
+	return postings, totalCount, pagingInfo.HasPreviousPage, pagingInfo.HasNextPage, nil
+}
+
+// PlaceWalletHold holds an amount of the available balance of a wallet, placing it again with the same idempotency key gives back the first hold.
+func PlaceWalletHold(hold WalletHold) (*WalletHold, error) {
+	hold.Amount = roundAmount(hold.Amount)
+	if hold.Amount <= 0 {
+		return nil, ErrInvalidWalletHoldAmount
+	}
+	if hold.IdempotencyKey == "" {
+		return nil, ErrWalletPostingKeyRequired
+	}
+	ensureWalletLedgerIndexes()
+	existing, err := GetWalletHoldByFilter(bson.D{{"idempotencyKey", hold.IdempotencyKey}})
+	if err != nil || existing != nil {
+		return existing, err
+	}
+	now := time.Now()
+	hold.ID = primitive.NewObjectID()
+	hold.CreatedAt = now
+	hold.UpdatedAt = now
+	hold.Status = WalletHoldStatusHeld
+	hold.CapturedAmount = 0
+	err = runWalletTransaction(func(sc mongo.SessionContext) error {
+		filter := bson.D{
+			{"_id", hold.WalletID},
+			{"$expr", bson.D{{"$gte", bson.A{bson.D{{"$subtract", bson.A{"$balance", "$heldBalance"}}}, hold.Amount}}}},
+		}
+		update := bson.D{{"$inc", bson.D{{"heldBalance", hold.Amount}}}, {"$set", bson.D{{"updatedAt", now}}}}
+		res, err := database.MongoDB.Collection(WalletsCollection).UpdateOne(sc, filter, update)
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount < 1 {
+			return ErrInsufficientWalletBalance
+		}
+		_, err = database.MongoDB.Collection(WalletHoldsCollection).InsertOne(sc, hold)
+		return err
+	})
+	if err != nil {
+		if isDuplicateKeyError(err) {
+			return GetWalletHoldByFilter(bson.D{{"idempotencyKey", hold.IdempotencyKey}})
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	err = cache.RedisClient.Del(hold.WalletID.Hex()).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	go webhooks.NewWebhookEvent("wallet_hold.created", &hold)
+	return &hold, nil
+}
+
+// settleWalletHold marks a held hold captured or released and gives its amount back to the available balance of the wallet.
+func settleWalletHold(sc mongo.SessionContext, hold *WalletHold, status WalletHoldStatus, capturedAmount float64, postingID *primitive.ObjectID, now time.Time) error {
+	filter := bson.D{{"_id", hold.ID}, {"status", WalletHoldStatusHeld}}
+	set := bson.D{{"status", status}, {"capturedAmount", capturedAmount}, {"settledAt", now}, {"updatedAt", now}}
+	if postingID != nil {
+		set = append(set, bson.E{"postingID", *postingID})
+	}
+	res, err := database.MongoDB.Collection(WalletHoldsCollection).UpdateOne(sc, filter, bson.D{{"$set", set}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount < 1 {
+		return ErrWalletHoldSettled
+	}
+	update := bson.D{{"$inc", bson.D{{"heldBalance", -hold.Amount}}}, {"$set", bson.D{{"updatedAt", now}}}}
+	_, err = database.MongoDB.Collection(WalletsCollection).UpdateOne(sc, bson.D{{"_id", hold.WalletID}}, update)
+	if err != nil {
+		return err
+	}
+	hold.Status = status
+	hold.CapturedAmount = capturedAmount
+	hold.PostingID = postingID
+	hold.SettledAt = &now
+	hold.UpdatedAt = now
+	return nil
+}
+
+// CaptureWalletHold takes the credited amounts out of a hold, giving the rest of the hold back to the wallet.
+func CaptureWalletHold(hold *WalletHold, credits []WalletEntry, description string, balanceFor BalanceFor) (*WalletPosting, error) {
+	posting := WalletPosting{
+		CreatedBy:      hold.CreatedBy,
+		IdempotencyKey: "hold:" + hold.ID.Hex() + ":capture",
+		Description:    description,
+		BalanceFor:     balanceFor,
+		HoldID:         &hold.ID,
+	}
+	var captured float64
+	for _, credit := range credits {
+		captured += credit.Amount
+	}
+	captured = roundAmount(captured)
+	if captured > hold.Amount {
+		return nil, ErrWalletHoldExceeded
+	}
+	posting.Entries = append([]WalletEntry{{WalletID: hold.WalletID, Amount: -captured}}, credits...)
+	err := validateWalletPosting(&posting)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := replayWalletPosting(&posting)
+	if err != nil || existing != nil {
+		return existing, err
+	}
+	now := time.Now()
+	posting.ID = primitive.NewObjectID()
+	posting.CreatedAt = now
+	err = runWalletTransaction(func(sc mongo.SessionContext) error {
+		err := settleWalletHold(sc, hold, WalletHoldStatusCaptured, captured, &posting.ID, now)
+		if err != nil {
+			return err
+		}
+		return applyWalletPosting(sc, &posting)
+	})
+	if err != nil {
+		if isDuplicateKeyError(err) {
+			return replayWalletPosting(&posting)
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	postedWalletPosting(&posting)
+	go webhooks.NewWebhookEvent("wallet_hold.captured", hold)
+	return &posting, nil
+}
+
+// ReleaseWalletHold gives the whole of a hold back to the available balance of its wallet.
+func ReleaseWalletHold(hold *WalletHold) (*WalletHold, error) {
+	err := runWalletTransaction(func(sc mongo.SessionContext) error {
+		return settleWalletHold(sc, hold, WalletHoldStatusReleased, 0, nil, time.Now())
+	})
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	err = cache.RedisClient.Del(hold.WalletID.Hex()).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	go webhooks.NewWebhookEvent("wallet_hold.released", hold)
+	return hold, nil
+}
+
+// GetWalletHoldByFilter gives the wallet hold matching the filter.
+func GetWalletHoldByFilter(filter bson.D) (*WalletHold, error) {
+	hold := &WalletHold{}
+	err := database.MongoDB.Collection(WalletHoldsCollection).FindOne(context.Background(), filter).Decode(hold)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	return hold, nil
+}
+
+// WalletOwnedBy tells whether a user owns a wallet, directly or as the provider the wallet belongs to.
+func WalletOwnedBy(wallet *Wallet, userID primitive.ObjectID) bool {
+	switch wallet.WalletType {
+	case WalletTypeUser:
+		return wallet.UserID == userID.Hex()
+	case WalletTypeProvider:
+		provider := GetServiceProviderByID(wallet.UserID)
+		return !provider.ID.IsZero() && provider.User == userID
+	}
+	return false
+}
+
+// jobHoldAmount gives what is held for the fare of a job, its fare once known and its estimate until then.
+func jobHoldAmount(job *Job) (float64, error) {
+	amount := job.FareAmount
+	if amount <= 0 {
+		amount = job.EstimatedFareAmount
+	}
+	if amount <= 0 {
+		return 0, ErrJobFareUnknown
+	}
+	return roundAmount(amount), nil
+}
+
+// HoldJobFare holds the fare of a job on the wallet of its customer until the job is completed or its hold released.
+func HoldJobFare(job *Job) (*WalletHold, error) {
+	amount, err := jobHoldAmount(job)
+	if err != nil {
+		return nil, err
+	}
+	wallet, err := GetOrCreateWallet(job.UserID, WalletTypeUser)
+	if err != nil {
+		return nil, err
+	}
+	return PlaceWalletHold(WalletHold{
+		CreatedBy:      job.CreatedBy,
+		WalletID:       wallet.ID,
+		JobID:          &job.ID,
+		IdempotencyKey: "job:" + job.ID.Hex() + ":hold",
+		Description:    fmt.Sprintf("Fare of booking %s", job.BookingNumber),
+		Amount:         amount,
+	})
+}
+
+// ReleaseJobFare gives the held fare of a job back to its customer.
+func ReleaseJobFare(job *Job) (*WalletHold, error) {
+	hold, err := GetWalletHoldByFilter(bson.D{{"jobID", job.ID}, {"status", WalletHoldStatusHeld}})
+	if err != nil {
+		return nil, err
+	}
+	if hold == nil {
+		return nil, ErrWalletHoldNotFound
+	}
+	return ReleaseWalletHold(hold)
+}
+
+// captureJobFare pays the provider of a completed job out of the fare held on the wallet of its customer.
+// The fare of the job is captured, capped at the held amount, and the rest of the hold is released.
+func captureJobFare(job *Job) (*WalletPosting, error) {
+	hold, err := GetWalletHoldByFilter(bson.D{{"jobID", job.ID}, {"status", WalletHoldStatusHeld}})
+	if err != nil || hold == nil {
+		return nil, err
+	}
+	amount := roundAmount(job.FareAmount)
+	if amount <= 0 || amount > hold.Amount {
+		amount = hold.Amount
+	}
+	if job.ProviderID == "" {
+		_, err = ReleaseWalletHold(hold)
+		return nil, err
+	}
+	wallet, err := GetOrCreateWallet(job.ProviderID, WalletTypeProvider)
+	if err != nil {
+		return nil, err
+	}
+	credits := []WalletEntry{{WalletID: wallet.ID, Amount: amount}}
+	return CaptureWalletHold(hold, credits, fmt.Sprintf("Fare of booking %s", job.BookingNumber), BalanceForBooking)
+}
+
+// walletDiscrepancy compares a wallet with the sum of its postings and active holds, nil when they agree.
+func walletDiscrepancy(wallet *Wallet, posted float64, held float64) *WalletDiscrepancy {
+	discrepancy := &WalletDiscrepancy{
+		WalletID:      wallet.ID,
+		Balance:       roundAmount(wallet.Balance),
+		PostedBalance: roundAmount(posted),
+		HeldBalance:   roundAmount(wallet.HeldBalance),
+		ActiveHolds:   roundAmount(held),
+	}
+	switch {
+	case discrepancy.Balance != discrepancy.PostedBalance:
+		discrepancy.Reason = "balance doesn't match the postings"
+	case discrepancy.HeldBalance != discrepancy.ActiveHolds:
+		discrepancy.Reason = "held balance doesn't match the active holds"
+	case wallet.WalletType != WalletTypeSystem && discrepancy.Balance < discrepancy.HeldBalance:
+		discrepancy.Reason = "held balance is more than the balance"
+	default:
+		return nil
+	}
+	return discrepancy
+}
+
+// sumByWallet runs an aggregation grouping amounts by wallet.
+func sumByWallet(collection string, pipeline bson.A) (map[primitive.ObjectID]float64, error) {
+	ctx := context.Background()
+	cur, err := database.MongoDB.Collection(collection).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	sums := map[primitive.ObjectID]float64{}
+	for cur.Next(ctx) {
+		var sum struct {
+			WalletID primitive.ObjectID `bson:"_id"`
+			Total    float64            `bson:"total"`
+		}
+		err = cur.Decode(&sum)
+		if err != nil {
+			return nil, err
+		}
+		sums[sum.WalletID] = sum.Total
+	}
+	return sums, cur.Err()
+}
+
+// ReconcileWallets checks every wallet balance against its postings and active holds,
+// and every posting for entries that don't add up to zero.
+func ReconcileWallets() ([]WalletDiscrepancy, error) {
+	ctx := context.Background()
+	db := database.MongoDB
+	var discrepancies []WalletDiscrepancy
+
+	posted, err := sumByWallet(WalletPostingsCollection, bson.A{
+		bson.M{"$unwind": "$entries"},
+		bson.M{"$group": bson.M{"_id": "$entries.walletID", "total": bson.M{"$sum": "$entries.amount"}}},
+	})
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	held, err := sumByWallet(WalletHoldsCollection, bson.A{
+		bson.M{"$match": bson.M{"status": WalletHoldStatusHeld}},
+		bson.M{"$group": bson.M{"_id": "$walletID", "total": bson.M{"$sum": "$amount"}}},
+	})
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+
+	cur, err := db.Collection(WalletsCollection).Find(ctx, bson.D{})
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	defer cur.Close(ctx)
+	for cur.Next(ctx) {
+		wallet := &Wallet{}
+		err = cur.Decode(wallet)
+		if err != nil {
+			log.Errorln(err)
+			return nil, err
+		}
+		if discrepancy := walletDiscrepancy(wallet, posted[wallet.ID], held[wallet.ID]); discrepancy != nil {
+			discrepancies = append(discrepancies, *discrepancy)
+		}
+		delete(posted, wallet.ID)
+	}
+	if err = cur.Err(); err != nil {
+		return nil, err
+	}
+	for walletID, total := range posted {
+		discrepancies = append(discrepancies, WalletDiscrepancy{WalletID: walletID, PostedBalance: roundAmount(total), Reason: "postings to a missing wallet"})
+	}
+
+	postings, err := db.Collection(WalletPostingsCollection).Aggregate(ctx, bson.A{
+		bson.M{"$project": bson.M{"total": bson.M{"$sum": "$entries.amount"}}},
+	})
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	defer postings.Close(ctx)
+	for postings.Next(ctx) {
+		var posting struct {
+			ID    primitive.ObjectID `bson:"_id"`
+			Total float64            `bson:"total"`
+		}
+		err = postings.Decode(&posting)
+		if err != nil {
+			return nil, err
+		}
+		if roundAmount(posting.Total) != 0 {
+			postingID := posting.ID
+			discrepancies = append(discrepancies, WalletDiscrepancy{PostingID: &postingID, PostedBalance: roundAmount(posting.Total), Reason: "posting entries don't add up to zero"})
+		}
+	}
+	return discrepancies, postings.Err()
+}
+
+//UnmarshalBinary required for the redis cache to work
+func (posting *WalletPosting) UnmarshalBinary(data []byte) error {
+	if err := json.Unmarshal(data, posting); err != nil {
+		return err
+	}
+	return nil
+}
+
+//MarshalBinary required for the redis cache to work
+func (posting *WalletPosting) MarshalBinary() ([]byte, error) {
+	return json.Marshal(posting)
+}
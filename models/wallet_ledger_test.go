@@ -0,0 +1,98 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+	"time"
+)
+
+func TestJobHoldAmount(t *testing.T) {
+	amount, err := jobHoldAmount(&Job{FareAmount: 240.456, EstimatedFareAmount: 200})
+	require.NoError(t, err)
+	require.Equal(t, 240.46, amount)
+
+	amount, err = jobHoldAmount(&Job{EstimatedFareAmount: 200})
+	require.NoError(t, err)
+	require.Equal(t, 200.0, amount)
+
+	_, err = jobHoldAmount(&Job{})
+	require.Equal(t, ErrJobFareUnknown, err)
+}
+
+func TestWalletOwnedBy(t *testing.T) {
+	userID := primitive.NewObjectID()
+	require.True(t, WalletOwnedBy(&Wallet{WalletType: WalletTypeUser, UserID: userID.Hex()}, userID))
+	require.False(t, WalletOwnedBy(&Wallet{WalletType: WalletTypeUser, UserID: primitive.NewObjectID().Hex()}, userID))
+	require.False(t, WalletOwnedBy(&Wallet{WalletType: WalletTypeSystem, UserID: userID.Hex()}, userID))
+}
+
+func TestValidateWalletPosting(t *testing.T) {
+	user, system := primitive.NewObjectID(), primitive.NewObjectID()
+	posting := &WalletPosting{
+		IdempotencyKey: "topup:1",
+		Entries:        []WalletEntry{{WalletID: user, Amount: 10.004}, {WalletID: system, Amount: -10}},
+	}
+	require.NoError(t, validateWalletPosting(posting))
+	require.Equal(t, 10.0, posting.Entries[0].Amount)
+
+	require.Equal(t, ErrWalletPostingKeyRequired, validateWalletPosting(&WalletPosting{Entries: posting.Entries}))
+	require.Equal(t, ErrInvalidWalletPosting, validateWalletPosting(&WalletPosting{IdempotencyKey: "k", Entries: posting.Entries[:1]}))
+	require.Equal(t, ErrInvalidWalletPosting, validateWalletPosting(&WalletPosting{IdempotencyKey: "k",
+		Entries: []WalletEntry{{WalletID: user, Amount: 0.001}, {WalletID: system, Amount: -0.001}}}))
+	require.Equal(t, ErrInvalidWalletPosting, validateWalletPosting(&WalletPosting{IdempotencyKey: "k",
+		Entries: []WalletEntry{{Amount: 10}, {WalletID: system, Amount: -10}}}))
+	require.Equal(t, ErrUnbalancedWalletPosting, validateWalletPosting(&WalletPosting{IdempotencyKey: "k",
+		Entries: []WalletEntry{{WalletID: user, Amount: 10}, {WalletID: system, Amount: -9.99}}}))
+}
+
+func TestSameWalletEntries(t *testing.T) {
+	user, system := primitive.NewObjectID(), primitive.NewObjectID()
+	entries := []WalletEntry{{WalletID: user, Amount: 10}, {WalletID: system, Amount: -10}}
+	require.True(t, sameWalletEntries(entries, []WalletEntry{{WalletID: user, Amount: 10.001}, {WalletID: system, Amount: -10}}))
+	require.False(t, sameWalletEntries(entries, []WalletEntry{{WalletID: user, Amount: 11}, {WalletID: system, Amount: -11}}))
+	require.False(t, sameWalletEntries(entries, []WalletEntry{{WalletID: system, Amount: 10}, {WalletID: user, Amount: -10}}))
+	require.False(t, sameWalletEntries(entries, entries[:1]))
+}
+
+func TestWalletDiscrepancy(t *testing.T) {
+	wallet := &Wallet{ID: primitive.NewObjectID(), WalletType: WalletTypeProvider, Balance: 100, HeldBalance: 20}
+	require.Nil(t, walletDiscrepancy(wallet, 100, 20))
+	require.Equal(t, 80.0, wallet.AvailableBalance())
+
+	require.Equal(t, "balance doesn't match the postings", walletDiscrepancy(wallet, 90, 20).Reason)
+	require.Equal(t, "held balance doesn't match the active holds", walletDiscrepancy(wallet, 100, 0).Reason)
+
+	overHeld := &Wallet{ID: wallet.ID, WalletType: WalletTypeProvider, Balance: 10, HeldBalance: 20}
+	require.Equal(t, "held balance is more than the balance", walletDiscrepancy(overHeld, 10, 20).Reason)
+	overHeld.WalletType = WalletTypeSystem
+	require.Nil(t, walletDiscrepancy(overHeld, 10, 20))
+}
+
+func TestLegacyWalletBalances(t *testing.T) {
+	now := time.Now()
+	first, second := primitive.NewObjectID().Hex(), primitive.NewObjectID().Hex()
+	balances := legacyWalletBalances([]*WalletTransaction{
+		{ID: primitive.NewObjectID(), WalletID: first, CreatedAt: now, RemainingBalance: 150.255},
+		{ID: primitive.NewObjectID(), WalletID: first, CreatedAt: now.Add(-time.Hour), RemainingBalance: 500},
+		{ID: primitive.NewObjectID(), WalletID: second, CreatedAt: now, RemainingBalance: 20},
+		{ID: primitive.NewObjectID(), WalletID: second, CreatedAt: now, RemainingBalance: 0},
+	})
+	require.Equal(t, map[string]float64{first: 150.26, second: 0}, balances)
+	require.Empty(t, legacyWalletBalances(nil))
+}
+
+func TestOpeningWalletPosting(t *testing.T) {
+	walletID, source := primitive.NewObjectID(), primitive.NewObjectID()
+	posting := openingWalletPosting(walletID, source, 150.26)
+	require.NoError(t, validateWalletPosting(&posting))
+	require.Equal(t, "opening-balance:"+walletID.Hex(), posting.IdempotencyKey)
+	require.Equal(t, []WalletEntry{{WalletID: source, Amount: -150.26}, {WalletID: walletID, Amount: 150.26}}, posting.Entries)
+
+	again := openingWalletPosting(walletID, source, 150.26)
+	require.True(t, sameWalletEntries(posting.Entries, again.Entries))
+}
@@ -0,0 +1,545 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"context"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/cache"
+	"github.com/tribehq/platform/lib/database"
+	"github.com/tribehq/platform/utils/webhooks"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrWithdrawalBelowMinimum        = errors.New("withdrawal amount is below the minimum")
+	ErrWithdrawalCooldown            = errors.New("a withdrawal was requested too recently, try again later")
+	ErrWithdrawalInProgress          = errors.New("a withdrawal is already in progress")
+	ErrWithdrawalBankAccountRequired = errors.New("a bank account of the provider is needed to withdraw")
+	ErrWithdrawalNotPending          = errors.New("withdrawal is not waiting for review")
+	ErrWithdrawalNotApproved         = errors.New("withdrawal is not approved")
+	ErrWithdrawalNotPaid             = errors.New("withdrawal is not paid")
+	ErrPayoutProviderNotConfigured   = errors.New("payout provider is not configured")
+)
+
+// Withdrawals holding the funds of a provider, they can't request another until these end.
+var openWithdrawalStatuses = bson.A{WithdrawalStatusPending, WithdrawalStatusApproved, WithdrawalStatusProcessing}
+
+// payoutCheckDelay is how long a withdrawal is left processing before its payout provider is asked how the payout went.
+const payoutCheckDelay = 10 * time.Minute
+
+var (
+	withdrawalIndexesMu    sync.Mutex
+	withdrawalIndexesReady bool
+)
+
+// isOpenWithdrawalStatus tells whether a withdrawal in the status still holds the funds of its provider.
+func isOpenWithdrawalStatus(status WithdrawalStatus) bool {
+	for _, open := range openWithdrawalStatuses {
+		if open == status {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureWithdrawalIndexes makes sure a provider has one open withdrawal at a time, even when they request two at once.
+// Withdrawals made before the open flag are flagged first so the index covers them too.
+func ensureWithdrawalIndexes() {
+	withdrawalIndexesMu.Lock()
+	defer withdrawalIndexesMu.Unlock()
+	if withdrawalIndexesReady {
+		return
+	}
+	collection := database.MongoDB.Collection(WithdrawalsCollection)
+	ctx := context.Background()
+	_, err := collection.UpdateMany(ctx, bson.D{{"status", bson.M{"$in": openWithdrawalStatuses}}, {"open", bson.M{"$exists": false}}},
+		bson.D{{"$set", bson.D{{"open", true}}}})
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{"providerID", 1}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.D{{"open", true}}),
+	})
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	withdrawalIndexesReady = true
+}
+
+// withdrawalSetting gives the withdrawal settings of the market, paying out by manual transfers when no payout provider is set.
+func withdrawalSetting() WithdrawalSetting {
+	setting := WithdrawalSetting{}
+	settings, err := GetCurrentMarketSettings()
+	if err == nil && settings != nil {
+		setting = settings.Withdrawal
+	}
+	if setting.PayoutProvider == "" {
+		setting.PayoutProvider = ManualPayoutProvider
+	}
+	return setting
+}
+
+// RequestWithdrawal holds an amount of the available balance of a provider's wallet and asks an admin to pay it to their bank account.
+func RequestWithdrawal(provider *ServiceProvider, bankAccount *BankAccount, amount float64, now time.Time) (*Withdrawal, error) {
+	setting := withdrawalSetting()
+	amount = roundAmount(amount)
+	if amount <= 0 || amount < setting.MinimumAmount {
+		return nil, ErrWithdrawalBelowMinimum
+	}
+	if bankAccount == nil || bankAccount.ID.IsZero() || bankAccount.ID != provider.BankDetails {
+		return nil, ErrWithdrawalBankAccountRequired
+	}
+	ensureWithdrawalIndexes()
+	collection := database.MongoDB.Collection(WithdrawalsCollection)
+	ctx := context.Background()
+	count, err := collection.CountDocuments(ctx, bson.D{{"providerID", provider.ID}, {"status", bson.M{"$in": openWithdrawalStatuses}}})
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrWithdrawalInProgress
+	}
+	if setting.CooldownHours > 0 {
+		since := now.Add(-time.Duration(setting.CooldownHours) * time.Hour)
+		filter := bson.D{{"providerID", provider.ID}, {"status", bson.M{"$ne": WithdrawalStatusRejected}}, {"createdAt", bson.M{"$gt": since}}}
+		count, err = collection.CountDocuments(ctx, filter)
+		if err != nil {
+			log.Errorln(err)
+			return nil, err
+		}
+		if count > 0 {
+			return nil, ErrWithdrawalCooldown
+		}
+	}
+
+	//cash the provider owes the market comes out of their earnings before they can withdraw them
+	_, err = offsetCashLiabilityFromWallet(provider)
+	if err != nil {
+		log.Errorln(err)
+	}
+	wallet, err := GetOrCreateWallet(provider.ID.Hex(), WalletTypeProvider)
+	if err != nil {
+		return nil, err
+	}
+	withdrawal := Withdrawal{
+		ID:             primitive.NewObjectID(),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		CreatedBy:      provider.User,
+		ProviderID:     provider.ID,
+		WalletID:       wallet.ID,
+		BankAccountID:  bankAccount.ID,
+		Amount:         amount,
+		Currency:       provider.Currency,
+		Status:         WithdrawalStatusPending,
+		PayoutProvider: setting.PayoutProvider,
+		Open:           true,
+	}
+	hold, err := PlaceWalletHold(WalletHold{
+		CreatedBy:      provider.User,
+		WalletID:       wallet.ID,
+		IdempotencyKey: "withdrawal:" + withdrawal.ID.Hex(),
+		Description:    "Withdrawal to bank account",
+		Amount:         amount,
+	})
+	if err != nil {
+		return nil, err
+	}
+	withdrawal.HoldID = &hold.ID
+	_, err = collection.InsertOne(ctx, &withdrawal)
+	if err != nil {
+		_, releaseErr := ReleaseWalletHold(hold)
+		if releaseErr != nil {
+			log.Errorln(releaseErr)
+		}
+		//another request of the provider got its withdrawal in first
+		if isDuplicateKeyError(err) {
+			return nil, ErrWithdrawalInProgress
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	go webhooks.NewWebhookEvent("withdrawal.created", &withdrawal)
+	return &withdrawal, nil
+}
+
+// moveWithdrawal changes the status of a withdrawal that is in one of the given statuses, nil when it has moved on already.
+func moveWithdrawal(withdrawal *Withdrawal, from bson.A, set bson.D) (*Withdrawal, error) {
+	filter := bson.D{{"_id", withdrawal.ID}, {"status", bson.M{"$in": from}}}
+	update := bson.D{{"$set", append(set, bson.E{"updatedAt", time.Now()})}}
+	for _, e := range set {
+		if status, ok := e.Value.(WithdrawalStatus); ok && e.Key == "status" && !isOpenWithdrawalStatus(status) {
+			//lets the provider request their next withdrawal
+			update = append(update, bson.E{"$unset", bson.D{{"open", ""}}})
+		}
+	}
+	findUpdateOpts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	moved := &Withdrawal{}
+	err := database.MongoDB.Collection(WithdrawalsCollection).FindOneAndUpdate(context.Background(), filter, update, findUpdateOpts).Decode(moved)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		log.Errorln(err)
+		return nil, err
+	}
+	go webhooks.NewWebhookEvent("withdrawal.updated", moved)
+	//Update cache item
+	err = cache.RedisClient.Del(moved.ID.Hex()).Err()
+	if err != nil {
+		log.Error(err)
+	}
+	return moved, nil
+}
+
+// withdrawalHold gives the wallet hold placed for a withdrawal.
+func withdrawalHold(withdrawal *Withdrawal) (*WalletHold, error) {
+	if withdrawal.HoldID == nil {
+		return nil, ErrWalletHoldNotFound
+	}
+	hold, err := GetWalletHoldByFilter(bson.D{{"_id", *withdrawal.HoldID}})
+	if err != nil {
+		return nil, err
+	}
+	if hold == nil {
+		return nil, ErrWalletHoldNotFound
+	}
+	return hold, nil
+}
+
+// releaseWithdrawalHold gives the funds held for a withdrawal that won't be paid back to the provider.
+func releaseWithdrawalHold(withdrawal *Withdrawal) {
+	hold, err := withdrawalHold(withdrawal)
+	if err == nil {
+		_, err = ReleaseWalletHold(hold)
+	}
+	if err != nil {
+		log.Errorln(err)
+	}
+}
+
+// notifyWithdrawalProvider emails the provider of a withdrawal about its outcome.
+func notifyWithdrawalProvider(withdrawal *Withdrawal, templateID string) {
+	provider := GetServiceProviderByID(withdrawal.ProviderID.Hex())
+	if provider == nil || provider.Email == "" {
+		return
+	}
+	err := SendEmail("no-reply@tribe.cab", provider.Email, templateID, provider.Language, withdrawal, nil)
+	if err != nil {
+		log.Errorln(err)
+	}
+}
+
+// ApproveWithdrawal approves a pending withdrawal and pays it through the payout provider it was requested with.
+// Withdrawals paid by manual transfer stay approved until an admin marks them paid.
+func ApproveWithdrawal(withdrawal *Withdrawal, reviewerID primitive.ObjectID, now time.Time) (*Withdrawal, error) {
+	approved, err := moveWithdrawal(withdrawal, bson.A{WithdrawalStatusPending}, bson.D{
+		{"status", WithdrawalStatusApproved}, {"reviewedBy", reviewerID}, {"reviewedAt", now},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if approved == nil {
+		return nil, ErrWithdrawalNotPending
+	}
+	if approved.PayoutProvider == ManualPayoutProvider {
+		return approved, nil
+	}
+	return payoutWithdrawal(approved, now)
+}
+
+// gatewayPayout describes the transfer of a withdrawal to the bank account it was requested to.
+func gatewayPayout(withdrawal *Withdrawal, bankAccount *BankAccount) GatewayPayout {
+	return GatewayPayout{
+		WithdrawalID:      withdrawal.ID.Hex(),
+		Amount:            withdrawal.Amount,
+		Currency:          withdrawal.Currency,
+		AccountHolderName: bankAccount.AccountHolderName,
+		AccountNumber:     bankAccount.AccountNumber,
+		IfscCode:          bankAccount.IfscCode,
+		RoutingNumber:     bankAccount.RoutingNumber,
+		SwiftCode:         bankAccount.SwiftCode,
+		BankName:          bankAccount.BankName,
+		BankCountry:       bankAccount.BankCountry,
+	}
+}
+
+// payoutWithdrawal transfers an approved withdrawal through its payout provider.
+// The withdrawal stays processing, with its funds held, until the payout provider tells how the payout went.
+func payoutWithdrawal(withdrawal *Withdrawal, now time.Time) (*Withdrawal, error) {
+	provider, ok := GetPayoutProvider(withdrawal.PayoutProvider)
+	if !ok {
+		//stays approved so it can still be paid by hand
+		return withdrawal, ErrPayoutProviderNotConfigured
+	}
+	bankAccount, err := GetBankAccountByID(withdrawal.BankAccountID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if bankAccount == nil {
+		return FailWithdrawal(withdrawal, ErrWithdrawalBankAccountRequired.Error())
+	}
+	processing, err := moveWithdrawal(withdrawal, bson.A{WithdrawalStatusApproved}, bson.D{{"status", WithdrawalStatusProcessing}})
+	if err != nil {
+		return nil, err
+	}
+	if processing == nil {
+		return nil, ErrWithdrawalNotApproved
+	}
+	result, err := provider.Payout(gatewayPayout(processing, bankAccount))
+	if err != nil {
+		//the payout may have been made all the same, the status checks find out
+		log.Errorln(err)
+		return processing, nil
+	}
+	return applyPayoutResult(processing, result, now)
+}
+
+// payoutWithdrawalStatus gives the status a withdrawal moves to on the state of its payout.
+// It stays as it is while the outcome isn't known, and once it has ended.
+func payoutWithdrawalStatus(current WithdrawalStatus, result *PayoutResult) WithdrawalStatus {
+	if result == nil {
+		return current
+	}
+	switch current {
+	case WithdrawalStatusApproved, WithdrawalStatusProcessing:
+		switch result.Status {
+		case PayoutStatusPaid:
+			return WithdrawalStatusPaid
+		case PayoutStatusFailed, PayoutStatusReversed:
+			//sent back before it was reported paid, the held funds never left the wallet
+			return WithdrawalStatusFailed
+		}
+	case WithdrawalStatusPaid:
+		if result.Status == PayoutStatusReversed {
+			return WithdrawalStatusReversed
+		}
+	}
+	return current
+}
+
+// payoutFailureReason gives why a payout failed or was reversed.
+func payoutFailureReason(result *PayoutResult) string {
+	if result.Reason != "" {
+		return result.Reason
+	}
+	return "payout " + string(result.Status)
+}
+
+// applyPayoutResult moves a withdrawal on the state of its payout, keeping the reference of a payout still pending.
+// The held funds go back to the provider only when the payout failed or was reversed.
+func applyPayoutResult(withdrawal *Withdrawal, result *PayoutResult, now time.Time) (*Withdrawal, error) {
+	if withdrawal.PayoutReference != "" && result.Reference != "" && result.Reference != withdrawal.PayoutReference {
+		log.Errorf("payout %s isn't the payout %s of withdrawal %s", result.Reference, withdrawal.PayoutReference, withdrawal.ID.Hex())
+		return withdrawal, nil
+	}
+	status := payoutWithdrawalStatus(withdrawal.Status, result)
+	if status == withdrawal.Status {
+		if status == WithdrawalStatusProcessing && withdrawal.PayoutReference == "" && result.Reference != "" {
+			moved, err := moveWithdrawal(withdrawal, bson.A{WithdrawalStatusProcessing}, bson.D{{"payoutReference", result.Reference}})
+			if err != nil || moved != nil {
+				return moved, err
+			}
+		}
+		return withdrawal, nil
+	}
+	switch status {
+	case WithdrawalStatusPaid:
+		return CompleteWithdrawal(withdrawal, result.Reference, now)
+	case WithdrawalStatusFailed:
+		return FailWithdrawal(withdrawal, payoutFailureReason(result))
+	case WithdrawalStatusReversed:
+		return reverseWithdrawal(withdrawal, payoutFailureReason(result), now)
+	}
+	return withdrawal, nil
+}
+
+// RecordPayoutResult records the state of a payout a payout provider sent a webhook about.
+// Payouts that weren't made for a withdrawal through the payout provider are left alone.
+func RecordPayoutResult(payoutProvider string, result *PayoutResult) (*Withdrawal, error) {
+	if _, err := primitive.ObjectIDFromHex(result.WithdrawalID); err != nil {
+		return nil, nil
+	}
+	withdrawal, err := GetWithdrawalByID(result.WithdrawalID)
+	if err != nil || withdrawal == nil {
+		return nil, err
+	}
+	if !strings.EqualFold(withdrawal.PayoutProvider, payoutProvider) {
+		return nil, nil
+	}
+	return applyPayoutResult(withdrawal, result, time.Now())
+}
+
+// checkWithdrawalPayout asks the payout provider of a processing withdrawal how its payout went.
+// A payout the payout provider has no record of is made again, under the same idempotency key.
+func checkWithdrawalPayout(withdrawal *Withdrawal, now time.Time) (*Withdrawal, error) {
+	provider, ok := GetPayoutProvider(withdrawal.PayoutProvider)
+	if !ok {
+		return nil, ErrPayoutProviderNotConfigured
+	}
+	result, err := provider.GetPayout(withdrawal.ID.Hex(), withdrawal.PayoutReference)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		bankAccount, err := GetBankAccountByID(withdrawal.BankAccountID.Hex())
+		if err != nil {
+			return nil, err
+		}
+		if bankAccount == nil {
+			return FailWithdrawal(withdrawal, ErrWithdrawalBankAccountRequired.Error())
+		}
+		result, err = provider.Payout(gatewayPayout(withdrawal, bankAccount))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return applyPayoutResult(withdrawal, result, now)
+}
+
+// CheckProcessingWithdrawals checks the payouts of withdrawals that have been processing for a while,
+// for the ones whose webhooks didn't come through. It gives how many withdrawals it checked.
+func CheckProcessingWithdrawals(now time.Time) (int, error) {
+	ctx := context.Background()
+	filter := bson.D{{"status", WithdrawalStatusProcessing}, {"updatedAt", bson.M{"$lt": now.Add(-payoutCheckDelay)}}}
+	cur, err := database.MongoDB.Collection(WithdrawalsCollection).Find(ctx, filter)
+	if err != nil {
+		log.Errorln(err)
+		return 0, err
+	}
+	defer cur.Close(ctx)
+	count := 0
+	for cur.Next(ctx) {
+		withdrawal := &Withdrawal{}
+		err = cur.Decode(withdrawal)
+		if err != nil {
+			log.Errorln(err)
+			continue
+		}
+		_, err = checkWithdrawalPayout(withdrawal, now)
+		if err != nil {
+			log.Errorf("checking the payout of withdrawal %s: %v", withdrawal.ID.Hex(), err)
+			continue
+		}
+		count++
+	}
+	return count, cur.Err()
+}
+
+// RunWithdrawalPayoutChecks checks the payouts of processing withdrawals at every interval.
+func RunWithdrawalPayoutChecks(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := CheckProcessingWithdrawals(time.Now()); err != nil {
+			log.Errorln(err)
+		}
+		<-ticker.C
+	}
+}
+
+// CompleteWithdrawal marks an approved withdrawal paid, taking the held funds out of the provider's wallet.
+func CompleteWithdrawal(withdrawal *Withdrawal, payoutReference string, now time.Time) (*Withdrawal, error) {
+	if withdrawal.Status != WithdrawalStatusApproved && withdrawal.Status != WithdrawalStatusProcessing {
+		return nil, ErrWithdrawalNotApproved
+	}
+	hold, err := withdrawalHold(withdrawal)
+	if err != nil {
+		return nil, err
+	}
+	payouts, err := GetOrCreateWallet(SystemWalletPayouts, WalletTypeSystem)
+	if err != nil {
+		return nil, err
+	}
+	credits := []WalletEntry{{WalletID: payouts.ID, Amount: withdrawal.Amount}}
+	posting, err := CaptureWalletHold(hold, credits, "Withdrawal to bank account", BalanceForWithdrawal)
+	if err != nil {
+		return nil, err
+	}
+	paid, err := moveWithdrawal(withdrawal, bson.A{WithdrawalStatusApproved, WithdrawalStatusProcessing}, bson.D{
+		{"status", WithdrawalStatusPaid}, {"payoutReference", payoutReference}, {"postingID", posting.ID}, {"paidAt", now},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if paid == nil {
+		return nil, ErrWithdrawalNotApproved
+	}
+	notifyWithdrawalProvider(paid, "provider.withdrawal.paid")
+	return paid, nil
+}
+
+// RejectWithdrawal turns down a pending withdrawal and gives the held funds back to the provider.
+func RejectWithdrawal(withdrawal *Withdrawal, reviewerID primitive.ObjectID, reason string, now time.Time) (*Withdrawal, error) {
+	rejected, err := moveWithdrawal(withdrawal, bson.A{WithdrawalStatusPending}, bson.D{
+		{"status", WithdrawalStatusRejected}, {"rejectionReason", reason}, {"reviewedBy", reviewerID}, {"reviewedAt", now},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if rejected == nil {
+		return nil, ErrWithdrawalNotPending
+	}
+	releaseWithdrawalHold(rejected)
+	notifyWithdrawalProvider(rejected, "provider.withdrawal.rejected")
+	return rejected, nil
+}
+
+// FailWithdrawal records that the payout of an approved withdrawal didn't go through and gives the held funds back to the provider.
+func FailWithdrawal(withdrawal *Withdrawal, reason string) (*Withdrawal, error) {
+	failed, err := moveWithdrawal(withdrawal, bson.A{WithdrawalStatusApproved, WithdrawalStatusProcessing}, bson.D{
+		{"status", WithdrawalStatusFailed}, {"failureReason", reason},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if failed == nil {
+		return nil, ErrWithdrawalNotApproved
+	}
+	releaseWithdrawalHold(failed)
+	notifyWithdrawalProvider(failed, "provider.withdrawal.failed")
+	return failed, nil
+}
+
+// reverseWithdrawal gives the amount of a paid withdrawal the bank sent back to the provider's wallet.
+func reverseWithdrawal(withdrawal *Withdrawal, reason string, now time.Time) (*Withdrawal, error) {
+	if withdrawal.PostingID == nil {
+		return nil, ErrWalletPostingNotFound
+	}
+	posting, err := GetWalletPostingByID(withdrawal.PostingID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if posting == nil {
+		return nil, ErrWalletPostingNotFound
+	}
+	reversal, err := ReverseWalletPosting(posting, "Withdrawal sent back by the bank", primitive.NilObjectID)
+	if err != nil {
+		return nil, err
+	}
+	reversed, err := moveWithdrawal(withdrawal, bson.A{WithdrawalStatusPaid}, bson.D{
+		{"status", WithdrawalStatusReversed}, {"failureReason", reason}, {"reversalPostingID", reversal.ID}, {"reversedAt", now},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reversed == nil {
+		return nil, ErrWithdrawalNotPaid
+	}
+	notifyWithdrawalProvider(reversed, "provider.withdrawal.reversed")
+	return reversed, nil
+}
@@ -0,0 +1,51 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package models
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestIsOpenWithdrawalStatus(t *testing.T) {
+	require.True(t, isOpenWithdrawalStatus(WithdrawalStatusPending))
+	require.True(t, isOpenWithdrawalStatus(WithdrawalStatusApproved))
+	require.True(t, isOpenWithdrawalStatus(WithdrawalStatusProcessing))
+	require.False(t, isOpenWithdrawalStatus(WithdrawalStatusPaid))
+	require.False(t, isOpenWithdrawalStatus(WithdrawalStatusRejected))
+	require.False(t, isOpenWithdrawalStatus(WithdrawalStatusFailed))
+}
+
+func TestPayoutWithdrawalStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  WithdrawalStatus
+		result   *PayoutResult
+		expected WithdrawalStatus
+	}{
+		{"queued payouts stay processing", WithdrawalStatusProcessing, &PayoutResult{Status: PayoutStatusPending}, WithdrawalStatusProcessing},
+		{"timed out payouts stay processing", WithdrawalStatusProcessing, nil, WithdrawalStatusProcessing},
+		{"processed payouts are paid", WithdrawalStatusProcessing, &PayoutResult{Status: PayoutStatusPaid}, WithdrawalStatusPaid},
+		{"rejected payouts fail", WithdrawalStatusProcessing, &PayoutResult{Status: PayoutStatusFailed}, WithdrawalStatusFailed},
+		{"payouts reversed before they were reported paid fail", WithdrawalStatusProcessing, &PayoutResult{Status: PayoutStatusReversed}, WithdrawalStatusFailed},
+		{"paid payouts sent back are reversed", WithdrawalStatusPaid, &PayoutResult{Status: PayoutStatusReversed}, WithdrawalStatusReversed},
+		{"paid payouts stay paid", WithdrawalStatusPaid, &PayoutResult{Status: PayoutStatusPaid}, WithdrawalStatusPaid},
+		{"late failures of paid payouts are ignored", WithdrawalStatusPaid, &PayoutResult{Status: PayoutStatusFailed}, WithdrawalStatusPaid},
+		{"failed withdrawals stay failed", WithdrawalStatusFailed, &PayoutResult{Status: PayoutStatusPaid}, WithdrawalStatusFailed},
+		{"reversed withdrawals stay reversed", WithdrawalStatusReversed, &PayoutResult{Status: PayoutStatusReversed}, WithdrawalStatusReversed},
+		{"pending withdrawals aren't paid out", WithdrawalStatusPending, &PayoutResult{Status: PayoutStatusPaid}, WithdrawalStatusPending},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.expected, payoutWithdrawalStatus(test.current, test.result))
+		})
+	}
+	require.False(t, isOpenWithdrawalStatus(WithdrawalStatusReversed))
+}
+
+func TestPayoutFailureReason(t *testing.T) {
+	require.Equal(t, "invalid account", payoutFailureReason(&PayoutResult{Status: PayoutStatusFailed, Reason: "invalid account"}))
+	require.Equal(t, "payout reversed", payoutFailureReason(&PayoutResult{Status: PayoutStatusReversed}))
+}
@@ -126,6 +126,11 @@ func (r *Resolver) Document() DocumentResolver {
 	return &documentResolver{r}
 }
 
+// BillingSubscription resolver
+func (r *Resolver) BillingSubscription() BillingSubscriptionResolver {
+	return &billingSubscriptionResolver{r}
+}
+
 // Mutation resolver
 func (r *Resolver) Mutation() MutationResolver {
 	return &mutationResolver{r}
@@ -85,11 +85,36 @@ func (r *queryResolver) JobLaterBookings(ctx context.Context, jobLaterSearchServ
 	return itemList, nil
 }
 
-//TODO
-//EstimateBookingFare gives an estimate booking fare
+//EstimateBookingFare gives an estimate booking fare, taxed where the service is picked up or done
 func (r *mutationResolver) EstimateBookingFare(ctx context.Context, input models.BookingInput) (*models.BookingFareEstimate, error) {
-	//Just do the dry run and report back the fare to the user
-	panic("implement me")
+	serviceSubCategory := models.GetServiceSubCategoryByID(input.ServiceSubCategoryID.Hex())
+	if serviceSubCategory.ID.IsZero() {
+		return nil, ErrServiceSubCategoryNotFound
+	}
+	service := models.GetServiceByID(serviceSubCategory.ServiceID)
+	if service.ID.IsZero() {
+		return nil, ErrServiceNotFound
+	}
+	switch service.Category {
+	case models.ServiceCategoryTaxiService:
+		if input.RideDetails == nil || input.RideDetails.PickUpLocation == nil || input.RideDetails.DropOffLocation == nil {
+			return nil, models.ErrBookingLocationRequired
+		}
+		from := &models.Address{}
+		_ = copier.Copy(&from, input.RideDetails.PickUpLocation)
+		to := &models.Address{}
+		_ = copier.Copy(&to, input.RideDetails.DropOffLocation)
+		return models.EstimateRideFare(input.RideDetails.VehicleType, from, to)
+	case models.ServiceCategoryProfessionalService:
+		if input.OtherServiceDetails == nil || input.OtherServiceDetails.DeliveryAddress == nil {
+			return nil, models.ErrBookingLocationRequired
+		}
+		address := &models.Address{}
+		_ = copier.Copy(&address, input.OtherServiceDetails.DeliveryAddress)
+		return models.EstimateServiceFare(input.OtherServiceDetails.ServiceOrderItems, address)
+	default:
+		return nil, models.ErrBookingFareNotAvailable
+	}
 }
 
 //CreateBooking creates a new booking
@@ -122,6 +147,7 @@ func (r *mutationResolver) CreateBooking(ctx context.Context, input models.Booki
 			return nil, ErrServiceProviderNotFound
 		}
 	}
+	isCashBooking := input.PaymentMethod != nil && *input.PaymentMethod == models.PaymentMethodTypeCash
 	emailTemplateID := ""
 	//smsTemplateID:=""
 	//pushNotificationTemplateID:=""
@@ -137,6 +163,22 @@ func (r *mutationResolver) CreateBooking(ctx context.Context, input models.Booki
 		//check for service provider schedule(personal availability + existing job bookings)
 		//if availability is true the create job
 		//create a job
+		//without a provider picked by the user the job goes to the best ranked one available
+		if provider.ID.IsZero() {
+			dispatched, err := models.DispatchProvider(serviceSubCategory.ID, isCashBooking)
+			if err != nil {
+				return nil, err
+			}
+			provider = *dispatched
+		}
+		//providers who owe more cash than the market allows don't get cash jobs until they settle,
+		//whether the user picked them or they were dispatched
+		if isCashBooking {
+			err = models.CheckCashJobsAllowed(provider.ID)
+			if err != nil {
+				return nil, err
+			}
+		}
 		address := &models.Address{}
 		_ = copier.Copy(&address, &input.OtherServiceDetails.DeliveryAddress)
 
@@ -148,6 +190,9 @@ func (r *mutationResolver) CreateBooking(ctx context.Context, input models.Booki
 		job.ProviderID = provider.ID.Hex()
 		job.UserID = user.ID.Hex()
 		job.ServiceOrderItems = &input.OtherServiceDetails.ServiceOrderItems
+		if input.PaymentMethod != nil {
+			job.PaymentMethodType = *input.PaymentMethod
+		}
 
 		job, err := models.CreateJob(job)
 		if err != nil {
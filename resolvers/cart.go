@@ -20,6 +20,7 @@ import (
 var (
 	ErrProductNotFound          = errors.New("product not found")
 	ErrProductVariationNotFound = errors.New("product variation not found")
+	ErrInvalidCartQuantity      = errors.New("cart quantity can't be negative")
 )
 
 //func (r *mutationResolver) AddCart(ctx context.Context, input models.AddCartInput) (*models.Cart, error) {
@@ -67,9 +68,24 @@ func (r cartItemResolver) Product(ctx context.Context, obj *models.CartItem) (*m
 }
 
 func (r cartResolver) User(ctx context.Context, obj *models.Cart) (*models.User, error) {
+	if obj.IsGuest() {
+		return nil, nil
+	}
 	return models.GetUserByID(obj.UserID.Hex()), nil
 }
 
+//Token gives the token a guest keeps to come back to their cart
+func (r cartResolver) Token(ctx context.Context, obj *models.Cart) (*string, error) {
+	if !obj.IsGuest() {
+		return nil, nil
+	}
+	token, err := models.GuestCartToken(obj)
+	if err != nil {
+		return nil, err
+	}
+	return &token, nil
+}
+
 func (r cartResolver) StoreID(ctx context.Context, obj *models.Cart) (primitive.ObjectID, error) {
 	storeID, err := primitive.ObjectIDFromHex(obj.StoreID)
 	if err != nil {
@@ -90,20 +106,33 @@ func (r cartResolver) CartTotal(ctx context.Context, obj *models.Cart) (float64,
 			if err != nil {
 				return 0, ErrProductVariationNotFound
 			}
-			cartTotal = cartTotal + productVariation.SalePrice
+			price := productVariation.Price
+			if price == 0 {
+				price = productVariation.RegularPrice
+			}
+			cartTotal = cartTotal + price
 		}
 		if item.VariationID == nil && !item.ProductID.IsZero() {
 			product := models.GetProductByID(item.ProductID.Hex())
 			if product.ID.IsZero() {
 				return 0, ErrProductNotFound
 			}
-			cartTotal = cartTotal + product.SalePrice
+			price := product.Price
+			if price == 0 {
+				price = product.RegularPrice
+			}
+			cartTotal = cartTotal + price
 		}
 	}
 
 	return cartTotal, nil
 }
 
+//Breakdown gives the price breakdown of the cart delivered to an address
+func (r cartResolver) Breakdown(ctx context.Context, obj *models.Cart, deliveryAddressID primitive.ObjectID, coupon *string) (*models.CartBreakdown, error) {
+	return models.GetCartBreakdown(obj, deliveryAddressID, coupon)
+}
+
 func (r *mutationResolver) DeleteCart(ctx context.Context, id primitive.ObjectID) (*bool, error) {
 	res, err := models.DeleteCartByID(id.Hex())
 	user, err := auth.ForContext(ctx)
@@ -145,6 +174,23 @@ func (r *queryResolver) Cart(ctx context.Context, id primitive.ObjectID) (*model
 	return cart, nil
 }
 
+//RecoverCart restores the cart of an abandoned cart reminder link
+func (r *mutationResolver) RecoverCart(ctx context.Context, cartID primitive.ObjectID, expires string, signature string) (*models.Cart, error) {
+	return models.RecoverCart(cartID, expires, signature)
+}
+
+//CartRecoveryReport gives how many of the abandoned carts reminded of were won back
+func (r *queryResolver) CartRecoveryReport(ctx context.Context, fromDate *time.Time, toDate *time.Time) (*models.CartRecoveryReport, error) {
+	var from, to time.Time
+	if fromDate != nil {
+		from = *fromDate
+	}
+	if toDate != nil {
+		to = *toDate
+	}
+	return models.GetCartRecoveryReport(from, to)
+}
+
 func containsObjectID(s []primitive.ObjectID, e primitive.ObjectID) bool {
 	for _, a := range s {
 		if a == e {
@@ -154,70 +200,99 @@ func containsObjectID(s []primitive.ObjectID, e primitive.ObjectID) bool {
 	return false
 }
 
-func (r *mutationResolver) AddProductToCart(ctx context.Context, productID primitive.ObjectID, variationID *primitive.ObjectID, quantity int) (*models.Cart, error) {
-	user, err := auth.ForContext(ctx)
-	if err != nil {
-		return nil, err
+//AddProductToCart sets the quantity of a product in the customer's cart of its store, or in a guest cart when nobody is logged in
+func (r *mutationResolver) AddProductToCart(ctx context.Context, productID primitive.ObjectID, variationID *primitive.ObjectID, quantity int, cartToken *string) (*models.Cart, error) {
+	if quantity < 0 {
+		return nil, ErrInvalidCartQuantity
 	}
-	//TODO : identifies user by store id
-	cart := &models.Cart{}
-	cart, err = models.GetCartByFilter(bson.D{{"userID", user.ID}})
-	if err != nil {
-		log.Errorln(err)
-		return nil, err
+	product := models.GetProductByID(productID.Hex())
+	if product == nil || product.ID.IsZero() {
+		return nil, ErrProductNotFound
 	}
+	if variationID != nil && !containsObjectID(product.Variations, *variationID) {
+		return nil, ErrProductVariationNotFound
+	}
+
+	var err error
+	var cart *models.Cart
+	user, _ := auth.ForContext(ctx)
+	if user != nil {
+		cart, err = models.GetCartByFilter(bson.D{{"userID", user.ID}, {"storeID", product.Store}})
+		if err != nil {
+			log.Errorln(err)
+			return nil, err
+		}
+	} else if cartToken != nil && *cartToken != "" {
+		cart, err = models.GetGuestCart(*cartToken)
+		if err != nil {
+			return nil, err
+		}
+		//Guest carts are kept per store, a product of another store starts another cart
+		if cart != nil && cart.StoreID != product.Store {
+			cart = nil
+		}
+	}
+
 	if cart == nil || cart.ID.IsZero() {
-		cart, err = models.CreateCart(&models.Cart{UserID: user.ID, CreatedBy: user.ID, CreatedAt: time.Now(), UpdatedAt: time.Now()})
+		newCart := &models.Cart{StoreID: product.Store, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		if user != nil {
+			newCart.UserID = user.ID
+			newCart.CreatedBy = user.ID
+		}
+		cart, err = models.CreateCart(newCart)
 		if err != nil {
 			return nil, err
 		}
 		//Update audit log
-		go audit_log.NewAuditLogWithCtx(models.Created, user.ID.Hex(), cart.ID.Hex(), "cart", cart, nil, ctx)
+		if user != nil {
+			go audit_log.NewAuditLogWithCtx(models.Created, user.ID.Hex(), cart.ID.Hex(), "cart", cart, nil, ctx)
+		}
 	}
-	cartItems := cart.Items
-	addCartItem := &models.CartItem{
+	cart.Items = models.SetCartItem(cart.Items, models.CartItem{
 		ProductID:   productID,
 		VariationID: variationID,
 		Quantity:    quantity,
 		Type:        models.CartItemTypeProduct,
-	}
-	if len(cartItems) > 0 {
-		for i, item := range cartItems {
-			if item.VariationID != nil && addCartItem.VariationID != nil {
-				if item.VariationID.Hex() == addCartItem.VariationID.Hex() {
-					if item.ProductID == addCartItem.ProductID {
-						product := models.GetProductByID(addCartItem.ProductID.Hex())
-						if product.ID.IsZero() {
-							return cart, ErrProductNotFound
-						}
-						if !containsObjectID(product.Variations, *variationID) {
-							return cart, ErrProductVariationNotFound
-						}
-						if addCartItem.Quantity == 0 {
-							//remove(cartItems,addCartItem.VariationID)
-						}
-						cartItems[i].Quantity = addCartItem.Quantity
-						break
-					}
-				}
-			}
-			if item.VariationID == nil && addCartItem.VariationID == nil && !item.ProductID.IsZero() && item.ProductID == addCartItem.ProductID {
-				if addCartItem.Quantity == 0 {
-					//remove(cartItems,addCartItem.VariationID)
-				}
-				cartItems[i].Quantity = addCartItem.Quantity
-				break
-			}
-		}
-	} else {
-		cartItems = append(cartItems, *addCartItem)
-	}
-	cart.Items = cartItems
+	})
 	updatedCart, err := models.UpdateCart(cart)
 	if err != nil {
 		return nil, err
 	}
 	//Update audit log
-	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), updatedCart.ID.Hex(), "cart", updatedCart, nil, ctx)
+	if user != nil {
+		go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), updatedCart.ID.Hex(), "cart", updatedCart, nil, ctx)
+	}
 	return updatedCart, nil
 }
+
+//MergeGuestCarts hands the guest carts of the tokens over to the logged in customer
+func (r *mutationResolver) MergeGuestCarts(ctx context.Context, cartTokens []string) ([]*models.Cart, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	carts := []*models.Cart{}
+	for _, token := range cartTokens {
+		cart, err := models.MergeGuestCart(token, user.ID)
+		if err != nil {
+			return carts, err
+		}
+		if cart == nil {
+			continue
+		}
+		//Update audit log
+		go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), cart.ID.Hex(), "cart", cart, nil, ctx)
+		carts = append(carts, cart)
+	}
+	return carts, nil
+}
+
+// mergeGuestCarts merges the guest carts a customer had before logging in, without failing the login.
+func mergeGuestCarts(cartTokens []string, userID primitive.ObjectID) {
+	for _, token := range cartTokens {
+		_, err := models.MergeGuestCart(token, userID)
+		if err != nil {
+			log.Errorln(err)
+		}
+	}
+}
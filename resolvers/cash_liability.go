@@ -0,0 +1,97 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package resolvers
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/tribehq/platform/lib/audit_log"
+	"github.com/tribehq/platform/models"
+	"github.com/tribehq/platform/utils/auth"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// cashLiabilityProviderID gives the provider asked for, or the current provider when none is given.
+func cashLiabilityProviderID(ctx context.Context, providerID *primitive.ObjectID) (primitive.ObjectID, error) {
+	if providerID != nil {
+		return *providerID, nil
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	provider := models.GetServiceProviderByFilter(bson.D{{"user", user.ID}})
+	if provider == nil || provider.ID.IsZero() {
+		return primitive.NilObjectID, ErrServiceProviderNotFound
+	}
+	return provider.ID, nil
+}
+
+//CashLiabilities gives the cash a provider owes the market in each currency
+func (r *queryResolver) CashLiabilities(ctx context.Context, providerID *primitive.ObjectID) ([]*models.CashLiability, error) {
+	id, err := cashLiabilityProviderID(ctx, providerID)
+	if err != nil {
+		return nil, err
+	}
+	return models.GetProviderCashLiabilities(id)
+}
+
+//CashLiabilityEntries gives the changes of the cash a provider owes the market
+func (r *queryResolver) CashLiabilityEntries(ctx context.Context, providerID *primitive.ObjectID, currency *string, after *string, before *string, first *int, last *int) (*models.CashLiabilityEntryConnection, error) {
+	var items []*models.CashLiabilityEntry
+	var edges []*models.CashLiabilityEntryEdge
+	id, err := cashLiabilityProviderID(ctx, providerID)
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.D{{"providerID", id}}
+	if currency != nil {
+		filter = append(filter, bson.E{"currency", *currency})
+	}
+	limit := 25
+	items, totalCount, hasPrevious, hasNext, err := models.GetCashLiabilityEntries(filter, limit, after, before, first, last)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		edge := &models.CashLiabilityEntryEdge{
+			Cursor: base64.StdEncoding.EncodeToString([]byte(item.ID.Hex())),
+			Node:   item,
+		}
+		edges = append(edges, edge)
+	}
+
+	pageInfo := &models.PageInfo{}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = edges[0].Cursor
+		pageInfo.EndCursor = edges[len(edges)-1].Cursor
+		pageInfo.HasNextPage = hasNext
+		pageInfo.HasPreviousPage = hasPrevious
+	}
+
+	itemList := &models.CashLiabilityEntryConnection{TotalCount: int(totalCount), Edges: edges, Nodes: items, PageInfo: pageInfo}
+	return itemList, nil
+}
+
+//RecordCashLiabilityPayment records cash a provider paid towards what they owe the market
+func (r *mutationResolver) RecordCashLiabilityPayment(ctx context.Context, input models.CashLiabilityPaymentInput) (*models.CashLiability, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	provider := models.GetServiceProviderByID(input.ProviderID.Hex())
+	if provider == nil || provider.ID.IsZero() {
+		return nil, ErrServiceProviderNotFound
+	}
+	entry, err := models.RecordCashLiabilityPayment(provider.ID, input.Currency, input.Amount, input.Reference, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Created, user.ID.Hex(), entry.ID.Hex(), "cash liability entry", entry, nil, ctx)
+	return models.GetCashLiability(provider.ID, input.Currency)
+}
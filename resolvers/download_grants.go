@@ -0,0 +1,188 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package resolvers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/audit_log"
+	"github.com/tribehq/platform/models"
+	"github.com/tribehq/platform/utils/auth"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrDownloadGrantNotFound = errors.New("download grant not found")
+)
+
+//MyDownloads gives the files the current user can download
+func (r *queryResolver) MyDownloads(ctx context.Context, after *string, before *string, first *int, last *int) (*models.DownloadGrantConnection, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return downloadGrantConnection(bson.D{{"customerID", user.ID}}, after, before, first, last)
+}
+
+//DownloadGrants gives a list of download grants
+func (r *queryResolver) DownloadGrants(ctx context.Context, orderID *primitive.ObjectID, customerID *primitive.ObjectID, productID *primitive.ObjectID, after *string, before *string, first *int, last *int) (*models.DownloadGrantConnection, error) {
+	filter := bson.D{}
+	if orderID != nil {
+		filter = append(filter, bson.E{"orderID", *orderID})
+	}
+	if customerID != nil {
+		filter = append(filter, bson.E{"customerID", *customerID})
+	}
+	if productID != nil {
+		filter = append(filter, bson.E{"productID", *productID})
+	}
+	return downloadGrantConnection(filter, after, before, first, last)
+}
+
+func downloadGrantConnection(filter bson.D, after *string, before *string, first *int, last *int) (*models.DownloadGrantConnection, error) {
+	var items []*models.DownloadGrant
+	var edges []*models.DownloadGrantEdge
+	limit := 25
+	items, totalCount, hasPrevious, hasNext, err := models.GetDownloadGrants(filter, limit, after, before, first, last)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		edge := &models.DownloadGrantEdge{
+			Cursor: base64.StdEncoding.EncodeToString([]byte(item.ID.Hex())),
+			Node:   item,
+		}
+		edges = append(edges, edge)
+	}
+
+	pageInfo := &models.PageInfo{}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = edges[0].Cursor
+		pageInfo.EndCursor = edges[len(edges)-1].Cursor
+		pageInfo.HasNextPage = hasNext
+		pageInfo.HasPreviousPage = hasPrevious
+	}
+
+	itemList := &models.DownloadGrantConnection{TotalCount: int(totalCount), Edges: edges, Nodes: items, PageInfo: pageInfo}
+	return itemList, nil
+}
+
+//DownloadGrant returns a download grant by ID
+func (r *queryResolver) DownloadGrant(ctx context.Context, id primitive.ObjectID) (*models.DownloadGrant, error) {
+	grant, err := models.GetDownloadGrantByID(id.Hex())
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	if grant == nil {
+		return nil, ErrDownloadGrantNotFound
+	}
+	return grant, nil
+}
+
+//DownloadLogs gives a list of download logs
+func (r *queryResolver) DownloadLogs(ctx context.Context, grantID *primitive.ObjectID, orderID *primitive.ObjectID, after *string, before *string, first *int, last *int) (*models.DownloadLogConnection, error) {
+	var items []*models.DownloadLog
+	var edges []*models.DownloadLogEdge
+	filter := bson.D{}
+	if grantID != nil {
+		filter = append(filter, bson.E{"grantID", *grantID})
+	}
+	if orderID != nil {
+		filter = append(filter, bson.E{"orderID", *orderID})
+	}
+	limit := 25
+	items, totalCount, hasPrevious, hasNext, err := models.GetDownloadLogs(filter, limit, after, before, first, last)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		edge := &models.DownloadLogEdge{
+			Cursor: base64.StdEncoding.EncodeToString([]byte(item.ID.Hex())),
+			Node:   item,
+		}
+		edges = append(edges, edge)
+	}
+
+	pageInfo := &models.PageInfo{}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = edges[0].Cursor
+		pageInfo.EndCursor = edges[len(edges)-1].Cursor
+		pageInfo.HasNextPage = hasNext
+		pageInfo.HasPreviousPage = hasPrevious
+	}
+
+	itemList := &models.DownloadLogConnection{TotalCount: int(totalCount), Edges: edges, Nodes: items, PageInfo: pageInfo}
+	return itemList, nil
+}
+
+//RequestDownloadURL gives a short-lived signed link to a file the current user was granted
+func (r *mutationResolver) RequestDownloadURL(ctx context.Context, grantID primitive.ObjectID) (*models.DownloadURL, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	grant, err := models.GetDownloadGrantByID(grantID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if grant == nil || grant.CustomerID != user.ID {
+		return nil, ErrDownloadGrantNotFound
+	}
+	url, expiresAt, err := models.SignDownloadURL(grant)
+	if err != nil {
+		return nil, err
+	}
+	return &models.DownloadURL{URL: url, ExpiresAt: expiresAt}, nil
+}
+
+//RevokeDownloadGrant revokes a buyer's access to a file
+func (r *mutationResolver) RevokeDownloadGrant(ctx context.Context, id primitive.ObjectID) (*models.DownloadGrant, error) {
+	grant, err := models.GetDownloadGrantByID(id.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if grant == nil {
+		return nil, ErrDownloadGrantNotFound
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	revoked, err := models.RevokeDownloadGrant(grant)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), revoked.ID.Hex(), "download grant", revoked, nil, ctx)
+	return revoked, nil
+}
+
+//ResetDownloadGrant resets the download count of a grant and lifts its revocation
+func (r *mutationResolver) ResetDownloadGrant(ctx context.Context, id primitive.ObjectID, extendExpiry *bool) (*models.DownloadGrant, error) {
+	grant, err := models.GetDownloadGrantByID(id.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if grant == nil {
+		return nil, ErrDownloadGrantNotFound
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reset, err := models.ResetDownloadGrant(grant, extendExpiry != nil && *extendExpiry)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), reset.ID.Hex(), "download grant", reset, nil, ctx)
+	return reset, nil
+}
@@ -28,6 +28,22 @@ func (r *mutationResolver) SingleUploadWithPayload(ctx context.Context, req mode
 	return uploadToGCS(req.File)
 }
 
+//UploadProductDownloadFile uploads a downloadable product file privately, it is only ever served through download grants
+func (r *mutationResolver) UploadProductDownloadFile(ctx context.Context, file graphql.Upload) (*models.File, error) {
+	if cloudstorage.DownloadsBucket == nil {
+		return nil, errors.New("internal server error, downloads bucket is missing")
+	}
+	name := cloudstorage.DownloadsPrefix + uuid.Must(uuid.NewV4()).String() + path.Ext(file.Filename)
+	w := cloudstorage.DownloadsBucket.Object(name).NewWriter(context.Background())
+	w.CacheControl = "private, no-store"
+	err := writeUpload(w, file)
+	if err != nil {
+		return nil, err
+	}
+	//the object name is kept as the file of the product download, there is no url to give out
+	return &models.File{ID: name, Name: file.Filename}, nil
+}
+
 //MultipleUpload gives multiple file uploads
 func (r *mutationResolver) MultipleUpload(ctx context.Context, files []*graphql.Upload) ([]*models.File, error) {
 	if len(files) == 0 {
@@ -94,19 +110,9 @@ func uploadToGCS(file graphql.Upload) (*models.File, error) {
 
 	// Warning: storage.AllUsers gives public read access to anyone.
 	w.ACL = []storage.ACLRule{{Entity: storage.AllUsers, Role: storage.RoleReader}}
-	contentType, err := GetFileContentType(file.File)
-	if err != nil {
-		return nil, err //invalid content type
-	}
-
-	w.ContentType = contentType
 	// Entries are immutable, be aggressive about caching (1 day).
 	w.CacheControl = "public, max-age=86400"
-
-	if _, err := io.Copy(w, file.File); err != nil {
-		return nil, err
-	}
-	if err := w.Close(); err != nil {
+	if err := writeUpload(w, file); err != nil {
 		return nil, err
 	}
 
@@ -120,3 +126,22 @@ func uploadToGCS(file graphql.Upload) (*models.File, error) {
 
 	return uploadedFile, nil
 }
+
+//writeUpload writes an uploaded file to a storage object, sniffing its content type
+func writeUpload(w *storage.Writer, file graphql.Upload) error {
+	contentType, err := GetFileContentType(file.File)
+	if err != nil {
+		return err //invalid content type
+	}
+	if seeker, ok := file.File.(io.Seeker); ok {
+		//rewind past the bytes read to sniff the content type
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	w.ContentType = contentType
+	if _, err := io.Copy(w, file.File); err != nil {
+		return err
+	}
+	return w.Close()
+}
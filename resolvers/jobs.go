@@ -7,12 +7,20 @@ package resolvers
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/audit_log"
 	"github.com/tribehq/platform/models"
+	"github.com/tribehq/platform/utils/auth"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"time"
 )
 
+var (
+	ErrJobNotFound = errors.New("job not found")
+)
+
 //TODO
 //RecentUnpaidJobs gives a list of recent unpaid jobs
 func (r *queryResolver) RecentUnpaidJobs(ctx context.Context, after *string, before *string, first *int, last *int) (*models.RecentUnpaidEarningConnection, error) {
@@ -60,6 +68,31 @@ func (r *queryResolver) Job(ctx context.Context, jobID string) (*models.Job, err
 	return job, nil
 }
 
+//CompleteJob marks a job as completed so both its sides can rate each other
+func (r *mutationResolver) CompleteJob(ctx context.Context, id primitive.ObjectID) (*models.Job, error) {
+	job, err := models.GetJobByID(id.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, ErrJobNotFound
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !models.IsJobParticipant(job, user.ID) && !models.UserHasScope(user.ID.Hex(), "Job:Manage") {
+		return nil, models.ErrNotJobParticipant
+	}
+	completed, err := models.CompleteJob(job)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), completed.ID.Hex(), "job", completed, nil, ctx)
+	return completed, nil
+}
+
 type jobResolver struct{ *Resolver }
 
 func (r *jobResolver) JobType(ctx context.Context, obj *models.Job) (string, error) {
@@ -23,7 +23,7 @@ type orderNoteResolver struct{ *Resolver }
 func (r *queryResolver) OrderNotes(ctx context.Context, id primitive.ObjectID, after *string, before *string, first *int, last *int) (*models.OrderNoteConnection, error) {
 	var items []*models.OrderNote
 	var edges []*models.OrderNoteEdge
-	filter := bson.D{}
+	filter := bson.D{{"orderID", id}}
 	limit := 25
 	items, totalCount, hasPrevious, hasNext, err := models.GetOrderNotes(filter, limit, after, before, first, last)
 	if err != nil {
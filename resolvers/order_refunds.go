@@ -0,0 +1,135 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package resolvers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/audit_log"
+	"github.com/tribehq/platform/models"
+	"github.com/tribehq/platform/utils/auth"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrOrderRefundNotFound = errors.New("order refund not found")
+)
+
+//OrderRefunds gives a list of refunds of an order
+func (r *queryResolver) OrderRefunds(ctx context.Context, orderID primitive.ObjectID, after *string, before *string, first *int, last *int) (*models.OrderRefundConnection, error) {
+	var items []*models.OrderRefund
+	var edges []*models.OrderRefundEdge
+	filter := bson.D{{"orderID", orderID}}
+	limit := 25
+	items, totalCount, hasPrevious, hasNext, err := models.GetOrderRefunds(filter, limit, after, before, first, last)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		edge := &models.OrderRefundEdge{
+			Cursor: base64.StdEncoding.EncodeToString([]byte(item.ID.Hex())),
+			Node:   item,
+		}
+		edges = append(edges, edge)
+	}
+
+	pageInfo := &models.PageInfo{}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = edges[0].Cursor
+		pageInfo.EndCursor = edges[len(edges)-1].Cursor
+		pageInfo.HasNextPage = hasNext
+		pageInfo.HasPreviousPage = hasPrevious
+	}
+
+	itemList := &models.OrderRefundConnection{TotalCount: int(totalCount), Edges: edges, Nodes: items, PageInfo: pageInfo}
+	return itemList, nil
+}
+
+//OrderRefund returns an order refund by ID
+func (r *queryResolver) OrderRefund(ctx context.Context, id primitive.ObjectID) (*models.OrderRefund, error) {
+	orderRefund, err := models.GetOrderRefundByID(id.Hex())
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	if orderRefund == nil {
+		return nil, ErrOrderRefundNotFound
+	}
+	return orderRefund, nil
+}
+
+//RefundOrder refunds an order in full, by amount or by line items
+func (r *mutationResolver) RefundOrder(ctx context.Context, input models.RefundOrderInput) (*models.OrderRefund, error) {
+	order, err := models.GetOrderByID(input.OrderID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	orderRefund, err := models.RequestOrderRefund(order, input, user.ID, user.FirstName+" "+user.LastName)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Created, user.ID.Hex(), orderRefund.ID.Hex(), "order refund", orderRefund, nil, ctx)
+	return orderRefund, nil
+}
+
+//ApproveOrderRefund approves and processes a refund waiting for approval
+func (r *mutationResolver) ApproveOrderRefund(ctx context.Context, id primitive.ObjectID) (*models.OrderRefund, error) {
+	orderRefund, err := models.GetOrderRefundByID(id.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if orderRefund == nil {
+		return nil, ErrOrderRefundNotFound
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	orderRefund, err = models.ApproveOrderRefund(orderRefund, user.ID, user.FirstName+" "+user.LastName)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), orderRefund.ID.Hex(), "order refund", orderRefund, nil, ctx)
+	return orderRefund, nil
+}
+
+//RejectOrderRefund rejects a refund waiting for approval
+func (r *mutationResolver) RejectOrderRefund(ctx context.Context, id primitive.ObjectID, reason *string) (*models.OrderRefund, error) {
+	orderRefund, err := models.GetOrderRefundByID(id.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if orderRefund == nil {
+		return nil, ErrOrderRefundNotFound
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rejectReason := ""
+	if reason != nil {
+		rejectReason = *reason
+	}
+	orderRefund, err = models.RejectOrderRefund(orderRefund, user.ID, rejectReason)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), orderRefund.ID.Hex(), "order refund", orderRefund, nil, ctx)
+	return orderRefund, nil
+}
@@ -7,6 +7,7 @@ package resolvers
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"github.com/jinzhu/copier"
 	log "github.com/sirupsen/logrus"
 	"github.com/tribehq/platform/lib/audit_log"
@@ -18,6 +19,11 @@ import (
 	"time"
 )
 
+var (
+	ErrOrderNotFound = errors.New("order not found")
+	ErrCartNotFound  = errors.New("cart not found")
+)
+
 //Order returns an order by its ID
 func (r *queryResolver) Order(ctx context.Context, id primitive.ObjectID) (*models.Order, error) {
 	order, err := models.GetOrderByID(id.Hex())
@@ -167,18 +173,79 @@ func (r *orderResolver) EarnedAmount(ctx context.Context, obj *models.Order) (fl
 	return obj.EarnedAmount, nil
 }
 
+//ChildOrders gives the per store orders of a parent order
+func (r *orderResolver) ChildOrders(ctx context.Context, obj *models.Order) ([]*models.Order, error) {
+	return models.GetChildOrders(obj), nil
+}
+
+//Checkout places the cart as an order, split into one child order per store
+func (r *mutationResolver) Checkout(ctx context.Context, input models.CheckoutInput) (*models.Order, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cart := models.GetCartByID(input.CartID.Hex())
+	if cart == nil || cart.ID.IsZero() || cart.UserID != user.ID {
+		return nil, ErrCartNotFound
+	}
+	order, err := models.CheckoutCart(cart, input)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Created, user.ID.Hex(), order.ID.Hex(), "order", order, nil, ctx)
+	return order, nil
+}
+
 //CancelOrder cancels orders
-func (r *mutationResolver) CancelOrder(ctx context.Context, orderID primitive.ObjectID) (*bool, error) {
-	order, err := models.GetOrderByID(orderID.String())
+func (r *mutationResolver) CancelOrder(ctx context.Context, orderID primitive.ObjectID, reason *string) (*bool, error) {
+	order, err := models.GetOrderByID(orderID.Hex())
 	if err != nil {
 		return nil, err
 	}
-	orderStatus := order.OrderStatus.IsValid()
+	if order == nil {
+		return utils.PointerBool(false), ErrOrderNotFound
+	}
 	user, err := auth.ForContext(ctx)
 	if err != nil {
 		return nil, err
 	}
+	note := ""
+	if reason != nil {
+		note = *reason
+		order.CancellationAndRefundDetails = *reason
+	}
+	_, err = models.TransitionOrderStatus(order, models.OrderStatusCancelled, user.FirstName+" "+user.LastName, note)
+	if err != nil {
+		return utils.PointerBool(false), err
+	}
 	//Update audit log
 	go audit_log.NewAuditLogWithCtx(models.Cancelled, user.ID.Hex(), orderID.Hex(), "order", nil, nil, ctx)
-	return &orderStatus, nil
+	return utils.PointerBool(true), nil
+}
+
+//UpdateOrderStatus moves an order to the next status of its workflow
+func (r *mutationResolver) UpdateOrderStatus(ctx context.Context, orderID primitive.ObjectID, status models.OrderStatus, note *string) (*models.Order, error) {
+	order, err := models.GetOrderByID(orderID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	orderNote := ""
+	if note != nil {
+		orderNote = *note
+	}
+	order, err = models.TransitionOrderStatus(order, status, user.FirstName+" "+user.LastName, orderNote)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), order.ID.Hex(), "order", order, nil, ctx)
+	return order, nil
 }
@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package resolvers
+
+import (
+	"context"
+	"github.com/tribehq/platform/controllers/payments"
+	"github.com/tribehq/platform/lib/audit_log"
+	"github.com/tribehq/platform/models"
+	"github.com/tribehq/platform/utils/auth"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//PaymentMethods gives the cards and wallets the user saved, the default first
+func (r *queryResolver) PaymentMethods(ctx context.Context) ([]*models.PaymentMethod, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return models.GetUserPaymentMethods(user.ID.Hex())
+}
+
+//SaveCard saves a card the user tokenized with a payment gateway's client library
+func (r *mutationResolver) SaveCard(ctx context.Context, input models.SaveCardInput) (*models.SaveCardPayload, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	gateway := ""
+	if input.Gateway != nil {
+		gateway = *input.Gateway
+	}
+	makeDefault := input.MakeDefault != nil && *input.MakeDefault
+	paymentMethod, duplicate, err := payments.SaveCard(user.ID, gateway, input.PaymentMethodToken, makeDefault)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log, with the saved payment method and never the card details
+	go audit_log.NewAuditLogWithCtx(models.Created, user.ID.Hex(), paymentMethod.ID.Hex(), "payment method", paymentMethod, nil, ctx)
+	return &models.SaveCardPayload{PaymentMethod: paymentMethod, Duplicate: duplicate}, nil
+}
+
+//SetDefaultPaymentMethod makes a saved payment method the user's default
+func (r *mutationResolver) SetDefaultPaymentMethod(ctx context.Context, id primitive.ObjectID) (*models.PaymentMethod, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	paymentMethod, err := models.GetUserPaymentMethod(user.ID.Hex(), id)
+	if err != nil {
+		return nil, err
+	}
+	paymentMethod, err = models.SetDefaultPaymentMethod(paymentMethod)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), paymentMethod.ID.Hex(), "payment method", paymentMethod, nil, ctx)
+	return paymentMethod, nil
+}
+
+//RemovePaymentMethod removes a saved payment method of the user
+func (r *mutationResolver) RemovePaymentMethod(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	paymentMethod, err := models.GetUserPaymentMethod(user.ID.Hex(), id)
+	if err != nil {
+		return false, err
+	}
+	err = models.RemovePaymentMethod(paymentMethod)
+	if err != nil {
+		return false, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Deleted, user.ID.Hex(), paymentMethod.ID.Hex(), "payment method", paymentMethod, nil, ctx)
+	return true, nil
+}
+
+//SetJobPaymentMethod picks the saved payment method the fare of the user's job is charged to
+func (r *mutationResolver) SetJobPaymentMethod(ctx context.Context, jobID primitive.ObjectID, paymentMethodID primitive.ObjectID) (*models.Job, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	job, err := models.GetJobByID(jobID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if job == nil || job.UserID != user.ID.Hex() {
+		return nil, ErrJobNotFound
+	}
+	paymentMethod, err := models.GetUserPaymentMethod(user.ID.Hex(), paymentMethodID)
+	if err != nil {
+		return nil, err
+	}
+	job, err = models.SetJobPaymentMethod(job, paymentMethod)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), job.ID.Hex(), "job", job, nil, ctx)
+	return job, nil
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"github.com/tribehq/platform/controllers/payments"
+	"github.com/tribehq/platform/lib/audit_log"
+	"github.com/tribehq/platform/models"
+	"github.com/tribehq/platform/utils/auth"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrPaymentTargetRequired = errors.New("an order or a job to pay is required")
+	ErrAlreadyPaid           = errors.New("already paid")
+	ErrInvalidAddMoneyAmount = errors.New("amount to add must be more than zero")
+)
+
+//CreateRazorpayOrder creates the razorpay order the customer pays an order or job with in razorpay checkout
+func (r *mutationResolver) CreateRazorpayOrder(ctx context.Context, input models.CreateRazorpayOrderInput) (*models.RazorpayOrder, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	request, err := paymentRequestFor(user, input.OrderID, input.JobID)
+	if err != nil {
+		return nil, err
+	}
+	razorpayOrder, err := payments.CreateRazorpayOrder(request)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Created, user.ID.Hex(), razorpayOrder.ID, "razorpay order", razorpayOrder, nil, ctx)
+	return razorpayOrder, nil
+}
+
+//VerifyRazorpayPayment verifies and records a payment made in razorpay checkout
+func (r *mutationResolver) VerifyRazorpayPayment(ctx context.Context, input models.VerifyRazorpayPaymentInput) (bool, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	err = payments.VerifyRazorpayPayment(input.RazorpayOrderID, input.RazorpayPaymentID, input.RazorpaySignature)
+	if err != nil {
+		return false, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), input.RazorpayPaymentID, "razorpay payment", input, nil, ctx)
+	return true, nil
+}
+
+//LinkedWallets gives the wallets the user has linked at wallet providers
+func (r *queryResolver) LinkedWallets(ctx context.Context) ([]*models.LinkedWallet, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return models.GetLinkedWallets(user.ID)
+}
+
+//PaytmWalletBalance gives the balance of the user's linked paytm wallet
+func (r *queryResolver) PaytmWalletBalance(ctx context.Context, amount float64) (*models.PaytmWalletBalance, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return payments.PaytmWalletBalance(user.ID, amount)
+}
+
+//SendPaytmOtp sends the otp that links the user's paytm wallet
+func (r *mutationResolver) SendPaytmOtp(ctx context.Context, mobile string) (bool, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	err = payments.SendPaytmOTP(user.ID, mobile)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+//LinkPaytmWallet links the user's paytm wallet with the otp paytm sent them
+func (r *mutationResolver) LinkPaytmWallet(ctx context.Context, otp string) (*models.LinkedWallet, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	wallet, err := payments.LinkPaytmWallet(user.ID, otp)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Created, user.ID.Hex(), wallet.ID.Hex(), "linked wallet", wallet, nil, ctx)
+	return wallet, nil
+}
+
+//UnlinkPaytmWallet unlinks the user's paytm wallet
+func (r *mutationResolver) UnlinkPaytmWallet(ctx context.Context) (bool, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	err = payments.UnlinkPaytmWallet(user.ID)
+	if err != nil {
+		return false, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Deleted, user.ID.Hex(), user.ID.Hex(), "linked wallet", payments.PaytmGatewayName, nil, ctx)
+	return true, nil
+}
+
+//AddMoneyToPaytmWallet gives the form that takes the user to paytm to add money to their linked wallet
+func (r *mutationResolver) AddMoneyToPaytmWallet(ctx context.Context, amount float64) (*models.PaytmAddMoneyForm, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if amount <= 0 {
+		return nil, ErrInvalidAddMoneyAmount
+	}
+	return payments.AddMoneyToPaytmWallet(user.ID, amount)
+}
+
+//PayWithPaytmWallet pays the user's order or job from their linked paytm wallet
+func (r *mutationResolver) PayWithPaytmWallet(ctx context.Context, input models.PayWithPaytmWalletInput) (bool, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return false, err
+	}
+	request, err := paymentRequestFor(user, input.OrderID, input.JobID)
+	if err != nil {
+		return false, err
+	}
+	err = payments.PayWithPaytmWallet(user.ID, request)
+	if err != nil {
+		return false, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Created, user.ID.Hex(), request.Reference, "paytm wallet payment", input, nil, ctx)
+	return true, nil
+}
+
+//paymentRequestFor describes the payment of the user's order or job, one of the two, that is still waiting to be paid,
+//referenced as a new attempt to pay it
+func paymentRequestFor(user *models.User, orderID *primitive.ObjectID, jobID *primitive.ObjectID) (payments.PaymentRequest, error) {
+	switch {
+	case orderID != nil:
+		order, err := models.GetOrderByID(orderID.Hex())
+		if err != nil {
+			return payments.PaymentRequest{}, err
+		}
+		if order == nil || order.CustomerID != user.ID || !order.ParentID.IsZero() {
+			return payments.PaymentRequest{}, ErrOrderNotFound
+		}
+		if order.OrderStatus != models.OrderStatusPendingPayment || !order.DatePaid.IsZero() {
+			return payments.PaymentRequest{}, ErrAlreadyPaid
+		}
+		request := payments.PaymentRequest{
+			Reference: payments.PaymentAttemptReference(order.ID.Hex()),
+			OrderID:   order.ID.Hex(),
+			Amount:    order.OrderTotalAmount,
+			Currency:  order.Currency.CurrencyCode,
+			Capture:   true,
+		}
+		if !order.StoreID.IsZero() {
+			request.StoreID = order.StoreID.Hex()
+		}
+		return request, nil
+	case jobID != nil:
+		job, err := models.GetJobByID(jobID.Hex())
+		if err != nil {
+			return payments.PaymentRequest{}, err
+		}
+		if job == nil || job.UserID != user.ID.Hex() {
+			return payments.PaymentRequest{}, ErrJobNotFound
+		}
+		if job.PaymentStatus != nil && *job.PaymentStatus == models.JobPaymentStatusPaid {
+			return payments.PaymentRequest{}, ErrAlreadyPaid
+		}
+		amount, currency, err := models.JobFareDue(job)
+		if err != nil {
+			return payments.PaymentRequest{}, err
+		}
+		return payments.PaymentRequest{
+			Reference: payments.PaymentAttemptReference(job.ID.Hex()),
+			JobID:     job.ID.Hex(),
+			Amount:    amount,
+			Currency:  currency,
+			Capture:   true,
+		}, nil
+	}
+	return payments.PaymentRequest{}, ErrPaymentTargetRequired
+}
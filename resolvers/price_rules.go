@@ -0,0 +1,130 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package resolvers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/audit_log"
+	"github.com/tribehq/platform/models"
+	"github.com/tribehq/platform/utils/auth"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+var (
+	ErrPriceRuleNotFound = errors.New("price rule not found")
+)
+
+//PriceRules gives a list of price rules
+func (r *queryResolver) PriceRules(ctx context.Context, storeID *primitive.ObjectID, status *models.PriceRuleStatus, after *string, before *string, first *int, last *int) (*models.PriceRuleConnection, error) {
+	var items []*models.PriceRule
+	var edges []*models.PriceRuleEdge
+	filter := bson.D{}
+	if storeID != nil {
+		filter = append(filter, bson.E{"store", storeID.Hex()})
+	}
+	if status != nil {
+		filter = append(filter, bson.E{"status", *status})
+	}
+	limit := 25
+	items, totalCount, hasPrevious, hasNext, err := models.GetPriceRules(filter, limit, after, before, first, last)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		edge := &models.PriceRuleEdge{
+			Cursor: base64.StdEncoding.EncodeToString([]byte(item.ID.Hex())),
+			Node:   item,
+		}
+		edges = append(edges, edge)
+	}
+
+	pageInfo := &models.PageInfo{}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = edges[0].Cursor
+		pageInfo.EndCursor = edges[len(edges)-1].Cursor
+		pageInfo.HasNextPage = hasNext
+		pageInfo.HasPreviousPage = hasPrevious
+	}
+
+	itemList := &models.PriceRuleConnection{TotalCount: int(totalCount), Edges: edges, Nodes: items, PageInfo: pageInfo}
+	return itemList, nil
+}
+
+//PriceRule returns a price rule by ID
+func (r *queryResolver) PriceRule(ctx context.Context, id primitive.ObjectID) (*models.PriceRule, error) {
+	priceRule, err := models.GetPriceRuleByID(id.Hex())
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	if priceRule == nil {
+		return nil, ErrPriceRuleNotFound
+	}
+	return priceRule, nil
+}
+
+//AddPriceRule marks down the products of a category or collection
+func (r *mutationResolver) AddPriceRule(ctx context.Context, input models.AddPriceRuleInput) (*models.PriceRule, error) {
+	store := models.GetStoreByID(input.StoreID.Hex())
+	if store == nil || store.ID.IsZero() {
+		return nil, ErrStoreNotFound
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	priceRule := models.PriceRule{
+		CreatedBy:  user.ID,
+		Store:      store.ID.Hex(),
+		Name:       input.Name,
+		Target:     input.Target,
+		TargetID:   input.TargetID,
+		Percentage: input.Percentage,
+		EndsAt:     input.EndsAt,
+	}
+	if input.StartsAt != nil {
+		priceRule.StartsAt = *input.StartsAt
+	}
+	created, err := models.CreatePriceRule(priceRule)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Created, user.ID.Hex(), created.ID.Hex(), "price rule", created, nil, ctx)
+	return created, nil
+}
+
+//RollbackPriceRule puts back the sale prices the products of a price rule had before
+func (r *mutationResolver) RollbackPriceRule(ctx context.Context, id primitive.ObjectID) (*models.PriceRule, error) {
+	priceRule, err := models.GetPriceRuleByID(id.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if priceRule == nil {
+		return nil, ErrPriceRuleNotFound
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rolledBack, err := models.RollbackPriceRule(priceRule)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), rolledBack.ID.Hex(), "price rule", rolledBack, nil, ctx)
+	return rolledBack, nil
+}
+
+//SyncScheduledSales starts and ends the scheduled sales that are due
+func (r *mutationResolver) SyncScheduledSales(ctx context.Context) (int, error) {
+	return models.SyncScheduledSales(time.Now())
+}
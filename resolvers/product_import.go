@@ -0,0 +1,125 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package resolvers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"github.com/99designs/gqlgen/graphql"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/audit_log"
+	"github.com/tribehq/platform/models"
+	"github.com/tribehq/platform/utils/auth"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+const maxProductCSVSize = 20 << 20
+
+var (
+	ErrProductImportJobNotFound = errors.New("product import job not found")
+	ErrProductCSVTooLarge       = errors.New("product csv file is larger than 20MB")
+)
+
+//ProductImportJobs gives a list of product import jobs
+func (r *queryResolver) ProductImportJobs(ctx context.Context, storeID *primitive.ObjectID, after *string, before *string, first *int, last *int) (*models.ProductImportJobConnection, error) {
+	var items []*models.ProductImportJob
+	var edges []*models.ProductImportJobEdge
+	filter := bson.D{}
+	if storeID != nil {
+		filter = append(filter, bson.E{"store", storeID.Hex()})
+	}
+	limit := 25
+	items, totalCount, hasPrevious, hasNext, err := models.GetProductImportJobs(filter, limit, after, before, first, last)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		edge := &models.ProductImportJobEdge{
+			Cursor: base64.StdEncoding.EncodeToString([]byte(item.ID.Hex())),
+			Node:   item,
+		}
+		edges = append(edges, edge)
+	}
+
+	pageInfo := &models.PageInfo{}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = edges[0].Cursor
+		pageInfo.EndCursor = edges[len(edges)-1].Cursor
+		pageInfo.HasNextPage = hasNext
+		pageInfo.HasPreviousPage = hasPrevious
+	}
+
+	itemList := &models.ProductImportJobConnection{TotalCount: int(totalCount), Edges: edges, Nodes: items, PageInfo: pageInfo}
+	return itemList, nil
+}
+
+//ProductImportJob returns a product import job and its progress by ID
+func (r *queryResolver) ProductImportJob(ctx context.Context, id primitive.ObjectID) (*models.ProductImportJob, error) {
+	job, err := models.GetProductImportJobByID(id.Hex())
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	if job == nil {
+		return nil, ErrProductImportJobNotFound
+	}
+	return job, nil
+}
+
+//ImportProducts starts importing a WooCommerce product CSV file into a store
+func (r *mutationResolver) ImportProducts(ctx context.Context, storeID primitive.ObjectID, file graphql.Upload, dryRun *bool) (*models.ProductImportJob, error) {
+	store := models.GetStoreByID(storeID.Hex())
+	if store == nil || store.ID.IsZero() {
+		return nil, ErrStoreNotFound
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(file.File, maxProductCSVSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxProductCSVSize {
+		return nil, ErrProductCSVTooLarge
+	}
+	job := models.ProductImportJob{
+		CreatedBy: user.ID,
+		Store:     store.ID.Hex(),
+		FileName:  file.Filename,
+		DryRun:    dryRun != nil && *dryRun,
+	}
+	created, err := models.CreateProductImportJob(job)
+	if err != nil {
+		return nil, err
+	}
+	running := *created
+	go models.RunProductImport(&running, data)
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Created, user.ID.Hex(), created.ID.Hex(), "product import job", created, nil, ctx)
+	return created, nil
+}
+
+//ExportProducts exports the products of a store as a WooCommerce product CSV file
+func (r *mutationResolver) ExportProducts(ctx context.Context, storeID primitive.ObjectID) (*models.File, error) {
+	store := models.GetStoreByID(storeID.Hex())
+	if store == nil || store.ID.IsZero() {
+		return nil, ErrStoreNotFound
+	}
+	var buf bytes.Buffer
+	err := models.ExportProductsCSV(store.ID.Hex(), &buf)
+	if err != nil {
+		return nil, err
+	}
+	fileName := "products-" + store.ID.Hex() + "-" + time.Now().Format("2006-01-02") + ".csv"
+	return uploadToGCS(graphql.Upload{File: bytes.NewReader(buf.Bytes()), Filename: fileName, Size: int64(buf.Len())})
+}
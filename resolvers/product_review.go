@@ -7,6 +7,7 @@ package resolvers
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"github.com/jinzhu/copier"
 	"github.com/tribehq/platform/lib/audit_log"
 	"github.com/tribehq/platform/models"
@@ -15,13 +16,24 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+var (
+	ErrProductReviewNotFound        = errors.New("product review not found")
+	ErrProductReviewNotOwned        = errors.New("product review can only be changed by its reviewer")
+	ErrProductReviewStatusForbidden = errors.New("only moderators can list reviews that are not approved")
+)
+
 func (r *mutationResolver) AddProductReview(ctx context.Context, input models.AddProductReviewInput) (*models.ProductReview, error) {
 	productReview := &models.ProductReview{}
 	_ = copier.Copy(&productReview, &input)
+	productID, err := primitive.ObjectIDFromHex(input.ProductID)
+	if err != nil {
+		return nil, ErrProductNotFound
+	}
 	user, err := auth.ForContext(ctx)
 	if err != nil {
 		return nil, err
 	}
+	productReview.ProductID = productID
 	productReview.CreatedBy = user.ID
 	productReview, err = models.CreateProductReview(*productReview)
 	if err != nil {
@@ -35,13 +47,24 @@ func (r *mutationResolver) AddProductReview(ctx context.Context, input models.Ad
 func (r *mutationResolver) UpdateProductReview(ctx context.Context, input models.UpdateProductReviewInput) (*models.ProductReview, error) {
 	productReview := &models.ProductReview{}
 	productReview = models.GetProductReviewByID(input.ID.Hex())
-	_ = copier.Copy(&productReview, &input)
+	if productReview == nil {
+		return nil, ErrProductReviewNotFound
+	}
 	user, err := auth.ForContext(ctx)
 	if err != nil {
 		return nil, err
 	}
-	productReview.CreatedBy = user.ID
-	productReview = models.UpdateProductReview(productReview)
+	if productReview.CreatedBy != user.ID && !models.UserHasScope(user.ID.Hex(), "ProductReview:Moderate") {
+		return nil, ErrProductReviewNotOwned
+	}
+	productID, createdBy := productReview.ProductID, productReview.CreatedBy
+	_ = copier.Copy(&productReview, &input)
+	productReview.ProductID, productReview.CreatedBy = productID, createdBy
+	if input.Rating < 1 || input.Rating > 5 {
+		return nil, models.ErrInvalidReviewRating
+	}
+	//an edited review is moderated again
+	productReview = models.ResubmitProductReview(productReview)
 	//Update audit log
 	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), productReview.ID.Hex(), "product review", productReview, nil, ctx)
 	return productReview, nil
@@ -65,10 +88,47 @@ func (r *mutationResolver) DeleteProductReview(ctx context.Context, id primitive
 	return &res, err
 }
 
-func (r *queryResolver) ProductReviews(ctx context.Context, productReviewID *primitive.ObjectID, after *string, before *string, first *int, last *int) (*models.ProductReviewConnection, error) {
+//ModerateProductReview approves, rejects or marks a product review as spam
+func (r *mutationResolver) ModerateProductReview(ctx context.Context, id primitive.ObjectID, action models.ReviewModerationAction) (*models.ProductReview, error) {
+	productReview := models.GetProductReviewByID(id.Hex())
+	if productReview == nil {
+		return nil, ErrProductReviewNotFound
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	productReview = models.ModerateProductReview(productReview, action, user.ID)
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), productReview.ID.Hex(), "product review", productReview, nil, ctx)
+	return productReview, nil
+}
+
+func (r *queryResolver) ProductReviews(ctx context.Context, productReviewID *primitive.ObjectID, productID *primitive.ObjectID, storeID *primitive.ObjectID, status *models.ProductReviewStatus, after *string, before *string, first *int, last *int) (*models.ProductReviewConnection, error) {
 	var items []*models.ProductReview
 	var edges []*models.ProductReviewEdge
 	filter := bson.D{}
+	if productID != nil {
+		filter = append(filter, bson.E{"productID", *productID})
+	}
+	if storeID != nil {
+		filter = append(filter, bson.E{"store", storeID.Hex()})
+	}
+	//only approved reviews are listed unless a moderator asks for another status
+	reviewStatus := models.ProductReviewStatusApproved
+	if status != nil {
+		reviewStatus = *status
+	}
+	if reviewStatus != models.ProductReviewStatusApproved {
+		user, err := auth.ForContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !models.UserHasScope(user.ID.Hex(), "ProductReview:Moderate") {
+			return nil, ErrProductReviewStatusForbidden
+		}
+	}
+	filter = append(filter, bson.E{"status", reviewStatus})
 	limit := 25
 
 	items, totalCount, hasPrevious, hasNext, err := models.GetProductReviews(filter, limit, after, before, first, last)
@@ -84,7 +144,13 @@ func (r *queryResolver) ProductReviews(ctx context.Context, productReviewID *pri
 		edges = append(edges, edge)
 	}
 
-	pageInfo := getPageInfo(edges[0].Cursor, edges[len(edges)-1].Cursor, len(edges), hasNext, hasPrevious)
+	pageInfo := &models.PageInfo{}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = edges[0].Cursor
+		pageInfo.EndCursor = edges[len(edges)-1].Cursor
+		pageInfo.HasNextPage = hasNext
+		pageInfo.HasPreviousPage = hasPrevious
+	}
 
 	ProductReviewList := &models.ProductReviewConnection{TotalCount: int(totalCount), Edges: edges, Nodes: items, PageInfo: pageInfo}
 	return ProductReviewList, nil
@@ -92,5 +158,18 @@ func (r *queryResolver) ProductReviews(ctx context.Context, productReviewID *pri
 
 func (r *queryResolver) ProductReview(ctx context.Context, id primitive.ObjectID) (*models.ProductReview, error) {
 	productReview := models.GetProductReviewByID(id.Hex())
+	if productReview == nil {
+		return nil, ErrProductReviewNotFound
+	}
+	//reviews still in moderation are only shown to their reviewer and moderators
+	if productReview.Status != models.ProductReviewStatusApproved {
+		user, err := auth.ForContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if productReview.CreatedBy != user.ID && !models.UserHasScope(user.ID.Hex(), "ProductReview:Moderate") {
+			return nil, ErrProductReviewNotFound
+		}
+	}
 	return productReview, nil
 }
@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package resolvers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"github.com/tribehq/platform/models"
+	"github.com/tribehq/platform/utils/auth"
+	"strconv"
+)
+
+var (
+	ErrInvalidSearchCursor   = errors.New("invalid search cursor")
+	ErrSearchHiddenForbidden = errors.New("only product admins can search hidden products")
+)
+
+//SearchProducts gives the products matching a search ordered by relevance along with the facet counts of all matches
+func (r *queryResolver) SearchProducts(ctx context.Context, query *string, filter *models.ProductSearchFilter, after *string, first *int) (*models.ProductSearchConnection, error) {
+	limit := 25
+	if first != nil && *first > 0 && *first <= 100 {
+		limit = *first
+	}
+	//search cursors are the position of a hit in the results
+	offset := 0
+	if after != nil {
+		position, err := base64.StdEncoding.DecodeString(*after)
+		if err != nil {
+			return nil, ErrInvalidSearchCursor
+		}
+		offset, err = strconv.Atoi(string(position))
+		if err != nil || offset < 0 {
+			return nil, ErrInvalidSearchCursor
+		}
+	}
+	//hidden products are only shown to those who manage products
+	if filter != nil && filter.IncludeHidden != nil && *filter.IncludeHidden {
+		user, err := auth.ForContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !models.UserHasScope(user.ID.Hex(), "Product:Update") {
+			return nil, ErrSearchHiddenForbidden
+		}
+	}
+	text := ""
+	if query != nil {
+		text = *query
+	}
+	search, err := models.SearchProducts(text, filter, offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	var edges []*models.ProductSearchEdge
+	var items []*models.Product
+	for i, hit := range search.Hits {
+		edge := &models.ProductSearchEdge{
+			Cursor: base64.StdEncoding.EncodeToString([]byte(strconv.Itoa(offset + i + 1))),
+			Node:   hit.Product,
+			Score:  hit.Score,
+		}
+		edges = append(edges, edge)
+		items = append(items, hit.Product)
+	}
+
+	pageInfo := &models.PageInfo{}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = edges[0].Cursor
+		pageInfo.EndCursor = edges[len(edges)-1].Cursor
+		pageInfo.HasNextPage = offset+limit < search.TotalCount
+		pageInfo.HasPreviousPage = offset > 0
+	}
+
+	itemList := &models.ProductSearchConnection{
+		TotalCount:     search.TotalCount,
+		Edges:          edges,
+		Nodes:          items,
+		PageInfo:       pageInfo,
+		Facets:         search.Facets,
+		CorrectedQuery: search.CorrectedQuery,
+	}
+	return itemList, nil
+}
+
+//ReindexProducts rebuilds the product search index
+func (r *mutationResolver) ReindexProducts(ctx context.Context) (int, error) {
+	return models.ReindexProducts()
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/tribehq/platform/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"regexp"
 	"time"
 )
 
@@ -54,6 +55,28 @@ func (r *queryResolver) StorePaymentReports(ctx context.Context, fromDate *time.
 	var items []*models.StorePaymentReport
 	var edges []*models.StorePaymentReportEdge
 	filter := bson.D{}
+	orderDate := bson.M{}
+	if fromDate != nil {
+		orderDate["$gte"] = *fromDate
+	}
+	if toDate != nil {
+		orderDate["$lte"] = *toDate
+	}
+	if len(orderDate) > 0 {
+		filter = append(filter, bson.E{"orderDate", orderDate})
+	}
+	if storeSearch != nil && *storeSearch != "" {
+		filter = append(filter, bson.E{"$or", bson.A{bson.M{"selectStore": *storeSearch}, bson.M{"storeName": primitive.Regex{Pattern: regexp.QuoteMeta(*storeSearch), Options: "i"}}}})
+	}
+	if serviceType != nil && *serviceType != "" {
+		filter = append(filter, bson.E{"serviceType", *serviceType})
+	}
+	if paymentStatus != nil {
+		filter = append(filter, bson.E{"paymentStatus", *paymentStatus})
+	}
+	if text != nil && *text != "" {
+		filter = append(filter, bson.E{"orderNumber", *text})
+	}
 	limit := 25
 	items, totalCount, hasPrevious, hasNext, err := models.GetStorePaymentReports(filter, limit, after, before, first, last)
 	if err != nil {
@@ -68,7 +91,13 @@ func (r *queryResolver) StorePaymentReports(ctx context.Context, fromDate *time.
 		edges = append(edges, edge)
 	}
 
-	pageInfo := getPageInfo(edges[0].Cursor, edges[len(edges)-1].Cursor, len(edges), hasNext, hasPrevious)
+	pageInfo := &models.PageInfo{}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = edges[0].Cursor
+		pageInfo.EndCursor = edges[len(edges)-1].Cursor
+		pageInfo.HasNextPage = hasNext
+		pageInfo.HasPreviousPage = hasPrevious
+	}
 
 	itemList := &models.StorePaymentReportConnection{TotalCount: int(totalCount), Edges: edges, Nodes: items, PageInfo: pageInfo}
 	return itemList, nil
@@ -89,6 +118,25 @@ func (r *queryResolver) ProviderPaymentReports(ctx context.Context, fromDate *ti
 	var items []*models.ProviderPaymentReport
 	var edges []*models.ProviderPaymentReportEdge
 	filter := bson.D{}
+	if fromDate != nil {
+		filter = append(filter, bson.E{"periodEnd", bson.M{"$gt": *fromDate}})
+	}
+	if toDate != nil {
+		filter = append(filter, bson.E{"periodStart", bson.M{"$lte": *toDate}})
+	}
+	if provider != nil && *provider != "" {
+		providerID, err := primitive.ObjectIDFromHex(*provider)
+		if err != nil {
+			return nil, err
+		}
+		filter = append(filter, bson.E{"providerID", providerID})
+	}
+	if paymentStatus != nil {
+		filter = append(filter, bson.E{"providerPaymentStatus", string(*paymentStatus)})
+	}
+	if text != nil && *text != "" {
+		filter = append(filter, bson.E{"providerName", primitive.Regex{Pattern: regexp.QuoteMeta(*text), Options: "i"}})
+	}
 	limit := 25
 	items, totalCount, hasPrevious, hasNext, err := models.GetProviderPaymentReports(filter, limit, after, before, first, last)
 	if err != nil {
@@ -103,7 +151,13 @@ func (r *queryResolver) ProviderPaymentReports(ctx context.Context, fromDate *ti
 		edges = append(edges, edge)
 	}
 
-	pageInfo := getPageInfo(edges[0].Cursor, edges[len(edges)-1].Cursor, len(edges), hasNext, hasPrevious)
+	pageInfo := &models.PageInfo{}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = edges[0].Cursor
+		pageInfo.EndCursor = edges[len(edges)-1].Cursor
+		pageInfo.HasNextPage = hasNext
+		pageInfo.HasPreviousPage = hasPrevious
+	}
 
 	itemList := &models.ProviderPaymentReportConnection{TotalCount: int(totalCount), Edges: edges, Nodes: items, PageInfo: pageInfo}
 	return itemList, nil
@@ -7,6 +7,7 @@ package resolvers
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"github.com/jinzhu/copier"
 	log "github.com/sirupsen/logrus"
 	"github.com/tribehq/platform/lib/audit_log"
@@ -18,6 +19,10 @@ import (
 	"time"
 )
 
+var (
+	ErrReviewNotFound = errors.New("review not found")
+)
+
 //StoreReviews gives a list of store reviews
 func (r *queryResolver) StoreReviews(ctx context.Context, storeReviewType *models.StoreReviewType, text *string, after *string, before *string, first *int, last *int) (*models.StoreReviewConnection, error) {
 	var items []*models.StoreReview
@@ -196,10 +201,17 @@ func (r *mutationResolver) AddReview(ctx context.Context, input models.AddReview
 
 //UpdateReview updates an existing review
 func (r *mutationResolver) UpdateReview(ctx context.Context, input models.UpdateReviewInput) (*models.Review, error) {
-	review := &models.Review{}
-	_ = copier.Copy(&review, &input)
+	review, err := models.GetReviewByID(input.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if review == nil {
+		return nil, ErrReviewNotFound
+	}
+	//the averages and rating times are kept by the server
+	_ = copier.Copy(review, &input)
 	review.UpdatedAt = time.Now()
-	review, err := models.UpdateReview(review)
+	review, err = models.UpdateReview(review)
 	if err != nil {
 		return nil, err
 	}
@@ -213,6 +225,32 @@ func (r *mutationResolver) UpdateReview(ctx context.Context, input models.Update
 	return review, nil
 }
 
+//RateJob rates the other side of a completed job for the user or provider of the job
+func (r *mutationResolver) RateJob(ctx context.Context, input models.RateJobInput) (*models.Review, error) {
+	job, err := models.GetJobByID(input.JobID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, ErrJobNotFound
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	comment := ""
+	if input.Comment != nil {
+		comment = *input.Comment
+	}
+	review, err := models.RateJob(job, user.ID, input.Rating, comment)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), review.ID.Hex(), "review", review, nil, ctx)
+	return review, nil
+}
+
 //DeleteReview deletes an existing review
 func (r *mutationResolver) DeleteReview(ctx context.Context, id primitive.ObjectID) (*bool, error) {
 	res, err := models.DeleteReviewByID(id.Hex())
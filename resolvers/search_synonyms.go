@@ -0,0 +1,122 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package resolvers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"github.com/jinzhu/copier"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/audit_log"
+	"github.com/tribehq/platform/models"
+	"github.com/tribehq/platform/utils/auth"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrSearchSynonymNotFound = errors.New("search synonym not found")
+)
+
+//SearchSynonyms gives a list of search synonyms
+func (r *queryResolver) SearchSynonyms(ctx context.Context, after *string, before *string, first *int, last *int) (*models.SearchSynonymConnection, error) {
+	var items []*models.SearchSynonym
+	var edges []*models.SearchSynonymEdge
+	filter := bson.D{}
+	limit := 25
+	items, totalCount, hasPrevious, hasNext, err := models.GetSearchSynonyms(filter, limit, after, before, first, last)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		edge := &models.SearchSynonymEdge{
+			Cursor: base64.StdEncoding.EncodeToString([]byte(item.ID.Hex())),
+			Node:   item,
+		}
+		edges = append(edges, edge)
+	}
+
+	pageInfo := &models.PageInfo{}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = edges[0].Cursor
+		pageInfo.EndCursor = edges[len(edges)-1].Cursor
+		pageInfo.HasNextPage = hasNext
+		pageInfo.HasPreviousPage = hasPrevious
+	}
+
+	itemList := &models.SearchSynonymConnection{TotalCount: int(totalCount), Edges: edges, Nodes: items, PageInfo: pageInfo}
+	return itemList, nil
+}
+
+//SearchSynonym returns a search synonym by ID
+func (r *queryResolver) SearchSynonym(ctx context.Context, id primitive.ObjectID) (*models.SearchSynonym, error) {
+	searchSynonym, err := models.GetSearchSynonymByID(id.Hex())
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	if searchSynonym == nil {
+		return nil, ErrSearchSynonymNotFound
+	}
+	return searchSynonym, nil
+}
+
+//AddSearchSynonym adds a new search synonym
+func (r *mutationResolver) AddSearchSynonym(ctx context.Context, input models.AddSearchSynonymInput) (*models.SearchSynonym, error) {
+	searchSynonym := &models.SearchSynonym{}
+	_ = copier.Copy(&searchSynonym, &input)
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	searchSynonym.CreatedBy = user.ID
+	searchSynonym, err = models.CreateSearchSynonym(*searchSynonym)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Created, user.ID.Hex(), searchSynonym.ID.Hex(), "search synonym", searchSynonym, nil, ctx)
+	return searchSynonym, nil
+}
+
+//UpdateSearchSynonym updates an existing search synonym
+func (r *mutationResolver) UpdateSearchSynonym(ctx context.Context, input models.UpdateSearchSynonymInput) (*models.SearchSynonym, error) {
+	searchSynonym, err := models.GetSearchSynonymByID(input.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if searchSynonym == nil {
+		return nil, ErrSearchSynonymNotFound
+	}
+	_ = copier.Copy(&searchSynonym, &input)
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	searchSynonym, err = models.UpdateSearchSynonym(searchSynonym)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), searchSynonym.ID.Hex(), "search synonym", searchSynonym, nil, ctx)
+	return searchSynonym, nil
+}
+
+//DeleteSearchSynonym deletes an existing search synonym
+func (r *mutationResolver) DeleteSearchSynonym(ctx context.Context, id primitive.ObjectID) (*bool, error) {
+	res, err := models.DeleteSearchSynonymByID(id.Hex())
+	if err != nil {
+		return nil, err
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Deleted, user.ID.Hex(), id.Hex(), "search synonym", nil, nil, ctx)
+	return &res, nil
+}
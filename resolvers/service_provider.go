@@ -131,10 +131,13 @@ func (r *serviceProviderResolver) BankAccountDetails(ctx context.Context, obj *m
 }
 
 //ServiceProviders gives a list of service provider
-func (r *queryResolver) ServiceProviders(ctx context.Context, searchProvidersType *models.SearchProviderType, text *string, providerStatus *models.ProviderStatus, after *string, before *string, first *int, last *int) (*models.ServiceProviderConnection, error) {
+func (r *queryResolver) ServiceProviders(ctx context.Context, searchProvidersType *models.SearchProviderType, text *string, providerStatus *models.ProviderStatus, qualityFlagged *bool, after *string, before *string, first *int, last *int) (*models.ServiceProviderConnection, error) {
 	var items []*models.ServiceProvider
 	var edges []*models.ServiceProviderEdge
 	filter := bson.D{}
+	if qualityFlagged != nil {
+		filter = append(filter, bson.E{"rating.qualityFlagged", *qualityFlagged})
+	}
 	limit := 25
 	items, totalCount, hasPrevious, hasNext, err := models.GetServiceProviders(filter, limit, after, before, first, last)
 	if err != nil {
@@ -149,7 +152,13 @@ func (r *queryResolver) ServiceProviders(ctx context.Context, searchProvidersTyp
 		edges = append(edges, edge)
 	}
 
-	pageInfo := getPageInfo(edges[0].Cursor, edges[len(edges)-1].Cursor, len(edges), hasNext, hasPrevious)
+	pageInfo := &models.PageInfo{}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = edges[0].Cursor
+		pageInfo.EndCursor = edges[len(edges)-1].Cursor
+		pageInfo.HasNextPage = hasNext
+		pageInfo.HasPreviousPage = hasPrevious
+	}
 
 	itemList := &models.ServiceProviderConnection{TotalCount: int(totalCount), Edges: edges, Nodes: items, PageInfo: pageInfo}
 	return itemList, nil
@@ -371,3 +380,23 @@ func (r *mutationResolver) ServiceProviderSignUp(ctx context.Context, input mode
 	return provider, nil
 
 }
+
+//ClearServiceProviderQualityFlag clears the quality flag of a service provider once ops reviewed it
+func (r *mutationResolver) ClearServiceProviderQualityFlag(ctx context.Context, id primitive.ObjectID) (*models.ServiceProvider, error) {
+	serviceProvider := models.GetServiceProviderByID(id.Hex())
+	if serviceProvider.ID.IsZero() {
+		return nil, ErrServiceProviderNotFound
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	models.ReviewQualityFlag(&serviceProvider.Rating, user.ID)
+	serviceProvider, err = models.UpdateServiceProvider(serviceProvider)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), id.Hex(), "service provider quality flag", serviceProvider.Rating, nil, ctx)
+	return serviceProvider, nil
+}
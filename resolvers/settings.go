@@ -19,7 +19,12 @@ import (
 
 //MarketSettings gives a list of market settings
 func (r *queryResolver) MarketSettings(ctx context.Context) (*models.MarketSettings, error) {
-	return nil, nil
+	marketSettings, err := models.GetCurrentMarketSettings()
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	return marketSettings, nil
 }
 
 //MarketSetting returns a market setting by ID
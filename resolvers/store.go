@@ -72,7 +72,11 @@ func (r *mutationResolver) AddStore(ctx context.Context, input models.AddStoreIn
 func (r *mutationResolver) UpdateStore(ctx context.Context, input models.UpdateStoreInput) (*models.Store, error) {
 	store := &models.Store{}
 	store = models.GetStoreByID(input.ID.Hex())
+	metadata := store.Metadata
 	_ = copier.Copy(&store, &input)
+	if input.Metadata == nil {
+		store.Metadata = metadata
+	}
 	user, err := auth.ForContext(ctx)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,90 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"github.com/tribehq/platform/lib/audit_log"
+	"github.com/tribehq/platform/models"
+	"github.com/tribehq/platform/utils/auth"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+var (
+	ErrStoreNotFound         = errors.New("store not found")
+	ErrStoreLocationNotFound = errors.New("store location not found")
+)
+
+//IsOpen tells whether the store takes orders right now
+func (r *storeResolver) IsOpen(ctx context.Context, obj *models.Store) (bool, error) {
+	return models.GetStoreHours(obj).IsOpenAt(time.Now()), nil
+}
+
+//NextOpeningAt gives when a closed store opens next
+func (r *storeResolver) NextOpeningAt(ctx context.Context, obj *models.Store) (*time.Time, error) {
+	return models.GetStoreHours(obj).NextOpeningAt(time.Now()), nil
+}
+
+//DeliverySlots gives the delivery slots of a store on a day
+func (r *queryResolver) DeliverySlots(ctx context.Context, storeID primitive.ObjectID, date time.Time) ([]*models.DeliverySlotAvailability, error) {
+	store := models.GetStoreByID(storeID.Hex())
+	if store == nil || store.ID.IsZero() {
+		return nil, ErrStoreNotFound
+	}
+	return models.GetDeliverySlotAvailability(store, date)
+}
+
+//UpdateStoreHours sets the opening hours, holidays and delivery slots of a store
+func (r *mutationResolver) UpdateStoreHours(ctx context.Context, storeID primitive.ObjectID, input models.StoreHoursInput) (*models.Store, error) {
+	store := models.GetStoreByID(storeID.Hex())
+	if store == nil || store.ID.IsZero() {
+		return nil, ErrStoreNotFound
+	}
+	hours, err := models.NewStoreHours(input)
+	if err != nil {
+		return nil, err
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	store.Hours = hours
+	store, err = models.UpdateStore(store)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), store.ID.Hex(), "store", store, nil, ctx)
+	return store, nil
+}
+
+//UpdateStoreLocationHours sets the opening hours, holidays and delivery slots of a store location
+func (r *mutationResolver) UpdateStoreLocationHours(ctx context.Context, storeLocationID primitive.ObjectID, input models.StoreHoursInput) (*models.StoreLocation, error) {
+	storeLocation, err := models.GetStoreLocationByID(storeLocationID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if storeLocation == nil {
+		return nil, ErrStoreLocationNotFound
+	}
+	hours, err := models.NewStoreHours(input)
+	if err != nil {
+		return nil, err
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	storeLocation.Hours = hours
+	storeLocation, err = models.UpdateStoreLocation(storeLocation)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), storeLocation.ID.Hex(), "storeLocation", storeLocation, nil, ctx)
+	return storeLocation, nil
+}
@@ -0,0 +1,382 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package resolvers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"github.com/tribehq/platform/lib/audit_log"
+	"github.com/tribehq/platform/models"
+	"github.com/tribehq/platform/utils/auth"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+var (
+	ErrSubscriptionNotFound        = errors.New("subscription not found")
+	ErrSubscriptionInvoiceNotFound = errors.New("subscription invoice not found")
+	ErrSubscriptionNotOwned        = errors.New("subscriptions of other customers need the Subscription:Manage scope")
+)
+
+// callerSubscription gives a subscription by id when it is the caller's or the caller manages subscriptions.
+func callerSubscription(ctx context.Context, id primitive.ObjectID) (*models.Subscription, *models.User, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	subscription := models.GetSubscriptionByID(id.Hex())
+	if subscription.ID.IsZero() {
+		return nil, nil, ErrSubscriptionNotFound
+	}
+	if subscription.CustomerID != user.ID && !models.UserHasScope(user.ID.Hex(), "Subscription:Manage") {
+		return nil, nil, ErrSubscriptionNotFound
+	}
+	return subscription, user, nil
+}
+
+type billingSubscriptionResolver struct{ *Resolver }
+
+//Customer gives the user billed for the subscription
+func (r *billingSubscriptionResolver) Customer(ctx context.Context, obj *models.Subscription) (*models.User, error) {
+	return models.GetUserByID(obj.CustomerID.Hex()), nil
+}
+
+//Plan gives the plan the subscription is billed for
+func (r *billingSubscriptionResolver) Plan(ctx context.Context, obj *models.Subscription) (*models.SubscriptionPlan, error) {
+	return models.GetSubscriptionPlanByID(obj.PlanID.Hex())
+}
+
+//LatestInvoice gives the last invoice of the subscription
+func (r *billingSubscriptionResolver) LatestInvoice(ctx context.Context, obj *models.Subscription) (*models.SubscriptionInvoice, error) {
+	if obj.LatestInvoiceID == nil {
+		return nil, nil
+	}
+	return models.GetSubscriptionInvoiceByID(obj.LatestInvoiceID.Hex())
+}
+
+//SubscriptionPlans gives a list of subscription plans
+func (r *queryResolver) SubscriptionPlans(ctx context.Context, active *bool, after *string, before *string, first *int, last *int) (*models.SubscriptionPlanConnection, error) {
+	var items []*models.SubscriptionPlan
+	var edges []*models.SubscriptionPlanEdge
+	filter := bson.D{}
+	if active != nil {
+		filter = append(filter, bson.E{"active", *active})
+	}
+	limit := 25
+	items, totalCount, hasPrevious, hasNext, err := models.GetSubscriptionPlans(filter, limit, after, before, first, last)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		edge := &models.SubscriptionPlanEdge{
+			Cursor: base64.StdEncoding.EncodeToString([]byte(item.ID.Hex())),
+			Node:   item,
+		}
+		edges = append(edges, edge)
+	}
+
+	pageInfo := &models.PageInfo{}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = edges[0].Cursor
+		pageInfo.EndCursor = edges[len(edges)-1].Cursor
+		pageInfo.HasNextPage = hasNext
+		pageInfo.HasPreviousPage = hasPrevious
+	}
+
+	itemList := &models.SubscriptionPlanConnection{TotalCount: int(totalCount), Edges: edges, Nodes: items, PageInfo: pageInfo}
+	return itemList, nil
+}
+
+//SubscriptionPlan returns a subscription plan by ID
+func (r *queryResolver) SubscriptionPlan(ctx context.Context, id primitive.ObjectID) (*models.SubscriptionPlan, error) {
+	plan, err := models.GetSubscriptionPlanByID(id.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if plan == nil {
+		return nil, models.ErrSubscriptionPlanNotFound
+	}
+	return plan, nil
+}
+
+//BillingSubscriptions gives a list of billing subscriptions
+func (r *queryResolver) BillingSubscriptions(ctx context.Context, customerID *primitive.ObjectID, status *models.SubscriptionStatus, after *string, before *string, first *int, last *int) (*models.BillingSubscriptionConnection, error) {
+	var items []*models.Subscription
+	var edges []*models.BillingSubscriptionEdge
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.D{{"customerID", user.ID}}
+	if customerID != nil && *customerID != user.ID {
+		if !models.UserHasScope(user.ID.Hex(), "Subscription:Manage") {
+			return nil, ErrSubscriptionNotOwned
+		}
+		filter = bson.D{{"customerID", *customerID}}
+	}
+	if status != nil {
+		filter = append(filter, bson.E{"status", *status})
+	}
+	limit := 25
+	items, totalCount, hasPrevious, hasNext, err := models.GetSubscriptions(filter, limit, after, before, first, last)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		edge := &models.BillingSubscriptionEdge{
+			Cursor: base64.StdEncoding.EncodeToString([]byte(item.ID.Hex())),
+			Node:   item,
+		}
+		edges = append(edges, edge)
+	}
+
+	pageInfo := &models.PageInfo{}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = edges[0].Cursor
+		pageInfo.EndCursor = edges[len(edges)-1].Cursor
+		pageInfo.HasNextPage = hasNext
+		pageInfo.HasPreviousPage = hasPrevious
+	}
+
+	itemList := &models.BillingSubscriptionConnection{TotalCount: int(totalCount), Edges: edges, Nodes: items, PageInfo: pageInfo}
+	return itemList, nil
+}
+
+//BillingSubscription returns a billing subscription by ID
+func (r *queryResolver) BillingSubscription(ctx context.Context, id primitive.ObjectID) (*models.Subscription, error) {
+	subscription, _, err := callerSubscription(ctx, id)
+	return subscription, err
+}
+
+//SubscriptionInvoices gives the invoices of a billing subscription
+func (r *queryResolver) SubscriptionInvoices(ctx context.Context, subscriptionID primitive.ObjectID, status *models.SubscriptionInvoiceStatus, after *string, before *string, first *int, last *int) (*models.SubscriptionInvoiceConnection, error) {
+	var items []*models.SubscriptionInvoice
+	var edges []*models.SubscriptionInvoiceEdge
+	_, _, err := callerSubscription(ctx, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+	filter := bson.D{{"subscriptionID", subscriptionID}}
+	if status != nil {
+		filter = append(filter, bson.E{"status", *status})
+	}
+	limit := 25
+	items, totalCount, hasPrevious, hasNext, err := models.GetSubscriptionInvoices(filter, limit, after, before, first, last)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		edge := &models.SubscriptionInvoiceEdge{
+			Cursor: base64.StdEncoding.EncodeToString([]byte(item.ID.Hex())),
+			Node:   item,
+		}
+		edges = append(edges, edge)
+	}
+
+	pageInfo := &models.PageInfo{}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = edges[0].Cursor
+		pageInfo.EndCursor = edges[len(edges)-1].Cursor
+		pageInfo.HasNextPage = hasNext
+		pageInfo.HasPreviousPage = hasPrevious
+	}
+
+	itemList := &models.SubscriptionInvoiceConnection{TotalCount: int(totalCount), Edges: edges, Nodes: items, PageInfo: pageInfo}
+	return itemList, nil
+}
+
+//AddSubscriptionPlan adds a plan customers can subscribe to
+func (r *mutationResolver) AddSubscriptionPlan(ctx context.Context, input models.AddSubscriptionPlanInput) (*models.SubscriptionPlan, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	plan := models.SubscriptionPlan{
+		CreatedBy:      user.ID,
+		Nickname:       input.Nickname,
+		ProductID:      input.ProductID,
+		Active:         true,
+		Currency:       input.Currency,
+		Interval:       input.Interval,
+		IntervalCount:  1,
+		UsageType:      input.UsageType,
+		AggregateUsage: models.SubscriptionPlanAggregateUsageSum,
+		BillingScheme:  input.BillingScheme,
+	}
+	if input.IntervalCount != nil {
+		plan.IntervalCount = *input.IntervalCount
+	}
+	if input.AggregateUsage != nil {
+		plan.AggregateUsage = *input.AggregateUsage
+	}
+	if input.Amount != nil {
+		plan.Amount = *input.Amount
+	}
+	if input.TiersMode != nil {
+		plan.TiersMode = *input.TiersMode
+	}
+	for _, tier := range input.Tiers {
+		plan.Tiers = append(plan.Tiers, models.SubscriptionPlanTier{FlatAmount: tier.FlatAmount, UnitAmount: tier.UnitAmount, UpTo: tier.UpTo})
+	}
+	if input.TransformUsage != nil {
+		plan.TransformUsage = &models.PlanTransformUsage{DivideBy: input.TransformUsage.DivideBy, Round: input.TransformUsage.Round}
+	}
+	if input.TrialPeriodDays != nil {
+		plan.TrialPeriodDays = *input.TrialPeriodDays
+	}
+	err = models.ValidateSubscriptionPlan(&plan)
+	if err != nil {
+		return nil, err
+	}
+	created, err := models.CreateSubscriptionPlan(plan)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Created, user.ID.Hex(), created.ID.Hex(), "subscription plan", created, nil, ctx)
+	return created, nil
+}
+
+//SetSubscriptionPlanActive stops or allows new subscriptions to a plan
+func (r *mutationResolver) SetSubscriptionPlanActive(ctx context.Context, id primitive.ObjectID, active bool) (*models.SubscriptionPlan, error) {
+	plan, err := models.GetSubscriptionPlanByID(id.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if plan == nil {
+		return nil, models.ErrSubscriptionPlanNotFound
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	plan.Active = active
+	updated, err := models.UpdateSubscriptionPlan(plan)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), updated.ID.Hex(), "subscription plan", updated, nil, ctx)
+	return updated, nil
+}
+
+//Subscribe subscribes the logged in user to a plan
+func (r *mutationResolver) Subscribe(ctx context.Context, input models.SubscribeInput) (*models.Subscription, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	subscription := models.Subscription{
+		CreatedBy:  user.ID,
+		CustomerID: user.ID,
+		PlanID:     input.PlanID,
+	}
+	if input.Quantity != nil {
+		subscription.Quantity = *input.Quantity
+	}
+	if input.Billing != nil {
+		subscription.Billing = *input.Billing
+	}
+	if input.DaysUntilDue != nil {
+		subscription.DaysUntilDue = *input.DaysUntilDue
+	}
+	if input.PaymentGateway != nil {
+		subscription.PaymentGateway = *input.PaymentGateway
+	}
+	if input.GatewayCustomerID != nil {
+		subscription.GatewayCustomerID = *input.GatewayCustomerID
+	}
+	if input.PaymentMethodID != nil {
+		subscription.PaymentMethodID = *input.PaymentMethodID
+	}
+	created, err := models.Subscribe(subscription, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Created, user.ID.Hex(), created.ID.Hex(), "subscription", created, nil, ctx)
+	return created, nil
+}
+
+//ChangeSubscriptionPlan moves a subscription to another plan or quantity
+func (r *mutationResolver) ChangeSubscriptionPlan(ctx context.Context, input models.ChangeSubscriptionPlanInput) (*models.Subscription, error) {
+	subscription, user, err := callerSubscription(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := models.GetSubscriptionPlanByID(input.PlanID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if plan == nil {
+		return nil, models.ErrSubscriptionPlanNotFound
+	}
+	updated, err := models.ChangeSubscriptionPlan(subscription, plan, input.Quantity, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), updated.ID.Hex(), "subscription", updated, nil, ctx)
+	return updated, nil
+}
+
+//CancelSubscription cancels a subscription now or at the end of its current period
+func (r *mutationResolver) CancelSubscription(ctx context.Context, id primitive.ObjectID, atPeriodEnd bool) (*models.Subscription, error) {
+	subscription, user, err := callerSubscription(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	canceled, err := models.CancelSubscription(subscription, atPeriodEnd, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Cancelled, user.ID.Hex(), canceled.ID.Hex(), "subscription", canceled, nil, ctx)
+	return canceled, nil
+}
+
+//ReportSubscriptionUsage reports usage of a metered subscription
+func (r *mutationResolver) ReportSubscriptionUsage(ctx context.Context, input models.SubscriptionUsageInput) (*models.SubscriptionUsageRecord, error) {
+	subscription := models.GetSubscriptionByID(input.SubscriptionID.Hex())
+	if subscription.ID.IsZero() {
+		return nil, ErrSubscriptionNotFound
+	}
+	var action models.SubscriptionUsageAction
+	if input.Action != nil {
+		action = *input.Action
+	}
+	timestamp := time.Now()
+	if input.Timestamp != nil {
+		timestamp = *input.Timestamp
+	}
+	return models.RecordSubscriptionUsage(subscription, input.Quantity, action, timestamp)
+}
+
+//MarkSubscriptionInvoicePaid marks a subscription invoice paid outside of automatic charges
+func (r *mutationResolver) MarkSubscriptionInvoicePaid(ctx context.Context, id primitive.ObjectID, paymentGateway string, paymentID string) (*models.SubscriptionInvoice, error) {
+	invoice, err := models.GetSubscriptionInvoiceByID(id.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if invoice == nil {
+		return nil, ErrSubscriptionInvoiceNotFound
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	paid, err := models.PaySubscriptionInvoice(invoice, paymentGateway, paymentID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), paid.ID.Hex(), "subscription invoice", paid, nil, ctx)
+	return paid, nil
+}
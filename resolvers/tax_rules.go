@@ -0,0 +1,128 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package resolvers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"github.com/jinzhu/copier"
+	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/audit_log"
+	"github.com/tribehq/platform/models"
+	"github.com/tribehq/platform/utils/auth"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrTaxRuleNotFound = errors.New("tax rule not found")
+)
+
+//TaxRules gives a list of tax rules
+func (r *queryResolver) TaxRules(ctx context.Context, country *string, taxClass *string, after *string, before *string, first *int, last *int) (*models.TaxRuleConnection, error) {
+	var items []*models.TaxRule
+	var edges []*models.TaxRuleEdge
+	filter := bson.D{}
+	if country != nil {
+		filter = append(filter, bson.E{"country", *country})
+	}
+	if taxClass != nil {
+		filter = append(filter, bson.E{"taxClass", *taxClass})
+	}
+	limit := 25
+	items, totalCount, hasPrevious, hasNext, err := models.GetTaxRules(filter, limit, after, before, first, last)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		edge := &models.TaxRuleEdge{
+			Cursor: base64.StdEncoding.EncodeToString([]byte(item.ID.Hex())),
+			Node:   item,
+		}
+		edges = append(edges, edge)
+	}
+
+	pageInfo := &models.PageInfo{}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = edges[0].Cursor
+		pageInfo.EndCursor = edges[len(edges)-1].Cursor
+		pageInfo.HasNextPage = hasNext
+		pageInfo.HasPreviousPage = hasPrevious
+	}
+
+	itemList := &models.TaxRuleConnection{TotalCount: int(totalCount), Edges: edges, Nodes: items, PageInfo: pageInfo}
+	return itemList, nil
+}
+
+//TaxRule returns a tax rule by ID
+func (r *queryResolver) TaxRule(ctx context.Context, id primitive.ObjectID) (*models.TaxRule, error) {
+	taxRule, err := models.GetTaxRuleByID(id.Hex())
+	if err != nil {
+		log.Errorln(err)
+		return nil, err
+	}
+	if taxRule == nil {
+		return nil, ErrTaxRuleNotFound
+	}
+	return taxRule, nil
+}
+
+//AddTaxRule adds a new tax rule
+func (r *mutationResolver) AddTaxRule(ctx context.Context, input models.AddTaxRuleInput) (*models.TaxRule, error) {
+	taxRule := &models.TaxRule{}
+	_ = copier.Copy(&taxRule, &input)
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	taxRule.CreatedBy = user.ID
+	taxRule, err = models.CreateTaxRule(*taxRule)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Created, user.ID.Hex(), taxRule.ID.Hex(), "tax rule", taxRule, nil, ctx)
+	return taxRule, nil
+}
+
+//UpdateTaxRule updates an existing tax rule
+func (r *mutationResolver) UpdateTaxRule(ctx context.Context, input models.UpdateTaxRuleInput) (*models.TaxRule, error) {
+	taxRule, err := models.GetTaxRuleByID(input.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if taxRule == nil {
+		return nil, ErrTaxRuleNotFound
+	}
+	_ = copier.Copy(&taxRule, &input)
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	taxRule, err = models.UpdateTaxRule(taxRule)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), taxRule.ID.Hex(), "tax rule", taxRule, nil, ctx)
+	return taxRule, nil
+}
+
+//DeleteTaxRule deletes an existing tax rule
+func (r *mutationResolver) DeleteTaxRule(ctx context.Context, id primitive.ObjectID) (*bool, error) {
+	res, err := models.DeleteTaxRuleByID(id.Hex())
+	if err != nil {
+		return nil, err
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Deleted, user.ID.Hex(), id.Hex(), "tax rule", nil, nil, ctx)
+	return &res, nil
+}
@@ -0,0 +1,114 @@
+/*
+ * Copyright (c) 2019. Pandranki Global Private Limited
+ */
+
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"github.com/tribehq/platform/controllers/payments"
+	"github.com/tribehq/platform/lib/audit_log"
+	"github.com/tribehq/platform/models"
+	"github.com/tribehq/platform/utils/auth"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrUPITransactionNotFound = errors.New("upi transaction not found")
+)
+
+//ValidateUPIAddress checks a UPI address exists before collecting from it
+func (r *queryResolver) ValidateUPIAddress(ctx context.Context, vpa string) (*models.UPIAddressValidation, error) {
+	_, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return payments.ValidateUPIAddress(vpa)
+}
+
+//UpiTransaction gives the user's UPI payment by its reference, polling the bank while it is pending
+func (r *queryResolver) UpiTransaction(ctx context.Context, txnRef string) (*models.UPITransaction, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	txn, err := models.GetUPITransactionByRef(txnRef)
+	if err != nil {
+		return nil, err
+	}
+	if txn == nil {
+		return nil, ErrUPITransactionNotFound
+	}
+	//only the customer who is paying can follow the payment
+	_, err = paymentRequestFor(user, txn.OrderID, txn.JobID)
+	if err == ErrOrderNotFound || err == ErrJobNotFound {
+		return nil, ErrUPITransactionNotFound
+	}
+	return payments.PollUPITransaction(txn)
+}
+
+//StoreUPIMerchantAccount gives the UPI address a store collects payments to
+func (r *queryResolver) StoreUPIMerchantAccount(ctx context.Context, storeID primitive.ObjectID) (*models.UPIMerchantAccount, error) {
+	return models.GetStoreUPIMerchantAccount(storeID)
+}
+
+//CreateUPICollectRequest sends a collect request for the user's order or job to their UPI address
+func (r *mutationResolver) CreateUPICollectRequest(ctx context.Context, input models.UPICollectRequestInput) (*models.UPITransaction, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	request, err := paymentRequestFor(user, input.OrderID, input.JobID)
+	if err != nil {
+		return nil, err
+	}
+	txn, err := payments.CreateUPICollectRequest(request, input.Vpa)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Created, user.ID.Hex(), txn.ID.Hex(), "upi transaction", txn, nil, ctx)
+	return txn, nil
+}
+
+//CreateUPIIntent creates the intent link the user pays their order or job with from their UPI app
+func (r *mutationResolver) CreateUPIIntent(ctx context.Context, input models.UPIIntentInput) (*models.UPITransaction, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	request, err := paymentRequestFor(user, input.OrderID, input.JobID)
+	if err != nil {
+		return nil, err
+	}
+	txn, err := payments.CreateUPIIntent(request)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Created, user.ID.Hex(), txn.ID.Hex(), "upi transaction", txn, nil, ctx)
+	return txn, nil
+}
+
+//SetStoreUPIMerchantAccount sets the UPI address of a merchant a store collects payments to
+func (r *mutationResolver) SetStoreUPIMerchantAccount(ctx context.Context, input models.SetStoreUPIMerchantAccountInput) (*models.UPIMerchantAccount, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if models.GetStoreByID(input.StoreID.Hex()) == nil {
+		return nil, ErrStoreNotFound
+	}
+	name := ""
+	if input.Name != nil {
+		name = *input.Name
+	}
+	account, err := models.SetStoreUPIMerchantAccount(input.StoreID, input.Mid, input.Vpa, name)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), account.ID.Hex(), "store upi merchant account", account, nil, ctx)
+	return account, nil
+}
@@ -28,6 +28,10 @@ import (
 	"time"
 )
 
+var (
+	ErrUserNotFound = errors.New("user not found")
+)
+
 //BlockUser returns a block user by ID
 func (r *mutationResolver) BlockUser(ctx context.Context, id primitive.ObjectID) (*bool, error) {
 	user := models.GetUserByID(id.Hex())
@@ -85,10 +89,13 @@ func (r *userResolver) RoleGroups(ctx context.Context, obj *models.User) ([]*mod
 }
 
 //Users gives a list of users
-func (r *queryResolver) Users(ctx context.Context, userType *models.UserSearchType, text *string, userStatus *models.UserStatus, after *string, before *string, first *int, last *int) (*models.UserConnection, error) {
+func (r *queryResolver) Users(ctx context.Context, userType *models.UserSearchType, text *string, userStatus *models.UserStatus, qualityFlagged *bool, after *string, before *string, first *int, last *int) (*models.UserConnection, error) {
 	var items []*models.User
 	var edges []*models.UserEdge
 	filter := bson.D{}
+	if qualityFlagged != nil {
+		filter = append(filter, bson.E{"rating.qualityFlagged", *qualityFlagged})
+	}
 	limit := 25
 	items, totalCount, hasPrevious, hasNext, err := models.GetUsers(filter, limit, after, before, first, last)
 	if err != nil {
@@ -103,7 +110,13 @@ func (r *queryResolver) Users(ctx context.Context, userType *models.UserSearchTy
 		edges = append(edges, edge)
 	}
 
-	pageInfo := getPageInfo(edges[0].Cursor, edges[len(edges)-1].Cursor, len(edges), hasNext, hasPrevious)
+	pageInfo := &models.PageInfo{}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = edges[0].Cursor
+		pageInfo.EndCursor = edges[len(edges)-1].Cursor
+		pageInfo.HasNextPage = hasNext
+		pageInfo.HasPreviousPage = hasPrevious
+	}
 	itemList := &models.UserConnection{TotalCount: int(totalCount), Edges: edges, Nodes: items, PageInfo: pageInfo}
 	return itemList, nil
 }
@@ -168,7 +181,7 @@ func (r *mutationResolver) AddUser(ctx context.Context, input models.AddUserInpu
 }
 
 //SignUpWithEmail lets you sign up with email address
-func (r *mutationResolver) SignUpWithEmail(ctx context.Context, input models.UserSignUpDetails) (*models.AuthPayload, error) {
+func (r *mutationResolver) SignUpWithEmail(ctx context.Context, input models.UserSignUpDetails, guestCartTokens []string) (*models.AuthPayload, error) {
 	db := database.MongoDB
 	var user models.User
 	if input.MobileNo != nil && input.Password != "" {
@@ -213,6 +226,7 @@ func (r *mutationResolver) SignUpWithEmail(ctx context.Context, input models.Use
 		if err != nil {
 			log.Errorln(err)
 		}
+		mergeGuestCarts(guestCartTokens, user.ID)
 		////Send verification SMS
 		//sent, err := msg91.SendMessage("Welcome to Tribe! "+user.OTP+" is your Verification OTP.", true, strings.TrimPrefix(user.MobileNo, "+"))
 		//if !sent || err != nil {
@@ -256,7 +270,7 @@ func (r *mutationResolver) UpdateUser(ctx context.Context, input models.UpdateUs
 }
 
 //LoginWithCredentials checks your credentials and logs in
-func (r *mutationResolver) LoginWithCredentials(ctx context.Context, email string, password string) (*models.AuthPayload, error) {
+func (r *mutationResolver) LoginWithCredentials(ctx context.Context, email string, password string, guestCartTokens []string) (*models.AuthPayload, error) {
 	db := database.MongoDB
 
 	var user models.User
@@ -287,6 +301,7 @@ func (r *mutationResolver) LoginWithCredentials(ctx context.Context, email strin
 		}
 
 		//utils.SendLoginMail(db, utils.LoginTemplate{Name: user.FirstName, IPAddress: ctx.Request().RemoteAddr, Client: ctx.Request().UserAgent(), TimeStamp: time.Now().Format(utils.TimeLayout)}, utils.EmailRequest{To: user.Email, From: utils.SUPPORT_EMAIL})
+		mergeGuestCarts(guestCartTokens, user.ID)
 
 		authPayload := &models.AuthPayload{
 			Token: t,
@@ -365,7 +380,7 @@ func (r *mutationResolver) RequestLoginOtp(ctx context.Context, countryCode stri
 }
 
 //VerifyLoginOtp verifies your one time password
-func (r *mutationResolver) VerifyLoginOtp(ctx context.Context, countryCode string, mobileNo string, otp string) (*models.AuthPayload, error) {
+func (r *mutationResolver) VerifyLoginOtp(ctx context.Context, countryCode string, mobileNo string, otp string, guestCartTokens []string) (*models.AuthPayload, error) {
 	var user models.User
 	db := database.ConnectMongo()
 	if mobileNo != "" && otp != "" {
@@ -402,6 +417,7 @@ func (r *mutationResolver) VerifyLoginOtp(ctx context.Context, countryCode strin
 				return nil, errors.New("internal server error")
 			}
 			//utils.SendLoginMail(db, utils.LoginTemplate{Name: user.FirstName, IPAddress: ctx.Request().RemoteAddr, Client: ctx.Request().UserAgent(), TimeStamp: time.Now().Format(utils.TimeLayout)}, utils.EmailRequest{To: user.Email, From: utils.SUPPORT_EMAIL})
+			mergeGuestCarts(guestCartTokens, user.ID)
 			authPayload := &models.AuthPayload{
 				Token: t,
 				User:  &user,
@@ -973,3 +989,23 @@ func (r *mutationResolver) UnAssignUserRolePermission(ctx context.Context, permi
 	go audit_log.NewAuditLogWithCtx(models.Unassigned, user.ID.Hex(), roleID.Hex(), "user role permission", nil, nil, ctx)
 	return true, nil
 }
+
+//ClearUserQualityFlag clears the quality flag of a user once ops reviewed it
+func (r *mutationResolver) ClearUserQualityFlag(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	flaggedUser := models.GetUserByID(id.Hex())
+	if flaggedUser == nil {
+		return nil, ErrUserNotFound
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	models.ReviewQualityFlag(&flaggedUser.Rating, user.ID)
+	flaggedUser, err = models.UpdateUser(flaggedUser)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), id.Hex(), "user quality flag", flaggedUser.Rating, nil, ctx)
+	return flaggedUser, nil
+}
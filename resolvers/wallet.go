@@ -7,13 +7,36 @@ package resolvers
 import (
 	"context"
 	"encoding/base64"
+	"errors"
+	"github.com/jinzhu/copier"
 	log "github.com/sirupsen/logrus"
+	"github.com/tribehq/platform/lib/audit_log"
 	"github.com/tribehq/platform/models"
+	"github.com/tribehq/platform/utils/auth"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"time"
 )
 
+var (
+	ErrWithdrawalNotFound = errors.New("withdrawal not found")
+	ErrWalletNotOwned     = errors.New("wallets of others need the Wallet:Manage scope")
+	ErrWithdrawalNotOwned = errors.New("withdrawals of other providers need the Withdrawal:Review scope")
+)
+
+//callerProviderID gives the service provider of the current user, nil when they aren't one
+func callerProviderID(ctx context.Context) (*primitive.ObjectID, primitive.ObjectID, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, primitive.NilObjectID, err
+	}
+	provider := models.GetServiceProviderByFilter(bson.D{{"user", user.ID}})
+	if provider == nil || provider.ID.IsZero() {
+		return nil, user.ID, nil
+	}
+	return &provider.ID, user.ID, nil
+}
+
 //Wallet Payments & Bill Payments
 type walletTransactionResolver struct{ *Resolver }
 
@@ -37,14 +60,42 @@ func (r *queryResolver) Withdrawal(ctx context.Context, id primitive.ObjectID) (
 		log.Errorln(err)
 		return nil, err
 	}
+	if withdrawal == nil {
+		return nil, ErrWithdrawalNotFound
+	}
+	callerProvider, userID, err := callerProviderID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if (callerProvider == nil || *callerProvider != withdrawal.ProviderID) && !models.UserHasScope(userID.Hex(), "Withdrawal:Review") {
+		return nil, ErrWithdrawalNotOwned
+	}
 	return withdrawal, nil
 }
 
-//Withdrawals returns a list of withdrawals
-func (r *queryResolver) Withdrawals(ctx context.Context, after *string, before *string, first *int, last *int) (*models.WithdrawalConnection, error) {
+//Withdrawals returns a list of withdrawals, those of the current provider unless another provider is asked for
+func (r *queryResolver) Withdrawals(ctx context.Context, status *models.WithdrawalStatus, providerID *primitive.ObjectID, after *string, before *string, first *int, last *int) (*models.WithdrawalConnection, error) {
 	var items []*models.Withdrawal
 	var edges []*models.WithdrawalEdge
+	callerProvider, userID, err := callerProviderID(ctx)
+	if err != nil {
+		return nil, err
+	}
 	filter := bson.D{}
+	if providerID != nil {
+		if (callerProvider == nil || *callerProvider != *providerID) && !models.UserHasScope(userID.Hex(), "Withdrawal:Review") {
+			return nil, ErrWithdrawalNotOwned
+		}
+		filter = append(filter, bson.E{"providerID", *providerID})
+	} else {
+		if callerProvider == nil {
+			return nil, ErrServiceProviderNotFound
+		}
+		filter = append(filter, bson.E{"providerID", *callerProvider})
+	}
+	if status != nil {
+		filter = append(filter, bson.E{"status", *status})
+	}
 	limit := 25
 	items, totalCount, hasPrevious, hasNext, err := models.GetWithdrawals(filter, limit, after, before, first, last)
 	if err != nil {
@@ -59,7 +110,13 @@ func (r *queryResolver) Withdrawals(ctx context.Context, after *string, before *
 		edges = append(edges, edge)
 	}
 
-	pageInfo := getPageInfo(edges[0].Cursor, edges[len(edges)-1].Cursor, len(edges), hasNext, hasPrevious)
+	pageInfo := &models.PageInfo{}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = edges[0].Cursor
+		pageInfo.EndCursor = edges[len(edges)-1].Cursor
+		pageInfo.HasNextPage = hasNext
+		pageInfo.HasPreviousPage = hasPrevious
+	}
 
 	itemList := &models.WithdrawalConnection{TotalCount: int(totalCount), Edges: edges, Nodes: items, PageInfo: pageInfo}
 	return itemList, nil
@@ -138,11 +195,250 @@ func (r *queryResolver) ProviderWalletTransactions(ctx context.Context, fromDate
 // withdrawalResolver is of type struct.
 type withdrawalResolver struct{ *Resolver }
 
-//PaymentMethod returns payment method used for withdrawal.
-func (r *withdrawalResolver) PaymentMethod(ctx context.Context, obj *models.Withdrawal) (models.PaymentMethodType, error) {
-	paymentMethod, err := models.GetPaymentMethodByID(obj.ID.Hex())
+//BankAccount returns the bank account the withdrawal is paid to.
+func (r *withdrawalResolver) BankAccount(ctx context.Context, obj *models.Withdrawal) (*models.BankAccountDetails, error) {
+	bankAccount, err := models.GetBankAccountByID(obj.BankAccountID.Hex())
+	if err != nil || bankAccount == nil {
+		return nil, err
+	}
+	bankAccountDetails := &models.BankAccountDetails{}
+	_ = copier.Copy(&bankAccountDetails, &bankAccount)
+	return bankAccountDetails, nil
+}
+
+//UserWallet returns the wallet of the current user
+func (r *queryResolver) UserWallet(ctx context.Context) (*models.Wallet, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return models.GetOrCreateWallet(user.ID.Hex(), models.WalletTypeUser)
+}
+
+//WalletPostings gives a list of the postings of a wallet
+func (r *queryResolver) WalletPostings(ctx context.Context, walletID primitive.ObjectID, after *string, before *string, first *int, last *int) (*models.WalletPostingConnection, error) {
+	var items []*models.WalletPosting
+	var edges []*models.WalletPostingEdge
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	wallet, err := models.GetWalletByID(walletID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if wallet == nil || wallet.ID.IsZero() {
+		return nil, models.ErrWalletNotFound
+	}
+	if !models.WalletOwnedBy(wallet, user.ID) && !models.UserHasScope(user.ID.Hex(), "Wallet:Manage") {
+		return nil, ErrWalletNotOwned
+	}
+	filter := bson.D{{"entries.walletID", walletID}}
+	limit := 25
+	items, totalCount, hasPrevious, hasNext, err := models.GetWalletPostings(filter, limit, after, before, first, last)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range items {
+		edge := &models.WalletPostingEdge{
+			Cursor: base64.StdEncoding.EncodeToString([]byte(item.ID.Hex())),
+			Node:   item,
+		}
+		edges = append(edges, edge)
+	}
+
+	pageInfo := &models.PageInfo{}
+	if len(edges) > 0 {
+		pageInfo.StartCursor = edges[0].Cursor
+		pageInfo.EndCursor = edges[len(edges)-1].Cursor
+		pageInfo.HasNextPage = hasNext
+		pageInfo.HasPreviousPage = hasPrevious
+	}
+
+	itemList := &models.WalletPostingConnection{TotalCount: int(totalCount), Edges: edges, Nodes: items, PageInfo: pageInfo}
+	return itemList, nil
+}
+
+//HoldJobWalletPayment holds the fare of a job on the wallet of its customer until it is completed
+func (r *mutationResolver) HoldJobWalletPayment(ctx context.Context, jobID primitive.ObjectID) (*models.WalletHold, error) {
+	job, err := models.GetJobByID(jobID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, ErrJobNotFound
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if job.UserID != user.ID.Hex() && !models.UserHasScope(user.ID.Hex(), "Wallet:Manage") {
+		return nil, ErrWalletNotOwned
+	}
+	hold, err := models.HoldJobFare(job)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Created, user.ID.Hex(), hold.ID.Hex(), "wallet hold", hold, nil, ctx)
+	return hold, nil
+}
+
+//ReleaseJobWalletPayment gives the wallet balance held for a job back to its customer
+func (r *mutationResolver) ReleaseJobWalletPayment(ctx context.Context, jobID primitive.ObjectID) (*models.WalletHold, error) {
+	job, err := models.GetJobByID(jobID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, ErrJobNotFound
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if job.UserID != user.ID.Hex() && !models.UserHasScope(user.ID.Hex(), "Wallet:Manage") {
+		return nil, ErrWalletNotOwned
+	}
+	hold, err := models.ReleaseJobFare(job)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), hold.ID.Hex(), "wallet hold", hold, nil, ctx)
+	return hold, nil
+}
+
+//ReverseWalletPosting posts the opposite entries of a wallet posting
+func (r *mutationResolver) ReverseWalletPosting(ctx context.Context, id primitive.ObjectID, description string) (*models.WalletPosting, error) {
+	posting, err := models.GetWalletPostingByID(id.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if posting == nil {
+		return nil, models.ErrWalletPostingNotFound
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reversal, err := models.ReverseWalletPosting(posting, description, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Created, user.ID.Hex(), reversal.ID.Hex(), "wallet posting", reversal, nil, ctx)
+	return reversal, nil
+}
+
+//RequestWithdrawal asks to pay an amount of the current provider's wallet balance to their bank account
+func (r *mutationResolver) RequestWithdrawal(ctx context.Context, amount float64) (*models.Withdrawal, error) {
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	provider := models.GetServiceProviderByFilter(bson.D{{"user", user.ID}})
+	if provider == nil || provider.ID.IsZero() {
+		return nil, ErrServiceProviderNotFound
+	}
+	bankAccount, err := models.GetBankAccountByID(provider.BankDetails.Hex())
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	withdrawal, err := models.RequestWithdrawal(provider, bankAccount, amount, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Created, user.ID.Hex(), withdrawal.ID.Hex(), "withdrawal", withdrawal, nil, ctx)
+	return withdrawal, nil
+}
+
+//ApproveWithdrawal approves a pending withdrawal, paying it through its payout provider
+func (r *mutationResolver) ApproveWithdrawal(ctx context.Context, id primitive.ObjectID) (*models.Withdrawal, error) {
+	withdrawal, err := models.GetWithdrawalByID(id.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if withdrawal == nil {
+		return nil, ErrWithdrawalNotFound
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	approved, err := models.ApproveWithdrawal(withdrawal, user.ID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), approved.ID.Hex(), "withdrawal", approved, nil, ctx)
+	return approved, nil
+}
+
+//RejectWithdrawal rejects a pending withdrawal, giving the held funds back to the provider
+func (r *mutationResolver) RejectWithdrawal(ctx context.Context, id primitive.ObjectID, reason string) (*models.Withdrawal, error) {
+	withdrawal, err := models.GetWithdrawalByID(id.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if withdrawal == nil {
+		return nil, ErrWithdrawalNotFound
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rejected, err := models.RejectWithdrawal(withdrawal, user.ID, reason, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), rejected.ID.Hex(), "withdrawal", rejected, nil, ctx)
+	return rejected, nil
+}
+
+//CompleteWithdrawal marks an approved withdrawal paid by a manual bank transfer
+func (r *mutationResolver) CompleteWithdrawal(ctx context.Context, id primitive.ObjectID, payoutReference string) (*models.Withdrawal, error) {
+	withdrawal, err := models.GetWithdrawalByID(id.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if withdrawal == nil {
+		return nil, ErrWithdrawalNotFound
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	paid, err := models.CompleteWithdrawal(withdrawal, payoutReference, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), paid.ID.Hex(), "withdrawal", paid, nil, ctx)
+	return paid, nil
+}
+
+//FailWithdrawal records that the bank transfer of an approved withdrawal failed
+func (r *mutationResolver) FailWithdrawal(ctx context.Context, id primitive.ObjectID, reason string) (*models.Withdrawal, error) {
+	withdrawal, err := models.GetWithdrawalByID(id.Hex())
+	if err != nil {
+		return nil, err
+	}
+	if withdrawal == nil {
+		return nil, ErrWithdrawalNotFound
+	}
+	user, err := auth.ForContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	failed, err := models.FailWithdrawal(withdrawal, reason)
+	if err != nil {
+		return nil, err
 	}
-	return paymentMethod.Type, nil
+	//Update audit log
+	go audit_log.NewAuditLogWithCtx(models.Updated, user.ID.Hex(), failed.ID.Hex(), "withdrawal", failed, nil, ctx)
+	return failed, nil
 }